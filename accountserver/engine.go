@@ -20,19 +20,23 @@ import (
 	"crypto/md5"
 	"encoding/xml"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/fs"
 )
 
 var (
 	// ErrorNoSuchAccount is returned when a requested account doesn't exist.
-	ErrorNoSuchAccount = fmt.Errorf("No such account.")
+	ErrorNoSuchAccount error = &common.BackendError{StatusCode: http.StatusNotFound, Message: "No such account."}
 	// ErrorInvalidMetadata is returned for errors that violate the API metadata constraints.
-	ErrorInvalidMetadata = fmt.Errorf("Invalid metadata value")
+	ErrorInvalidMetadata error = &common.BackendError{StatusCode: http.StatusBadRequest, Message: "Invalid metadata value"}
+	// ErrorDeletedLater is returned when an account is put with a timestamp older than its deletion.
+	ErrorDeletedLater error = &common.BackendError{StatusCode: http.StatusConflict, Message: "Account was deleted later"}
 )
 
 // AccountInfo represents the container_info database record - basic information about the container.
@@ -153,6 +157,8 @@ type ReplicableAccount interface {
 	CleanupTombstones(reclaimAge int64) error
 	// RingHash returns the account's ring hash.
 	RingHash() string
+	// Audit checks the database for corruption, quarantining it if it finds any, and for negative stats.
+	Audit() error
 }
 
 // AccountEngine is the interface of an object that creates and returns accounts.
@@ -21,7 +21,6 @@ package accountserver
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -55,7 +54,6 @@ import (
 )
 
 var (
-	errDeviceNotMounted = errors.New("Remove drive was unmounted")
 	deviceLockupTimeout = time.Hour
 	// GetRing is a local pointer to the hummingbird function, for overriding in tests.
 	GetRing = ring.GetRing
@@ -80,6 +78,8 @@ type Replicator struct {
 	keyFile           string
 	runningDevices    map[string]*replicationDevice
 	reclaimAge        int64
+	auditRate         float64
+	auditInterval     time.Duration
 	logLevel          zap.AtomicLevel
 	metricsCloser     io.Closer
 	traceCloser       io.Closer
@@ -151,11 +151,11 @@ func (rd *replicationDevice) sync(dev *ring.Device, part uint64, ringHash string
 		info.ID, info.CreatedAt, info.PutTimestamp, info.DeleteTimestamp, info.RawMetadata)
 	if err != nil {
 		return nil, fmt.Errorf("sending sync request to %s/%s: %v", dev.Ip, dev.Device, err)
-	} else if status == http.StatusNotFound {
+	} else if err := common.StatusError(status); common.IsNotFound(err) {
 		return nil, nil
-	} else if status == http.StatusInsufficientStorage {
-		return nil, errDeviceNotMounted
-	} else if status/100 != 2 {
+	} else if common.IsInsufficientStorage(err) {
+		return nil, common.ErrDiskUnmounted
+	} else if err != nil {
 		return nil, fmt.Errorf("bad status code %d", status)
 	}
 	if err := json.Unmarshal(body, &remoteInfo); err != nil {
@@ -368,7 +368,7 @@ func (rd *replicationDevice) replicateDatabase(dbFile string) error {
 				zap.String("Ip", devices[i].Ip),
 				zap.String("Device", devices[i].Device),
 				zap.Error(err))
-			if err == errDeviceNotMounted && !handoff {
+			if common.IsDiskUnmounted(err) && !handoff {
 				next := moreNodes.Next()
 				if next == nil {
 					rd.r.logger.Error("Ran out of handoffs to talk to.",
@@ -482,6 +482,66 @@ func (rd *replicationDevice) replicateLoop() {
 	}
 }
 
+// auditDatabase audits one database, which is quarantined if it's corrupt.
+// Negative stats are only counted, to show up in the replicator's stats.
+func (rd *replicationDevice) auditDatabase(dbFile string) error {
+	db, err := sqliteOpenAccount(dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rd.i.incrementStat("audited")
+	if err := db.Audit(); err != nil {
+		if _, ok := err.(*negativeStatsError); ok {
+			rd.i.incrementStat("audit_negative_stats")
+		} else {
+			rd.i.incrementStat("audit_failed")
+		}
+		return err
+	}
+	return nil
+}
+
+// audit runs a pass of auditDatabase over the device's databases, at no more
+// than auditRate a second.
+func (rd *replicationDevice) audit() {
+	devicePath := filepath.Join(rd.r.deviceRoot, rd.dev.Device)
+	if mount, err := fs.IsMount(devicePath); rd.r.checkMounts && (err != nil || !mount) {
+		rd.r.logger.Error("Device not mounted.",
+			zap.String("devicePath", devicePath), zap.Error(err))
+		return
+	}
+	pause := time.Duration(float64(time.Second) / rd.r.auditRate)
+	results := make(chan string, 100)
+	go rd.i.findAccountDbs(devicePath, results)
+	for dbFile := range results {
+		if err := rd.auditDatabase(dbFile); err != nil {
+			rd.r.logger.Error("Error auditing database file.",
+				zap.String("dbFile", dbFile),
+				zap.Error(err))
+		}
+		select {
+		case <-rd.cancel:
+			return
+		case <-time.After(pause):
+		}
+	}
+}
+
+// auditLoop audits the device's databases, starting a pass no more often
+// than every auditInterval.
+func (rd *replicationDevice) auditLoop() {
+	for {
+		start := time.Now()
+		rd.audit()
+		select {
+		case <-rd.cancel:
+			return
+		case <-time.After(rd.r.auditInterval - time.Since(start)):
+		}
+	}
+}
+
 func (rd *replicationDevice) incrementStat(stat string) {
 	rd.r.sendStat <- statUpdate{rd.dev.Device, stat, 1}
 }
@@ -618,6 +678,9 @@ func (r *Replicator) verifyDevices() {
 		if _, ok := r.runningDevices[dev.Device]; !ok {
 			r.runningDevices[dev.Device] = newReplicationDevice(dev, r)
 			go r.runningDevices[dev.Device].replicateLoop()
+			if r.auditRate > 0 {
+				go r.runningDevices[dev.Device].auditLoop()
+			}
 		}
 	}
 	// look for devices that are running but shouldn't be
@@ -640,10 +703,9 @@ func (r *Replicator) reportStats() {
 	aggStats := map[string]int64{"attempted": 0, "success": 0, "failure": 0, "remove": 0}
 	for _, device := range r.runningDevices {
 		totalTime += time.Since(device.runStarted)
-		aggStats["attempted"] += device.stats["attempted"]
-		aggStats["success"] += device.stats["success"]
-		aggStats["failure"] += device.stats["failure"]
-		aggStats["remove"] += device.stats["remove"]
+		for _, stat := range []string{"attempted", "success", "failure", "remove", "audited", "audit_failed", "audit_negative_stats"} {
+			aggStats[stat] += device.stats[stat]
+		}
 	}
 	// there's no longer the concept of a single pass, so we report the average running time.
 	if len(r.runningDevices) > 0 {
@@ -662,6 +724,12 @@ func (r *Replicator) reportStats() {
 		r.logger.Info("Sucess & Failure",
 			zap.Int64("success", aggStats["success"]),
 			zap.Int64("failure", aggStats["failure"]))
+		if r.auditRate > 0 {
+			r.logger.Info("Audited dbs",
+				zap.Int64("audited", aggStats["audited"]),
+				zap.Int64("failed", aggStats["audit_failed"]),
+				zap.Int64("negativeStats", aggStats["audit_negative_stats"]))
+		}
 	} else {
 		r.logger.Info("No devices replicating.")
 	}
@@ -970,6 +1038,8 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 		deviceRoot:     serverconf.GetDefault("account-replicator", "devices", "/srv/node"),
 		serverPort:     port,
 		reclaimAge:     serverconf.GetInt("account-replicator", "reclaim_age", 604800),
+		auditRate:      serverconf.GetFloat("account-replicator", "audit_dbs_per_second", 0),
+		auditInterval:  time.Duration(serverconf.GetInt("account-replicator", "audit_interval", 86400)) * time.Second,
 		logger:         logger,
 		concurrencySem: make(chan struct{}, concurrency),
 		Ring:           ring,
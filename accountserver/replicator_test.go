@@ -226,6 +226,9 @@ func (f fakeDatabase) CleanupTombstones(reclaimAge int64) error {
 func (f fakeDatabase) CheckSyncLink() error {
 	return errors.New("")
 }
+func (f fakeDatabase) Audit() error {
+	return errors.New("")
+}
 func (f fakeDatabase) PutContainer(name string, putTimestamp string, deleteTimestamp string, objectCount int64, bytesUsed int64, storagePolicyIndex int) error {
 	return errors.New("")
 }
@@ -296,7 +299,7 @@ func TestReplicatorSyncUnmounted(t *testing.T) {
 	defer cleanup()
 	rd := newTestReplicationDevice(&ring.Device{}, &Replicator{client: http.DefaultClient})
 	_, err := rd.sync(dev, 1, "00000000000000000000000000000000", &AccountInfo{})
-	require.Equal(t, err, errDeviceNotMounted)
+	require.Equal(t, err, common.ErrDiskUnmounted)
 }
 
 func TestReplicatorRsync(t *testing.T) {
@@ -778,7 +781,7 @@ func TestReplicateSyncOnMessageError(t *testing.T) {
 	}
 	rinfo, err = rd.sync(&ring.Device{}, 1, "SOMEHASH", &AccountInfo{})
 	require.Nil(t, rinfo)
-	require.Equal(t, err, errDeviceNotMounted)
+	require.Equal(t, err, common.ErrDiskUnmounted)
 
 	rd._sendReplicationMessage = func(dev *ring.Device, part uint64, ringHash string, args ...interface{}) (int, []byte, error) {
 		return 500, []byte{}, nil
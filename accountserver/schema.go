@@ -149,7 +149,6 @@ const (
 
 	pragmaScript = `
 		PRAGMA synchronous = NORMAL;
-		PRAGMA cache_size = -4096;
 		PRAGMA temp_store = MEMORY;
 		PRAGMA journal_mode = WAL;
 		PRAGMA busy_timeout = 25000;`
@@ -79,6 +79,16 @@ func (server *AccountServer) Type() string {
 	return "account"
 }
 
+// Reload applies the settings that can be changed without a restart.
+func (server *AccountServer) Reload(config conf.Config) ([]string, error) {
+	if changed, err := srv.ReloadLogLevel(server.logLevel, config, "app:account-server"); err != nil {
+		return nil, err
+	} else if changed {
+		return []string{"app:account-server/log_level"}, nil
+	}
+	return nil, nil
+}
+
 func (server *AccountServer) Background(flags *flag.FlagSet) chan struct{} {
 	return nil
 }
@@ -100,7 +110,7 @@ func (server *AccountServer) AccountGetHandler(writer http.ResponseWriter, reque
 		return
 	}
 	db, err := server.accountEngine.Get(vars)
-	if err == ErrorNoSuchAccount {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -271,7 +281,10 @@ func (server *AccountServer) AccountPutHandler(writer http.ResponseWriter, reque
 		}
 	}
 	created, db, err := server.accountEngine.Create(vars, timestamp, metadata)
-	if err != nil {
+	if common.IsConflict(err) {
+		srv.StandardResponse(writer, http.StatusConflict)
+		return
+	} else if err != nil {
 		srv.GetLogger(request).Error("Unable to create database.", zap.Error(err))
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
@@ -288,7 +301,7 @@ func (server *AccountServer) AccountPutHandler(writer http.ResponseWriter, reque
 func (server *AccountServer) AccountDeleteHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := srv.GetVars(request)
 	db, err := server.accountEngine.Get(vars)
-	if err == ErrorNoSuchAccount {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -337,7 +350,7 @@ func (server *AccountServer) AccountPostHandler(writer http.ResponseWriter, requ
 		}
 	}
 	db, err := server.accountEngine.Get(vars)
-	if err == ErrorNoSuchAccount {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -388,7 +401,7 @@ func (server *AccountServer) ContainerPutHandler(writer http.ResponseWriter, req
 	}
 	deleteTimestamp := request.Header.Get("X-Delete-Timestamp")
 	db, err := server.accountEngine.Get(vars)
-	if err == ErrorNoSuchAccount {
+	if common.IsNotFound(err) {
 		if strings.HasPrefix(vars["account"], server.autoCreatePrefix) {
 			if _, db, err = server.accountEngine.Create(vars, putTimestamp, map[string][]string{}); err != nil {
 				srv.GetLogger(request).Error("Unable to auto-create account.", zap.Error(err))
@@ -415,6 +428,9 @@ func (server *AccountServer) ContainerPutHandler(writer http.ResponseWriter, req
 
 // HealthcheckHandler implements a basic health check, that just returns "OK".
 func (server *AccountServer) HealthcheckHandler(writer http.ResponseWriter, request *http.Request) {
+	if middleware.InMaintenance(server.reconCachePath) {
+		writer.Header().Set(middleware.MaintenanceHeader, "true")
+	}
 	writer.Header().Set("Content-Length", "2")
 	writer.WriteHeader(http.StatusOK)
 	writer.Write([]byte("OK"))
@@ -425,6 +441,11 @@ func (server *AccountServer) ReconHandler(writer http.ResponseWriter, request *h
 	middleware.ReconHandler(server.driveRoot, server.reconCachePath, server.checkMounts, writer, request)
 }
 
+// MaintenanceHandler delegates incoming /maintenance calls to the common maintenance handler.
+func (server *AccountServer) MaintenanceHandler(writer http.ResponseWriter, request *http.Request) {
+	middleware.MaintenanceHandler(server.reconCachePath, writer, request)
+}
+
 // DiskUsageHandler returns information on the current outstanding HTTP requests per-disk.
 func (server *AccountServer) DiskUsageHandler(writer http.ResponseWriter, request *http.Request) {
 	if data, err := server.diskInUse.MarshalJSON(); err == nil {
@@ -508,6 +529,9 @@ func (server *AccountServer) GetHandler(config conf.Config, metricsPrefix string
 	router.Put("/ring/*ring_path", commonHandlers.ThenFunc(middleware.RingHandler))
 	router.Get("/recon/:method/:recon_type", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Get("/recon/:method", commonHandlers.ThenFunc(server.ReconHandler))
+	router.Get("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Put("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Delete("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
 	router.Delete("/recon/:device/:method/:recon_type/*item_path", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Get("/debug/pprof/:parm", http.DefaultServeMux)
 	router.Post("/debug/pprof/:parm", http.DefaultServeMux)
@@ -543,6 +567,8 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 	server.reconCachePath = serverconf.GetDefault("app:account-server", "recon_cache_path", "/var/cache/swift")
 	server.checkMounts = serverconf.GetBool("app:account-server", "mount_check", true)
 	server.diskInUse = common.NewKeyedLimit(serverconf.GetLimit("app:account-server", "disk_limit", 0, 0))
+	dbCacheSize = serverconf.GetInt("app:account-server", "db_cache_size", 4096)
+	dbMmapSize = serverconf.GetInt("app:account-server", "db_mmap_size", 0)
 	bindIP := serverconf.GetDefault("app:account-server", "bind_ip", "0.0.0.0")
 	bindPort := int(serverconf.GetInt("app:account-server", "bind_port", common.DefaultAccountServerPort))
 	certFile := serverconf.GetDefault("app:account-server", "cert_file", "")
@@ -70,6 +70,14 @@ func chexor(old, name, timestamp string) string {
 	return hex.EncodeToString(digest)
 }
 
+// dbCacheSize (in KiB) and dbMmapSize (in bytes) size the page cache and
+// memory mapped I/O of each database connection; they're set from the
+// server's config before any databases are opened.
+var (
+	dbCacheSize int64 = 4096
+	dbMmapSize  int64
+)
+
 func init() {
 	// register our sql driver with user-defined chexor function
 	sql.Register("sqlite3_account",
@@ -81,6 +89,9 @@ func init() {
 				if _, err := conn.Exec(pragmaScript, nil); err != nil {
 					return err
 				}
+				if _, err := conn.Exec(fmt.Sprintf("PRAGMA cache_size = -%d; PRAGMA mmap_size = %d;", dbCacheSize, dbMmapSize), nil); err != nil {
+					return err
+				}
 				if _, err := conn.Exec(`CREATE TEMPORARY VIEW IF NOT EXISTS maxrowid (max) AS
 				  						SELECT IFNULL(MAX(seq), -1) FROM sqlite_sequence WHERE name='container'`, nil); err != nil {
 					return err
@@ -226,7 +237,8 @@ func (db *sqliteAccount) Remove() error {
 }
 
 // Delete sets the account's deleted timestamp and tombstones any metadata older than that timestamp.
-// This may or may not make the account "deleted".
+// This may or may not make the account "deleted": it won't if the account was put again since.  If it
+// does, the status_changed_at is set to timestamp.
 func (db *sqliteAccount) Delete(timestamp string) error {
 	if err := db.connect(); err != nil {
 		return err
@@ -236,9 +248,9 @@ func (db *sqliteAccount) Delete(timestamp string) error {
 		return err
 	}
 	defer tx.Rollback()
-	var deleteTimestamp, metastr string
+	var putTimestamp, deleteTimestamp, statusChangedAt, metastr string
 	var metadata map[string][]string
-	if err := tx.QueryRow("SELECT delete_timestamp, metadata FROM account_stat").Scan(&deleteTimestamp, &metastr); err != nil {
+	if err := tx.QueryRow("SELECT put_timestamp, delete_timestamp, status_changed_at, metadata FROM account_stat").Scan(&putTimestamp, &deleteTimestamp, &statusChangedAt, &metastr); err != nil {
 		if common.IsCorruptDBError(err) {
 			return fmt.Errorf("Failed to Delete SELECT: %v; %v", err, common.QuarantineDir(path.Dir(db.accountFile), 4, "accounts"))
 		}
@@ -259,7 +271,10 @@ func (db *sqliteAccount) Delete(timestamp string) error {
 	if err != nil {
 		return err
 	}
-	if _, err = tx.Exec("UPDATE account_stat SET delete_timestamp = ?, metadata = ?", timestamp, string(serializedMetadata)); err != nil {
+	if deleteTimestamp <= putTimestamp && timestamp > putTimestamp {
+		statusChangedAt = timestamp
+	}
+	if _, err = tx.Exec("UPDATE account_stat SET delete_timestamp = ?, status_changed_at = ?, metadata = ?", timestamp, statusChangedAt, string(serializedMetadata)); err != nil {
 		if common.IsCorruptDBError(err) {
 			return fmt.Errorf("Failed to Delete UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(db.accountFile), 4, "accounts"))
 		}
@@ -372,11 +387,7 @@ func (db *sqliteAccount) mergeItems(records []*ContainerRecord, remoteID string)
 			if er.DeleteTimestamp > record.DeleteTimestamp {
 				record.DeleteTimestamp = er.DeleteTimestamp
 			}
-			if record.DeleteTimestamp > record.PutTimestamp {
-				record.Deleted = 1
-			} else {
-				record.Deleted = 0
-			}
+			record.Deleted = containerDeleted(record.PutTimestamp, record.DeleteTimestamp, record.ObjectCount)
 		}
 		if res, err := ast.Exec(record.Name, record.PutTimestamp, record.DeleteTimestamp, record.ObjectCount,
 			record.BytesUsed, record.Deleted, record.StoragePolicyIndex); err != nil {
@@ -825,9 +836,9 @@ func (db *sqliteAccount) SyncRemoteData(maxRow int64, hash, id, createdAt, putTi
 		return nil, err
 	}
 	defer tx.Rollback()
-	var localMeta, localHash, localDeleteTimestamp string
+	var localMeta, localHash, localPutTimestamp, localDeleteTimestamp, statusChangedAt string
 	var localPoint int64
-	if err := tx.QueryRow("SELECT hash, metadata, delete_timestamp FROM account_stat").Scan(&localHash, &localMeta, &localDeleteTimestamp); err != nil {
+	if err := tx.QueryRow("SELECT hash, metadata, put_timestamp, delete_timestamp, status_changed_at FROM account_stat").Scan(&localHash, &localMeta, &localPutTimestamp, &localDeleteTimestamp, &statusChangedAt); err != nil {
 		if common.IsCorruptDBError(err) {
 			return nil, fmt.Errorf("Failed to SyncRemoteData SELECT: %v; %v", err, common.QuarantineDir(path.Dir(db.accountFile), 4, "accounts"))
 		}
@@ -840,13 +851,22 @@ func (db *sqliteAccount) SyncRemoteData(maxRow int64, hash, id, createdAt, putTi
 	if err := json.Unmarshal([]byte(localMeta), &lm); err != nil {
 		return nil, err
 	}
+	wasDeleted := localDeleteTimestamp > localPutTimestamp
 	if deleteTimestamp > localDeleteTimestamp {
 		localDeleteTimestamp = deleteTimestamp
 	}
+	if putTimestamp > localPutTimestamp {
+		localPutTimestamp = putTimestamp
+	}
+	if wasDeleted != (localDeleteTimestamp > localPutTimestamp) {
+		// As in Swift, the status changed when this merge noticed, not
+		// when the put or delete behind it happened.
+		statusChangedAt = common.GetTimestamp()
+	}
 	metastr, err := db.mergeMetas(lm, rm, localDeleteTimestamp)
 	if _, err = tx.Exec(`UPDATE account_stat SET created_at=MIN(?, created_at), put_timestamp=MAX(?, put_timestamp),
-	  					 delete_timestamp=MAX(?, delete_timestamp), metadata=?`,
-		createdAt, putTimestamp, deleteTimestamp, metastr); err != nil {
+	  					 delete_timestamp=MAX(?, delete_timestamp), status_changed_at=?, metadata=?`,
+		createdAt, putTimestamp, deleteTimestamp, statusChangedAt, metastr); err != nil {
 		if common.IsCorruptDBError(err) {
 			return nil, fmt.Errorf("Failed to SyncRemoteData UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(db.accountFile), 4, "accounts"))
 		}
@@ -925,6 +945,104 @@ func (db *sqliteAccount) OpenDatabaseFile() (*os.File, func(), error) {
 	return fp, cleanup, nil
 }
 
+// negativeStatsError is what Audit returns for a database whose stats have
+// gone negative.
+type negativeStatsError struct {
+	problem string
+}
+
+func (e *negativeStatsError) Error() string {
+	return "Failed audit: " + e.problem
+}
+
+// Audit checks the database with sqlite's integrity_check, quarantining it if
+// that fails so replication will bring back a good copy from another replica.
+// It also makes sure the database's container, object and byte counts aren't negative,
+// returning a *negativeStatsError if they are.  That comes from updates
+// applied out of order, which the other replicas have likely seen too, so the
+// database is left where it is.
+func (db *sqliteAccount) Audit() error {
+	if err := db.connect(); err != nil {
+		return err
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	problem, err := db.integrityProblem()
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		db.Close()
+		return fmt.Errorf("Failed audit: %s; %v", problem, common.QuarantineDir(path.Dir(db.accountFile), 4, "accounts"))
+	}
+	if problem, err = db.statsProblem(); err != nil || problem == "" {
+		return err
+	}
+	return &negativeStatsError{problem: problem}
+}
+
+// integrityProblem returns what sqlite's integrity_check found wrong with the
+// database, or "" if nothing.
+func (db *sqliteAccount) integrityProblem() (string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		if common.IsCorruptDBError(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		if common.IsCorruptDBError(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	rows.Close()
+	if len(problems) > 0 {
+		return "integrity_check: " + strings.Join(problems, "; "), nil
+	}
+	return "", nil
+}
+
+// statsProblem returns which of the database's stats are negative, or "" if
+// none are.
+func (db *sqliteAccount) statsProblem() (string, error) {
+	info, err := db.GetInfo()
+	if err != nil {
+		return "", err
+	}
+	if info.ContainerCount < 0 || info.ObjectCount < 0 || info.BytesUsed < 0 {
+		return fmt.Sprintf("negative stats: %d containers, %d objects, %d bytes", info.ContainerCount, info.ObjectCount, info.BytesUsed), nil
+	}
+	var negatives int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM policy_stat WHERE container_count < 0 OR object_count < 0 OR bytes_used < 0").Scan(&negatives); err != nil {
+		return "", err
+	}
+	if negatives > 0 {
+		return fmt.Sprintf("negative stats for %d policies", negatives), nil
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM container WHERE object_count < 0 OR bytes_used < 0").Scan(&negatives); err != nil {
+		return "", err
+	}
+	if negatives > 0 {
+		return fmt.Sprintf("%d containers with negative stats", negatives), nil
+	}
+	return "", nil
+}
+
 // Ping verifies the underlying sqlite file hasn't gone away.
 func (db *sqliteAccount) Ping() error {
 	lock, err := fs.LockPath(filepath.Dir(db.accountFile), dirLockTimeout)
@@ -1025,6 +1143,17 @@ func int64MaybeStringified(i interface{}) (int64, bool) {
 	}
 }
 
+// containerDeleted returns the deleted flag for a container record: 1 if its
+// last delete came after its last put and it has no objects left, as in Swift.
+// A container deleted and put again on one replica, or still holding objects
+// on another, then converges to not deleted whichever report arrives first.
+func containerDeleted(putTimestamp, deleteTimestamp string, objectCount int64) int {
+	if deleteTimestamp > putTimestamp && objectCount == 0 {
+		return 1
+	}
+	return 0
+}
+
 // PutContainer adds a container to the account, by way of pending file.
 func (db *sqliteAccount) PutContainer(name string, putTimestamp string, deleteTimestamp string, objectCount int64, bytesUsed int64, storagePolicyIndex int) error {
 	lock, err := fs.LockPath(filepath.Dir(db.accountFile), dirLockTimeout)
@@ -1032,10 +1161,7 @@ func (db *sqliteAccount) PutContainer(name string, putTimestamp string, deleteTi
 		return err
 	}
 	defer lock.Close()
-	deleted := 0
-	if deleteTimestamp > putTimestamp {
-		deleted = 1
-	}
+	deleted := containerDeleted(putTimestamp, deleteTimestamp, objectCount)
 	tuple := []interface{}{name, putTimestamp, deleteTimestamp, objectCount, bytesUsed, deleted, storagePolicyIndex}
 	file, err := os.OpenFile(db.accountFile+".pending", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
@@ -1089,14 +1215,25 @@ func sqliteCreateExistingAccount(db Account, putTimestamp string, newMetadata ma
 		return false, err
 	}
 	defer tx.Rollback()
-	var cDeleteTimestamp, cPutTimestamp, cMetadata string
-	row := tx.QueryRow("SELECT put_timestamp, delete_timestamp, metadata FROM account_stat")
-	if err := row.Scan(&cPutTimestamp, &cDeleteTimestamp, &cMetadata); err != nil {
+	var cDeleteTimestamp, cPutTimestamp, cStatusChangedAt, cMetadata string
+	row := tx.QueryRow("SELECT put_timestamp, delete_timestamp, status_changed_at, metadata FROM account_stat")
+	if err := row.Scan(&cPutTimestamp, &cDeleteTimestamp, &cStatusChangedAt, &cMetadata); err != nil {
 		if common.IsCorruptDBError(err) {
 			return false, fmt.Errorf("Failed to sqliteCreateExistingAccount SELECT: %v; %v", err, common.QuarantineDir(path.Dir(cdb.accountFile), 4, "accounts"))
 		}
 		return false, err
 	}
+	recreated := false
+	if cDeleteTimestamp > cPutTimestamp {
+		if putTimestamp <= cDeleteTimestamp {
+			return false, ErrorDeletedLater
+		}
+		recreated = true
+		cStatusChangedAt = putTimestamp
+	}
+	if putTimestamp < cPutTimestamp {
+		putTimestamp = cPutTimestamp
+	}
 	var existingMetadata map[string][]string
 	if cMetadata == "" {
 		existingMetadata = make(map[string][]string)
@@ -1107,8 +1244,8 @@ func sqliteCreateExistingAccount(db Account, putTimestamp string, newMetadata ma
 	if err != nil {
 		return false, err
 	}
-	if _, err := tx.Exec("UPDATE account_stat SET put_timestamp = ?, metadata = ?",
-		putTimestamp, metastr); err != nil {
+	if _, err := tx.Exec("UPDATE account_stat SET put_timestamp = ?, status_changed_at = ?, metadata = ?",
+		putTimestamp, cStatusChangedAt, metastr); err != nil {
 		if common.IsCorruptDBError(err) {
 			return false, fmt.Errorf("Failed to sqliteCreateExistingAccount UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(cdb.accountFile), 4, "accounts"))
 		}
@@ -1121,7 +1258,7 @@ func sqliteCreateExistingAccount(db Account, putTimestamp string, newMetadata ma
 		}
 		return false, err
 	}
-	return (cDeleteTimestamp > cPutTimestamp && putTimestamp > cDeleteTimestamp), nil
+	return recreated, nil
 }
 
 func sqliteCreateAccount(accountFile string, account string, putTimestamp string, metadata map[string][]string) error {
@@ -246,6 +246,37 @@ func TestCreateExisting(t *testing.T) {
 	})
 }
 
+func TestCreateExistingRecreate(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("200000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+
+	require.Nil(t, db.Delete("200000002.00000"))
+	info, err := db.GetInfo()
+	require.Nil(t, err)
+	require.Equal(t, "200000002.00000", info.StatusChangedAt)
+
+	_, err = sqliteCreateExistingAccount(db, "200000001.00000", map[string][]string{})
+	require.Equal(t, ErrorDeletedLater, err)
+
+	c, err := sqliteCreateExistingAccount(db, "200000003.00000", map[string][]string{})
+	require.Nil(t, err)
+	require.True(t, c)
+	info, err = db.GetInfo()
+	require.Nil(t, err)
+	require.Equal(t, "200000003.00000", info.PutTimestamp)
+	require.Equal(t, "200000003.00000", info.StatusChangedAt)
+	deleted, err := db.IsDeleted()
+	require.Nil(t, err)
+	require.False(t, deleted)
+}
+
+func TestContainerDeleted(t *testing.T) {
+	require.Equal(t, 0, containerDeleted("200000001.00000", "200000000.00000", 0))
+	require.Equal(t, 1, containerDeleted("200000000.00000", "200000001.00000", 0))
+	require.Equal(t, 0, containerDeleted("200000000.00000", "200000001.00000", 3))
+}
+
 func TestInt64MaybeStringified(t *testing.T) {
 	i, ok := int64MaybeStringified(nil)
 	if ok {
@@ -470,3 +501,21 @@ func TestSqliteRename(t *testing.T) {
 		require.Equal(t, data, []byte("a data"))
 	}
 }
+
+func TestAudit(t *testing.T) {
+	db, dbFile, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, mergeItemsByName(db, []string{"a", "b"}))
+	require.Nil(t, db.Audit())
+	require.True(t, fs.Exists(dbFile))
+	_, err = db.Exec("UPDATE container SET object_count = -1 WHERE name = 'a'")
+	require.Nil(t, err)
+	err = db.Audit()
+	require.NotNil(t, err)
+	_, ok := err.(*negativeStatsError)
+	require.True(t, ok)
+	require.True(t, strings.Contains(err.Error(), "negative"))
+	// negative stats aren't corruption, so the database stays put
+	require.True(t, fs.Exists(dbFile))
+}
@@ -22,6 +22,9 @@ type RequestClient interface {
 	GetContainerRaw(ctx context.Context, account string, container string, options map[string]string, headers http.Header) *http.Response
 	GetContainerInfo(ctx context.Context, account string, container string) (*ContainerInfo, error)
 	SetContainerInfo(ctx context.Context, account string, container string, resp *http.Response) (*ContainerInfo, error)
+	// InvalidateContainerInfo drops the container's info from the caches
+	// GetContainerInfo reads, so the next call goes to the container servers.
+	InvalidateContainerInfo(ctx context.Context, account string, container string)
 	HeadContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response
 	DeleteContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response
 	PutObject(ctx context.Context, account string, container string, obj string, headers http.Header, src io.Reader) *http.Response
@@ -0,0 +1,185 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+// deviceUtilization is what a server last reported about one of its devices.
+type deviceUtilization struct {
+	avail int64
+	inUse int64
+}
+
+// deviceStats keeps the free space and in use request counts the object
+// servers report for their devices, so handoffs can be chosen from the
+// least loaded devices instead of in ring order.
+type deviceStats struct {
+	lock    sync.RWMutex
+	devices map[string]deviceUtilization
+}
+
+func newDeviceStats() *deviceStats {
+	return &deviceStats{devices: map[string]deviceUtilization{}}
+}
+
+func deviceStatsKey(dev *ring.Device) string {
+	return fmt.Sprintf("%s:%d/%s", dev.Ip, dev.Port, dev.Device)
+}
+
+func (ds *deviceStats) get(dev *ring.Device) (deviceUtilization, bool) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+	u, ok := ds.devices[deviceStatsKey(dev)]
+	return u, ok
+}
+
+// sort orders devs with the fewest requests in use first and, among those,
+// the most free space first.  Devices with no stats keep their ring order
+// after those that have them.
+func (ds *deviceStats) sort(devs []*ring.Device) {
+	type ranked struct {
+		dev   *ring.Device
+		u     deviceUtilization
+		known bool
+	}
+	r := make([]ranked, len(devs))
+	for i, dev := range devs {
+		u, ok := ds.get(dev)
+		r[i] = ranked{dev: dev, u: u, known: ok}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		if r[i].known != r[j].known {
+			return r[i].known
+		}
+		if r[i].u.inUse != r[j].u.inUse {
+			return r[i].u.inUse < r[j].u.inUse
+		}
+		return r[i].u.avail > r[j].u.avail
+	})
+	for i := range r {
+		devs[i] = r[i].dev
+	}
+}
+
+func getJSON(client common.HTTPClient, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// update asks each server with one of devs for its devices' free space, from
+// /recon/diskusage, and requests in use, from /diskusage.  Devices of servers
+// that don't answer are forgotten.
+func (ds *deviceStats) update(client common.HTTPClient, devs []*ring.Device, logger srv.LowLevelLogger) {
+	servers := map[string]*ring.Device{}
+	for _, dev := range devs {
+		if dev != nil {
+			servers[fmt.Sprintf("%s:%d", dev.Ip, dev.Port)] = dev
+		}
+	}
+	devices := map[string]deviceUtilization{}
+	for server, dev := range servers {
+		var usage []struct {
+			Device  string `json:"device"`
+			Mounted bool   `json:"mounted"`
+			Avail   int64  `json:"avail"`
+		}
+		if err := getJSON(client, fmt.Sprintf("%s://%s/recon/diskusage", dev.Scheme, server), &usage); err != nil {
+			logger.Debug("Unable to get disk usage", zap.String("server", server), zap.Error(err))
+			continue
+		}
+		inUse := map[string]int64{}
+		if err := getJSON(client, fmt.Sprintf("%s://%s/diskusage", dev.Scheme, server), &inUse); err != nil {
+			logger.Debug("Unable to get requests in use", zap.String("server", server), zap.Error(err))
+		}
+		for _, u := range usage {
+			if u.Mounted {
+				devices[server+"/"+u.Device] = deviceUtilization{avail: u.Avail, inUse: inUse[u.Device]}
+			}
+		}
+	}
+	ds.lock.Lock()
+	ds.devices = devices
+	ds.lock.Unlock()
+}
+
+// run updates the stats for the devices of rings every interval.
+func (ds *deviceStats) run(client common.HTTPClient, rings []ringFilter, interval time.Duration, logger srv.LowLevelLogger) {
+	for {
+		var devs []*ring.Device
+		for _, r := range rings {
+			devs = append(devs, r.ring().AllDevices()...)
+		}
+		ds.update(client, devs, logger)
+		time.Sleep(interval)
+	}
+}
+
+// utilizationMoreNodes hands out handoffs from more, looking window devices
+// ahead and choosing the least loaded of them each time.
+type utilizationMoreNodes struct {
+	mutex   sync.Mutex
+	more    ring.MoreNodes
+	stats   *deviceStats
+	window  int
+	pending []*ring.Device
+}
+
+func (u *utilizationMoreNodes) Next() *ring.Device {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for len(u.pending) < u.window {
+		dev := u.more.Next()
+		if dev == nil {
+			break
+		}
+		u.pending = append(u.pending, dev)
+	}
+	if len(u.pending) == 0 {
+		return nil
+	}
+	u.stats.sort(u.pending)
+	var dev *ring.Device
+	dev, u.pending = u.pending[0], u.pending[1:]
+	return dev
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func TestDeviceStatsUpdate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/recon/diskusage":
+			fmt.Fprint(w, `[{"device": "sda", "mounted": true, "avail": 100}, {"device": "sdb", "mounted": true, "avail": 500}, {"device": "sdc", "mounted": false, "avail": 0}]`)
+		case "/diskusage":
+			fmt.Fprint(w, `{"sda": 2}`)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.Nil(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.Nil(t, err)
+	sda := &ring.Device{Scheme: "http", Ip: u.Hostname(), Port: port, Device: "sda"}
+	sdb := &ring.Device{Scheme: "http", Ip: u.Hostname(), Port: port, Device: "sdb"}
+	sdc := &ring.Device{Scheme: "http", Ip: u.Hostname(), Port: port, Device: "sdc"}
+	down := &ring.Device{Scheme: "http", Ip: "127.0.0.1", Port: 1, Device: "sda"}
+
+	ds := newDeviceStats()
+	ds.update(http.DefaultClient, []*ring.Device{sda, sdb, sdc, down}, zap.NewNop())
+	util, ok := ds.get(sda)
+	require.True(t, ok)
+	require.Equal(t, deviceUtilization{avail: 100, inUse: 2}, util)
+	util, ok = ds.get(sdb)
+	require.True(t, ok)
+	require.Equal(t, deviceUtilization{avail: 500}, util)
+	_, ok = ds.get(sdc)
+	require.False(t, ok)
+	_, ok = ds.get(down)
+	require.False(t, ok)
+}
+
+func TestUtilizationHandoffs(t *testing.T) {
+	ds := newDeviceStats()
+	ds.devices = map[string]deviceUtilization{
+		":0/sdd": {avail: 10},
+		":0/sde": {avail: 1000, inUse: 4},
+		":0/sdf": {avail: 500},
+	}
+	r := &test.FakeRing{
+		MockDevices: []*ring.Device{
+			{Id: 0, Device: "sda"},
+			{Id: 1, Device: "sdb"},
+			{Id: 2, Device: "sdc"},
+		},
+		MockGetMoreNodes: &listMoreNodes{devs: []*ring.Device{
+			{Id: 3, Device: "sdd"},
+			{Id: 4, Device: "sde"},
+			{Id: 5, Device: "sdf"},
+			{Id: 6, Device: "sdg"},
+		}},
+	}
+	a := newClientRingFilter(r, "", "", "", 0)
+	a.handoffStats = ds
+	a.handoffWindow = 3
+	devs, more := a.getWriteNodes(1)
+	require.Equal(t, []int{0, 1, 2}, []int{devs[0].Id, devs[1].Id, devs[2].Id})
+	require.Equal(t, 5, more.Next().Id)
+	require.Equal(t, 3, more.Next().Id)
+	require.Equal(t, 4, more.Next().Id)
+	require.Nil(t, more.Next())
+}
@@ -0,0 +1,104 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type dnsCacheEntry struct {
+	addrs   []string
+	fetched time.Time
+}
+
+// dnsCache remembers what backend hostnames resolved to, so rings that name
+// servers by hostname don't cost a lookup for every new connection.  Answers
+// are kept for ttl regardless of the records' own TTLs, and if a lookup fails
+// the last answer keeps being used for up to staleTTL past that, so a DNS
+// outage doesn't take the backends with it.
+type dnsCache struct {
+	lock     sync.Mutex
+	entries  map[string]*dnsCacheEntry
+	ttl      time.Duration
+	staleTTL time.Duration
+	lookup   func(ctx context.Context, host string) ([]string, error)
+}
+
+func newDNSCache(ttl, staleTTL time.Duration) *dnsCache {
+	return &dnsCache{
+		entries:  map[string]*dnsCacheEntry{},
+		ttl:      ttl,
+		staleTTL: staleTTL,
+		lookup:   net.DefaultResolver.LookupHost,
+	}
+}
+
+// resolve returns the addresses for host, which is returned as is if it's
+// already an IP address.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	c.lock.Lock()
+	entry := c.entries[host]
+	c.lock.Unlock()
+	now := time.Now()
+	if entry != nil && now.Sub(entry.fetched) < c.ttl {
+		return entry.addrs, nil
+	}
+	addrs, err := c.lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		if entry != nil && now.Sub(entry.fetched) < c.ttl+c.staleTTL {
+			return entry.addrs, nil
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "no addresses", Name: host}
+		}
+		return nil, err
+	}
+	c.lock.Lock()
+	c.entries[host] = &dnsCacheEntry{addrs: addrs, fetched: now}
+	c.lock.Unlock()
+	return addrs, nil
+}
+
+// cachingDialer resolves hostnames through a dnsCache before handing the
+// address to dial, trying each address in turn.
+type cachingDialer struct {
+	cache *dnsCache
+	dial  func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (d *cachingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return d.dial(ctx, network, addr)
+	}
+	addrs, err := d.cache.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		var conn net.Conn
+		if conn, err = d.dial(ctx, network, net.JoinHostPort(a, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
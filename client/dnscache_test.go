@@ -0,0 +1,88 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSCache(t *testing.T) {
+	lookups := 0
+	var lookupErr error
+	c := newDNSCache(time.Minute, time.Hour)
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+
+	addrs, err := c.resolve(context.Background(), "10.1.1.1")
+	require.Nil(t, err)
+	require.Equal(t, []string{"10.1.1.1"}, addrs)
+	require.Equal(t, 0, lookups)
+
+	for i := 0; i < 2; i++ {
+		addrs, err = c.resolve(context.Background(), "storage1")
+		require.Nil(t, err)
+		require.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, addrs)
+	}
+	require.Equal(t, 1, lookups)
+
+	// Past the ttl, a failed lookup still gets the stale answer.
+	c.entries["storage1"].fetched = time.Now().Add(-2 * time.Minute)
+	lookupErr = errors.New("no dns")
+	addrs, err = c.resolve(context.Background(), "storage1")
+	require.Nil(t, err)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, addrs)
+	require.Equal(t, 2, lookups)
+
+	// But not forever.
+	c.entries["storage1"].fetched = time.Now().Add(-2 * time.Hour)
+	_, err = c.resolve(context.Background(), "storage1")
+	require.NotNil(t, err)
+
+	_, err = c.resolve(context.Background(), "storage2")
+	require.NotNil(t, err)
+}
+
+func TestCachingDialer(t *testing.T) {
+	c := newDNSCache(time.Minute, time.Hour)
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+	var dialed []string
+	d := &cachingDialer{cache: c, dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "10.0.0.1:6000" {
+			return nil, errors.New("refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}}
+	conn, err := d.DialContext(context.Background(), "tcp", "storage1:6000")
+	require.Nil(t, err)
+	conn.Close()
+	require.Equal(t, []string{"10.0.0.1:6000", "10.0.0.2:6000"}, dialed)
+}
@@ -0,0 +1,257 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+// nodeHealth keeps which backend servers failed their last health check, so
+// requests can go to other nodes instead of waiting on ones known to be down.
+// It also keeps which servers said they're on a node in maintenance; reads try
+// those last and writes go to handoffs instead.  With trackDown false, only
+// maintenance is kept and servers that can't be reached are left as they were.
+type nodeHealth struct {
+	lock        sync.RWMutex
+	down        map[string]bool
+	maintenance map[string]bool
+	timeout     time.Duration
+	trackDown   bool
+}
+
+func newNodeHealth(timeout time.Duration, trackDown bool) *nodeHealth {
+	return &nodeHealth{down: map[string]bool{}, maintenance: map[string]bool{}, timeout: timeout, trackDown: trackDown}
+}
+
+func nodeHealthKey(dev *ring.Device) string {
+	return fmt.Sprintf("%s:%d", dev.Ip, dev.Port)
+}
+
+func (nh *nodeHealth) isDown(dev *ring.Device) bool {
+	nh.lock.RLock()
+	defer nh.lock.RUnlock()
+	return nh.down[nodeHealthKey(dev)]
+}
+
+func (nh *nodeHealth) anyDown() bool {
+	nh.lock.RLock()
+	defer nh.lock.RUnlock()
+	return len(nh.down) > 0
+}
+
+func (nh *nodeHealth) inMaintenance(dev *ring.Device) bool {
+	nh.lock.RLock()
+	defer nh.lock.RUnlock()
+	return nh.maintenance[nodeHealthKey(dev)]
+}
+
+func (nh *nodeHealth) anyMaintenance() bool {
+	nh.lock.RLock()
+	defer nh.lock.RUnlock()
+	return len(nh.maintenance) > 0
+}
+
+// avoid reports whether writes should go elsewhere than dev.
+func (nh *nodeHealth) avoid(dev *ring.Device) bool {
+	nh.lock.RLock()
+	defer nh.lock.RUnlock()
+	key := nodeHealthKey(dev)
+	return nh.down[key] || nh.maintenance[key]
+}
+
+// ping asks a server's /healthcheck whether it's up, and whether its node is
+// in maintenance.  The response is read to the end so the connection goes back
+// to the client's idle pool, ready for the next request to that server.
+func (nh *nodeHealth) ping(client common.HTTPClient, url string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), nh.timeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return common.LooksTrue(resp.Header.Get("X-Backend-Maintenance")), nil
+}
+
+// check pings every server with one of devs at once and records which are
+// down and which are in maintenance, logging servers as they change.
+func (nh *nodeHealth) check(client common.HTTPClient, devs []*ring.Device, logger srv.LowLevelLogger) {
+	servers := map[string]*ring.Device{}
+	for _, dev := range devs {
+		if dev != nil {
+			servers[nodeHealthKey(dev)] = dev
+		}
+	}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	down := map[string]bool{}
+	maintenance := map[string]bool{}
+	for server, dev := range servers {
+		wg.Add(1)
+		go func(server string, dev *ring.Device) {
+			defer wg.Done()
+			inMaintenance, err := nh.ping(client, fmt.Sprintf("%s://%s/healthcheck", dev.Scheme, server))
+			if err != nil && !nh.trackDown {
+				if nh.inMaintenance(dev) {
+					lock.Lock()
+					maintenance[server] = true
+					lock.Unlock()
+				}
+				return
+			} else if err != nil {
+				if !nh.isDown(dev) {
+					logger.Error("Backend server failed health check", zap.String("server", server), zap.Error(err))
+				}
+				lock.Lock()
+				down[server] = true
+				lock.Unlock()
+				return
+			} else if nh.isDown(dev) {
+				logger.Info("Backend server passed health check", zap.String("server", server))
+			}
+			if inMaintenance != nh.inMaintenance(dev) {
+				logger.Info("Backend server maintenance changed", zap.String("server", server), zap.Bool("maintenance", inMaintenance))
+			}
+			if inMaintenance {
+				lock.Lock()
+				maintenance[server] = true
+				lock.Unlock()
+			}
+		}(server, dev)
+	}
+	wg.Wait()
+	nh.lock.Lock()
+	nh.down = down
+	nh.maintenance = maintenance
+	nh.lock.Unlock()
+}
+
+// run checks the servers of rings every interval.
+func (nh *nodeHealth) run(client common.HTTPClient, rings []ringFilter, interval time.Duration, logger srv.LowLevelLogger) {
+	for {
+		var devs []*ring.Device
+		for _, r := range rings {
+			devs = append(devs, r.ring().AllDevices()...)
+		}
+		nh.check(client, devs, logger)
+		time.Sleep(interval)
+	}
+}
+
+// healthyMoreNodes hands out devices from more, holding back those skip says
+// to avoid until more runs out.
+type healthyMoreNodes struct {
+	mutex    sync.Mutex
+	more     ring.MoreNodes
+	skip     func(*ring.Device) bool
+	deferred []*ring.Device
+}
+
+func (h *healthyMoreNodes) nextHealthy() *ring.Device {
+	for dev := h.more.Next(); dev != nil; dev = h.more.Next() {
+		if !h.skip(dev) {
+			return dev
+		}
+		h.deferred = append(h.deferred, dev)
+	}
+	return nil
+}
+
+func (h *healthyMoreNodes) Next() *ring.Device {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if dev := h.nextHealthy(); dev != nil {
+		return dev
+	}
+	if len(h.deferred) > 0 {
+		var dev *ring.Device
+		dev, h.deferred = h.deferred[0], h.deferred[1:]
+		return dev
+	}
+	return nil
+}
+
+// skipNodes replaces any of devs that skip says to avoid with devices from
+// more, if there are any. Devices passed over are only handed out by the
+// returned MoreNodes after everything else, as a last resort.
+func skipNodes(devs []*ring.Device, more ring.MoreNodes, skip func(*ring.Device) bool) ([]*ring.Device, ring.MoreNodes) {
+	result := make([]*ring.Device, len(devs))
+	copy(result, devs)
+	h := &healthyMoreNodes{more: more, skip: skip}
+	for i, dev := range result {
+		if dev == nil || !skip(dev) {
+			continue
+		}
+		if handoff := h.nextHealthy(); handoff != nil {
+			result[i] = handoff
+			h.deferred = append(h.deferred, dev)
+		}
+	}
+	return result, h
+}
+
+// skipUnhealthy orders devs for reading: devices on servers that are down are
+// replaced with healthy devices from more, and those on nodes in maintenance
+// are moved to the end so they're only read from if the others can't answer.
+func skipUnhealthy(devs []*ring.Device, more ring.MoreNodes, health *nodeHealth) ([]*ring.Device, ring.MoreNodes) {
+	if health == nil {
+		return devs, more
+	}
+	if health.anyMaintenance() {
+		ordered := make([]*ring.Device, 0, len(devs))
+		var last []*ring.Device
+		for _, dev := range devs {
+			if dev != nil && health.inMaintenance(dev) {
+				last = append(last, dev)
+			} else {
+				ordered = append(ordered, dev)
+			}
+		}
+		devs = append(ordered, last...)
+	}
+	if !health.anyDown() {
+		return devs, more
+	}
+	return skipNodes(devs, more, health.isDown)
+}
+
+// skipUnavailable replaces any of devs on servers that are down or on nodes
+// in maintenance with devices from more, so writes land on handoffs instead.
+func skipUnavailable(devs []*ring.Device, more ring.MoreNodes, health *nodeHealth) ([]*ring.Device, ring.MoreNodes) {
+	if health == nil || (!health.anyDown() && !health.anyMaintenance()) {
+		return devs, more
+	}
+	return skipNodes(devs, more, health.avoid)
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func testServerDevice(t *testing.T, ts *httptest.Server) *ring.Device {
+	u, err := url.Parse(ts.URL)
+	require.Nil(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.Nil(t, err)
+	return &ring.Device{Scheme: "http", Ip: u.Hostname(), Port: port, Device: "sda"}
+}
+
+func TestNodeHealthCheck(t *testing.T) {
+	var paths []string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("OK"))
+	}))
+	defer up.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	upDev := testServerDevice(t, up)
+	unavailableDev := testServerDevice(t, unavailable)
+	deadDev := &ring.Device{Scheme: "http", Ip: "127.0.0.1", Port: 1, Device: "sda"}
+
+	nh := newNodeHealth(time.Second, true)
+	nh.check(http.DefaultClient, []*ring.Device{upDev, upDev, unavailableDev, deadDev}, zap.NewNop())
+	require.Equal(t, []string{"/healthcheck"}, paths)
+	require.False(t, nh.isDown(upDev))
+	require.True(t, nh.isDown(unavailableDev))
+	require.True(t, nh.isDown(deadDev))
+
+	nh.check(http.DefaultClient, []*ring.Device{upDev}, zap.NewNop())
+	require.False(t, nh.anyDown())
+}
+
+func TestUnhealthyNodesSkipped(t *testing.T) {
+	nh := newNodeHealth(time.Second, true)
+	nh.down = map[string]bool{":2": true, ":5": true}
+	r := &test.FakeRing{
+		MockDevices: []*ring.Device{
+			{Id: 0, Port: 1},
+			{Id: 1, Port: 2},
+			{Id: 2, Port: 3},
+		},
+		MockGetMoreNodes: &listMoreNodes{devs: []*ring.Device{
+			{Id: 3, Port: 4},
+			{Id: 4, Port: 5},
+			{Id: 5, Port: 6},
+			{Id: 6, Port: 7},
+		}},
+	}
+	a := newClientRingFilter(r, "", "", "", 0)
+	a.health = nh
+	devs, more := a.getWriteNodes(1)
+	require.Equal(t, []int{0, 3, 2}, []int{devs[0].Id, devs[1].Id, devs[2].Id})
+	require.Equal(t, 5, more.Next().Id)
+	require.Equal(t, 1, more.Next().Id)
+	require.Equal(t, 4, more.Next().Id)
+	require.Nil(t, more.Next())
+}
+
+func TestMaintenanceNodesAvoided(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Maintenance", "true")
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+	dev := testServerDevice(t, ts)
+	nh := newNodeHealth(time.Second, true)
+	nh.check(http.DefaultClient, []*ring.Device{dev}, zap.NewNop())
+	require.False(t, nh.isDown(dev))
+	require.True(t, nh.inMaintenance(dev))
+
+	nh.maintenance = map[string]bool{":1": true}
+	r := &test.FakeRing{
+		MockDevices: []*ring.Device{
+			{Id: 0, Port: 1},
+			{Id: 1, Port: 2},
+			{Id: 2, Port: 3},
+		},
+		MockGetMoreNodes: &listMoreNodes{devs: []*ring.Device{
+			{Id: 3, Port: 4},
+			{Id: 4, Port: 5},
+		}},
+	}
+	a := newClientRingFilter(r, "", "", "", 0)
+	a.health = nh
+	devs, more := a.getWriteNodes(1)
+	require.Equal(t, []int{3, 1, 2}, []int{devs[0].Id, devs[1].Id, devs[2].Id})
+	require.Equal(t, 4, more.Next().Id)
+	require.Equal(t, 0, more.Next().Id)
+	require.Nil(t, more.Next())
+
+	devs, _ = a.getReadNodes(1)
+	require.Equal(t, 3, len(devs))
+	require.Equal(t, 0, devs[2].Id)
+}
+
+func TestMaintenanceOnlyHealth(t *testing.T) {
+	maintenance := "true"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Maintenance", maintenance)
+		w.Write([]byte("OK"))
+	}))
+	dev := testServerDevice(t, ts)
+	deadDev := &ring.Device{Scheme: "http", Ip: "127.0.0.1", Port: 1, Device: "sda"}
+	nh := newNodeHealth(time.Second, false)
+	nh.check(http.DefaultClient, []*ring.Device{dev, deadDev}, zap.NewNop())
+	require.True(t, nh.inMaintenance(dev))
+	require.False(t, nh.anyDown())
+
+	// a server that can't be reached keeps the maintenance it last reported
+	ts.Close()
+	nh.check(http.DefaultClient, []*ring.Device{dev, deadDev}, zap.NewNop())
+	require.True(t, nh.inMaintenance(dev))
+	require.False(t, nh.anyDown())
+}
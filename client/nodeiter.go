@@ -18,6 +18,10 @@ type ringFilter interface {
 	GetNodes(partition uint64) []*ring.Device
 	getReadNodes(partition uint64) ([]*ring.Device, ring.MoreNodes)
 	getWriteNodes(partition uint64) ([]*ring.Device, ring.MoreNodes)
+	quorum(method string, replicas int) int
+	// requestNodes is how many nodes, primaries and handoffs together, a
+	// read may try.
+	requestNodes() int
 	ring() ring.Ring
 }
 
@@ -73,16 +77,39 @@ type readAffSection struct {
 
 type clientRingFilter struct {
 	ring.Ring
-	raffs       []readAffSection
-	waffRegion  int
-	waffCount   int
-	deviceLimit int
+	raffs            []readAffSection
+	waffRegion       int
+	waffCount        int
+	deviceLimit      int
+	requestNodeCount int
+	// handoffStats, if set, is used to write to the least loaded of the next
+	// handoffWindow handoffs rather than in ring order.
+	handoffStats  *deviceStats
+	handoffWindow int
+	// health, if set, is used to avoid nodes on servers that are down.
+	health *nodeHealth
+	// putQuorum and deleteQuorum, if set, are how many nodes have to succeed
+	// for a PUT or DELETE to succeed, rather than the usual quorumSize.
+	putQuorum    int
+	deleteQuorum int
 }
 
 func (a *clientRingFilter) ring() ring.Ring {
 	return a.Ring
 }
 
+// quorum returns how many of replicas nodes have to agree on the outcome of a
+// request with method.
+func (a *clientRingFilter) quorum(method string, replicas int) int {
+	switch method {
+	case "PUT":
+		return effectiveQuorum(a.putQuorum, replicas)
+	case "DELETE":
+		return effectiveQuorum(a.deleteQuorum, replicas)
+	}
+	return effectiveQuorum(0, replicas)
+}
+
 func (a *clientRingFilter) getReadNodes(partition uint64) ([]*ring.Device, ring.MoreNodes) {
 	devs := a.GetNodes(partition)
 	d2a := make(map[*ring.Device]int, len(devs))
@@ -100,7 +127,7 @@ func (a *clientRingFilter) getReadNodes(partition uint64) ([]*ring.Device, ring.
 	}
 	rand.Shuffle(len(devs), func(i, j int) { devs[i], devs[j] = devs[j], devs[i] })
 	sort.SliceStable(devs, func(i, j int) bool { return d2a[devs[i]] < d2a[devs[j]] })
-	return devs, a.Ring.GetMoreNodes(partition)
+	return skipUnhealthy(devs, &limitMoreNodes{more: a.Ring.GetMoreNodes(partition), limit: a.requestNodeCount - len(devs)}, a.health)
 }
 
 func (a *clientRingFilter) getWriteNodes(partition uint64) ([]*ring.Device, ring.MoreNodes) {
@@ -109,9 +136,13 @@ func (a *clientRingFilter) getWriteNodes(partition uint64) ([]*ring.Device, ring
 	if a.deviceLimit == 0 {
 		a.deviceLimit = len(devs)
 	}
+	handoffs := a.GetMoreNodes(partition)
+	if a.handoffStats != nil && a.handoffWindow > 1 {
+		handoffs = &utilizationMoreNodes{more: handoffs, stats: a.handoffStats, window: a.handoffWindow}
+	}
 	more := &writeNodeIter{
 		devs:       devs,
-		more:       a.GetMoreNodes(partition),
+		more:       handoffs,
 		waffRegion: a.waffRegion,
 		waffCount:  a.waffCount,
 		limit:      a.deviceLimit,
@@ -124,23 +155,35 @@ func (a *clientRingFilter) getWriteNodes(partition uint64) ([]*ring.Device, ring
 	for i := range ndevs {
 		ndevs[i] = more.next()
 	}
-	return ndevs, more
+	return skipUnavailable(ndevs, more, a.health)
+}
+
+// parseNodeCount parses a node count setting, either a plain number or of
+// the form "<n> * replicas", defaulting to twice the ring's replica count.
+func parseNodeCount(setting string, replicas uint64) int {
+	var f float64
+	if v, err := strconv.ParseInt(setting, 0, 64); err == nil {
+		return int(v)
+	} else if n, err := fmt.Sscanf(setting, "%f * replicas", &f); err == nil && n == 1 {
+		return int(math.Ceil(f * float64(replicas)))
+	}
+	return int(2 * replicas)
+}
+
+func (a *clientRingFilter) requestNodes() int {
+	return a.requestNodeCount
+}
+
+// setRequestNodeCount sets how many nodes, primaries followed by handoffs,
+// reads may try before giving up; see parseNodeCount.
+func (a *clientRingFilter) setRequestNodeCount(setting string) {
+	a.requestNodeCount = parseNodeCount(setting, a.ReplicaCount())
 }
 
 func newClientRingFilter(r ring.Ring, readAff, writeAff, waffCount string, deviceLimit int) *clientRingFilter {
 	waffRegion := -1
 	fmt.Sscanf(writeAff, "r%d", &waffRegion)
 
-	wc := 0
-	var f float64
-	if v, err := strconv.ParseInt(waffCount, 0, 64); err == nil {
-		wc = int(v)
-	} else if n, err := fmt.Sscanf(waffCount, "%f * replicas", &f); err == nil && n == 1 {
-		wc = int(math.Ceil(f * float64(r.ReplicaCount())))
-	} else {
-		wc = int(2 * r.ReplicaCount())
-	}
-
 	sections := strings.Split(readAff, ",")
 	raffs := make([]readAffSection, 0, len(sections))
 	for i := range sections {
@@ -154,10 +197,29 @@ func newClientRingFilter(r ring.Ring, readAff, writeAff, waffCount string, devic
 	}
 	sort.Slice(raffs, func(i, j int) bool { return raffs[i].weight < raffs[j].weight })
 	return &clientRingFilter{
-		Ring:        r,
-		raffs:       raffs,
-		waffRegion:  waffRegion,
-		waffCount:   wc,
-		deviceLimit: deviceLimit,
+		Ring:             r,
+		raffs:            raffs,
+		waffRegion:       waffRegion,
+		waffCount:        parseNodeCount(waffCount, r.ReplicaCount()),
+		deviceLimit:      deviceLimit,
+		requestNodeCount: int(2 * r.ReplicaCount()),
+	}
+}
+
+// limitMoreNodes hands out at most limit devices from more, so reads stop
+// trying handoffs once request_node_count nodes have been asked.
+type limitMoreNodes struct {
+	mutex sync.Mutex
+	more  ring.MoreNodes
+	limit int
+}
+
+func (l *limitMoreNodes) Next() *ring.Device {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.limit <= 0 || l.more == nil {
+		return nil
 	}
+	l.limit--
+	return l.more.Next()
 }
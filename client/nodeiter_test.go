@@ -1,6 +1,7 @@
 package client
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -8,6 +9,26 @@ import (
 	"github.com/troubling/hummingbird/common/test"
 )
 
+type listMoreNodes struct {
+	mutex sync.Mutex
+	devs  []*ring.Device
+	more  ring.MoreNodes
+}
+
+func (l *listMoreNodes) Next() *ring.Device {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.devs) > 0 {
+		var dev *ring.Device
+		dev, l.devs = l.devs[0], l.devs[1:]
+		return dev
+	}
+	if l.more == nil {
+		return nil
+	}
+	return l.more.Next()
+}
+
 func TestAffinityReadOrder(t *testing.T) {
 	r := &test.FakeRing{
 		MockDevices: []*ring.Device{
@@ -30,6 +51,39 @@ func TestAffinityReadOrder(t *testing.T) {
 	require.Equal(t, "sdc", devs[2].Device)
 }
 
+func TestReadNodesFallBackToHandoffs(t *testing.T) {
+	r := &test.FakeRing{
+		MockDevices: []*ring.Device{
+			{Id: 0, Region: 1, Zone: 1, Device: "sda"},
+			{Id: 1, Region: 1, Zone: 1, Device: "sdb"},
+			{Id: 2, Region: 1, Zone: 1, Device: "sdc"},
+		},
+		MockGetMoreNodes: &listMoreNodes{devs: []*ring.Device{
+			{Id: 3, Device: "sdd"},
+			{Id: 4, Device: "sde"},
+			{Id: 5, Device: "sdf"},
+			{Id: 6, Device: "sdg"},
+		}},
+	}
+	a := newClientRingFilter(r, "", "", "", 0)
+	a.setRequestNodeCount("5")
+	devs, more := a.getReadNodes(1)
+	require.Equal(t, 3, len(devs))
+	for _, dev := range devs {
+		require.True(t, dev.Id < 3)
+	}
+	require.Equal(t, 3, more.Next().Id)
+	require.Equal(t, 4, more.Next().Id)
+	require.Nil(t, more.Next())
+}
+
+func TestParseNodeCount(t *testing.T) {
+	require.Equal(t, 6, parseNodeCount("", 3))
+	require.Equal(t, 4, parseNodeCount("4", 3))
+	require.Equal(t, 9, parseNodeCount("3 * replicas", 3))
+	require.Equal(t, 6, parseNodeCount("3 * monkeys", 3))
+}
+
 type fakeRing struct {
 	*test.FakeRing
 	nodes []*ring.Device
@@ -148,3 +202,8 @@ func TestWriteAffinityNonPreferred(t *testing.T) {
 	require.Equal(t, 4, more.Next().Id)
 	require.Equal(t, 5, more.Next().Id)
 }
+
+func TestParseStorageClasses(t *testing.T) {
+	require.Equal(t, []string{"standard", "fast"}, parseStorageClasses("standard, fast,"))
+	require.Nil(t, parseStorageClasses(""))
+}
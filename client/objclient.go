@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -63,13 +62,58 @@ type standardObjectClient struct {
 	Logger      srv.LowLevelLogger
 }
 
+// exposeStorageClass copies the object's recorded storage class, if any, to
+// the client facing header.
+func exposeStorageClass(resp *http.Response) *http.Response {
+	if class := resp.Header.Get("X-Object-Sysmeta-Storage-Class"); class != "" {
+		resp.Header.Set("X-Object-Storage-Class", class)
+	}
+	return resp
+}
+
 // putReader is a Reader proxy that sends its reader over the ready channel the first time Read is called.
 // This is important because "Expect: 100-continue" requests don't call Read unless/until they get a 100 response.
 type putReader struct {
 	io.Reader
 	cancel chan struct{}
-	ready  chan io.WriteCloser
-	w      io.WriteCloser
+	ready  chan putWriter
+	w      putWriter
+}
+
+// putWriter is the end of a putReader's pipe that the object's data is
+// written to.
+type putWriter interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// footerPipe writes the object's data to a pipe as the first part of a
+// metadata footer document, and the footers from src when it's closed.
+type footerPipe struct {
+	fw     *common.FooterWriter
+	pipe   *io.PipeWriter
+	src    common.FooterSource
+	closed bool
+}
+
+func (f *footerPipe) Write(b []byte) (int, error) {
+	return f.fw.Write(b)
+}
+
+func (f *footerPipe) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if err := f.fw.Close(f.src.Footers()); err != nil {
+		return f.pipe.CloseWithError(err)
+	}
+	return f.pipe.Close()
+}
+
+func (f *footerPipe) CloseWithError(err error) error {
+	f.closed = true
+	return f.pipe.CloseWithError(err)
 }
 
 func (p *putReader) Read(b []byte) (int, error) {
@@ -99,16 +143,32 @@ func (oc *standardObjectClient) putObject(ctx context.Context, account, containe
 	objectPartition := oc.objectRing.GetPartition(account, container, obj)
 	containerPartition := oc.pdc.ContainerRing.GetPartition(account, container, "")
 	containerDevices := oc.pdc.ContainerRing.GetNodes(containerPartition)
-	ready := make(chan io.WriteCloser)
+	ready := make(chan putWriter)
 	cancel := make(chan struct{})
 	defer close(cancel)
 	responsec := make(chan *http.Response)
 	devs, more := oc.objectRing.getWriteNodes(objectPartition)
 	objectReplicaCount := len(devs)
+	storageClass := headers.Get("X-Object-Storage-Class")
+	if storageClass != "" && len(oc.pdc.storageClasses) > 0 {
+		// Placement comes from the policy's ring, so an object can only be
+		// given a class the container's policy serves.
+		if policy, ok := oc.pdc.storageClasses[storageClass]; !ok {
+			return nectarutil.ResponseStub(http.StatusBadRequest, fmt.Sprintf("Invalid storage class %q", storageClass))
+		} else if policy != oc.policy {
+			return nectarutil.ResponseStub(http.StatusConflict, fmt.Sprintf("Storage class %q is not served by the container's storage policy", storageClass))
+		}
+	}
 
 	devToRequest := func(index int, dev *ring.Device) (*http.Request, error) {
 		trp, wp := io.Pipe()
 		rp := &putReader{Reader: trp, cancel: cancel, w: wp, ready: ready}
+		footerSrc, footers := src.(common.FooterSource)
+		var fw *common.FooterWriter
+		if footers {
+			fw = common.NewFooterWriter(wp)
+			rp.w = &footerPipe{fw: fw, pipe: wp, src: footerSrc}
+		}
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, objectPartition,
 			common.Urlencode(account), common.Urlencode(container), common.Urlencode(obj))
 		req, err := http.NewRequest("PUT", url, rp)
@@ -124,6 +184,18 @@ func (oc *standardObjectClient) putObject(ctx context.Context, account, containe
 		req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(oc.policy))
 		req.Header.Set("X-Container-Partition", strconv.FormatUint(containerPartition, 10))
 		addUpdateHeaders("X-Container", req.Header, containerDevices, index, objectReplicaCount)
+		req.Header.Del("X-Object-Storage-Class")
+		if storageClass != "" && len(oc.pdc.storageClasses) > 0 {
+			req.Header.Set("X-Object-Sysmeta-Storage-Class", storageClass)
+		}
+		if footers {
+			req.Header.Set(common.MetadataFooterHeader, "yes")
+			req.Header.Set(common.MimeBoundaryHeader, fw.Boundary())
+			if cl := req.Header.Get("Content-Length"); cl != "" {
+				req.Header.Set(common.ObjContentLengthHeader, cl)
+				req.Header.Del("Content-Length")
+			}
+		}
 		req.Header.Set("Expect", "100-continue")
 		return req, nil
 	}
@@ -162,32 +234,31 @@ func (oc *standardObjectClient) putObject(ctx context.Context, account, containe
 			}
 		}(i)
 	}
-	responseClassCounts := make([]int, 6)
-	quorum := int(math.Ceil(float64(objectReplicaCount) / 2.0))
+	quorum := oc.objectRing.quorum("PUT", objectReplicaCount)
+	tally := newResponseTally(quorum, objectReplicaCount)
 	writers := make([]io.Writer, 0)
-	cWriters := make([]io.WriteCloser, 0)
+	cWriters := make([]putWriter, 0)
 	responseCount := 0
 	written := false
 	for {
 		select {
 		case resp := <-responsec:
 			responseCount++
-			if resp != nil {
-				responseClassCounts[resp.StatusCode/100]++
-				if responseClassCounts[resp.StatusCode/100] >= quorum {
-					timeout := time.After(time.Duration(PostQuorumTimeoutMs) * time.Millisecond)
-					for responseCount < objectReplicaCount {
-						select {
-						case <-responsec:
-							responseCount++
-						case <-timeout:
-							return resp
-						}
+			if tally.add(resp) {
+				timeout := time.After(time.Duration(PostQuorumTimeoutMs) * time.Millisecond)
+			WAIT:
+				for responseCount < objectReplicaCount {
+					select {
+					case <-responsec:
+						responseCount++
+					case <-timeout:
+						break WAIT
 					}
+				}
+				if resp := tally.best(); resp != nil {
 					return resp
-				} else if responseCount == objectReplicaCount {
-					return nectarutil.ResponseStub(http.StatusServiceUnavailable, "The service is currently unavailable.")
 				}
+				return nectarutil.ResponseStub(http.StatusServiceUnavailable, "The service is currently unavailable.")
 			}
 		case w := <-ready:
 			defer w.Close()
@@ -197,6 +268,10 @@ func (oc *standardObjectClient) putObject(ctx context.Context, account, containe
 		if !written && len(writers) >= quorum && len(writers)+responseCount == objectReplicaCount {
 			written = true
 			if _, err := common.CopyQuorum(src, quorum, writers...); err != nil {
+				// The backends mustn't take a short body for a whole one.
+				for _, w := range cWriters {
+					w.CloseWithError(err)
+				}
 				return nectarutil.ResponseStub(http.StatusServiceUnavailable, "The service is currently unavailable.")
 			}
 			for _, w := range cWriters {
@@ -212,7 +287,7 @@ func (oc *standardObjectClient) postObject(ctx context.Context, account, contain
 	containerDevices := oc.pdc.ContainerRing.GetNodes(containerPartition)
 	devs, _ := oc.objectRing.getWriteNodes(partition)
 	objectReplicaCount := len(devs)
-	return oc.pdc.quorumResponse(oc.objectRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return oc.pdc.quorumResponse(oc.objectRing, partition, "POST", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container), common.Urlencode(obj))
 		req, err := http.NewRequest("POST", url, nil)
@@ -233,7 +308,7 @@ func (oc *standardObjectClient) postObject(ctx context.Context, account, contain
 
 func (oc *standardObjectClient) getObject(ctx context.Context, account, container, obj string, headers http.Header) *http.Response {
 	partition := oc.objectRing.GetPartition(account, container, obj)
-	return oc.pdc.firstResponse(oc.objectRing, partition, func(dev *ring.Device) (*http.Request, error) {
+	return exposeStorageClass(oc.pdc.firstResponse(oc.objectRing, partition, func(dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container), common.Urlencode(obj))
 		req, err := http.NewRequest("GET", url, nil)
@@ -247,7 +322,7 @@ func (oc *standardObjectClient) getObject(ctx context.Context, account, containe
 		}
 		req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(oc.policy))
 		return req, nil
-	})
+	}))
 }
 
 func (oc *standardObjectClient) grepObject(ctx context.Context, account, container, obj string, search string) *http.Response {
@@ -268,7 +343,7 @@ func (oc *standardObjectClient) grepObject(ctx context.Context, account, contain
 
 func (oc *standardObjectClient) headObject(ctx context.Context, account, container, obj string, headers http.Header) *http.Response {
 	partition := oc.objectRing.GetPartition(account, container, obj)
-	return oc.pdc.firstResponse(oc.objectRing, partition, func(dev *ring.Device) (*http.Request, error) {
+	return exposeStorageClass(oc.pdc.firstResponse(oc.objectRing, partition, func(dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container), common.Urlencode(obj))
 		req, err := http.NewRequest("HEAD", url, nil)
@@ -282,7 +357,7 @@ func (oc *standardObjectClient) headObject(ctx context.Context, account, contain
 		}
 		req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(oc.policy))
 		return req, nil
-	})
+	}))
 }
 
 func (oc *standardObjectClient) deleteObject(ctx context.Context, account, container, obj string, headers http.Header) *http.Response {
@@ -291,7 +366,7 @@ func (oc *standardObjectClient) deleteObject(ctx context.Context, account, conta
 	containerDevices := oc.pdc.ContainerRing.GetNodes(containerPartition)
 	devs, _ := oc.objectRing.getWriteNodes(partition)
 	objectReplicaCount := len(devs)
-	return oc.pdc.quorumResponse(oc.objectRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return oc.pdc.quorumResponse(oc.objectRing, partition, "DELETE", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container), common.Urlencode(obj))
 		req, err := http.NewRequest("DELETE", url, nil)
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"net"
 	"net/http"
 	"strconv"
@@ -52,10 +51,27 @@ type proxyClient struct {
 	Logger            srv.LowLevelLogger
 	ClientTraceCloser io.Closer
 	userAgent         string
+	// storageClasses maps each X-Object-Storage-Class value to the index of
+	// the policy that serves it; see parseStorageClasses.
+	storageClasses map[string]int
 }
 
 var _ ProxyClient = &proxyClient{}
 
+// parseStorageClasses parses a policy's storage_classes setting, e.g.
+// "fast, ssd", into the X-Object-Storage-Class values the policy serves. A
+// class is placed by its policy's ring, so a class of fast media is a policy
+// whose ring is built from the fast devices.
+func parseStorageClasses(setting string) []string {
+	var classes []string
+	for _, class := range strings.Split(setting, ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
 func NewProxyClient(policyList conf.PolicyList, cnf srv.ConfigLoader, logger srv.LowLevelLogger, certFile, keyFile, readAffinity, writeAffinity, writeAffinityCount string, serverconf conf.Config) (ProxyClient, error) {
 	var xport http.RoundTripper = &http.Transport{
 		MaxIdleConnsPerHost: 100,
@@ -68,6 +84,32 @@ func NewProxyClient(policyList conf.PolicyList, cnf srv.ConfigLoader, logger srv
 		}).Dial,
 		ExpectContinueTimeout: 10 * time.Minute, // TODO: this should probably be like infinity.
 	}
+	if unixSocketDir := serverconf.GetDefault("app:proxy-server", "unix_socket_dir", ""); unixSocketDir != "" {
+		dialer, err := newLocalSocketDialer(unixSocketDir, &net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 5 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		xport.(*http.Transport).Dial = nil
+		xport.(*http.Transport).DialContext = dialer.DialContext
+	}
+	// Rings may name servers by hostname; dns_cache_ttl = 0 turns off the
+	// cache and leaves every new connection to do its own lookup.
+	if ttl := serverconf.GetFloat("app:proxy-server", "dns_cache_ttl", 30); ttl > 0 {
+		dial := xport.(*http.Transport).DialContext
+		if dial == nil {
+			dial = (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 5 * time.Second,
+			}).DialContext
+		}
+		staleTTL := serverconf.GetFloat("app:proxy-server", "dns_cache_stale_ttl", 3600)
+		cache := newDNSCache(time.Duration(ttl*float64(time.Second)), time.Duration(staleTTL*float64(time.Second)))
+		xport.(*http.Transport).Dial = nil
+		xport.(*http.Transport).DialContext = (&cachingDialer{cache: cache, dial: dial}).DialContext
+	}
 	if certFile != "" && keyFile != "" {
 		tlsConf, err := common.NewClientTLSConfig(certFile, keyFile)
 		if err != nil {
@@ -118,13 +160,38 @@ func NewProxyClient(policyList conf.PolicyList, cnf srv.ConfigLoader, logger srv
 	if err != nil {
 		return nil, err
 	}
-	c.ContainerRing = newClientRingFilter(containerRing, readAffinity, "", "", 0)
+	requestNodeCount := serverconf.GetDefault("app:proxy-server", "request_node_count", "")
+	containerRingFilter := newClientRingFilter(containerRing, readAffinity, "", "", 0)
+	containerRingFilter.setRequestNodeCount(requestNodeCount)
+	c.ContainerRing = containerRingFilter
 	accountRing, err := cnf.GetRing("account", hashPathPrefix, hashPathSuffix, 0)
 	if err != nil {
 		return nil, err
 	}
-	c.AccountRing = newClientRingFilter(accountRing, readAffinity, "", "", 0)
+	accountRingFilter := newClientRingFilter(accountRing, readAffinity, "", "", 0)
+	accountRingFilter.setRequestNodeCount(requestNodeCount)
+	c.AccountRing = accountRingFilter
 	c.objectClients = make(map[int]proxyObjectClient)
+	c.storageClasses = make(map[string]int)
+	var handoffStats *deviceStats
+	var objectRings []ringFilter
+	var health *nodeHealth
+	// Maintenance is read from the same /healthcheck, so a proxy polls it on
+	// its own schedule when health checks are off.
+	healthInterval := serverconf.GetInt("app:proxy-server", "healthcheck_interval", 0)
+	if healthInterval <= 0 && serverconf.HasSection("app:proxy-server") {
+		healthInterval = serverconf.GetInt("app:proxy-server", "maintenance_check_interval", 30)
+	}
+	if healthInterval > 0 {
+		health = newNodeHealth(time.Duration(serverconf.GetFloat("app:proxy-server", "healthcheck_timeout", 2)*float64(time.Second)),
+			serverconf.GetInt("app:proxy-server", "healthcheck_interval", 0) > 0)
+		accountRingFilter.health = health
+		containerRingFilter.health = health
+	}
+	handoffWindow := int(serverconf.GetInt("app:proxy-server", "handoff_utilization_window", 3))
+	if serverconf.GetInt("app:proxy-server", "handoff_utilization_interval", 0) > 0 {
+		handoffStats = newDeviceStats()
+	}
 	for _, policy := range c.policyList {
 		// TODO: the intention is to (if it becomes necessary) have a policy type to object client
 		// constructor mapping here, similar to how object engines are loaded by policy type.
@@ -152,14 +219,44 @@ func NewProxyClient(policyList conf.PolicyList, cnf srv.ConfigLoader, logger srv
 				deviceLimit = 3
 			}
 		}
+		for _, class := range parseStorageClasses(policy.Config["storage_classes"]) {
+			if other, ok := c.storageClasses[class]; ok {
+				return nil, fmt.Errorf("Storage class %q is served by both policy %d and policy %d", class, other, policy.Index)
+			}
+			c.storageClasses[class] = policy.Index
+		}
+		policyRequestNodeCount, ok := policy.Config["request_node_count"]
+		if !ok {
+			policyRequestNodeCount = requestNodeCount
+		}
+		objectRing := newClientRingFilter(ring, policyReadAffinity, policyWriteAffinity, policyWriteAffinityCount, deviceLimit)
+		objectRing.setRequestNodeCount(policyRequestNodeCount)
+		if objectRing.putQuorum, err = parseQuorum(policy.Config["put_quorum"]); err != nil {
+			return nil, fmt.Errorf("Policy %d put_quorum: %v", policy.Index, err)
+		}
+		if objectRing.deleteQuorum, err = parseQuorum(policy.Config["delete_quorum"]); err != nil {
+			return nil, fmt.Errorf("Policy %d delete_quorum: %v", policy.Index, err)
+		}
+		objectRing.handoffStats = handoffStats
+		objectRing.handoffWindow = handoffWindow
+		objectRing.health = health
+		objectRings = append(objectRings, objectRing)
 		client := &standardObjectClient{
 			pdc:        c,
 			policy:     policy.Index,
-			objectRing: newClientRingFilter(ring, policyReadAffinity, policyWriteAffinity, policyWriteAffinityCount, deviceLimit),
+			objectRing: objectRing,
 			Logger:     logger,
 		}
 		c.objectClients[policy.Index] = client
 	}
+	if handoffStats != nil {
+		interval := time.Duration(serverconf.GetInt("app:proxy-server", "handoff_utilization_interval", 0)) * time.Second
+		go handoffStats.run(c.client, objectRings, interval, logger)
+	}
+	if health != nil {
+		interval := time.Duration(healthInterval) * time.Second
+		go health.run(c.client, append([]ringFilter{accountRingFilter, containerRingFilter}, objectRings...), interval, logger)
+	}
 	return c, nil
 }
 
@@ -170,7 +267,7 @@ func (c *proxyClient) SetUserAgent(v string) {
 // quorumResponse returns with a response representative of a quorum of nodes.
 //
 // This is analogous to swift's best_response function.
-func (c *proxyClient) quorumResponse(r ringFilter, partition uint64, devToRequest func(int, *ring.Device) (*http.Request, error)) *http.Response {
+func (c *proxyClient) quorumResponse(r ringFilter, partition uint64, method string, devToRequest func(int, *ring.Device) (*http.Request, error)) *http.Response {
 	cancel := make(chan struct{})
 	defer close(cancel)
 	responsec := make(chan *http.Response)
@@ -200,7 +297,7 @@ func (c *proxyClient) quorumResponse(r ringFilter, partition uint64, devToReques
 			// it's a response from the primary node. This corrects for the
 			// case where the primary node 5xx errored and subsequent nodes
 			// don't know about the item requested.
-			if resp.StatusCode == 404 {
+			if resp.StatusCode == http.StatusNotFound {
 				resp = firstResp
 			}
 			select {
@@ -210,25 +307,24 @@ func (c *proxyClient) quorumResponse(r ringFilter, partition uint64, devToReques
 			}
 		}(i)
 	}
-	responseClassCounts := make([]int, 6)
-	quorum := int(math.Ceil(float64(len(devs)) / 2.0))
+	tally := newResponseTally(r.quorum(method, len(devs)), len(devs))
 	for i := 0; i < len(devs); i++ {
-		if resp := <-responsec; resp != nil {
-			responseClassCounts[resp.StatusCode/100]++
-			if responseClassCounts[resp.StatusCode/100] >= quorum {
-				timeout := time.After(time.Duration(PostQuorumTimeoutMs) * time.Millisecond)
-				for i < int(len(devs)-1) {
-					select {
-					case <-responsec:
-						i++
-					case <-timeout:
-						return resp
-					}
+		if tally.add(<-responsec) {
+			timeout := time.After(time.Duration(PostQuorumTimeoutMs) * time.Millisecond)
+			for i < int(len(devs)-1) {
+				select {
+				case <-responsec:
+					i++
+				case <-timeout:
+					i = len(devs)
 				}
-				return resp
 			}
+			break
 		}
 	}
+	if resp := tally.best(); resp != nil {
+		return resp
+	}
 	return nectarutil.ResponseStub(http.StatusServiceUnavailable, "Unknown State")
 }
 
@@ -266,7 +362,12 @@ func (c *proxyClient) firstResponse(r ringFilter, partition uint64, devToRequest
 		}
 		return nil
 	}
-	maxRequests := int(r.ReplicaCount()) * 2
+	// Primaries are asked first, then handoffs up to the request node count,
+	// so data written to handoffs during a rebalance can still be found.
+	maxRequests := r.requestNodes()
+	if maxRequests < len(devs) {
+		maxRequests = len(devs)
+	}
 	requestsPending := 0
 	for requestCount := 0; requestCount < maxRequests; requestCount++ {
 		var dev *ring.Device
@@ -348,18 +449,22 @@ func (c *proxyClient) Close() error {
 // NilContainerInfo is used for testing.
 var NilContainerInfo = &ContainerInfo{}
 
-var ContainerNotFound = errors.New("Container Not Found")
+var ContainerNotFound error = &common.BackendError{StatusCode: http.StatusNotFound, Message: "Container Not Found"}
 
 func (c *proxyClient) NewRequestClient(mc ring.MemcacheRing, lc map[string]*ContainerInfo, logger srv.LowLevelLogger) RequestClient {
-	return &requestClient{pdc: c, mc: mc, lc: lc, Logger: logger}
+	return &requestClient{pdc: c, mc: mc, lc: lc, fetching: make(map[string]chan struct{}), Logger: logger}
 }
 
 type requestClient struct {
-	pdc    *proxyClient
-	mc     ring.MemcacheRing
-	lc     map[string]*ContainerInfo
-	lcm    sync.RWMutex
-	Logger srv.LowLevelLogger
+	pdc *proxyClient
+	mc  ring.MemcacheRing
+	lc  map[string]*ContainerInfo
+	// fetching has a channel, closed when done, for each container whose
+	// info is being looked up, so concurrent lookups of the same container
+	// wait on the first instead of each going to memcache and the backend.
+	fetching map[string]chan struct{}
+	lcm      sync.RWMutex
+	Logger   srv.LowLevelLogger
 }
 
 var _ RequestClient = &requestClient{}
@@ -371,19 +476,20 @@ func (c *requestClient) SetUserAgent(v string) {
 func (c *requestClient) getObjectClient(ctx context.Context, account string, container string, mc ring.MemcacheRing, lc map[string]*ContainerInfo) proxyObjectClient {
 	ci, err := c.GetContainerInfo(ctx, account, container)
 	if err != nil {
-		st := http.StatusInternalServerError
-		if err == ContainerNotFound {
-			st = http.StatusNotFound
-		}
-		return &erroringObjectClient{st, err.Error()}
+		return &erroringObjectClient{common.ErrorStatus(err), err.Error()}
 	}
 	return c.pdc.objectClients[ci.StoragePolicyIndex]
 }
 
-func (c *requestClient) invalidateContainerInfo(ctx context.Context, account string, container string) {
+func (c *requestClient) InvalidateContainerInfo(ctx context.Context, account string, container string) {
 	key := fmt.Sprintf("container/%s/%s", account, container)
+	// A lookup under way, like the proxy's prefetch, may have read the info
+	// from before the change; let it finish caching that first.
+	c.waitFetch(ctx, key)
 	if c.lc != nil {
+		c.lcm.Lock()
 		delete(c.lc, key)
+		c.lcm.Unlock()
 	}
 	if c.mc != nil {
 		c.mc.Delete(ctx, key)
@@ -392,7 +498,7 @@ func (c *requestClient) invalidateContainerInfo(ctx context.Context, account str
 
 func (c *requestClient) PutAccount(ctx context.Context, account string, headers http.Header) *http.Response {
 	partition := c.pdc.AccountRing.GetPartition(account, "", "")
-	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, "PUT", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition, common.Urlencode(account))
 		req, err := http.NewRequest("PUT", url, nil)
 		if err != nil {
@@ -409,7 +515,7 @@ func (c *requestClient) PutAccount(ctx context.Context, account string, headers
 
 func (c *requestClient) PostAccount(ctx context.Context, account string, headers http.Header) *http.Response {
 	partition := c.pdc.AccountRing.GetPartition(account, "", "")
-	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, "POST", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition, common.Urlencode(account))
 		req, err := http.NewRequest("POST", url, nil)
 		if err != nil {
@@ -463,7 +569,7 @@ func (c *requestClient) HeadAccount(ctx context.Context, account string, headers
 
 func (c *requestClient) DeleteAccount(ctx context.Context, account string, headers http.Header) *http.Response {
 	partition := c.pdc.AccountRing.GetPartition(account, "", "")
-	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.AccountRing, partition, "DELETE", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition, common.Urlencode(account))
 		req, err := http.NewRequest("DELETE", url, nil)
 		if err != nil {
@@ -479,7 +585,7 @@ func (c *requestClient) DeleteAccount(ctx context.Context, account string, heade
 }
 
 func (c *requestClient) PutContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response {
-	defer c.invalidateContainerInfo(ctx, account, container)
+	defer c.InvalidateContainerInfo(ctx, account, container)
 	partition := c.pdc.ContainerRing.GetPartition(account, container, "")
 	accountPartition := c.pdc.AccountRing.GetPartition(account, "", "")
 	accountDevices := c.pdc.AccountRing.GetNodes(accountPartition)
@@ -493,9 +599,15 @@ func (c *requestClient) PutContainer(ctx context.Context, account string, contai
 			return nectarutil.ResponseStub(http.StatusBadRequest, fmt.Sprintf("Storage Policy %q is deprecated", policyName))
 		}
 		policyIndex = policy.Index
+	} else if class := strings.TrimSpace(headers.Get("X-Storage-Class")); class != "" {
+		index, ok := c.pdc.storageClasses[class]
+		if !ok {
+			return nectarutil.ResponseStub(http.StatusBadRequest, fmt.Sprintf("Invalid X-Storage-Class %q", class))
+		}
+		policyIndex = index
 	}
 	containerReplicaCount := int(c.pdc.ContainerRing.ReplicaCount())
-	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, "PUT", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container))
 		req, err := http.NewRequest("PUT", url, nil)
@@ -518,9 +630,9 @@ func (c *requestClient) PutContainer(ctx context.Context, account string, contai
 }
 
 func (c *requestClient) PostContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response {
-	defer c.invalidateContainerInfo(ctx, account, container)
+	defer c.InvalidateContainerInfo(ctx, account, container)
 	partition := c.pdc.ContainerRing.GetPartition(account, container, "")
-	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, "POST", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container))
 		req, err := http.NewRequest("POST", url, nil)
@@ -555,11 +667,61 @@ func (c *requestClient) GetContainerRaw(ctx context.Context, account string, con
 	})
 }
 
+// joinFetch waits for any lookup of key already under way.  If there isn't
+// one and key isn't in the local cache, it returns a func the caller must call
+// when its own lookup is done.
+func (c *requestClient) joinFetch(ctx context.Context, key string) func() {
+	if c.lc == nil || c.fetching == nil {
+		return nil
+	}
+	c.lcm.Lock()
+	if _, ok := c.lc[key]; ok {
+		c.lcm.Unlock()
+		return nil
+	}
+	if ch, ok := c.fetching[key]; ok {
+		c.lcm.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	ch := make(chan struct{})
+	c.fetching[key] = ch
+	c.lcm.Unlock()
+	return func() {
+		c.lcm.Lock()
+		delete(c.fetching, key)
+		c.lcm.Unlock()
+		close(ch)
+	}
+}
+
+// waitFetch waits for any lookup of key under way to finish.
+func (c *requestClient) waitFetch(ctx context.Context, key string) {
+	if c.fetching == nil {
+		return
+	}
+	c.lcm.RLock()
+	ch, ok := c.fetching[key]
+	c.lcm.RUnlock()
+	if ok {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+	}
+}
+
 func (c *requestClient) GetContainerInfo(ctx context.Context, account string, container string) (*ContainerInfo, error) {
 	// if finds container info returns: *ci, nil
 	// if gets 404 on HeadContainer returns: nil, ContainerNotFound
 	// if errors on getting container retuns nil, err
 	key := fmt.Sprintf("container/%s/%s", account, container)
+	if done := c.joinFetch(ctx, key); done != nil {
+		defer done()
+	}
 	var ci *ContainerInfo
 	contInCache := false
 	if c.lc != nil {
@@ -573,9 +735,9 @@ func (c *requestClient) GetContainerInfo(ctx context.Context, account string, co
 	if !contInCache && c.mc != nil {
 		if err := c.mc.GetStructured(ctx, key, &ci); err == nil {
 			if c.lc != nil {
-				c.lcm.RLock()
+				c.lcm.Lock()
 				c.lc[key] = ci
-				c.lcm.RUnlock()
+				c.lcm.Unlock()
 			}
 			contInCache = true
 		} else {
@@ -585,16 +747,16 @@ func (c *requestClient) GetContainerInfo(ctx context.Context, account string, co
 	if !contInCache {
 		resp := c.HeadContainer(ctx, account, container, nil)
 		resp.Body.Close()
-		if resp.StatusCode/100 != 2 {
-			if resp.StatusCode == 404 {
+		if err := common.StatusError(resp.StatusCode); err != nil {
+			if common.IsNotFound(err) {
 				if c.lc != nil {
-					c.lcm.RLock()
+					c.lcm.Lock()
 					c.lc[key] = nil
-					c.lcm.RUnlock()
+					c.lcm.Unlock()
 				}
 				return nil, ContainerNotFound
 			}
-			return nil, fmt.Errorf("%d error retrieving info for container %s/%s", resp.StatusCode, account, container)
+			return nil, &common.BackendError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%d error retrieving info for container %s/%s", resp.StatusCode, account, container)}
 		}
 		var err error
 		if ci, err = c.SetContainerInfo(ctx, account, container, resp); err != nil {
@@ -666,12 +828,12 @@ func (c *requestClient) HeadContainer(ctx context.Context, account string, conta
 }
 
 func (c *requestClient) DeleteContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response {
-	defer c.invalidateContainerInfo(ctx, account, container)
+	defer c.InvalidateContainerInfo(ctx, account, container)
 	partition := c.pdc.ContainerRing.GetPartition(account, container, "")
 	accountPartition := c.pdc.AccountRing.GetPartition(account, "", "")
 	accountDevices := c.pdc.AccountRing.GetNodes(accountPartition)
 	containerReplicaCount := int(c.pdc.ContainerRing.ReplicaCount())
-	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, func(i int, dev *ring.Device) (*http.Request, error) {
+	return c.pdc.quorumResponse(c.pdc.ContainerRing, partition, "DELETE", func(i int, dev *ring.Device) (*http.Request, error) {
 		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s", dev.Scheme, dev.Ip, dev.Port, dev.Device, partition,
 			common.Urlencode(account), common.Urlencode(container))
 		req, err := http.NewRequest("DELETE", url, nil)
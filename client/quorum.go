@@ -0,0 +1,119 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// quorumSize is how many of replicas nodes have to agree for their answer to
+// stand: half, rounded up, as in Swift.  So one replica needs its one node and
+// two replicas need either of theirs.
+func quorumSize(replicas int) int {
+	return (replicas + 1) / 2
+}
+
+// parseQuorum reads a put_quorum or delete_quorum setting, a number of nodes
+// that has to succeed, with 0 meaning the usual quorumSize.
+func parseQuorum(setting string) (int, error) {
+	if setting = strings.TrimSpace(setting); setting == "" {
+		return 0, nil
+	}
+	q, err := strconv.Atoi(setting)
+	if err != nil || q < 0 {
+		return 0, fmt.Errorf("Invalid quorum %q, should be a number of nodes", setting)
+	}
+	return q, nil
+}
+
+// effectiveQuorum is the quorum for replicas nodes, given the configured
+// setting; it's kept between 1 and replicas so a setting meant for a bigger
+// ring can't make every request fail on a small one.
+func effectiveQuorum(setting, replicas int) int {
+	q := setting
+	if q <= 0 {
+		q = quorumSize(replicas)
+	}
+	if q > replicas {
+		q = replicas
+	}
+	if q < 1 {
+		q = 1
+	}
+	return q
+}
+
+// responseTally picks the response that represents a set of backend requests,
+// the way Swift's best_response does: the best class of status that a quorum
+// of the nodes answered with, where 2xx beats 3xx beats 4xx beats 5xx.
+type responseTally struct {
+	quorum    int
+	total     int
+	received  int
+	counts    [6]int
+	responses [6]*http.Response
+}
+
+func newResponseTally(quorum, total int) *responseTally {
+	return &responseTally{quorum: quorum, total: total}
+}
+
+// add counts resp and reports whether the outcome is decided.
+func (t *responseTally) add(resp *http.Response) bool {
+	t.received++
+	if resp != nil {
+		class := resp.StatusCode / 100
+		if class < 2 || class > 5 {
+			class = 5
+		}
+		t.counts[class]++
+		if t.counts[class] <= t.quorum {
+			t.responses[class] = resp
+		}
+	}
+	return t.decided()
+}
+
+// decided reports whether some class has reached quorum and no better class
+// could still reach it with the responses yet to come.  Without that second
+// check, a two replica ring's quorum of one would let a failure from the first
+// node to answer stand even though the second succeeded.
+func (t *responseTally) decided() bool {
+	remaining := t.total - t.received
+	for class := 2; class <= 5; class++ {
+		if t.counts[class] >= t.quorum {
+			return true
+		}
+		if t.counts[class]+remaining >= t.quorum {
+			return false
+		}
+	}
+	return remaining == 0
+}
+
+// best returns the response of the best class to reach quorum, or nil if none
+// did.
+func (t *responseTally) best() *http.Response {
+	for class := 2; class <= 5; class++ {
+		if t.counts[class] >= t.quorum {
+			return t.responses[class]
+		}
+	}
+	return nil
+}
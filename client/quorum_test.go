@@ -0,0 +1,103 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuorumSize(t *testing.T) {
+	require.Equal(t, 1, quorumSize(1))
+	require.Equal(t, 1, quorumSize(2))
+	require.Equal(t, 2, quorumSize(3))
+	require.Equal(t, 2, quorumSize(4))
+	require.Equal(t, 3, quorumSize(5))
+}
+
+func TestParseQuorum(t *testing.T) {
+	q, err := parseQuorum("")
+	require.Nil(t, err)
+	require.Equal(t, 0, q)
+	q, err = parseQuorum(" 2 ")
+	require.Nil(t, err)
+	require.Equal(t, 2, q)
+	_, err = parseQuorum("-1")
+	require.NotNil(t, err)
+	_, err = parseQuorum("most")
+	require.NotNil(t, err)
+}
+
+func TestEffectiveQuorum(t *testing.T) {
+	require.Equal(t, 1, effectiveQuorum(0, 1))
+	require.Equal(t, 1, effectiveQuorum(0, 2))
+	require.Equal(t, 2, effectiveQuorum(2, 2))
+	require.Equal(t, 1, effectiveQuorum(3, 1))
+	require.Equal(t, 3, effectiveQuorum(3, 5))
+	require.Equal(t, 1, effectiveQuorum(0, 0))
+}
+
+func TestResponseTallyOneReplica(t *testing.T) {
+	tally := newResponseTally(effectiveQuorum(0, 1), 1)
+	require.True(t, tally.add(&http.Response{StatusCode: 201}))
+	require.Equal(t, 201, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 1), 1)
+	require.True(t, tally.add(&http.Response{StatusCode: 507}))
+	require.Equal(t, 507, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 1), 1)
+	require.True(t, tally.add(nil))
+	require.Nil(t, tally.best())
+}
+
+func TestResponseTallyTwoReplicas(t *testing.T) {
+	// a failure first mustn't win while the other node could still succeed
+	tally := newResponseTally(effectiveQuorum(0, 2), 2)
+	require.False(t, tally.add(&http.Response{StatusCode: 503}))
+	require.True(t, tally.add(&http.Response{StatusCode: 201}))
+	require.Equal(t, 201, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 2), 2)
+	require.True(t, tally.add(&http.Response{StatusCode: 204}))
+	require.Equal(t, 204, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 2), 2)
+	require.False(t, tally.add(nil))
+	require.True(t, tally.add(&http.Response{StatusCode: 404}))
+	require.Equal(t, 404, tally.best().StatusCode)
+
+	// put_quorum = 2 needs both
+	tally = newResponseTally(effectiveQuorum(2, 2), 2)
+	require.False(t, tally.add(&http.Response{StatusCode: 201}))
+	require.True(t, tally.add(&http.Response{StatusCode: 503}))
+	require.Nil(t, tally.best())
+}
+
+func TestResponseTallyThreeReplicas(t *testing.T) {
+	tally := newResponseTally(effectiveQuorum(0, 3), 3)
+	require.False(t, tally.add(&http.Response{StatusCode: 201}))
+	require.False(t, tally.add(&http.Response{StatusCode: 503}))
+	require.True(t, tally.add(&http.Response{StatusCode: 201}))
+	require.Equal(t, 201, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 3), 3)
+	require.False(t, tally.add(&http.Response{StatusCode: 404}))
+	require.True(t, tally.add(&http.Response{StatusCode: 404}))
+	require.Equal(t, 404, tally.best().StatusCode)
+
+	tally = newResponseTally(effectiveQuorum(0, 3), 3)
+	require.False(t, tally.add(&http.Response{StatusCode: 201}))
+	require.False(t, tally.add(&http.Response{StatusCode: 404}))
+	require.True(t, tally.add(&http.Response{StatusCode: 503}))
+	require.Nil(t, tally.best())
+}
+
+func TestClientRingFilterQuorum(t *testing.T) {
+	a := &clientRingFilter{putQuorum: 2}
+	require.Equal(t, 2, a.quorum("PUT", 2))
+	require.Equal(t, 1, a.quorum("DELETE", 2))
+	require.Equal(t, 1, a.quorum("POST", 2))
+	require.Equal(t, 2, a.quorum("PUT", 3))
+	require.Equal(t, 1, a.quorum("PUT", 1))
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+// localSocketDialer dials backend servers on this host over their Unix domain
+// socket when one is present, falling back to TCP for everything else. Since
+// the address is still host:port, http.Transport keeps pooling connections per
+// backend as usual.
+type localSocketDialer struct {
+	dir      string
+	localIPs map[string]bool
+	dialer   *net.Dialer
+}
+
+func newLocalSocketDialer(dir string, dialer *net.Dialer) (*localSocketDialer, error) {
+	d := &localSocketDialer{dir: dir, localIPs: map[string]bool{}, dialer: dialer}
+	localAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range localAddrs {
+		d.localIPs[strings.Split(addr.String(), "/")[0]] = true
+	}
+	return d, nil
+}
+
+// socketPath returns the socket to use for addr, or "" if addr should be dialed over TCP.
+func (d *localSocketDialer) socketPath(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !d.localIPs[host] {
+		return ""
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return ""
+	}
+	path := srv.UnixSocketPath(d.dir, p)
+	if fi, err := os.Stat(path); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return ""
+	}
+	return path
+}
+
+func (d *localSocketDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if path := d.socketPath(addr); path != "" {
+		if conn, err := d.dialer.DialContext(ctx, "unix", path); err == nil {
+			return conn, nil
+		}
+	}
+	return d.dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+func TestLocalSocketDialer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	sock, err := net.Listen("unix", srv.UnixSocketPath(dir, 6000))
+	require.Nil(t, err)
+	defer sock.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := sock.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+
+	d, err := newLocalSocketDialer(dir, &net.Dialer{})
+	require.Nil(t, err)
+	require.Equal(t, srv.UnixSocketPath(dir, 6000), d.socketPath("127.0.0.1:6000"))
+	require.Equal(t, "", d.socketPath("127.0.0.1:6001"))
+	require.Equal(t, "", d.socketPath("192.0.2.1:6000"))
+	require.Equal(t, "", d.socketPath("garbage"))
+
+	conn, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:6000")
+	require.Nil(t, err)
+	defer conn.Close()
+	require.Equal(t, "unix", conn.RemoteAddr().Network())
+	c := <-accepted
+	c.Close()
+}
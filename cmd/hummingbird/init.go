@@ -180,6 +180,10 @@ func initCommand(args []string) error {
 	print(`# project_name = service`)
 	print(`# username = swift`)
 	print(`# password = password`)
+	print(`# or, to authenticate with an application credential instead:`)
+	print(`# auth_plugin = application_credential`)
+	print(`# application_credential_id = <id>`)
+	print(`# application_credential_secret = <secret>`)
 	print(`# cache = swift.cache`)
 	print(`# include_service_catalog = False`)
 	print(`# delay_auth_decision = True`)
@@ -192,6 +196,10 @@ func initCommand(args []string) error {
 	print(`# default_domain_id = default`)
 	print(`# allow_names_in_acls = false`)
 	print(``)
+	print(`[filter:header_policy]`)
+	print(`# deny_headers = Server X-Powered-By`)
+	print(`# add_header_strict_transport_security = max-age=31536000; includeSubDomains`)
+	print(``)
 	print(`[filter:catch_errors]`)
 	print(``)
 	print(`[filter:healthcheck]`)
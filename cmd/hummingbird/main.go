@@ -262,12 +262,68 @@ func main() {
 	objectReplicatorFlags.Bool("once", false, "Run one pass of the replicator")
 	objectReplicatorFlags.String("devices", "", "Replicate only given devices. Comma-separated list.")
 	objectReplicatorFlags.String("partitions", "", "Replicate only given partitions. Comma-separated list.")
+	objectReplicatorFlags.Bool("dry-run", false, "Run one pass reporting what would be sent and deleted per partition, without moving any data.")
 	objectReplicatorFlags.Usage = func() {
 		fmt.Fprintln(os.Stderr, "hummingbird object-replicator [ARGS]")
 		fmt.Fprintln(os.Stderr, "  Run object replicator")
 		objectReplicatorFlags.PrintDefaults()
 	}
 
+	objectAuditorFlags := flag.NewFlagSet("object auditor", flag.ExitOnError)
+	objectAuditorFlags.String("c", findConfig("object"), "Config file/directory to use")
+	objectAuditorFlags.String("l", "stdout", "Log location")
+	objectAuditorFlags.String("e", "stderr", "Error log location")
+	objectAuditorFlags.String("devices", "", "Audit only given devices. Comma-separated list.")
+	objectAuditorFlags.String("partitions", "", "Audit only given partitions. Comma-separated list.")
+	objectAuditorFlags.String("prefix", "", "Audit only object hashes starting with this prefix.")
+	objectAuditorFlags.Bool("zbf", false, "Only check metadata and sizes, without reading file contents.")
+	objectAuditorFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "hummingbird object-auditor [ARGS]")
+		fmt.Fprintln(os.Stderr, "  Run one pass of the object auditor")
+		objectAuditorFlags.PrintDefaults()
+	}
+
+	indexConvertFlags := flag.NewFlagSet("index convert", flag.ExitOnError)
+	indexConvertFlags.String("c", findConfig("object"), "Config file/directory to use")
+	indexConvertFlags.String("from", "sqlite", "Backend to convert from: sqlite or badger.")
+	indexConvertFlags.String("to", "badger", "Backend to convert to: sqlite or badger.")
+	indexConvertFlags.String("devices", "", "Convert only given devices. Comma-separated list.")
+	indexConvertFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "hummingbird index-convert [ARGS]")
+		fmt.Fprintln(os.Stderr, "  Copy object indexes to another db_backend; run with the object servers stopped")
+		indexConvertFlags.PrintDefaults()
+	}
+
+	indexBackupFlags := flag.NewFlagSet("index backup", flag.ExitOnError)
+	indexBackupFlags.String("c", findConfig("object"), "Config file/directory to use")
+	indexBackupFlags.String("o", ".", "Directory to write backups to.")
+	indexBackupFlags.String("url", "", "Also PUT each backup under this URL, e.g. an object store container.")
+	indexBackupFlags.String("token", "", "X-Auth-Token to send with the PUTs.")
+	indexBackupFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "hummingbird index-backup [ARGS] <device> ...")
+		fmt.Fprintln(os.Stderr, "  Back up the sqlite object indexes on devices; safe to run with the object servers running")
+		indexBackupFlags.PrintDefaults()
+	}
+
+	indexRestoreFlags := flag.NewFlagSet("index restore", flag.ExitOnError)
+	indexRestoreFlags.String("c", findConfig("object"), "Config file/directory to use")
+	indexRestoreFlags.String("i", ".", "Directory holding the backups.")
+	indexRestoreFlags.Bool("f", false, "Replace indexes that already exist.")
+	indexRestoreFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "hummingbird index-restore [ARGS] <device> ...")
+		fmt.Fprintln(os.Stderr, "  Restore object indexes made by index-backup; run with the object servers stopped")
+		indexRestoreFlags.PrintDefaults()
+	}
+
+	handoffsFlags := flag.NewFlagSet("handoffs", flag.ExitOnError)
+	handoffsFlags.String("c", findConfig("object"), "Config file/directory to use")
+	handoffsFlags.Int("policy", -1, "Only list handoffs of this policy index.")
+	handoffsFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "hummingbird handoffs [ARGS] <node ip>")
+		fmt.Fprintln(os.Stderr, "  List the handoff partitions on a node's local devices, with their object counts and sizes")
+		handoffsFlags.PrintDefaults()
+	}
+
 	containerFlags := flag.NewFlagSet("container server", flag.ExitOnError)
 	containerFlags.String("c", findConfig("container"), "Config file/directory to use")
 	containerFlags.String("l", "stdout", "Log location")
@@ -319,8 +375,11 @@ func main() {
 		fmt.Fprintf(os.Stderr, "    create <part_power> <replicas> <min_part_hours> (create a new ring)\n")
 		fmt.Fprintf(os.Stderr, "    add <device> <weight> (add a new device to the ring)\n")
 		fmt.Fprintf(os.Stderr, "    rebalance [-dryrun] (rebalance the ring)\n")
+		fmt.Fprintf(os.Stderr, "    apply [-dryrun] <declaration.yaml> (add, remove and reweight devices to match the declaration, then rebalance)\n")
 		fmt.Fprintf(os.Stderr, "    search <search_flags> (search for devices in the ring)\n")
 		fmt.Fprintf(os.Stderr, "    set_weight <search_flags> [-yes] <weight> (change the weight of 1 or more devices)\n")
+		fmt.Fprintf(os.Stderr, "    ramp <search_flags> [-steps <n>] [-yes] <weight> (change the weight of 1 or more devices over n rebalances)\n")
+		fmt.Fprintf(os.Stderr, "    ramp_step (take the next step of any weight ramps and rebalance)\n")
 		fmt.Fprintf(os.Stderr, "    remove <search_flags> [-yes] (remove device from the ring)\n")
 		fmt.Fprintf(os.Stderr, "    set_info <search_flags> [-yes] <change_flags> (change device information)\n")
 		fmt.Fprintf(os.Stderr, "    info (display ring info)\n")
@@ -331,7 +390,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  <device> is of the form: [r<region>]z<zone>[s<scheme>]-<ip>:<port>[R<r_ip>:<r_port>]/<device_name>_<meta>\n")
 		fmt.Fprintf(os.Stderr, "  <scheme> can be either http or https\n")
 		fmt.Fprintf(os.Stderr, "  <search_flags> is at least one of: -region, -zone, -scheme, -ip, -port, -replication-ip, replication-port, -device, -meta, -weight\n")
-		fmt.Fprintf(os.Stderr, "  <change_flags> is at least one of: -change-ip, -change-port, -change-replication-ip, -change-replication-port, -change-device, -change-meta, -change-scheme\n")
+		fmt.Fprintf(os.Stderr, "  <change_flags> is at least one of: -change-ip, -change-port, -change-replication-ip, -change-replication-port, -change-device, -change-meta, -change-attributes, -change-scheme\n")
 		ringBuilderFlags.PrintDefaults()
 	}
 
@@ -376,6 +435,18 @@ func main() {
 		objectInfoFlags.PrintDefaults()
 	}
 
+	infoFlags := flag.NewFlagSet("", flag.ExitOnError)
+	infoFlags.Bool("a", false, "Check all handoff nodes")
+	infoFlags.String("P", "", "Specify which policy to use, rather than the container's")
+	infoFlags.String("certfile", "", "Cert file to use for setting up https client")
+	infoFlags.String("keyfile", "", "Key file to use for setting up https client")
+	infoFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird info [ARGS] /v1/<account>[/<container>[/<object>]]\n")
+		fmt.Fprintf(os.Stderr, "  HEADs the item on its primaries and handoffs, showing each replica's\n")
+		fmt.Fprintf(os.Stderr, "  timestamp, etag and size and how its headers differ from the newest's.\n")
+		infoFlags.PrintDefaults()
+	}
+
 	reconFlags := flag.NewFlagSet("", flag.ExitOnError)
 	reconFlags.Bool("progress", false, "Show andrewd progress report; state of internal processes")
 	reconFlags.Bool("md5", false, "Get md5sum of servers ring and compare to local copy")
@@ -388,6 +459,7 @@ func main() {
 	reconFlags.Bool("rc", false, "List all drives with replicator cancellations")
 	reconFlags.Bool("d", false, "Show last dispersion report")
 	reconFlags.Bool("ds", false, "Show device status report")
+	reconFlags.Bool("m", false, "List nodes in maintenance")
 	reconFlags.Bool("rar", false, "Show andrewd ring action report")
 	reconFlags.Bool("rbr", false, "Show andrewd ring balance report")
 	reconFlags.String("c", findConfig("andrewd"), "Andrewd Config file to use (e.g. for dispersion)")
@@ -399,6 +471,75 @@ func main() {
 		reconFlags.PrintDefaults()
 	}
 
+	dfFlags := flag.NewFlagSet("", flag.ExitOnError)
+	dfFlags.String("c", findConfig("andrewd"), "Andrewd Config file to use")
+	dfFlags.Bool("json", false, "Output in json")
+	dfFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird df [ARGS]\n")
+		fmt.Fprintf(os.Stderr, "  Shows cluster capacity by ring, region and zone, and how long until\n")
+		fmt.Fprintf(os.Stderr, "  each zone is full at its recent growth, from the device states andrewd records.\n")
+		dfFlags.PrintDefaults()
+	}
+
+	maintenanceFlags := flag.NewFlagSet("", flag.ExitOnError)
+	maintenanceFlags.String("reason", "", "Why the node is going into maintenance, shown by status and recon")
+	maintenanceFlags.String("certfile", "", "Cert file to use for setting up https client")
+	maintenanceFlags.String("keyfile", "", "Key file to use for setting up https client")
+	maintenanceFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird maintenance [ARGS] enable|disable|status IP[:PORT]\n")
+		fmt.Fprintf(os.Stderr, "  Puts a node in maintenance, takes it out, or shows whether it is. Proxies\n")
+		fmt.Fprintf(os.Stderr, "  notice within maintenance_check_interval (or healthcheck_interval, if set),\n")
+		fmt.Fprintf(os.Stderr, "  then read from the node last and write to handoffs instead, and replication\n")
+		fmt.Fprintf(os.Stderr, "  to it pauses; the rings aren't changed.\n")
+		maintenanceFlags.PrintDefaults()
+	}
+
+	diskVerifyFlags := flag.NewFlagSet("", flag.ExitOnError)
+	diskVerifyFlags.Int("size", 256, "MiB to write and read for the throughput test; 0 skips it")
+	diskVerifyFlags.Bool("mount-check", true, "Fail if MOUNTPOINT isn't a mount point")
+	diskVerifyFlags.Bool("json", false, "Output in json")
+	diskVerifyFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird disk-verify [ARGS] MOUNTPOINT\n")
+		fmt.Fprintf(os.Stderr, "  Checks a disk can write, fsync, read back, hold xattrs and use O_TMPFILE,\n")
+		fmt.Fprintf(os.Stderr, "  and measures its throughput, before it's added to a ring.\n")
+		diskVerifyFlags.PrintDefaults()
+	}
+
+	sloVerifyFlags := flag.NewFlagSet("", flag.ExitOnError)
+	sloVerifyFlags.Bool("json", false, "Output in json")
+	sloVerifyFlags.String("certfile", "", "Cert file to use for setting up https client")
+	sloVerifyFlags.String("keyfile", "", "Key file to use for setting up https client")
+	sloVerifyFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird slo-verify [ARGS] ACCOUNT/CONTAINER/OBJECT\n")
+		fmt.Fprintf(os.Stderr, "  Checks that every segment of an SLO manifest exists with the etag and size\n")
+		fmt.Fprintf(os.Stderr, "  the manifest expects, including those of nested manifests.\n")
+		sloVerifyFlags.PrintDefaults()
+	}
+
+	migrateFlags := flag.NewFlagSet("", flag.ExitOnError)
+	migrateFlags.String("src-auth-url", "", "Auth url of the source cluster; without it the source is this cluster")
+	migrateFlags.String("src-user", "", "User to authenticate with the source cluster as")
+	migrateFlags.String("src-key", "", "Key to authenticate with the source cluster with")
+	migrateFlags.String("src-password", "", "Password to authenticate with the source cluster with")
+	migrateFlags.String("src-tenant", "", "Tenant to authenticate with the source cluster as")
+	migrateFlags.String("src-region", "", "Region of the source cluster to use")
+	migrateFlags.Bool("src-insecure", false, "Don't check the source cluster's auth certificate")
+	migrateFlags.String("dst-account", "", "Account to migrate into, if not the same as the source account")
+	migrateFlags.String("container-suffix", "", "Suffix added to the names of destination containers")
+	migrateFlags.String("policy", "", "Storage policy for the destination containers")
+	migrateFlags.Int("concurrency", 8, "Number of objects to copy at once")
+	migrateFlags.String("checkpoint", "", "File recording progress, so an interrupted migration can be resumed")
+	migrateFlags.Bool("verify-only", false, "Only report differences between the source and destination")
+	migrateFlags.Bool("json", false, "Output the difference report in json")
+	migrateFlags.String("certfile", "", "Cert file to use for setting up https client")
+	migrateFlags.String("keyfile", "", "Key file to use for setting up https client")
+	migrateFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "hummingbird migrate [ARGS] ACCOUNT[/CONTAINER]\n")
+		fmt.Fprintf(os.Stderr, "  Copies an account or container from another cluster, or into another storage\n")
+		fmt.Fprintf(os.Stderr, "  policy of this one, verifying etags, then reports what differs.\n")
+		migrateFlags.PrintDefaults()
+	}
+
 	/* main flag parser, which doesn't do much */
 
 	flag.Usage = func() {
@@ -417,6 +558,16 @@ func main() {
 		fmt.Fprintln(os.Stderr)
 		objectReplicatorFlags.Usage()
 		fmt.Fprintln(os.Stderr)
+		objectAuditorFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		indexConvertFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		indexBackupFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		indexRestoreFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		handoffsFlags.Usage()
+		fmt.Fprintln(os.Stderr)
 		ringBuilderFlags.Usage()
 		fmt.Fprintln(os.Stderr)
 		proxyFlags.Usage()
@@ -427,6 +578,9 @@ func main() {
 		fmt.Fprintln(os.Stderr, "hummingbird restoredevice [ip] [device-name]")
 		fmt.Fprintln(os.Stderr, "  Reconstruct a device from its peers")
 		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "hummingbird drain [ip] [device-name]")
+		fmt.Fprintln(os.Stderr, "  Take a device out of the object ring and move its data off it")
+		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "hummingbird bench CONFIG")
 		fmt.Fprintln(os.Stderr, "  Run bench tool")
 		fmt.Fprintln(os.Stderr)
@@ -457,7 +611,19 @@ func main() {
 		fmt.Fprintln(os.Stderr)
 		objectInfoFlags.Usage()
 		fmt.Fprintln(os.Stderr)
+		infoFlags.Usage()
+		fmt.Fprintln(os.Stderr)
 		reconFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		dfFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		maintenanceFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		diskVerifyFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		sloVerifyFlags.Usage()
+		fmt.Fprintln(os.Stderr)
+		migrateFlags.Usage()
 	}
 
 	flag.Parse()
@@ -501,6 +667,21 @@ func main() {
 	case "object-replicator":
 		objectReplicatorFlags.Parse(flag.Args()[1:])
 		srv.RunServers(objectserver.NewReplicator, objectReplicatorFlags)
+	case "object-auditor":
+		objectAuditorFlags.Parse(flag.Args()[1:])
+		objectserver.RunAuditorOnce(objectAuditorFlags, srv.DefaultConfigLoader{})
+	case "index-convert":
+		indexConvertFlags.Parse(flag.Args()[1:])
+		objectserver.RunIndexConvert(indexConvertFlags, srv.DefaultConfigLoader{})
+	case "index-backup":
+		indexBackupFlags.Parse(flag.Args()[1:])
+		objectserver.RunIndexBackup(indexBackupFlags, srv.DefaultConfigLoader{})
+	case "index-restore":
+		indexRestoreFlags.Parse(flag.Args()[1:])
+		objectserver.RunIndexRestore(indexRestoreFlags, srv.DefaultConfigLoader{})
+	case "handoffs":
+		handoffsFlags.Parse(flag.Args()[1:])
+		objectserver.RunHandoffs(handoffsFlags, srv.DefaultConfigLoader{})
 	case "bench":
 		bench.RunBench(flag.Args()[1:])
 	case "dbench":
@@ -515,6 +696,8 @@ func main() {
 		objectserver.MoveParts(flag.Args()[1:], srv.DefaultConfigLoader{})
 	case "restoredevice":
 		objectserver.RestoreDevice(flag.Args()[1:], srv.DefaultConfigLoader{})
+	case "drain":
+		objectserver.Drain(flag.Args()[1:], srv.DefaultConfigLoader{})
 	case "ring":
 		ringBuilderFlags.Parse(flag.Args()[1:])
 		tools.RingBuildCmd(ringBuilderFlags)
@@ -527,11 +710,41 @@ func main() {
 	case "oinfo":
 		objectInfoFlags.Parse(flag.Args()[1:])
 		tools.ObjectInfo(objectInfoFlags, srv.DefaultConfigLoader{})
+	case "info":
+		infoFlags.Parse(flag.Args()[1:])
+		if pass := tools.Info(infoFlags, srv.DefaultConfigLoader{}); !pass {
+			os.Exit(1)
+		}
 	case "recon":
 		reconFlags.Parse(flag.Args()[1:])
 		if pass := tools.ReconClient(reconFlags, srv.DefaultConfigLoader{}); !pass {
 			os.Exit(1)
 		}
+	case "df":
+		dfFlags.Parse(flag.Args()[1:])
+		if pass := tools.DiskFree(dfFlags); !pass {
+			os.Exit(1)
+		}
+	case "maintenance":
+		maintenanceFlags.Parse(flag.Args()[1:])
+		if pass := tools.Maintenance(maintenanceFlags, srv.DefaultConfigLoader{}); !pass {
+			os.Exit(1)
+		}
+	case "disk-verify":
+		diskVerifyFlags.Parse(flag.Args()[1:])
+		if pass := tools.DiskVerify(diskVerifyFlags); !pass {
+			os.Exit(1)
+		}
+	case "slo-verify":
+		sloVerifyFlags.Parse(flag.Args()[1:])
+		if pass := tools.SloVerify(sloVerifyFlags, srv.DefaultConfigLoader{}); !pass {
+			os.Exit(1)
+		}
+	case "migrate":
+		migrateFlags.Parse(flag.Args()[1:])
+		if pass := tools.Migrate(migrateFlags, srv.DefaultConfigLoader{}); !pass {
+			os.Exit(1)
+		}
 	case "init":
 		if err := initCommand(flag.Args()[1:]); err != nil {
 			fmt.Fprintln(os.Stderr, "init error:", err)
@@ -22,16 +22,44 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/troubling/hummingbird/common"
 	"github.com/vaughan0/go-ini"
 )
 
 // Config represents an ini file.
-type Config struct{ ini.File }
+type Config struct {
+	ini.File
+	used *usedKeys
+}
+
+// usedKeys records which keys have been looked up, so UnknownKeys can report
+// the ones nothing asked for.
+type usedKeys struct {
+	sync.Mutex
+	keys map[string]map[string]bool
+}
+
+func (u *usedKeys) mark(section, key string) {
+	if u == nil {
+		return
+	}
+	u.Lock()
+	defer u.Unlock()
+	if u.keys[section] == nil {
+		u.keys[section] = map[string]bool{}
+	}
+	u.keys[section][key] = true
+}
+
+func newConfig() Config {
+	return Config{File: make(ini.File), used: &usedKeys{keys: map[string]map[string]bool{}}}
+}
 
 type Section struct {
 	ini.Section
@@ -41,6 +69,10 @@ type Section struct {
 
 // Get fetches a value from the Config, looking in the DEFAULT section if not found in the specific section.  Also ignores "set " key prefixes, like paste.
 func (f Config) Get(section string, key string) (string, bool) {
+	f.used.mark(section, key)
+	f.used.mark("DEFAULT", key)
+	f.used.mark(section, "set "+key)
+	f.used.mark("DEFAULT", "set "+key)
 	if value, ok := f.File.Get(section, key); ok {
 		return value, true
 	} else if value, ok := f.File.Get("DEFAULT", key); ok {
@@ -140,9 +172,98 @@ func (s Section) GetConfig() Config {
 	return s.c
 }
 
+// Keys returns the keys set in the section itself, for settings that aren't
+// known ahead of time, like tempauth's user_<account>_<user> entries.
+func (s Section) Keys() []string {
+	keys := make([]string, 0, len(s.Section))
+	for key := range s.Section {
+		s.c.used.mark(s.section, key)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UnknownKeys returns "section/key" for each key that hasn't been looked up,
+// so daemons can warn about misspelled or obsolete settings once they've read
+// their config.  Sections nothing was read from at all are left out, since
+// they are probably for some other daemon sharing the file.
+func (f Config) UnknownKeys() []string {
+	if f.used == nil {
+		return nil
+	}
+	f.used.Lock()
+	defer f.used.Unlock()
+	var unknown []string
+	for section, values := range f.File {
+		used := f.used.keys[section]
+		if section == "DEFAULT" || len(used) == 0 {
+			continue
+		}
+		for key := range values {
+			if !used[key] {
+				unknown = append(unknown, section+"/"+key)
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+var envVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv replaces ${NAME} in values with the environment variable
+// NAME, or with default in ${NAME:-default} if NAME isn't set.  Referring
+// to an unset variable without a default is an error.
+func (f Config) interpolateEnv() error {
+	for section, values := range f.File {
+		for key, value := range values {
+			var err error
+			values[key] = envVarRegex.ReplaceAllStringFunc(value, func(ref string) string {
+				match := envVarRegex.FindStringSubmatch(ref)
+				if v, ok := os.LookupEnv(match[1]); ok {
+					return v
+				} else if match[2] != "" {
+					return match[3]
+				}
+				err = fmt.Errorf("Environment variable %s used by %s/%s is not set", match[1], section, key)
+				return ref
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// merge copies src's settings over f's, key by key.
+func (f Config) merge(src Config) {
+	for sec, values := range src.File {
+		if f.File[sec] == nil {
+			f.File[sec] = make(ini.Section)
+		}
+		for key, value := range values {
+			f.File[sec][key] = value
+		}
+	}
+}
+
+// snippetDir returns the directory of conf.d snippets for the config at path,
+// which is named for the config so each daemon only picks up its own:
+// proxy-server.conf and proxy-server.conf.d both use conf.d/proxy-server.
+func snippetDir(path string) string {
+	path = filepath.Clean(path)
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".d"), ".conf")
+	return filepath.Join(filepath.Dir(path), "conf.d", name)
+}
+
 // LoadConfig loads an ini from a path.  The path should be a *.conf file or a *.conf.d directory.
+// The config's settings may be extended or overridden key by key by *.conf snippets in the conf.d
+// subdirectory named for it alongside it; see snippetDir.  Values may refer to environment variables
+// as ${NAME} or ${NAME:-default}.
 func LoadConfig(path string) (Config, error) {
-	file := Config{make(ini.File)}
+	file := newConfig()
 	if fi, err := os.Stat(path); err != nil {
 		return file, err
 	} else if fi.IsDir() {
@@ -152,17 +273,30 @@ func LoadConfig(path string) (Config, error) {
 		}
 		sort.Strings(files)
 		for _, subfile := range files {
-			sf, err := LoadConfig(subfile)
-			if err != nil {
+			sf := newConfig()
+			if err := sf.LoadFile(subfile); err != nil {
 				return file, err
 			}
 			for sec, val := range sf.File {
 				file.File[sec] = val
 			}
 		}
-		return file, nil
+	} else if err := file.LoadFile(path); err != nil {
+		return file, err
+	}
+	snippets, err := filepath.Glob(filepath.Join(snippetDir(path), "*.conf"))
+	if err != nil {
+		return file, err
+	}
+	sort.Strings(snippets)
+	for _, snippet := range snippets {
+		sf := newConfig()
+		if err := sf.LoadFile(snippet); err != nil {
+			return file, err
+		}
+		file.merge(sf)
 	}
-	return file, file.LoadFile(path)
+	return file, file.interpolateEnv()
 }
 
 // LoadConfigs finds and loads any configs that exist for the given path.  Multiple configs are supported for things like SAIO setups.
@@ -192,7 +326,7 @@ func LoadConfigs(path string) ([]Config, error) {
 
 // StringConfig returns an Config from a string, for use in tests.
 func StringConfig(data string) (Config, error) {
-	file := Config{make(ini.File)}
+	file := newConfig()
 	return file, file.Load(bytes.NewBufferString(data))
 }
 
@@ -63,6 +63,63 @@ func TestConfD(t *testing.T) {
 	require.Equal(t, int(3), int(iniFile.GetInt("otherstuff", "intvalue", 0))) // otherstuff from earlier conf was preserved
 }
 
+func TestConfDSnippets(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+	require.Nil(t, os.MkdirAll(filepath.Join(tempDir, "conf.d", "object-server"), 0777))
+	require.Nil(t, os.MkdirAll(filepath.Join(tempDir, "conf.d", "proxy-server"), 0777))
+	ioutil.WriteFile(filepath.Join(tempDir, "object-server.conf"), []byte("[stuff]\ntruevalue=true\nintvalue=3\n"), 0666)
+	ioutil.WriteFile(filepath.Join(tempDir, "conf.d", "object-server", "10-ints.conf"), []byte("[stuff]\nintvalue=4\n"), 0666)
+	ioutil.WriteFile(filepath.Join(tempDir, "conf.d", "object-server", "20-more.conf"), []byte("[stuff]\nfalsevalue=false\n[otherstuff]\nintvalue=5\n"), 0666)
+	ioutil.WriteFile(filepath.Join(tempDir, "conf.d", "proxy-server", "10-ints.conf"), []byte("[stuff]\nintvalue=6\n"), 0666)
+	iniFile, err := LoadConfig(filepath.Join(tempDir, "object-server.conf"))
+	require.Nil(t, err)
+	require.Equal(t, true, iniFile.GetBool("stuff", "truevalue", false))  // kept from the main file
+	require.Equal(t, false, iniFile.GetBool("stuff", "falsevalue", true)) // added by a snippet
+	require.Equal(t, int64(4), iniFile.GetInt("stuff", "intvalue", 0))    // overridden by a snippet, not the proxy's
+	require.Equal(t, int64(5), iniFile.GetInt("otherstuff", "intvalue", 0))
+
+	// a directory config gets its snippets once, after all of its files
+	require.Nil(t, os.MkdirAll(filepath.Join(tempDir, "proxy-server.conf.d"), 0777))
+	ioutil.WriteFile(filepath.Join(tempDir, "proxy-server.conf.d", "1.conf"), []byte("[stuff]\nintvalue=1\n"), 0666)
+	ioutil.WriteFile(filepath.Join(tempDir, "proxy-server.conf.d", "2.conf"), []byte("[otherstuff]\nintvalue=2\n"), 0666)
+	iniFile, err = LoadConfig(filepath.Join(tempDir, "proxy-server.conf.d"))
+	require.Nil(t, err)
+	require.Equal(t, int64(6), iniFile.GetInt("stuff", "intvalue", 0))
+	require.Equal(t, int64(2), iniFile.GetInt("otherstuff", "intvalue", 0))
+	require.Equal(t, true, iniFile.GetBool("stuff", "falsevalue", true)) // only the proxy's snippets apply
+}
+
+func TestConfigEnvInterpolation(t *testing.T) {
+	os.Setenv("HB_TEST_CONF_PORT", "6543")
+	defer os.Unsetenv("HB_TEST_CONF_PORT")
+	tempFile, err := ioutil.TempFile("", "INI")
+	require.Nil(t, err)
+	defer os.RemoveAll(tempFile.Name())
+	tempFile.WriteString("[stuff]\nport=${HB_TEST_CONF_PORT}\nhost=${HB_TEST_CONF_HOST:-127.0.0.1}\nurl=http://${HB_TEST_CONF_HOST:-localhost}:${HB_TEST_CONF_PORT}/\nprice=$5\n")
+	iniFile, err := LoadConfig(tempFile.Name())
+	require.Nil(t, err)
+	require.Equal(t, int64(6543), iniFile.GetInt("stuff", "port", 0))
+	require.Equal(t, "127.0.0.1", iniFile.GetDefault("stuff", "host", ""))
+	require.Equal(t, "http://localhost:6543/", iniFile.GetDefault("stuff", "url", ""))
+	require.Equal(t, "$5", iniFile.GetDefault("stuff", "price", ""))
+
+	tempFile.WriteString("missing=${HB_TEST_CONF_MISSING}\n")
+	_, err = LoadConfig(tempFile.Name())
+	require.NotNil(t, err)
+}
+
+func TestUnknownKeys(t *testing.T) {
+	iniFile, err := StringConfig("[DEFAULT]\nlog_level=INFO\n[app:object-server]\nbind_port=6000\nbind_prot=6001\nset log_facility=LOG_LOCAL1\n[object-replicator]\nconcurrency=4\n")
+	require.Nil(t, err)
+	iniFile.GetInt("app:object-server", "bind_port", 0)
+	iniFile.GetDefault("app:object-server", "log_facility", "")
+	require.Equal(t, []string{"app:object-server/bind_prot"}, iniFile.UnknownKeys())
+	require.Equal(t, []string{"concurrency"}, iniFile.GetSection("object-replicator").Keys())
+	require.Equal(t, []string{"app:object-server/bind_prot"}, iniFile.UnknownKeys())
+}
+
 func TestLoadConfigs(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	require.Nil(t, err)
@@ -60,6 +60,47 @@ func (p Policy) GetDbSubDirs() (int, error) {
 	return subdirs, nil
 }
 
+// GetDbBackend returns what the policy keeps its object indexes in: "sqlite",
+// the default, or "badger".
+func (p Policy) GetDbBackend() (string, error) {
+	switch backend := strings.ToLower(p.Config["db_backend"]); backend {
+	case "", "sqlite":
+		return "sqlite", nil
+	case "badger":
+		return backend, nil
+	default:
+		return "", fmt.Errorf("Unknown db_backend %q", p.Config["db_backend"])
+	}
+}
+
+// GetChecksumAlgorithm returns the checksum_algorithm of the policy: "md5",
+// the default, or "sha256", in which case objects also get a SHA-256
+// checksum alongside their MD5 etag.
+func (p Policy) GetChecksumAlgorithm() (string, error) {
+	switch algorithm := strings.ToLower(p.Config["checksum_algorithm"]); algorithm {
+	case "", "md5":
+		return "md5", nil
+	case "sha256":
+		return algorithm, nil
+	default:
+		return "", fmt.Errorf("Unknown checksum_algorithm %q", p.Config["checksum_algorithm"])
+	}
+}
+
+// GetInlineMaxSize returns, in bytes, the inline_max_kb of the policy:
+// objects up to that size are kept in their index rows instead of files.
+// Zero, the default, keeps every object in a file.
+func (p Policy) GetInlineMaxSize() (int64, error) {
+	if p.Config["inline_max_kb"] == "" {
+		return 0, nil
+	}
+	kb, err := strconv.ParseInt(p.Config["inline_max_kb"], 10, 64)
+	if err != nil || kb < 0 {
+		return 0, fmt.Errorf("Could not parse inline_max_kb value %q", p.Config["inline_max_kb"])
+	}
+	return kb * 1024, nil
+}
+
 type PolicyList map[int]*Policy
 
 func (p PolicyList) Default() int {
@@ -99,6 +140,9 @@ func (p PolicyList) GetPolicyInfo() []map[string]interface{} {
 			pol["default"] = v.Default
 		}
 		pol["aliases"] = strings.Join(v.Aliases, ", ")
+		if algorithm, err := v.GetChecksumAlgorithm(); err == nil && algorithm != "md5" {
+			pol["checksum_algorithm"] = algorithm
+		}
 		policyInfo = append(policyInfo, pol)
 	}
 	return policyInfo
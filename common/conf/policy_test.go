@@ -51,7 +51,7 @@ func TestGetPolicyInfo(t *testing.T) {
 	tempFile, _ := ioutil.TempFile("", "INI")
 	tempFile.Write([]byte("[swift-hash]\nswift_hash_path_prefix = changeme\nswift_hash_path_suffix = changeme\n" +
 		"[storage-policy:0]\nname = gold\naliases = yellow, orange\npolicy_type = replication\ndefault = yes\n" +
-		"[storage-policy:1]\nname = rose\naliases = rose, apple\npolicy_type = replication\n" +
+		"[storage-policy:1]\nname = rose\naliases = rose, apple\npolicy_type = replication\nchecksum_algorithm = sha256\n" +
 		"[storage-policy:2]\nname = silver\npolicy_type = replication\ndeprecated = yes\n"))
 	oldConfigs := configLocations
 	defer func() {
@@ -69,12 +69,35 @@ func TestGetPolicyInfo(t *testing.T) {
 		"aliases": "gold, yellow, orange",
 	}
 	expectedRose := map[string]interface{}{"name": "rose",
-		"aliases": "rose, apple",
+		"aliases":            "rose, apple",
+		"checksum_algorithm": "sha256",
 	}
 	require.Contains(t, policyInfo, expectedGold)
 	require.Contains(t, policyInfo, expectedRose)
 }
 
+func TestGetChecksumAlgorithm(t *testing.T) {
+	algorithm, err := Policy{Config: map[string]string{}}.GetChecksumAlgorithm()
+	require.Nil(t, err)
+	require.Equal(t, "md5", algorithm)
+	algorithm, err = Policy{Config: map[string]string{"checksum_algorithm": "SHA256"}}.GetChecksumAlgorithm()
+	require.Nil(t, err)
+	require.Equal(t, "sha256", algorithm)
+	_, err = Policy{Config: map[string]string{"checksum_algorithm": "crc32"}}.GetChecksumAlgorithm()
+	require.NotNil(t, err)
+}
+
+func TestGetDbBackend(t *testing.T) {
+	backend, err := Policy{Config: map[string]string{}}.GetDbBackend()
+	require.Nil(t, err)
+	require.Equal(t, "sqlite", backend)
+	backend, err = Policy{Config: map[string]string{"db_backend": "Badger"}}.GetDbBackend()
+	require.Nil(t, err)
+	require.Equal(t, "badger", backend)
+	_, err = Policy{Config: map[string]string{"db_backend": "lmdb"}}.GetDbBackend()
+	require.NotNil(t, err)
+}
+
 func TestNoPolicies(t *testing.T) {
 	tempFile, _ := ioutil.TempFile("", "INI")
 	tempFile.Write([]byte("[swift-hash]\nswift_hash_path_prefix = changeme\nswift_hash_path_suffix = changeme\n"))
@@ -16,12 +16,12 @@
 package common
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -66,24 +66,86 @@ var OwnerHeaders = map[string]bool{
 	"x-account-access-control":        true,
 }
 
-var ErrBadRequest = errors.New("bad request")
-var ErrNotFound = errors.New("not found")
-var ErrConflict = errors.New("conflict")
-var ErrDisconnect = errors.New("disconnect")
+// Constraints are the request limits the proxy enforces, and advertises in
+// /info.  They default to DefaultConstraints, and each can be changed in the
+// proxy's config by the name it's advertised under.
+type Constraints struct {
+	MaxFileSize        int64
+	MaxMetaNameLength  int
+	MaxMetaValueLength int
+	MaxMetaCount       int
+	MaxMetaOverallSize int
+	MaxHeaderSize      int
+	ExtraHeaderCount   int
+}
+
+var DefaultConstraints = Constraints{
+	MaxFileSize:        MAX_FILE_SIZE,
+	MaxMetaNameLength:  MAX_META_NAME_LENGTH,
+	MaxMetaValueLength: MAX_META_VALUE_LENGTH,
+	MaxMetaCount:       MAX_META_COUNT,
+	MaxMetaOverallSize: MAX_META_OVERALL_SIZE,
+	MaxHeaderSize:      MAX_HEADER_SIZE,
+	ExtraHeaderCount:   EXTRA_HEADER_COUNT,
+}
+
+// MaxHeaderCount is how many headers a request may have: enough for the most
+// metadata allowed, 20 for everything else, and extra_header_count more for
+// clients that need them, as in Swift.
+func (c *Constraints) MaxHeaderCount() int {
+	return c.MaxMetaCount + 20 + c.ExtraHeaderCount
+}
+
+// Info returns the constraints as they're advertised in /info.
+func (c *Constraints) Info() map[string]interface{} {
+	info := map[string]interface{}{}
+	for k, v := range DEFAULT_CONSTRAINTS {
+		info[k] = v
+	}
+	info["max_file_size"] = c.MaxFileSize
+	info["max_meta_name_length"] = c.MaxMetaNameLength
+	info["max_meta_value_length"] = c.MaxMetaValueLength
+	info["max_meta_count"] = c.MaxMetaCount
+	info["max_meta_overall_size"] = c.MaxMetaOverallSize
+	info["max_header_size"] = c.MaxHeaderSize
+	info["extra_header_count"] = c.ExtraHeaderCount
+	return info
+}
+
+// CheckHeaderCount checks that the request has no more than MaxHeaderCount
+// headers.  It should be called on the request as the client sent it, before
+// anything adds headers of its own.
+func (c *Constraints) CheckHeaderCount(req *http.Request) (int, string) {
+	headerCount := 0
+	for _, values := range req.Header {
+		headerCount += len(values)
+	}
+	if headerCount > c.MaxHeaderCount() {
+		return http.StatusBadRequest, fmt.Sprintf("Too many headers; max %d", c.MaxHeaderCount())
+	}
+	return http.StatusOK, ""
+}
 
 func CheckMetadata(req *http.Request, targetType string) (int, string) {
+	return DefaultConstraints.CheckMetadata(req, targetType)
+}
+
+// CheckMetadata checks the request's headers, and its targetType metadata in
+// particular, against the constraints, saying which header broke which limit
+// if one did.
+func (c *Constraints) CheckMetadata(req *http.Request, targetType string) (int, string) {
 	metaCount := 0
 	metaSize := 0
 	metaPrefix := fmt.Sprintf("X-%s-Meta-", targetType)
 	fixKeys := make(map[string]string)
 	for key := range req.Header {
 		value := req.Header.Get(key)
-		if len(value) > MAX_HEADER_SIZE {
-			errStr := fmt.Sprintf("Header value too long: %s", key)
-			if len(key) > MAX_META_NAME_LENGTH {
-				errStr = fmt.Sprintf("Header value too long: %s", key[:MAX_META_NAME_LENGTH])
+		if len(value) > c.MaxHeaderSize {
+			name := key
+			if len(name) > c.MaxMetaNameLength {
+				name = name[:c.MaxMetaNameLength]
 			}
-			return http.StatusBadRequest, errStr
+			return http.StatusBadRequest, fmt.Sprintf("Header value longer than %d: %s", c.MaxHeaderSize, name)
 		}
 		if !strings.HasPrefix(key, metaPrefix) {
 			continue
@@ -97,17 +159,17 @@ func CheckMetadata(req *http.Request, targetType string) (int, string) {
 		if StringInSlice(targetType, []string{"Account", "Container"}) && (strings.Contains(key, "\x00") || strings.Contains(value, "\x00")) {
 			return http.StatusBadRequest, "Metadata must be valid UTF-8"
 		}
-		if len(key) > MAX_META_NAME_LENGTH {
-			return http.StatusBadRequest, fmt.Sprintf("Metadata name too long: %s%s", metaPrefix, key)
+		if len(key) > c.MaxMetaNameLength {
+			return http.StatusBadRequest, fmt.Sprintf("Metadata name longer than %d: %s%s", c.MaxMetaNameLength, metaPrefix, key)
 		}
-		if len(value) > MAX_META_VALUE_LENGTH {
-			return http.StatusBadRequest, fmt.Sprintf("Metadata value longer than %d: %s%s", MAX_META_VALUE_LENGTH, metaPrefix, key)
+		if len(value) > c.MaxMetaValueLength {
+			return http.StatusBadRequest, fmt.Sprintf("Metadata value longer than %d: %s%s", c.MaxMetaValueLength, metaPrefix, key)
 		}
-		if metaCount > MAX_META_COUNT {
-			return http.StatusBadRequest, fmt.Sprintf("Too many metadata items; max %d", MAX_META_COUNT)
+		if metaCount > c.MaxMetaCount {
+			return http.StatusBadRequest, fmt.Sprintf("Too many metadata items; max %d", c.MaxMetaCount)
 		}
-		if metaSize > MAX_META_OVERALL_SIZE {
-			return http.StatusBadRequest, fmt.Sprintf("Total metadata too large; max %d", MAX_META_OVERALL_SIZE)
+		if metaSize > c.MaxMetaOverallSize {
+			return http.StatusBadRequest, fmt.Sprintf("Total metadata too large; max %d", c.MaxMetaOverallSize)
 		}
 		fixedKey := strings.Replace(key, "_", "-", -1)
 		if key != fixedKey {
@@ -143,14 +205,30 @@ func handleObjDeleteHeaders(req *http.Request) (int, string) {
 }
 
 func CheckObjPost(req *http.Request, objectName string) (int, string) {
+	return DefaultConstraints.CheckObjPost(req, objectName)
+}
+
+func (c *Constraints) CheckObjPost(req *http.Request, objectName string) (int, string) {
 	if status, msg := handleObjDeleteHeaders(req); status != http.StatusOK {
 		return status, msg
 	}
-	return CheckMetadata(req, "Object")
+	return c.CheckMetadata(req, "Object")
 }
 
 func CheckObjPut(req *http.Request, objectName string) (int, string) {
-	if req.ContentLength > MAX_FILE_SIZE {
+	return DefaultConstraints.CheckObjPut(req, objectName)
+}
+
+// CheckObjPutMaxSize is CheckObjPut for clusters that allow objects larger
+// than MAX_FILE_SIZE.
+func CheckObjPutMaxSize(req *http.Request, objectName string, maxFileSize int64) (int, string) {
+	c := DefaultConstraints
+	c.MaxFileSize = maxFileSize
+	return c.CheckObjPut(req, objectName)
+}
+
+func (c *Constraints) CheckObjPut(req *http.Request, objectName string) (int, string) {
+	if req.ContentLength > c.MaxFileSize {
 		return http.StatusRequestEntityTooLarge, "Your request is too large."
 	}
 	if req.Header.Get("X-Copy-From") != "" && req.ContentLength != 0 {
@@ -171,12 +249,41 @@ func CheckObjPut(req *http.Request, objectName string) (int, string) {
 	if strings.Contains(req.Header.Get("Content-Type"), "\x00") {
 		return http.StatusBadRequest, "Invalid Content-Type"
 	}
-	return CheckMetadata(req, "Object")
+	return c.CheckMetadata(req, "Object")
+}
+
+// CheckName validates an account, container or object name.  Names must be
+// valid UTF-8 without NULs, and names being created must also fit in
+// maxLength bytes and have no other control characters, so names that got in
+// before these rules were enforced can still be read and deleted.
+func CheckName(name, kind string, maxLength int, creating bool) (int, string) {
+	if !utf8.ValidString(name) {
+		return http.StatusPreconditionFailed, fmt.Sprintf("%s name is not valid UTF-8", kind)
+	}
+	if strings.Contains(name, "\x00") {
+		return http.StatusPreconditionFailed, fmt.Sprintf("%s name contains NULL", kind)
+	}
+	if !creating {
+		return http.StatusOK, ""
+	}
+	if len(name) > maxLength {
+		return http.StatusBadRequest, fmt.Sprintf("%s name length of %d longer than %d", kind, len(name), maxLength)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return http.StatusBadRequest, fmt.Sprintf("%s name contains control character %U", kind, r)
+		}
+	}
+	return http.StatusOK, ""
 }
 
 func CheckContainerPut(req *http.Request, containerName string) (int, string) {
+	return DefaultConstraints.CheckContainerPut(req, containerName)
+}
+
+func (c *Constraints) CheckContainerPut(req *http.Request, containerName string) (int, string) {
 	if len(containerName) > MAX_CONTAINER_NAME_LENGTH {
 		return http.StatusBadRequest, fmt.Sprintf("Container name length of %d longer than %d", len(containerName), MAX_CONTAINER_NAME_LENGTH)
 	}
-	return CheckMetadata(req, "Container")
+	return c.CheckMetadata(req, "Container")
 }
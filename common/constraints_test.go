@@ -33,6 +33,20 @@ func TestPutTooBig(t *testing.T) {
 	require.Equal(t, http.StatusRequestEntityTooLarge, status)
 }
 
+func TestPutMaxSize(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Length", "21474836480")
+	req.ContentLength = 20 * 1024 * 1024 * 1024
+	status, _ := CheckObjPut(req, "o")
+	require.Equal(t, http.StatusRequestEntityTooLarge, status)
+	status, _ = CheckObjPutMaxSize(req, "o", 50*1024*1024*1024)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = CheckObjPutMaxSize(req, "o", req.ContentLength-1)
+	require.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
 func TestBadTransferEncoding(t *testing.T) {
 	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
 	require.Nil(t, err)
@@ -190,6 +204,60 @@ func TestTooMuchMeta(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, status)
 }
 
+func TestTooManyHeaders(t *testing.T) {
+	c := DefaultConstraints
+	c.MaxMetaCount = 2
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	for i := 0; i < c.MaxHeaderCount(); i++ {
+		req.Header.Set(fmt.Sprintf("X-Header-%d", i), "X")
+	}
+	status, _ := c.CheckHeaderCount(req)
+	require.Equal(t, http.StatusOK, status)
+	req.Header.Add("X-Header-0", "Y")
+	status, msg := c.CheckHeaderCount(req)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "Too many headers; max 22", msg)
+}
+
+func TestConfiguredConstraints(t *testing.T) {
+	c := DefaultConstraints
+	c.MaxMetaNameLength = 4
+	c.MaxMetaValueLength = 8
+	req, err := http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Meta-Longer", "X")
+	status, msg := c.CheckContainerPut(req, "c")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "Metadata name longer than 4: X-Container-Meta-Longer", msg)
+
+	req.Header.Del("X-Container-Meta-Longer")
+	req.Header.Set("X-Container-Meta-Key", "123456789")
+	status, msg = c.CheckContainerPut(req, "c")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "Metadata value longer than 8: X-Container-Meta-Key", msg)
+
+	req.Header.Del("X-Container-Meta-Key")
+	req.Header.Set("X-Other", strings.Repeat("X", 17))
+	c = DefaultConstraints
+	c.MaxHeaderSize = 16
+	status, msg = c.CheckContainerPut(req, "c")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "Header value longer than 16: X-Other", msg)
+	status, _ = CheckContainerPut(req, "c")
+	require.Equal(t, http.StatusOK, status)
+}
+
+func TestConstraintsInfo(t *testing.T) {
+	c := DefaultConstraints
+	c.MaxFileSize = 10
+	c.MaxMetaCount = 3
+	info := c.Info()
+	require.Equal(t, int64(10), info["max_file_size"])
+	require.Equal(t, 3, info["max_meta_count"])
+	require.Equal(t, MAX_OBJECT_NAME_LENGTH, info["max_object_name_length"])
+}
+
 func TestContainerNameTooLong(t *testing.T) {
 	req, err := http.NewRequest("PUT", "/v1/a/c", nil)
 	require.Nil(t, err)
@@ -197,3 +265,19 @@ func TestContainerNameTooLong(t *testing.T) {
 	status, _ := CheckContainerPut(req, strings.Repeat("o", MAX_CONTAINER_NAME_LENGTH+1))
 	require.Equal(t, http.StatusBadRequest, status)
 }
+
+func TestCheckName(t *testing.T) {
+	status, _ := CheckName("caf\xc3\xa9", "Object", MAX_OBJECT_NAME_LENGTH, true)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = CheckName("caf\xe9", "Object", MAX_OBJECT_NAME_LENGTH, false)
+	require.Equal(t, http.StatusPreconditionFailed, status)
+	status, _ = CheckName("a\x00b", "Container", MAX_CONTAINER_NAME_LENGTH, false)
+	require.Equal(t, http.StatusPreconditionFailed, status)
+	status, _ = CheckName("line\nbreak", "Object", MAX_OBJECT_NAME_LENGTH, false)
+	require.Equal(t, http.StatusOK, status)
+	status, msg := CheckName("line\nbreak", "Object", MAX_OBJECT_NAME_LENGTH, true)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "Object name contains control character U+000A", msg)
+	status, _ = CheckName(strings.Repeat("a", MAX_ACCOUNT_NAME_LENGTH+1), "Account", MAX_ACCOUNT_NAME_LENGTH, true)
+	require.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,105 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"net/http"
+)
+
+// BackendError is an error that stands for a status a backend server answers
+// with, so code can ask what went wrong with the Is functions below rather
+// than comparing status codes, and servers can answer with the right status
+// for an error with ErrorStatus.
+type BackendError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *BackendError) Error() string {
+	return e.Message
+}
+
+var ErrBadRequest error = &BackendError{StatusCode: http.StatusBadRequest, Message: "bad request"}
+var ErrNotFound error = &BackendError{StatusCode: http.StatusNotFound, Message: "not found"}
+var ErrTimeout error = &BackendError{StatusCode: http.StatusRequestTimeout, Message: "timeout"}
+var ErrConflict error = &BackendError{StatusCode: http.StatusConflict, Message: "conflict"}
+var ErrPreconditionFailed error = &BackendError{StatusCode: http.StatusPreconditionFailed, Message: "precondition failed"}
+var ErrDisconnect error = &BackendError{StatusCode: 499, Message: "disconnect"}
+var ErrInsufficientStorage error = &BackendError{StatusCode: http.StatusInsufficientStorage, Message: "insufficient storage"}
+
+// ErrDiskUnmounted is the InsufficientStorage error for a device that isn't
+// mounted, or is otherwise out of service, as opposed to one that's full.
+var ErrDiskUnmounted error = &BackendError{StatusCode: http.StatusInsufficientStorage, Message: "disk unmounted"}
+
+// StatusError returns the error for a backend response status, nil for 2xx.
+func StatusError(statusCode int) error {
+	switch {
+	case statusCode/100 == 2:
+		return nil
+	case statusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case statusCode == http.StatusConflict:
+		return ErrConflict
+	case statusCode == http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case statusCode == 499:
+		return ErrDisconnect
+	case statusCode == http.StatusInsufficientStorage:
+		return ErrInsufficientStorage
+	}
+	return &BackendError{StatusCode: statusCode, Message: http.StatusText(statusCode)}
+}
+
+// ErrorStatus returns the status to answer with for err, 500 if it isn't a
+// BackendError.
+func ErrorStatus(err error) int {
+	if be, ok := err.(*BackendError); ok {
+		return be.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+func IsNotFound(err error) bool {
+	return ErrorStatus(err) == http.StatusNotFound
+}
+
+func IsConflict(err error) bool {
+	return ErrorStatus(err) == http.StatusConflict
+}
+
+func IsTimeout(err error) bool {
+	return err == ErrTimeout
+}
+
+// IsInsufficientStorage reports whether err means the device can't take the
+// request, whether because it's full or because it's unmounted.
+func IsInsufficientStorage(err error) bool {
+	return ErrorStatus(err) == http.StatusInsufficientStorage
+}
+
+func IsDiskUnmounted(err error) bool {
+	return err == ErrDiskUnmounted
+}
+
+// IsClientError reports whether err is down to the request rather than the
+// server or its devices.
+func IsClientError(err error) bool {
+	return ErrorStatus(err)/100 == 4
+}
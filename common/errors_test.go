@@ -0,0 +1,59 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusError(t *testing.T) {
+	require.Nil(t, StatusError(201))
+	require.Equal(t, ErrNotFound, StatusError(404))
+	require.Equal(t, ErrConflict, StatusError(409))
+	require.Equal(t, ErrPreconditionFailed, StatusError(412))
+	require.Equal(t, ErrTimeout, StatusError(408))
+	require.Equal(t, ErrTimeout, StatusError(504))
+	require.Equal(t, ErrInsufficientStorage, StatusError(507))
+	err := StatusError(503)
+	require.Equal(t, 503, ErrorStatus(err))
+	require.Equal(t, "Service Unavailable", err.Error())
+}
+
+func TestErrorStatus(t *testing.T) {
+	require.Equal(t, 400, ErrorStatus(ErrBadRequest))
+	require.Equal(t, 499, ErrorStatus(ErrDisconnect))
+	require.Equal(t, 507, ErrorStatus(ErrDiskUnmounted))
+	require.Equal(t, 500, ErrorStatus(errors.New("oops")))
+}
+
+func TestErrorKinds(t *testing.T) {
+	require.True(t, IsNotFound(ErrNotFound))
+	require.True(t, IsNotFound(&BackendError{StatusCode: 404, Message: "No such thing"}))
+	require.False(t, IsNotFound(errors.New("not found")))
+	require.False(t, IsNotFound(nil))
+	require.True(t, IsConflict(StatusError(409)))
+	require.True(t, IsTimeout(StatusError(504)))
+	require.True(t, IsInsufficientStorage(ErrDiskUnmounted))
+	require.True(t, IsInsufficientStorage(StatusError(507)))
+	require.True(t, IsDiskUnmounted(ErrDiskUnmounted))
+	require.False(t, IsDiskUnmounted(ErrInsufficientStorage))
+	require.True(t, IsClientError(ErrDisconnect))
+	require.False(t, IsClientError(ErrInsufficientStorage))
+	require.False(t, IsClientError(errors.New("oops")))
+}
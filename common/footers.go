@@ -0,0 +1,162 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+)
+
+// A backend object PUT can carry metadata that isn't known until its body has
+// been sent, such as the etag of data that was encrypted or erasure coded on
+// the way through, in a footer.  The body is then a MIME document, the same
+// as Swift's, with the object's data as the first part and a JSON map of the
+// metadata as the second:
+//
+//	--boundary
+//	X-Document: object body
+//
+//	<data>
+//	--boundary
+//	X-Document: object metadata
+//	Content-MD5: <md5 of the json>
+//
+//	<json>
+//	--boundary--
+const (
+	// MetadataFooterHeader says the PUT's body has a metadata footer.
+	MetadataFooterHeader = "X-Backend-Obj-Metadata-Footer"
+	// MimeBoundaryHeader gives the boundary of a footer PUT's parts.
+	MimeBoundaryHeader = "X-Backend-Obj-Multipart-Mime-Boundary"
+	// ObjContentLengthHeader gives the length of a footer PUT's data, since
+	// its Content-Length covers the whole document.
+	ObjContentLengthHeader = "X-Backend-Obj-Content-Length"
+)
+
+// FooterSource is a PUT body with metadata to send in a footer once it's
+// been read.
+type FooterSource interface {
+	io.Reader
+	// Footers returns the metadata for the footer.  It's only called once
+	// the body has all been read.
+	Footers() map[string]string
+}
+
+// FooterReader reads the data out of a PUT body with a metadata footer.
+type FooterReader struct {
+	mr   *multipart.Reader
+	body *multipart.Part
+}
+
+// NewFooterReader returns a FooterReader positioned at the start of the
+// object's data in r.
+func NewFooterReader(r io.Reader, boundary string) (*FooterReader, error) {
+	mr := multipart.NewReader(r, boundary)
+	body, err := mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	if doc := body.Header.Get("X-Document"); doc != "object body" {
+		return nil, fmt.Errorf("Expected object body, got %q", doc)
+	}
+	return &FooterReader{mr: mr, body: body}, nil
+}
+
+func (f *FooterReader) Read(b []byte) (int, error) {
+	return f.body.Read(b)
+}
+
+// Footers reads and returns the metadata footer.  It should only be called
+// once the data has all been read.
+func (f *FooterReader) Footers() (map[string]string, error) {
+	part, err := f.mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	if doc := part.Header.Get("X-Document"); doc != "object metadata" {
+		return nil, fmt.Errorf("Expected object metadata, got %q", doc)
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+	if sum := part.Header.Get("Content-MD5"); sum != "" {
+		if calculated := md5.Sum(data); sum != hex.EncodeToString(calculated[:]) {
+			return nil, fmt.Errorf("Footer MD5 mismatch")
+		}
+	}
+	footers := map[string]string{}
+	if err := json.Unmarshal(data, &footers); err != nil {
+		return nil, err
+	}
+	return footers, nil
+}
+
+// FooterWriter writes a PUT body with a metadata footer.  Headers for the
+// request should be set with Boundary before anything is written.
+type FooterWriter struct {
+	mw   *multipart.Writer
+	body io.Writer
+}
+
+// NewFooterWriter returns a FooterWriter that writes to w.
+func NewFooterWriter(w io.Writer) *FooterWriter {
+	return &FooterWriter{mw: multipart.NewWriter(w)}
+}
+
+// Boundary returns the value for the MimeBoundaryHeader.
+func (f *FooterWriter) Boundary() string {
+	return f.mw.Boundary()
+}
+
+func (f *FooterWriter) Write(b []byte) (int, error) {
+	if f.body == nil {
+		var err error
+		if f.body, err = f.mw.CreatePart(textproto.MIMEHeader{"X-Document": {"object body"}}); err != nil {
+			return 0, err
+		}
+	}
+	return f.body.Write(b)
+}
+
+// Close writes the metadata footer and ends the body.
+func (f *FooterWriter) Close(footers map[string]string) error {
+	if _, err := f.Write(nil); err != nil {
+		return err
+	}
+	data, err := json.Marshal(footers)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(data)
+	part, err := f.mw.CreatePart(textproto.MIMEHeader{
+		"X-Document":  {"object metadata"},
+		"Content-Md5": {hex.EncodeToString(sum[:])},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	return f.mw.Close()
+}
@@ -0,0 +1,85 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFooters(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fw := NewFooterWriter(buf)
+	fw.Write([]byte("SOME "))
+	fw.Write([]byte("DATA"))
+	require.Nil(t, fw.Close(map[string]string{"Etag": "abc", "X-Object-Meta-Foo": "bar"}))
+
+	fr, err := NewFooterReader(bytes.NewReader(buf.Bytes()), fw.Boundary())
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(fr)
+	require.Nil(t, err)
+	require.Equal(t, "SOME DATA", string(data))
+	footers, err := fr.Footers()
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"Etag": "abc", "X-Object-Meta-Foo": "bar"}, footers)
+}
+
+func TestFootersEmptyBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fw := NewFooterWriter(buf)
+	require.Nil(t, fw.Close(nil))
+	fr, err := NewFooterReader(bytes.NewReader(buf.Bytes()), fw.Boundary())
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(fr)
+	require.Nil(t, err)
+	require.Equal(t, "", string(data))
+	footers, err := fr.Footers()
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{}, footers)
+}
+
+func TestFootersTruncated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fw := NewFooterWriter(buf)
+	fw.Write([]byte("SOME DATA"))
+	require.Nil(t, fw.Close(map[string]string{"Etag": "abc"}))
+	fr, err := NewFooterReader(bytes.NewReader(buf.Bytes()[:strings.Index(buf.String(), "DATA")]), fw.Boundary())
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(fr)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFootersBadMD5(t *testing.T) {
+	doc := "--xx\r\nX-Document: object body\r\n\r\nhello\r\n" +
+		"--xx\r\nX-Document: object metadata\r\nContent-MD5: 0\r\n\r\n{}\r\n--xx--"
+	fr, err := NewFooterReader(strings.NewReader(doc), "xx")
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(fr)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(data))
+	_, err = fr.Footers()
+	require.NotNil(t, err)
+}
+
+func TestFootersNotObjectBody(t *testing.T) {
+	_, err := NewFooterReader(strings.NewReader("--xx\r\nX-Document: something\r\n\r\nhello\r\n--xx--"), "xx")
+	require.NotNil(t, err)
+}
@@ -18,6 +18,7 @@
 package fs
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -29,6 +30,7 @@ type TempFile struct {
 	*os.File
 	saved  bool
 	synced bool
+	policy SyncPolicy
 }
 
 // Abandon removes any resources associated with this file, if it hasn't already been saved.
@@ -50,9 +52,9 @@ func (o *TempFile) Save(dst string) error {
 	return o.Finalize(dst)
 }
 
-// sync file to disk
+// sync file to disk, as far as its SyncPolicy calls for
 func (o *TempFile) Sync() error {
-	if err := o.File.Sync(); err != nil {
+	if err := o.policy.SyncFile(o.File); err != nil {
 		return err
 	}
 	o.synced = true
@@ -83,6 +85,12 @@ func (o *TempFile) Preallocate(size int64, reserve int64) error {
 
 // NewAtomicFileWriter returns an AtomicFileWriter, which handles atomically writing files.
 func NewAtomicFileWriter(tempDir string, dstDir string) (AtomicFileWriter, error) {
+	return NewAtomicFileWriterSync(tempDir, dstDir, SyncAlways)
+}
+
+// NewAtomicFileWriterSync is NewAtomicFileWriter with the file synced as the
+// policy calls for, rather than always.
+func NewAtomicFileWriterSync(tempDir string, dstDir string, policy SyncPolicy) (AtomicFileWriter, error) {
 	if err := os.MkdirAll(tempDir, 0770); err != nil {
 		return nil, err
 	}
@@ -90,5 +98,22 @@ func NewAtomicFileWriter(tempDir string, dstDir string) (AtomicFileWriter, error
 	if err != nil {
 		return nil, err
 	}
-	return &TempFile{File: tempFile}, nil
+	return &TempFile{File: tempFile, policy: policy}, nil
+}
+
+// CheckTmpfile always fails, since O_TMPFILE is only available on Linux.
+func CheckTmpfile(dir string) error {
+	return errors.New("O_TMPFILE is only available on Linux")
+}
+
+// DropCache does nothing, since there's no portable way to drop a file's
+// cached pages.
+func DropCache(f *os.File) error {
+	return nil
+}
+
+// fdatasync falls back to a full fsync, since fdatasync isn't available
+// everywhere.
+func fdatasync(f *os.File) error {
+	return f.Sync()
 }
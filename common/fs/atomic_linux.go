@@ -85,6 +85,7 @@ type TempFile struct {
 	saved     bool
 	otempfile bool
 	synced    bool
+	policy    SyncPolicy
 }
 
 // Abandon removes any resources associated with this file, if it hasn't already been saved.
@@ -108,9 +109,9 @@ func (o *TempFile) Save(dst string) error {
 	return o.Finalize(dst)
 }
 
-// sync file to disk
+// sync file to disk, as far as its SyncPolicy calls for
 func (o *TempFile) Sync() error {
-	if err := o.File.Sync(); err != nil {
+	if err := o.policy.SyncFile(o.File); err != nil {
 		return err
 	}
 	o.synced = true
@@ -168,13 +169,19 @@ func (o *TempFile) Preallocate(size int64, reserve int64) error {
 
 // NewAtomicFileWriter returns an AtomicFileWriter, which handles atomically writing files.
 func NewAtomicFileWriter(tempDir string, dstDir string) (AtomicFileWriter, error) {
+	return NewAtomicFileWriterSync(tempDir, dstDir, SyncAlways)
+}
+
+// NewAtomicFileWriterSync is NewAtomicFileWriter with the file synced as the
+// policy calls for, rather than always.
+func NewAtomicFileWriterSync(tempDir string, dstDir string, policy SyncPolicy) (AtomicFileWriter, error) {
 	if useOTempfile {
 		if err := os.MkdirAll(dstDir, 0770); err != nil {
 			return nil, err
 		}
 		tempFile, err := os.OpenFile(dstDir, O_TMPFILE|os.O_RDWR, 0660)
 		if err == nil {
-			return &TempFile{File: tempFile, tempDir: tempDir, saved: false, otempfile: true}, nil
+			return &TempFile{File: tempFile, tempDir: tempDir, saved: false, otempfile: true, policy: policy}, nil
 		}
 	}
 	if err := os.MkdirAll(tempDir, 0770); err != nil {
@@ -184,5 +191,42 @@ func NewAtomicFileWriter(tempDir string, dstDir string) (AtomicFileWriter, error
 	if err != nil {
 		return nil, err
 	}
-	return &TempFile{File: tempFile, tempDir: tempDir, saved: false, otempfile: false}, nil
+	return &TempFile{File: tempFile, tempDir: tempDir, saved: false, otempfile: false, policy: policy}, nil
+}
+
+// CheckTmpfile checks that a file can be made in dir with O_TMPFILE and
+// linked into place, as NewAtomicFileWriter does when it can.
+func CheckTmpfile(dir string) error {
+	if !useOTempfile {
+		return errors.New("kernel is too old for O_TMPFILE")
+	}
+	tempFile, err := os.OpenFile(dir, O_TMPFILE|os.O_RDWR, 0660)
+	if err != nil {
+		return err
+	}
+	defer tempFile.Close()
+	if _, err := tempFile.Write([]byte("tmpfile")); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, fmt.Sprintf(".%016X", rand.Int63()))
+	if err := linkat(tempFile.Fd(), dst); err != nil {
+		return err
+	}
+	return os.Remove(dst)
+}
+
+// DropCache asks the kernel to drop any of the file's pages it has cached, so
+// the next read of it comes from the disk.
+func DropCache(f *os.File) error {
+	const POSIX_FADV_DONTNEED = 4
+	if _, _, err := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, POSIX_FADV_DONTNEED, 0, 0); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// fdatasync writes out f's data, and only as much of its metadata as it
+// takes to read the data back.
+func fdatasync(f *os.File) error {
+	return syscall.Fdatasync(int(f.Fd()))
 }
@@ -0,0 +1,69 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fs
+
+import (
+	"io"
+	"os"
+	"unsafe"
+)
+
+// DirectAlignment is what buffers and offsets are aligned to for O_DIRECT
+// reads.  It's the page size, which covers any disk's logical block size.
+const DirectAlignment = 4096
+
+// directBufferSize is how much CopyDirect reads at a time.
+const directBufferSize = 1024 * 1024
+
+// alignedBuffer returns a buffer of size bytes starting on a DirectAlignment
+// boundary.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+DirectAlignment)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (DirectAlignment - 1)); rem != 0 {
+		offset = DirectAlignment - rem
+	}
+	return buf[offset : offset+size]
+}
+
+// CopyDirect copies size bytes from the start of f, which has had SetDirect
+// called on it, to dst.  It stops at size rather than reading to EOF because
+// the read after a short one wouldn't be aligned.
+func CopyDirect(f *os.File, size int64, dst io.Writer) (int64, error) {
+	buf := alignedBuffer(directBufferSize)
+	var written int64
+	for written < size {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if int64(n) > size-written {
+				n = int(size - written)
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			if written < size {
+				return written, io.ErrUnexpectedEOF
+			}
+			break
+		} else if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
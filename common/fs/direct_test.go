@@ -0,0 +1,69 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignedBuffer(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		buf := alignedBuffer(8192)
+		require.Equal(t, 8192, len(buf))
+		require.Equal(t, uintptr(0), uintptr(unsafe.Pointer(&buf[0]))%DirectAlignment)
+	}
+}
+
+func TestCopyDirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	data := make([]byte, 3*directBufferSize+123)
+	rand.Read(data)
+	path := filepath.Join(dir, "f")
+	require.Nil(t, ioutil.WriteFile(path, data, 0600))
+
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer f.Close()
+	require.Nil(t, Fadvise(f, 0, 0, FADV_SEQUENTIAL))
+	require.Nil(t, Fadvise(f, 0, 4096, FADV_WILLNEED))
+	if err := SetDirect(f); err != nil {
+		// tmpfs and some others don't do O_DIRECT; CopyDirect still works
+		// on a regular file descriptor.
+		t.Logf("O_DIRECT unsupported: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	n, err := CopyDirect(f, int64(len(data)), buf)
+	require.Nil(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.True(t, bytes.Equal(data, buf.Bytes()))
+
+	f2, err := os.Open(path)
+	require.Nil(t, err)
+	defer f2.Close()
+	_, err = CopyDirect(f2, int64(len(data)+1), ioutil.Discard)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
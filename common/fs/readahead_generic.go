@@ -0,0 +1,39 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// +build !linux
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// Advice for Fadvise.
+const (
+	FADV_SEQUENTIAL = 2
+	FADV_WILLNEED   = 3
+)
+
+// Fadvise does nothing, since posix_fadvise isn't available everywhere.
+func Fadvise(f *os.File, offset, length int64, advice int) error {
+	return nil
+}
+
+// SetDirect always fails, since O_DIRECT is only supported on Linux.
+func SetDirect(f *os.File) error {
+	return errors.New("O_DIRECT is only supported on Linux")
+}
@@ -0,0 +1,52 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// +build linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Advice for Fadvise.
+const (
+	FADV_SEQUENTIAL = 2
+	FADV_WILLNEED   = 3
+)
+
+// Fadvise tells the kernel how a range of the file is about to be read, so it
+// can read ahead to suit.  A length of 0 means through the end of the file.
+func Fadvise(f *os.File, offset, length int64, advice int) error {
+	if _, _, err := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), uintptr(offset), uintptr(length), uintptr(advice), 0, 0); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// SetDirect turns on O_DIRECT for an open file, so its reads bypass the page
+// cache.  Reads then have to use aligned buffers, as CopyDirect does.  Not
+// every filesystem supports it.
+func SetDirect(f *os.File) error {
+	flags, _, err := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_GETFL, 0)
+	if err != 0 {
+		return err
+	}
+	if _, _, err := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_SETFL, flags|syscall.O_DIRECT); err != 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SyncPolicy is how durably an AtomicFileWriter's file, and the directory it's
+// saved into, are written before they're considered committed.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs both the file and its directory.
+	SyncAlways SyncPolicy = iota
+	// SyncData fdatasyncs the file, skipping metadata like its mtime, and
+	// fsyncs its directory.
+	SyncData
+	// SyncDirOnly only fsyncs the directory, so the file is sure to be
+	// there after a crash but its contents may not be.
+	SyncDirOnly
+	// SyncNone leaves it all to the kernel to write out when it likes.
+	SyncNone
+)
+
+var syncPolicyNames = map[SyncPolicy]string{
+	SyncAlways:  "always",
+	SyncData:    "fdatasync",
+	SyncDirOnly: "dir",
+	SyncNone:    "none",
+}
+
+func (p SyncPolicy) String() string {
+	if name, ok := syncPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(p))
+}
+
+// ParseSyncPolicy reads a SyncPolicy by name: always, fdatasync, dir or none.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for p, name := range syncPolicyNames {
+		if s == name {
+			return p, nil
+		}
+	}
+	return SyncAlways, fmt.Errorf("Unknown fsync policy %q, should be always, fdatasync, dir or none", s)
+}
+
+// SyncFile writes f's contents to disk as the policy calls for.
+func (p SyncPolicy) SyncFile(f *os.File) error {
+	switch p {
+	case SyncAlways:
+		return f.Sync()
+	case SyncData:
+		return fdatasync(f)
+	}
+	return nil
+}
+
+// SyncDir writes the directory's entries to disk as the policy calls for.
+func (p SyncPolicy) SyncDir(dir string) error {
+	if p == SyncNone {
+		return nil
+	}
+	d, err := os.OpenFile(dir, os.O_RDONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -110,3 +110,24 @@ func TestTempFileReplaceSyncFinalize(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, []byte("some crap"), data)
 }
+
+func TestTempFileSyncPolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"always", "fdatasync", "dir", "none"} {
+		policy, err := ParseSyncPolicy(name)
+		require.Nil(t, err)
+		require.Equal(t, name, policy.String())
+		f, err := NewAtomicFileWriterSync(dir, dir, policy)
+		require.Nil(t, err)
+		f.Write([]byte("some crap"))
+		require.Nil(t, f.Save(filepath.Join(dir, name)))
+		require.Nil(t, policy.SyncDir(dir))
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.Nil(t, err)
+		require.Equal(t, []byte("some crap"), data)
+	}
+	_, err = ParseSyncPolicy("sometimes")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,53 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// BackendPriorityHeader is set to LowPriority by the proxy on requests no
+// user is waiting on directly, like those spawned by bulk operations, and by
+// background daemons, so backend servers can keep them from crowding out
+// user requests on a busy device.
+const BackendPriorityHeader = "X-Backend-Priority"
+
+const LowPriority = "low"
+
+func IsLowPriority(request *http.Request) bool {
+	return request.Header.Get(BackendPriorityHeader) == LowPriority
+}
+
+// NewLowPriorityLimit returns a per device limit for low priority requests
+// of sharePercent of diskLimit, or nil if there's no share, in which case low
+// priority requests are only limited by diskLimit like any other.
+func NewLowPriorityLimit(sharePercent, diskLimit int64) (*KeyedLimit, error) {
+	if sharePercent < 0 || sharePercent > 100 {
+		return nil, fmt.Errorf("Invalid low_priority_share %d", sharePercent)
+	}
+	if sharePercent == 0 || sharePercent == 100 {
+		return nil, nil
+	}
+	if diskLimit <= 0 {
+		return nil, fmt.Errorf("low_priority_share needs a disk_limit to take a share of")
+	}
+	limit := diskLimit * sharePercent / 100
+	if limit < 1 {
+		limit = 1
+	}
+	return NewKeyedLimit(limit, 0), nil
+}
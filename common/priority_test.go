@@ -0,0 +1,56 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLowPriority(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	require.False(t, IsLowPriority(req))
+	req.Header.Set(BackendPriorityHeader, LowPriority)
+	require.True(t, IsLowPriority(req))
+}
+
+func TestNewLowPriorityLimit(t *testing.T) {
+	limit, err := NewLowPriorityLimit(0, 25)
+	require.Nil(t, err)
+	require.Nil(t, limit)
+	limit, err = NewLowPriorityLimit(100, 25)
+	require.Nil(t, err)
+	require.Nil(t, limit)
+	_, err = NewLowPriorityLimit(101, 25)
+	require.NotNil(t, err)
+	_, err = NewLowPriorityLimit(50, 0)
+	require.NotNil(t, err)
+
+	limit, err = NewLowPriorityLimit(20, 10)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), limit.Acquire("sda", false))
+	require.Equal(t, int64(0), limit.Acquire("sda", false))
+	require.NotEqual(t, int64(0), limit.Acquire("sda", false))
+	require.Equal(t, int64(0), limit.Acquire("sdb", false))
+
+	limit, err = NewLowPriorityLimit(1, 10)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), limit.Acquire("sda", false))
+	require.NotEqual(t, int64(0), limit.Acquire("sda", false))
+}
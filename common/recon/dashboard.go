@@ -0,0 +1,160 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package recon
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+)
+
+// dashboardSection is one of the recon reports shown on the dashboard.
+type dashboardSection struct {
+	Title  string
+	report func(client common.HTTPClient) Passable
+}
+
+var dashboardSections = []dashboardSection{
+	{"Rings", func(c common.HTTPClient) Passable { return GetRingMD5Report(c, nil, nil) }},
+	{"Configuration", func(c common.HTTPClient) Passable { return GetMainConfMD5Report(c, nil) }},
+	{"Binaries", func(c common.HTTPClient) Passable { return GetHummingbirdMD5Report(c, nil) }},
+	{"Clocks", func(c common.HTTPClient) Passable { return GetTimeReport(c, nil) }},
+	{"Replication duration", func(c common.HTTPClient) Passable { return GetReplicationDurationReport(c, nil) }},
+	{"Replication rate", func(c common.HTTPClient) Passable { return GetReplicationPartsSecReport(c, nil) }},
+	{"Replication cancellations", func(c common.HTTPClient) Passable { return GetReplicationCanceledReport(c, nil) }},
+	{"Async pendings", func(c common.HTTPClient) Passable { return GetAsyncReport(c) }},
+	{"Quarantines", func(c common.HTTPClient) Passable { return GetQuarantineReport(c, nil) }},
+}
+
+// dashboardResult is a section's report as last built.
+type dashboardResult struct {
+	Title  string
+	Passed bool
+	Text   string
+	Report Passable
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.RefreshSeconds}}">
+<title>Hummingbird cluster status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+h2 { margin-bottom: 0.2em; }
+.pass { color: #2a7d2a; }
+.fail { color: #b22222; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>Hummingbird cluster status</h1>
+<p>Gathered {{.Built.Format "2006-01-02 15:04:05 MST"}}.
+<a href="?format=json">JSON</a></p>
+{{range .Results}}
+<h2 class="{{if .Passed}}pass{{else}}fail{{end}}">{{.Title}}: {{if .Passed}}OK{{else}}PROBLEMS{{end}}</h2>
+<pre>{{.Text}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+// Dashboard is a status page for the cluster, built from the same recon
+// reports the recon command prints.  Reports query every server, so they're
+// built at most once per refresh interval however often the page is loaded.
+type Dashboard struct {
+	client   common.HTTPClient
+	refresh  time.Duration
+	lock     sync.Mutex
+	results  []dashboardResult
+	built    time.Time
+	sections []dashboardSection
+}
+
+// NewDashboard returns a Dashboard that queries servers with a client using
+// the certFile and keyFile, if given, and rebuilds its reports at most every
+// refresh.
+func NewDashboard(certFile, keyFile string, refresh time.Duration) (*Dashboard, error) {
+	client, err := HTTPClient(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Dashboard{client: client, refresh: refresh, sections: dashboardSections}, nil
+}
+
+// build runs every section's report at once.
+func (d *Dashboard) build() []dashboardResult {
+	results := make([]dashboardResult, len(d.sections))
+	var wg sync.WaitGroup
+	for i, section := range d.sections {
+		wg.Add(1)
+		go func(i int, section dashboardSection) {
+			defer wg.Done()
+			report := section.report(d.client)
+			results[i] = dashboardResult{Title: section.Title, Passed: report.Passed(), Report: report}
+			if s, ok := report.(fmt.Stringer); ok {
+				results[i].Text = s.String()
+			}
+		}(i, section)
+	}
+	wg.Wait()
+	return results
+}
+
+// Results returns the reports, rebuilding them if they're older than the
+// refresh interval.  There's no way to force a rebuild sooner, since any
+// client could then have every server queried as often as it liked.
+func (d *Dashboard) Results() ([]dashboardResult, time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.results == nil || time.Since(d.built) > d.refresh {
+		d.results = d.build()
+		d.built = time.Now()
+	}
+	return d.results, d.built
+}
+
+func (d *Dashboard) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	results, built := d.Results()
+	if request.FormValue("format") == "json" {
+		reports := map[string]Passable{}
+		for _, r := range results {
+			reports[r.Title] = r.Report
+		}
+		body, err := json.MarshalIndent(reports, "", "    ")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(body)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(writer, map[string]interface{}{
+		"Results":        results,
+		"Built":          built,
+		"RefreshSeconds": int(d.refresh / time.Second),
+	}); err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
+}
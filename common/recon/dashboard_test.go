@@ -0,0 +1,53 @@
+package recon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+)
+
+func TestDashboard(t *testing.T) {
+	builds := 0
+	d := &Dashboard{
+		refresh: time.Minute,
+		sections: []dashboardSection{
+			{"Good", func(c common.HTTPClient) Passable {
+				builds++
+				return &TimeReport{Name: "Time Report", Pass: true}
+			}},
+			{"Bad", func(c common.HTTPClient) Passable {
+				return &AsyncReport{Name: "Async Pending Report", Errors: []string{"<server> is down"}}
+			}},
+		},
+	}
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	require.True(t, strings.Contains(body, "Good: OK"))
+	require.True(t, strings.Contains(body, "Bad: PROBLEMS"))
+	require.True(t, strings.Contains(body, "!! &lt;server&gt; is down"))
+	require.Equal(t, 1, builds)
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard?format=json", nil))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var reports map[string]map[string]interface{}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &reports))
+	require.Equal(t, true, reports["Good"]["Pass"])
+	require.Equal(t, false, reports["Bad"]["Pass"])
+	require.Equal(t, 1, builds)
+
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/dashboard?refresh=true", nil))
+	require.Equal(t, 1, builds)
+
+	d.built = d.built.Add(-2 * time.Minute)
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/dashboard", nil))
+	require.Equal(t, 2, builds)
+}
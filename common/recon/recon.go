@@ -0,0 +1,1073 @@
+//  Copyright (c) 2017 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package recon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
+	"golang.org/x/net/http2"
+)
+
+// Server is a storage server the reports query.
+type Server struct {
+	IP, Scheme      string
+	Port            int
+	ReplicationPort int
+}
+
+func (v *Server) String() string {
+	return fmt.Sprintf("%s://%s:%d|%d", v.Scheme, v.IP, v.Port, v.ReplicationPort)
+}
+
+// ServerID identifies a server by its ip and port.
+func ServerID(ip string, port int) string {
+	return fmt.Sprintf("%s:%d", ip, port)
+}
+
+func deviceId(ip string, port int, device string) string {
+	return fmt.Sprintf("%s:%d/%s", ip, port, device)
+}
+
+// DistinctIPServers returns a server for each ip in the rings, adding any
+// problems reading them to errors.
+func DistinctIPServers(errors []string) ([]*Server, []string) {
+	serversMap := map[string]*Server{}
+	prefix, suffix, err := conf.GetHashPrefixAndSuffix()
+	if err != nil {
+		return nil, append(errors, fmt.Sprintf("Unable to get hash prefix and suffix: %s", err))
+	}
+	fn := func(r ring.Ring) {
+		for _, dev := range r.AllDevices() {
+			if dev == nil || dev.Weight < 0 {
+				continue
+			}
+			serversMap[dev.Ip] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+		}
+	}
+	if r, err := ring.GetRing("account", prefix, suffix, 0); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		fn(r)
+	}
+	if r, err := ring.GetRing("container", prefix, suffix, 0); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		fn(r)
+	}
+	if policies, err := conf.GetPolicies(); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		for _, policy := range policies {
+			if r, err := ring.GetRing("object", prefix, suffix, policy.Index); err != nil {
+				errors = append(errors, err.Error())
+			} else {
+				fn(r)
+			}
+		}
+	}
+	var servers []*Server
+	for _, server := range serversMap {
+		servers = append(servers, server)
+	}
+	return servers, errors
+}
+
+func distinctObjectReplicationServers(errors []string) ([]*Server, []string) {
+	serversMap := map[string]*Server{}
+	prefix, suffix, err := conf.GetHashPrefixAndSuffix()
+	if err != nil {
+		return nil, append(errors, fmt.Sprintf("Unable to get hash prefix and suffix: %s", err))
+	}
+	fn := func(r ring.Ring) {
+		for _, dev := range r.AllDevices() {
+			if dev == nil || dev.Weight < 0 {
+				continue
+			}
+			serversMap[ServerID(dev.Ip, dev.ReplicationPort)] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+		}
+	}
+	if policies, err := conf.GetPolicies(); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		for _, policy := range policies {
+			if r, err := ring.GetRing("object", prefix, suffix, policy.Index); err != nil {
+				errors = append(errors, err.Error())
+			} else {
+				fn(r)
+			}
+		}
+	}
+	var servers []*Server
+	for _, server := range serversMap {
+		servers = append(servers, server)
+	}
+	return servers, errors
+}
+
+// QueryHostRecon returns the body of the server's recon endpoint.
+func QueryHostRecon(client common.HTTPClient, s *Server, endpoint string) ([]byte, error) {
+	serverUrl := fmt.Sprintf("%s://%s:%d/recon/%s", s.Scheme, s.IP, s.Port, endpoint)
+	req, err := http.NewRequest("GET", serverUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// replicationStats is what the reports use of the object replicator's progress
+// for a device.
+type replicationStats struct {
+	PassStarted        time.Time
+	LastPassFinishDate time.Time
+	LastPassDuration   time.Duration
+	CancelCount        int64
+	PartitionsDone     int64
+	PartitionsTotal    int64
+}
+
+func queryHostReplication(client common.HTTPClient, s *Server) (map[string]replicationStats, error) {
+	serverUrl := fmt.Sprintf("http://%s:%d/progress/object-replicator", s.IP, s.ReplicationPort)
+	req, err := http.NewRequest("GET", serverUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var stats map[string]replicationStats
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Passable is a report that can say whether everything it checked was fine.
+type Passable interface {
+	Passed() bool
+}
+
+type RingMD5Report struct {
+	Name    string
+	Time    time.Time
+	Pass    bool
+	Servers int
+	Checks  int
+	Errors  []string
+}
+
+func (r *RingMD5Report) Passed() bool {
+	return r.Pass
+}
+
+func (r *RingMD5Report) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += fmt.Sprintf("%d ring checks done across %d servers\n", r.Checks, r.Servers)
+	return s
+}
+
+func GetRingMD5Report(client common.HTTPClient, ringMap map[string]string, typeToServers map[string]map[string]*Server) *RingMD5Report {
+	// ringMap and typeToServers parameters are for overriding for tests, leave nil normally
+	report := &RingMD5Report{
+		Name: "Ring MD5 Report",
+		Time: time.Now().UTC(),
+		Pass: true,
+	}
+	var err error
+	if ringMap == nil {
+		ringMap, err = common.GetAllRingFileMd5s()
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		report.Pass = false
+		return report
+	}
+	if typeToServers == nil {
+		typeToServers = map[string]map[string]*Server{}
+		prefix, suffix, err := conf.GetHashPrefixAndSuffix()
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Unable to get hash prefix and suffix: %s", err))
+			report.Pass = false
+			return report
+		}
+		if r, err := ring.GetRing("account", prefix, suffix, 0); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			for _, dev := range r.AllDevices() {
+				if dev != nil && dev.Weight >= 0 {
+					m, ok := typeToServers[ServerID(dev.Ip, dev.Port)]
+					if !ok {
+						m = map[string]*Server{}
+						typeToServers[ServerID(dev.Ip, dev.Port)] = m
+					}
+					m["account.ring.gz"] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+				}
+			}
+		}
+		if r, err := ring.GetRing("container", prefix, suffix, 0); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			for _, dev := range r.AllDevices() {
+				if dev != nil && dev.Weight >= 0 {
+					m, ok := typeToServers[ServerID(dev.Ip, dev.Port)]
+					if !ok {
+						m = map[string]*Server{}
+						typeToServers[ServerID(dev.Ip, dev.Port)] = m
+					}
+					m["container.ring.gz"] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+				}
+			}
+		}
+		if policies, err := conf.GetPolicies(); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			for _, policy := range policies {
+				if r, err := ring.GetRing("object", prefix, suffix, policy.Index); err != nil {
+					report.Errors = append(report.Errors, err.Error())
+				} else {
+					for _, dev := range r.AllDevices() {
+						if dev != nil && dev.Weight >= 0 {
+							m, ok := typeToServers[ServerID(dev.Ip, dev.Port)]
+							if !ok {
+								m = map[string]*Server{}
+								typeToServers[ServerID(dev.Ip, dev.Port)] = m
+							}
+							if policy.Index == 0 {
+								m["object.ring.gz"] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+							} else {
+								m[fmt.Sprintf("object-%d.ring.gz", policy.Index)] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, serverMap := range typeToServers {
+		var server *Server
+		for _, server = range serverMap {
+			break
+		}
+		if server == nil {
+			continue
+		}
+		report.Servers++
+		rBytes, err := QueryHostRecon(client, server, "ringmd5")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		var rData map[string]string
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			continue
+		}
+		for fname := range serverMap {
+			a := ""
+			for k, v := range rData {
+				if filepath.Base(k) == fname {
+					a = v
+					break
+				}
+			}
+			b := ""
+			for k, v := range ringMap {
+				if filepath.Base(k) == fname {
+					b = v
+					break
+				}
+			}
+			if a != "" || b != "" {
+				report.Checks++
+			}
+			if a != b {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s://%s:%d/recon/ringmd5 (%s => %s) doesn't match on disk md5sum %s", server.Scheme, server.IP, server.Port, fname, a, b))
+			}
+		}
+	}
+	report.Pass = len(report.Errors) == 0
+	return report
+}
+
+type MainConfMD5Report struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+}
+
+func (r *MainConfMD5Report) Passed() bool {
+	return r.Pass
+}
+
+func (r *MainConfMD5Report) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += fmt.Sprintf(
+		"%d/%d hosts matched, %d error[s] while checking hosts.\n",
+		r.Successes, r.Servers, len(r.Errors),
+	)
+	return s
+}
+
+func GetMainConfMD5Report(client common.HTTPClient, servers []*Server) *MainConfMD5Report {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &MainConfMD5Report{
+		Name:    "hummingbird.conf MD5 Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Pass:    true,
+	}
+	if servers == nil {
+		servers, report.Errors = DistinctIPServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	md5Map, err := common.FileMD5("/etc/hummingbird/hummingbird.conf")
+	if err != nil {
+		md5Map, err = common.FileMD5("/etc/swift/swift.conf")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Unrecoverable error on confmd5 report: %v", err))
+			report.Pass = false
+			return report
+		}
+	}
+	for _, server := range servers {
+		rBytes, err := QueryHostRecon(client, server, "hummingbirdconfmd5")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			report.Pass = false
+			continue
+		}
+		var rData map[string]string
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			report.Pass = false
+			continue
+		}
+		allMatch := true
+		for fName, md5sum := range md5Map {
+			if rData[fName] != md5sum {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s://%s:%d/recon/hummingbirdconfmd5 (%s => %s) doesn't match on disk md5sum %s", server.Scheme, server.IP, server.Port, filepath.Base(fName), rData[fName], md5sum))
+				report.Pass = false
+				allMatch = false
+			}
+		}
+		if allMatch {
+			report.Successes++
+		}
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type HummingbirdMD5Report struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+}
+
+func (r *HummingbirdMD5Report) Passed() bool {
+	return r.Pass
+}
+
+func (r *HummingbirdMD5Report) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += fmt.Sprintf(
+		"%d/%d hosts matched, %d error[s] while checking hosts.\n",
+		r.Successes, r.Servers, len(r.Errors),
+	)
+	return s
+}
+
+func GetHummingbirdMD5Report(client common.HTTPClient, servers []*Server) *HummingbirdMD5Report {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &HummingbirdMD5Report{
+		Name:    "hummingbird MD5 Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Pass:    true,
+	}
+	if servers == nil {
+		servers, report.Errors = DistinctIPServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	var md5Map map[string]string
+	if exePath, err := os.Executable(); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		report.Pass = false
+		return report
+	} else if md5Map, err = common.FileMD5(exePath); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		report.Pass = false
+		return report
+	}
+	for _, server := range servers {
+		rBytes, err := QueryHostRecon(client, server, "hummingbirdmd5")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			report.Pass = false
+			continue
+		}
+		var rData map[string]string
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			report.Pass = false
+			continue
+		}
+		allMatch := true
+		for fName, md5sum := range md5Map {
+			bName := filepath.Base(fName)
+			found := false
+			for rName, rmd5sum := range rData {
+				if filepath.Base(rName) == bName {
+					found = true
+					if rmd5sum != md5sum {
+						report.Errors = append(report.Errors, fmt.Sprintf("%s://%s:%d/recon/hummingbirdmd5 (%s => %s) doesn't match on disk (%s => %s)", server.Scheme, server.IP, server.Port, rName, rmd5sum, fName, md5sum))
+						report.Pass = false
+						allMatch = false
+					}
+				}
+			}
+			if !found {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s://%s:%d/recon/hummingbirdmd5 could not find %s md5 value", server.Scheme, server.IP, server.Port, bName))
+				report.Pass = false
+				allMatch = false
+			}
+		}
+		if allMatch {
+			report.Successes++
+		}
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type TimeReport struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+}
+
+func (r *TimeReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *TimeReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += fmt.Sprintf(
+		"%d/%d hosts matched, %d error[s] while checking hosts.\n",
+		r.Successes, r.Servers, len(r.Errors),
+	)
+	return s
+}
+
+func GetTimeReport(client common.HTTPClient, servers []*Server) *TimeReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &TimeReport{
+		Name:    "Time Sync Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+	}
+	if servers == nil {
+		servers, report.Errors = DistinctIPServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	for _, server := range servers {
+		preCall := time.Now().Round(time.Microsecond)
+		rBytes, err := QueryHostRecon(client, server, "hummingbirdtime")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		postCall := time.Now().Round(time.Microsecond)
+		var rData map[string]time.Time
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			continue
+		}
+		if rData["time"].IsZero() {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: time was zeroed", server))
+			continue
+		}
+		remoteTime := rData["time"].Round(time.Microsecond)
+		if remoteTime.Before(preCall) || remoteTime.After(postCall) {
+			report.Errors = append(report.Errors, fmt.Sprintf(
+				"%s://%s:%d/recon/hummingbirdtime current time is %s but remote time is %s, differs by %.2f nsecs",
+				server.Scheme,
+				server.IP,
+				server.Port,
+				postCall.Format(time.StampMicro),
+				remoteTime.Format(time.StampMicro),
+				float64(postCall.Sub(remoteTime)),
+			))
+		} else {
+			report.Successes++
+		}
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type quarData struct {
+	Accounts   int                       `json:"accounts"`
+	Containers int                       `json:"containers"`
+	Objects    int                       `json:"objects"`
+	Policies   map[string]map[string]int `json:"policies"`
+}
+
+type quarReconStats struct {
+	Accounts   map[string]int
+	Containers map[string]int
+	Objects    map[string]int
+	Policies   map[string]map[string]int
+}
+
+func statsLine(tag string, stats map[string]int) string {
+	low, high, total, reported, num_none := 0, 0, 0, 0, 0
+	init := true
+	for _, v := range stats {
+		if init {
+			low, high = v, v
+			init = false
+		}
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+		reported++
+		if v == -1 {
+			num_none++ // these might not be none- just zero. also, i dont think i care
+		} else {
+			total += v
+		}
+	}
+	ave, pFail := float64(0), float64(0)
+	if reported > 0 {
+		ave = float64(total) / float64(reported)
+		pFail = float64(num_none) / float64(reported) * 100
+	}
+	return fmt.Sprintf("[%s] low: %d, high: %d, avg: %.1f, total: %d, Failed: %.1f%%, no_result: %d, reported: %d",
+		tag, low, high, ave, total, pFail, num_none, reported)
+}
+
+func statsLineF(tag string, stats map[string]float64) string {
+	low, high, total, reported, num_none := float64(0), float64(0), float64(0), int(0), int(0)
+	init := true
+	for _, v := range stats {
+		if init {
+			low, high = v, v
+			init = false
+		}
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+		reported++
+		if v == -1 {
+			num_none++ // these might not be none- just zero. also, i dont think i care
+		} else {
+			total += v
+		}
+	}
+	ave, pFail := float64(0), float64(0)
+	if reported > 0 {
+		ave = float64(total) / float64(reported)
+		pFail = float64(num_none) / float64(reported) * 100
+	}
+	return fmt.Sprintf("[%s] low: %.3f, high: %.3f, avg: %.3f, Failed: %.1f%%, no_result: %d, reported: %d",
+		tag, low, high, ave, pFail, num_none, reported)
+}
+
+type QuarantineReport struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+	Stats     *quarReconStats
+}
+
+func (r *QuarantineReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *QuarantineReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += statsLine("quarantined_account", r.Stats.Accounts) + "\n"
+	s += statsLine("quarantined_container", r.Stats.Containers) + "\n"
+	s += statsLine("quarantined_objects", r.Stats.Objects) + "\n"
+	for pid, pmap := range r.Stats.Policies {
+		s += statsLine(fmt.Sprintf("quarantined_objects_%s", pid), pmap) + "\n"
+	}
+	return s
+}
+
+func GetQuarantineReport(client common.HTTPClient, servers []*Server) *QuarantineReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &QuarantineReport{
+		Name:    "Quarantine Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Stats: &quarReconStats{
+			Accounts:   map[string]int{},
+			Containers: map[string]int{},
+			Objects:    map[string]int{},
+			Policies:   map[string]map[string]int{},
+		},
+	}
+	if servers == nil {
+		servers, report.Errors = DistinctIPServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	for _, server := range servers {
+		rBytes, err := QueryHostRecon(client, server, "quarantined")
+		report.Stats.Accounts[server.IP] = -1
+		report.Stats.Containers[server.IP] = -1
+		report.Stats.Objects[server.IP] = -1
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		var rData quarData
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			continue
+		}
+		report.Stats.Accounts[server.IP] = rData.Accounts
+		report.Stats.Containers[server.IP] = rData.Containers
+		report.Stats.Objects[server.IP] = rData.Objects
+		for pIndex, v := range rData.Policies {
+			if _, ok := report.Stats.Policies[pIndex]; !ok {
+				report.Stats.Policies[pIndex] = map[string]int{}
+			}
+			report.Stats.Policies[pIndex][server.IP] = v["objects"]
+		}
+		report.Successes++
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type AsyncReport struct {
+	Name   string
+	Time   time.Time
+	Pass   bool
+	Errors []string
+	Stats  map[int]map[string]int
+}
+
+func (r *AsyncReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *AsyncReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	var ii []int
+	for i := range r.Stats {
+		ii = append(ii, i)
+	}
+	sort.Ints(ii)
+	for i := range ii {
+		if i == 0 {
+			s += statsLine("async_pending", r.Stats[i]) + "\n"
+		} else {
+			s += statsLine(fmt.Sprintf("async_pending-%d", i), r.Stats[i]) + "\n"
+		}
+	}
+	return s
+}
+
+func GetAsyncReport(client common.HTTPClient) *AsyncReport {
+	report := &AsyncReport{
+		Name:  "Async Pending Report",
+		Time:  time.Now().UTC(),
+		Stats: map[int]map[string]int{},
+	}
+	policies, err := conf.GetPolicies()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("could not get policy configurations: %s", err))
+		return report
+	}
+	prefix, suffix, err := conf.GetHashPrefixAndSuffix()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Unable to get hash prefix and suffix: %s", err))
+		return report
+	}
+	for _, policy := range policies {
+		oring, err := ring.GetRing("object", prefix, suffix, policy.Index)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not ring for policy %d: %s", policy.Index, err))
+			continue
+		}
+		servers := map[string]*Server{}
+		for _, dev := range oring.AllDevices() {
+			if dev == nil || dev.Weight < 0 {
+				continue
+			}
+			sId := ServerID(dev.Ip, dev.Port)
+			if _, ok := servers[sId]; !ok {
+				servers[sId] = &Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+			}
+		}
+		getAsyncReportHelper(client, report, servers, policy.Index)
+	}
+	report.Pass = len(report.Errors) == 0
+	return report
+}
+
+func getAsyncReportHelper(client common.HTTPClient, report *AsyncReport, servers map[string]*Server, policy int) {
+	report.Stats[policy] = map[string]int{}
+	for _, server := range servers {
+		rBytes, err := QueryHostRecon(client, server, "async")
+		report.Stats[policy][ServerID(server.IP, server.Port)] = -1
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		var rData map[string]int
+		if err := json.Unmarshal(rBytes, &rData); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			continue
+		}
+		report.Stats[policy][ServerID(server.IP, server.Port)] = rData["async_pending"]
+	}
+}
+
+type ReplicationDurationReport struct {
+	Name           string
+	Time           time.Time
+	Pass           bool
+	Servers        int
+	Successes      int
+	Errors         []string
+	Stats          map[string]float64
+	TotalDriveZero int
+}
+
+func (r *ReplicationDurationReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *ReplicationDurationReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	s += statsLineF("replication_duration_secs", r.Stats) + "\n"
+	s += fmt.Sprintf("Number of drives not completed a pass: %d\n", r.TotalDriveZero)
+	return s
+}
+
+func GetReplicationDurationReport(client common.HTTPClient, servers []*Server) *ReplicationDurationReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &ReplicationDurationReport{
+		Name:    "Replication Duration Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Stats:   map[string]float64{},
+	}
+	if servers == nil {
+		servers, report.Errors = distinctObjectReplicationServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	for _, server := range servers {
+		data, err := queryHostReplication(client, server)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		totalDuration := time.Duration(0)
+		totalSet := float64(0)
+		for _, dStats := range data {
+			if dStats.LastPassDuration > 0 {
+				totalDuration += dStats.LastPassDuration
+				totalSet++
+			} else {
+				report.TotalDriveZero++
+			}
+		}
+		if totalSet > 0 {
+			report.Stats[ServerID(server.IP, server.Port)] = totalDuration.Seconds() / totalSet
+		} else {
+			report.Stats[ServerID(server.IP, server.Port)] = 0
+		}
+		report.Successes++
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type ReplicationPartsSecReport struct {
+	Name           string
+	Time           time.Time
+	Pass           bool
+	Servers        int
+	Successes      int
+	Errors         []string
+	Warnings       []string
+	Stats          map[string]float64
+	DriveSpeeds    map[string]float64
+	OverallAverage float64
+	TotalDriveZero int
+}
+
+func (r *ReplicationPartsSecReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *ReplicationPartsSecReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	for _, w := range r.Warnings {
+		s += fmt.Sprintf("! %s\n", w)
+	}
+	s += statsLineF("replication_srv_parts_per_sec", r.Stats) + "\n"
+	s += fmt.Sprintf("Number drives with no partitions completed: %d\n", r.TotalDriveZero)
+	s += fmt.Sprintf("Cluster wide parts/sec: %.3f\n", r.OverallAverage)
+	return s
+}
+
+func GetReplicationPartsSecReport(client common.HTTPClient, servers []*Server) *ReplicationPartsSecReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &ReplicationPartsSecReport{
+		Name:        "Replication Partitions Per Second Report",
+		Time:        time.Now().UTC(),
+		Servers:     len(servers),
+		Stats:       map[string]float64{},
+		DriveSpeeds: map[string]float64{},
+	}
+	if servers == nil {
+		servers, report.Errors = distinctObjectReplicationServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	allDur := time.Duration(0)
+	allPartsDone := int64(0)
+	for _, server := range servers {
+		report.Stats[ServerID(server.IP, server.Port)] = -1
+		data, err := queryHostReplication(client, server)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		serverDuration := time.Duration(0)
+		serverPartsDone := int64(0)
+		for d, dStats := range data {
+			driveDur := dStats.LastPassFinishDate.Sub(dStats.PassStarted)
+			if dStats.LastPassFinishDate.IsZero() {
+				// is in middle of run
+				driveDur = time.Since(dStats.PassStarted)
+			}
+			serverDuration += driveDur
+			serverPartsDone += dStats.PartitionsDone
+			allDur += driveDur
+			allPartsDone += dStats.PartitionsDone
+			if dStats.PartitionsTotal == 0 {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s has no partitions\n", deviceId(server.IP, server.Port, d)))
+			} else {
+				if dStats.PartitionsDone == 0 && driveDur > time.Hour {
+					report.Warnings = append(report.Warnings, fmt.Sprintf("%s has no partitions processed\n", deviceId(server.IP, server.Port, d)))
+				}
+			}
+			report.DriveSpeeds[deviceId(server.IP, server.Port, d)] = float64(dStats.PartitionsDone) / driveDur.Seconds()
+		}
+		if serverPartsDone > 0 {
+			report.Stats[ServerID(server.IP, server.Port)] = float64(serverPartsDone) / serverDuration.Seconds()
+		} else {
+			report.Stats[ServerID(server.IP, server.Port)] = 0
+			report.TotalDriveZero++
+		}
+		report.Successes++
+	}
+	report.OverallAverage = float64(allPartsDone) / allDur.Seconds()
+	if math.IsNaN(report.OverallAverage) {
+		report.OverallAverage = 0
+	}
+	for dId, speed := range report.DriveSpeeds {
+		if speed > 0 && speed*2 < report.OverallAverage {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s @ %.3f parts/sec is %.2fx slower than cluster parts/sec: %.3f\n", dId, speed, report.OverallAverage/speed, report.OverallAverage))
+		}
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+type ReplicationCanceledReport struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+	Warnings  []string
+	Stats     map[string]int
+}
+
+func (r *ReplicationCanceledReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *ReplicationCanceledReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	for _, w := range r.Warnings {
+		s += fmt.Sprintf("! %s\n", w)
+	}
+	s += statsLine("replication_device_cancelations", r.Stats) + "\n"
+	return s
+}
+
+func GetReplicationCanceledReport(client common.HTTPClient, servers []*Server) *ReplicationCanceledReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &ReplicationCanceledReport{
+		Name:    "Stalled Replicators Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Stats:   map[string]int{},
+	}
+	if servers == nil {
+		servers, report.Errors = distinctObjectReplicationServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	for _, server := range servers {
+		data, err := queryHostReplication(client, server)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		for d, dStats := range data {
+			report.Stats[deviceId(server.IP, server.Port, d)] = int(dStats.CancelCount)
+			if dStats.CancelCount > 0 {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s has had to restart its replicator %d times.\n", deviceId(server.IP, server.Port, d), dStats.CancelCount))
+			}
+		}
+		report.Successes++
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
+
+// HTTPClient returns the client the reports query servers with.
+func HTTPClient(certFile, keyFile string) (*http.Client, error) {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 100,
+		MaxIdleConns:        0,
+	}
+	if certFile != "" && keyFile != "" {
+		tlsConf, err := common.NewClientTLSConfig(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting TLS config: %v", err)
+		}
+		transport.TLSClientConfig = tlsConf
+		if err = http2.ConfigureTransport(transport); err != nil {
+			return nil, fmt.Errorf("Error setting up http2: %v", err)
+		}
+	}
+	// TODO: Do we want to trace requests from this client?
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}, nil
+}
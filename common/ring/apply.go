@@ -0,0 +1,180 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DeclaredDevice is a device as listed in a ring declaration file.
+type DeclaredDevice struct {
+	Region          int64    `yaml:"region"`
+	Zone            int64    `yaml:"zone"`
+	Scheme          string   `yaml:"scheme"`
+	Ip              string   `yaml:"ip"`
+	Port            int64    `yaml:"port"`
+	ReplicationIp   string   `yaml:"replication_ip"`
+	ReplicationPort int64    `yaml:"replication_port"`
+	Device          string   `yaml:"device"`
+	Weight          *float64 `yaml:"weight"`
+	Meta            string   `yaml:"meta"`
+	// Attributes replace the device's attributes; see Device.
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// RingDeclaration is the desired device inventory of a ring, for example:
+//
+//	devices:
+//	  - {region: 1, zone: 1, ip: 10.0.0.1, port: 6000, device: sda, weight: 100}
+//	  - {region: 1, zone: 2, ip: 10.0.0.2, port: 6000, device: sda, weight: 100, meta: ssd}
+//	  - {region: 1, zone: 3, ip: 10.0.0.3, port: 6000, device: sda, weight: 100, attributes: {media: nvme, chassis: "7"}}
+type RingDeclaration struct {
+	Devices []DeclaredDevice `yaml:"devices"`
+}
+
+// LoadRingDeclaration reads a ring declaration from a YAML (or JSON) file.
+func LoadRingDeclaration(declarationPath string) (*RingDeclaration, error) {
+	data, err := ioutil.ReadFile(declarationPath)
+	if err != nil {
+		return nil, err
+	}
+	decl := &RingDeclaration{}
+	if err := yaml.UnmarshalStrict(data, decl); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", declarationPath, err)
+	}
+	return decl, nil
+}
+
+// ApplyDeclaration changes the builder's devices to match decl: devices not
+// in the builder are added, devices not in decl are removed, and weights,
+// meta, attributes, schemes and replication addresses are updated.  Devices are matched
+// by ip, port and device name; moving a device to another region or zone
+// isn't done implicitly since it moves all of its partitions, so it must be
+// removed from the declaration and added back under a new name or address.
+// It returns a description of each change made.
+func (b *RingBuilder) ApplyDeclaration(decl *RingDeclaration) ([]string, error) {
+	declared := map[string]*DeclaredDevice{}
+	for i := range decl.Devices {
+		d := &decl.Devices[i]
+		if d.Ip == "" || d.Port <= 0 || d.Device == "" {
+			return nil, fmt.Errorf("Declared device %d must have an ip, port and device.", i)
+		}
+		if d.Weight == nil || *d.Weight < 0 {
+			return nil, fmt.Errorf("Declared device %s:%d/%s must have a weight of at least 0.", d.Ip, d.Port, d.Device)
+		}
+		if d.Scheme == "" {
+			d.Scheme = "http"
+		} else if d.Scheme != "http" && d.Scheme != "https" {
+			return nil, errors.New("scheme can only http or https")
+		}
+		key := fmt.Sprintf("%s:%d/%s", d.Ip, d.Port, d.Device)
+		if declared[key] != nil {
+			return nil, fmt.Errorf("Device %s is declared more than once.", key)
+		}
+		declared[key] = d
+	}
+	var changes []string
+	seen := map[string]bool{}
+	for next, dev := devIterator(b.Devs); dev != nil; dev = next() {
+		if dev.Weight < 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d/%s", dev.Ip, dev.Port, dev.Device)
+		d := declared[key]
+		if d == nil {
+			b.RemoveDev(dev.Id, false)
+			changes = append(changes, fmt.Sprintf("Removed device %d %s", dev.Id, key))
+			continue
+		}
+		seen[key] = true
+		if d.Region != dev.Region || d.Zone != dev.Zone {
+			return nil, fmt.Errorf("Device %d %s is in r%dz%d but declared in r%dz%d.", dev.Id, key, dev.Region, dev.Zone, d.Region, d.Zone)
+		}
+		if *d.Weight != dev.Weight {
+			changes = append(changes, fmt.Sprintf("Changed weight of device %d %s from %v to %v", dev.Id, key, dev.Weight, *d.Weight))
+			if err := b.SetDevWeight(dev.Id, *d.Weight); err != nil {
+				return nil, err
+			}
+		}
+		if d.Meta != dev.Meta || d.Scheme != dev.Scheme || d.ReplicationIp != dev.ReplicationIp || d.ReplicationPort != dev.ReplicationPort ||
+			FormatAttributes(d.Attributes) != FormatAttributes(dev.Attributes) {
+			changes = append(changes, fmt.Sprintf("Changed info of device %d %s", dev.Id, key))
+			dev.Meta = d.Meta
+			dev.Attributes = nil
+			if len(d.Attributes) > 0 {
+				dev.Attributes = d.Attributes
+			}
+			dev.Scheme = d.Scheme
+			dev.ReplicationIp = d.ReplicationIp
+			dev.ReplicationPort = d.ReplicationPort
+		}
+	}
+	for i := range decl.Devices {
+		d := &decl.Devices[i]
+		key := fmt.Sprintf("%s:%d/%s", d.Ip, d.Port, d.Device)
+		if seen[key] {
+			continue
+		}
+		id, err := b.AddDev(&RingBuilderDevice{
+			Id:              -1,
+			Region:          d.Region,
+			Zone:            d.Zone,
+			Scheme:          d.Scheme,
+			Ip:              d.Ip,
+			Port:            d.Port,
+			ReplicationIp:   d.ReplicationIp,
+			ReplicationPort: d.ReplicationPort,
+			Device:          d.Device,
+			Weight:          *d.Weight,
+			Meta:            d.Meta,
+			Attributes:      d.Attributes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("Added device %d %s with weight %v", id, key, *d.Weight))
+	}
+	return changes, nil
+}
+
+// Apply converges the builder at builderPath to the declaration at
+// declarationPath and, if anything changed, rebalances it and writes the
+// ring; see RingBuilder.ApplyDeclaration.  With dryrun, the changes are only
+// reported.
+// Note that no locking is done here, you should call LockBuilderPath first.
+func Apply(builderPath, declarationPath string, debug, dryrun bool) ([]string, error) {
+	decl, err := LoadRingDeclaration(declarationPath)
+	if err != nil {
+		return nil, err
+	}
+	builder, err := NewRingBuilderFromFile(builderPath, debug)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := builder.ApplyDeclaration(decl)
+	if err != nil || len(changes) == 0 || dryrun {
+		return changes, err
+	}
+	if err = builder.Save(builderPath); err != nil {
+		return changes, err
+	}
+	_, _, _, err = Rebalance(builderPath, debug, false, false)
+	return changes, err
+}
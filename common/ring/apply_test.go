@@ -0,0 +1,117 @@
+package ring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDeclaration(t *testing.T) {
+	b, err := NewRingBuilder(4, 2, 1, false)
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 1, Scheme: "http", Ip: "10.0.0.1", Port: 6000, Device: "sda", Weight: 100})
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 2, Scheme: "http", Ip: "10.0.0.2", Port: 6000, Device: "sda", Weight: 100})
+	require.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	declPath := filepath.Join(dir, "cluster.yaml")
+	require.Nil(t, ioutil.WriteFile(declPath, []byte(`devices:
+  - {zone: 1, ip: 10.0.0.1, port: 6000, device: sda, weight: 50, meta: ssd}
+  - {zone: 3, ip: 10.0.0.3, port: 6000, device: sda, weight: 100, attributes: {media: nvme}}
+`), 0600))
+	decl, err := LoadRingDeclaration(declPath)
+	require.Nil(t, err)
+	changes, err := b.ApplyDeclaration(decl)
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"Changed weight of device 0 10.0.0.1:6000/sda from 100 to 50",
+		"Changed info of device 0 10.0.0.1:6000/sda",
+		"Removed device 1 10.0.0.2:6000/sda",
+		"Added device 2 10.0.0.3:6000/sda with weight 100",
+	}, changes)
+	require.Equal(t, "ssd", b.Devs[0].Meta)
+	require.Equal(t, -1.0, b.Devs[1].Weight)
+	require.Equal(t, int64(3), b.Devs[2].Zone)
+	require.Equal(t, "http", b.Devs[2].Scheme)
+	require.Equal(t, map[string]string{"media": "nvme"}, b.Devs[2].Attributes)
+
+	// Applying it again changes nothing.
+	changes, err = b.ApplyDeclaration(decl)
+	require.Nil(t, err)
+	require.Empty(t, changes)
+
+	decl.Devices[0].Attributes = map[string]string{"chassis": "7"}
+	changes, err = b.ApplyDeclaration(decl)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Changed info of device 0 10.0.0.1:6000/sda"}, changes)
+	require.Equal(t, map[string]string{"chassis": "7"}, b.Devs[0].Attributes)
+
+	decl.Devices[0].Zone = 2
+	_, err = b.ApplyDeclaration(decl)
+	require.NotNil(t, err)
+}
+
+func TestLoadRingDeclarationErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	declPath := filepath.Join(dir, "cluster.yaml")
+	require.Nil(t, ioutil.WriteFile(declPath, []byte("devices:\n  - {ip: 10.0.0.1, port: 6000, device: sda, wieght: 1}\n"), 0600))
+	_, err = LoadRingDeclaration(declPath)
+	require.NotNil(t, err)
+
+	b, err := NewRingBuilder(4, 2, 1, false)
+	require.Nil(t, err)
+	_, err = b.ApplyDeclaration(&RingDeclaration{Devices: []DeclaredDevice{{Ip: "10.0.0.1", Port: 6000, Device: "sda"}}})
+	require.NotNil(t, err)
+	weight := 1.0
+	_, err = b.ApplyDeclaration(&RingDeclaration{Devices: []DeclaredDevice{
+		{Ip: "10.0.0.1", Port: 6000, Device: "sda", Weight: &weight},
+		{Ip: "10.0.0.1", Port: 6000, Device: "sda", Weight: &weight},
+	}})
+	require.NotNil(t, err)
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	attrs, err := ParseAttributes("media=ssd, chassis=7,speed=")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"media": "ssd", "chassis": "7", "speed": ""}, attrs)
+	require.Equal(t, "chassis=7,media=ssd,speed=", FormatAttributes(attrs))
+	_, err = ParseAttributes("media")
+	require.NotNil(t, err)
+
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	builderPath := filepath.Join(dir, "object.builder")
+	b, err := NewRingBuilder(4, 1, 0, false)
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 1, Scheme: "http", Ip: "10.0.0.1", Port: 6000, Device: "sda", Weight: 100,
+		Attributes: map[string]string{"media": "hdd", "speed": "6G"}})
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 2, Scheme: "http", Ip: "10.0.0.2", Port: 6000, Device: "sda", Weight: 100})
+	require.Nil(t, err)
+	require.Nil(t, b.SetDevAttributes(0, map[string]string{"media": "ssd", "speed": ""}))
+	require.NotNil(t, b.SetDevAttributes(5, attrs))
+	_, _, _, err = b.Rebalance()
+	require.Nil(t, err)
+	require.Nil(t, b.Save(builderPath))
+
+	b, err = NewRingBuilderFromFile(builderPath, false)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"media": "ssd"}, b.Devs[0].Attributes)
+	require.Empty(t, b.Devs[1].Attributes)
+
+	require.Nil(t, WriteRing(builderPath))
+	r, err := LoadRing(filepath.Join(dir, "object.ring.gz"), "prefix", "suffix")
+	require.Nil(t, err)
+	devs := r.AllDevices()
+	require.Equal(t, map[string]string{"media": "ssd"}, devs[0].Attributes)
+	require.Nil(t, devs[1].Attributes)
+}
@@ -150,7 +150,9 @@ type RingBuilderDevice struct {
 	ReplicationIp   string  `pickle:"replication_ip"`
 	Parts           int64   `pickle:"parts"`
 	Id              int64   `pickle:"id"`
-	tiers           [4]string
+	// Attributes are free-form details of the device; see Device.
+	Attributes map[string]string `pickle:"attributes"`
+	tiers      [4]string
 }
 
 type RingBuilder struct {
@@ -1575,6 +1577,61 @@ func (b *RingBuilder) UpdateDevInfo(devId int64, newIp string, newPort int64, ne
 	return nil
 }
 
+// SetDevAttributes merges attrs into the device's attributes.  An attribute
+// set to "" is removed.
+func (b *RingBuilder) SetDevAttributes(devId int64, attrs map[string]string) error {
+	if devId < 0 || devId >= int64(len(b.Devs)) || b.Devs[devId] == nil {
+		return fmt.Errorf("Device %d not found.", devId)
+	}
+	dev := b.Devs[devId]
+	for k, v := range attrs {
+		if v == "" {
+			delete(dev.Attributes, k)
+			continue
+		}
+		if dev.Attributes == nil {
+			dev.Attributes = map[string]string{}
+		}
+		dev.Attributes[k] = v
+	}
+	if len(dev.Attributes) == 0 {
+		dev.Attributes = nil
+	}
+	return nil
+}
+
+// ParseAttributes parses device attributes given as comma separated
+// key=value pairs, such as "media=ssd,chassis=12".  A pair with no value,
+// "media=", is kept as "" so SetDevAttributes will remove it.
+func ParseAttributes(s string) (map[string]string, error) {
+	attrs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Invalid attribute %q, expected key=value.", pair)
+		}
+		attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return attrs, nil
+}
+
+// FormatAttributes returns attrs as ParseAttributes takes them, sorted by key.
+func FormatAttributes(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + attrs[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
 // ChangeMinPartHours changes the value used to decide if a given partition can be moved again.  This restriction is to give the overall system enough time to settl a partition to its new location before moving it to yet another location.  While no data would be lost if a partition is moved several times quickly, it could make the data unreachable for a short period of time.
 //
 // This should be set to at least the average full partition replication time.  Starting it at 24 hours and then lowering it to what the replicator reprots as the longest partition cycle is best.
@@ -1613,18 +1670,20 @@ func (b *RingBuilder) GetRing() *hashRing {
 				ReplicationPort: int(b.Devs[i].ReplicationPort),
 				Weight:          b.Devs[i].Weight,
 				Zone:            int(b.Devs[i].Zone),
+				Attributes:      b.Devs[i].Attributes,
 			})
 		} else {
 			data.Devs = append(data.Devs, nil)
 		}
 	}
-	data.replica2part2devId = make([][]uint16, len(b.replica2Part2Dev))
+	replica2part2devId := make([][]uint16, len(b.replica2Part2Dev))
 	for i := range b.replica2Part2Dev {
-		data.replica2part2devId[i] = make([]uint16, len(b.replica2Part2Dev[i]))
+		replica2part2devId[i] = make([]uint16, len(b.replica2Part2Dev[i]))
 		for j := range b.replica2Part2Dev[i] {
-			data.replica2part2devId[i][j] = uint16(b.replica2Part2Dev[i][j])
+			replica2part2devId[i][j] = uint16(b.replica2Part2Dev[i][j])
 		}
 	}
+	data.setAssignments(replica2part2devId)
 	r := &hashRing{}
 	r.data.Store(&data)
 
@@ -1829,6 +1888,22 @@ func SetInfo(builderPath string, devs []*RingBuilderDevice, newIp string, newPor
 	return builder.Save(builderPath)
 }
 
+// SetAttributes merges attrs into each of the devs' attributes; see
+// RingBuilder.SetDevAttributes.
+// Note that no locking is done here, you should call LockBuilderPath first.
+func SetAttributes(builderPath string, devs []*RingBuilderDevice, attrs map[string]string) error {
+	builder, err := NewRingBuilderFromFile(builderPath, false)
+	if err != nil {
+		return err
+	}
+	for _, dev := range devs {
+		if err := builder.SetDevAttributes(dev.Id, attrs); err != nil {
+			return err
+		}
+	}
+	return builder.Save(builderPath)
+}
+
 // Note that no locking is done here, you should call LockBuilderPath first.
 func WriteRing(builderPath string) error {
 	builder, err := NewRingBuilderFromFile(builderPath, false)
@@ -41,6 +41,7 @@ const (
 	jsonFlag    = 2
 	opGet       = byte(0x00)
 	opSet       = byte(0x01)
+	opAdd       = byte(0x02)
 	opDelete    = byte(0x04)
 	opIncrement = byte(0x05)
 	opDecrement = byte(0x06)
@@ -58,6 +59,19 @@ type MemcacheRing interface {
 	SetMulti(ctx context.Context, serverKey string, values map[string]interface{}, timeout int) error
 }
 
+// CASMemcacheRing is implemented by MemcacheRings that can check and set, so
+// that a value can be read, changed and written back without overwriting the
+// changes of others in between.
+type CASMemcacheRing interface {
+	// GetStructuredCAS is GetStructured that also returns the value's CAS
+	// token for SetCAS.
+	GetStructuredCAS(ctx context.Context, key string, val interface{}) (uint64, error)
+	// SetCAS stores value only if it hasn't changed since cas was read, or
+	// with a cas of 0, only if there is no value yet; it returns CASConflict
+	// otherwise.
+	SetCAS(ctx context.Context, key string, value interface{}, cas uint64, timeout int) error
+}
+
 type tracingMemcacheRing struct {
 	MemcacheRing
 	tracer opentracing.Tracer
@@ -161,6 +175,32 @@ func (r *tracingMemcacheRing) SetMulti(ctx context.Context, serverKey string, va
 	return err
 }
 
+func (r *tracingMemcacheRing) GetStructuredCAS(ctx context.Context, key string, val interface{}) (uint64, error) {
+	casRing, ok := r.MemcacheRing.(CASMemcacheRing)
+	if !ok {
+		return 0, errors.New("memcache ring does not support cas")
+	}
+	mcSpan := r.tracer.StartSpan("Memcache GetStructuredCAS", opentracing.ChildOf(r.getSpanContext(ctx)))
+	r.addKey(mcSpan, key)
+	defer mcSpan.Finish()
+	cas, err := casRing.GetStructuredCAS(ctx, key, val)
+	r.addError(mcSpan, err)
+	return cas, err
+}
+
+func (r *tracingMemcacheRing) SetCAS(ctx context.Context, key string, value interface{}, cas uint64, timeout int) error {
+	casRing, ok := r.MemcacheRing.(CASMemcacheRing)
+	if !ok {
+		return errors.New("memcache ring does not support cas")
+	}
+	mcSpan := r.tracer.StartSpan("Memcache SetCAS", opentracing.ChildOf(r.getSpanContext(ctx)))
+	r.addKey(mcSpan, key)
+	defer mcSpan.Finish()
+	err := casRing.SetCAS(ctx, key, value, cas, timeout)
+	r.addError(mcSpan, err)
+	return err
+}
+
 type memcacheRing struct {
 	ring                        map[string]string
 	serverKeys                  []string
@@ -267,6 +307,51 @@ func (ring *memcacheRing) GetStructured(ctx context.Context, key string, val int
 	return ring.loop(key, fn)
 }
 
+func (ring *memcacheRing) GetStructuredCAS(ctx context.Context, key string, val interface{}) (uint64, error) {
+	var cas uint64
+	fn := func(conn *connection) error {
+		if err := conn.sendPacket(opGet, hashKey(key), nil, nil, 0); err != nil {
+			return err
+		}
+		value, extras, c, err := conn.receivePacketCAS()
+		if err != nil {
+			return err
+		}
+		flags := binary.BigEndian.Uint32(extras[0:4])
+		if flags&jsonFlag == 0 {
+			return errors.New("Not json data")
+		}
+		if err := json.Unmarshal(value, val); err != nil {
+			return err
+		}
+		cas = c
+		return nil
+	}
+	return cas, ring.loop(key, fn)
+}
+
+func (ring *memcacheRing) SetCAS(ctx context.Context, key string, value interface{}, cas uint64, timeout int) error {
+	serl, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	extras := make([]byte, 8)
+	binary.BigEndian.PutUint32(extras[0:4], uint32(jsonFlag))
+	binary.BigEndian.PutUint32(extras[4:8], uint32(timeout))
+	op := opSet
+	if cas == 0 {
+		op = opAdd
+	}
+	fn := func(conn *connection) error {
+		if err := conn.sendPacket(op, hashKey(key), serl, extras, cas); err != nil {
+			return err
+		}
+		_, _, _, err := conn.receivePacketCAS()
+		return err
+	}
+	return ring.loop(key, fn)
+}
+
 func (ring *memcacheRing) Get(ctx context.Context, key string) (interface{}, error) {
 	type Return struct {
 		value interface{}
@@ -298,7 +383,7 @@ func (ring *memcacheRing) GetMulti(ctx context.Context, serverKey string, keys [
 	fn := func(conn *connection) error {
 		ret.value = make(map[string]interface{})
 		for _, key := range keys {
-			if err := conn.sendPacket(opGet, hashKey(key), nil, nil); err != nil {
+			if err := conn.sendPacket(opGet, hashKey(key), nil, nil, 0); err != nil {
 				return err
 			}
 		}
@@ -378,7 +463,7 @@ func (ring *memcacheRing) SetMulti(ctx context.Context, serverKey string, values
 			extras := make([]byte, 8)
 			binary.BigEndian.PutUint32(extras[0:4], uint32(jsonFlag))
 			binary.BigEndian.PutUint32(extras[4:8], uint32(timeout))
-			if err = conn.sendPacket(opSet, hashKey(key), serl, extras); err != nil {
+			if err = conn.sendPacket(opSet, hashKey(key), serl, extras, 0); err != nil {
 				return err
 			}
 		}
@@ -439,7 +524,7 @@ func (ring *memcacheRing) loop(key string, fn func(*connection) error) error {
 		server.releaseConnection(conn, err)
 		if err == nil {
 			return nil
-		} else if err == CacheMiss {
+		} else if err == CacheMiss || err == CASConflict {
 			return err
 		}
 	}
@@ -506,7 +591,7 @@ func (s *server) getConnection() (*connection, error) {
 }
 
 func (s *server) releaseConnection(conn *connection, err error) {
-	if err == nil || err == CacheMiss {
+	if err == nil || err == CacheMiss || err == CASConflict {
 		s.lock.Lock()
 		defer s.lock.Unlock()
 		if int64(len(s.connections)) < s.maxFreeConnections {
@@ -519,6 +604,10 @@ func (s *server) releaseConnection(conn *connection, err error) {
 
 var CacheMiss = fmt.Errorf("Server cache miss")
 
+// CASConflict is returned by SetCAS when the value was changed, or added, by
+// someone else.
+var CASConflict = errors.New("Server cache value changed")
+
 type connection struct {
 	conn       net.Conn
 	rw         *bufio.ReadWriter
@@ -553,41 +642,49 @@ func (c *connection) close() error {
 }
 
 func (c *connection) receivePacket() ([]byte, []byte, error) {
+	value, extras, _, err := c.receivePacketCAS()
+	return value, extras, err
+}
+
+func (c *connection) receivePacketCAS() ([]byte, []byte, uint64, error) {
 	packet := c.packetBuf[0:24]
 	if _, err := io.ReadFull(c.rw, packet); err != nil {
 		c.close()
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 	keyLen := binary.BigEndian.Uint16(packet[2:4])
 	extrasLen := packet[4]
 	status := binary.BigEndian.Uint16(packet[6:8])
 	bodyLen := int(binary.BigEndian.Uint32(packet[8:12]))
+	cas := binary.BigEndian.Uint64(packet[16:24])
 	for cap(c.packetBuf) < bodyLen {
 		c.packetBuf = append(c.packetBuf, ' ')
 	}
 	body := c.packetBuf[0:bodyLen]
 	if _, err := io.ReadFull(c.rw, body); err != nil {
 		c.close()
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 	switch status {
 	case 0:
-		return body[int(keyLen)+int(extrasLen) : int(bodyLen)], body[int(keyLen):int(extrasLen)], nil
+		return body[int(keyLen)+int(extrasLen) : int(bodyLen)], body[int(keyLen):int(extrasLen)], cas, nil
 	case 1:
-		return nil, nil, CacheMiss
+		return nil, nil, 0, CacheMiss
+	case 2:
+		return nil, nil, 0, CASConflict
 	default:
-		return nil, nil, fmt.Errorf("Error response from memcache: %d", status)
+		return nil, nil, 0, fmt.Errorf("Error response from memcache: %d", status)
 	}
 }
 
 func (c *connection) roundTripPacket(opcode byte, hashKey string, value []byte, extras []byte) ([]byte, []byte, error) {
-	if err := c.sendPacket(opcode, hashKey, value, extras); err != nil {
+	if err := c.sendPacket(opcode, hashKey, value, extras, 0); err != nil {
 		return nil, nil, err
 	}
 	return c.receivePacket()
 }
 
-func (c *connection) sendPacket(opcode byte, hashKey string, value []byte, extras []byte) error {
+func (c *connection) sendPacket(opcode byte, hashKey string, value []byte, extras []byte, cas uint64) error {
 	key := []byte(hashKey)
 	c.conn.SetDeadline(time.Now().Add(c.reqTimeout))
 	packet := c.packetBuf[0:24]
@@ -596,7 +693,7 @@ func (c *connection) sendPacket(opcode byte, hashKey string, value []byte, extra
 	packet[6], packet[7] = 0, 0
 	binary.BigEndian.PutUint32(packet[8:12], uint32(len(key)+len(value)+len(extras)))
 	packet[12], packet[13], packet[14], packet[15] = 0, 0, 0, 0
-	packet[16], packet[17], packet[18], packet[19], packet[20], packet[21], packet[22], packet[23] = 0, 0, 0, 0, 0, 0, 0, 0
+	binary.BigEndian.PutUint64(packet[16:24], cas)
 	packet = append(append(append(packet, extras...), key...), value...)
 	if _, err := c.rw.Write(packet); err != nil || c.rw.Flush() != nil {
 		c.close()
@@ -121,6 +121,7 @@ func testWithRing(t *testing.T, ring *memcacheRing) {
 	testGetCacheMiss(t, ring)
 	testIncr(t, ring)
 	testDecr(t, ring)
+	testCAS(t, ring)
 	testSetGetMulti(t, ring)
 	testManySetGets(t, ring)
 	testConnectionLimits(t, ring)
@@ -185,6 +186,24 @@ func testIncr(t *testing.T, ring *memcacheRing) {
 	}
 }
 
+func testCAS(t *testing.T, ring *memcacheRing) {
+	ctx := context.Background()
+	key := "testCAS"
+	var val map[string]int
+	_, err := ring.GetStructuredCAS(ctx, key, &val)
+	assert.Equal(t, CacheMiss, err)
+	assert.Nil(t, ring.SetCAS(ctx, key, map[string]int{"a": 1}, 0, 2))
+	assert.Equal(t, CASConflict, ring.SetCAS(ctx, key, map[string]int{"a": 2}, 0, 2))
+	cas, err := ring.GetStructuredCAS(ctx, key, &val)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val["a"])
+	assert.Nil(t, ring.SetCAS(ctx, key, map[string]int{"a": 3}, cas, 2))
+	assert.Equal(t, CASConflict, ring.SetCAS(ctx, key, map[string]int{"a": 4}, cas, 2))
+	_, err = ring.GetStructuredCAS(ctx, key, &val)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val["a"])
+}
+
 func testDecr(t *testing.T, ring *memcacheRing) {
 	ctx := context.Background()
 	key := "testDecr"
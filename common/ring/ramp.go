@@ -0,0 +1,153 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WeightRamp moves a device's weight toward Target by Step each time the
+// ring is stepped, so that capacity added or drained doesn't move all of its
+// partitions in a single rebalance.
+type WeightRamp struct {
+	Target float64 `json:"target"`
+	Step   float64 `json:"step"`
+}
+
+// weightRampsPath is where the pending ramps of a builder are kept, since
+// the builder file itself has to stay readable by other ring tools.
+func weightRampsPath(builderPath string) string {
+	return strings.TrimSuffix(builderPath, ".builder") + ".ramps.json"
+}
+
+// LoadWeightRamps returns the pending ramps of the builder at builderPath,
+// keyed by device id.
+func LoadWeightRamps(builderPath string) (map[int64]WeightRamp, error) {
+	ramps := map[int64]WeightRamp{}
+	data, err := ioutil.ReadFile(weightRampsPath(builderPath))
+	if os.IsNotExist(err) {
+		return ramps, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ramps); err != nil {
+		return nil, err
+	}
+	return ramps, nil
+}
+
+func saveWeightRamps(builderPath string, ramps map[int64]WeightRamp) error {
+	pth := weightRampsPath(builderPath)
+	if len(ramps) == 0 {
+		if err := os.Remove(pth); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(ramps)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(pth+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(pth+".tmp", pth)
+}
+
+// StepWeightRamps moves the weight of each device in ramps one step toward
+// its target, dropping the ramps that are done or whose devices are gone.  It
+// returns a description of each change made.
+func (b *RingBuilder) StepWeightRamps(ramps map[int64]WeightRamp) ([]string, error) {
+	var changes []string
+	ids := make([]int64, 0, len(ramps))
+	for id := range ramps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		ramp := ramps[id]
+		if id < 0 || id >= int64(len(b.Devs)) || b.Devs[id] == nil || b.Devs[id].Weight < 0 {
+			delete(ramps, id)
+			continue
+		}
+		dev := b.Devs[id]
+		weight := dev.Weight + ramp.Step
+		if ramp.Step == 0 || (ramp.Step > 0 && weight >= ramp.Target) || (ramp.Step < 0 && weight <= ramp.Target) {
+			weight = ramp.Target
+			delete(ramps, id)
+		}
+		if weight == dev.Weight {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("Ramped weight of device %d %s:%d/%s from %v to %v", id, dev.Ip, dev.Port, dev.Device, dev.Weight, weight))
+		if err := b.SetDevWeight(id, weight); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// SetWeightRamp starts ramping devs to weight in the given number of steps;
+// the first step is taken by the next StepWeightRamps.
+// Note that no locking is done here, you should call LockBuilderPath first.
+func SetWeightRamp(builderPath string, devs []*RingBuilderDevice, weight float64, steps int) error {
+	if weight < 0 {
+		return errors.New("weight must be at least 0")
+	}
+	if steps < 1 {
+		return errors.New("steps must be at least 1")
+	}
+	ramps, err := LoadWeightRamps(builderPath)
+	if err != nil {
+		return err
+	}
+	for _, dev := range devs {
+		ramps[dev.Id] = WeightRamp{Target: weight, Step: (weight - dev.Weight) / float64(steps)}
+	}
+	return saveWeightRamps(builderPath, ramps)
+}
+
+// StepWeightRampsFile takes the next step of the builder's pending ramps and
+// saves the builder; it does not rebalance.  No step is taken until
+// min_part_hours have passed since the last rebalance, since the partitions
+// moved by the previous step may not have settled yet.
+// Note that no locking is done here, you should call LockBuilderPath first.
+func StepWeightRampsFile(builderPath string) ([]string, error) {
+	ramps, err := LoadWeightRamps(builderPath)
+	if err != nil || len(ramps) == 0 {
+		return nil, err
+	}
+	builder, err := NewRingBuilderFromFile(builderPath, false)
+	if err != nil || builder.MinPartSecondsLeft() > 0 {
+		return nil, err
+	}
+	changes, err := builder.StepWeightRamps(ramps)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		if err = builder.Save(builderPath); err != nil {
+			return nil, err
+		}
+	}
+	return changes, saveWeightRamps(builderPath, ramps)
+}
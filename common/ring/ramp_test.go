@@ -0,0 +1,66 @@
+package ring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepWeightRamps(t *testing.T) {
+	b, err := NewRingBuilder(4, 2, 1, false)
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 1, Scheme: "http", Ip: "10.0.0.1", Port: 6000, Device: "sda", Weight: 0})
+	require.Nil(t, err)
+	_, err = b.AddDev(&RingBuilderDevice{Id: -1, Zone: 2, Scheme: "http", Ip: "10.0.0.2", Port: 6000, Device: "sda", Weight: 100})
+	require.Nil(t, err)
+	ramps := map[int64]WeightRamp{0: {Target: 100, Step: 40}, 1: {Target: 50, Step: -50}, 7: {Target: 1, Step: 1}}
+
+	changes, err := b.StepWeightRamps(ramps)
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		"Ramped weight of device 0 10.0.0.1:6000/sda from 0 to 40",
+		"Ramped weight of device 1 10.0.0.2:6000/sda from 100 to 50",
+	}, changes)
+	require.Equal(t, map[int64]WeightRamp{0: {Target: 100, Step: 40}}, ramps)
+
+	b.StepWeightRamps(ramps)
+	require.Equal(t, 80.0, b.Devs[0].Weight)
+	changes, err = b.StepWeightRamps(ramps)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Ramped weight of device 0 10.0.0.1:6000/sda from 80 to 100"}, changes)
+	require.Empty(t, ramps)
+}
+
+func TestWeightRampsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	builderPath := filepath.Join(dir, "object.builder")
+	require.Nil(t, CreateRing(builderPath, 4, 1, 1, false))
+	_, err = AddDevice(builderPath, -1, 0, 1, "http", "10.0.0.1", 6000, "", 0, "sda", 0, false)
+	require.Nil(t, err)
+	devs, err := Search(builderPath, -1, -1, "", -1, "", -1, "sda", -1, "", "")
+	require.Nil(t, err)
+
+	require.Nil(t, SetWeightRamp(builderPath, devs, 100, 2))
+	ramps, err := LoadWeightRamps(builderPath)
+	require.Nil(t, err)
+	require.Equal(t, map[int64]WeightRamp{0: {Target: 100, Step: 50}}, ramps)
+
+	changes, err := StepWeightRampsFile(builderPath)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(changes))
+	changes, err = StepWeightRampsFile(builderPath)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(changes))
+	builder, err := NewRingBuilderFromFile(builderPath, false)
+	require.Nil(t, err)
+	require.Equal(t, 100.0, builder.Devs[0].Weight)
+	_, err = os.Stat(weightRampsPath(builderPath))
+	require.True(t, os.IsNotExist(err))
+
+	require.NotNil(t, SetWeightRamp(builderPath, devs, 100, 0))
+}
@@ -26,6 +26,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -63,6 +64,10 @@ type Device struct {
 	ReplicationPort int     `json:"replication_port"`
 	Weight          float64 `json:"weight"`
 	Zone            int     `json:"zone"`
+	// Attributes are free-form details of the device, such as media=ssd or
+	// chassis=12, for placement, affinity and capacity reports to use.
+	// Rings written before they existed just have none.
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type RingMD5 interface {
@@ -74,22 +79,108 @@ type RingMD5 interface {
 	AssignmentCount(devId int) int
 }
 
+// noDevice is the device id of the missing replicas of partitions in rings
+// with a fractional replica count.
+const noDevice = -1
+
 type ringData struct {
-	Devs                                []*Device `json:"devs"`
-	ReplicaCount                        int       `json:"replica_count"`
-	PartShift                           uint64    `json:"part_shift"`
-	replica2part2devId                  [][]uint16
+	Devs         []*Device `json:"devs"`
+	ReplicaCount int       `json:"replica_count"`
+	PartShift    uint64    `json:"part_shift"`
+	// assignments has the device id of each replica of each partition,
+	// partition by partition so a partition's are next to each other.  Ids
+	// take a byte each if every device's fits in one, two otherwise, with
+	// all bits set meaning noDevice.  The []*Device for a partition is only
+	// put together when asked for.
+	assignments []byte
+	idWidth     int
+	replicas    int
+	parts       int
+	// replicaParts is how many partitions each replica was given, which
+	// is less than parts for the last replica of a fractional replica
+	// count.
+	replicaParts                        []int
 	regionCount, zoneCount, ipPortCount int
 	md5                                 string
 }
 
+// setAssignments stores replica2part2devId, as read from a ring file or made
+// by a RingBuilder, in the compact form.
+func (d *ringData) setAssignments(replica2part2devId [][]uint16) {
+	d.replicas = len(replica2part2devId)
+	d.parts = 0
+	d.replicaParts = make([]int, d.replicas)
+	maxId := 0
+	for i, part2devId := range replica2part2devId {
+		d.replicaParts[i] = len(part2devId)
+		if len(part2devId) > d.parts {
+			d.parts = len(part2devId)
+		}
+		for _, devId := range part2devId {
+			if int(devId) > maxId {
+				maxId = int(devId)
+			}
+		}
+	}
+	d.idWidth = 1
+	if maxId >= 0xff {
+		d.idWidth = 2
+	}
+	d.assignments = make([]byte, d.parts*d.replicas*d.idWidth)
+	for i, part2devId := range replica2part2devId {
+		for partition := 0; partition < d.parts; partition++ {
+			if partition < len(part2devId) {
+				d.setDevId(partition, i, int(part2devId[partition]))
+			} else {
+				d.setDevId(partition, i, noDevice)
+			}
+		}
+	}
+}
+
+func (d *ringData) setDevId(partition, replica, devId int) {
+	i := (partition*d.replicas + replica) * d.idWidth
+	if d.idWidth == 1 {
+		d.assignments[i] = uint8(devId)
+	} else {
+		binary.LittleEndian.PutUint16(d.assignments[i:], uint16(devId))
+	}
+}
+
+// devId returns the id of the device assigned replica of partition, or
+// noDevice.
+func (d *ringData) devId(partition, replica int) int {
+	i := partition*d.replicas + replica
+	if d.idWidth == 1 {
+		if devId := d.assignments[i]; devId != 0xff {
+			return int(devId)
+		}
+		return noDevice
+	}
+	if devId := binary.LittleEndian.Uint16(d.assignments[i*2:]); devId != 0xffff {
+		return int(devId)
+	}
+	return noDevice
+}
+
+// part2devId returns the device ids of replica's partitions, as they're
+// stored in a ring file.
+func (d *ringData) part2devId(replica int) []uint16 {
+	part2devId := make([]uint16, d.replicaParts[replica])
+	for partition := range part2devId {
+		part2devId[partition] = uint16(d.devId(partition, replica))
+	}
+	return part2devId
+}
+
 type hashRing struct {
-	data    atomic.Value
-	path    string
-	prefix  string
-	suffix  string
-	mtime   time.Time
-	calcMD5 bool
+	data     atomic.Value
+	path     string
+	prefix   string
+	suffix   string
+	mtime    time.Time
+	calcMD5  bool
+	reloadMu sync.Mutex
 }
 
 type regionZone struct {
@@ -125,11 +216,14 @@ func (r *hashRing) getData() *ringData {
 
 func (r *hashRing) GetNodes(partition uint64) (response []*Device) {
 	d := r.getData()
-	if partition >= uint64(len(d.replica2part2devId[0])) {
+	if partition >= uint64(d.parts) {
 		return nil
 	}
+	response = make([]*Device, 0, d.ReplicaCount)
 	for i := 0; i < d.ReplicaCount; i++ {
-		response = append(response, d.Devs[d.replica2part2devId[i][partition]])
+		if devId := d.devId(int(partition), i); devId != noDevice {
+			response = append(response, d.Devs[devId])
+		}
 	}
 	return response
 }
@@ -137,11 +231,15 @@ func (r *hashRing) GetNodes(partition uint64) (response []*Device) {
 func (r *hashRing) GetJobNodes(partition uint64, localDevice int) (response []*Device, handoff bool) {
 	d := r.getData()
 	handoff = true
-	if partition >= uint64(len(d.replica2part2devId[0])) {
+	if partition >= uint64(d.parts) {
 		return nil, false
 	}
 	for i := 0; i < d.ReplicaCount; i++ {
-		dev := d.Devs[d.replica2part2devId[i][partition]]
+		devId := d.devId(int(partition), i)
+		if devId == noDevice {
+			continue
+		}
+		dev := d.Devs[devId]
 		if dev.Id == localDevice {
 			handoff = false
 		} else {
@@ -211,12 +309,12 @@ func (r *hashRing) GetMoreNodes(partition uint64) MoreNodes {
 
 func (r *hashRing) ReplicaCount() (cnt uint64) {
 	d := r.getData()
-	return uint64(len(d.replica2part2devId))
+	return uint64(d.replicas)
 }
 
 func (r *hashRing) PartitionCount() (cnt uint64) {
 	d := r.getData()
-	return uint64(len(d.replica2part2devId[0]))
+	return uint64(d.parts)
 }
 
 func (r *hashRing) MD5() string {
@@ -289,6 +387,8 @@ func (r *hashRing) RingMatching(md5 string) RingMD5 {
 }
 
 func (r *hashRing) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
 	fi, err := os.Stat(r.path)
 	if err != nil {
 		return err
@@ -332,11 +432,12 @@ func (r *hashRing) Reload() error {
 		return err
 	}
 	partitionCount := 1 << (32 - data.PartShift)
-	for i := 0; i < data.ReplicaCount; i++ {
-		part2dev := make([]uint16, partitionCount)
-		binary.Read(gz, binary.LittleEndian, &part2dev)
-		data.replica2part2devId = append(data.replica2part2devId, part2dev)
+	replica2part2devId := make([][]uint16, data.ReplicaCount)
+	for i := range replica2part2devId {
+		replica2part2devId[i] = make([]uint16, partitionCount)
+		binary.Read(gz, binary.LittleEndian, &replica2part2devId[i])
 	}
+	data.setAssignments(replica2part2devId)
 	regionCount := make(map[int]bool)
 	zoneCount := make(map[regionZone]bool)
 	ipPortCount := make(map[ipPort]bool)
@@ -373,10 +474,11 @@ func (r *hashRing) reloader() error {
 }
 
 func (r *hashRing) AssignmentCount(devId int) int {
+	d := r.getData()
 	count := 0
-	for _, part2devId := range r.getData().replica2part2devId {
-		for _, rDevId := range part2devId {
-			if int(rDevId) == devId {
+	for partition := 0; partition < d.parts; partition++ {
+		for i := 0; i < d.replicas; i++ {
+			if d.devId(partition, i) == devId {
 				count++
 			}
 		}
@@ -393,13 +495,15 @@ func (m *hashMoreNodes) addDevice(d *Device) {
 
 func (m *hashMoreNodes) initialize() {
 	d := m.r.getData()
-	m.parts = len(d.replica2part2devId[0])
+	m.parts = d.parts
 	m.used = make(map[int]bool)
 	m.sameRegions = make(map[int]bool)
 	m.sameZones = make(map[regionZone]bool)
 	m.sameIpPorts = make(map[ipPort]bool)
-	for _, mp := range d.replica2part2devId {
-		m.addDevice(d.Devs[mp[m.partition]])
+	for i := 0; i < d.replicas; i++ {
+		if devId := d.devId(int(m.partition), i); devId != noDevice {
+			m.addDevice(d.Devs[devId])
+		}
 	}
 	hash := md5.New()
 	hash.Write([]byte(strconv.FormatUint(m.partition, 10)))
@@ -430,11 +534,11 @@ func (m *hashMoreNodes) Next() *Device {
 	}
 	for i := 0; i < m.parts; i += m.inc {
 		handoffPart := (i + m.start) % m.parts
-		for _, part2devId := range d.replica2part2devId {
-			if handoffPart < len(part2devId) {
-				if check(d.Devs[part2devId[handoffPart]]) {
-					m.addDevice(d.Devs[part2devId[handoffPart]])
-					return d.Devs[part2devId[handoffPart]]
+		for replica := 0; replica < d.replicas; replica++ {
+			if devId := d.devId(handoffPart, replica); devId != noDevice {
+				if dev := d.Devs[devId]; check(dev) {
+					m.addDevice(dev)
+					return dev
 				}
 			}
 		}
@@ -460,6 +564,29 @@ func LoadRing(path string, prefix string, suffix string) (Ring, error) {
 	return ring, nil
 }
 
+// ReloadRings re-reads every ring loaded with LoadRing rather than waiting
+// for the periodic reload, returning the paths of the rings that changed.
+func ReloadRings() ([]string, error) {
+	loadedRingsLock.Lock()
+	defer loadedRingsLock.Unlock()
+	var changed []string
+	var errs []string
+	for path, ring := range loadedRings {
+		before := ring.getData()
+		if err := ring.Reload(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		} else if ring.getData() != before {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return changed, fmt.Errorf("Error reloading rings: %s", strings.Join(errs, "; "))
+	}
+	return changed, nil
+}
+
 func LoadRingMD5(path string, prefix string, suffix string) (RingMD5, error) {
 	ring := &hashRing{prefix: prefix, suffix: suffix, path: path, mtime: time.Unix(0, 0), calcMD5: true}
 	if err := ring.Reload(); err != nil {
@@ -496,8 +623,8 @@ func (r *hashRing) Save(filename string) error {
 	gz.Write(dataBuf)
 	// Write replica2part2devId
 	d := r.getData()
-	for i := range d.replica2part2devId {
-		if err := binary.Write(gz, binary.LittleEndian, d.replica2part2devId[i]); err != nil {
+	for i := 0; i < d.replicas; i++ {
+		if err := binary.Write(gz, binary.LittleEndian, d.part2devId(i)); err != nil {
 			return err
 		}
 	}
@@ -167,6 +167,27 @@ func TestRingReload(t *testing.T) {
 	require.Equal(t, uint64(30), ring.getData().PartShift)
 }
 
+func TestReloadRings(t *testing.T) {
+	fp, err := ioutil.TempFile("", "")
+	require.Nil(t, err)
+	defer fp.Close()
+	defer os.RemoveAll(fp.Name())
+	require.Nil(t, writeARing(fp, 4, 2, 29, 2))
+	r, err := LoadRing(fp.Name(), "prefix", "suffix")
+	require.Nil(t, err)
+	// rings loaded by other tests may have had their files removed, so only
+	// this ring's entry is checked
+	changed, _ := ReloadRings()
+	require.NotContains(t, changed, fp.Name())
+	fp.Seek(0, os.SEEK_SET)
+	fp.Truncate(0)
+	require.Nil(t, writeARing(fp, 5, 3, 30, -1))
+	os.Chtimes(fp.Name(), time.Now(), time.Now().Add(time.Second))
+	changed, _ = ReloadRings()
+	require.Contains(t, changed, fp.Name())
+	require.Equal(t, uint64(3), r.ReplicaCount())
+}
+
 func TestCounts(t *testing.T) {
 	fp, err := ioutil.TempFile("", "")
 	require.Nil(t, err)
@@ -177,3 +198,33 @@ func TestCounts(t *testing.T) {
 	require.Equal(t, uint64(2), r.ReplicaCount())
 	require.Equal(t, uint64(8), r.PartitionCount())
 }
+
+func TestRingAssignments(t *testing.T) {
+	d := &ringData{}
+	d.setAssignments([][]uint16{{0, 1, 2, 3}, {1, 2, 3, 0}, {2, 3}})
+	require.Equal(t, 1, d.idWidth)
+	require.Equal(t, 3, d.replicas)
+	require.Equal(t, 4, d.parts)
+	require.Equal(t, 12, len(d.assignments))
+	require.Equal(t, 3, d.devId(1, 2))
+	require.Equal(t, noDevice, d.devId(2, 2))
+	require.Equal(t, []uint16{2, 3}, d.part2devId(2))
+
+	d = &ringData{}
+	d.setAssignments([][]uint16{{0, 300}, {300, 1000}})
+	require.Equal(t, 2, d.idWidth)
+	require.Equal(t, 1000, d.devId(1, 1))
+	require.Equal(t, []uint16{300, 1000}, d.part2devId(1))
+}
+
+func TestGetNodesFractionalReplicas(t *testing.T) {
+	devs := []*Device{{Id: 0}, {Id: 1}, {Id: 2}}
+	d := &ringData{Devs: devs, ReplicaCount: 3}
+	d.setAssignments([][]uint16{{0, 1}, {1, 2}, {2}})
+	r := &hashRing{}
+	r.data.Store(d)
+	require.Equal(t, []*Device{devs[0], devs[1], devs[2]}, r.GetNodes(0))
+	require.Equal(t, []*Device{devs[1], devs[2]}, r.GetNodes(1))
+	require.Nil(t, r.GetNodes(2))
+	require.Equal(t, 2, r.AssignmentCount(2))
+}
@@ -0,0 +1,98 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Spool holds data written to it in memory until there's more than its
+// memory limit, then moves it all to a temporary file, so a large payload
+// that has to be held onto costs disk rather than RAM.  A Spool must be
+// closed to remove any file it made.
+type Spool struct {
+	memoryLimit int
+	dir         string
+	mem         bytes.Buffer
+	file        *os.File
+	size        int64
+}
+
+// NewSpool returns a Spool that keeps up to memoryLimit bytes in memory and
+// spills to a file in dir, or the system's temporary directory if dir is "".
+func NewSpool(memoryLimit int, dir string) *Spool {
+	return &Spool{memoryLimit: memoryLimit, dir: dir}
+}
+
+func (s *Spool) Write(b []byte) (int, error) {
+	if s.file == nil && s.mem.Len()+len(b) > s.memoryLimit {
+		f, err := ioutil.TempFile(s.dir, "spool")
+		if err != nil {
+			return 0, err
+		}
+		// The file only needs a name long enough to be opened; once it's
+		// unlinked, the space goes back when it's closed, even on a crash.
+		os.Remove(f.Name())
+		if _, err := f.Write(s.mem.Bytes()); err != nil {
+			f.Close()
+			return 0, err
+		}
+		s.file = f
+		s.mem = bytes.Buffer{}
+	}
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(b)
+	} else {
+		n, err = s.mem.Write(b)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// Len returns how many bytes have been written.
+func (s *Spool) Len() int64 {
+	return s.size
+}
+
+// Spilled reports whether the data has been moved to disk.
+func (s *Spool) Spilled() bool {
+	return s.file != nil
+}
+
+// Reader returns a reader of everything written so far, from the start.
+// Writing more afterward invalidates it.
+func (s *Spool) Reader() (io.Reader, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.mem.Bytes()), nil
+	}
+	return io.NewSectionReader(s.file, 0, s.size), nil
+}
+
+// Close frees the spool's memory and file.
+func (s *Spool) Close() error {
+	s.mem = bytes.Buffer{}
+	if s.file != nil {
+		err := s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewSpool(10, dir)
+	s.Write([]byte("hello"))
+	require.False(t, s.Spilled())
+	r, err := s.Reader()
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(data))
+
+	s.Write([]byte(" there, world"))
+	require.True(t, s.Spilled())
+	require.Equal(t, int64(18), s.Len())
+	// The file is already unlinked.
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(files))
+	for i := 0; i < 2; i++ {
+		r, err = s.Reader()
+		require.Nil(t, err)
+		data, err = ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Equal(t, "hello there, world", string(data))
+	}
+	require.Nil(t, s.Close())
+	require.False(t, s.Spilled())
+}
@@ -0,0 +1,171 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package srv
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
+	"go.uber.org/zap"
+)
+
+// Reloader is implemented by servers that can apply some of their settings
+// without a restart.  Reload is given the freshly read config and returns the
+// settings, as "section/key", that it changed.
+type Reloader interface {
+	Reload(config conf.Config) ([]string, error)
+}
+
+// certReloader serves a TLS certificate that can be swapped out while the
+// server is running.
+type certReloader struct {
+	certFile, keyFile string
+	lock              sync.RWMutex
+	cert              *tls.Certificate
+	certPEM, keyPEM   []byte
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload re-reads the certificate and key files, reporting whether they
+// changed.  The current certificate is kept if the new one can't be loaded.
+func (c *certReloader) Reload() (bool, error) {
+	certPEM, err := ioutil.ReadFile(c.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := ioutil.ReadFile(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cert != nil && bytes.Equal(certPEM, c.certPEM) && bytes.Equal(keyPEM, c.keyPEM) {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	c.cert, c.certPEM, c.keyPEM = &cert, certPEM, keyPEM
+	return true, nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
+
+// ReloadSummary is the JSON body returned by /admin/reload.
+type ReloadSummary struct {
+	Rings    []string `json:"rings"`
+	Certs    bool     `json:"certs"`
+	Settings []string `json:"settings"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// adminReloadHandler answers POST /admin/reload, re-reading rings, the TLS
+// certificate and, for servers that are Reloaders, their config; everything
+// else goes to next.  Requests must carry the admin_key from the [admin]
+// section in an X-Admin-Key header, and the endpoint is not served at all
+// when no admin_key is set.
+func adminReloadHandler(next http.Handler, adminKey string, certs *certReloader, server Server, loadConfig func() (conf.Config, error), logger LowLevelLogger) http.Handler {
+	if adminKey == "" {
+		return next
+	}
+	var reloadLock sync.Mutex
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/admin/reload" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		if request.Method != "POST" {
+			StandardResponse(writer, http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("X-Admin-Key")), []byte(adminKey)) != 1 {
+			StandardResponse(writer, http.StatusUnauthorized)
+			return
+		}
+		reloadLock.Lock()
+		defer reloadLock.Unlock()
+		summary := &ReloadSummary{Rings: []string{}, Settings: []string{}}
+		if changed, err := ring.ReloadRings(); err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+		} else if changed != nil {
+			summary.Rings = changed
+		}
+		if certs != nil {
+			if changed, err := certs.Reload(); err != nil {
+				summary.Errors = append(summary.Errors, "Error reloading certificate: "+err.Error())
+			} else {
+				summary.Certs = changed
+			}
+		}
+		if reloader, ok := server.(Reloader); ok {
+			if config, err := loadConfig(); err != nil {
+				summary.Errors = append(summary.Errors, "Error loading config: "+err.Error())
+			} else if changed, err := reloader.Reload(config); err != nil {
+				summary.Errors = append(summary.Errors, "Error reloading config: "+err.Error())
+			} else if changed != nil {
+				summary.Settings = changed
+			}
+		}
+		logger.Info("Reloaded", zap.Strings("rings", summary.Rings), zap.Bool("certs", summary.Certs),
+			zap.Strings("settings", summary.Settings), zap.Strings("errors", summary.Errors))
+		body, err := json.Marshal(summary)
+		if err != nil {
+			StandardResponse(writer, http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		if len(summary.Errors) > 0 {
+			writer.WriteHeader(http.StatusInternalServerError)
+		} else {
+			writer.WriteHeader(http.StatusOK)
+		}
+		writer.Write(body)
+	})
+}
+
+// ReloadLogLevel sets level from the log_level in the given config section,
+// reporting whether it changed.  It's meant for use by Reloaders.
+func ReloadLogLevel(level zap.AtomicLevel, config conf.Config, section string) (bool, error) {
+	newLevel := zap.NewAtomicLevel()
+	if err := newLevel.UnmarshalText([]byte(strings.ToLower(config.GetDefault(section, "log_level", "INFO")))); err != nil {
+		return false, err
+	}
+	if newLevel.Level() == level.Level() {
+		return false, nil
+	}
+	level.SetLevel(newLevel.Level())
+	return true, nil
+}
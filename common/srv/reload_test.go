@@ -0,0 +1,99 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package srv
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/troubling/hummingbird/common/conf"
+	"go.uber.org/zap"
+)
+
+type reloadingServer struct {
+	logLevel zap.AtomicLevel
+}
+
+func (s *reloadingServer) Type() string                                         { return "test" }
+func (s *reloadingServer) Background(flags *flag.FlagSet) chan struct{}         { return nil }
+func (s *reloadingServer) GetHandler(config conf.Config, m string) http.Handler { return nil }
+func (s *reloadingServer) Finalize()                                            {}
+
+func (s *reloadingServer) Reload(config conf.Config) ([]string, error) {
+	if changed, err := ReloadLogLevel(s.logLevel, config, "app:test-server"); err != nil || !changed {
+		return nil, err
+	}
+	return []string{"app:test-server/log_level"}, nil
+}
+
+func TestAdminReload(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+	server := &reloadingServer{logLevel: zap.NewAtomicLevel()}
+	loadConfig := func() (conf.Config, error) {
+		return conf.StringConfig("[app:test-server]\nlog_level = debug\n")
+	}
+	handler := adminReloadHandler(next, "secret", nil, server, loadConfig, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("GET", "/healthcheck"))
+	assert.Equal(t, 204, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("POST", "/admin/reload"))
+	assert.Equal(t, 401, w.Code)
+
+	w = httptest.NewRecorder()
+	req := newRequest("POST", "/admin/reload")
+	req.Header.Set("X-Admin-Key", "wrong")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+
+	w = httptest.NewRecorder()
+	req = newRequest("POST", "/admin/reload")
+	req.Header.Set("X-Admin-Key", "secret")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var summary ReloadSummary
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, []string{"app:test-server/log_level"}, summary.Settings)
+	assert.False(t, summary.Certs)
+	assert.Equal(t, zap.DebugLevel, server.logLevel.Level())
+
+	// Nothing changed the second time around.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, []string{}, summary.Settings)
+}
+
+func TestAdminReloadDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	handler := adminReloadHandler(next, "", nil, &reloadingServer{}, nil, zap.NewNop())
+	w := httptest.NewRecorder()
+	req := newRequest("POST", "/admin/reload")
+	req.Header.Set("X-Admin-Key", "")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
@@ -96,6 +96,12 @@ type IpPort struct {
 	Ip                string
 	Port              int
 	CertFile, KeyFile string
+	// UnixSocket, if set, is a path the server will also listen on in
+	// addition to Ip:Port; see UnixSocketPath.
+	UnixSocket string
+	// Workers, if more than one, is how many worker processes serve
+	// Ip:Port, each with its own SO_REUSEPORT socket; see superviseWorkers.
+	Workers int
 }
 
 func (w *customWriter) WriteHeader(status int) {
@@ -173,18 +179,7 @@ func SimpleErrorResponse(w http.ResponseWriter, statusCode int, body string) {
 }
 
 func ErrorResponse(w http.ResponseWriter, err error) {
-	errCode := http.StatusInternalServerError
-	switch err {
-	case common.ErrBadRequest:
-		errCode = http.StatusBadRequest
-	case common.ErrNotFound:
-		errCode = http.StatusNotFound
-	case common.ErrConflict:
-		errCode = http.StatusConflict
-	case common.ErrDisconnect:
-		errCode = 499
-	default:
-	}
+	errCode := common.ErrorStatus(err)
 	body := err.Error()
 	if body == "" {
 		body = responseBodies[errCode]
@@ -331,6 +326,9 @@ func LogRequest(logger LowLevelLogger, next http.Handler) http.Handler {
 		newReader := &CountingReadCloser{ReadCloser: request.Body}
 		request.Body = newReader
 		logr := logger.With(zap.String("txn", request.Header.Get("X-Trans-Id")))
+		if traceId, ok := common.ParseTraceparent(request.Header.Get("Traceparent")); ok {
+			logr = logr.With(zap.String("traceId", traceId))
+		}
 		request = SetLogger(request, logr)
 		next.ServeHTTP(newWriter, request)
 		LogRequestLine(logr, request, start, newWriter, newReader)
@@ -508,6 +506,29 @@ func RetryListen(ip string, port int) (net.Listener, error) {
 	}
 }
 
+// UnixSocketPath returns the path of the Unix domain socket a server bound
+// to the given port listens on within dir. Backend servers and the proxy both
+// use this so the proxy can find a local server's socket from a ring device.
+func UnixSocketPath(dir string, port int) string {
+	return filepath.Join(dir, strconv.Itoa(port)+".sock")
+}
+
+func RetryListenUnix(path string) (net.Listener, error) {
+	started := time.Now()
+	for {
+		// A previous instance that didn't exit cleanly can leave a stale socket file behind.
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		if sock, err := net.Listen("unix", path); err == nil {
+			return sock, nil
+		} else if time.Now().Sub(started) > 10*time.Second {
+			return nil, fmt.Errorf("Failed to bind for 10 seconds (%v)", err)
+		}
+		time.Sleep(time.Second / 5)
+	}
+}
+
 func DumpGoroutinesStackTrace(pid int) {
 	filename := filepath.Join("/tmp", strconv.Itoa(pid)+".dump")
 	buf := make([]byte, 1<<20)
@@ -544,12 +565,15 @@ func RunServers(getServer func(conf.Config, *flag.FlagSet, ConfigLoader) (*IpPor
 	}
 	var wg *sync.WaitGroup
 
-	for _, config := range configs {
+	for i, config := range configs {
 		ipPort, server, logger, err := getServer(config, flags, DefaultConfigLoader{})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
 		}
+		for _, key := range config.UnknownKeys() {
+			logger.With(zap.String("setting", key)).Warn("Unknown config setting")
+		}
 		var metricsPrefix string
 		if len(configs) == 1 {
 			metricsPrefix = fmt.Sprintf("hb_%s", server.Type())
@@ -558,23 +582,69 @@ func RunServers(getServer func(conf.Config, *flag.FlagSet, ConfigLoader) (*IpPor
 		}
 		metricsPrefix = strings.Replace(metricsPrefix, "-", "_", -1)
 		metricsPrefix = strings.Replace(metricsPrefix, ".", "_", -1)
-		sock, err := RetryListen(ipPort.Ip, ipPort.Port)
+		if ipPort.Workers > 1 && !IsWorker() {
+			if len(configs) == 1 {
+				superviseWorkers(ipPort, ipPort.Workers, logger)
+				return
+			}
+			logger.With(zap.Int("port", ipPort.Port)).Warn("Worker processes need a single server config; running just one")
+		}
+		var sock net.Listener
+		if IsWorker() {
+			sock, err = RetryListenReusePort(ipPort.Ip, ipPort.Port)
+		} else {
+			sock, err = RetryListen(ipPort.Ip, ipPort.Port)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listening: %v\n", err)
 			logger.Error("Error listening", zap.Error(err))
 			os.Exit(1)
 		}
-		var srv HummingbirdServer
+		var unixSock net.Listener
+		if ipPort.UnixSocket != "" && IsWorker() {
+			if unixSock, err = inheritedUnixListener(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error using inherited unix socket: %v\n", err)
+				logger.Error("Error using inherited unix socket", zap.Error(err))
+				os.Exit(1)
+			}
+		} else if ipPort.UnixSocket != "" {
+			if unixSock, err = RetryListenUnix(ipPort.UnixSocket); err != nil {
+				fmt.Fprintf(os.Stderr, "Error listening on unix socket: %v\n", err)
+				logger.Error("Error listening on unix socket", zap.String("path", ipPort.UnixSocket), zap.Error(err))
+				os.Exit(1)
+			}
+		}
+		var certs *certReloader
 		if ipPort.CertFile != "" && ipPort.KeyFile != "" {
+			if certs, err = newCertReloader(ipPort.CertFile, ipPort.KeyFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading certificate: %v\n", err)
+				logger.Error("Error loading certificate", zap.Error(err))
+				os.Exit(1)
+			}
+		}
+		configIndex := i
+		handler := adminReloadHandler(server.GetHandler(config, metricsPrefix), config.GetDefault("admin", "admin_key", ""), certs, server, func() (conf.Config, error) {
+			configs, err := conf.LoadConfigs(configFile)
+			if err != nil {
+				return conf.Config{}, err
+			}
+			if len(configs) <= configIndex {
+				return conf.Config{}, fmt.Errorf("Config %d of %s no longer exists", configIndex, configFile)
+			}
+			return configs[configIndex], nil
+		}, logger)
+		var srv HummingbirdServer
+		if certs != nil {
 			tlsConf := &tls.Config{
 				PreferServerCipherSuites: true,
 				MinVersion:               tls.VersionTLS12,
+				GetCertificate:           certs.GetCertificate,
 			}
 			if server.Type() != "proxy" {
 				tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
 			}
 			httpServer := http.Server{
-				Handler:      server.GetHandler(config, metricsPrefix),
+				Handler:      handler,
 				ReadTimeout:  24 * time.Hour,
 				WriteTimeout: 24 * time.Hour,
 				TLSConfig:    tlsConf,
@@ -590,11 +660,15 @@ func RunServers(getServer func(conf.Config, *flag.FlagSet, ConfigLoader) (*IpPor
 				logger:   logger,
 				finalize: server.Finalize,
 			}
-			go srv.ServeTLS(sock, ipPort.CertFile, ipPort.KeyFile)
+			// The certificate comes from tlsConf.GetCertificate so that it can be reloaded.
+			go srv.ServeTLS(sock, "", "")
+			if unixSock != nil {
+				go srv.ServeTLS(unixSock, "", "")
+			}
 		} else {
 			srv = HummingbirdServer{
 				Server: &http.Server{
-					Handler:      server.GetHandler(config, metricsPrefix),
+					Handler:      handler,
 					ReadTimeout:  24 * time.Hour,
 					WriteTimeout: 24 * time.Hour,
 				},
@@ -602,6 +676,9 @@ func RunServers(getServer func(conf.Config, *flag.FlagSet, ConfigLoader) (*IpPor
 				finalize: server.Finalize,
 			}
 			go srv.Serve(sock)
+			if unixSock != nil {
+				go srv.Serve(unixSock)
+			}
 		}
 		ch := server.Background(flags)
 		if ch != nil {
@@ -615,7 +692,11 @@ func RunServers(getServer func(conf.Config, *flag.FlagSet, ConfigLoader) (*IpPor
 			}(ch)
 		}
 		servers = append(servers, &srv)
-		logger.Info("Server started", zap.Int("port", ipPort.Port))
+		if unixSock != nil {
+			logger.Info("Server started", zap.Int("port", ipPort.Port), zap.String("unixSocket", ipPort.UnixSocket))
+		} else {
+			logger.Info("Server started", zap.Int("port", ipPort.Port))
+		}
 	}
 
 	if wg != nil {
@@ -0,0 +1,155 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// workerEnv is set in the environment of worker processes to their number.
+const workerEnv = "HUMMINGBIRD_WORKER"
+
+// workerUnixSocketFd is the descriptor a worker inherits the supervisor's
+// Unix domain socket listener on.
+const workerUnixSocketFd = 3
+
+// workerRestartDelay is how long the supervisor waits before replacing a
+// worker that exited on its own, so one that can't start doesn't spin.
+var workerRestartDelay = time.Second
+
+// IsWorker reports whether this process is a worker started by a supervisor.
+func IsWorker() bool {
+	return os.Getenv(workerEnv) != ""
+}
+
+// RetryListenReusePort is RetryListen with SO_REUSEPORT set, so that every
+// worker can have its own listening socket on the same port and the kernel
+// spreads new connections across them.
+func RetryListenReusePort(ip string, port int) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var serr error
+			if err := c.Control(func(fd uintptr) {
+				serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			}); err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+	address := fmt.Sprintf("%s:%d", ip, port)
+	started := time.Now()
+	for {
+		if sock, err := lc.Listen(context.Background(), "tcp", address); err == nil {
+			return sock, nil
+		} else if time.Now().Sub(started) > 10*time.Second {
+			return nil, fmt.Errorf("Failed to bind for 10 seconds (%v)", err)
+		}
+		time.Sleep(time.Second / 5)
+	}
+}
+
+// inheritedUnixListener returns the Unix domain socket listener a worker's
+// supervisor passed it.
+func inheritedUnixListener() (net.Listener, error) {
+	return net.FileListener(os.NewFile(workerUnixSocketFd, "unix socket"))
+}
+
+// superviseWorkers runs workers copies of this command as worker processes
+// and replaces any that exit, until it gets a signal to stop, which it passes
+// on to the workers before waiting for them to finish.  Unix domain sockets
+// can't be shared with SO_REUSEPORT, so the supervisor listens on the
+// server's and the workers all accept from that one socket.
+func superviseWorkers(ipPort *IpPort, workers int, logger LowLevelLogger) {
+	var unixFile *os.File
+	if ipPort.UnixSocket != "" {
+		sock, err := RetryListenUnix(ipPort.UnixSocket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listening on unix socket: %v\n", err)
+			logger.Error("Error listening on unix socket", zap.String("path", ipPort.UnixSocket), zap.Error(err))
+			os.Exit(1)
+		}
+		if unixFile, err = sock.(*net.UnixListener).File(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sharing unix socket: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT)
+	exited := make(chan int, workers)
+	procs := make([]*exec.Cmd, workers)
+	start := func(i int) bool {
+		cmd := exec.Command(os.Args[0], os.Args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", workerEnv, i+1))
+		if unixFile != nil {
+			cmd.ExtraFiles = []*os.File{unixFile}
+		}
+		if err := cmd.Start(); err != nil {
+			logger.Error("Error starting worker", zap.Int("worker", i+1), zap.Error(err))
+			return false
+		}
+		procs[i] = cmd
+		go func() {
+			cmd.Wait()
+			exited <- i
+		}()
+		return true
+	}
+	running := 0
+	for i := 0; i < workers; i++ {
+		if start(i) {
+			running++
+		}
+	}
+	logger.Info("Workers started", zap.Int("port", ipPort.Port), zap.Int("workers", running))
+	stopping := false
+	for running > 0 {
+		select {
+		case s := <-sigs:
+			stopping = true
+			for _, cmd := range procs {
+				if cmd != nil {
+					cmd.Process.Signal(s)
+				}
+			}
+		case i := <-exited:
+			running--
+			procs[i] = nil
+			if stopping {
+				continue
+			}
+			logger.Error("Worker exited, restarting it", zap.Int("worker", i+1))
+			time.Sleep(workerRestartDelay)
+			if start(i) {
+				running++
+			}
+		}
+	}
+	if ipPort.UnixSocket != "" {
+		os.Remove(ipPort.UnixSocket)
+	}
+}
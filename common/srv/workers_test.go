@@ -0,0 +1,34 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package srv
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryListenReusePort(t *testing.T) {
+	first, err := RetryListenReusePort("127.0.0.1", 0)
+	require.Nil(t, err)
+	defer first.Close()
+	port := first.Addr().(*net.TCPAddr).Port
+	second, err := RetryListenReusePort("127.0.0.1", port)
+	require.Nil(t, err)
+	defer second.Close()
+	require.Equal(t, first.Addr().String(), second.Addr().String())
+}
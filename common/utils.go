@@ -138,17 +138,59 @@ func GetTimestamp() string {
 	return CanonicalTimestampFromTime(time.Now())
 }
 
-func FormatLastModified(lastModified time.Time) string {
-	if lastModified.Nanosecond() > 0 { // for some reason, Last-Modified is ceil(X-Timestamp)
-		lastModified = lastModified.Truncate(time.Second).Add(time.Second)
+// LastModified rounds a timestamp up to the whole second that Last-Modified
+// headers show for it, so conditional requests compare against what clients
+// were actually sent.
+func LastModified(timestamp time.Time) time.Time {
+	if timestamp.Nanosecond() > 0 { // for some reason, Last-Modified is ceil(X-Timestamp)
+		timestamp = timestamp.Truncate(time.Second).Add(time.Second)
 	}
-	return lastModified.In(GMT).Format(time.RFC1123)
+	return timestamp
+}
+
+func FormatLastModified(lastModified time.Time) string {
+	return LastModified(lastModified).In(GMT).Format(time.RFC1123)
 }
 
 func GetTransactionId() string {
 	return fmt.Sprintf("tx%012x%09x-%x", rand.Int63n(0xffffffffffff), rand.Int63n(0xfffffffff), time.Now().UnixNano())
 }
 
+// TransactionIdExtra returns the suffix a client's X-Trans-Id-Extra adds to
+// its request's transaction id, so it can find its requests in our logs.
+func TransactionIdExtra(extra string) string {
+	if extra == "" {
+		return ""
+	}
+	if len(extra) > 32 {
+		extra = extra[:32]
+	}
+	return "-" + Urlencode(extra)
+}
+
+// ParseTraceparent returns the trace id of a W3C Trace Context traceparent
+// header, like "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+// and whether the header is valid.
+func ParseTraceparent(traceparent string) (string, bool) {
+	if len(traceparent) < 55 || (len(traceparent) > 55 && traceparent[55] != '-') {
+		return "", false
+	}
+	parts := strings.Split(traceparent[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false
+	}
+	for _, part := range parts {
+		if strings.Trim(part, "0123456789abcdef") != "" {
+			return "", false
+		}
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(traceparent) != 55) ||
+		strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
 func HeaderGetDefault(h http.Header, key string, dfl string) string {
 	val := h.Get(key)
 	if val == "" {
@@ -516,6 +558,19 @@ func ParseIfMatch(s string) map[string]bool {
 	return r
 }
 
+// ParseIfNoneMatch is ParseIfMatch for If-None-Match, which compares etags
+// weakly, so W/"etag" matches the strong "etag" we send.
+func ParseIfNoneMatch(s string) map[string]bool {
+	r := make(map[string]bool)
+	for etag := range ParseIfMatch(s) {
+		if strings.HasPrefix(etag, "W/") {
+			etag = strings.Trim(etag[2:], "\"")
+		}
+		r[etag] = true
+	}
+	return r
+}
+
 func FileMD5(files ...string) (map[string]string, error) {
 	response := make(map[string]string)
 	for _, file := range files {
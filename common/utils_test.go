@@ -133,6 +133,23 @@ func TestParseDate(t *testing.T) {
 
 }
 
+func TestFormatLastModified(t *testing.T) {
+	ts, err := ParseDate("1136214245.1234")
+	require.Nil(t, err)
+	require.Equal(t, int64(1136214246), LastModified(ts).Unix())
+	require.Equal(t, "Mon, 02 Jan 2006 15:04:06 GMT", FormatLastModified(ts))
+	ts, err = ParseDate("1136214245")
+	require.Nil(t, err)
+	require.Equal(t, ts, LastModified(ts))
+	require.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", FormatLastModified(ts))
+}
+
+func TestParseIfNoneMatch(t *testing.T) {
+	require.Equal(t, map[string]bool{"a": true, "b": true, "*": true}, ParseIfNoneMatch(`W/"a", "b", *`))
+	require.Equal(t, map[string]bool{"W/\"a\"": true}, ParseIfMatch(`W/"a"`))
+	require.Empty(t, ParseIfNoneMatch(""))
+}
+
 func TestStandardizeTimestamp(t *testing.T) {
 	//Setup tests with individual data
 	tests := []struct {
@@ -339,3 +356,29 @@ func TestGetTransactionId(t *testing.T) {
 	require.Nil(t, err)
 	require.True(t, matched)
 }
+
+func TestTransactionIdExtra(t *testing.T) {
+	require.Equal(t, "", TransactionIdExtra(""))
+	require.Equal(t, "-my%20app", TransactionIdExtra("my app"))
+	require.Equal(t, "-"+strings.Repeat("x", 32), TransactionIdExtra(strings.Repeat("x", 40)))
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceId, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceId)
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	require.True(t, ok)
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		_, ok = ParseTraceparent(bad)
+		require.False(t, ok, bad)
+	}
+}
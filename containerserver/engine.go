@@ -20,21 +20,25 @@ import (
 	"crypto/md5"
 	"encoding/xml"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/fs"
 )
 
 var (
 	// ErrorNoSuchContainer is returned when a requested container doesn't exist.
-	ErrorNoSuchContainer = fmt.Errorf("No such container.")
+	ErrorNoSuchContainer error = &common.BackendError{StatusCode: http.StatusNotFound, Message: "No such container."}
 	// ErrorInvalidMetadata is returned for errors that violate the API metadata constraints.
-	ErrorInvalidMetadata = fmt.Errorf("Invalid metadata value")
+	ErrorInvalidMetadata error = &common.BackendError{StatusCode: http.StatusBadRequest, Message: "Invalid metadata value"}
 	// ErrorPolicyConflict is returned when an operation conflicts with the container's existing policy.
-	ErrorPolicyConflict = fmt.Errorf("Policy conflicts with existing value")
+	ErrorPolicyConflict error = &common.BackendError{StatusCode: http.StatusConflict, Message: "Policy conflicts with existing value"}
+	// ErrorDeletedLater is returned when a container is put with a timestamp older than its deletion.
+	ErrorDeletedLater error = &common.BackendError{StatusCode: http.StatusConflict, Message: "Container was deleted later"}
 )
 
 // ContainerInfo represents the container_info database record - basic information about the container.
@@ -74,6 +78,8 @@ type ObjectListingRecord struct {
 	Size         int64    `xml:"bytes" json:"bytes"`
 	ContentType  string   `xml:"content_type" json:"content_type"`
 	ETag         string   `xml:"hash" json:"hash"`
+	// Tags are only included in json listings.
+	Tags map[string]string `xml:"-" json:"tags,omitempty"`
 }
 
 // SubdirListingRecord is the struct used for serializing subdirs in json and xml container listings.
@@ -94,6 +100,32 @@ type ObjectRecord struct {
 	Deleted            int     `json:"deleted"`
 	StoragePolicyIndex int     `json:"storage_policy_index"`
 	Expires            *string `json:"expires"`
+	Tags               *string `json:"tags,omitempty"`
+	IndexedMeta        *string `json:"indexed_meta,omitempty"`
+}
+
+// ListOptions are what a Container's object listing is limited to and how
+// it's rolled up.
+type ListOptions struct {
+	Limit     int
+	Marker    string
+	EndMarker string
+	Prefix    string
+	Delimiter string
+	// Path is a pointer because behavior is different for empty and missing
+	// path query parameters.
+	Path               *string
+	Reverse            bool
+	StoragePolicyIndex int
+	// Depth rolls names up into subdirs at the Depth-th delimiter after the
+	// prefix rather than the first.  Zero is the same as one.
+	Depth int
+	// Tags limits the listing to objects having all of the given tags.  A
+	// tag with an empty value matches any value.
+	Tags map[string]string
+	// Meta limits the listing to objects whose indexed metadata match all of
+	// it.  A key with an empty value matches any value.
+	Meta map[string]string
 }
 
 // SyncRecord represents a row in the incoming_sync table.  It is used by replication.
@@ -111,13 +143,14 @@ type Container interface {
 	// Delete deletes the container.
 	Delete(timestamp string) error
 	// ListObjects lists the container's object entries.
-	ListObjects(limit int, marker string, endMarker string, prefix string, delimiter string, path *string, reverse bool, storagePolicyIndex int) ([]interface{}, error)
+	ListObjects(opts ListOptions) ([]interface{}, error)
 	// GetMetadata returns the container's current metadata.
 	GetMetadata() (map[string]string, error)
 	// UpdateMetadata applies updates to the container's metadata.
 	UpdateMetadata(updates map[string][]string, timestamp string) error
-	// PutObject adds a new object to the container.
-	PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string) error
+	// PutObject adds a new object to the container.  Tags and indexedMeta are
+	// url query encoded, or empty for none.
+	PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string, tags string, indexedMeta string) error
 	// DeleteObject deletes an object from the container.
 	DeleteObject(name string, timestamp string, storagePolicyIndex int) error
 	// ID returns a unique identifier for the container.
@@ -151,6 +184,8 @@ type ReplicableContainer interface {
 	CheckSyncLink() error
 	// RingHash returns the container's ring hash.
 	RingHash() string
+	// Audit checks the database for corruption, quarantining it if it finds any, and for negative stats.
+	Audit() error
 	// Reported records the information as having been reported to an account database.
 	Reported(putTimestamp, deleteTimestamp string, objectCount, bytesUsed int64) error
 }
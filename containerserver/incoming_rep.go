@@ -25,6 +25,7 @@ import (
 
 	"github.com/troubling/hummingbird/common/fs"
 	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/middleware"
 	"go.uber.org/zap"
 )
 
@@ -77,6 +78,11 @@ func (server *ContainerServer) ContainerTmpUploadHandler(writer http.ResponseWri
 // ContainerReplicateHandler handles the REPLICATE call for containers.
 func (server *ContainerServer) ContainerReplicateHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := srv.GetVars(request)
+	// replication to a node in maintenance waits until it's back
+	if middleware.InMaintenance(server.reconCachePath) {
+		srv.StandardResponse(writer, http.StatusServiceUnavailable)
+		return
+	}
 	// make sure there's a tmp dir to rsync to
 	if err := os.MkdirAll(filepath.Join(server.driveRoot, vars["device"], "tmp"), 0777); err != nil {
 		srv.StandardResponse(writer, http.StatusInternalServerError)
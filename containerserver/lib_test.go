@@ -129,7 +129,7 @@ func (f fakeDatabase) IsDeleted() (bool, error) {
 func (f fakeDatabase) Delete(timestamp string) error {
 	return errors.New("")
 }
-func (f fakeDatabase) ListObjects(limit int, marker string, endMarker string, prefix string, delimiter string, path *string, reverse bool, storagePolicyIndex int) ([]interface{}, error) {
+func (f fakeDatabase) ListObjects(opts ListOptions) ([]interface{}, error) {
 	return nil, errors.New("")
 }
 func (f fakeDatabase) GetMetadata() (map[string]string, error) {
@@ -174,7 +174,10 @@ func (f fakeDatabase) CleanupTombstones(reclaimAge int64) error {
 func (f fakeDatabase) CheckSyncLink() error {
 	return errors.New("")
 }
-func (f fakeDatabase) PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string) error {
+func (f fakeDatabase) Audit() error {
+	return errors.New("")
+}
+func (f fakeDatabase) PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string, tags string, indexedMeta string) error {
 	return errors.New("")
 }
 func (f fakeDatabase) DeleteObject(name string, timestamp string, storagePolicyIndex int) error {
@@ -32,6 +32,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/conf"
 	"github.com/troubling/hummingbird/common/fs"
 	"github.com/troubling/hummingbird/common/ring"
@@ -220,7 +221,7 @@ func TestReplicatorSyncUnmounted(t *testing.T) {
 	defer cleanup()
 	rd := newTestReplicationDevice(&ring.Device{}, &Replicator{client: http.DefaultClient})
 	_, err := rd.sync(dev, 1, "00000000000000000000000000000000", &ContainerInfo{})
-	require.Equal(t, err, errDeviceNotMounted)
+	require.Equal(t, err, common.ErrDiskUnmounted)
 }
 
 func TestReplicatorRsync(t *testing.T) {
@@ -706,7 +707,7 @@ func TestReplicateSyncOnMessageError(t *testing.T) {
 	}
 	rinfo, err = rd.sync(&ring.Device{}, 1, "SOMEHASH", &ContainerInfo{})
 	require.Nil(t, rinfo)
-	require.Equal(t, err, errDeviceNotMounted)
+	require.Equal(t, err, common.ErrDiskUnmounted)
 
 	rd._sendReplicationMessage = func(dev *ring.Device, part uint64, ringHash string, args ...interface{}) (int, []byte, error) {
 		return 500, []byte{}, nil
@@ -129,7 +129,9 @@ const (
 				etag TEXT,
 				deleted INTEGER DEFAULT 0,
 				storage_policy_index INTEGER DEFAULT 0,
-				expires INTEGER DEFAULT NULL
+				expires INTEGER DEFAULT NULL,
+				tags TEXT DEFAULT NULL,
+				indexed_meta TEXT DEFAULT NULL
 			);
 		CREATE INDEX ix_object_deleted_name ON object (deleted, name);
 		CREATE INDEX ix_object_expires ON object(expires) WHERE expires IS NOT NULL;
@@ -138,6 +140,23 @@ const (
 				SELECT RAISE(FAIL, 'UPDATE not allowed; DELETE and INSERT');
 			END;`
 
+	// object_meta is the secondary index on the metadata values objects are
+	// put with, for the keys the container's X-Container-Sysmeta-Indexed-Meta
+	// names.  Rows are added along with their object's row and, since object
+	// rows are only ever deleted and reinserted, removed by trigger.
+	objectMetaTableScript = `
+		CREATE TABLE object_meta (
+				object_rowid INTEGER,
+				key TEXT,
+				value TEXT
+			);
+		CREATE INDEX ix_object_meta_key_value ON object_meta (key, value, object_rowid);
+		CREATE INDEX ix_object_meta_rowid ON object_meta (object_rowid);
+		CREATE TRIGGER object_delete_meta AFTER DELETE ON object
+			BEGIN
+				DELETE FROM object_meta WHERE object_rowid = old.ROWID;
+			END;`
+
 	syncTableScript = `	
 		CREATE TABLE outgoing_sync (
 				remote_id TEXT UNIQUE,
@@ -197,7 +216,6 @@ const (
 
 	pragmaScript = `
 		PRAGMA synchronous = NORMAL;
-		PRAGMA cache_size = -4096;
 		PRAGMA temp_store = MEMORY;
 		PRAGMA journal_mode = WAL;
 		PRAGMA busy_timeout = 25000;`
@@ -207,6 +225,10 @@ const (
 	xExpireMigrateScript = `
 		ALTER TABLE object ADD COLUMN expires INTEGER DEFAULT NULL;
 		CREATE INDEX ix_object_expires ON object(expires) WHERE expires IS NOT NULL;`
+
+	tagsMigrateScript = "ALTER TABLE object ADD COLUMN tags TEXT DEFAULT NULL;"
+
+	indexedMetaMigrateScript = "ALTER TABLE object ADD COLUMN indexed_meta TEXT DEFAULT NULL;" + objectMetaTableScript
 )
 
 func schemaMigrate(db *sql.DB) (bool, error) {
@@ -215,6 +237,8 @@ func schemaMigrate(db *sql.DB) (bool, error) {
 	hasMetadata := false
 	hasPolicyStat := false
 	hasExpireColumn := false
+	hasTagsColumn := false
+	hasObjectMeta := false
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -223,7 +247,7 @@ func schemaMigrate(db *sql.DB) (bool, error) {
 	defer tx.Rollback()
 
 	// We just pull the schema out of sqlite_master and look at it to get the current state of the database.
-	rows, err := tx.Query("SELECT name, sql FROM sqlite_master WHERE name in ('policy_stat', 'ix_object_deleted_name', 'container_stat')")
+	rows, err := tx.Query("SELECT name, sql FROM sqlite_master WHERE name in ('policy_stat', 'ix_object_deleted_name', 'container_stat', 'ix_object_expires', 'object', 'object_meta')")
 	if err != nil {
 		return false, err
 	}
@@ -241,6 +265,10 @@ func schemaMigrate(db *sql.DB) (bool, error) {
 			hasMetadata = strings.Contains(sql, "metadata")
 		} else if name == "ix_object_expires" {
 			hasExpireColumn = true
+		} else if name == "object" {
+			hasTagsColumn = strings.Contains(sql, "tags")
+		} else if name == "object_meta" {
+			hasObjectMeta = true
 		}
 	}
 	if err := rows.Err(); err != nil {
@@ -250,7 +278,7 @@ func schemaMigrate(db *sql.DB) (bool, error) {
 		return hasDeletedNameIndex, err
 	}
 
-	if hasSyncPoints && hasMetadata && hasPolicyStat {
+	if hasSyncPoints && hasMetadata && hasPolicyStat && hasExpireColumn && hasTagsColumn && hasObjectMeta {
 		return hasDeletedNameIndex, nil
 	}
 
@@ -274,5 +302,15 @@ func schemaMigrate(db *sql.DB) (bool, error) {
 			return hasDeletedNameIndex, fmt.Errorf("Performing expires migration: %v", err)
 		}
 	}
+	if !hasTagsColumn {
+		if _, err = tx.Exec(tagsMigrateScript); err != nil {
+			return hasDeletedNameIndex, fmt.Errorf("Adding tags column: %v", err)
+		}
+	}
+	if !hasObjectMeta {
+		if _, err = tx.Exec(indexedMetaMigrateScript); err != nil {
+			return hasDeletedNameIndex, fmt.Errorf("Adding metadata index: %v", err)
+		}
+	}
 	return hasDeletedNameIndex, tx.Commit()
 }
@@ -169,6 +169,7 @@ func TestMigrateCruftyDatabase(t *testing.T) {
 			require.True(t, columnNames[column])
 		}
 	}
-	ensureColumnsExist("object", []string{"storage_policy_index"})
+	ensureColumnsExist("object", []string{"storage_policy_index", "tags", "indexed_meta"})
+	ensureColumnsExist("object_meta", []string{"object_rowid", "key", "value"})
 	ensureColumnsExist("container_stat", []string{"metadata", "x_container_sync_point1", "x_container_sync_point2"})
 }
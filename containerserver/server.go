@@ -45,6 +45,10 @@ import (
 	"golang.org/x/net/http2"
 )
 
+// indexedMetaHeader is the container sysmeta naming the object metadata keys
+// the container indexes, comma separated.
+const indexedMetaHeader = "X-Container-Sysmeta-Indexed-Meta"
+
 // ContainerServer contains all of the information for a running container server.
 type ContainerServer struct {
 	driveRoot               string
@@ -54,6 +58,7 @@ type ContainerServer struct {
 	logger                  srv.LowLevelLogger
 	logLevel                zap.AtomicLevel
 	diskInUse               *common.KeyedLimit
+	lowPriorityInUse        *common.KeyedLimit
 	checkMounts             bool
 	containerEngine         ContainerEngine
 	updateClient            common.HTTPClient
@@ -92,10 +97,80 @@ func formatTimestamp(ts string) string {
 	return ret
 }
 
+var listingFields = map[string]bool{
+	"name":          true,
+	"hash":          true,
+	"bytes":         true,
+	"content_type":  true,
+	"last_modified": true,
+	"tags":          true,
+}
+
+// parseListingFields returns the set of fields named in a comma separated
+// fields parameter, or nil if none were asked for.
+func parseListingFields(fields string) (map[string]bool, error) {
+	if fields == "" {
+		return nil, nil
+	}
+	selected := map[string]bool{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if !listingFields[field] {
+			return nil, fmt.Errorf("Invalid listing field %q", field)
+		}
+		selected[field] = true
+	}
+	return selected, nil
+}
+
+// selectListingFields trims object records down to the selected fields for
+// json listings; subdirs are passed through untouched.
+func selectListingFields(objects []interface{}, fields map[string]bool) []interface{} {
+	selected := make([]interface{}, len(objects))
+	for i, obj := range objects {
+		or, ok := obj.(*ObjectListingRecord)
+		if !ok {
+			selected[i] = obj
+			continue
+		}
+		record := make(map[string]interface{}, len(fields))
+		if fields["name"] {
+			record["name"] = or.Name
+		}
+		if fields["hash"] {
+			record["hash"] = or.ETag
+		}
+		if fields["bytes"] {
+			record["bytes"] = or.Size
+		}
+		if fields["content_type"] {
+			record["content_type"] = or.ContentType
+		}
+		if fields["last_modified"] {
+			record["last_modified"] = or.LastModified
+		}
+		if fields["tags"] && len(or.Tags) > 0 {
+			record["tags"] = or.Tags
+		}
+		selected[i] = record
+	}
+	return selected
+}
+
 func (server *ContainerServer) Type() string {
 	return "container"
 }
 
+// Reload applies the settings that can be changed without a restart.
+func (server *ContainerServer) Reload(config conf.Config) ([]string, error) {
+	if changed, err := srv.ReloadLogLevel(server.logLevel, config, "app:container-server"); err != nil {
+		return nil, err
+	} else if changed {
+		return []string{"app:container-server/log_level"}, nil
+	}
+	return nil, nil
+}
+
 func (server *ContainerServer) Background(flags *flag.FlagSet) chan struct{} {
 	return nil
 }
@@ -120,7 +195,7 @@ func (server *ContainerServer) ContainerGetHandler(writer http.ResponseWriter, r
 		return
 	}
 	db, err := server.containerEngine.Get(vars)
-	if err == ErrorNoSuchContainer {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -211,7 +286,77 @@ func (server *ContainerServer) ContainerGetHandler(writer http.ResponseWriter, r
 		policyIndex = info.StoragePolicyIndex
 	}
 	reverse := common.LooksTrue(request.Form.Get("reverse"))
-	objects, err := db.ListObjects(int(limit), marker, endMarker, prefix, delimiter, path, reverse, policyIndex)
+	fields, err := parseListingFields(request.Form.Get("fields"))
+	if err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	depth := 1
+	if depthStr := request.Form.Get("depth"); depthStr != "" {
+		if depth, err = strconv.Atoi(depthStr); err != nil || depth < 1 {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid depth")
+			return
+		}
+	}
+	var objects []interface{}
+	var tags map[string]string
+	if tagParams, ok := request.Form["tag"]; ok {
+		// each tag filter is either "key:value" or just "key" to match any
+		// value; filters may be repeated or given as a comma separated list
+		tags = make(map[string]string, len(tagParams))
+		for _, tag := range strings.Split(strings.Join(tagParams, ","), ",") {
+			kv := strings.SplitN(tag, ":", 2)
+			if kv[0] == "" {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid tag filter")
+				return
+			}
+			if len(kv) == 2 {
+				tags[strings.ToLower(kv[0])] = kv[1]
+			} else {
+				tags[strings.ToLower(kv[0])] = ""
+			}
+		}
+	}
+	var meta map[string]string
+	if metaParams, ok := request.Form["meta"]; ok {
+		// meta filters take the same forms as tag filters, but only keys
+		// the container indexes can be used
+		indexed := map[string]bool{}
+		for _, key := range strings.Split(metadata[indexedMetaHeader], ",") {
+			indexed[strings.ToLower(strings.TrimSpace(key))] = true
+		}
+		meta = make(map[string]string, len(metaParams))
+		for _, filter := range strings.Split(strings.Join(metaParams, ","), ",") {
+			kv := strings.SplitN(filter, ":", 2)
+			key := strings.ToLower(kv[0])
+			if key == "" {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid meta filter")
+				return
+			}
+			if !indexed[key] {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Metadata key %q is not indexed", key))
+				return
+			}
+			if len(kv) == 2 {
+				meta[key] = kv[1]
+			} else {
+				meta[key] = ""
+			}
+		}
+	}
+	objects, err = db.ListObjects(ListOptions{
+		Limit:              int(limit),
+		Marker:             marker,
+		EndMarker:          endMarker,
+		Prefix:             prefix,
+		Delimiter:          delimiter,
+		Path:               path,
+		Reverse:            reverse,
+		StoragePolicyIndex: policyIndex,
+		Depth:              depth,
+		Tags:               tags,
+		Meta:               meta,
+	})
 	if err != nil {
 		srv.GetLogger(request).Error("Unable to list objects.", zap.Error(err))
 		srv.StandardResponse(writer, http.StatusInternalServerError)
@@ -248,6 +393,9 @@ func (server *ContainerServer) ContainerGetHandler(writer http.ResponseWriter, r
 			writer.Write([]byte(""))
 		}
 	} else if format == "json" {
+		if fields != nil {
+			objects = selectListingFields(objects, fields)
+		}
 		output, err := json.Marshal(objects)
 		if err != nil {
 			srv.StandardResponse(writer, http.StatusInternalServerError)
@@ -302,7 +450,7 @@ func (server *ContainerServer) ContainerPutHandler(writer http.ResponseWriter, r
 		}
 	}
 	created, db, err := server.containerEngine.Create(vars, timestamp, metadata, policyIndex, defaultPolicyIndex)
-	if err == ErrorPolicyConflict {
+	if common.IsConflict(err) {
 		srv.StandardResponse(writer, http.StatusConflict)
 		return
 	} else if err != nil {
@@ -329,7 +477,7 @@ func (server *ContainerServer) ContainerPutHandler(writer http.ResponseWriter, r
 func (server *ContainerServer) ContainerDeleteHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := srv.GetVars(request)
 	db, err := server.containerEngine.Get(vars)
-	if err == ErrorNoSuchContainer {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -363,13 +511,17 @@ func (server *ContainerServer) ContainerDeleteHandler(writer http.ResponseWriter
 		return
 	}
 	info, err = db.GetInfo()
-	if err == nil {
-		server.accountUpdate(writer, request, vars, info, srv.GetLogger(request))
-	} else {
+	if err != nil {
 		srv.GetLogger(request).Error("could not GetInfo on cont delete.", zap.Error(err))
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
+	if info.DeleteTimestamp <= info.PutTimestamp {
+		// the container was put again after this delete
+		srv.StandardResponse(writer, http.StatusConflict)
+		return
+	}
+	server.accountUpdate(writer, request, vars, info, srv.GetLogger(request))
 	writer.WriteHeader(http.StatusNoContent)
 	writer.Write([]byte(""))
 }
@@ -395,7 +547,7 @@ func (server *ContainerServer) ContainerPostHandler(writer http.ResponseWriter,
 		}
 	}
 	db, err := server.containerEngine.Get(vars)
-	if err == ErrorNoSuchContainer {
+	if common.IsNotFound(err) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -442,7 +594,7 @@ func (server *ContainerServer) ObjPutHandler(writer http.ResponseWriter, request
 		policyIndex = 0
 	}
 	db, err := server.containerEngine.Get(vars)
-	if err == ErrorNoSuchContainer {
+	if common.IsNotFound(err) {
 		if strings.HasPrefix(vars["account"], server.autoCreatePrefix) {
 			if _, db, err = server.containerEngine.Create(vars, timestamp, map[string][]string{}, policyIndex, 0); err != nil {
 				srv.GetLogger(request).Error("Unable to auto-create container.", zap.Error(err))
@@ -460,7 +612,9 @@ func (server *ContainerServer) ObjPutHandler(writer http.ResponseWriter, request
 	}
 	defer server.containerEngine.Return(db)
 	expires := request.Header.Get("X-Delete-At")
-	if err := db.PutObject(vars["obj"], timestamp, size, contentType, etag, policyIndex, expires); err != nil {
+	tags := request.Header.Get("X-Object-Tags")
+	indexedMeta := request.Header.Get("X-Object-Indexed-Meta")
+	if err := db.PutObject(vars["obj"], timestamp, size, contentType, etag, policyIndex, expires, tags, indexedMeta); err != nil {
 		srv.GetLogger(request).Error("Error adding object to container.", zap.Error(err))
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
@@ -481,7 +635,7 @@ func (server *ContainerServer) ObjDeleteHandler(writer http.ResponseWriter, requ
 		policyIndex = 0
 	}
 	db, err := server.containerEngine.Get(vars)
-	if err == ErrorNoSuchContainer {
+	if common.IsNotFound(err) {
 		if strings.HasPrefix(vars["account"], server.autoCreatePrefix) {
 			if _, db, err = server.containerEngine.Create(vars, timestamp, map[string][]string{}, policyIndex, 0); err != nil {
 				srv.GetLogger(request).Error("Unable to auto-create container.", zap.Error(err))
@@ -509,6 +663,9 @@ func (server *ContainerServer) ObjDeleteHandler(writer http.ResponseWriter, requ
 
 // HealthcheckHandler implements a basic health check, that just returns "OK".
 func (server *ContainerServer) HealthcheckHandler(writer http.ResponseWriter, request *http.Request) {
+	if middleware.InMaintenance(server.reconCachePath) {
+		writer.Header().Set(middleware.MaintenanceHeader, "true")
+	}
 	writer.Header().Set("Content-Length", "2")
 	writer.WriteHeader(http.StatusOK)
 	writer.Write([]byte("OK"))
@@ -519,6 +676,11 @@ func (server *ContainerServer) ReconHandler(writer http.ResponseWriter, request
 	middleware.ReconHandler(server.driveRoot, server.reconCachePath, server.checkMounts, writer, request)
 }
 
+// MaintenanceHandler delegates incoming /maintenance calls to the common maintenance handler.
+func (server *ContainerServer) MaintenanceHandler(writer http.ResponseWriter, request *http.Request) {
+	middleware.MaintenanceHandler(server.reconCachePath, writer, request)
+}
+
 //OptionsHandler delegates incoming OPTIONS calls to the common options handler.
 func (server *ContainerServer) OptionsHandler(writer http.ResponseWriter, request *http.Request) {
 	middleware.OptionsHandler("container-server", writer, request)
@@ -562,6 +724,15 @@ func (server *ContainerServer) AcquireDevice(next http.Handler) http.Handler {
 				return
 			}
 			defer server.diskInUse.Release(device)
+
+			if server.lowPriorityInUse != nil && common.IsLowPriority(request) {
+				if concRequests := server.lowPriorityInUse.Acquire(device, forceAcquire); concRequests != 0 {
+					writer.Header().Set("X-Disk-Usage", strconv.FormatInt(concRequests, 10))
+					srv.StandardResponse(writer, 503)
+					return
+				}
+				defer server.lowPriorityInUse.Release(device)
+			}
 		}
 		next.ServeHTTP(writer, request)
 	}
@@ -610,6 +781,9 @@ func (server *ContainerServer) GetHandler(config conf.Config, metricsPrefix stri
 	router.Post("/debug/pprof/:parm", http.DefaultServeMux)
 	router.Get("/recon/:method/:recon_type", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Get("/recon/:method", commonHandlers.ThenFunc(server.ReconHandler))
+	router.Get("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Put("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Delete("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
 	router.Delete("/recon/:device/:method/:recon_type/*item_path", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Put("/:device/tmp/:filename", commonHandlers.ThenFunc(server.ContainerTmpUploadHandler))
 	router.Put("/:device/:partition/:account/:container/*obj", commonHandlers.ThenFunc(server.ObjPutHandler))
@@ -658,7 +832,13 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 	if server.logger, err = srv.SetupLogger("container-server", &server.logLevel, flags); err != nil {
 		return ipPort, nil, nil, fmt.Errorf("Error setting up logger: %v", err)
 	}
-	server.diskInUse = common.NewKeyedLimit(serverconf.GetLimit("app:container-server", "disk_limit", 0, 0))
+	diskLimit, diskTotalLimit := serverconf.GetLimit("app:container-server", "disk_limit", 0, 0)
+	server.diskInUse = common.NewKeyedLimit(diskLimit, diskTotalLimit)
+	if server.lowPriorityInUse, err = common.NewLowPriorityLimit(serverconf.GetInt("app:container-server", "low_priority_share", 0), diskLimit); err != nil {
+		return ipPort, nil, nil, err
+	}
+	dbCacheSize = serverconf.GetInt("app:container-server", "db_cache_size", 4096)
+	dbMmapSize = serverconf.GetInt("app:container-server", "db_mmap_size", 0)
 	bindIP := serverconf.GetDefault("app:container-server", "bind_ip", "0.0.0.0")
 	bindPort := int(serverconf.GetInt("app:container-server", "bind_port", common.DefaultContainerServerPort))
 	certFile := serverconf.GetDefault("app:container-server", "cert_file", "")
@@ -366,6 +366,59 @@ func TestContainerPutObjectsGet(t *testing.T) {
 	// TODO parse and validate xml.  or maybe we won't do that.
 }
 
+func TestContainerGetFields(t *testing.T) {
+	handler, cleanup, err := makeTestServer()
+	require.Nil(t, err)
+	defer cleanup()
+
+	rsp := test.MakeCaptureResponse()
+	req, err := http.NewRequest("PUT", "/device/1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Timestamp", "100000000.00001")
+	req.Header.Set("X-Backend-Storage-Policy-Index", "0")
+	handler.ServeHTTP(rsp, req)
+	require.Equal(t, 201, rsp.Status)
+
+	for _, object := range []string{"a", "d/b"} {
+		rsp := test.MakeCaptureResponse()
+		req, err := http.NewRequest("PUT", "/device/1/a/c/"+object, nil)
+		require.Nil(t, err)
+		req.Header.Set("X-Timestamp", common.GetTimestamp())
+		req.Header.Set("X-Content-Type", "application/octet-stream")
+		req.Header.Set("X-Size", "2")
+		req.Header.Set("X-Etag", "d41d8cd98f00b204e9800998ecf8427e")
+		handler.ServeHTTP(rsp, req)
+		require.Equal(t, 201, rsp.Status)
+	}
+
+	rsp = test.MakeCaptureResponse()
+	req, err = http.NewRequest("GET", "/device/1/a/c?format=json&fields=name,bytes", nil)
+	require.Nil(t, err)
+	handler.ServeHTTP(rsp, req)
+	require.Equal(t, 200, rsp.Status)
+	var data []map[string]interface{}
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), &data))
+	require.Equal(t, []map[string]interface{}{
+		{"name": "a", "bytes": float64(2)},
+		{"name": "d/b", "bytes": float64(2)},
+	}, data)
+
+	rsp = test.MakeCaptureResponse()
+	req, err = http.NewRequest("GET", "/device/1/a/c?format=json&fields=name&delimiter=/", nil)
+	require.Nil(t, err)
+	handler.ServeHTTP(rsp, req)
+	require.Equal(t, 200, rsp.Status)
+	data = nil
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), &data))
+	require.Equal(t, []map[string]interface{}{{"name": "a"}, {"subdir": "d/"}}, data)
+
+	rsp = test.MakeCaptureResponse()
+	req, err = http.NewRequest("GET", "/device/1/a/c?format=json&fields=name,size", nil)
+	require.Nil(t, err)
+	handler.ServeHTTP(rsp, req)
+	require.Equal(t, 400, rsp.Status)
+}
+
 func TestContainerPutObjectsFails(t *testing.T) {
 	server, handler, cleanup, err := makeTestServer2()
 	require.Nil(t, err)
@@ -560,7 +613,7 @@ func TestContainerDelete(t *testing.T) {
 	require.Nil(t, err)
 	req.Header.Set("X-Timestamp", common.CanonicalTimestamp(1))
 	handler.ServeHTTP(rsp, req)
-	require.Equal(t, 204, rsp.Status)
+	require.Equal(t, 409, rsp.Status)
 
 	rsp = test.MakeCaptureResponse()
 	req, err = http.NewRequest("HEAD", "/device/1/a/c", nil)
@@ -26,6 +26,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -68,6 +69,14 @@ func chexor(old, name, timestamp string) string {
 	return hex.EncodeToString(digest)
 }
 
+// dbCacheSize (in KiB) and dbMmapSize (in bytes) size the page cache and
+// memory mapped I/O of each database connection; they're set from the
+// server's config before any databases are opened.
+var (
+	dbCacheSize int64 = 4096
+	dbMmapSize  int64
+)
+
 func init() {
 	// register our sql driver with user-defined chexor function
 	sql.Register("sqlite3_hummingbird",
@@ -79,6 +88,9 @@ func init() {
 				if _, err := conn.Exec(pragmaScript, nil); err != nil {
 					return err
 				}
+				if _, err := conn.Exec(fmt.Sprintf("PRAGMA cache_size = -%d; PRAGMA mmap_size = %d;", dbCacheSize, dbMmapSize), nil); err != nil {
+					return err
+				}
 				if _, err := conn.Exec(`CREATE TEMPORARY VIEW IF NOT EXISTS maxrowid (max) AS
 				  						SELECT IFNULL(MAX(seq), -1) FROM sqlite_sequence WHERE name='object'`, nil); err != nil {
 					return err
@@ -190,7 +202,8 @@ func (db *sqliteContainer) Remove() error {
 }
 
 // Delete sets the container's deleted timestamp and tombstones any metadata older than that timestamp.
-// This may or may not make the container "deleted".
+// This may or may not make the container "deleted": it won't if the container was put again since, and
+// the deleted timestamp is only ever moved forward.  If it does, the status_changed_at is set to timestamp.
 func (db *sqliteContainer) Delete(timestamp string) error {
 	if err := db.connect(); err != nil {
 		return err
@@ -200,9 +213,9 @@ func (db *sqliteContainer) Delete(timestamp string) error {
 		return err
 	}
 	defer tx.Rollback()
-	var metastr string
+	var metastr, putTimestamp, deleteTimestamp, statusChangedAt string
 	var metadata map[string][]string
-	if err := tx.QueryRow("SELECT metadata FROM container_info").Scan(&metastr); err != nil {
+	if err := tx.QueryRow("SELECT metadata, put_timestamp, delete_timestamp, status_changed_at FROM container_info").Scan(&metastr, &putTimestamp, &deleteTimestamp, &statusChangedAt); err != nil {
 		if common.IsCorruptDBError(err) {
 			return fmt.Errorf("Failed to Delete SELECT: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 		}
@@ -220,7 +233,13 @@ func (db *sqliteContainer) Delete(timestamp string) error {
 	if err != nil {
 		return err
 	}
-	if _, err = tx.Exec("UPDATE container_info SET delete_timestamp = ?, metadata = ?", timestamp, string(serializedMetadata)); err != nil {
+	if timestamp > deleteTimestamp {
+		if deleteTimestamp <= putTimestamp && timestamp > putTimestamp {
+			statusChangedAt = timestamp
+		}
+		deleteTimestamp = timestamp
+	}
+	if _, err = tx.Exec("UPDATE container_info SET delete_timestamp = ?, status_changed_at = ?, metadata = ?", deleteTimestamp, statusChangedAt, string(serializedMetadata)); err != nil {
 		if common.IsCorruptDBError(err) {
 			return fmt.Errorf("Failed to Delete UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 		}
@@ -309,12 +328,18 @@ func (db *sqliteContainer) MergeItems(records []*ObjectRecord, remoteID string)
 	}
 	defer dst.Close()
 
-	ast, err := tx.Prepare("INSERT INTO object (name, created_at, size, content_type, etag, deleted, storage_policy_index, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	ast, err := tx.Prepare("INSERT INTO object (name, created_at, size, content_type, etag, deleted, storage_policy_index, expires, tags, indexed_meta) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
 	}
 	defer ast.Close()
 
+	mst, err := tx.Prepare("INSERT INTO object_meta (object_rowid, key, value) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer mst.Close()
+
 	var maxRowid int64 = -1
 	for _, record := range records {
 		if record.Rowid > maxRowid {
@@ -339,12 +364,28 @@ func (db *sqliteContainer) MergeItems(records []*ObjectRecord, remoteID string)
 	}
 
 	for _, record := range toAdd {
-		if _, err := ast.Exec(record.Name, record.CreatedAt, record.Size, record.ContentType, record.ETag, record.Deleted, record.StoragePolicyIndex, record.Expires); err != nil {
+		result, err := ast.Exec(record.Name, record.CreatedAt, record.Size, record.ContentType, record.ETag, record.Deleted, record.StoragePolicyIndex, record.Expires, record.Tags, record.IndexedMeta)
+		if err != nil {
 			if common.IsCorruptDBError(err) {
 				return fmt.Errorf("Failed to MergeItems INSERT: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 			}
 			return err
 		}
+		if record.IndexedMeta == nil || record.Deleted != 0 {
+			continue
+		}
+		rowid, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for key, value := range decodeTags(sql.NullString{String: *record.IndexedMeta, Valid: true}) {
+			if _, err := mst.Exec(rowid, key, value); err != nil {
+				if common.IsCorruptDBError(err) {
+					return fmt.Errorf("Failed to MergeItems INSERT meta: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
+				}
+				return err
+			}
+		}
 	}
 
 	if remoteID != "" && maxRowid > -1 {
@@ -376,6 +417,18 @@ func indexAfter(s, sep string, after int) int {
 	return index + after
 }
 
+// indexAfterN returns the index of the nth sep in s after the given index, or
+// -1 if there aren't that many.
+func indexAfterN(s, sep string, after, n int) int {
+	index := after - len(sep)
+	for ; n > 0; n-- {
+		if index = indexAfter(s, sep, index+len(sep)); index == -1 {
+			return -1
+		}
+	}
+	return index
+}
+
 func updateRecord(rec *ObjectListingRecord) error {
 	f, err := strconv.ParseFloat(rec.LastModified, 64)
 	if err != nil {
@@ -389,12 +442,77 @@ func updateRecord(rec *ObjectListingRecord) error {
 	return err
 }
 
-// ListObjects implements object listings.  Path is a string pointer because behavior is different for empty and missing path query parameters.
-func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker string, prefix string, delimiter string,
-	pth *string, reverse bool, storagePolicyIndex int) ([]interface{}, error) {
+// Object tags are stored in the tags column url query encoded with surrounding
+// ampersands, e.g. "&color=red&size=large&", so that a single tag can be found
+// with a GLOB on "*&color=red&*".  Query escaping never produces any of GLOB's
+// special characters, so the patterns need no escaping of their own.  Objects
+// with no tags have a NULL column.
+func encodeTags(tags string) (*string, error) {
+	if tags == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(tags)
+	if err != nil {
+		return nil, err
+	}
+	encoded := "&" + values.Encode() + "&"
+	return &encoded, nil
+}
+
+func decodeTags(tags sql.NullString) map[string]string {
+	if !tags.Valid {
+		return nil
+	}
+	values, err := url.ParseQuery(strings.Trim(tags.String, "&"))
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	decoded := make(map[string]string, len(values))
+	for k := range values {
+		decoded[k] = values.Get(k)
+	}
+	return decoded
+}
+
+func tagWheres(tags map[string]string) ([]string, []interface{}) {
+	wheres := []string{}
+	args := []interface{}{}
+	for k, v := range tags {
+		pattern := "*&" + url.QueryEscape(k) + "="
+		if v != "" {
+			pattern += url.QueryEscape(v) + "&"
+		}
+		wheres = append(wheres, "tags GLOB ?")
+		args = append(args, pattern+"*")
+	}
+	return wheres, args
+}
+
+// Indexed metadata is kept in the indexed_meta column in the same form as
+// tags, so it's carried along by replication, and in the object_meta table,
+// which is what listings are actually filtered with.
+func metaWheres(meta map[string]string) ([]string, []interface{}) {
+	wheres := []string{}
+	args := []interface{}{}
+	for k, v := range meta {
+		if v == "" {
+			wheres = append(wheres, "ROWID IN (SELECT object_rowid FROM object_meta WHERE key = ?)")
+			args = append(args, k)
+		} else {
+			wheres = append(wheres, "ROWID IN (SELECT object_rowid FROM object_meta WHERE key = ? AND value = ?)")
+			args = append(args, k, v)
+		}
+	}
+	return wheres, args
+}
+
+// ListObjects implements object listings.
+func (db *sqliteContainer) ListObjects(opts ListOptions) ([]interface{}, error) {
 	if err := db.connect(); err != nil {
 		return nil, err
 	}
+	limit, marker, endMarker, prefix, delimiter := opts.Limit, opts.Marker, opts.EndMarker, opts.Prefix, opts.Delimiter
+	pth, reverse, storagePolicyIndex, depth := opts.Path, opts.Reverse, opts.StoragePolicyIndex, opts.Depth
 	var point, pointDirection, queryTail, queryStart string
 
 	if pth != nil {
@@ -404,12 +522,20 @@ func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker strin
 		}
 		delimiter = "/"
 		prefix = *pth
+		depth = 1
+	}
+	if depth < 1 {
+		depth = 1
 	}
 	if db.hasDeletedNameIndex {
-		queryStart = "SELECT name, created_at, size, content_type, etag FROM object WHERE deleted = 0 AND"
+		queryStart = "SELECT name, created_at, size, content_type, etag, tags FROM object WHERE deleted = 0 AND"
 	} else {
-		queryStart = "SELECT name, created_at, size, content_type, etag FROM object WHERE +deleted = 0 AND"
+		queryStart = "SELECT name, created_at, size, content_type, etag, tags FROM object WHERE +deleted = 0 AND"
 	}
+	filters, filterArgs := tagWheres(opts.Tags)
+	metaFilters, metaArgs := metaWheres(opts.Meta)
+	filters = append(filters, metaFilters...)
+	filterArgs = append(filterArgs, metaArgs...)
 	if reverse {
 		marker, endMarker = endMarker, marker
 		queryTail = "ORDER BY name DESC LIMIT ?"
@@ -443,6 +569,8 @@ func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker strin
 			wheres = append(wheres, pointDirection)
 			queryArgs = append(queryArgs, point)
 		}
+		wheres = append(wheres, filters...)
+		queryArgs = append(queryArgs, filterArgs...)
 		rows, err := db.Query(queryStart+" "+strings.Join(wheres, " AND ")+" "+queryTail,
 			append(queryArgs, limit-len(results))...)
 		if err != nil {
@@ -455,7 +583,8 @@ func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker strin
 		for rows.Next() && len(results) < limit {
 			gotResults = true
 			record := &ObjectListingRecord{}
-			if err := rows.Scan(&record.Name, &record.LastModified, &record.Size, &record.ContentType, &record.ETag); err != nil {
+			var recordTags sql.NullString
+			if err := rows.Scan(&record.Name, &record.LastModified, &record.Size, &record.ContentType, &record.ETag, &recordTags); err != nil {
 				if common.IsCorruptDBError(err) {
 					return nil, fmt.Errorf("Failed to ListObjects Scan: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 				}
@@ -466,7 +595,7 @@ func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker strin
 				if pth != nil && record.Name == *pth {
 					continue
 				}
-				end := indexAfter(record.Name, delimiter, len(prefix))
+				end := indexAfterN(record.Name, delimiter, len(prefix), depth)
 				if end >= 0 && (pth == nil || len(record.Name) > end+1) {
 					dirName := record.Name[:end] + delimiter
 					if reverse {
@@ -483,6 +612,7 @@ func (db *sqliteContainer) ListObjects(limit int, marker string, endMarker strin
 			if err := updateRecord(record); err != nil {
 				return nil, err
 			}
+			record.Tags = decodeTags(recordTags)
 			results = append(results, record)
 		}
 		if err := rows.Err(); err != nil {
@@ -525,7 +655,7 @@ func (db *sqliteContainer) NewID() error {
 func (db *sqliteContainer) ItemsSince(start int64, count int) ([]*ObjectRecord, error) {
 	db.flush()
 	records := []*ObjectRecord{}
-	rows, err := db.Query(`SELECT ROWID, name, created_at, size, content_type, etag, deleted, storage_policy_index, expires
+	rows, err := db.Query(`SELECT ROWID, name, created_at, size, content_type, etag, deleted, storage_policy_index, expires, tags, indexed_meta
 						   FROM object WHERE ROWID > ? ORDER BY ROWID ASC LIMIT ?`, start, count)
 	if err != nil {
 		if common.IsCorruptDBError(err) {
@@ -535,7 +665,7 @@ func (db *sqliteContainer) ItemsSince(start int64, count int) ([]*ObjectRecord,
 	}
 	for rows.Next() {
 		r := &ObjectRecord{}
-		if err := rows.Scan(&r.Rowid, &r.Name, &r.CreatedAt, &r.Size, &r.ContentType, &r.ETag, &r.Deleted, &r.StoragePolicyIndex, &r.Expires); err != nil {
+		if err := rows.Scan(&r.Rowid, &r.Name, &r.CreatedAt, &r.Size, &r.ContentType, &r.ETag, &r.Deleted, &r.StoragePolicyIndex, &r.Expires, &r.Tags, &r.IndexedMeta); err != nil {
 			if common.IsCorruptDBError(err) {
 				return nil, fmt.Errorf("Failed to ItemsSince Scan: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 			}
@@ -789,9 +919,9 @@ func (db *sqliteContainer) SyncRemoteData(maxRow int64, hash, id, createdAt, put
 		return nil, err
 	}
 	defer tx.Rollback()
-	var localMeta, localHash, localDeleteTimestamp string
+	var localMeta, localHash, localPutTimestamp, localDeleteTimestamp, statusChangedAt string
 	var localPoint int64
-	if err := tx.QueryRow("SELECT hash, metadata, delete_timestamp FROM container_info").Scan(&localHash, &localMeta, &localDeleteTimestamp); err != nil {
+	if err := tx.QueryRow("SELECT hash, metadata, put_timestamp, delete_timestamp, status_changed_at FROM container_info").Scan(&localHash, &localMeta, &localPutTimestamp, &localDeleteTimestamp, &statusChangedAt); err != nil {
 		if common.IsCorruptDBError(err) {
 			return nil, fmt.Errorf("Failed to SyncRemoteData SELECT: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 		}
@@ -804,13 +934,22 @@ func (db *sqliteContainer) SyncRemoteData(maxRow int64, hash, id, createdAt, put
 	if err := json.Unmarshal([]byte(localMeta), &lm); err != nil {
 		return nil, err
 	}
+	wasDeleted := localDeleteTimestamp > localPutTimestamp
 	if deleteTimestamp > localDeleteTimestamp {
 		localDeleteTimestamp = deleteTimestamp
 	}
+	if putTimestamp > localPutTimestamp {
+		localPutTimestamp = putTimestamp
+	}
+	if wasDeleted != (localDeleteTimestamp > localPutTimestamp) {
+		// As in Swift, the status changed when this merge noticed, not
+		// when the put or delete behind it happened.
+		statusChangedAt = common.GetTimestamp()
+	}
 	metastr, err := db.mergeMetas(lm, rm, localDeleteTimestamp)
 	if _, err = tx.Exec(`UPDATE container_info SET created_at=MIN(?, created_at), put_timestamp=MAX(?, put_timestamp),
-	  					 delete_timestamp=MAX(?, delete_timestamp), metadata=?`,
-		createdAt, putTimestamp, deleteTimestamp, metastr); err != nil {
+	  					 delete_timestamp=MAX(?, delete_timestamp), status_changed_at=?, metadata=?`,
+		createdAt, putTimestamp, deleteTimestamp, statusChangedAt, metastr); err != nil {
 		if common.IsCorruptDBError(err) {
 			return nil, fmt.Errorf("Failed to SyncRemoteData UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
 		}
@@ -846,6 +985,104 @@ func (db *sqliteContainer) SyncRemoteData(maxRow int64, hash, id, createdAt, put
 	return info, nil
 }
 
+// negativeStatsError is what Audit returns for a database whose stats have
+// gone negative.
+type negativeStatsError struct {
+	problem string
+}
+
+func (e *negativeStatsError) Error() string {
+	return "Failed audit: " + e.problem
+}
+
+// Audit checks the database with sqlite's integrity_check, quarantining it if
+// that fails so replication will bring back a good copy from another replica.
+// It also makes sure the database's object counts and sizes aren't negative,
+// returning a *negativeStatsError if they are.  That comes from updates
+// applied out of order, which the other replicas have likely seen too, so the
+// database is left where it is.
+func (db *sqliteContainer) Audit() error {
+	if err := db.connect(); err != nil {
+		return err
+	}
+	if err := db.flush(); err != nil {
+		return err
+	}
+	problem, err := db.integrityProblem()
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		db.Close()
+		return fmt.Errorf("Failed audit: %s; %v", problem, common.QuarantineDir(path.Dir(db.containerFile), 4, "containers"))
+	}
+	if problem, err = db.statsProblem(); err != nil || problem == "" {
+		return err
+	}
+	return &negativeStatsError{problem: problem}
+}
+
+// integrityProblem returns what sqlite's integrity_check found wrong with the
+// database, or "" if nothing.
+func (db *sqliteContainer) integrityProblem() (string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		if common.IsCorruptDBError(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		if common.IsCorruptDBError(err) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	rows.Close()
+	if len(problems) > 0 {
+		return "integrity_check: " + strings.Join(problems, "; "), nil
+	}
+	return "", nil
+}
+
+// statsProblem returns which of the database's stats are negative, or "" if
+// none are.
+func (db *sqliteContainer) statsProblem() (string, error) {
+	info, err := db.GetInfo()
+	if err != nil {
+		return "", err
+	}
+	if info.ObjectCount < 0 || info.BytesUsed < 0 {
+		return fmt.Sprintf("negative stats: %d objects, %d bytes", info.ObjectCount, info.BytesUsed), nil
+	}
+	var negatives int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM policy_stat WHERE object_count < 0 OR bytes_used < 0").Scan(&negatives); err != nil {
+		return "", err
+	}
+	if negatives > 0 {
+		return fmt.Sprintf("negative stats for %d policies", negatives), nil
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM object WHERE size < 0").Scan(&negatives); err != nil {
+		return "", err
+	}
+	if negatives > 0 {
+		return fmt.Sprintf("%d objects with negative sizes", negatives), nil
+	}
+	return "", nil
+}
+
 // CheckSyncLink makes sure the database's container sync symlink exists or doesn't exist, as in accordance with the existence of the X-Container-Sync-To header.
 func (db *sqliteContainer) CheckSyncLink() error {
 	metadata, err := db.GetMetadata()
@@ -1003,7 +1240,15 @@ func (db *sqliteContainer) flush() error {
 	return db.flushAlreadyLocked()
 }
 
-func (db *sqliteContainer) addObject(name string, timestamp string, size int64, contentType string, etag string, deleted int, storagePolicyIndex int, expires string) error {
+func (db *sqliteContainer) addObject(name string, timestamp string, size int64, contentType string, etag string, deleted int, storagePolicyIndex int, expires string, tags string, indexedMeta string) error {
+	encodedTags, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+	encodedMeta, err := encodeTags(indexedMeta)
+	if err != nil {
+		return err
+	}
 	lock, err := fs.LockPath(filepath.Dir(db.containerFile), 10*time.Second)
 	if err != nil {
 		return err
@@ -1018,6 +1263,8 @@ func (db *sqliteContainer) addObject(name string, timestamp string, size int64,
 		Deleted:            deleted,
 		StoragePolicyIndex: storagePolicyIndex,
 		Expires:            &expires,
+		Tags:               encodedTags,
+		IndexedMeta:        encodedMeta,
 	}
 	if expires == "" {
 		rec.Expires = nil
@@ -1041,13 +1288,13 @@ func (db *sqliteContainer) addObject(name string, timestamp string, size int64,
 }
 
 // PutObject adds an object to the container, by way of pending file.
-func (db *sqliteContainer) PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string) error {
-	return db.addObject(name, timestamp, size, contentType, etag, 0, storagePolicyIndex, expires)
+func (db *sqliteContainer) PutObject(name string, timestamp string, size int64, contentType string, etag string, storagePolicyIndex int, expires string, tags string, indexedMeta string) error {
+	return db.addObject(name, timestamp, size, contentType, etag, 0, storagePolicyIndex, expires, tags, indexedMeta)
 }
 
 // DeleteObject removes an object from the container, by way of pending file.
 func (db *sqliteContainer) DeleteObject(name string, timestamp string, storagePolicyIndex int) error {
-	return db.addObject(name, timestamp, 0, "", "", 1, storagePolicyIndex, "")
+	return db.addObject(name, timestamp, 0, "", "", 1, storagePolicyIndex, "", "", "")
 }
 
 // Close closes the underlying sqlite database connection.
@@ -1079,25 +1326,33 @@ func sqliteCreateExistingContainer(db Container, putTimestamp string, newMetadat
 		return false, err
 	}
 	defer tx.Rollback()
-	var cDeleteTimestamp, cPutTimestamp, cMetadata string
+	var cDeleteTimestamp, cPutTimestamp, cStatusChangedAt, cMetadata string
 	var cPolicyIndex int
-	row := tx.QueryRow("SELECT put_timestamp, delete_timestamp, storage_policy_index, metadata FROM container_info")
-	if err := row.Scan(&cPutTimestamp, &cDeleteTimestamp, &cPolicyIndex, &cMetadata); err != nil {
+	row := tx.QueryRow("SELECT put_timestamp, delete_timestamp, status_changed_at, storage_policy_index, metadata FROM container_info")
+	if err := row.Scan(&cPutTimestamp, &cDeleteTimestamp, &cStatusChangedAt, &cPolicyIndex, &cMetadata); err != nil {
 		if common.IsCorruptDBError(err) {
 			return false, fmt.Errorf("Failed to sqliteCreateExistingContainer SELECT: %v; %v", err, common.QuarantineDir(path.Dir(cdb.containerFile), 4, "containers"))
 		}
 		return false, err
 	}
+	recreated := false
 	if cDeleteTimestamp <= cPutTimestamp { // not deleted
 		if policyIndex < 0 {
 			policyIndex = cPolicyIndex
 		} else if cPolicyIndex != policyIndex {
 			return false, ErrorPolicyConflict
 		}
+	} else if putTimestamp <= cDeleteTimestamp { // deleted after this put
+		return false, ErrorDeletedLater
 	} else { // deleted
 		if policyIndex < 0 {
 			policyIndex = defaultPolicyIndex
 		}
+		recreated = true
+		cStatusChangedAt = putTimestamp
+	}
+	if putTimestamp < cPutTimestamp {
+		putTimestamp = cPutTimestamp
 	}
 	var existingMetadata map[string][]string
 	if cMetadata == "" {
@@ -1109,8 +1364,8 @@ func sqliteCreateExistingContainer(db Container, putTimestamp string, newMetadat
 	if err != nil {
 		return false, err
 	}
-	if _, err := tx.Exec("UPDATE container_info SET put_timestamp = ?, storage_policy_index = ?, metadata = ?",
-		putTimestamp, policyIndex, metastr); err != nil {
+	if _, err := tx.Exec("UPDATE container_info SET put_timestamp = ?, status_changed_at = ?, storage_policy_index = ?, metadata = ?",
+		putTimestamp, cStatusChangedAt, policyIndex, metastr); err != nil {
 		if common.IsCorruptDBError(err) {
 			return false, fmt.Errorf("Failed to sqliteCreateExistingContainer UPDATE: %v; %v", err, common.QuarantineDir(path.Dir(cdb.containerFile), 4, "containers"))
 		}
@@ -1123,7 +1378,7 @@ func sqliteCreateExistingContainer(db Container, putTimestamp string, newMetadat
 		}
 		return false, err
 	}
-	return (cDeleteTimestamp > cPutTimestamp && putTimestamp > cDeleteTimestamp), nil
+	return recreated, nil
 }
 
 func sqliteCreateContainer(containerFile string, account string, container string, putTimestamp string,
@@ -1170,7 +1425,7 @@ func sqliteCreateContainer(containerFile string, account string, container strin
 		return err
 	}
 	defer tx.Rollback()
-	if _, err := tx.Exec(objectTableScript + policyStatTableScript + policyStatTriggerScript +
+	if _, err := tx.Exec(objectTableScript + objectMetaTableScript + policyStatTableScript + policyStatTriggerScript +
 		containerInfoTableScript + containerStatViewScript + syncTableScript); err != nil {
 		return err
 	}
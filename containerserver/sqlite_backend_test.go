@@ -56,7 +56,7 @@ func BenchmarkContainerListings(b *testing.B) {
 	}
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		records, err := db.ListObjects(10000, "", "", "", "", nil, false, 0)
+		records, err := db.ListObjects(ListOptions{Limit: 10000})
 		if err != nil {
 			panic("NON-NIL ERROR")
 		}
@@ -71,7 +71,7 @@ func TestContainerListings(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a", "b", "c"}))
-	records, err := db.ListObjects(10000, "", "", "", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000})
 	require.Nil(t, err)
 	require.Equal(t, 3, len(records))
 	require.Equal(t, "a", records[0].(*ObjectListingRecord).Name)
@@ -79,6 +79,64 @@ func TestContainerListings(t *testing.T) {
 	require.Equal(t, "c", records[2].(*ObjectListingRecord).Name)
 }
 
+func TestContainerListingsTags(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, db.PutObject("a", "200000000.00000", 1, "text/plain", "", 0, "", "color=red&size=large", ""))
+	require.Nil(t, db.PutObject("b", "200000000.00000", 1, "text/plain", "", 0, "", "color=blue", ""))
+	require.Nil(t, db.PutObject("c", "200000000.00000", 1, "text/plain", "", 0, "", "", ""))
+	records, err := db.ListObjects(ListOptions{Tags: map[string]string{"color": "red"}, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "a", records[0].(*ObjectListingRecord).Name)
+	require.Equal(t, map[string]string{"color": "red", "size": "large"}, records[0].(*ObjectListingRecord).Tags)
+	records, err = db.ListObjects(ListOptions{Tags: map[string]string{"color": ""}, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(records))
+	records, err = db.ListObjects(ListOptions{Tags: map[string]string{"color": "red", "size": "small"}, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(records))
+	records, err = db.ListObjects(ListOptions{Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(records))
+	require.Nil(t, records[2].(*ObjectListingRecord).Tags)
+}
+
+func TestContainerListingsIndexedMeta(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, db.PutObject("a", "200000000.00000", 1, "text/plain", "", 0, "", "", "color=red&size=large"))
+	require.Nil(t, db.PutObject("b", "200000000.00000", 1, "text/plain", "", 0, "", "stage=done", "color=blue"))
+	require.Nil(t, db.PutObject("c", "200000000.00000", 1, "text/plain", "", 0, "", "", ""))
+	records, err := db.ListObjects(ListOptions{Meta: map[string]string{"color": "red"}, Depth: 1, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "a", records[0].(*ObjectListingRecord).Name)
+	records, err = db.ListObjects(ListOptions{Meta: map[string]string{"color": ""}, Depth: 1, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(records))
+	records, err = db.ListObjects(ListOptions{Meta: map[string]string{"color": ""}, Tags: map[string]string{"stage": "done"}, Depth: 1, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "b", records[0].(*ObjectListingRecord).Name)
+
+	// Overwrites and deletes take their old values out of the index.
+	require.Nil(t, db.PutObject("a", "300000000.00000", 1, "text/plain", "", 0, "", "", "color=green"))
+	require.Nil(t, db.DeleteObject("b", "300000000.00000", 0))
+	records, err = db.ListObjects(ListOptions{Meta: map[string]string{"color": "red"}, Depth: 1, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(records))
+	records, err = db.ListObjects(ListOptions{Meta: map[string]string{"color": ""}, Depth: 1, Limit: 10000})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "a", records[0].(*ObjectListingRecord).Name)
+	var count int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM object_meta").Scan(&count))
+	require.Equal(t, 1, count)
+}
+
 func TestContainerUpdateRecord(t *testing.T) {
 	rec := &ObjectListingRecord{Name: "a", ContentType: "text/plain; swift_bytes=100", LastModified: "1.0"}
 	require.Nil(t, updateRecord(rec))
@@ -96,7 +154,7 @@ func TestContainerListingsLimit(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a", "b", "c"}))
-	records, err := db.ListObjects(2, "", "", "", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 2})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "a", records[0].(*ObjectListingRecord).Name)
@@ -108,7 +166,7 @@ func TestContainerListingsPrefixChange(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"b10\u2603"}))
-	records, err := db.ListObjects(10000, "", "", "b10", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Prefix: "b10"})
 	require.Nil(t, err)
 	require.Equal(t, 1, len(records))
 }
@@ -118,14 +176,14 @@ func TestContainerListingsPrefix(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a1", "a2", "A3", "b1", "B2", "a10", "b10", "zz"}))
-	records, err := db.ListObjects(10000, "", "", "a", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Prefix: "a"})
 	require.Nil(t, err)
 	require.Equal(t, 3, len(records))
 	require.Equal(t, "a1", records[0].(*ObjectListingRecord).Name)
 	require.Equal(t, "a10", records[1].(*ObjectListingRecord).Name)
 	require.Equal(t, "a2", records[2].(*ObjectListingRecord).Name)
 
-	records, err = db.ListObjects(10000, "", "", "b10", "", nil, false, 0)
+	records, err = db.ListObjects(ListOptions{Limit: 10000, Prefix: "b10"})
 	require.Nil(t, err)
 	require.Equal(t, 1, len(records))
 	require.Equal(t, "b10", records[0].(*ObjectListingRecord).Name)
@@ -136,7 +194,7 @@ func TestContainerListingsPrefixLimit(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a1", "b1", "a2", "b2", "a3", "b3"}))
-	records, err := db.ListObjects(2, "", "", "a", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 2, Prefix: "a"})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "a1", records[0].(*ObjectListingRecord).Name)
@@ -148,7 +206,7 @@ func TestContainerListingsPrefixDelim(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"US-TX-A", "US-TX-B", "US-OK-A", "US-OK-B", "US-UT-A"}))
-	records, err := db.ListObjects(10000, "", "", "US-", "-", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Prefix: "US-", Delimiter: "-"})
 	require.Nil(t, err)
 	require.Equal(t, 3, len(records))
 	require.Equal(t, "US-OK-", records[0].(*SubdirListingRecord).Name)
@@ -161,7 +219,7 @@ func TestContainerLeadingDelimiter(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"US-TX-A", "US-TX-B", "-UK", "-CH"}))
-	records, err := db.ListObjects(10000, "", "", "", "-", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Delimiter: "-"})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "-", records[0].(*SubdirListingRecord).Name)
@@ -173,7 +231,7 @@ func TestContainerMarkers(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a", "b", "c", "d", "e", "f"}))
-	records, err := db.ListObjects(10000, "b", "e", "", "", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Marker: "b", EndMarker: "e"})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "c", records[0].(*ObjectListingRecord).Name)
@@ -185,7 +243,7 @@ func TestContainerReverse(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a", "b", "c"}))
-	records, err := db.ListObjects(10000, "", "", "", "", nil, true, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Reverse: true})
 	require.Nil(t, err)
 	require.Equal(t, 3, len(records))
 	require.Equal(t, "c", records[0].(*ObjectListingRecord).Name)
@@ -198,7 +256,7 @@ func TestContainerReverseMarkers(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"a", "b", "c", "d", "e", "f"}))
-	records, err := db.ListObjects(10000, "e", "b", "", "", nil, true, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Marker: "e", EndMarker: "b", Reverse: true})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "d", records[0].(*ObjectListingRecord).Name)
@@ -210,7 +268,7 @@ func TestContainerListingsReversePrefixDelim(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"US-TX-A", "US-TX-B", "US-OK-A", "US-OK-B", "US-UT-A"}))
-	records, err := db.ListObjects(10000, "", "", "US-", "-", nil, true, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Prefix: "US-", Delimiter: "-", Reverse: true})
 	require.Nil(t, err)
 	require.Equal(t, 3, len(records))
 	require.Equal(t, "US-UT-", records[0].(*SubdirListingRecord).Name)
@@ -223,31 +281,72 @@ func TestContainerListingsDelimiterAndPrefix(t *testing.T) {
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"bar", "bazar"}))
-	records, err := db.ListObjects(10000, "", "", "ba", "a", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Prefix: "ba", Delimiter: "a"})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "bar", records[0].(*ObjectListingRecord).Name)
 	require.Equal(t, "baza", records[1].(*SubdirListingRecord).Name)
 
-	records, err = db.ListObjects(10000, "", "", "ba", "a", nil, true, 0)
+	records, err = db.ListObjects(ListOptions{Limit: 10000, Prefix: "ba", Delimiter: "a", Reverse: true})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "baza", records[0].(*SubdirListingRecord).Name)
 	require.Equal(t, "bar", records[1].(*ObjectListingRecord).Name)
 }
 
+func TestContainerListingsMultiCharDelimiter(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, mergeItemsByName(db, []string{"a::b::c", "a::d", "a:e", "f"}))
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Delimiter: "::"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(records))
+	require.Equal(t, "a::", records[0].(*SubdirListingRecord).Name)
+	require.Equal(t, "a:e", records[1].(*ObjectListingRecord).Name)
+	require.Equal(t, "f", records[2].(*ObjectListingRecord).Name)
+
+	records, err = db.ListObjects(ListOptions{Limit: 10000, Delimiter: "::", Reverse: true})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(records))
+	require.Equal(t, "f", records[0].(*ObjectListingRecord).Name)
+	require.Equal(t, "a:e", records[1].(*ObjectListingRecord).Name)
+	require.Equal(t, "a::", records[2].(*SubdirListingRecord).Name)
+}
+
+func TestContainerListingsDepth(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, mergeItemsByName(db, []string{"a/b/c/d", "a/b/e", "a/f", "g/h/i", "j"}))
+	records, err := db.ListObjects(ListOptions{Depth: 2, Limit: 10000, Delimiter: "/"})
+	require.Nil(t, err)
+	require.Equal(t, 4, len(records))
+	require.Equal(t, "a/b/", records[0].(*SubdirListingRecord).Name)
+	require.Equal(t, "a/f", records[1].(*ObjectListingRecord).Name)
+	require.Equal(t, "g/h/", records[2].(*SubdirListingRecord).Name)
+	require.Equal(t, "j", records[3].(*ObjectListingRecord).Name)
+
+	records, err = db.ListObjects(ListOptions{Depth: 2, Limit: 10000, Prefix: "a/", Delimiter: "/", Reverse: true})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(records))
+	require.Equal(t, "a/f", records[0].(*ObjectListingRecord).Name)
+	require.Equal(t, "a/b/e", records[1].(*ObjectListingRecord).Name)
+	require.Equal(t, "a/b/c/", records[2].(*SubdirListingRecord).Name)
+}
+
 func TestContainerListingsDelimiter(t *testing.T) {
 	db, _, cleanup, err := createTestDatabase("100000000.00000")
 	require.Nil(t, err)
 	defer cleanup()
 	require.Nil(t, mergeItemsByName(db, []string{"test", "test-bar", "test-foo"}))
-	records, err := db.ListObjects(10000, "", "", "", "-", nil, false, 0)
+	records, err := db.ListObjects(ListOptions{Limit: 10000, Delimiter: "-"})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "test", records[0].(*ObjectListingRecord).Name)
 	require.Equal(t, "test-", records[1].(*SubdirListingRecord).Name)
 
-	records, err = db.ListObjects(10000, "", "", "", "-", nil, true, 0)
+	records, err = db.ListObjects(ListOptions{Limit: 10000, Delimiter: "-", Reverse: true})
 	require.Nil(t, err)
 	require.Equal(t, 2, len(records))
 	require.Equal(t, "test-", records[0].(*SubdirListingRecord).Name)
@@ -303,7 +402,7 @@ func TestContainerListingsPaths(t *testing.T) {
 	require.Nil(t, mergeItemsByName(db, files))
 	assertListing := func(path string, expected []string) {
 		sort.Strings(expected)
-		records, err := db.ListObjects(10000, "", "", "", "-", &path, false, 0)
+		records, err := db.ListObjects(ListOptions{Limit: 10000, Delimiter: "-", Path: &path})
 		require.Nil(t, err)
 		require.Equal(t, len(expected), len(records))
 		for i, rec := range records {
@@ -649,6 +748,38 @@ func TestCreateExistingNoPolicy(t *testing.T) {
 	})
 }
 
+func TestCreateExistingRecreate(t *testing.T) {
+	db, _, cleanup, err := createTestDatabase("200000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+
+	require.Nil(t, db.Delete("200000002.00000"))
+	info, err := db.GetInfo()
+	require.Nil(t, err)
+	require.Equal(t, "200000002.00000", info.StatusChangedAt)
+
+	_, err = sqliteCreateExistingContainer(db, "200000001.00000", map[string][]string{}, -1, 0)
+	require.Equal(t, ErrorDeletedLater, err)
+
+	c, err := sqliteCreateExistingContainer(db, "200000003.00000", map[string][]string{}, -1, 0)
+	require.Nil(t, err)
+	require.True(t, c)
+	info, err = db.GetInfo()
+	require.Nil(t, err)
+	require.Equal(t, "200000003.00000", info.PutTimestamp)
+	require.Equal(t, "200000002.00000", info.DeleteTimestamp)
+	require.Equal(t, "200000003.00000", info.StatusChangedAt)
+
+	require.Nil(t, db.Delete("200000001.00000"))
+	deleted, err := db.IsDeleted()
+	require.Nil(t, err)
+	require.False(t, deleted)
+	info, err = db.GetInfo()
+	require.Nil(t, err)
+	require.Equal(t, "200000002.00000", info.DeleteTimestamp)
+	require.Equal(t, "200000003.00000", info.StatusChangedAt)
+}
+
 func TestCleanupTombstones(t *testing.T) {
 	db, _, cleanup, err := createTestDatabase("200000000.00000")
 	require.Nil(t, err)
@@ -783,3 +914,21 @@ func TestNotADB(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAudit(t *testing.T) {
+	db, dbFile, cleanup, err := createTestDatabase("100000000.00000")
+	require.Nil(t, err)
+	defer cleanup()
+	require.Nil(t, mergeItemsByName(db, []string{"a", "b"}))
+	require.Nil(t, db.Audit())
+	require.True(t, fs.Exists(dbFile))
+	_, err = db.Exec("UPDATE object SET size = -5 WHERE name = 'a'")
+	require.Nil(t, err)
+	err = db.Audit()
+	require.NotNil(t, err)
+	_, ok := err.(*negativeStatsError)
+	require.True(t, ok)
+	require.True(t, strings.Contains(err.Error(), "negative"))
+	// negative stats aren't corruption, so the database stays put
+	require.True(t, fs.Exists(dbFile))
+}
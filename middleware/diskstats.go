@@ -0,0 +1,234 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// diskSample is one device's line of /proc/diskstats.
+type diskSample struct {
+	reads      uint64
+	readTicks  uint64
+	writes     uint64
+	writeTicks uint64
+	inFlight   uint64
+	ioTicks    uint64
+	queueTicks uint64
+}
+
+// DeviceIOStats is how busy a device was over the last sampling interval,
+// in the terms iostat -x uses.
+type DeviceIOStats struct {
+	Device string `json:"device"`
+	// Util is the percentage of the interval the device was doing I/O.
+	Util float64 `json:"util"`
+	// Await is the average milliseconds a request took, queueing included.
+	Await float64 `json:"await"`
+	// QueueDepth is the average number of requests queued or in progress.
+	QueueDepth   float64 `json:"queue_depth"`
+	InFlight     uint64  `json:"in_flight"`
+	ReadsPerSec  float64 `json:"reads_per_sec"`
+	WritesPerSec float64 `json:"writes_per_sec"`
+}
+
+// DiskStatsCollector samples /proc/diskstats for the devices mounted under
+// a drive root, so how loaded each one is can be reported and acted on.
+type DiskStatsCollector struct {
+	driveRoot     string
+	diskstatsPath string
+	lock          sync.RWMutex
+	last          map[string]diskSample
+	lastTime      time.Time
+	stats         map[string]*DeviceIOStats
+}
+
+func NewDiskStatsCollector(driveRoot string) *DiskStatsCollector {
+	return &DiskStatsCollector{
+		driveRoot:     driveRoot,
+		diskstatsPath: "/proc/diskstats",
+		stats:         map[string]*DeviceIOStats{},
+	}
+}
+
+// parseDiskstats reads /proc/diskstats format lines, keyed by major:minor.
+func parseDiskstats(r io.Reader) map[string]diskSample {
+	samples := map[string]diskSample{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		var v [11]uint64
+		var err error
+		for i := range v {
+			if v[i], err = strconv.ParseUint(fields[i+3], 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		samples[fields[0]+":"+fields[1]] = diskSample{
+			reads:      v[0],
+			readTicks:  v[3],
+			writes:     v[4],
+			writeTicks: v[7],
+			inFlight:   v[8],
+			ioTicks:    v[9],
+			queueTicks: v[10],
+		}
+	}
+	return samples
+}
+
+// deviceNumber returns the major:minor of the block device the path is on.
+func deviceNumber(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	dev := uint64(st.Dev)
+	major := ((dev >> 8) & 0xfff) | ((dev >> 32) & 0xfffff000)
+	minor := (dev & 0xff) | ((dev >> 12) & 0xffffff00)
+	return fmt.Sprintf("%d:%d", major, minor), nil
+}
+
+// ioStats works out a device's DeviceIOStats from two samples taken elapsed
+// apart.
+func ioStats(device string, prev, cur diskSample, elapsed time.Duration) *DeviceIOStats {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	s := &DeviceIOStats{Device: device, InFlight: cur.inFlight}
+	if ms <= 0 {
+		return s
+	}
+	ios := float64(cur.reads - prev.reads + cur.writes - prev.writes)
+	s.Util = float64(cur.ioTicks-prev.ioTicks) / ms * 100
+	if s.Util > 100 {
+		s.Util = 100
+	}
+	if ios > 0 {
+		s.Await = float64(cur.readTicks-prev.readTicks+cur.writeTicks-prev.writeTicks) / ios
+	}
+	s.QueueDepth = float64(cur.queueTicks-prev.queueTicks) / ms
+	s.ReadsPerSec = float64(cur.reads-prev.reads) / ms * 1000
+	s.WritesPerSec = float64(cur.writes-prev.writes) / ms * 1000
+	return s
+}
+
+// Sample reads /proc/diskstats and updates the stats of every device in the
+// drive root from the previous sample.
+func (c *DiskStatsCollector) Sample() error {
+	fp, err := os.Open(c.diskstatsPath)
+	if err != nil {
+		return err
+	}
+	all := parseDiskstats(fp)
+	fp.Close()
+	now := time.Now()
+	devices, err := filepath.Glob(filepath.Join(c.driveRoot, "*"))
+	if err != nil {
+		return err
+	}
+	samples := map[string]diskSample{}
+	stats := map[string]*DeviceIOStats{}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, path := range devices {
+		num, err := deviceNumber(path)
+		if err != nil {
+			continue
+		}
+		cur, ok := all[num]
+		if !ok {
+			continue
+		}
+		device := filepath.Base(path)
+		samples[device] = cur
+		if prev, ok := c.last[device]; ok {
+			stats[device] = ioStats(device, prev, cur, now.Sub(c.lastTime))
+		}
+	}
+	c.last = samples
+	c.lastTime = now
+	c.stats = stats
+	return nil
+}
+
+// Stats returns the stats of device from the last sampling interval.
+func (c *DiskStatsCollector) Stats(device string) (*DeviceIOStats, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	s, ok := c.stats[device]
+	return s, ok
+}
+
+// AllStats returns the stats of every device from the last sampling
+// interval.
+func (c *DiskStatsCollector) AllStats() []*DeviceIOStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	all := make([]*DeviceIOStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		all = append(all, s)
+	}
+	return all
+}
+
+// ReconHandler serves the stats of every device as the iostats recon call.
+func (c *DiskStatsCollector) ReconHandler(writer http.ResponseWriter, request *http.Request) {
+	serialized, _ := json.MarshalIndent(c.AllStats(), "", "  ")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(serialized)
+}
+
+// Run samples every interval, updating per device gauges, until cancel is
+// closed.
+func (c *DiskStatsCollector) Run(scope tally.Scope, interval time.Duration, cancel chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	c.Sample()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Sample(); err != nil {
+				continue
+			}
+			for _, s := range c.AllStats() {
+				devScope := scope.Tagged(map[string]string{"device": s.Device})
+				devScope.Gauge("disk_util").Update(s.Util)
+				devScope.Gauge("disk_await").Update(s.Await)
+				devScope.Gauge("disk_queue_depth").Update(s.QueueDepth)
+			}
+		case <-cancel:
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiskstats(t *testing.T) {
+	samples := parseDiskstats(strings.NewReader(
+		"   8       0 sda 100 5 2000 300 50 2 800 200 3 400 500\n" +
+			"   8       1 sda1 garbage\n" +
+			" 259       0 nvme0n1 1 0 8 1 2 0 16 2 0 3 3 0 0 0 0\n"))
+	require.Equal(t, 2, len(samples))
+	require.Equal(t, diskSample{reads: 100, readTicks: 300, writes: 50, writeTicks: 200, inFlight: 3, ioTicks: 400, queueTicks: 500}, samples["8:0"])
+	require.Equal(t, uint64(2), samples["259:0"].writes)
+}
+
+func TestIOStats(t *testing.T) {
+	prev := diskSample{reads: 100, readTicks: 100, writes: 100, writeTicks: 100, ioTicks: 1000, queueTicks: 1000}
+	cur := diskSample{reads: 150, readTicks: 300, writes: 150, writeTicks: 500, inFlight: 2, ioTicks: 1500, queueTicks: 3000}
+	s := ioStats("sda", prev, cur, time.Second)
+	require.Equal(t, "sda", s.Device)
+	require.Equal(t, float64(50), s.Util)
+	require.Equal(t, float64(6), s.Await)
+	require.Equal(t, float64(2), s.QueueDepth)
+	require.Equal(t, float64(50), s.ReadsPerSec)
+	require.Equal(t, uint64(2), s.InFlight)
+}
+
+func TestDiskStatsCollectorSample(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	driveRoot := filepath.Join(dir, "node")
+	require.Nil(t, os.MkdirAll(filepath.Join(driveRoot, "sda"), 0755))
+	num, err := deviceNumber(filepath.Join(driveRoot, "sda"))
+	require.Nil(t, err)
+	parts := strings.Split(num, ":")
+	statsPath := filepath.Join(dir, "diskstats")
+	c := NewDiskStatsCollector(driveRoot)
+	c.diskstatsPath = statsPath
+
+	require.Nil(t, ioutil.WriteFile(statsPath, []byte(fmt.Sprintf("%s %s dev 0 0 0 0 0 0 0 0 0 0 0\n", parts[0], parts[1])), 0600))
+	require.Nil(t, c.Sample())
+	_, ok := c.Stats("sda")
+	require.False(t, ok)
+
+	require.Nil(t, ioutil.WriteFile(statsPath, []byte(fmt.Sprintf("%s %s dev 10 0 0 10 0 0 0 0 1 5 10\n", parts[0], parts[1])), 0600))
+	require.Nil(t, c.Sample())
+	s, ok := c.Stats("sda")
+	require.True(t, ok)
+	require.Equal(t, float64(1), s.Await)
+	require.Equal(t, uint64(1), s.InFlight)
+	require.Equal(t, 1, len(c.AllStats()))
+}
@@ -0,0 +1,109 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+// MaintenanceHeader is set on /healthcheck responses from servers on a node
+// that's in maintenance, so proxies checking on them know to steer around it.
+const MaintenanceHeader = "X-Backend-Maintenance"
+
+// MaintenanceState is whether a node is in maintenance, and since when and
+// why if it is.
+type MaintenanceState struct {
+	Maintenance bool       `json:"maintenance"`
+	Since       *time.Time `json:"since,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// The maintenance marker lives in the recon cache so every server on the node
+// sees it, however many ports they're spread across.
+func maintenanceMarker(reconCachePath string) string {
+	return filepath.Join(reconCachePath, "maintenance.json")
+}
+
+// GetMaintenance returns the node's maintenance state.
+func GetMaintenance(reconCachePath string) *MaintenanceState {
+	state := &MaintenanceState{}
+	data, err := ioutil.ReadFile(maintenanceMarker(reconCachePath))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		// a marker that can't be read still means someone put it there
+		return &MaintenanceState{Maintenance: true}
+	}
+	state.Maintenance = true
+	return state
+}
+
+// InMaintenance reports whether the node is in maintenance.
+func InMaintenance(reconCachePath string) bool {
+	_, err := os.Stat(maintenanceMarker(reconCachePath))
+	return err == nil
+}
+
+// SetMaintenance puts the node in maintenance, or takes it out if state is
+// nil.
+func SetMaintenance(reconCachePath string, state *MaintenanceState) error {
+	if state == nil {
+		if err := os.Remove(maintenanceMarker(reconCachePath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := maintenanceMarker(reconCachePath) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, maintenanceMarker(reconCachePath))
+}
+
+// MaintenanceHandler serves /maintenance: GET returns the node's maintenance
+// state, PUT puts it in maintenance with an optional reason query parameter,
+// and DELETE takes it out.
+func MaintenanceHandler(reconCachePath string, writer http.ResponseWriter, request *http.Request) {
+	var err error
+	switch request.Method {
+	case "PUT":
+		if !InMaintenance(reconCachePath) {
+			now := time.Now().UTC()
+			err = SetMaintenance(reconCachePath, &MaintenanceState{Maintenance: true, Since: &now, Reason: request.FormValue("reason")})
+		}
+	case "DELETE":
+		err = SetMaintenance(reconCachePath, nil)
+	}
+	if err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+	serialized, _ := json.MarshalIndent(GetMaintenance(reconCachePath), "", "  ")
+	writer.Write(serialized)
+}
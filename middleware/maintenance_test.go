@@ -0,0 +1,62 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.False(t, InMaintenance(dir))
+
+	w := httptest.NewRecorder()
+	MaintenanceHandler(dir, w, httptest.NewRequest("PUT", "/maintenance?reason=new+disks", nil))
+	require.Equal(t, 200, w.Code)
+	require.True(t, InMaintenance(dir))
+	state := GetMaintenance(dir)
+	require.True(t, state.Maintenance)
+	require.Equal(t, "new disks", state.Reason)
+	require.NotNil(t, state.Since)
+
+	// enabling again keeps the original reason and time
+	w = httptest.NewRecorder()
+	MaintenanceHandler(dir, w, httptest.NewRequest("PUT", "/maintenance", nil))
+	require.Equal(t, 200, w.Code)
+	var got MaintenanceState
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, "new disks", got.Reason)
+	require.True(t, got.Since.Equal(*state.Since))
+
+	w = httptest.NewRecorder()
+	MaintenanceHandler(dir, w, httptest.NewRequest("DELETE", "/maintenance", nil))
+	require.Equal(t, 200, w.Code)
+	require.False(t, InMaintenance(dir))
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.False(t, got.Maintenance)
+
+	w = httptest.NewRecorder()
+	MaintenanceHandler(dir, w, httptest.NewRequest("DELETE", "/maintenance", nil))
+	require.Equal(t, 200, w.Code)
+}
@@ -725,6 +725,8 @@ func ReconHandler(driveRoot string, reconCachePath string, mountCheck bool, writ
 		content = float64(time.Now().UnixNano()) / float64(time.Second)
 	case "hummingbirdtime":
 		content = map[string]time.Time{"time": time.Now()}
+	case "maintenance":
+		content = GetMaintenance(reconCachePath)
 	case "driveaudit":
 		content, err = fromReconCache(reconCachePath, "drive", "drive_audit_errors")
 		if err != nil {
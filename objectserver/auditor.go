@@ -22,6 +22,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/bits"
 	"os"
 	"path/filepath"
@@ -57,6 +58,24 @@ type AuditorDaemon struct {
 	reconCachePath    string
 	hashPathPrefix    string
 	hashPathSuffix    string
+	// devices, partitions and hashPrefix narrow what gets audited, for
+	// spot-checking with RunAuditorOnce; empty means everything.
+	devices    map[string]bool
+	partitions map[string]bool
+	hashPrefix string
+	zbfOnly    bool
+}
+
+func (d *AuditorDaemon) wantDevice(device string) bool {
+	return len(d.devices) == 0 || d.devices[device]
+}
+
+func (d *AuditorDaemon) wantPartition(partition string) bool {
+	return len(d.partitions) == 0 || d.partitions[partition]
+}
+
+func (d *AuditorDaemon) wantHash(hash string) bool {
+	return strings.HasPrefix(hash, d.hashPrefix)
 }
 
 // Auditor keeps track of general audit data.
@@ -72,7 +91,7 @@ type Auditor struct {
 	errors, totalErrors           int64
 }
 
-func slowCopyMd5(file *os.File, bps int64) (int64, string, error) {
+func slowCopyMd5(file io.Reader, bps int64) (int64, string, error) {
 	h := md5.New()
 	st := time.Now()
 	bytesRead := int64(0)
@@ -160,8 +179,10 @@ func (ecAuditor) AuditItem(path string, item *IndexDBItem, md5BytesPerSec int64)
 type repAuditor struct{}
 
 func (repAuditor) AuditItem(path string, item *IndexDBItem, md5BytesPerSec int64) (int64, error) {
-	finfo, err := os.Stat(path)
-	if err != nil || !finfo.Mode().IsRegular() {
+	var size int64
+	if item.Inline {
+		size = int64(len(item.Data))
+	} else if finfo, err := os.Stat(path); err != nil || !finfo.Mode().IsRegular() {
 		if item.Nursery {
 			// We're not going to do any quarantining here. It's likely the object
 			// simply got stabilized and is gone.
@@ -169,9 +190,11 @@ func (repAuditor) AuditItem(path string, item *IndexDBItem, md5BytesPerSec int64
 		} else {
 			return 0, fmt.Errorf("Object file isn't a normal file: %s", err)
 		}
+	} else {
+		size = finfo.Size()
 	}
 	metadata := map[string]string{}
-	if err = json.Unmarshal(item.Metabytes, &metadata); err != nil {
+	if err := json.Unmarshal(item.Metabytes, &metadata); err != nil {
 		return 0, fmt.Errorf("Error decoding metadata: %s", err)
 	}
 	fBytes, err := strconv.ParseInt(metadata["Content-Length"], 10, 64)
@@ -182,11 +205,11 @@ func (repAuditor) AuditItem(path string, item *IndexDBItem, md5BytesPerSec int64
 	if !ok {
 		return 0, fmt.Errorf("Metadata missing ETag: %s", metadata)
 	}
-	if fBytes != finfo.Size() {
-		return 0, fmt.Errorf("File size (%d) doesn't match metadata (%d)", finfo.Size(), fBytes)
+	if fBytes != size {
+		return 0, fmt.Errorf("File size (%d) doesn't match metadata (%d)", size, fBytes)
 	}
 	if md5BytesPerSec > 0 {
-		file, err := os.Open(path)
+		file, err := openItem(&IndexDBItem{Path: path, Inline: item.Inline, Data: item.Data})
 		if err != nil {
 			return 0, fmt.Errorf("Error opening file: %s", err)
 		}
@@ -220,7 +243,9 @@ func QuarantineItem(db *IndexDB, item *IndexDBItem) error {
 	}
 	dest := filepath.Join(quarantineDir, itemName)
 	var rerr error
-	if err = os.Rename(itemPath, dest); err != nil && !os.IsNotExist(err) {
+	if item.Inline {
+		rerr = ioutil.WriteFile(dest, item.Data, 0644)
+	} else if err = os.Rename(itemPath, dest); err != nil && !os.IsNotExist(err) {
 		rerr = err
 	}
 	metaName := filepath.Join(quarantineDir, itemName+".idbmeta")
@@ -371,11 +396,16 @@ func (a *Auditor) auditDB(devPath string, objRing ring.Ring, policy *conf.Policy
 		a.logger.Error("could not GetDbSubDirs", zap.Error(err))
 		return
 	}
+	dbBackend, err := policy.GetDbBackend()
+	if err != nil {
+		a.logger.Error("could not GetDbBackend", zap.Error(err))
+		return
+	}
 	if _, ok := a.idbAuditors[policy.Index]; !ok {
 		a.logger.Error("No auditor set policy", zap.String("policy-type", policy.Type), zap.Int("policy-index", policy.Index))
 		return
 	}
-	db, err := NewIndexDB(dbpath, path, temppath, ringPartPower, int(dbPartPower), subdirs, 0, zapLogger, a.idbAuditors[policy.Index])
+	db, err := NewIndexDBWithBackend(dbBackend, dbpath, path, temppath, ringPartPower, int(dbPartPower), subdirs, 0, zapLogger, a.idbAuditors[policy.Index])
 	if err != nil {
 		a.errors++
 		a.totalErrors++
@@ -384,14 +414,24 @@ func (a *Auditor) auditDB(devPath string, objRing ring.Ring, policy *conf.Policy
 	}
 	defer db.Close()
 
+	startHash, stopHash := "", ""
+	if a.hashPrefix != "" {
+		startHash = a.hashPrefix + strings.Repeat("0", 32-len(a.hashPrefix))
+		stopHash = a.hashPrefix + strings.Repeat("f", 32-len(a.hashPrefix))
+	}
 	marker := ""
 	for {
-		items, err := db.List("", "", marker, 1000)
+		items, err := db.List(startHash, stopHash, marker, 1000)
 		if err != nil {
 			a.logger.Error("db.List failed", zap.String("dbpath", dbpath), zap.Error(err))
 			return
 		}
 		for _, item := range items {
+			if len(a.partitions) > 0 {
+				if _, ringPart, _, _, err := ValidateHash(item.Hash, uint(ringPartPower), dbPartPower, subdirs); err != nil || !a.wantPartition(strconv.Itoa(ringPart)) {
+					continue
+				}
+			}
 			itemPath, err := db.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery)
 			if err != nil {
 				a.logger.Error("Error getting indexdb path for hash",
@@ -450,6 +490,9 @@ func (a *Auditor) auditSuffix(suffixDir string) {
 			a.logger.Error("Skipping invalid file in suffix", zap.String("hashDir", hashDir), zap.Error(err))
 			continue
 		}
+		if !a.wantHash(hash) {
+			continue
+		}
 		a.passes++
 		a.totalPasses++
 		var bps int64
@@ -524,6 +567,9 @@ func (a *Auditor) auditDevice(devPath string) {
 				continue
 			}
 			for _, partition := range partitions {
+				if !a.wantPartition(partition) {
+					continue
+				}
 				_, intErr := strconv.ParseInt(partition, 10, 64)
 				partitionDir := filepath.Join(objPath, partition)
 				if finfo, err := os.Stat(partitionDir); err != nil || intErr != nil || !finfo.Mode().IsDir() {
@@ -623,7 +669,9 @@ func (a *Auditor) run(c <-chan time.Time) {
 			continue
 		}
 		for _, dev := range devices {
-			a.auditDevice(filepath.Join(a.driveRoot, dev))
+			if a.wantDevice(dev) {
+				a.auditDevice(filepath.Join(a.driveRoot, dev))
+			}
 		}
 		a.finalLog()
 	}
@@ -631,6 +679,15 @@ func (a *Auditor) run(c <-chan time.Time) {
 
 // Run a single audit pass.
 func (d *AuditorDaemon) Run() {
+	if d.zbfOnly {
+		filesPerSecond := d.zbFilesPerSecond
+		if filesPerSecond <= 0 {
+			filesPerSecond = 50
+		}
+		zba := Auditor{AuditorDaemon: d, auditorType: "ZBF", mode: "once", filesPerSecond: filesPerSecond}
+		zba.run(OneTimeChan())
+		return
+	}
 	wg := sync.WaitGroup{}
 	if d.zbFilesPerSecond > 0 {
 		wg.Add(1)
@@ -694,3 +751,39 @@ func NewAuditorDaemon(serverconf conf.Config, flags *flag.FlagSet, cnf srv.Confi
 	d.logTime = serverconf.GetInt("object-auditor", "log_time", 3600)
 	return d, nil
 }
+
+// RunAuditorOnce runs a single audit pass for each object server config,
+// limited to the devices, partitions and hash prefix given by the flags.
+// With -zbf only the fast pass, which checks metadata and sizes but doesn't
+// read file contents, is run.
+func RunAuditorOnce(flags *flag.FlagSet, cnf srv.ConfigLoader) {
+	configFile := flags.Lookup("c").Value.(flag.Getter).Get().(string)
+	configs, err := conf.LoadConfigs(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding configs: %v\n", err)
+		os.Exit(1)
+	}
+	hashPrefix := strings.ToLower(flags.Lookup("prefix").Value.(flag.Getter).Get().(string))
+	if _, err := hex.DecodeString(hashPrefix + strings.Repeat("0", len(hashPrefix)%2)); err != nil || len(hashPrefix) > 32 {
+		fmt.Fprintf(os.Stderr, "Invalid hash prefix %q\n", hashPrefix)
+		os.Exit(1)
+	}
+	for _, config := range configs {
+		d, err := NewAuditorDaemon(config, flags, cnf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		d.devices = map[string]bool{}
+		for _, dev := range common.SliceFromCSV(flags.Lookup("devices").Value.(flag.Getter).Get().(string)) {
+			d.devices[dev] = true
+		}
+		d.partitions = map[string]bool{}
+		for _, part := range common.SliceFromCSV(flags.Lookup("partitions").Value.(flag.Getter).Get().(string)) {
+			d.partitions[part] = true
+		}
+		d.hashPrefix = hashPrefix
+		d.zbfOnly = flags.Lookup("zbf").Value.(flag.Getter).Get() == true
+		d.Run()
+	}
+}
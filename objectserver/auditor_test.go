@@ -398,6 +398,30 @@ func TestAuditDevicePasses(t *testing.T) {
 	assert.Equal(t, int64(12), auditor.totalBytes)
 }
 
+func TestAuditDeviceFiltered(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	for _, path := range []string{
+		filepath.Join(dir, "sda", "objects", "1", "abc", "fffffffffffffffffffffffffffffabc", "12345.data"),
+		filepath.Join(dir, "sda", "objects", "1", "abc", "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeabc", "12345.data"),
+		filepath.Join(dir, "sda", "objects", "2", "abc", "fffffffffffffffffffffffffffffabc", "12345.data"),
+	} {
+		os.MkdirAll(filepath.Dir(path), 0777)
+		f, _ := os.Create(path)
+		common.SwiftObjectWriteMetadata(f.Fd(), map[string]string{"Content-Length": "12", "ETag": "d3ac5112fe464b81184352ccba743001", "name": "", "Content-Type": "", "X-Timestamp": ""})
+		f.Write([]byte("testcontents"))
+		f.Close()
+	}
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	auditor := makeAuditor(t, confLoader, "mount_check", "false")
+	auditor.partitions = map[string]bool{"1": true}
+	auditor.hashPrefix = "ff"
+	totalPasses := auditor.totalPasses
+	auditor.auditDevice(filepath.Join(dir, "sda"))
+	assert.Equal(t, totalPasses+1, auditor.totalPasses)
+}
+
 func TestAuditDeviceSkipsBadData(t *testing.T) {
 	dir, _ := ioutil.TempDir("", "")
 	defer os.RemoveAll(dir)
@@ -0,0 +1,122 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// deviceBreaker takes a device out of service for a while once it's thrown
+// too many I/O errors, rather than letting a dying drive keep failing
+// requests (and soaking up retries) one at a time.  The object server trips
+// it; a marker file in the recon cache tells the replicator on the same host
+// to leave the device alone until the cool-down is over.
+type deviceBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	markerDir string
+	lock      sync.Mutex
+	errors    map[string][]time.Time
+	openUntil map[string]time.Time
+	scope     tally.Scope
+}
+
+func newDeviceBreaker(threshold int, window, cooldown time.Duration, markerDir string) *deviceBreaker {
+	return &deviceBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		markerDir: markerDir,
+		errors:    map[string][]time.Time{},
+		openUntil: map[string]time.Time{},
+	}
+}
+
+// Error records an I/O error on device and reports whether it tripped the
+// breaker.
+func (b *deviceBreaker) Error(device string) bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if now.Before(b.openUntil[device]) {
+		return false
+	}
+	recent := b.errors[device][:0]
+	for _, t := range b.errors[device] {
+		if now.Sub(t) < b.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) < b.threshold {
+		b.errors[device] = recent
+		return false
+	}
+	delete(b.errors, device)
+	until := now.Add(b.cooldown)
+	b.openUntil[device] = until
+	ioutil.WriteFile(deviceBreakerMarker(b.markerDir, device), []byte(strconv.FormatInt(until.UnixNano(), 10)), 0644)
+	if b.scope != nil {
+		b.scope.Tagged(map[string]string{"device": device}).Counter("device_breaker_trips").Inc(1)
+	}
+	return true
+}
+
+// Open reports whether device is out of service.
+func (b *deviceBreaker) Open(device string) bool {
+	if b == nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	until, ok := b.openUntil[device]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(until) {
+		return true
+	}
+	delete(b.openUntil, device)
+	os.Remove(deviceBreakerMarker(b.markerDir, device))
+	return false
+}
+
+func deviceBreakerMarker(markerDir, device string) string {
+	return filepath.Join(markerDir, "object_breaker_"+device)
+}
+
+// deviceBreakerTripped reports whether an object server on this host has
+// taken device out of service.
+func deviceBreakerTripped(markerDir, device string) bool {
+	data, err := ioutil.ReadFile(deviceBreakerMarker(markerDir, device))
+	if err != nil {
+		return false
+	}
+	until, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return err == nil && time.Now().UnixNano() < until
+}
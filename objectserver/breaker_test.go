@@ -0,0 +1,65 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceBreaker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	b := newDeviceBreaker(3, time.Minute, 50*time.Millisecond, dir)
+	require.False(t, b.Error("sda"))
+	require.False(t, b.Error("sda"))
+	require.False(t, b.Error("sdb"))
+	require.False(t, b.Open("sda"))
+	require.True(t, b.Error("sda"))
+	require.True(t, b.Open("sda"))
+	require.False(t, b.Open("sdb"))
+	require.True(t, deviceBreakerTripped(dir, "sda"))
+	require.False(t, deviceBreakerTripped(dir, "sdb"))
+
+	time.Sleep(60 * time.Millisecond)
+	require.False(t, deviceBreakerTripped(dir, "sda"))
+	require.False(t, b.Open("sda"))
+	_, err = os.Stat(deviceBreakerMarker(dir, "sda"))
+	require.True(t, os.IsNotExist(err))
+	// The count starts over after a cool-down.
+	require.False(t, b.Error("sda"))
+}
+
+func TestDeviceBreakerWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	b := newDeviceBreaker(2, 20*time.Millisecond, time.Minute, dir)
+	require.False(t, b.Error("sda"))
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, b.Error("sda"))
+	require.True(t, b.Error("sda"))
+
+	var disabled *deviceBreaker
+	require.False(t, disabled.Error("sda"))
+	require.False(t, disabled.Open("sda"))
+	require.False(t, newDeviceBreaker(0, time.Minute, time.Minute, dir).Error("sdc"))
+}
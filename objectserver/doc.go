@@ -36,6 +36,23 @@ flow looks like:
 		}
 	}
 
+If the replicator sets Streaming in its BeginReplicationRequest (the
+streaming_sync option) and the server echoes it back, files are instead
+handled in batches, saving a round trip per file:
+
+	replicator sends a SyncFileRequest{MissingCheck: true, Paths []string}
+	server responds with a SyncFileResponse{Wanted []string, Newer []string}
+	for each wanted file {
+		replicator sends a SyncFileRequest{Path string, Xattrs string, Size int, Streamed: true}
+		replicator sends raw file body
+	}
+	replicator sends a SyncFileRequest{MissingCheck: true}
+	server responds with a SyncFileResponse{Saved []string}
+
+A dry run (the -dry-run flag or dry_run option) sends each SyncFileRequest
+with Check set, which the server answers without taking a file, and logs
+per partition how many files and bytes would have been sent and deleted.
+
 The replicator limits concurrency per-device and overall.  When the server
 gets a BeginReplicationRequest, it'll wait up to 60 seconds for a slot to open
 up before rejecting it.
@@ -0,0 +1,371 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"golang.org/x/net/http2"
+)
+
+// The drain state of a device is kept in its ring meta, so an interrupted
+// drain picks up where it left off.
+const (
+	drainStarted = "drain:started"
+	drainDone    = "drain:done"
+)
+
+// drainState returns the drain state recorded in a device's meta.
+func drainState(meta string) string {
+	for _, f := range strings.Fields(meta) {
+		if strings.HasPrefix(f, "drain:") {
+			return f
+		}
+	}
+	return ""
+}
+
+// setDrainState returns meta with its drain state replaced by state.
+func setDrainState(meta, state string) string {
+	fields := []string{}
+	for _, f := range strings.Fields(meta) {
+		if !strings.HasPrefix(f, "drain:") {
+			fields = append(fields, f)
+		}
+	}
+	return strings.Join(append(fields, state), " ")
+}
+
+// drainRingPath is where the ring from before the drain is kept; it says
+// which partitions the device held.
+func drainRingPath(builderPath string, devId int64) string {
+	return fmt.Sprintf("%s.drain-%d.ring.gz", strings.TrimSuffix(builderPath, ".builder"), devId)
+}
+
+func findDrainDevice(builder *ring.RingBuilder, ip, device string) (*ring.RingBuilderDevice, error) {
+	var found *ring.RingBuilderDevice
+	for _, dev := range builder.Devs {
+		if dev == nil || dev.Device != device || (dev.Ip != ip && dev.ReplicationIp != ip) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("More than one device matches %s/%s", ip, device)
+		}
+		found = dev
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No device matches %s/%s", ip, device)
+	}
+	return found, nil
+}
+
+// startDrain keeps a copy of the current ring, then sets the device's weight
+// to zero, marks it as draining and rebalances.
+func startDrain(builderPath string, dev *ring.RingBuilderDevice) error {
+	data, err := ioutil.ReadFile(strings.TrimSuffix(builderPath, ".builder") + ".ring.gz")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(drainRingPath(builderPath, dev.Id), data, 0644); err != nil {
+		return err
+	}
+	devs := []*ring.RingBuilderDevice{dev}
+	if err = ring.SetWeight(builderPath, devs, 0); err != nil {
+		return err
+	}
+	if err = ring.SetInfo(builderPath, devs, "", -1, "", -1, "", setDrainState(dev.Meta, drainStarted), ""); err != nil {
+		return err
+	}
+	_, _, _, err = ring.Rebalance(builderPath, false, false, false)
+	return err
+}
+
+// drainPartsAssigned returns how many partitions the ring still assigns to
+// the device.
+func drainPartsAssigned(r ring.Ring, devId int) int {
+	count := 0
+	for partition := uint64(0); true; partition++ {
+		devs := r.GetNodes(partition)
+		if devs == nil {
+			break
+		}
+		for _, dev := range devs {
+			if dev.Id == devId {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// getDrainJobs creates a job for each partition replica that oldRing had on
+// the device and newRing has put somewhere else.
+func getDrainJobs(oldRing, newRing ring.Ring, devId int, overrideParts []uint64, policy int) []*PriorityRepJob {
+	jobs := make([]*PriorityRepJob, 0)
+	for i := uint64(0); true; i++ {
+		partition := i
+		if len(overrideParts) > 0 {
+			if int(partition) < len(overrideParts) {
+				partition = overrideParts[partition]
+			} else {
+				break
+			}
+		}
+		olddevs := oldRing.GetNodes(partition)
+		newdevs := newRing.GetNodes(partition)
+		if olddevs == nil || newdevs == nil {
+			break
+		}
+		for i := range olddevs {
+			if i < len(newdevs) && olddevs[i].Id == devId && newdevs[i].Id != devId {
+				jobs = append(jobs, &PriorityRepJob{
+					Partition:  partition,
+					FromDevice: olddevs[i],
+					ToDevice:   newdevs[i],
+					Policy:     policy,
+				})
+			}
+		}
+	}
+	return jobs
+}
+
+// checkRingDistributed asks every object server in the ring for the md5 of
+// its copy of the ring file, returning a line for each one that doesn't
+// have the local copy.
+func checkRingDistributed(client common.HTTPClient, r ring.Ring, ringFile string) []string {
+	local, err := common.FileMD5(ringFile)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	want := local[ringFile]
+	var problems []string
+	checked := map[string]bool{}
+	for _, dev := range r.AllDevices() {
+		if dev == nil {
+			continue
+		}
+		url := fmt.Sprintf("%s://%s:%d/recon/ringmd5", dev.Scheme, dev.Ip, dev.Port)
+		if checked[url] {
+			continue
+		}
+		checked[url] = true
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+		var md5s map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&md5s)
+		resp.Body.Close()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+		got := ""
+		for name, md5 := range md5s {
+			if filepath.Base(name) == filepath.Base(ringFile) {
+				got = md5
+			}
+		}
+		if got != want {
+			problems = append(problems, fmt.Sprintf("%s: %s is %q, not %q", url, filepath.Base(ringFile), got, want))
+		}
+	}
+	return problems
+}
+
+func doDrain(args []string, cnf srv.ConfigLoader) int {
+	flags := flag.NewFlagSet("drain", flag.ExitOnError)
+	policyName := flags.String("P", "", "policy to use")
+	builderPath := flags.String("b", "", "builder file to use, instead of the policy's object builder")
+	conc := flags.Int("c", 2, "limit of per device concurrency priority repl calls")
+	certFile := flags.String("certfile", "", "Cert file to use for setting up https client")
+	keyFile := flags.String("keyfile", "", "Key file to use for setting up https client")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: hummingbird drain [ip] [device]\n")
+		fmt.Fprintf(os.Stderr, "  Sets the device's weight to zero and rebalances, checks the new ring is\n")
+		fmt.Fprintf(os.Stderr, "  on every object server, moves the device's partitions to their new primaries,\n")
+		fmt.Fprintf(os.Stderr, "  checks them with a second pass and marks the device as safe to remove.\n")
+		fmt.Fprintf(os.Stderr, "  Run it again to pick up an interrupted drain.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if len(flags.Args()) != 2 {
+		flags.Usage()
+		return 1
+	}
+	ip, device := flags.Arg(0), flags.Arg(1)
+	policyIndex := 0
+	if *policyName != "" {
+		policies, err := conf.GetPolicies()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to load policies:", err)
+			return 1
+		}
+		p := policies.NameLookup(*policyName)
+		if p == nil {
+			fmt.Fprintf(os.Stderr, "Unknown policy named %q\n", *policyName)
+			return 1
+		}
+		policyIndex = p.Index
+	}
+	if *builderPath == "" {
+		var err error
+		if _, *builderPath, err = ring.GetRingBuilder("object", policyIndex); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+	builderLock, err := ring.LockBuilderPath(*builderPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer builderLock.Close()
+	builder, err := ring.NewRingBuilderFromFile(*builderPath, false)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	dev, err := findDrainDevice(builder, ip, device)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	switch drainState(dev.Meta) {
+	case drainDone:
+		fmt.Printf("Device %d (%s/%s) is already drained and safe to remove.\n", dev.Id, ip, device)
+		return 0
+	case drainStarted:
+		fmt.Printf("Resuming drain of device %d (%s/%s).\n", dev.Id, ip, device)
+	default:
+		fmt.Printf("Setting the weight of device %d (%s/%s) to 0 and rebalancing.\n", dev.Id, ip, device)
+		if err = startDrain(*builderPath, dev); err != nil {
+			fmt.Println("Unable to start drain:", err)
+			return 1
+		}
+	}
+
+	hashPathPrefix, hashPathSuffix, err := cnf.GetHashPrefixAndSuffix()
+	if err != nil {
+		fmt.Println("Unable to load hash path prefix and suffix:", err)
+		return 1
+	}
+	ringFile := strings.TrimSuffix(*builderPath, ".builder") + ".ring.gz"
+	oldRing, err := ring.LoadRing(drainRingPath(*builderPath, dev.Id), hashPathPrefix, hashPathSuffix)
+	if err != nil {
+		fmt.Println("Unable to load the ring from before the drain:", err)
+		return 1
+	}
+	newRing, err := ring.LoadRing(ringFile, hashPathPrefix, hashPathSuffix)
+	if err != nil {
+		fmt.Println("Unable to load current ring:", err)
+		return 1
+	}
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 100,
+		MaxIdleConns:        0,
+	}
+	if *certFile != "" && *keyFile != "" {
+		tlsConf, err := common.NewClientTLSConfig(*certFile, *keyFile)
+		if err != nil {
+			fmt.Println("Error getting TLS config:", err)
+			return 1
+		}
+		transport.TLSClientConfig = tlsConf
+		if err = http2.ConfigureTransport(transport); err != nil {
+			fmt.Println("Error setting up http2:", err)
+			return 1
+		}
+	}
+	client := &http.Client{
+		Timeout:   time.Hour * 4,
+		Transport: transport,
+	}
+
+	// Moving data before every node has the new ring would have the
+	// replicators on the old ring's primaries move it straight back.
+	if problems := checkRingDistributed(client, newRing, ringFile); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		fmt.Printf("Distribute %s to every node and run drain again.\n", ringFile)
+		return 1
+	}
+
+	badParts := []uint64{}
+	for pass := 1; ; pass++ {
+		jobs := getDrainJobs(oldRing, newRing, int(dev.Id), badParts, policyIndex)
+		fmt.Printf("Pass %d: moving %d partition replicas.\n", pass, len(jobs))
+		lastBad := len(badParts)
+		badParts = doPriRepJobs(jobs, *conc, client, "Drain")
+		fmt.Printf("Pass %d: moved %d of %d partition replicas.\n", pass, len(jobs)-len(badParts), len(jobs))
+		if len(badParts) == 0 {
+			break
+		}
+		if pass > 1 && len(badParts) >= lastBad {
+			fmt.Printf("%d partitions could not be moved; run drain again to retry them.\n", len(badParts))
+			return 1
+		}
+		time.Sleep(time.Second * 5)
+	}
+
+	if assigned := drainPartsAssigned(newRing, int(dev.Id)); assigned > 0 {
+		fmt.Printf("The ring still assigns %d partitions to the device until min_part_hours passes.\n", assigned)
+		fmt.Println("Rebalance, distribute the ring and run drain again then.")
+		return 1
+	}
+
+	fmt.Println("Verifying that every partition has been synced to its new primaries.")
+	jobs := getDrainJobs(oldRing, newRing, int(dev.Id), nil, policyIndex)
+	if badParts = doPriRepJobs(jobs, *conc, client, "Drain"); len(badParts) > 0 {
+		fmt.Printf("%d partitions failed verification; run drain again to retry them.\n", len(badParts))
+		return 1
+	}
+	if err = ring.SetInfo(*builderPath, []*ring.RingBuilderDevice{dev}, "", -1, "", -1, "", setDrainState(dev.Meta, drainDone), ""); err != nil {
+		fmt.Println("Unable to mark device as drained:", err)
+		return 1
+	}
+	os.Remove(drainRingPath(*builderPath, dev.Id))
+	fmt.Printf("Device %d (%s/%s) is drained and safe to remove:\n", dev.Id, ip, device)
+	fmt.Printf("    hummingbird ring %s remove -ip %s -device %s\n", *builderPath, dev.Ip, dev.Device)
+	return 0
+}
+
+// Drain takes an IP address and device name such as []string{"172.24.0.1", "sda1"}, takes the device out of the object ring and moves its data to the rest of the cluster.
+func Drain(args []string, cnf srv.ConfigLoader) {
+	ret := doDrain(args, cnf)
+	os.Exit(ret)
+}
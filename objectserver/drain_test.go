@@ -0,0 +1,107 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+)
+
+func TestDrainState(t *testing.T) {
+	require.Equal(t, "", drainState("ssd fast"))
+	meta := setDrainState("ssd fast", drainStarted)
+	require.Equal(t, "ssd fast drain:started", meta)
+	require.Equal(t, drainStarted, drainState(meta))
+	meta = setDrainState(meta, drainDone)
+	require.Equal(t, "ssd fast drain:done", meta)
+	require.Equal(t, drainDone, drainState(meta))
+	require.Equal(t, drainStarted, setDrainState("", drainStarted))
+}
+
+func TestGetDrainJobs(t *testing.T) {
+	oldRing := &priFakeRing{
+		mapping: map[uint64][]int{
+			0: {1, 2, 3},
+			1: {4, 5, 6},
+			2: {7, 1, 8},
+		},
+	}
+	newRing := &priFakeRing{
+		mapping: map[uint64][]int{
+			0: {9, 2, 3},
+			1: {4, 5, 6},
+			2: {7, 1, 8},
+		},
+	}
+	jobs := getDrainJobs(oldRing, newRing, 1, nil, 2)
+	require.Equal(t, 1, len(jobs))
+	require.EqualValues(t, 0, jobs[0].Partition)
+	require.Equal(t, 1, jobs[0].FromDevice.Id)
+	require.Equal(t, 9, jobs[0].ToDevice.Id)
+	require.Equal(t, 2, jobs[0].Policy)
+	// Partition 2 hasn't moved yet, say because of min_part_hours.
+	require.Equal(t, 2, drainPartsAssigned(oldRing, 1))
+	require.Equal(t, 1, drainPartsAssigned(newRing, 1))
+
+	newRing.mapping[2] = []int{7, 10, 8}
+	jobs = getDrainJobs(oldRing, newRing, 1, []uint64{2}, 2)
+	require.Equal(t, 1, len(jobs))
+	require.EqualValues(t, 2, jobs[0].Partition)
+	require.Equal(t, 10, jobs[0].ToDevice.Id)
+	require.Equal(t, 0, drainPartsAssigned(newRing, 1))
+}
+
+func TestCheckRingDistributed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ringFile := filepath.Join(dir, "object.ring.gz")
+	require.Nil(t, ioutil.WriteFile(ringFile, []byte("ring"), 0644))
+	md5s := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/recon/ringmd5", r.URL.Path)
+		w.Write([]byte(fmt.Sprintf(`{"/etc/hummingbird/object.ring.gz": %q}`, md5s["object.ring.gz"])))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.Nil(t, err)
+	host, ports, err := net.SplitHostPort(u.Host)
+	require.Nil(t, err)
+	port, err := strconv.Atoi(ports)
+	require.Nil(t, err)
+	r := &priFakeRing{fakeDevs: []*ring.Device{
+		{Id: 0, Device: "sda", Scheme: "http", Ip: host, Port: port},
+		{Id: 1, Device: "sdb", Scheme: "http", Ip: host, Port: port},
+	}}
+
+	md5s["object.ring.gz"] = "stale"
+	problems := checkRingDistributed(http.DefaultClient, r, ringFile)
+	require.Equal(t, 1, len(problems))
+
+	md5s["object.ring.gz"] = "1a5df958e0f29d35594c7cf057fe4bd1"
+	require.Equal(t, 0, len(checkRingDistributed(http.DefaultClient, r, ringFile)))
+}
@@ -67,12 +67,16 @@ type ecEngine struct {
 	nurseryReplicas                int
 	dbPartPower                    int
 	numSubDirs                     int
+	dbBackend                      string
+	syncPolicies                   *syncPolicies
+	reclaimAge                     time.Duration
 	nurseryNotifyStabilizeAttempts tally.Counter
 	nurseryNotifyStabilizeNoop     tally.Counter
 	nurseryNotifyStabilizeFastNoop tally.Counter
 	nurseryNotifyStabilizeFailure  tally.Counter
 	nurseryNotifyStabilizeSuccess  tally.Counter
 	nurseryNotifyStabilizeSkips    tally.Counter
+	metricsScope                   tally.Scope
 }
 
 func (f *ecEngine) getDB(device string) (*IndexDB, error) {
@@ -86,10 +90,16 @@ func (f *ecEngine) getDB(device string) (*IndexDB, error) {
 	path := filepath.Join(f.driveRoot, device, PolicyDir(f.policy), "hec")
 	temppath := filepath.Join(f.driveRoot, device, "tmp")
 	ringPartPower := bits.Len64(f.ring.PartitionCount() - 1)
-	f.idbs[device], err = NewIndexDB(dbpath, path, temppath, ringPartPower, f.dbPartPower, f.numSubDirs, f.reserve, f.logger, ecAuditor{})
+	f.idbs[device], err = NewIndexDBWithBackend(f.dbBackend, dbpath, path, temppath, ringPartPower, f.dbPartPower, f.numSubDirs, f.reserve, f.logger, ecAuditor{})
 	if err != nil {
 		return nil, err
 	}
+	if f.syncPolicies.configured(device) {
+		f.idbs[device].SetSyncPolicy(f.syncPolicies.forDevice(device))
+	}
+	if f.metricsScope != nil {
+		f.idbs[device].SetMetrics(f.metricsScope, fmt.Sprintf("%d_%s_", f.policy, device))
+	}
 	return f.idbs[device], nil
 }
 
@@ -121,7 +131,8 @@ func (f *ecEngine) New(vars map[string]string, needData bool, asyncWG *sync.Wait
 			if err = json.Unmarshal(item.Metabytes, &obj.metadata); err != nil {
 				return nil, fmt.Errorf("Error parsing metadata: %v", err)
 			}
-			if !item.Deletion {
+			// The index row has everything a metadata only HEAD needs.
+			if !item.Deletion && vars[metadataOnlyVar] != "true" {
 				if fi, err := os.Stat(item.Path); err != nil {
 					obj.Quarantine()
 					return nil, err
@@ -431,6 +442,7 @@ func (f *ecEngine) GetObjectsToReplicate(prirep PriorityRepJob, c chan ObjectSta
 	req, err := http.NewRequest("GET", url, nil)
 	req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(prirep.Policy))
 	req.Header.Set("User-Agent", "nursery-stabilizer")
+	req.Header.Set(RequestClassHeader, requestClassReplication)
 	resp, err := f.client.Do(req)
 
 	var remoteItems []*IndexDBItem
@@ -535,6 +547,7 @@ func (f *ecEngine) listPartitionHandler(writer http.ResponseWriter, request *htt
 }
 
 func (f *ecEngine) RegisterHandlers(addRoute func(method, path string, handler http.HandlerFunc), metScope tally.Scope) {
+	f.metricsScope = metScope
 	f.nurseryNotifyStabilizeAttempts = metScope.Counter(fmt.Sprintf("%d_stabilize_notify_attempts", f.policy))
 	f.nurseryNotifyStabilizeNoop = metScope.Counter(fmt.Sprintf("%d_stabilize_notify_noops", f.policy))
 	f.nurseryNotifyStabilizeFastNoop = metScope.Counter(fmt.Sprintf("%d_stabilize_notify_fast_noops", f.policy))
@@ -594,6 +607,11 @@ func (f *ecEngine) getObjectsToStabilize(device *ring.Device, c chan ObjectStabi
 		return
 	}
 	idb.ExpireObjects()
+	if n, err := idb.ReclaimTombstones(f.reclaimAge); err != nil {
+		f.logger.Error("ReclaimTombstones error", zap.Error(err))
+	} else if n > 0 {
+		f.logger.Debug("reclaimed tombstones", zap.String("device", device.Device), zap.Int64("count", n))
+	}
 
 	idbItems, err := idb.ListObjectsToStabilize()
 	if err != nil {
@@ -659,6 +677,14 @@ func ecEngineConstructor(config conf.Config, policy *conf.Policy, flags *flag.Fl
 	if err != nil {
 		return nil, err
 	}
+	dbBackend, err := policy.GetDbBackend()
+	if err != nil {
+		return nil, err
+	}
+	sp, err := newSyncPolicies(config, policy)
+	if err != nil {
+		return nil, err
+	}
 	certFile := config.GetDefault("app:object-server", "cert_file", "")
 	keyFile := config.GetDefault("app:object-server", "key_file", "")
 	transport := &http.Transport{
@@ -700,6 +726,9 @@ func ecEngineConstructor(config conf.Config, policy *conf.Policy, flags *flag.Fl
 		stabItems:      map[string]bool{},
 		dbPartPower:    int(dbPartPower),
 		numSubDirs:     subdirs,
+		dbBackend:      dbBackend,
+		syncPolicies:   sp,
+		reclaimAge:     time.Duration(config.GetInt("app:object-server", "reclaim_age", int64(common.ONE_WEEK))) * time.Second,
 		client:         httpClient,
 	}
 	if engine.logger, err = srv.SetupLogger("ecengine", &logLevel, flags); err != nil {
@@ -314,3 +314,36 @@ func TestGetObjectsToStabilize(t *testing.T) {
 	require.Equal(t, "o1", os1.Metadata()["name"])
 	require.Equal(t, "o2", os2.Metadata()["name"])
 }
+
+func TestNewMetadataOnly(t *testing.T) {
+	ece, dr, err := getTestEce(nil)
+	if dr != "" {
+		defer os.RemoveAll(dr)
+	}
+	require.Nil(t, err)
+	idb, err := ece.getDB("sdb1")
+	require.Nil(t, err)
+
+	vars := map[string]string{"device": "sdb1", "account": "a", "container": "c", "obj": "o"}
+	hsh := ObjHash(vars, "a", "b")
+	timestamp := time.Now().UnixNano()
+	body := "just testing"
+	f, err := idb.TempFile(hsh, 0, timestamp, int64(len(body)), true)
+	require.Nil(t, err)
+	f.Write([]byte(body))
+	require.Nil(t, idb.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{"Content-Length": strconv.Itoa(len(body)), "ETag": "abc"}, true, ""))
+	item, err := idb.Lookup(hsh, shardAny, false)
+	require.Nil(t, err)
+	require.Nil(t, os.Remove(item.Path))
+
+	vars[metadataOnlyVar] = "true"
+	obj, err := ece.New(vars, false, nil)
+	require.Nil(t, err)
+	require.True(t, obj.Exists())
+	require.Equal(t, "abc", obj.Metadata()["ETag"])
+	require.Equal(t, int64(len(body)), obj.ContentLength())
+
+	delete(vars, metadataOnlyVar)
+	_, err = ece.New(vars, false, nil)
+	require.NotNil(t, err)
+}
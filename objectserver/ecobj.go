@@ -308,6 +308,9 @@ func (o *ecObject) commit(metadata map[string]string, method string, nursery boo
 	if !nursery {
 		shard = o.Shard
 	}
+	if method == "CREATE" {
+		return o.idb.CommitNew(o.afw, o.Hash, shard, timestamp, metadata, nursery, "")
+	}
 	return o.idb.Commit(o.afw, o.Hash, shard, timestamp, method, metadata, nursery, "")
 }
 
@@ -315,6 +318,10 @@ func (o *ecObject) Commit(metadata map[string]string) error {
 	return o.commit(metadata, "PUT", true)
 }
 
+func (o *ecObject) CommitNew(metadata map[string]string) error {
+	return o.commit(metadata, "CREATE", true)
+}
+
 func (o *ecObject) Delete(metadata map[string]string) error {
 	return o.commit(metadata, "DELETE", true)
 }
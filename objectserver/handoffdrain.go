@@ -0,0 +1,202 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+// handoffDrainer moves the handoff partitions of the replicator's devices to
+// their primaries ahead of the regular scan.  With write affinity the proxy
+// puts new objects on handoffs in its own region, and those can pile up for
+// as long as a full replication pass takes; the drainer goes after the
+// partitions whose primaries are in another region first, with its own
+// concurrency limit so the scan doesn't hold it up.
+type handoffDrainer struct {
+	r        *Replicator
+	sem      chan struct{}
+	interval time.Duration
+	lock     sync.Mutex
+	active   map[string]bool
+}
+
+func newHandoffDrainer(r *Replicator, concurrency int, interval time.Duration) *handoffDrainer {
+	return &handoffDrainer{
+		r:        r,
+		sem:      make(chan struct{}, concurrency),
+		interval: interval,
+		active:   map[string]bool{},
+	}
+}
+
+// claim marks a device's partition as being worked on, by the drainer or the
+// scan, returning false if the other already has it.  Both may replicate a
+// handoff partition and remove its files, so they take turns.  With no
+// drainer, there's nothing to take turns with.
+func (d *handoffDrainer) claim(key, partition string) bool {
+	if d == nil {
+		return true
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.active[key+"/"+partition] {
+		return false
+	}
+	d.active[key+"/"+partition] = true
+	return true
+}
+
+// release gives up a claim on a device's partition.
+func (d *handoffDrainer) release(key, partition string) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.active, key+"/"+partition)
+}
+
+// affinityDebt reports whether any of a partition's primaries are outside
+// the device's region, which is where write affinity leaves data.
+func affinityDebt(oring ring.Ring, dev *ring.Device, partition string) bool {
+	partitioni, err := strconv.ParseUint(partition, 10, 64)
+	if err != nil {
+		return false
+	}
+	for _, node := range oring.GetNodes(partitioni) {
+		if node.Region != dev.Region {
+			return true
+		}
+	}
+	return false
+}
+
+// orderHandoffs puts the partitions owed to other regions ahead of the rest,
+// keeping the order of each.
+func orderHandoffs(oring ring.Ring, dev *ring.Device, partitions []string) []string {
+	debt := make(map[string]bool, len(partitions))
+	for _, partition := range partitions {
+		debt[partition] = affinityDebt(oring, dev, partition)
+	}
+	sort.SliceStable(partitions, func(i, j int) bool {
+		return debt[partitions[i]] && !debt[partitions[j]]
+	})
+	return partitions
+}
+
+type handoffDrainJob struct {
+	rd     HandoffDrainer
+	dev    *ring.Device
+	policy int
+}
+
+// jobs returns the running replication devices that can be drained.
+func (d *handoffDrainer) jobs() []handoffDrainJob {
+	d.r.runningDevicesLock.Lock()
+	defer d.r.runningDevicesLock.Unlock()
+	var jobs []handoffDrainJob
+	for policy, oring := range d.r.objectRings {
+		devs, err := oring.LocalDevices(d.r.port)
+		if err != nil {
+			d.r.logger.Error("[handoffDrain] Error getting local devices from ring", zap.Int("policy", policy), zap.Error(err))
+			continue
+		}
+		for _, dev := range devs {
+			if rd, ok := d.r.runningDevices[deviceKeyId(dev.Device, policy)].(HandoffDrainer); ok {
+				jobs = append(jobs, handoffDrainJob{rd: rd, dev: dev, policy: policy})
+			}
+		}
+	}
+	return jobs
+}
+
+// drainDevice pushes each of a device's handoff partitions to its primaries.
+func (d *handoffDrainer) drainDevice(job handoffDrainJob) {
+	defer srv.LogPanics(d.r.logger, fmt.Sprintf("PANIC DRAINING HANDOFFS: %s", job.dev.Device))
+	prefix := fmt.Sprintf("%d_%s_handoff_drain_", job.policy, job.dev.Device)
+	partitions, err := job.rd.HandoffPartitions()
+	if err != nil {
+		d.r.logger.Error("[handoffDrain] Error getting handoff partition list", zap.String("Device", job.dev.Device), zap.Int("Policy", job.policy), zap.Error(err))
+		return
+	}
+	partitions = orderHandoffs(d.r.objectRings[job.policy], job.dev, partitions)
+	pending := int64(len(partitions))
+	pendingMetric := d.r.metricsScope.Gauge(prefix + "pending")
+	pendingMetric.Update(float64(pending))
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for _, partition := range partitions {
+		d.sem <- struct{}{}
+		if !d.claim(job.rd.Key(), partition) {
+			// the scan is replicating it already
+			<-d.sem
+			pendingMetric.Update(float64(atomic.AddInt64(&pending, -1)))
+			continue
+		}
+		wg.Add(1)
+		go func(partition string) {
+			defer wg.Done()
+			defer func() {
+				d.release(job.rd.Key(), partition)
+				<-d.sem
+			}()
+			files, err := job.rd.DrainHandoff(partition)
+			d.r.metricsScope.Counter(prefix + "files_sent").Inc(files)
+			if err != nil {
+				d.r.metricsScope.Counter(prefix + "errors").Inc(1)
+				d.r.logger.Error("[handoffDrain] Error draining handoff partition", zap.String("Device", job.dev.Device), zap.Int("Policy", job.policy), zap.String("Partition", partition), zap.Error(err))
+			} else {
+				d.r.metricsScope.Counter(prefix + "partitions").Inc(1)
+			}
+			pendingMetric.Update(float64(atomic.AddInt64(&pending, -1)))
+		}(partition)
+	}
+	wg.Wait()
+	d.r.metricsScope.Timer(prefix + "duration").Record(time.Since(start))
+	if len(partitions) > 0 {
+		d.r.logger.Info("[handoffDrain] Completed handoff drain pass", zap.String("Device", job.dev.Device), zap.Int("Policy", job.policy), zap.Int("handoffsProcessed", len(partitions)), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// drain makes one pass over the handoffs of all the running devices.
+func (d *handoffDrainer) drain() {
+	wg := sync.WaitGroup{}
+	for _, job := range d.jobs() {
+		wg.Add(1)
+		go func(job handoffDrainJob) {
+			defer wg.Done()
+			d.drainDevice(job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// run drains the handoffs every interval, forever.
+func (d *handoffDrainer) run() {
+	for {
+		time.Sleep(d.interval)
+		d.drain()
+	}
+}
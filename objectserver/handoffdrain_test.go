@@ -0,0 +1,96 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+)
+
+type regionRing struct {
+	test.FakeRing
+	nodes map[uint64][]*ring.Device
+}
+
+func (r *regionRing) GetNodes(partition uint64) []*ring.Device {
+	return r.nodes[partition]
+}
+
+// claimed reports whether a device's partition is being worked on.
+func (d *handoffDrainer) claimed(key, partition string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.active[key+"/"+partition]
+}
+
+func TestOrderHandoffs(t *testing.T) {
+	oring := &regionRing{nodes: map[uint64][]*ring.Device{
+		1: {{Region: 1}, {Region: 1}},
+		2: {{Region: 1}, {Region: 2}},
+		3: {{Region: 1}},
+		4: {{Region: 2}},
+	}}
+	require.Equal(t, []string{"2", "4", "1", "3"}, orderHandoffs(oring, &ring.Device{Region: 1}, []string{"1", "2", "3", "4"}))
+}
+
+func TestHandoffDrainDevice(t *testing.T) {
+	testRing := &test.FakeRing{MockGetMoreNodes: &NoMoreNodes{}, MockGetJobNodesHandoff: true}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	replicator, _, err := newTestReplicator(confLoader, "bind_port", "1234", "check_mounts", "no")
+	require.Nil(t, err)
+	drainer := newHandoffDrainer(replicator, 2, time.Minute)
+	replicator.handoffDrain = drainer
+	rd := newPatchableReplicationDevice(testRing, replicator)
+	rd._listPartitions = func() ([]string, []string, error) {
+		return []string{"1", "2", "3"}, []string{"2", "3"}, nil
+	}
+	var lock sync.Mutex
+	drained := map[string]bool{}
+	rd._replicateAll = func(rjob replJob, isHandoff bool) {
+		lock.Lock()
+		defer lock.Unlock()
+		drained[rjob.partition] = isHandoff && drainer.claimed(rd.Key(), rjob.partition)
+	}
+
+	// the scan skips a partition the drainer has, and the other way around
+	require.True(t, drainer.claim(rd.Key(), "2"))
+	rd.replicatePartition("2")
+	require.Empty(t, drained)
+	drainer.drainDevice(handoffDrainJob{rd: rd, dev: rd.dev, policy: 0})
+	require.Equal(t, map[string]bool{"3": true}, drained)
+	drainer.release(rd.Key(), "2")
+	delete(drained, "3")
+
+	// the drainer doesn't wait on the scan's concurrency
+	replicator.replicateConcurrencySem <- struct{}{}
+	drainer.drainDevice(handoffDrainJob{rd: rd, dev: rd.dev, policy: 0})
+	require.Equal(t, map[string]bool{"2": true, "3": true}, drained)
+	require.False(t, drainer.claimed(rd.Key(), "2"))
+	require.False(t, drainer.claimed(rd.Key(), "3"))
+	<-replicator.replicateConcurrencySem
+
+	// the scan holds its partition while it replicates it
+	delete(drained, "3")
+	rd.replicatePartition("3")
+	require.True(t, drained["3"])
+	require.False(t, drainer.claimed(rd.Key(), "3"))
+}
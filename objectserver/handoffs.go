@@ -0,0 +1,207 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+// HandoffPartition is a partition a device holds that the ring has assigned
+// elsewhere, waiting for replication to move it.
+type HandoffPartition struct {
+	Device    string
+	Policy    int
+	Partition uint64
+	Objects   int64
+	Bytes     int64
+}
+
+// dirHandoffs finds the handoff partitions of a policy stored as one
+// directory per partition.
+func dirHandoffs(oring ring.Ring, dev *ring.Device, policy int, policyDir string) ([]*HandoffPartition, error) {
+	entries, err := ioutil.ReadDir(policyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var handoffs []*HandoffPartition
+	for _, entry := range entries {
+		partition, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if _, handoff := oring.GetJobNodes(partition, dev.Id); !handoff {
+			continue
+		}
+		hp := &HandoffPartition{Device: dev.Device, Policy: policy, Partition: partition}
+		filepath.Walk(filepath.Join(policyDir, entry.Name()), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				if filepath.Ext(path) == ".data" {
+					hp.Objects++
+				}
+				hp.Bytes += info.Size()
+			}
+			return nil
+		})
+		handoffs = append(handoffs, hp)
+	}
+	sort.Slice(handoffs, func(i, j int) bool { return handoffs[i].Partition < handoffs[j].Partition })
+	return handoffs, nil
+}
+
+// indexHandoffs finds the handoff partitions of a policy that keeps its
+// objects in an IndexDB.
+func indexHandoffs(oring ring.Ring, dev *ring.Device, policy int, idb *IndexDB) ([]*HandoffPartition, error) {
+	items, err := idb.List("", "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+	byPartition := map[uint64]*HandoffPartition{}
+	var handoffs []*HandoffPartition
+	for _, item := range items {
+		partition, err := oring.PartitionForHash(item.Hash)
+		if err != nil {
+			return nil, err
+		}
+		hp, ok := byPartition[partition]
+		if !ok {
+			if _, handoff := oring.GetJobNodes(partition, dev.Id); handoff {
+				hp = &HandoffPartition{Device: dev.Device, Policy: policy, Partition: partition}
+				handoffs = append(handoffs, hp)
+			}
+			byPartition[partition] = hp
+		}
+		if hp == nil || item.Deletion {
+			continue
+		}
+		hp.Objects++
+		if item.Path, err = idb.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery); err != nil {
+			return nil, err
+		}
+		if size, err := itemSize(item); err == nil {
+			hp.Bytes += size
+		}
+	}
+	sort.Slice(handoffs, func(i, j int) bool { return handoffs[i].Partition < handoffs[j].Partition })
+	return handoffs, nil
+}
+
+// RunHandoffs lists the handoff partitions held by the node's devices, with
+// how many objects and bytes each holds, so operators can see how much is
+// still waiting to drain after a failure or a rebalance.
+func RunHandoffs(flags *flag.FlagSet, cnf srv.ConfigLoader) {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	node := flags.Arg(0)
+	configFile := flags.Lookup("c").Value.(flag.Getter).Get().(string)
+	onlyPolicy := flags.Lookup("policy").Value.(flag.Getter).Get().(int)
+	configs, err := conf.LoadConfigs(configFile)
+	if err != nil || len(configs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error finding configs: %v\n", err)
+		os.Exit(1)
+	}
+	driveRoot := configs[0].GetDefault("app:object-server", "devices", "/srv/node")
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policies: %v\n", err)
+		os.Exit(1)
+	}
+	hashPathPrefix, hashPathSuffix, err := cnf.GetHashPrefixAndSuffix()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load hashpath prefix and suffix: %v\n", err)
+		os.Exit(1)
+	}
+	var totalObjects, totalBytes int64
+	totalPartitions := 0
+	for _, policy := range policies {
+		if onlyPolicy >= 0 && policy.Index != onlyPolicy {
+			continue
+		}
+		oring, err := cnf.GetRing("object", hashPathPrefix, hashPathSuffix, policy.Index)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading ring for policy %d: %v\n", policy.Index, err)
+			os.Exit(1)
+		}
+		for _, dev := range oring.AllDevices() {
+			if dev == nil || (dev.Ip != node && dev.ReplicationIp != node) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(driveRoot, dev.Device)); err != nil {
+				continue
+			}
+			policyDir := filepath.Join(driveRoot, dev.Device, PolicyDir(policy.Index))
+			var handoffs []*HandoffPartition
+			if policy.Type == "repng" || policy.Type == "hec" {
+				handoffs, err = policyIndexHandoffs(oring, dev, policy, policyDir, driveRoot)
+			} else {
+				handoffs, err = dirHandoffs(oring, dev, policy.Index, policyDir)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing %s for policy %d: %v\n", dev.Device, policy.Index, err)
+				continue
+			}
+			for _, hp := range handoffs {
+				fmt.Printf("%s\tpolicy %d\tpartition %d\t%d objects\t%d bytes\n", hp.Device, hp.Policy, hp.Partition, hp.Objects, hp.Bytes)
+				totalObjects += hp.Objects
+				totalBytes += hp.Bytes
+			}
+			totalPartitions += len(handoffs)
+		}
+	}
+	fmt.Printf("%d handoff partitions, %d objects, %d bytes\n", totalPartitions, totalObjects, totalBytes)
+}
+
+func policyIndexHandoffs(oring ring.Ring, dev *ring.Device, policy *conf.Policy, policyDir, driveRoot string) ([]*HandoffPartition, error) {
+	dbpath := filepath.Join(policyDir, fmt.Sprintf("%s.db", policy.Type))
+	if _, err := os.Stat(dbpath); err != nil {
+		return nil, nil
+	}
+	dbPartPower, err := policy.GetDbPartPower()
+	if err != nil {
+		return nil, err
+	}
+	subdirs, err := policy.GetDbSubDirs()
+	if err != nil {
+		return nil, err
+	}
+	backend, err := policy.GetDbBackend()
+	if err != nil {
+		return nil, err
+	}
+	idb, err := NewIndexDBWithBackend(backend, dbpath, filepath.Join(policyDir, policy.Type), filepath.Join(driveRoot, dev.Device, "tmp"),
+		bits.Len64(oring.PartitionCount()-1), int(dbPartPower), subdirs, 0, zap.L(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer idb.Close()
+	return indexHandoffs(oring, dev, policy.Index, idb)
+}
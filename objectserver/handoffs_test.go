@@ -0,0 +1,94 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+// oddHandoffRing makes every odd partition a handoff, and puts a hash in
+// the partition named by its first hex digit.
+type oddHandoffRing struct {
+	*test.FakeRing
+}
+
+func (r oddHandoffRing) GetJobNodes(partition uint64, localDevice int) ([]*ring.Device, bool) {
+	return nil, partition%2 == 1
+}
+
+func (r oddHandoffRing) PartitionForHash(hsh string) (uint64, error) {
+	return strconv.ParseUint(hsh[:1], 16, 64)
+}
+
+func TestDirHandoffs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, partition := range []string{"1", "2", "11"} {
+		hashDir := filepath.Join(dir, partition, "abc", "fffffffffffffffffffffffffffffabc")
+		require.Nil(t, os.MkdirAll(hashDir, 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(hashDir, "1425753549.99999.data"), []byte("data"), 0644))
+	}
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "tmp"), 0755))
+	handoffs, err := dirHandoffs(oddHandoffRing{&test.FakeRing{}}, &ring.Device{Device: "sda"}, 1, dir)
+	require.Nil(t, err)
+	require.Equal(t, []*HandoffPartition{
+		{Device: "sda", Policy: 1, Partition: 1, Objects: 1, Bytes: 4},
+		{Device: "sda", Policy: 1, Partition: 11, Objects: 1, Bytes: 4},
+	}, handoffs)
+
+	handoffs, err = dirHandoffs(oddHandoffRing{&test.FakeRing{}}, &ring.Device{Device: "sda"}, 1, filepath.Join(dir, "missing"))
+	require.Nil(t, err)
+	require.Equal(t, 0, len(handoffs))
+}
+
+func TestIndexHandoffs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	idb, err := NewIndexDB(dir, dir, dir, 4, 1, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	require.Nil(t, err)
+	defer idb.Close()
+	timestamp := time.Now().UnixNano()
+	for _, hsh := range []string{
+		"10000000000000000000000000000000",
+		"1f000000000000000000000000000000",
+		"20000000000000000000000000000000",
+		"30000000000000000000000000000000",
+	} {
+		f, err := idb.TempFile(hsh, 0, timestamp, 4, false)
+		require.Nil(t, err)
+		f.Write([]byte("data"))
+		require.Nil(t, idb.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{}, false, ""))
+	}
+	require.Nil(t, idb.Commit(nil, "3f000000000000000000000000000000", 0, timestamp, "DELETE", map[string]string{}, false, ""))
+	handoffs, err := indexHandoffs(oddHandoffRing{&test.FakeRing{}}, &ring.Device{Device: "sda"}, 2, idb)
+	require.Nil(t, err)
+	require.Equal(t, []*HandoffPartition{
+		{Device: "sda", Policy: 2, Partition: 1, Objects: 2, Bytes: 8},
+		{Device: "sda", Policy: 2, Partition: 3, Objects: 1, Bytes: 4},
+	}, handoffs)
+}
@@ -0,0 +1,275 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+// indexBackupPages is how many pages BackupIndexFile copies at a time; the
+// database is only locked while each step runs, so the object server can
+// keep writing to it between steps.
+const indexBackupPages = 256
+
+// BackupIndexFile makes a consistent copy of the sqlite index file src at
+// dst using sqlite's online backup API, so it's safe to run while the
+// object server is using the index.
+func BackupIndexFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	driver := &sqlite3.SQLiteDriver{}
+	srcConn, err := driver.Open("file:" + src + "?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := driver.Open("file:" + tmp + "?mode=rwc")
+	if err != nil {
+		return err
+	}
+	backup, err := dstConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		dstConn.Close()
+		return err
+	}
+	for {
+		done, err := backup.Step(indexBackupPages)
+		if err != nil {
+			backup.Close()
+			dstConn.Close()
+			return err
+		}
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = backup.Close(); err != nil {
+		dstConn.Close()
+		return err
+	}
+	if err = dstConn.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// indexFiles returns the sqlite index files of each repng and hec policy on
+// device, relative to the device's directory.  Badger indexes are skipped,
+// as they have no equivalent of the sqlite backup API.
+func indexFiles(driveRoot, device string, policies conf.PolicyList) ([]string, error) {
+	var files []string
+	for _, policy := range policies {
+		if policy.Type != "repng" && policy.Type != "hec" {
+			continue
+		}
+		if backend, err := policy.GetDbBackend(); err != nil {
+			return nil, err
+		} else if backend != IndexBackendSQLite {
+			fmt.Fprintf(os.Stderr, "Skipping policy %d: only sqlite indexes can be backed up\n", policy.Index)
+			continue
+		}
+		dbpath := filepath.Join(PolicyDir(policy.Index), fmt.Sprintf("%s.db", policy.Type))
+		matches, err := filepath.Glob(filepath.Join(driveRoot, device, dbpath, "index.db.*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if name := filepath.Base(match); strings.HasSuffix(name, "-wal") || strings.HasSuffix(name, "-shm") || strings.HasSuffix(name, "-journal") || strings.HasSuffix(name, ".tmp") {
+				continue
+			}
+			files = append(files, filepath.Join(dbpath, filepath.Base(match)))
+		}
+	}
+	return files, nil
+}
+
+// uploadIndexFile PUTs a backed up index file to url, which would usually be
+// a container in an object store.
+func uploadIndexFile(client *http.Client, url, token, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", url, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func loadIndexBackupConfig(flags *flag.FlagSet, cnf srv.ConfigLoader) (string, conf.PolicyList) {
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	configFile := flags.Lookup("c").Value.(flag.Getter).Get().(string)
+	configs, err := conf.LoadConfigs(configFile)
+	if err != nil || len(configs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error finding configs: %v\n", err)
+		os.Exit(1)
+	}
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policies: %v\n", err)
+		os.Exit(1)
+	}
+	return configs[0].GetDefault("app:object-server", "devices", "/srv/node"), policies
+}
+
+// RunIndexBackup backs up the object indexes of the devices named on the
+// command line into a directory, laid out as they are on the device, and
+// optionally uploads them.
+func RunIndexBackup(flags *flag.FlagSet, cnf srv.ConfigLoader) {
+	driveRoot, policies := loadIndexBackupConfig(flags, cnf)
+	output := flags.Lookup("o").Value.(flag.Getter).Get().(string)
+	url := strings.TrimRight(flags.Lookup("url").Value.(flag.Getter).Get().(string), "/")
+	token := flags.Lookup("token").Value.(flag.Getter).Get().(string)
+	client := &http.Client{Timeout: 10 * time.Minute}
+	failed := false
+	for _, device := range flags.Args() {
+		files, err := indexFiles(driveRoot, device, policies)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding indexes on %s: %v\n", device, err)
+			os.Exit(1)
+		}
+		for _, file := range files {
+			dst := filepath.Join(output, device, file)
+			if err := BackupIndexFile(filepath.Join(driveRoot, device, file), dst); err != nil {
+				fmt.Fprintf(os.Stderr, "Error backing up %s on %s: %v\n", file, device, err)
+				failed = true
+				continue
+			}
+			if url != "" {
+				if err := uploadIndexFile(client, url+"/"+device+"/"+filepath.ToSlash(file), token, dst); err != nil {
+					fmt.Fprintf(os.Stderr, "Error uploading %s on %s: %v\n", file, device, err)
+					failed = true
+					continue
+				}
+			}
+			fmt.Printf("Backed up %s on %s\n", file, device)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// RestoreIndexFile replaces the index file dst with the backup src.  Any
+// write-ahead log belonging to the old file is removed, since replaying it
+// against the restored file would corrupt it.
+func RestoreIndexFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dst + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
+
+// RunIndexRestore puts the object indexes backed up by RunIndexBackup back
+// on the devices named on the command line.  The object servers must be
+// stopped while it runs.
+func RunIndexRestore(flags *flag.FlagSet, cnf srv.ConfigLoader) {
+	driveRoot, policies := loadIndexBackupConfig(flags, cnf)
+	input := flags.Lookup("i").Value.(flag.Getter).Get().(string)
+	force := flags.Lookup("f").Value.(flag.Getter).Get().(bool)
+	failed := false
+	for _, device := range flags.Args() {
+		files, err := indexFiles(input, device, policies)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding backups for %s: %v\n", device, err)
+			os.Exit(1)
+		}
+		if len(files) == 0 {
+			fmt.Fprintf(os.Stderr, "No backups found for %s in %s\n", device, input)
+			failed = true
+			continue
+		}
+		for _, file := range files {
+			dst := filepath.Join(driveRoot, device, file)
+			if _, err := os.Stat(dst); err == nil && !force {
+				fmt.Fprintf(os.Stderr, "Not replacing existing %s on %s without -f\n", file, device)
+				failed = true
+				continue
+			}
+			if err := RestoreIndexFile(filepath.Join(input, device, file), dst); err != nil {
+				fmt.Fprintf(os.Stderr, "Error restoring %s on %s: %v\n", file, device, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("Restored %s on %s\n", file, device)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,77 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/conf"
+	"go.uber.org/zap"
+)
+
+func TestIndexBackupRestore(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	dbpath := filepath.Join(root, "sda", "objects-1", "repng.db")
+	objpath := filepath.Join(root, "sda", "objects-1", "repng")
+	ot, err := NewIndexDB(dbpath, objpath, root, 8, 1, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	require.Nil(t, err)
+	timestamp := time.Now().UnixNano()
+	for i := 0; i < 10; i++ {
+		hsh := md5hash("object" + strconv.Itoa(i))
+		f, err := ot.TempFile(hsh, 0, timestamp, 4, true)
+		require.Nil(t, err)
+		f.Write([]byte("data"))
+		require.Nil(t, ot.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{}, true, ""))
+	}
+	want, err := ot.List("", "", "", 0)
+	require.Nil(t, err)
+
+	policies := conf.PolicyList{
+		0: &conf.Policy{Index: 0, Type: "replication"},
+		1: &conf.Policy{Index: 1, Type: "repng", Config: map[string]string{}},
+	}
+	files, err := indexFiles(root, "sda", policies)
+	require.Nil(t, err)
+	require.Equal(t, ot.dbCount(), len(files))
+	backup := filepath.Join(root, "backup")
+	for _, file := range files {
+		require.Nil(t, BackupIndexFile(filepath.Join(root, "sda", file), filepath.Join(backup, "sda", file)))
+	}
+	backedUp, err := indexFiles(backup, "sda", policies)
+	require.Nil(t, err)
+	require.Equal(t, files, backedUp)
+
+	// Lose the index, then put it back.
+	ot.Close()
+	require.Nil(t, os.RemoveAll(dbpath))
+	for _, file := range files {
+		require.Nil(t, RestoreIndexFile(filepath.Join(backup, "sda", file), filepath.Join(root, "sda", file)))
+	}
+	ot, err = NewIndexDB(dbpath, objpath, root, 8, 1, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	require.Nil(t, err)
+	defer ot.Close()
+	got, err := ot.List("", "", "", 0)
+	require.Nil(t, err)
+	require.Equal(t, want, got)
+}
@@ -0,0 +1,186 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+// convertBatchSize is about how many rows ConvertIndexDB reads and writes at
+// a time.
+var convertBatchSize = 1000
+
+// ConvertIndexDB copies every row of from's index into to's, returning how
+// many rows it copied.  The two must share their object files, so they need
+// the same paths and part powers; only the backend differs.  Nothing should
+// be writing to from while it runs.
+func ConvertIndexDB(from, to *IndexDB) (int, error) {
+	if from.dbPartPower != to.dbPartPower || from.RingPartPower != to.RingPartPower {
+		return 0, fmt.Errorf("part powers differ: %d/%d and %d/%d", from.RingPartPower, from.dbPartPower, to.RingPartPower, to.dbPartPower)
+	}
+	copied := 0
+	for dbPart := 0; dbPart < from.dbCount(); dbPart++ {
+		marker := ""
+		for {
+			items, err := from.store.list(dbPart, "00000000000000000000000000000000", "ffffffffffffffffffffffffffffffff", marker, convertBatchSize)
+			if err != nil {
+				return copied, err
+			}
+			if len(items) == 0 {
+				break
+			}
+			full := len(items) == convertBatchSize
+			if full {
+				// The next batch starts after the last hash, which may have
+				// more rows than made it into this one, so its rows are all
+				// read on their own.
+				last := items[len(items)-1].Hash
+				for len(items) > 0 && items[len(items)-1].Hash == last {
+					items = items[:len(items)-1]
+				}
+				rest, err := from.store.list(dbPart, last, last, "", 0)
+				if err != nil {
+					return copied, err
+				}
+				items = append(items, rest...)
+			}
+			if err = to.store.put(dbPart, items); err != nil {
+				return copied, err
+			}
+			copied += len(items)
+			if !full {
+				break
+			}
+			marker = items[len(items)-1].Hash
+		}
+	}
+	return copied, nil
+}
+
+// RunIndexConvert converts the object indexes on this server's devices from
+// one backend to another, for each object server config.  It's for switching
+// a policy's db_backend, with the object servers stopped; the old index is
+// left in place.
+func RunIndexConvert(flags *flag.FlagSet, cnf srv.ConfigLoader) {
+	configFile := flags.Lookup("c").Value.(flag.Getter).Get().(string)
+	fromBackend := flags.Lookup("from").Value.(flag.Getter).Get().(string)
+	toBackend := flags.Lookup("to").Value.(flag.Getter).Get().(string)
+	for _, backend := range []string{fromBackend, toBackend} {
+		if backend != IndexBackendSQLite && backend != IndexBackendBadger {
+			fmt.Fprintf(os.Stderr, "Unknown index backend %q\n", backend)
+			os.Exit(1)
+		}
+	}
+	if fromBackend == toBackend {
+		fmt.Fprintf(os.Stderr, "Nothing to do converting from %s to %s\n", fromBackend, toBackend)
+		os.Exit(1)
+	}
+	configs, err := conf.LoadConfigs(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding configs: %v\n", err)
+		os.Exit(1)
+	}
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policies: %v\n", err)
+		os.Exit(1)
+	}
+	hashPathPrefix, hashPathSuffix, err := cnf.GetHashPrefixAndSuffix()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load hashpath prefix and suffix: %v\n", err)
+		os.Exit(1)
+	}
+	devices := map[string]bool{}
+	for _, dev := range common.SliceFromCSV(flags.Lookup("devices").Value.(flag.Getter).Get().(string)) {
+		devices[dev] = true
+	}
+	failed := false
+	for _, config := range configs {
+		driveRoot := config.GetDefault("app:object-server", "devices", "/srv/node")
+		devDirs, err := ioutil.ReadDir(driveRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", driveRoot, err)
+			os.Exit(1)
+		}
+		for _, policy := range policies {
+			if policy.Type != "repng" && policy.Type != "hec" {
+				continue
+			}
+			objRing, err := cnf.GetRing("object", hashPathPrefix, hashPathSuffix, policy.Index)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading ring for policy %d: %v\n", policy.Index, err)
+				os.Exit(1)
+			}
+			dbPartPower, err := policy.GetDbPartPower()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			subdirs, err := policy.GetDbSubDirs()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			ringPartPower := bits.Len64(objRing.PartitionCount() - 1)
+			for _, devDir := range devDirs {
+				if len(devices) > 0 && !devices[devDir.Name()] {
+					continue
+				}
+				policyDir := filepath.Join(driveRoot, devDir.Name(), PolicyDir(policy.Index))
+				dbpath := filepath.Join(policyDir, fmt.Sprintf("%s.db", policy.Type))
+				if _, err := os.Stat(dbpath); err != nil {
+					continue
+				}
+				path := filepath.Join(policyDir, policy.Type)
+				temppath := filepath.Join(driveRoot, devDir.Name(), "tmp")
+				copied, err := convertIndexDBPath(fromBackend, toBackend, dbpath, path, temppath, ringPartPower, int(dbPartPower), subdirs)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error converting %s: %v\n", dbpath, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Converted %s from %s to %s: %d rows\n", dbpath, fromBackend, toBackend, copied)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func convertIndexDBPath(fromBackend, toBackend, dbpath, path, temppath string, ringPartPower, dbPartPower, subdirs int) (int, error) {
+	from, err := NewIndexDBWithBackend(fromBackend, dbpath, path, temppath, ringPartPower, dbPartPower, subdirs, 0, zap.L(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer from.Close()
+	to, err := NewIndexDBWithBackend(toBackend, dbpath, path, temppath, ringPartPower, dbPartPower, subdirs, 0, zap.L(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer to.Close()
+	return ConvertIndexDB(from, to)
+}
@@ -2,7 +2,6 @@ package objectserver
 
 import (
 	"crypto/md5"
-	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -10,13 +9,16 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/fs"
 	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
 
@@ -25,6 +27,11 @@ const (
 	shardNursery             = 0
 	numStabilizeObjects      = 100
 	maxStableObjectCacheSize = 1000000
+	// listWorkers bounds how many of a disk's databases are listed at once.
+	listWorkers = 8
+	// reclaimBatchSize is how many tombstones ReclaimTombstones deletes per
+	// transaction, so writers aren't locked out for the whole pass.
+	reclaimBatchSize = 1000
 )
 
 // IndexDBItem is a single item returned by List.
@@ -40,14 +47,18 @@ type IndexDBItem struct {
 	ShardHash   string
 	Restabilize bool
 	Expires     *int64
+	// Inline is set when the object's contents are kept in Data instead of
+	// a file; see IndexDB.SetInlineMaxSize.
+	Inline bool   `json:"-"`
+	Data   []byte `json:"-"`
 }
 
 // IndexDB will track a set of objects.
 //
-// This is the "index.db" per disk. Right now it just handles whole objects,
-// but eventually we'd like to add either slab support or direct database
-// embedding for small objects. But, those details should be transparent from
-// users of a IndexDB.
+// This is the "index.db" per disk. It handles whole objects, each either in
+// its own file or, if it's small enough and SetInlineMaxSize has been used,
+// embedded in its row. Those details should be transparent to users of a
+// IndexDB, as long as they read objects through openItem.
 //
 // This is different from the standard Swift full replica object tracking in
 // that the directory structure is much shallower, there are a configurable
@@ -69,12 +80,17 @@ type IndexDB struct {
 	subdirs       int
 	temppath      string
 	reserve       int64
-	dbs           []*sql.DB
+	store         indexStore
 	logger        srv.LowLevelLogger
 	auditor       IndexDBAuditor
+	inlineMaxSize int64
+	syncPolicy    fs.SyncPolicy
+	syncDirs      bool
+	metrics       *indexDBMetrics
 }
 
-// NewIndexDB creates a IndexDB to manage a set of objects.
+// NewIndexDB creates a IndexDB to manage a set of objects, keeping its index
+// in sqlite.
 //
 // The ringPartPower is defined by the ring in use, but should be greater than
 // the dbPartPower. The dbPartPower will define how many
@@ -82,6 +98,14 @@ type IndexDB struct {
 // subdirs value will define how many subdirectories are created where object
 // content files are placed.
 func NewIndexDB(dbpath, filepath, temppath string, ringPartPower, dbPartPower, subdirs int, reserve int64, logger srv.LowLevelLogger, auditor IndexDBAuditor) (*IndexDB, error) {
+	return NewIndexDBWithBackend(IndexBackendSQLite, dbpath, filepath, temppath, ringPartPower, dbPartPower, subdirs, reserve, logger, auditor)
+}
+
+// NewIndexDBWithBackend is NewIndexDB keeping the index in the given backend,
+// IndexBackendSQLite or IndexBackendBadger.  With Badger, the dbPartPower
+// still decides how the index's work is split up, but there's just one
+// database.
+func NewIndexDBWithBackend(backend, dbpath, filepath, temppath string, ringPartPower, dbPartPower, subdirs int, reserve int64, logger srv.LowLevelLogger, auditor IndexDBAuditor) (*IndexDB, error) {
 	if ringPartPower <= dbPartPower {
 		return nil, fmt.Errorf("ringPartPower must be greater than dbPartPower: %d is not greater than %d", ringPartPower, dbPartPower)
 	}
@@ -95,10 +119,10 @@ func NewIndexDB(dbpath, filepath, temppath string, ringPartPower, dbPartPower, s
 		RingPartPower: uint(ringPartPower),
 		dbPartPower:   uint(dbPartPower),
 		subdirs:       subdirs,
-		dbs:           make([]*sql.DB, 1<<uint(dbPartPower)),
 		logger:        logger,
 		reserve:       reserve,
 		auditor:       auditor,
+		metrics:       newIndexDBMetrics(tally.NoopScope, ""),
 	}
 	err := os.MkdirAll(ot.dbpath, 0700)
 	if err != nil {
@@ -112,81 +136,46 @@ func NewIndexDB(dbpath, filepath, temppath string, ringPartPower, dbPartPower, s
 	if err != nil {
 		return nil, err
 	}
-	for i := 0; i < 1<<ot.dbPartPower; i++ {
-		ot.dbs[i], err = sql.Open("sqlite3", "file:"+path.Join(ot.dbpath, fmt.Sprintf("index.db.%02x", i))+"?psow=1&_txlock=immediate&mode=rwc")
-		if err == nil {
-			ot.dbs[i].SetMaxOpenConns(2)
-			ot.dbs[i].SetMaxIdleConns(2)
-			err = ot.init(i)
-		}
-		if err != nil {
-			for j := 0; j < i; j++ {
-				ot.dbs[j].Close()
-			}
-			return nil, err
-		}
+	if ot.store, err = newIndexStore(backend, ot.dbpath, ot.dbPartPower); err != nil {
+		return nil, err
 	}
 	for i := 0; i < ot.subdirs; i++ {
 		err := os.MkdirAll(path.Join(ot.filepath, fmt.Sprintf("index.db.dir.%02x", i)), 0700)
 		if err != nil {
-			for j := 0; j < 1<<ot.dbPartPower; j++ {
-				ot.dbs[j].Close()
-			}
+			ot.store.close()
 			return nil, err
 		}
 	}
 	return ot, nil
 }
 
-func (ot *IndexDB) init(dbi int) error {
-	db := ot.dbs[dbi]
-	if _, err := db.Exec(`
-        PRAGMA synchronous = NORMAL;
-        PRAGMA cache_size = -4096;
-        PRAGMA temp_store = MEMORY;
-        PRAGMA journal_mode = WAL;
-        PRAGMA busy_timeout = 25000;
-    `, nil); err != nil {
-		return err
-	}
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	_, err = tx.Exec(`
-		CREATE TABLE IF NOT EXISTS objects (
-			hash TEXT NOT NULL,
-			shard INTEGER NOT NULL,
-			timestamp INTEGER NOT NULL,
-			nursery BOOLEAN NOT NULL,
-			deletion BOOLEAN NOT NULL,
-			metahash TEXT, -- NULLable because not everyone stores the metadata
-			metadata TEXT, -- NULLable because not everyone stores the metadata
-			shardhash TEXT, -- NULLable because not every object is a shard
-			restabilize BOOLEAN NOT NULL,
-			expires INTEGER DEFAULT NULL,
-			CONSTRAINT ix_objects_hash_shard_timestamp PRIMARY KEY (hash, shard, timestamp, nursery)
-		) WITHOUT ROWID;
-	`)
-	if err != nil {
-		return err
-	}
-	if _, err = tx.Exec("CREATE INDEX IF NOT EXISTS ix_stabilize_items ON objects (nursery, restabilize, timestamp) WHERE nursery = 1 OR restabilize = 1"); err != nil {
-		return err
-	}
-	if _, err = tx.Exec("CREATE INDEX IF NOT EXISTS ix_object_expires ON objects(expires) WHERE expires IS NOT NULL"); err != nil {
-		return err
-	}
-	return tx.Commit()
+// SetInlineMaxSize has objects of up to size bytes stored in their index rows,
+// written in the same transaction as their metadata, rather than in files of
+// their own; zero, the default, turns that off.  Objects already stored are
+// left as they are.
+func (ot *IndexDB) SetInlineMaxSize(size int64) {
+	ot.inlineMaxSize = size
+}
+
+// SetSyncPolicy sets how durably object files are written before Commit puts
+// them in the index, including whether the directory each is linked into is
+// fsynced.  Until it's called, each file is fsynced but its directory isn't,
+// as they always have been.
+func (ot *IndexDB) SetSyncPolicy(policy fs.SyncPolicy) {
+	ot.syncPolicy = policy
+	ot.syncDirs = true
+}
+
+// SetMetrics has the IndexDB report its metrics to scope, each name starting
+// with prefix; until it's called they're discarded.
+func (ot *IndexDB) SetMetrics(scope tally.Scope, prefix string) {
+	ot.metrics = newIndexDBMetrics(scope, prefix)
 }
 
 // Close closes all the underlying databases for the IndexDB; you should
 // discard the IndexDB instance after this call.
 func (ot *IndexDB) Close() {
-	for _, db := range ot.dbs {
-		db.Close()
-	}
+	ot.store.close()
 }
 
 // TempFile returns a temporary file to write to for eventually adding the
@@ -211,6 +200,7 @@ func (ot *IndexDB) TempFile(hsh string, shard int, timestamp int64, sizeHint int
 				}
 				return nil, err
 			}
+			ot.metrics.oldDiscards.Inc(1)
 			return nil, nil
 		}
 	}
@@ -218,7 +208,10 @@ func (ot *IndexDB) TempFile(hsh string, shard int, timestamp int64, sizeHint int
 	if err != nil {
 		return nil, err
 	}
-	afw, err := fs.NewAtomicFileWriter(ot.temppath, dir)
+	if ot.inlineMaxSize > 0 && sizeHint <= ot.inlineMaxSize {
+		return &inlineWriter{ot: ot, dir: dir}, nil
+	}
+	afw, err := fs.NewAtomicFileWriterSync(ot.temppath, dir, ot.syncPolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -239,13 +232,14 @@ func (ot *IndexDB) TempFile(hsh string, shard int, timestamp int64, sizeHint int
 // Timestamp is the timestamp for the object contents, not necessarily the
 // metadata.
 func (ot *IndexDB) Commit(f fs.AtomicFileWriter, hsh string, shard int, timestamp int64, method string, metadata map[string]string, nursery bool, shardhash string) error {
+	defer ot.metrics.commitLatency.Start().Stop()
 	hsh, _, dbPart, _, err := ValidateHash(hsh, ot.RingPartPower, ot.dbPartPower, ot.subdirs)
 	if err != nil {
 		return err
 	}
 	metabytes := []byte{}
 	metahash := ""
-	expires := (*string)(nil)
+	expires := (*int64)(nil)
 
 	if len(metadata) > 0 {
 		metabytes, err = json.Marshal(metadata)
@@ -254,155 +248,135 @@ func (ot *IndexDB) Commit(f fs.AtomicFileWriter, hsh string, shard int, timestam
 		}
 		metahash = MetadataHash(metadata)
 		if xda, ok := metadata["X-Delete-At"]; ok {
-			expires = &xda
+			if t, err := strconv.ParseInt(xda, 10, 64); err == nil {
+				expires = &t
+			}
 		}
 	}
 
+	var inlineData []byte
+	inline := false
 	if f != nil {
+		if iw, ok := f.(*inlineWriter); ok {
+			inlineData, inline = iw.inline()
+		}
 		if err = f.Sync(); err != nil {
 			return err
 		}
+		// If f.Save() was already called, this is a No-Op.
+		defer f.Abandon()
 	}
 
-	var tx *sql.Tx
-	var rows *sql.Rows
-	// Single defer so we can control the order of the tear down.
-	defer func() {
-		if rows != nil {
-			rows.Close()
-		}
-		if tx != nil {
-			// If tx.Commit() was already called, this is a No-Op.
-			tx.Rollback()
-		}
-		if f != nil {
-			// If f.Save() was already called, this is a No-Op.
-			f.Abandon()
-		}
-	}()
-	db := ot.dbs[dbPart]
-	tx, err = db.Begin()
-	if err != nil {
-		return err
-	}
 	deletion := method == "DELETE"
-	rows, err = tx.Query(`
-        SELECT timestamp, metahash, metadata, shardhash
-        FROM objects
-        WHERE hash = ? AND shard = ? AND nursery = ?
-        ORDER BY timestamp DESC
-    `, hsh, shard, nursery)
-	if err != nil {
-		return err
-	}
 	var dbWholeObjectPath string
 	var dbTimestamp int64
-	if !rows.Next() {
-		rows.Close()
-		if err = rows.Err(); err != nil {
-			return err
-		}
-		if f == nil && !deletion {
-			return common.ErrNotFound
-		}
-	} else {
-		var dbMetahash, dbShardHash string
-		var dbMetadata []byte
-		if err = rows.Scan(&dbTimestamp, &dbMetahash, &dbMetadata, &dbShardHash); err != nil {
-			return err
-		}
-		if f == nil && !deletion {
-			// We keep the original file's timestamp if just committing new metadata. (not the x-timestamp header)
-			timestamp = dbTimestamp
-		}
-		dbWholeObjectPath, err = ot.WholeObjectPath(hsh, shard, dbTimestamp, nursery)
-		if err != nil {
-			return err
-		}
-		if metahash == dbMetahash && ((f == nil && !deletion) || dbTimestamp > timestamp) {
-			return common.ErrConflict
-		}
-		if shardhash == "" {
-			shardhash = dbShardHash
-		}
-		if metahash != dbMetahash {
-			dbMetadataMap := map[string]string{}
-			if err = json.Unmarshal(dbMetadata, &dbMetadataMap); err != nil {
-				ot.logger.Error(
-					"error decoding metadata from db; discarding",
-					zap.Error(err),
-					zap.String("hsh", hsh),
-					zap.Int("shard", shard),
-					zap.Int64("dbTimestamp", dbTimestamp),
-					zap.String("dbMetahash", dbMetahash),
-					zap.Binary("dbMetadata", dbMetadata),
-				)
-			} else {
-				if f == nil {
-					delete(metadata, "Content-Length")
-					delete(metadata, "ETag")
+	dbInline := false
+	err = ot.store.commit(dbPart, hsh, shard, nursery, func(current *IndexDBItem) (*IndexDBItem, error) {
+		if current == nil {
+			if f == nil && !deletion {
+				return nil, common.ErrNotFound
+			}
+		} else {
+			dbTimestamp = current.Timestamp
+			dbInline = current.Inline
+			if f == nil && !deletion {
+				// We keep the original file's timestamp if just committing new metadata. (not the x-timestamp header)
+				timestamp = dbTimestamp
+				// And its contents, if they're in the row.
+				inline = current.Inline
+				inlineData = current.Data
+			}
+			var err error
+			dbWholeObjectPath, err = ot.WholeObjectPath(hsh, shard, dbTimestamp, nursery)
+			if err != nil {
+				return nil, err
+			}
+			if metahash == current.Metahash && ((f == nil && !deletion) || dbTimestamp > timestamp) {
+				if dbTimestamp > timestamp {
+					ot.metrics.oldDiscards.Inc(1)
 				}
-				metadata = MetadataMerge(metadata, dbMetadataMap)
-				var newMetabytes []byte
-				if newMetabytes, err = json.Marshal(metadata); err != nil {
-					if _, err2 := json.Marshal(dbMetadataMap); err2 != nil {
-						ot.logger.Error(
-							"error reencoding metadata from db; discarding",
-							zap.Error(err2),
-							zap.String("hsh", hsh),
-							zap.Int("shard", shard),
-							zap.Int64("dbTimestamp", dbTimestamp),
-							zap.String("dbMetahash", dbMetahash),
-							zap.Binary("dbMetadata", dbMetadata),
-							zap.String("metahash", metahash),
-							zap.Binary("metadata", metabytes),
-						)
+				return nil, common.ErrConflict
+			}
+			if shardhash == "" {
+				shardhash = current.ShardHash
+			}
+			if metahash != current.Metahash {
+				dbMetadataMap := map[string]string{}
+				if err = json.Unmarshal(current.Metabytes, &dbMetadataMap); err != nil {
+					ot.metrics.metadataDecodeFailures.Inc(1)
+					ot.logger.Error(
+						"error decoding metadata from db; discarding",
+						zap.Error(err),
+						zap.String("hsh", hsh),
+						zap.Int("shard", shard),
+						zap.Int64("dbTimestamp", dbTimestamp),
+						zap.String("dbMetahash", current.Metahash),
+						zap.Binary("dbMetadata", current.Metabytes),
+					)
+				} else {
+					if f == nil {
+						delete(metadata, "Content-Length")
+						delete(metadata, "ETag")
+					}
+					metadata = MetadataMerge(metadata, dbMetadataMap)
+					var newMetabytes []byte
+					if newMetabytes, err = json.Marshal(metadata); err != nil {
+						if _, err2 := json.Marshal(dbMetadataMap); err2 != nil {
+							ot.metrics.metadataDecodeFailures.Inc(1)
+							ot.logger.Error(
+								"error reencoding metadata from db; discarding",
+								zap.Error(err2),
+								zap.String("hsh", hsh),
+								zap.Int("shard", shard),
+								zap.Int64("dbTimestamp", dbTimestamp),
+								zap.String("dbMetahash", current.Metahash),
+								zap.Binary("dbMetadata", current.Metabytes),
+								zap.String("metahash", metahash),
+								zap.Binary("metadata", metabytes),
+							)
+						} else {
+							// We return this error because the caller (presumably)
+							// gave us bad metadata.
+							return nil, err
+						}
 					} else {
-						// We return this error because the caller (presumably)
-						// gave us bad metadata.
-						return err
+						ot.metrics.metadataMerges.Inc(1)
+						metahash = MetadataHash(metadata)
+						metabytes = newMetabytes
 					}
-				} else {
-					metahash = MetadataHash(metadata)
-					metabytes = newMetabytes
 				}
 			}
 		}
-	}
-	rows.Close()
-	var pth string
-	pth, err = ot.WholeObjectPath(hsh, shard, timestamp, nursery)
-	if err != nil {
-		return err
-	}
-	restabilize := false
-	if dbWholeObjectPath == "" {
-		_, err = tx.Exec(`
-            INSERT INTO objects (hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-        `, hsh, shard, timestamp, deletion, metahash, metabytes, nursery, shardhash, restabilize, expires)
-	} else {
-		if !nursery && method == "POST" {
-			restabilize = true
-		}
-		_, err = tx.Exec(`
-            UPDATE objects
-            SET timestamp = ?, deletion = ?, metahash = ?, metadata = ?, nursery = ?, shardhash = ?, restabilize = ?, expires = ?
-            WHERE hash = ? AND shard = ? AND nursery = ?
-        `, timestamp, deletion, metahash, metabytes, nursery, shardhash, restabilize, expires, hsh, shard, nursery)
+		pth, err := ot.WholeObjectPath(hsh, shard, timestamp, nursery)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	}
-	if f != nil {
-		if err = f.Finalize(pth); err != nil {
-			return err
+		restabilize := dbWholeObjectPath != "" && !nursery && method == "POST"
+		if f != nil && !inline {
+			// The file goes in place before the row is committed, so the
+			// index never points at a file that isn't there.
+			if err = f.Finalize(pth); err != nil {
+				return nil, err
+			}
+			if ot.syncDirs {
+				if err = ot.syncPolicy.SyncDir(path.Dir(pth)); err != nil {
+					return nil, err
+				}
+			}
 		}
-	}
-	if err == nil {
-		err = tx.Commit()
-	}
-	if err == nil && dbWholeObjectPath != "" && (f != nil || deletion) && timestamp > dbTimestamp {
+		return &IndexDBItem{
+			Timestamp:   timestamp,
+			Deletion:    deletion,
+			Metahash:    metahash,
+			Metabytes:   metabytes,
+			ShardHash:   shardhash,
+			Restabilize: restabilize,
+			Expires:     expires,
+			Inline:      inline,
+			Data:        inlineData,
+		}, nil
+	})
+	if err == nil && dbWholeObjectPath != "" && !dbInline && (f != nil || deletion) && timestamp > dbTimestamp {
 		if err2 := os.Remove(dbWholeObjectPath); err2 != nil {
 			ot.logger.Error(
 				"error removing older file",
@@ -414,36 +388,54 @@ func (ot *IndexDB) Commit(f fs.AtomicFileWriter, hsh string, shard int, timestam
 	return err
 }
 
-func (ot *IndexDB) SetStabilized(hsh string, shard int, timestamp int64, stabilizePath bool) error {
-	hsh, _, dbPart, _, err := ValidateHash(hsh, ot.RingPartPower, ot.dbPartPower, ot.subdirs)
+// CommitNew is Commit for a create-only PUT, like one with If-None-Match: *.
+// It discards f and returns common.ErrPreconditionFailed if there's already
+// an object for the hash, in the nursery or stable, that isn't a deletion.
+// The caller must keep other writes to the object out until it returns, as
+// the object server's lockObject does, for the check to stand.
+func (ot *IndexDB) CommitNew(f fs.AtomicFileWriter, hsh string, shard int, timestamp int64, metadata map[string]string, nursery bool, shardhash string) error {
+	item, err := ot.Lookup(hsh, shardAny, false)
 	if err != nil {
 		return err
 	}
-	db := ot.dbs[dbPart]
-	tx, err := db.Begin()
-	defer tx.Rollback()
-	if err != nil {
-		return err
+	if item != nil && !item.Deletion {
+		if f != nil {
+			f.Abandon()
+		}
+		return common.ErrPreconditionFailed
 	}
-	_, err = tx.Exec(`
-	    UPDATE objects SET nursery = 0, restabilize = 0
-		WHERE hash = ? AND shard = ? AND timestamp = ?
-		`, hsh, shard, timestamp)
+	return ot.Commit(f, hsh, shard, timestamp, "PUT", metadata, nursery, shardhash)
+}
+
+func (ot *IndexDB) SetStabilized(hsh string, shard int, timestamp int64, stabilizePath bool) error {
+	hsh, _, dbPart, _, err := ValidateHash(hsh, ot.RingPartPower, ot.dbPartPower, ot.subdirs)
 	if err != nil {
 		return err
 	}
 	if stabilizePath {
-		var wasPath, toPath string
-		if wasPath, err = ot.WholeObjectPath(hsh, shard, timestamp, true); err == nil {
-			if toPath, err = ot.WholeObjectPath(hsh, shard, timestamp, false); err == nil {
-				err = os.Rename(wasPath, toPath)
-			}
-		}
+		// Objects in their rows have no file to move.
+		item, err := ot.store.lookup(dbPart, hsh, shard, false)
 		if err != nil {
 			return err
 		}
+		if item != nil && item.Timestamp == timestamp && item.Inline {
+			stabilizePath = false
+		}
 	}
-	return tx.Commit()
+	return ot.store.setStabilized(dbPart, hsh, shard, timestamp, func() error {
+		if !stabilizePath {
+			return nil
+		}
+		wasPath, err := ot.WholeObjectPath(hsh, shard, timestamp, true)
+		if err != nil {
+			return err
+		}
+		toPath, err := ot.WholeObjectPath(hsh, shard, timestamp, false)
+		if err != nil {
+			return err
+		}
+		return os.Rename(wasPath, toPath)
+	})
 }
 
 func (ot *IndexDB) wholeObjectDir(hsh string) (string, error) {
@@ -471,17 +463,11 @@ func (ot *IndexDB) Remove(hsh string, shard int, timestamp int64, nursery bool,
 	if err != nil {
 		return 0, err
 	}
-	db := ot.dbs[dbPart]
-	res, err := db.Exec(`
-        DELETE
-		FROM objects
-        WHERE hash = ? AND shard = ? AND timestamp = ? AND nursery = ? AND metahash = ?
-    `, hsh, shard, timestamp, nursery, metahash)
+	af, err := ot.store.remove(dbPart, hsh, shard, timestamp, nursery, metahash)
 	if err != nil {
 		return 0, err
 	}
-	af := int64(0)
-	if af, err = res.RowsAffected(); err == nil && af > 0 {
+	if af > 0 {
 		path, err := ot.WholeObjectPath(hsh, shard, timestamp, nursery)
 		if err != nil {
 			return af, err
@@ -498,85 +484,83 @@ func (ot *IndexDB) Remove(hsh string, shard int, timestamp int64, nursery bool,
 // use var shardAny to search for any shard or in nursery
 // NOTE: if justStable is true then you must specify shard. TODO: is this kinda weird?
 func (ot *IndexDB) Lookup(hsh string, shard int, justStable bool) (*IndexDBItem, error) {
+	defer ot.metrics.lookupLatency.Start().Stop()
 	var err error
 	hsh, _, dbPart, _, err := ValidateHash(hsh, ot.RingPartPower, ot.dbPartPower, ot.subdirs)
 	if err != nil {
 		return nil, err
 	}
-	db := ot.dbs[dbPart]
-	var rows *sql.Rows
-	if justStable {
-		rows, err = db.Query(`
-			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires
-			FROM objects
-			WHERE hash = ? AND shard = ? AND nursery = 0
-			LIMIT 1
-		`, hsh, shard)
-	} else if shard == shardAny {
-		rows, err = db.Query(`
-			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires
-			FROM objects
-			WHERE hash = ? AND metadata IS NOT NULL
-			ORDER BY nursery DESC, shard ASC
-			LIMIT 1
-		`, hsh)
-	} else {
-		rows, err = db.Query(`
-			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires
-			FROM objects
-			WHERE hash = ? AND shard = ?
-			ORDER BY nursery DESC
-			LIMIT 1
-		`, hsh, shard)
-	}
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	if !rows.Next() {
-		return nil, rows.Err()
-	}
-	item := &IndexDBItem{Hash: hsh}
-	if err = rows.Scan(&item.Timestamp, &item.Deletion, &item.Metahash,
-		&item.Metabytes, &item.Nursery, &item.Shard, &item.ShardHash, &item.Restabilize, &item.Expires); err != nil {
+	item, err := ot.store.lookup(dbPart, hsh, shard, justStable)
+	if err != nil || item == nil {
 		return nil, err
 	}
+	item.Hash = hsh
 	item.Path, err = ot.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery)
 	return item, err
 }
 
+// dbCount is how many parts the index is split into.
+func (ot *IndexDB) dbCount() int {
+	return 1 << ot.dbPartPower
+}
+
+// forEachDB calls fn for each database part from first to last, listWorkers
+// at a time, since the parts are independent; it returns the first error
+// encountered.
+func (ot *IndexDB) forEachDB(first, last int, fn func(dbPart int) error) error {
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+	parts := make(chan int)
+	workers := listWorkers
+	if workers > last-first+1 {
+		workers = last - first + 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dbPart := range parts {
+				if err := fn(dbPart); err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+				}
+			}
+		}()
+	}
+	for dbPart := first; dbPart <= last; dbPart++ {
+		parts <- dbPart
+	}
+	close(parts)
+	wg.Wait()
+	return firstErr
+}
+
 // ListObjectsToStabilize lists oldest objects in the nursery, it will be limited to numStabilizeObjects * # index.db's
 func (ot *IndexDB) ListObjectsToStabilize() ([]*IndexDBItem, error) {
-	listing := []*IndexDBItem{}
-	for _, db := range ot.dbs {
-		if err := func() error {
-			rows, err := db.Query(`
-				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, restabilize, expires
-				FROM objects
-				WHERE nursery = 1 OR restabilize = 1
-                ORDER BY timestamp LIMIT ?`, numStabilizeObjects)
+	listings := make([][]*IndexDBItem, ot.dbCount())
+	err := ot.forEachDB(0, ot.dbCount()-1, func(dbPart int) error {
+		items, err := ot.store.listToStabilize(dbPart, numStabilizeObjects)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			item.Path, err = ot.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery)
 			if err != nil {
 				return err
 			}
-			defer rows.Close()
-			for rows.Next() {
-				item := &IndexDBItem{}
-				if err = rows.Scan(&item.Hash, &item.Shard, &item.Timestamp, &item.Deletion, &item.Metahash,
-					&item.Metabytes, &item.Nursery, &item.Restabilize, &item.Expires); err != nil {
-					return err
-				}
-				item.Path, err = ot.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery)
-				if err != nil {
-					return err
-				}
-				listing = append(listing, item)
-			}
-			return rows.Err()
-		}(); err != nil {
-			return listing, err
 		}
+		listings[dbPart] = items
+		return nil
+	})
+	listing := []*IndexDBItem{}
+	for _, l := range listings {
+		listing = append(listing, l...)
 	}
-	return listing, nil
+	return listing, err
 }
 
 // List returns the items for the ringPart given.
@@ -585,6 +569,7 @@ func (ot *IndexDB) ListObjectsToStabilize() ([]*IndexDBItem, error) {
 // NOTE: List does not populate item.Path for some reason- maybe
 // size of listing? Maybe we should change that later.
 func (ot *IndexDB) List(startHash, stopHash, marker string, limit int) ([]*IndexDBItem, error) {
+	defer ot.metrics.listLatency.Start().Stop()
 	if startHash == "" {
 		startHash = "00000000000000000000000000000000"
 	}
@@ -599,95 +584,38 @@ func (ot *IndexDB) List(startHash, stopHash, marker string, limit int) ([]*Index
 	if err != nil {
 		return nil, err
 	}
+	listings := make([][]*IndexDBItem, ot.dbCount())
+	err = ot.forEachDB(startDBPart, stopDBPart, func(dbPart int) error {
+		items, err := ot.store.list(dbPart, startHash, stopHash, marker, limit)
+		listings[dbPart] = items
+		return err
+	})
 	listing := []*IndexDBItem{}
-	for dbPart := startDBPart; dbPart <= stopDBPart; dbPart++ {
-		db := ot.dbs[dbPart]
-		var rows *sql.Rows
-		if limit > 0 {
-			rows, err = db.Query(`
-				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires
-			FROM objects
-			WHERE hash BETWEEN ? AND ? AND hash > ?
-			ORDER BY hash
-			LIMIT ?
-		    `, startHash, stopHash, marker, limit)
-		} else {
-			rows, err = db.Query(`
-				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires
-			FROM objects
-			WHERE hash BETWEEN ? AND ? AND hash > ?
-			ORDER BY hash
-		    `, startHash, stopHash, marker)
-		}
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			item := &IndexDBItem{}
-			if err = rows.Scan(&item.Hash, &item.Shard, &item.Timestamp, &item.Deletion, &item.Metahash,
-				&item.Metabytes, &item.Nursery, &item.ShardHash, &item.Restabilize, &item.Expires); err != nil {
-				return listing, err
-			}
-			listing = append(listing, item)
-		}
-		if err = rows.Err(); err != nil {
-			return listing, err
-		}
+	for _, l := range listings {
+		listing = append(listing, l...)
 	}
-	return listing, nil
+	return listing, err
 }
 
 func (ot *IndexDB) ExpireObjects() error {
-	type result struct {
-		hash      string
-		timestamp int64
-		shard     int
-		nursery   bool
-	}
-	for dbIndex, db := range ot.dbs {
-		rows, err := db.Query("SELECT hash, shard, timestamp, nursery FROM objects WHERE expires < ?", time.Now().Unix())
+	for dbIndex := 0; dbIndex < ot.dbCount(); dbIndex++ {
+		items, err := ot.store.listExpired(dbIndex, time.Now().Unix())
 		if err != nil {
 			ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
 			return err
 		}
-		defer rows.Close()
-		remove := []result{}
-		for i := 0; rows.Next(); i++ {
-			var r result
-			if err = rows.Scan(&r.hash, &r.shard, &r.timestamp, &r.nursery); err != nil {
-				ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
-				return err
-			}
-			if path, err := ot.WholeObjectPath(r.hash, r.shard, r.timestamp, r.nursery); err == nil {
+		remove := []*IndexDBItem{}
+		for _, item := range items {
+			if path, err := ot.WholeObjectPath(item.Hash, item.Shard, item.Timestamp, item.Nursery); err == nil {
 				if err := os.Remove(path); err == nil || os.IsNotExist(err) {
-					remove = append(remove, r)
+					remove = append(remove, item)
 				} else {
 					ot.logger.Error("remove error", zap.Error(err), zap.String("path", path))
 				}
 			}
 		}
-		if err := rows.Err(); err != nil {
-			ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
-			return err
-		}
-		rows.Close()
-
 		if len(remove) > 0 {
-			tx, err := db.Begin()
-			if err != nil {
-				ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
-				return err
-			}
-			defer tx.Rollback()
-			for _, r := range remove {
-				if _, err := tx.Exec("DELETE FROM objects WHERE hash=? AND shard=? AND timestamp=? AND nursery=?",
-					r.hash, r.shard, r.timestamp, r.nursery); err != nil {
-					ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
-					return err
-				}
-			}
-			if err := tx.Commit(); err != nil {
+			if err := ot.store.delete(dbIndex, remove); err != nil {
 				ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbIndex))
 				return err
 			}
@@ -696,6 +624,32 @@ func (ot *IndexDB) ExpireObjects() error {
 	return nil
 }
 
+// ReclaimTombstones deletes the rows of stable deletions older than
+// reclaimAge, returning how many it removed.
+//
+// A deletion only becomes stable once every primary has it, and after
+// reclaimAge no replica should still be holding an older copy for it to
+// shadow, so the row is just taking up space; delete heavy workloads would
+// otherwise grow the databases without bound.
+func (ot *IndexDB) ReclaimTombstones(reclaimAge time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-reclaimAge).UnixNano()
+	var reclaimed int64
+	err := ot.forEachDB(0, ot.dbCount()-1, func(dbPart int) error {
+		for {
+			n, err := ot.store.reclaimTombstones(dbPart, cutoff, reclaimBatchSize)
+			if err != nil {
+				ot.logger.Error("database error", zap.Error(err), zap.Int("db", dbPart))
+				return err
+			}
+			atomic.AddInt64(&reclaimed, n)
+			if n < reclaimBatchSize {
+				return nil
+			}
+		}
+	})
+	return reclaimed, err
+}
+
 func ValidateHash(hsh string, ringPartPower, dbPartPower uint, subdirs int) (hshOut string, ringPart, dbPart, dirNm int, err error) {
 	hsh = strings.ToLower(hsh)
 	if len(hsh) != 32 {
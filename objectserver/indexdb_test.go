@@ -320,6 +320,62 @@ func TestIndexDB_Lookup_withUnderwrite(t *testing.T) {
 	}
 }
 
+func TestIndexDB_Metrics(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	ot := newTestIndexDB(t, pth)
+	defer ot.Close()
+	scope := common.NewTestScope()
+	ot.SetMetrics(scope, "0_sda_")
+	hsh := md5hash("object1")
+	timestamp := time.Now().UnixNano()
+	f, err := ot.TempFile(hsh, 0, timestamp, 4, false)
+	errnil(t, err)
+	f.Write([]byte("test"))
+	errnil(t, ot.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{"Content-Length": "4"}, false, ""))
+	// Anything older is discarded before it's even written.
+	f, err = ot.TempFile(hsh, 0, timestamp-1, 4, false)
+	errnil(t, err)
+	require.Nil(t, f)
+	require.Equal(t, int64(1), scope.Counter("0_sda_index_old_discards").(*common.TestCounter).Value())
+	// New metadata is merged with what's stored.
+	errnil(t, ot.Commit(nil, hsh, 0, timestamp+1, "POST", map[string]string{"X-Object-Meta-Color": "blue"}, false, ""))
+	require.Equal(t, int64(1), scope.Counter("0_sda_index_metadata_merges").(*common.TestCounter).Value())
+	require.Equal(t, int64(0), scope.Counter("0_sda_index_metadata_decode_failures").(*common.TestCounter).Value())
+}
+
+func TestIndexDB_CommitNew(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	ot := newTestIndexDB(t, pth)
+	defer ot.Close()
+	hsh := md5hash("object1")
+	timestamp := time.Now().UnixNano()
+	metadata := map[string]string{"name": "/a/c/o", "X-Timestamp": "1"}
+	f, err := ot.TempFile(hsh, 0, timestamp, 4, true)
+	errnil(t, err)
+	f.Write([]byte("test"))
+	errnil(t, ot.CommitNew(f, hsh, 0, timestamp, metadata, true, ""))
+	// A newer create-only PUT loses to the object already there.
+	f, err = ot.TempFile(hsh, 0, timestamp+1, 4, true)
+	errnil(t, err)
+	f.Write([]byte("new!"))
+	require.Equal(t, common.ErrPreconditionFailed, ot.CommitNew(f, hsh, 0, timestamp+1, metadata, true, ""))
+	i, err := ot.Lookup(hsh, 0, false)
+	errnil(t, err)
+	require.Equal(t, timestamp, i.Timestamp)
+	// But not to a deletion.
+	errnil(t, ot.Commit(nil, hsh, 0, timestamp+2, "DELETE", metadata, true, ""))
+	f, err = ot.TempFile(hsh, 0, timestamp+3, 4, true)
+	errnil(t, err)
+	f.Write([]byte("new!"))
+	errnil(t, ot.CommitNew(f, hsh, 0, timestamp+3, metadata, true, ""))
+	i, err = ot.Lookup(hsh, 0, false)
+	errnil(t, err)
+	require.Equal(t, timestamp+3, i.Timestamp)
+	require.False(t, i.Deletion)
+}
+
 func TestIndexDB_List(t *testing.T) {
 	pth, _ := ioutil.TempDir("", "")
 	defer os.RemoveAll(pth)
@@ -394,6 +450,38 @@ func TestIndexDB_List(t *testing.T) {
 	}
 }
 
+func TestIndexDB_ListOrderAcrossDBs(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	ot, err := NewIndexDB(pth, pth, pth, 8, 6, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	errnil(t, err)
+	defer ot.Close()
+	for i := 0; i < 200; i++ {
+		hsh := md5hash(fmt.Sprintf("object%d", i))
+		timestamp := time.Now().UnixNano()
+		body := "just testing"
+		f, err := ot.TempFile(hsh, 0, timestamp, int64(len(body)), true)
+		errnil(t, err)
+		f.Write([]byte(body))
+		errnil(t, ot.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{}, true, ""))
+	}
+	listing, err := ot.List("", "", "", 0)
+	errnil(t, err)
+	if len(listing) != 200 {
+		t.Fatal(len(listing))
+	}
+	for i := 1; i < len(listing); i++ {
+		if listing[i-1].Hash >= listing[i].Hash {
+			t.Fatal(listing[i-1].Hash, listing[i].Hash)
+		}
+	}
+	stabilize, err := ot.ListObjectsToStabilize()
+	errnil(t, err)
+	if len(stabilize) != 200 {
+		t.Fatal(len(stabilize))
+	}
+}
+
 func TestIndexDB_ListRange(t *testing.T) {
 	pth, _ := ioutil.TempDir("", "")
 	defer os.RemoveAll(pth)
@@ -661,3 +749,38 @@ func TestIndexDB_Expire(t *testing.T) {
 	require.Nil(t, err)
 	require.False(t, fs.Exists(path))
 }
+
+func TestIndexDB_ReclaimTombstones(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	ot := newTestIndexDB(t, pth)
+	defer ot.Close()
+	old := time.Now().Add(-2 * time.Hour).UnixNano()
+	recent := time.Now().UnixNano()
+	oldStable := md5hash("oldStable")
+	errnil(t, ot.Commit(nil, oldStable, 0, old, "DELETE", map[string]string{}, false, ""))
+	recentStable := md5hash("recentStable")
+	errnil(t, ot.Commit(nil, recentStable, 0, recent, "DELETE", map[string]string{}, false, ""))
+	oldNursery := md5hash("oldNursery")
+	errnil(t, ot.Commit(nil, oldNursery, 0, old, "DELETE", map[string]string{}, true, ""))
+	oldPut := md5hash("oldPut")
+	f, err := ot.TempFile(oldPut, 0, old, 4, false)
+	errnil(t, err)
+	f.Write([]byte("data"))
+	errnil(t, ot.Commit(f, oldPut, 0, old, "PUT", map[string]string{}, false, ""))
+
+	reclaimed, err := ot.ReclaimTombstones(time.Hour)
+	errnil(t, err)
+	require.Equal(t, int64(1), reclaimed)
+	item, err := ot.Lookup(oldStable, 0, false)
+	errnil(t, err)
+	require.Nil(t, item)
+	for _, hsh := range []string{recentStable, oldNursery, oldPut} {
+		item, err = ot.Lookup(hsh, 0, false)
+		errnil(t, err)
+		require.NotNil(t, item, hsh)
+	}
+	reclaimed, err = ot.ReclaimTombstones(time.Hour)
+	errnil(t, err)
+	require.Equal(t, int64(0), reclaimed)
+}
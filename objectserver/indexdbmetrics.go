@@ -0,0 +1,32 @@
+package objectserver
+
+import (
+	"github.com/uber-go/tally"
+)
+
+// indexDBMetrics are what an IndexDB reports about itself: how long commits,
+// lookups and listings take, how often writes lose to newer ones already in
+// place, and how often stored metadata has to be merged or can't be read.
+// Steady discards or any decode failures usually mean a misbehaving client or
+// a corrupt index, and are worth catching before replication spreads them.
+type indexDBMetrics struct {
+	commitLatency          tally.Timer
+	lookupLatency          tally.Timer
+	listLatency            tally.Timer
+	oldDiscards            tally.Counter
+	metadataMerges         tally.Counter
+	metadataDecodeFailures tally.Counter
+}
+
+// newIndexDBMetrics returns the metrics for an IndexDB in scope, each name
+// starting with prefix, e.g. "0_sda_".
+func newIndexDBMetrics(scope tally.Scope, prefix string) *indexDBMetrics {
+	return &indexDBMetrics{
+		commitLatency:          scope.Timer(prefix + "index_commit_latency"),
+		lookupLatency:          scope.Timer(prefix + "index_lookup_latency"),
+		listLatency:            scope.Timer(prefix + "index_list_latency"),
+		oldDiscards:            scope.Counter(prefix + "index_old_discards"),
+		metadataMerges:         scope.Counter(prefix + "index_metadata_merges"),
+		metadataDecodeFailures: scope.Counter(prefix + "index_metadata_decode_failures"),
+	}
+}
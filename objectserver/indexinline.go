@@ -0,0 +1,152 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/troubling/hummingbird/common/fs"
+)
+
+// inlineWriter is the TempFile of an IndexDB that stores small objects in
+// their index rows.  It holds the data in memory until it outgrows the
+// IndexDB's inline limit, at which point it moves it to a real temp file
+// and carries on like one.
+type inlineWriter struct {
+	ot  *IndexDB
+	dir string
+	buf []byte
+	afw fs.AtomicFileWriter
+}
+
+// inline returns the object's data if it's small enough to go in its row.
+func (w *inlineWriter) inline() ([]byte, bool) {
+	if w.afw != nil {
+		return nil, false
+	}
+	return w.buf, true
+}
+
+func (w *inlineWriter) spill() error {
+	if w.afw != nil {
+		return nil
+	}
+	afw, err := fs.NewAtomicFileWriterSync(w.ot.temppath, w.dir, w.ot.syncPolicy)
+	if err != nil {
+		return err
+	}
+	if _, err = afw.Write(w.buf); err != nil {
+		afw.Abandon()
+		return err
+	}
+	w.afw = afw
+	w.buf = nil
+	return nil
+}
+
+func (w *inlineWriter) Write(data []byte) (int, error) {
+	if w.afw == nil && int64(len(w.buf)+len(data)) <= w.ot.inlineMaxSize {
+		w.buf = append(w.buf, data...)
+		return len(data), nil
+	}
+	if err := w.spill(); err != nil {
+		return 0, err
+	}
+	return w.afw.Write(data)
+}
+
+func (w *inlineWriter) Fd() uintptr {
+	if err := w.spill(); err != nil {
+		return ^uintptr(0)
+	}
+	return w.afw.Fd()
+}
+
+func (w *inlineWriter) Save(dst string) error {
+	if err := w.spill(); err != nil {
+		return err
+	}
+	return w.afw.Save(dst)
+}
+
+func (w *inlineWriter) Abandon() error {
+	w.buf = nil
+	if w.afw != nil {
+		return w.afw.Abandon()
+	}
+	return nil
+}
+
+func (w *inlineWriter) Preallocate(size int64, reserve int64) error {
+	if size <= w.ot.inlineMaxSize && w.afw == nil {
+		return nil
+	}
+	if err := w.spill(); err != nil {
+		return err
+	}
+	return w.afw.Preallocate(size, reserve)
+}
+
+func (w *inlineWriter) Sync() error {
+	if w.afw != nil {
+		return w.afw.Sync()
+	}
+	return nil
+}
+
+func (w *inlineWriter) Finalize(dst string) error {
+	if err := w.spill(); err != nil {
+		return err
+	}
+	return w.afw.Finalize(dst)
+}
+
+// itemReader reads an object's contents, wherever they're kept.
+type itemReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type inlineReader struct {
+	*bytes.Reader
+}
+
+func (inlineReader) Close() error {
+	return nil
+}
+
+// openItem opens the contents of item, which must have come from the
+// IndexDB, from its row or its file.
+func openItem(item *IndexDBItem) (itemReader, error) {
+	if item.Inline {
+		return inlineReader{bytes.NewReader(item.Data)}, nil
+	}
+	return os.Open(item.Path)
+}
+
+// itemSize returns the size of item's contents.
+func itemSize(item *IndexDBItem) (int64, error) {
+	if item.Inline {
+		return int64(len(item.Data)), nil
+	}
+	fi, err := os.Stat(item.Path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
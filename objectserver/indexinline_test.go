@@ -0,0 +1,149 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIndexDBInline(t *testing.T) {
+	for _, backend := range []string{IndexBackendSQLite, IndexBackendBadger} {
+		t.Run(backend, func(t *testing.T) {
+			pth, _ := ioutil.TempDir("", "")
+			defer os.RemoveAll(pth)
+			ot := newTestIndexDBBackend(t, backend, pth)
+			defer ot.Close()
+			ot.SetInlineMaxSize(8)
+			timestamp := time.Now().UnixNano()
+
+			small := md5hash("small")
+			f, err := ot.TempFile(small, 0, timestamp, 4, true)
+			require.Nil(t, err)
+			f.Write([]byte("data"))
+			require.Nil(t, ot.Commit(f, small, 0, timestamp, "PUT", map[string]string{"Content-Length": "4"}, true, ""))
+			item, err := ot.Lookup(small, 0, false)
+			require.Nil(t, err)
+			require.True(t, item.Inline)
+			require.Equal(t, []byte("data"), item.Data)
+			_, err = os.Stat(item.Path)
+			require.True(t, os.IsNotExist(err))
+			r, err := openItem(item)
+			require.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, "data", string(data))
+			size, err := itemSize(item)
+			require.Nil(t, err)
+			require.Equal(t, int64(4), size)
+
+			require.Nil(t, ot.SetStabilized(small, 0, timestamp, true))
+			item, err = ot.Lookup(small, 0, true)
+			require.Nil(t, err)
+			require.False(t, item.Nursery)
+			require.Equal(t, []byte("data"), item.Data)
+			require.Nil(t, ot.Commit(nil, small, 0, timestamp+1, "POST", map[string]string{"X-Object-Meta-Color": "blue"}, false, ""))
+			item, err = ot.Lookup(small, 0, true)
+			require.Nil(t, err)
+			require.True(t, item.Inline)
+			require.Equal(t, []byte("data"), item.Data)
+			items, err := ot.List("", "", "", 0)
+			require.Nil(t, err)
+			require.Equal(t, 1, len(items))
+			require.Equal(t, []byte("data"), items[0].Data)
+
+			// Anything that turns out bigger than the limit goes to a file,
+			// whatever size it was said to be.
+			large := md5hash("large")
+			f, err = ot.TempFile(large, 0, timestamp, 4, false)
+			require.Nil(t, err)
+			f.Write([]byte("data"))
+			f.Write([]byte("more data"))
+			require.Nil(t, ot.Commit(f, large, 0, timestamp, "PUT", map[string]string{"Content-Length": "13"}, false, ""))
+			item, err = ot.Lookup(large, 0, false)
+			require.Nil(t, err)
+			require.False(t, item.Inline)
+			data, err = ioutil.ReadFile(item.Path)
+			require.Nil(t, err)
+			require.Equal(t, "datamore data", string(data))
+
+			// Overwriting the file with an inline object removes the file.
+			f, err = ot.TempFile(large, 0, timestamp+1, 2, false)
+			require.Nil(t, err)
+			f.Write([]byte("ok"))
+			require.Nil(t, ot.Commit(f, large, 0, timestamp+1, "PUT", map[string]string{"Content-Length": "2"}, false, ""))
+			_, err = os.Stat(item.Path)
+			require.True(t, os.IsNotExist(err))
+			item, err = ot.Lookup(large, 0, false)
+			require.Nil(t, err)
+			require.Equal(t, []byte("ok"), item.Data)
+
+			require.Nil(t, ot.Commit(nil, large, 0, timestamp+2, "DELETE", map[string]string{}, false, ""))
+			item, err = ot.Lookup(large, 0, false)
+			require.Nil(t, err)
+			require.True(t, item.Deletion)
+			require.False(t, item.Inline)
+		})
+	}
+}
+
+func TestIndexDBInlineMigration(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	// An index from before objects could be inline.
+	for i := 0; i < 4; i++ {
+		db, err := sql.Open("sqlite3", filepath.Join(pth, fmt.Sprintf("index.db.%02x", i)))
+		require.Nil(t, err)
+		_, err = db.Exec(`
+			CREATE TABLE objects (
+				hash TEXT NOT NULL,
+				shard INTEGER NOT NULL,
+				timestamp INTEGER NOT NULL,
+				nursery BOOLEAN NOT NULL,
+				deletion BOOLEAN NOT NULL,
+				metahash TEXT,
+				metadata TEXT,
+				shardhash TEXT,
+				restabilize BOOLEAN NOT NULL,
+				expires INTEGER DEFAULT NULL,
+				CONSTRAINT ix_objects_hash_shard_timestamp PRIMARY KEY (hash, shard, timestamp, nursery)
+			) WITHOUT ROWID;
+		`)
+		require.Nil(t, err)
+		db.Close()
+	}
+	ot, err := NewIndexDBWithBackend(IndexBackendSQLite, pth, pth, pth, 8, 2, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	require.Nil(t, err)
+	defer ot.Close()
+	ot.SetInlineMaxSize(8)
+	hsh := md5hash("object")
+	timestamp := time.Now().UnixNano()
+	f, err := ot.TempFile(hsh, 0, timestamp, 4, false)
+	require.Nil(t, err)
+	f.Write([]byte("data"))
+	require.Nil(t, ot.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{"Content-Length": "4"}, false, ""))
+	item, err := ot.Lookup(hsh, 0, false)
+	require.Nil(t, err)
+	require.Equal(t, []byte("data"), item.Data)
+}
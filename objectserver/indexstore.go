@@ -0,0 +1,424 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// IndexBackendSQLite keeps an IndexDB in 1<<dbPartPower sqlite files.
+	IndexBackendSQLite = "sqlite"
+	// IndexBackendBadger keeps an IndexDB in a single Badger key-value store,
+	// which avoids sqlite's write amplification on fast devices.
+	IndexBackendBadger = "badger"
+)
+
+// indexStore is where an IndexDB keeps its rows.  The IndexDB handles the
+// object files and decides what the rows should be; the store just persists
+// and finds them.  Every call names the dbPart the hash belongs to, which
+// stores may use to split their data up, and rows never have Path set.
+//
+// Rows are keyed by hash, shard, timestamp and nursery, though normally a
+// hash and shard only has one nursery row and one stable row.
+type indexStore interface {
+	// lookup returns one row for hsh, as described for IndexDB.Lookup, or nil.
+	lookup(dbPart int, hsh string, shard int, justStable bool) (*IndexDBItem, error)
+	// commit calls update with the newest row for hsh, shard and nursery, or
+	// nil if there isn't one, and replaces the rows for them with the row
+	// update returns, all in one transaction.  If update returns an error,
+	// nothing is changed and the error is returned.
+	commit(dbPart int, hsh string, shard int, nursery bool, update func(current *IndexDBItem) (*IndexDBItem, error)) error
+	// setStabilized marks the rows for hsh, shard and timestamp stable and
+	// calls then, keeping the change only if then succeeds.
+	setStabilized(dbPart int, hsh string, shard int, timestamp int64, then func() error) error
+	// remove deletes the row matching all the given values, returning how
+	// many rows were deleted.
+	remove(dbPart int, hsh string, shard int, timestamp int64, nursery bool, metahash string) (int64, error)
+	// listToStabilize returns up to limit of the oldest rows in the nursery or
+	// marked for restabilizing.
+	listToStabilize(dbPart int, limit int) ([]*IndexDBItem, error)
+	// list returns rows with hashes from startHash to stopHash, after marker,
+	// in hash order; limit <= 0 means no limit.
+	list(dbPart int, startHash, stopHash, marker string, limit int) ([]*IndexDBItem, error)
+	// listExpired returns the rows that expired before now, a Unix time.
+	listExpired(dbPart int, now int64) ([]*IndexDBItem, error)
+	// delete removes the rows with the hash, shard, timestamp and nursery of
+	// each of items.
+	delete(dbPart int, items []*IndexDBItem) error
+	// reclaimTombstones deletes up to about limit of the stable deletion rows
+	// older than cutoff, a timestamp, returning how many it deleted.
+	reclaimTombstones(dbPart int, cutoff int64, limit int) (int64, error)
+	// put stores items as they are, replacing any rows with the same keys.
+	put(dbPart int, items []*IndexDBItem) error
+	close()
+}
+
+func newIndexStore(backend, dbpath string, dbPartPower uint) (indexStore, error) {
+	switch backend {
+	case "", IndexBackendSQLite:
+		return newSQLiteIndexStore(dbpath, dbPartPower)
+	case IndexBackendBadger:
+		return newBadgerIndexStore(path.Join(dbpath, "index.badger"), dbPartPower)
+	default:
+		return nil, fmt.Errorf("unknown index backend %q", backend)
+	}
+}
+
+// sqliteIndexStore keeps each dbPart in its own sqlite database, so they can
+// be written to independently.
+type sqliteIndexStore struct {
+	dbs []*sql.DB
+}
+
+func newSQLiteIndexStore(dbpath string, dbPartPower uint) (*sqliteIndexStore, error) {
+	s := &sqliteIndexStore{dbs: make([]*sql.DB, 1<<dbPartPower)}
+	var err error
+	for i := range s.dbs {
+		s.dbs[i], err = sql.Open("sqlite3", "file:"+path.Join(dbpath, fmt.Sprintf("index.db.%02x", i))+"?psow=1&_txlock=immediate&mode=rwc")
+		if err == nil {
+			s.dbs[i].SetMaxOpenConns(2)
+			s.dbs[i].SetMaxIdleConns(2)
+			err = s.init(i)
+		}
+		if err != nil {
+			for j := 0; j < i; j++ {
+				s.dbs[j].Close()
+			}
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *sqliteIndexStore) init(dbi int) error {
+	db := s.dbs[dbi]
+	if _, err := db.Exec(`
+        PRAGMA synchronous = NORMAL;
+        PRAGMA cache_size = -4096;
+        PRAGMA temp_store = MEMORY;
+        PRAGMA journal_mode = WAL;
+        PRAGMA busy_timeout = 25000;
+    `, nil); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS objects (
+			hash TEXT NOT NULL,
+			shard INTEGER NOT NULL,
+			timestamp INTEGER NOT NULL,
+			nursery BOOLEAN NOT NULL,
+			deletion BOOLEAN NOT NULL,
+			metahash TEXT, -- NULLable because not everyone stores the metadata
+			metadata TEXT, -- NULLable because not everyone stores the metadata
+			shardhash TEXT, -- NULLable because not every object is a shard
+			restabilize BOOLEAN NOT NULL,
+			expires INTEGER DEFAULT NULL,
+			inline BOOLEAN NOT NULL DEFAULT 0,
+			data BLOB, -- the object itself, when inline
+			CONSTRAINT ix_objects_hash_shard_timestamp PRIMARY KEY (hash, shard, timestamp, nursery)
+		) WITHOUT ROWID;
+	`)
+	if err != nil {
+		return err
+	}
+	// Tables made before objects could be stored inline need the columns.
+	var schema string
+	if err = tx.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'objects'").Scan(&schema); err != nil {
+		return err
+	}
+	if !strings.Contains(schema, "inline") {
+		if _, err = tx.Exec(`
+			ALTER TABLE objects ADD COLUMN inline BOOLEAN NOT NULL DEFAULT 0;
+			ALTER TABLE objects ADD COLUMN data BLOB;
+		`); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec("CREATE INDEX IF NOT EXISTS ix_stabilize_items ON objects (nursery, restabilize, timestamp) WHERE nursery = 1 OR restabilize = 1"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("CREATE INDEX IF NOT EXISTS ix_object_expires ON objects(expires) WHERE expires IS NOT NULL"); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("CREATE INDEX IF NOT EXISTS ix_object_tombstones ON objects(timestamp) WHERE deletion = 1 AND nursery = 0"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteIndexStore) close() {
+	for _, db := range s.dbs {
+		db.Close()
+	}
+}
+
+func (s *sqliteIndexStore) lookup(dbPart int, hsh string, shard int, justStable bool) (*IndexDBItem, error) {
+	db := s.dbs[dbPart]
+	var rows *sql.Rows
+	var err error
+	if justStable {
+		rows, err = db.Query(`
+			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires, inline, data
+			FROM objects
+			WHERE hash = ? AND shard = ? AND nursery = 0
+			LIMIT 1
+		`, hsh, shard)
+	} else if shard == shardAny {
+		rows, err = db.Query(`
+			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires, inline, data
+			FROM objects
+			WHERE hash = ? AND metadata IS NOT NULL
+			ORDER BY nursery DESC, shard ASC
+			LIMIT 1
+		`, hsh)
+	} else {
+		rows, err = db.Query(`
+			SELECT timestamp, deletion, metahash, metadata, nursery, shard, shardhash, restabilize, expires, inline, data
+			FROM objects
+			WHERE hash = ? AND shard = ?
+			ORDER BY nursery DESC
+			LIMIT 1
+		`, hsh, shard)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	item := &IndexDBItem{Hash: hsh}
+	if err = rows.Scan(&item.Timestamp, &item.Deletion, &item.Metahash,
+		&item.Metabytes, &item.Nursery, &item.Shard, &item.ShardHash, &item.Restabilize, &item.Expires,
+		&item.Inline, &item.Data); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *sqliteIndexStore) commit(dbPart int, hsh string, shard int, nursery bool, update func(current *IndexDBItem) (*IndexDBItem, error)) error {
+	tx, err := s.dbs[dbPart].Begin()
+	if err != nil {
+		return err
+	}
+	// If tx.Commit() was already called, this is a No-Op.
+	defer tx.Rollback()
+	rows, err := tx.Query(`
+        SELECT timestamp, metahash, metadata, shardhash, inline, data
+        FROM objects
+        WHERE hash = ? AND shard = ? AND nursery = ?
+        ORDER BY timestamp DESC
+    `, hsh, shard, nursery)
+	if err != nil {
+		return err
+	}
+	var current *IndexDBItem
+	if rows.Next() {
+		current = &IndexDBItem{Hash: hsh, Shard: shard, Nursery: nursery}
+		if err = rows.Scan(&current.Timestamp, &current.Metahash, &current.Metabytes, &current.ShardHash, &current.Inline, &current.Data); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	item, err := update(current)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		_, err = tx.Exec(`
+            INSERT INTO objects (hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires, inline, data)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `, hsh, shard, item.Timestamp, item.Deletion, item.Metahash, item.Metabytes, nursery, item.ShardHash, item.Restabilize, item.Expires, item.Inline, item.Data)
+	} else {
+		_, err = tx.Exec(`
+            UPDATE objects
+            SET timestamp = ?, deletion = ?, metahash = ?, metadata = ?, nursery = ?, shardhash = ?, restabilize = ?, expires = ?, inline = ?, data = ?
+            WHERE hash = ? AND shard = ? AND nursery = ?
+        `, item.Timestamp, item.Deletion, item.Metahash, item.Metabytes, nursery, item.ShardHash, item.Restabilize, item.Expires, item.Inline, item.Data, hsh, shard, nursery)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteIndexStore) setStabilized(dbPart int, hsh string, shard int, timestamp int64, then func() error) error {
+	tx, err := s.dbs[dbPart].Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+	    UPDATE objects SET nursery = 0, restabilize = 0
+		WHERE hash = ? AND shard = ? AND timestamp = ?
+		`, hsh, shard, timestamp)
+	if err != nil {
+		return err
+	}
+	if err = then(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteIndexStore) remove(dbPart int, hsh string, shard int, timestamp int64, nursery bool, metahash string) (int64, error) {
+	res, err := s.dbs[dbPart].Exec(`
+        DELETE
+		FROM objects
+        WHERE hash = ? AND shard = ? AND timestamp = ? AND nursery = ? AND metahash = ?
+    `, hsh, shard, timestamp, nursery, metahash)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqliteIndexStore) listToStabilize(dbPart int, limit int) ([]*IndexDBItem, error) {
+	rows, err := s.dbs[dbPart].Query(`
+				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, restabilize, expires, inline, data
+				FROM objects
+				WHERE nursery = 1 OR restabilize = 1
+                ORDER BY timestamp LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*IndexDBItem
+	for rows.Next() {
+		item := &IndexDBItem{}
+		if err = rows.Scan(&item.Hash, &item.Shard, &item.Timestamp, &item.Deletion, &item.Metahash,
+			&item.Metabytes, &item.Nursery, &item.Restabilize, &item.Expires, &item.Inline, &item.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqliteIndexStore) list(dbPart int, startHash, stopHash, marker string, limit int) ([]*IndexDBItem, error) {
+	db := s.dbs[dbPart]
+	var rows *sql.Rows
+	var err error
+	if limit > 0 {
+		rows, err = db.Query(`
+				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires, inline, data
+			FROM objects
+			WHERE hash BETWEEN ? AND ? AND hash > ?
+			ORDER BY hash
+			LIMIT ?
+		    `, startHash, stopHash, marker, limit)
+	} else {
+		rows, err = db.Query(`
+				SELECT hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires, inline, data
+			FROM objects
+			WHERE hash BETWEEN ? AND ? AND hash > ?
+			ORDER BY hash
+		    `, startHash, stopHash, marker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*IndexDBItem
+	for rows.Next() {
+		item := &IndexDBItem{}
+		if err = rows.Scan(&item.Hash, &item.Shard, &item.Timestamp, &item.Deletion, &item.Metahash,
+			&item.Metabytes, &item.Nursery, &item.ShardHash, &item.Restabilize, &item.Expires, &item.Inline, &item.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqliteIndexStore) listExpired(dbPart int, now int64) ([]*IndexDBItem, error) {
+	rows, err := s.dbs[dbPart].Query("SELECT hash, shard, timestamp, nursery FROM objects WHERE expires < ?", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*IndexDBItem
+	for rows.Next() {
+		item := &IndexDBItem{}
+		if err = rows.Scan(&item.Hash, &item.Shard, &item.Timestamp, &item.Nursery); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqliteIndexStore) delete(dbPart int, items []*IndexDBItem) error {
+	tx, err := s.dbs[dbPart].Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, item := range items {
+		if _, err := tx.Exec("DELETE FROM objects WHERE hash=? AND shard=? AND timestamp=? AND nursery=?",
+			item.Hash, item.Shard, item.Timestamp, item.Nursery); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteIndexStore) reclaimTombstones(dbPart int, cutoff int64, limit int) (int64, error) {
+	res, err := s.dbs[dbPart].Exec(`
+		DELETE FROM objects
+		WHERE deletion = 1 AND nursery = 0 AND timestamp < ? AND hash IN (
+			SELECT hash FROM objects
+			WHERE deletion = 1 AND nursery = 0 AND timestamp < ?
+			LIMIT ?
+		)
+	`, cutoff, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqliteIndexStore) put(dbPart int, items []*IndexDBItem) error {
+	tx, err := s.dbs[dbPart].Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, item := range items {
+		if _, err := tx.Exec(`
+            INSERT OR REPLACE INTO objects (hash, shard, timestamp, deletion, metahash, metadata, nursery, shardhash, restabilize, expires, inline, data)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `, item.Hash, item.Shard, item.Timestamp, item.Deletion, item.Metahash, item.Metabytes, item.Nursery, item.ShardHash, item.Restabilize, item.Expires, item.Inline, item.Data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
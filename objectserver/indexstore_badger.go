@@ -0,0 +1,537 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	// badgerGCInterval is how often a badgerIndexStore rewrites its value log
+	// to reclaim the space of overwritten and deleted rows.
+	badgerGCInterval = 10 * time.Minute
+	// badgerRowKeyLen is the length of a rowKey: hash, shard, timestamp and
+	// nursery.
+	badgerRowKeyLen = 32 + 8 + 16 + 1
+	// badgerIndexPrefixLen is the length of the part of a secondary index key
+	// before its rowKey: kind, dbPart and the indexed value.
+	badgerIndexPrefixLen = 1 + 2 + 16
+)
+
+// badgerRow is the stored value of a row; the rest of the row is its key.
+type badgerRow struct {
+	Deletion    bool   `json:"d,omitempty"`
+	Metahash    string `json:"mh,omitempty"`
+	Metadata    []byte `json:"m"`
+	ShardHash   string `json:"sh,omitempty"`
+	Restabilize bool   `json:"r,omitempty"`
+	Expires     *int64 `json:"e,omitempty"`
+	Inline      bool   `json:"i,omitempty"`
+	Data        []byte `json:"b,omitempty"`
+}
+
+// badgerIndexStore keeps all of a disk's rows in one Badger database.  Rows
+// are under "o" + rowKey, so they sort like the sqlite primary key, and the
+// sqlite indexes are kept by hand as empty keys:
+//
+//	"n" + dbPart + timestamp + rowKey  rows to stabilize
+//	"e" + dbPart + expires + rowKey    rows with an X-Delete-At
+//	"t" + dbPart + timestamp + rowKey  stable deletions
+type badgerIndexStore struct {
+	db          *badger.DB
+	dbPartPower uint
+	// locks serialize the writes to each dbPart, as sqlite does, so
+	// concurrent writes to an object wait instead of failing with conflicts.
+	locks []sync.Mutex
+	done  chan struct{}
+}
+
+func newBadgerIndexStore(dir string, dbPartPower uint) (*badgerIndexStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &badgerIndexStore{
+		db:          db,
+		dbPartPower: dbPartPower,
+		locks:       make([]sync.Mutex, 1<<dbPartPower),
+		done:        make(chan struct{}),
+	}
+	go s.gc()
+	return s, nil
+}
+
+func (s *badgerIndexStore) gc() {
+	ticker := time.NewTicker(badgerGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			for s.db.RunValueLogGC(0.5) == nil {
+			}
+		}
+	}
+}
+
+func (s *badgerIndexStore) close() {
+	close(s.done)
+	s.db.Close()
+}
+
+func (s *badgerIndexStore) dbPart(hsh string) int {
+	b, _ := strconv.ParseUint(hsh[:2], 16, 8)
+	return int(b >> (8 - s.dbPartPower))
+}
+
+func badgerBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func badgerRowKey(hsh string, shard int, timestamp int64, nursery bool) string {
+	return fmt.Sprintf("%s%08x%016x%s", hsh, shard, uint64(timestamp), badgerBool(nursery))
+}
+
+func badgerIndexKey(kind string, dbPart int, value int64, rowKey string) []byte {
+	return []byte(fmt.Sprintf("%s%02x%016x%s", kind, dbPart, uint64(value), rowKey))
+}
+
+// parseBadgerRowKey returns an item with the hash, shard, timestamp and
+// nursery in rowKey.
+func parseBadgerRowKey(rowKey string) (*IndexDBItem, error) {
+	if len(rowKey) != badgerRowKeyLen {
+		return nil, fmt.Errorf("invalid index row key %q", rowKey)
+	}
+	shard, err := strconv.ParseUint(rowKey[32:40], 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index row key %q: %v", rowKey, err)
+	}
+	timestamp, err := strconv.ParseUint(rowKey[40:56], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index row key %q: %v", rowKey, err)
+	}
+	return &IndexDBItem{Hash: rowKey[:32], Shard: int(shard), Timestamp: int64(timestamp), Nursery: rowKey[56] == '1'}, nil
+}
+
+func decodeBadgerRow(key, value []byte) (*IndexDBItem, error) {
+	item, err := parseBadgerRowKey(string(key[1:]))
+	if err != nil {
+		return nil, err
+	}
+	var row badgerRow
+	if err = json.Unmarshal(value, &row); err != nil {
+		return nil, fmt.Errorf("invalid index row %q: %v", key, err)
+	}
+	item.Deletion = row.Deletion
+	item.Metahash = row.Metahash
+	item.Metabytes = row.Metadata
+	item.ShardHash = row.ShardHash
+	item.Restabilize = row.Restabilize
+	item.Expires = row.Expires
+	item.Inline = row.Inline
+	item.Data = row.Data
+	return item, nil
+}
+
+// getRow returns the row under rowKey, or nil if there isn't one.
+func (s *badgerIndexStore) getRow(txn *badger.Txn, rowKey string) (*IndexDBItem, error) {
+	key := []byte("o" + rowKey)
+	bitem, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	value, err := bitem.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBadgerRow(key, value)
+}
+
+// rows returns the rows whose rowKeys start with prefix, in key order.
+func (s *badgerIndexStore) rows(txn *badger.Txn, prefix string) ([]*IndexDBItem, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	var items []*IndexDBItem
+	p := []byte("o" + prefix)
+	for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		item, err := decodeBadgerRow(it.Item().KeyCopy(nil), value)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *badgerIndexStore) indexKeys(item *IndexDBItem) [][]byte {
+	dbPart := s.dbPart(item.Hash)
+	rowKey := badgerRowKey(item.Hash, item.Shard, item.Timestamp, item.Nursery)
+	var keys [][]byte
+	if item.Nursery || item.Restabilize {
+		keys = append(keys, badgerIndexKey("n", dbPart, item.Timestamp, rowKey))
+	}
+	if item.Expires != nil && *item.Expires >= 0 {
+		keys = append(keys, badgerIndexKey("e", dbPart, *item.Expires, rowKey))
+	}
+	if item.Deletion && !item.Nursery {
+		keys = append(keys, badgerIndexKey("t", dbPart, item.Timestamp, rowKey))
+	}
+	return keys
+}
+
+func (s *badgerIndexStore) setRow(txn *badger.Txn, item *IndexDBItem) error {
+	value, err := json.Marshal(&badgerRow{
+		Deletion:    item.Deletion,
+		Metahash:    item.Metahash,
+		Metadata:    item.Metabytes,
+		ShardHash:   item.ShardHash,
+		Restabilize: item.Restabilize,
+		Expires:     item.Expires,
+		Inline:      item.Inline,
+		Data:        item.Data,
+	})
+	if err != nil {
+		return err
+	}
+	if err = txn.Set([]byte("o"+badgerRowKey(item.Hash, item.Shard, item.Timestamp, item.Nursery)), value); err != nil {
+		return err
+	}
+	for _, key := range s.indexKeys(item) {
+		if err = txn.Set(key, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRow removes item, which must be the row as stored so the right index
+// keys are removed with it.
+func (s *badgerIndexStore) deleteRow(txn *badger.Txn, item *IndexDBItem) error {
+	if err := txn.Delete([]byte("o" + badgerRowKey(item.Hash, item.Shard, item.Timestamp, item.Nursery))); err != nil {
+		return err
+	}
+	for _, key := range s.indexKeys(item) {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *badgerIndexStore) lookup(dbPart int, hsh string, shard int, justStable bool) (*IndexDBItem, error) {
+	var found *IndexDBItem
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := hsh
+		if shard != shardAny || justStable {
+			prefix += fmt.Sprintf("%08x", shard)
+		}
+		items, err := s.rows(txn, prefix)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if justStable {
+				if !item.Nursery {
+					found = item
+					return nil
+				}
+				continue
+			}
+			if shard == shardAny && item.Metabytes == nil {
+				continue
+			}
+			if item.Nursery {
+				found = item
+				return nil
+			}
+			if found == nil {
+				found = item
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (s *badgerIndexStore) commit(dbPart int, hsh string, shard int, nursery bool, update func(current *IndexDBItem) (*IndexDBItem, error)) error {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		items, err := s.rows(txn, fmt.Sprintf("%s%08x", hsh, shard))
+		if err != nil {
+			return err
+		}
+		var current *IndexDBItem
+		var replaced []*IndexDBItem
+		for _, item := range items {
+			if item.Nursery != nursery {
+				continue
+			}
+			replaced = append(replaced, item)
+			if current == nil || item.Timestamp > current.Timestamp {
+				current = item
+			}
+		}
+		item, err := update(current)
+		if err != nil {
+			return err
+		}
+		for _, r := range replaced {
+			if err = s.deleteRow(txn, r); err != nil {
+				return err
+			}
+		}
+		item.Hash, item.Shard, item.Nursery = hsh, shard, nursery
+		return s.setRow(txn, item)
+	})
+}
+
+func (s *badgerIndexStore) setStabilized(dbPart int, hsh string, shard int, timestamp int64, then func() error) error {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		items, err := s.rows(txn, fmt.Sprintf("%s%08x%016x", hsh, shard, uint64(timestamp)))
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err = s.deleteRow(txn, item); err != nil {
+				return err
+			}
+			item.Nursery, item.Restabilize = false, false
+			if err = s.setRow(txn, item); err != nil {
+				return err
+			}
+		}
+		return then()
+	})
+}
+
+func (s *badgerIndexStore) remove(dbPart int, hsh string, shard int, timestamp int64, nursery bool, metahash string) (int64, error) {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	var removed int64
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := s.getRow(txn, badgerRowKey(hsh, shard, timestamp, nursery))
+		if err != nil || item == nil || item.Metahash != metahash {
+			return err
+		}
+		removed = 1
+		return s.deleteRow(txn, item)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// indexed returns up to limit rows from the secondary index kind for dbPart,
+// stopping at the first whose indexed value isn't below before.
+func (s *badgerIndexStore) indexed(txn *badger.Txn, kind string, dbPart int, before int64, limit int) ([]*IndexDBItem, error) {
+	rowKeys, err := s.indexedRowKeys(txn, kind, dbPart, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	var items []*IndexDBItem
+	for _, rowKey := range rowKeys {
+		item, err := s.getRow(txn, rowKey)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// indexedRowKeys is the iterating half of indexed, split out so the iterator
+// is closed before the rows are read; read-write transactions only allow one
+// iterator at a time.
+func (s *badgerIndexStore) indexedRowKeys(txn *badger.Txn, kind string, dbPart int, before int64, limit int) ([]string, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var rowKeys []string
+	prefix := []byte(fmt.Sprintf("%s%02x", kind, dbPart))
+	for it.Seek(prefix); it.ValidForPrefix(prefix) && (limit <= 0 || len(rowKeys) < limit); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		if len(key) != badgerIndexPrefixLen+badgerRowKeyLen {
+			return nil, fmt.Errorf("invalid index key %q", key)
+		}
+		value, err := strconv.ParseUint(string(key[3:badgerIndexPrefixLen]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index key %q: %v", key, err)
+		}
+		if int64(value) >= before {
+			break
+		}
+		rowKeys = append(rowKeys, string(key[badgerIndexPrefixLen:]))
+	}
+	return rowKeys, nil
+}
+
+func (s *badgerIndexStore) listToStabilize(dbPart int, limit int) ([]*IndexDBItem, error) {
+	var items []*IndexDBItem
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		items, err = s.indexed(txn, "n", dbPart, math.MaxInt64, limit)
+		return err
+	})
+	return items, err
+}
+
+func (s *badgerIndexStore) list(dbPart int, startHash, stopHash, marker string, limit int) ([]*IndexDBItem, error) {
+	var items []*IndexDBItem
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		seek := startHash
+		if marker > seek {
+			seek = marker
+		}
+		prefix := []byte("o")
+		for it.Seek([]byte("o" + seek)); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if len(key) != 1+badgerRowKeyLen {
+				return fmt.Errorf("invalid index row key %q", key)
+			}
+			hsh := string(key[1:33])
+			if hsh <= marker || hsh < startHash {
+				continue
+			}
+			if hsh > stopHash || s.dbPart(hsh) > dbPart {
+				break
+			}
+			if s.dbPart(hsh) < dbPart {
+				continue
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			item, err := decodeBadgerRow(key, value)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			if limit > 0 && len(items) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *badgerIndexStore) listExpired(dbPart int, now int64) ([]*IndexDBItem, error) {
+	var items []*IndexDBItem
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		items, err = s.indexed(txn, "e", dbPart, now, 0)
+		return err
+	})
+	return items, err
+}
+
+func (s *badgerIndexStore) delete(dbPart int, items []*IndexDBItem) error {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, i := range items {
+			item, err := s.getRow(txn, badgerRowKey(i.Hash, i.Shard, i.Timestamp, i.Nursery))
+			if err != nil {
+				return err
+			}
+			if item != nil {
+				if err = s.deleteRow(txn, item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerIndexStore) reclaimTombstones(dbPart int, cutoff int64, limit int) (int64, error) {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	var reclaimed int64
+	err := s.db.Update(func(txn *badger.Txn) error {
+		items, err := s.indexed(txn, "t", dbPart, cutoff, limit)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err = s.deleteRow(txn, item); err != nil {
+				return err
+			}
+		}
+		reclaimed = int64(len(items))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reclaimed, nil
+}
+
+func (s *badgerIndexStore) put(dbPart int, items []*IndexDBItem) error {
+	s.locks[dbPart].Lock()
+	defer s.locks[dbPart].Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, item := range items {
+			existing, err := s.getRow(txn, badgerRowKey(item.Hash, item.Shard, item.Timestamp, item.Nursery))
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				if err = s.deleteRow(txn, existing); err != nil {
+					return err
+				}
+			}
+			if err = s.setRow(txn, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
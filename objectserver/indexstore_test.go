@@ -0,0 +1,161 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"go.uber.org/zap"
+)
+
+func newTestIndexDBBackend(t *testing.T, backend, pth string) *IndexDB {
+	t.Helper()
+	ot, err := NewIndexDBWithBackend(backend, pth, pth, pth, 8, 2, 1, 0, zap.L(), fakeIndexDBAuditor{})
+	require.Nil(t, err)
+	return ot
+}
+
+func TestIndexDBBackends(t *testing.T) {
+	for _, backend := range []string{IndexBackendSQLite, IndexBackendBadger} {
+		t.Run(backend, func(t *testing.T) {
+			pth, _ := ioutil.TempDir("", "")
+			defer os.RemoveAll(pth)
+			ot := newTestIndexDBBackend(t, backend, pth)
+			defer ot.Close()
+			timestamp := time.Now().UnixNano()
+
+			hsh := md5hash("object1")
+			f, err := ot.TempFile(hsh, 0, timestamp, 4, true)
+			require.Nil(t, err)
+			f.Write([]byte("data"))
+			require.Nil(t, ot.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{"Content-Length": "4"}, true, ""))
+			item, err := ot.Lookup(hsh, 0, false)
+			require.Nil(t, err)
+			require.Equal(t, timestamp, item.Timestamp)
+			require.True(t, item.Nursery)
+			item, err = ot.Lookup(hsh, shardAny, false)
+			require.Nil(t, err)
+			require.NotNil(t, item)
+			item, err = ot.Lookup(hsh, 0, true)
+			require.Nil(t, err)
+			require.Nil(t, item)
+
+			items, err := ot.ListObjectsToStabilize()
+			require.Nil(t, err)
+			require.Equal(t, 1, len(items))
+			require.Nil(t, ot.SetStabilized(hsh, 0, timestamp, true))
+			items, err = ot.ListObjectsToStabilize()
+			require.Nil(t, err)
+			require.Equal(t, 0, len(items))
+			item, err = ot.Lookup(hsh, 0, true)
+			require.Nil(t, err)
+			require.False(t, item.Nursery)
+			_, err = os.Stat(item.Path)
+			require.Nil(t, err)
+
+			// A POST to a stable object marks it for restabilizing.
+			require.Nil(t, ot.Commit(nil, hsh, 0, timestamp+1, "POST", map[string]string{"X-Object-Meta-Color": "blue"}, false, ""))
+			items, err = ot.ListObjectsToStabilize()
+			require.Nil(t, err)
+			require.Equal(t, 1, len(items))
+			require.True(t, items[0].Restabilize)
+			require.Equal(t, common.ErrNotFound, ot.Commit(nil, md5hash("missing"), 0, timestamp, "POST", map[string]string{"X-Object-Meta-Color": "blue"}, false, ""))
+
+			expiring := md5hash("expiring")
+			f, err = ot.TempFile(expiring, 0, timestamp, 4, false)
+			require.Nil(t, err)
+			f.Write([]byte("data"))
+			require.Nil(t, ot.Commit(f, expiring, 0, timestamp, "PUT", map[string]string{"X-Delete-At": strconv.FormatInt(time.Now().Unix()-1, 10)}, false, ""))
+			tombstone := md5hash("tombstone")
+			require.Nil(t, ot.Commit(nil, tombstone, 0, time.Now().Add(-2*time.Hour).UnixNano(), "DELETE", map[string]string{}, false, ""))
+
+			items, err = ot.List("", "", "", 0)
+			require.Nil(t, err)
+			require.Equal(t, 3, len(items))
+			for i := 1; i < len(items); i++ {
+				require.True(t, items[i-1].Hash < items[i].Hash)
+			}
+			items, err = ot.List("", "", items[0].Hash, 1)
+			require.Nil(t, err)
+			require.NotEqual(t, 0, len(items))
+
+			require.Nil(t, ot.ExpireObjects())
+			item, err = ot.Lookup(expiring, 0, false)
+			require.Nil(t, err)
+			require.Nil(t, item)
+			reclaimed, err := ot.ReclaimTombstones(time.Hour)
+			require.Nil(t, err)
+			require.Equal(t, int64(1), reclaimed)
+
+			item, err = ot.Lookup(hsh, 0, false)
+			require.Nil(t, err)
+			removed, err := ot.Remove(hsh, 0, item.Timestamp, item.Nursery, item.Metahash)
+			require.Nil(t, err)
+			require.Equal(t, int64(1), removed)
+			items, err = ot.List("", "", "", 0)
+			require.Nil(t, err)
+			require.Equal(t, 0, len(items))
+		})
+	}
+}
+
+func TestConvertIndexDB(t *testing.T) {
+	pth, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(pth)
+	from := newTestIndexDBBackend(t, IndexBackendSQLite, pth)
+	defer from.Close()
+	timestamp := time.Now().UnixNano()
+	for i := 0; i < 10; i++ {
+		hsh := md5hash("object" + strconv.Itoa(i))
+		f, err := from.TempFile(hsh, 0, timestamp, 4, false)
+		require.Nil(t, err)
+		f.Write([]byte("data"))
+		require.Nil(t, from.Commit(f, hsh, 0, timestamp, "PUT", map[string]string{"name": "/a/c/o" + strconv.Itoa(i)}, i%2 == 0, ""))
+		if i < 5 {
+			f, err = from.TempFile(hsh, 1, timestamp, 4, false)
+			require.Nil(t, err)
+			f.Write([]byte("data"))
+			require.Nil(t, from.Commit(f, hsh, 1, timestamp, "PUT", map[string]string{"name": "/a/c/o" + strconv.Itoa(i)}, true, ""))
+		}
+	}
+	to := newTestIndexDBBackend(t, IndexBackendBadger, pth)
+	defer to.Close()
+	// small batches, so some end partway through a hash's rows
+	defer func(size int) { convertBatchSize = size }(convertBatchSize)
+	convertBatchSize = 2
+	copied, err := ConvertIndexDB(from, to)
+	require.Nil(t, err)
+	require.Equal(t, 15, copied)
+	fromItems, err := from.List("", "", "", 0)
+	require.Nil(t, err)
+	toItems, err := to.List("", "", "", 0)
+	require.Nil(t, err)
+	require.ElementsMatch(t, fromItems, toItems)
+	stabilize, err := to.ListObjectsToStabilize()
+	require.Nil(t, err)
+	require.Equal(t, 10, len(stabilize))
+	item, err := to.Lookup(md5hash("object3"), 0, false)
+	require.Nil(t, err)
+	require.Equal(t, `{"name":"/a/c/o3"}`, string(item.Metabytes))
+	_, err = os.Stat(item.Path)
+	require.Nil(t, err)
+}
@@ -17,9 +17,11 @@ package objectserver
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"net/http"
@@ -59,27 +61,60 @@ type ObjectServer struct {
 	logLevel           zap.AtomicLevel
 	diskInUse          *common.KeyedLimit
 	accountDiskInUse   *common.KeyedLimit
+	classInUse         requestClassLimits
+	lowPriorityInUse   *common.KeyedLimit
 	expiringDivisor    int64
 	updateClient       common.HTTPClient
 	objEngines         map[int]ObjectEngine
+	sha256Policies     map[int]bool
 	updateTimeout      time.Duration
 	asyncWG            sync.WaitGroup // Used to wait on async goroutines
 	metricsCloser      io.Closer
 	traceCloser        io.Closer
 	tracer             opentracing.Tracer
 	updateClientCloser io.Closer
+	diskStats          *middleware.DiskStatsCollector
+	diskStatsInterval  time.Duration
+	diskStatsCancel    chan struct{}
+	objLocks           objectLocks
+	// slowRequestThreshold is how long a request can take before
+	// LogSlowRequests logs it; zero disables it.
+	slowRequestThreshold time.Duration
+	breaker              *deviceBreaker
+	// putHashPipelined is 1 when PUTs hash on their own goroutines; see
+	// put_hash_mode.
+	putHashPipelined int32
 }
 
 func (server *ObjectServer) Type() string {
 	return "object"
 }
 
+// Reload applies the settings that can be changed without a restart.
+func (server *ObjectServer) Reload(config conf.Config) ([]string, error) {
+	var changes []string
+	if changed, err := srv.ReloadLogLevel(server.logLevel, config, "app:object-server"); err != nil {
+		return nil, err
+	} else if changed {
+		changes = append(changes, "app:object-server/log_level")
+	}
+	if mode, err := putHashModeSetting(config); err != nil {
+		return nil, err
+	} else if server.setPutHashMode(mode) {
+		changes = append(changes, "app:object-server/put_hash_mode")
+	}
+	return changes, nil
+}
+
 func (server *ObjectServer) Background(flags *flag.FlagSet) chan struct{} {
 	return nil
 }
 
 func (server *ObjectServer) Finalize() {
 	server.asyncWG.Wait()
+	if server.diskStatsCancel != nil {
+		close(server.diskStatsCancel)
+	}
 	if server.metricsCloser != nil {
 		server.metricsCloser.Close()
 	}
@@ -100,7 +135,33 @@ func (server *ObjectServer) newObject(req *http.Request, vars map[string]string,
 	if !ok {
 		return nil, fmt.Errorf("Engine for policy index %d not found.", policy)
 	}
-	return engine.New(vars, needData, &server.asyncWG)
+	if !needData && common.LooksTrue(req.Header.Get(FetchMetadataOnlyHeader)) {
+		vars[metadataOnlyVar] = "true"
+	}
+	obj, err := engine.New(vars, needData, &server.asyncWG)
+	markPhase(req, "open")
+	return obj, err
+}
+
+// lockObject serializes writes to the request's object, returning the
+// function that releases the lock.
+func (server *ObjectServer) lockObject(req *http.Request, vars map[string]string) func() {
+	policy, err := strconv.Atoi(req.Header.Get("X-Backend-Storage-Policy-Index"))
+	if err != nil {
+		policy = 0
+	}
+	unlock := server.objLocks.Lock(objectLockKey(vars, policy, ObjHash(vars, server.hashPathPrefix, server.hashPathSuffix)))
+	markPhase(req, "lock")
+	return unlock
+}
+
+// deviceError counts an I/O error against the request's device, taking the
+// device out of service if it's had too many.
+func (server *ObjectServer) deviceError(req *http.Request, vars map[string]string) {
+	if server.breaker.Error(vars["device"]) {
+		srv.GetLogger(req).Error("Taking device out of service after repeated I/O errors",
+			zap.String("device", vars["device"]), zap.Duration("cooldown", server.breaker.cooldown))
+	}
 }
 
 func resolveEtag(req *http.Request, metadata map[string]string) string {
@@ -120,13 +181,14 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 	obj, err := server.newObject(request, vars, request.Method == "GET")
 	if err != nil {
 		srv.GetLogger(request).Error("Unable to open object.", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
 	defer obj.Close()
 
 	ifMatches := common.ParseIfMatch(request.Header.Get("If-Match"))
-	ifNoneMatches := common.ParseIfMatch(request.Header.Get("If-None-Match"))
+	ifNoneMatches := common.ParseIfNoneMatch(request.Header.Get("If-None-Match"))
 
 	metadata := obj.Metadata()
 	headers.Set("X-Backend-Timestamp", metadata["X-Timestamp"])
@@ -142,7 +204,7 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 	}
 	etag := resolveEtag(request, metadata)
 
-	if Expired(metadata) {
+	if Expired(metadata) && !common.LooksTrue(request.Header.Get("X-Backend-Open-Expired")) {
 		srv.StandardResponse(writer, http.StatusNotFound)
 		return
 	}
@@ -154,8 +216,10 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
+	lastModified = common.LastModified(lastModified)
 	headers.Set("Last-Modified", common.FormatLastModified(lastModified))
 	headers.Set("ETag", "\""+etag+"\"")
+	headers.Set("Accept-Ranges", "bytes")
 	xTimestamp, err := common.GetEpochFromTimestamp(metadata["X-Timestamp"])
 	if err != nil {
 		srv.GetLogger(request).Error("Error getting the epoch time from x-timestamp", zap.Error(err))
@@ -170,6 +234,9 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 			headers.Set(key, value)
 		}
 	}
+	if checksum := metadata["X-Object-Checksum-Sha256"]; checksum != "" {
+		headers.Set("X-Object-Checksum-Sha256", checksum)
+	}
 
 	if len(ifMatches) > 0 && !ifMatches[etag] && !ifMatches["*"] {
 		srv.StandardResponse(writer, http.StatusPreconditionFailed)
@@ -181,17 +248,18 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 		return
 	}
 
-	if ius, err := common.ParseDate(request.Header.Get("If-Unmodified-Since")); err == nil && lastModified.After(ius) {
+	// If-Unmodified-Since and If-Modified-Since only apply when there's no
+	// If-Match or If-None-Match respectively (RFC 7232 section 6).
+	if ius, err := common.ParseDate(request.Header.Get("If-Unmodified-Since")); err == nil && len(ifMatches) == 0 && lastModified.After(ius) {
 		srv.StandardResponse(writer, http.StatusPreconditionFailed)
 		return
 	}
 
-	if ims, err := common.ParseDate(request.Header.Get("If-Modified-Since")); err == nil && lastModified.Before(ims) {
+	if ims, err := common.ParseDate(request.Header.Get("If-Modified-Since")); err == nil && len(ifNoneMatches) == 0 && !lastModified.After(ims) {
 		writer.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	headers.Set("Accept-Ranges", "bytes")
 	headers.Set("Content-Type", metadata["Content-Type"])
 	headers.Set("Content-Length", metadata["Content-Length"])
 
@@ -202,7 +270,13 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 			headers.Set("Content-Range", fmt.Sprintf("bytes */%d", obj.ContentLength()))
 			writer.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
 			return
-		} else if ranges != nil && len(ranges) == 1 {
+		}
+		if p, ok := obj.(ObjectPrefetcher); ok {
+			for _, rng := range ranges {
+				p.Prefetch(rng.Start, rng.End)
+			}
+		}
+		if ranges != nil && len(ranges) == 1 {
 			headers.Set("Content-Length", strconv.FormatInt(int64(ranges[0].End-ranges[0].Start), 10))
 			headers.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", ranges[0].Start, ranges[0].End-1, obj.ContentLength()))
 			writer.WriteHeader(http.StatusPartialContent)
@@ -232,6 +306,7 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 		if server.checkEtags {
 			hash := md5.New()
 			_, err := obj.Copy(writer, hash)
+			markPhase(request, "transfer")
 			if err != nil {
 				srv.GetLogger(request).Error("Error copying body", zap.Error(err))
 			} else if hex.EncodeToString(hash.Sum(nil)) != metadata["ETag"] {
@@ -239,6 +314,7 @@ func (server *ObjectServer) ObjGetHandler(writer http.ResponseWriter, request *h
 			}
 		} else {
 			_, err := obj.Copy(writer)
+			markPhase(request, "transfer")
 			if err != nil {
 				srv.GetLogger(request).Error("Error copying body", zap.Error(err))
 			}
@@ -273,9 +349,33 @@ func (server *ObjectServer) ObjPutHandler(writer http.ResponseWriter, request *h
 		}
 	}
 
+	body := io.Reader(request.Body)
+	contentLength := request.ContentLength
+	var footerReader *common.FooterReader
+	if common.LooksTrue(request.Header.Get(common.MetadataFooterHeader)) {
+		boundary := request.Header.Get(common.MimeBoundaryHeader)
+		if boundary == "" {
+			http.Error(writer, "Missing MIME boundary", http.StatusBadRequest)
+			return
+		}
+		contentLength = -1
+		if cl := request.Header.Get(common.ObjContentLengthHeader); cl != "" {
+			if contentLength, err = strconv.ParseInt(cl, 10, 64); err != nil || contentLength < 0 {
+				http.Error(writer, "Invalid "+common.ObjContentLengthHeader, http.StatusBadRequest)
+				return
+			}
+		}
+		if footerReader, err = common.NewFooterReader(request.Body, boundary); err != nil {
+			http.Error(writer, "Invalid MIME document", http.StatusBadRequest)
+			return
+		}
+		body = footerReader
+	}
+
 	obj, err := server.newObject(request, vars, false)
 	if err != nil {
 		srv.GetLogger(request).Error("Error getting obj", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
@@ -300,20 +400,30 @@ func (server *ObjectServer) ObjPutHandler(writer http.ResponseWriter, request *h
 		}
 	}
 
-	tempFile, err := obj.SetData(request.ContentLength)
-	if err == DriveFullError {
+	tempFile, err := obj.SetData(contentLength)
+	if common.IsInsufficientStorage(err) {
 		srv.GetLogger(request).Debug("Not enough space available")
 		srv.CustomErrorResponse(writer, 507, vars)
 		return
 	} else if err != nil {
 		srv.GetLogger(request).Error("Error making new file", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
 
-	hash := md5.New()
-	totalSize, err := common.Copy(request.Body, tempFile, hash)
-	if err == io.ErrUnexpectedEOF || (request.ContentLength >= 0 && totalSize != request.ContentLength) {
+	md5Hash := md5.New()
+	policy, _ := strconv.Atoi(request.Header.Get("X-Backend-Storage-Policy-Index"))
+	sha256Hash := sha256.New()
+	hashes := []hash.Hash{md5Hash}
+	if server.sha256Policies[policy] {
+		hashes = append(hashes, sha256Hash)
+	}
+	hashWriter, hashDone := server.putHasher(hashes...)
+	totalSize, err := common.Copy(body, tempFile, hashWriter)
+	hashDone()
+	markPhase(request, "transfer")
+	if err == io.ErrUnexpectedEOF || (contentLength >= 0 && totalSize != contentLength) {
 		srv.StandardResponse(writer, 499)
 		return
 	} else if err != nil {
@@ -321,12 +431,27 @@ func (server *ObjectServer) ObjPutHandler(writer http.ResponseWriter, request *h
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
+	if footerReader != nil {
+		// The footer's metadata was worked out after the headers were sent,
+		// so it takes precedence over them.
+		footers, err := footerReader.Footers()
+		if err == io.ErrUnexpectedEOF {
+			srv.StandardResponse(writer, 499)
+			return
+		} else if err != nil {
+			http.Error(writer, "Invalid metadata footer", http.StatusBadRequest)
+			return
+		}
+		for key, value := range footers {
+			request.Header.Set(key, value)
+		}
+	}
 	metadata := map[string]string{
 		"name":           "/" + vars["account"] + "/" + vars["container"] + "/" + vars["obj"],
 		"X-Timestamp":    requestTimestamp,
 		"Content-Type":   request.Header.Get("Content-Type"),
 		"Content-Length": strconv.FormatInt(totalSize, 10),
-		"ETag":           hex.EncodeToString(hash.Sum(nil)),
+		"ETag":           hex.EncodeToString(md5Hash.Sum(nil)),
 	}
 	for key := range request.Header {
 		if allowed, ok := server.allowedHeaders[key]; (ok && allowed) ||
@@ -341,12 +466,39 @@ func (server *ObjectServer) ObjPutHandler(writer http.ResponseWriter, request *h
 		return
 	}
 	outHeaders.Set("ETag", metadata["ETag"])
+	if server.sha256Policies[policy] {
+		metadata["X-Object-Checksum-Sha256"] = hex.EncodeToString(sha256Hash.Sum(nil))
+		requestChecksum := strings.ToLower(request.Header.Get("X-Object-Checksum-Sha256"))
+		if requestChecksum != "" && requestChecksum != metadata["X-Object-Checksum-Sha256"] {
+			http.Error(writer, "Unprocessable Entity", 422)
+			return
+		}
+		outHeaders.Set("X-Object-Checksum-Sha256", metadata["X-Object-Checksum-Sha256"])
+	}
 
-	if err := obj.Commit(metadata); err != nil {
+	// Only the commit is serialized; holding the lock for the upload would
+	// leave every other write to the object waiting on a slow client.
+	unlock := server.lockObject(request, vars)
+	if creator, ok := obj.(ObjectCreator); ok && request.Header.Get("If-None-Match") == "*" {
+		// Another PUT may have landed since the check above.
+		err = creator.CommitNew(metadata)
+	} else {
+		err = obj.Commit(metadata)
+	}
+	unlock()
+	markPhase(request, "commit")
+	if err == common.ErrPreconditionFailed {
+		srv.StandardResponse(writer, http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
+		if !common.IsClientError(err) {
+			server.deviceError(request, vars)
+		}
 		srv.ErrorResponse(writer, err)
 		return
 	}
 	server.containerUpdates(writer, request, metadata, request.Header.Get("X-Delete-At"), vars, srv.GetLogger(request))
+	markPhase(request, "update")
 	srv.StandardResponse(writer, http.StatusCreated)
 }
 
@@ -364,9 +516,13 @@ func (server *ObjectServer) ObjPostHandler(writer http.ResponseWriter, request *
 		return
 	}
 
+	// Held from reading the current metadata to committing the new, so a
+	// concurrent POST can't merge with metadata that's about to be replaced.
+	defer server.lockObject(request, vars)()
 	obj, err := server.newObject(request, vars, false)
 	if err != nil {
 		srv.GetLogger(request).Error("Error getting obj", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
@@ -415,8 +571,11 @@ func (server *ObjectServer) ObjPostHandler(writer http.ResponseWriter, request *
 	metadata["name"] = "/" + vars["account"] + "/" + vars["container"] + "/" + vars["obj"]
 	metadata["X-Timestamp"] = requestTimestamp
 
-	if err := obj.CommitMetadata(metadata); err != nil {
+	err = obj.CommitMetadata(metadata)
+	markPhase(request, "commit")
+	if err != nil {
 		srv.GetLogger(request).Error("Error saving object meta file", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
@@ -434,16 +593,19 @@ func (server *ObjectServer) ObjDeleteHandler(writer http.ResponseWriter, request
 	}
 	responseStatus := http.StatusNotFound
 
+	unlock := server.lockObject(request, vars)
+	defer unlock()
 	obj, err := server.newObject(request, vars, false)
 	if err != nil {
 		srv.GetLogger(request).Error("Error getting obj", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
 	defer obj.Close()
 
 	if ida := request.Header.Get("X-If-Delete-At"); ida != "" {
-		_, err = strconv.ParseInt(ida, 10, 64)
+		idaTime, err := parseDeleteAt(ida)
 		if err != nil {
 			srv.StandardResponse(writer, http.StatusBadRequest)
 			return
@@ -453,8 +615,8 @@ func (server *ObjectServer) ObjDeleteHandler(writer http.ResponseWriter, request
 			return
 		}
 		metadata := obj.Metadata()
-		if _, ok := metadata["X-Delete-At"]; ok {
-			if ida != metadata["X-Delete-At"] {
+		if xda, ok := metadata["X-Delete-At"]; ok {
+			if xdaTime, err := parseDeleteAt(xda); err != nil || xdaTime != idaTime {
 				srv.StandardResponse(writer, http.StatusPreconditionFailed)
 				return
 			}
@@ -484,21 +646,29 @@ func (server *ObjectServer) ObjDeleteHandler(writer http.ResponseWriter, request
 		"X-Timestamp": requestTimestamp,
 		"name":        "/" + vars["account"] + "/" + vars["container"] + "/" + vars["obj"],
 	}
-	if err := obj.Delete(metadata); err == DriveFullError {
+	err = obj.Delete(metadata)
+	markPhase(request, "commit")
+	if common.IsInsufficientStorage(err) {
 		srv.GetLogger(request).Debug("Not enough space available")
 		srv.CustomErrorResponse(writer, 507, vars)
 		return
 	} else if err != nil {
 		srv.GetLogger(request).Error("Error deleting object", zap.Error(err))
+		server.deviceError(request, vars)
 		srv.StandardResponse(writer, http.StatusInternalServerError)
 		return
 	}
+	unlock()
 	headers.Set("X-Backend-Timestamp", metadata["X-Timestamp"])
 	server.containerUpdates(writer, request, metadata, deleteAt, vars, srv.GetLogger(request))
+	markPhase(request, "update")
 	srv.StandardResponse(writer, responseStatus)
 }
 
 func (server *ObjectServer) HealthcheckHandler(writer http.ResponseWriter, request *http.Request) {
+	if middleware.InMaintenance(server.reconCachePath) {
+		writer.Header().Set(middleware.MaintenanceHeader, "true")
+	}
 	writer.Header().Set("Content-Length", "2")
 	writer.WriteHeader(http.StatusOK)
 	writer.Write([]byte("OK"))
@@ -506,10 +676,19 @@ func (server *ObjectServer) HealthcheckHandler(writer http.ResponseWriter, reque
 }
 
 func (server *ObjectServer) ReconHandler(writer http.ResponseWriter, request *http.Request) {
+	if server.diskStats != nil && srv.GetVars(request)["method"] == "iostats" {
+		server.diskStats.ReconHandler(writer, request)
+		return
+	}
 	middleware.ReconHandler(server.driveRoot, server.reconCachePath, server.checkMounts, writer, request)
 	return
 }
 
+// MaintenanceHandler delegates incoming /maintenance calls to the common maintenance handler.
+func (server *ObjectServer) MaintenanceHandler(writer http.ResponseWriter, request *http.Request) {
+	middleware.MaintenanceHandler(server.reconCachePath, writer, request)
+}
+
 func (server *ObjectServer) OptionsHandler(writer http.ResponseWriter, request *http.Request) {
 	middleware.OptionsHandler("object-server", writer, request)
 	return
@@ -543,6 +722,11 @@ func (server *ObjectServer) AcquireDevice(next http.Handler) http.Handler {
 					return
 				}
 			}
+			if server.breaker.Open(device) {
+				vars["Method"] = request.Method
+				srv.CustomErrorResponse(writer, 507, vars)
+				return
+			}
 
 			forceAcquire := request.Header.Get("X-Force-Acquire") == "true"
 			if concRequests := server.diskInUse.Acquire(device, forceAcquire); concRequests != 0 {
@@ -552,6 +736,23 @@ func (server *ObjectServer) AcquireDevice(next http.Handler) http.Handler {
 			}
 			defer server.diskInUse.Release(device)
 
+			class := classifyRequest(request)
+			if concRequests := server.classInUse.Acquire(device, class, forceAcquire); concRequests != 0 {
+				writer.Header().Set("X-Disk-Usage", strconv.FormatInt(concRequests, 10))
+				srv.StandardResponse(writer, 503)
+				return
+			}
+			defer server.classInUse.Release(device, class)
+
+			if server.lowPriorityInUse != nil && common.IsLowPriority(request) {
+				if concRequests := server.lowPriorityInUse.Acquire(device, forceAcquire); concRequests != 0 {
+					writer.Header().Set("X-Disk-Usage", strconv.FormatInt(concRequests, 10))
+					srv.StandardResponse(writer, 503)
+					return
+				}
+				defer server.lowPriorityInUse.Release(device)
+			}
+
 			if account, ok := vars["account"]; ok && account != "" {
 				limitKey := fmt.Sprintf("%s/%s", device, account)
 				if concRequests := server.accountDiskInUse.Acquire(limitKey, false); concRequests != 0 {
@@ -561,6 +762,7 @@ func (server *ObjectServer) AcquireDevice(next http.Handler) http.Handler {
 				defer server.accountDiskInUse.Release(limitKey)
 			}
 		}
+		markPhase(request, "queue")
 		next.ServeHTTP(writer, request)
 	}
 	return http.HandlerFunc(fn)
@@ -592,10 +794,18 @@ func (server *ObjectServer) GetHandler(config conf.Config, metricsPrefix string)
 	commonHandlers := alice.New(
 		middleware.NewDebugResponses(config.GetBool("debug", "debug_x_source_code", false)),
 		server.LogRequest,
+		server.LogSlowRequests,
 		middleware.RecoverHandler,
 		middleware.ValidateRequest,
 		server.AcquireDevice,
 	)
+	if server.breaker != nil {
+		server.breaker.scope = metricsScope
+	}
+	if server.diskStats != nil {
+		server.diskStatsCancel = make(chan struct{})
+		go server.diskStats.Run(metricsScope, server.diskStatsInterval, server.diskStatsCancel)
+	}
 	router := srv.NewRouter()
 	router.Get("/metrics", prometheus.Handler())
 	router.Get("/loglevel", server.logLevel)
@@ -605,6 +815,9 @@ func (server *ObjectServer) GetHandler(config conf.Config, metricsPrefix string)
 	router.Put("/ring/*ring_path", commonHandlers.ThenFunc(middleware.RingHandler))
 	router.Get("/recon/:method/:recon_type", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Get("/recon/:method", commonHandlers.ThenFunc(server.ReconHandler))
+	router.Get("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Put("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
+	router.Delete("/maintenance", commonHandlers.ThenFunc(server.MaintenanceHandler))
 	router.Delete("/recon/:device/:method/:recon_type/*item_path", commonHandlers.ThenFunc(server.ReconHandler))
 	router.Get("/:device/:partition/:account/:container/*obj", commonHandlers.ThenFunc(server.ObjGetHandler))
 	router.Head("/:device/:partition/:account/:container/*obj", commonHandlers.ThenFunc(server.ObjGetHandler))
@@ -646,14 +859,33 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 	if server.objEngines, err = buildEngines(serverconf, flags, cnf); err != nil {
 		return ipPort, nil, nil, err
 	}
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		return ipPort, nil, nil, err
+	}
+	server.sha256Policies = map[int]bool{}
+	for _, policy := range policies {
+		if algorithm, err := policy.GetChecksumAlgorithm(); err != nil {
+			return ipPort, nil, nil, fmt.Errorf("Policy %d: %v", policy.Index, err)
+		} else if algorithm == "sha256" {
+			server.sha256Policies[policy.Index] = true
+		}
+	}
 
 	server.driveRoot = serverconf.GetDefault("app:object-server", "devices", "/srv/node")
 	server.reconCachePath = serverconf.GetDefault("app:object-server", "recon_cache_path", "/var/cache/swift")
 	server.checkMounts = serverconf.GetBool("app:object-server", "mount_check", true)
 	server.checkEtags = serverconf.GetBool("app:object-server", "check_etags", false)
-	server.diskInUse = common.NewKeyedLimit(serverconf.GetLimit("app:object-server", "disk_limit", 25, 0))
+	diskLimit, diskTotalLimit := serverconf.GetLimit("app:object-server", "disk_limit", 25, 0)
+	server.diskInUse = common.NewKeyedLimit(diskLimit, diskTotalLimit)
+	if server.classInUse, err = newRequestClassLimits(serverconf.GetDefault("app:object-server", "request_class_shares", ""), diskLimit); err != nil {
+		return ipPort, nil, nil, err
+	}
+	if server.lowPriorityInUse, err = common.NewLowPriorityLimit(serverconf.GetInt("app:object-server", "low_priority_share", 0), diskLimit); err != nil {
+		return ipPort, nil, nil, err
+	}
 	server.accountDiskInUse = common.NewKeyedLimit(serverconf.GetLimit("app:object-server", "account_rate_limit", 0, 0))
-	server.expiringDivisor = serverconf.GetInt("app:object-server", "expiring_objects_container_divisor", 86400)
+	server.expiringDivisor = serverconf.GetInt("app:object-server", "expiring_objects_container_divisor", 3600)
 	bindIP := serverconf.GetDefault("app:object-server", "bind_ip", "0.0.0.0")
 	bindPort := int(serverconf.GetInt("app:object-server", "bind_port", common.DefaultObjectServerPort))
 	certFile := serverconf.GetDefault("app:object-server", "cert_file", "")
@@ -671,6 +903,16 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 		return ipPort, nil, nil, fmt.Errorf("Error setting up logger: %v", err)
 	}
 	server.updateTimeout = time.Duration(serverconf.GetFloat("app:object-server", "container_update_timeout", 0.25) * float64(time.Second))
+	putHashMode, err := putHashModeSetting(serverconf)
+	if err != nil {
+		return ipPort, nil, nil, err
+	}
+	server.setPutHashMode(putHashMode)
+	server.slowRequestThreshold = time.Duration(serverconf.GetFloat("app:object-server", "slow_request_threshold", 0) * float64(time.Second))
+	server.breaker = newDeviceBreaker(int(serverconf.GetInt("app:object-server", "breaker_error_limit", 0)),
+		time.Duration(serverconf.GetFloat("app:object-server", "breaker_error_window", 60)*float64(time.Second)),
+		time.Duration(serverconf.GetFloat("app:object-server", "breaker_cooldown", 600)*float64(time.Second)),
+		server.reconCachePath)
 	connTimeout := time.Duration(serverconf.GetFloat("app:object-server", "conn_timeout", 1.0) * float64(time.Second))
 	nodeTimeout := time.Duration(serverconf.GetFloat("app:object-server", "node_timeout", 10.0) * float64(time.Second))
 	transport := &http.Transport{
@@ -713,10 +955,20 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 			return ipPort, nil, nil, fmt.Errorf("Error setting up tracing client: %v", err)
 		}
 	}
+	if diskStatsInterval := serverconf.GetFloat("app:object-server", "diskstats_interval", 10); diskStatsInterval > 0 {
+		server.diskStats = middleware.NewDiskStatsCollector(server.driveRoot)
+		server.diskStatsInterval = time.Duration(diskStatsInterval * float64(time.Second))
+	}
 	deviceLockUpdateSeconds := serverconf.GetInt("app:object-server", "device_lock_update_seconds", 0)
 	if deviceLockUpdateSeconds > 0 {
 		go server.updateDeviceLocks(deviceLockUpdateSeconds)
 	}
-	ipPort = &srv.IpPort{Ip: bindIP, Port: bindPort, CertFile: certFile, KeyFile: keyFile}
+	// Each worker process has its own device and account limits, so
+	// disk_limit and friends apply per worker when workers > 1.
+	ipPort = &srv.IpPort{Ip: bindIP, Port: bindPort, CertFile: certFile, KeyFile: keyFile,
+		Workers: int(serverconf.GetInt("app:object-server", "workers", 1))}
+	if unixSocketDir := serverconf.GetDefault("app:object-server", "unix_socket_dir", ""); unixSocketDir != "" {
+		ipPort.UnixSocket = srv.UnixSocketPath(unixSocketDir, bindPort)
+	}
 	return ipPort, server, server.logger, nil
 }
@@ -17,6 +17,8 @@ package objectserver
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
 	"flag"
 	"fmt"
 	"io"
@@ -169,6 +171,52 @@ func TestBasicPutGet(t *testing.T) {
 	assert.Equal(t, "9", resp.Header.Get("Content-Length"))
 }
 
+func TestPutSha256Checksum(t *testing.T) {
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	confLoader.GetPoliciesFunc = func() (conf.PolicyList, error) {
+		return conf.PolicyList(map[int]*conf.Policy{
+			0: {Index: 0, Type: "replication", Name: "gold", Default: true, Config: map[string]string{"checksum_algorithm": "sha256"}},
+			1: {Index: 1, Type: "replication", Name: "silver", Config: map[string]string{}},
+		}), nil
+	}
+	ts, err := makeObjectServer(confLoader)
+	require.Nil(t, err)
+	defer ts.Close()
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte("SOME DATA")))
+
+	put := func(path, policy, requestChecksum string) *http.Response {
+		req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d%s", ts.host, ts.port, path), bytes.NewBuffer([]byte("SOME DATA")))
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Length", "9")
+		req.Header.Set("X-Timestamp", common.GetTimestamp())
+		req.Header.Set("X-Backend-Storage-Policy-Index", policy)
+		if requestChecksum != "" {
+			req.Header.Set("X-Object-Checksum-Sha256", requestChecksum)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		return resp
+	}
+
+	resp := put("/sda/0/a/c/o", "0", "")
+	require.Equal(t, 201, resp.StatusCode)
+	require.Equal(t, checksum, resp.Header.Get("X-Object-Checksum-Sha256"))
+	resp, err = ts.Do("GET", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, checksum, resp.Header.Get("X-Object-Checksum-Sha256"))
+	require.Equal(t, fmt.Sprintf("\"%x\"", md5.Sum([]byte("SOME DATA"))), resp.Header.Get("ETag"))
+
+	resp = put("/sda/0/a/c/o2", "0", strings.Repeat("0", 64))
+	require.Equal(t, 422, resp.StatusCode)
+
+	resp = put("/sda/0/a/c/o3", "1", "")
+	require.Equal(t, 201, resp.StatusCode)
+	require.Equal(t, "", resp.Header.Get("X-Object-Checksum-Sha256"))
+}
+
 func TestBasicPutDelete(t *testing.T) {
 	testRing := &test.FakeRing{}
 	confLoader := srv.NewTestConfigLoader(testRing)
@@ -327,6 +375,61 @@ func TestGetRanges(t *testing.T) {
 	assert.Equal(t, 2, strings.Count(string(body), "UVWXYZ"))
 }
 
+func TestConditionalGet(t *testing.T) {
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	ts, err := makeObjectServer(confLoader)
+	assert.Nil(t, err)
+	defer ts.Close()
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port),
+		bytes.NewBuffer([]byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", "26")
+	req.Header.Set("X-Timestamp", "1500000000.00000")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	get := func(headers map[string]string) *http.Response {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), nil)
+		assert.Nil(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp = get(nil)
+	assert.Equal(t, 200, resp.StatusCode)
+	lastModified := resp.Header.Get("Last-Modified")
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, "Fri, 14 Jul 2017 02:40:00 GMT", lastModified)
+	assert.Equal(t, "\"437bba8e0bf58337674f4539e75186ac\"", etag)
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+
+	resp = get(map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, 304, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	resp = get(map[string]string{"If-Modified-Since": "Fri, 14 Jul 2017 02:39:59 GMT"})
+	assert.Equal(t, 200, resp.StatusCode)
+	resp = get(map[string]string{"If-None-Match": "W/" + etag})
+	assert.Equal(t, 304, resp.StatusCode)
+	resp = get(map[string]string{"If-None-Match": "\"other\"", "If-Modified-Since": lastModified})
+	assert.Equal(t, 200, resp.StatusCode)
+	resp = get(map[string]string{"If-Match": "W/" + etag})
+	assert.Equal(t, 412, resp.StatusCode)
+	resp = get(map[string]string{"If-Unmodified-Since": lastModified})
+	assert.Equal(t, 200, resp.StatusCode)
+	resp = get(map[string]string{"If-Unmodified-Since": "Fri, 14 Jul 2017 02:39:59 GMT"})
+	assert.Equal(t, 412, resp.StatusCode)
+}
+
 func TestBadEtag(t *testing.T) {
 	testRing := &test.FakeRing{}
 	confLoader := srv.NewTestConfigLoader(testRing)
@@ -367,6 +470,60 @@ func TestCorrectEtag(t *testing.T) {
 	assert.Equal(t, etag, resp.Header.Get("Etag"))
 }
 
+func TestPutFooters(t *testing.T) {
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	ts, err := makeObjectServer(confLoader)
+	require.Nil(t, err)
+	defer ts.Close()
+
+	put := func(path string, footers map[string]string) *http.Response {
+		body := &bytes.Buffer{}
+		fw := common.NewFooterWriter(body)
+		fw.Write([]byte("SOME DATA"))
+		require.Nil(t, fw.Close(footers))
+		req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d%s", ts.host, ts.port, path), body)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("X-Timestamp", common.GetTimestamp())
+		req.Header.Set("X-Object-Meta-Foo", "header")
+		req.Header.Set(common.MetadataFooterHeader, "yes")
+		req.Header.Set(common.MimeBoundaryHeader, fw.Boundary())
+		req.Header.Set(common.ObjContentLengthHeader, "9")
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		return resp
+	}
+
+	resp := put("/sda/0/a/c/o", map[string]string{
+		"Etag":                         fmt.Sprintf("%x", md5.Sum([]byte("SOME DATA"))),
+		"X-Object-Meta-Foo":            "footer",
+		"X-Object-Sysmeta-Crypto-Etag": "sealed",
+	})
+	require.Equal(t, 201, resp.StatusCode)
+	resp, err = ts.Do("GET", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "SOME DATA", string(body))
+	require.Equal(t, "9", resp.Header.Get("Content-Length"))
+	require.Equal(t, "footer", resp.Header.Get("X-Object-Meta-Foo"))
+	require.Equal(t, "sealed", resp.Header.Get("X-Object-Sysmeta-Crypto-Etag"))
+
+	resp = put("/sda/0/a/c/o2", map[string]string{"Etag": "11111111111111111111111111111111"})
+	require.Equal(t, 422, resp.StatusCode)
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d/sda/0/a/c/o3", ts.host, ts.port), bytes.NewBuffer([]byte("SOME DATA")))
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Timestamp", common.GetTimestamp())
+	req.Header.Set(common.MetadataFooterHeader, "yes")
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 400, resp.StatusCode)
+}
+
 func TestUppercaseEtag(t *testing.T) {
 	testRing := &test.FakeRing{}
 	confLoader := srv.NewTestConfigLoader(testRing)
@@ -532,7 +689,8 @@ func TestBasicPutDeleteAt(t *testing.T) {
 	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), nil)
 	assert.Nil(t, err)
 	req.Header.Set("X-Timestamp", timestamp)
-	req.Header.Set("X-If-Delete-At", time_delete)
+	// Python Swift's expirer sends a normalized timestamp.
+	req.Header.Set("X-If-Delete-At", time_delete+".00000")
 	resp, err = http.DefaultClient.Do(req)
 	assert.Nil(t, err)
 	assert.Equal(t, 204, resp.StatusCode)
@@ -566,6 +724,39 @@ func TestBasicPutDeleteAt(t *testing.T) {
 	assert.Equal(t, 200, resp.StatusCode)
 }
 
+func TestGetOpenExpired(t *testing.T) {
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	ts, err := makeObjectServer(confLoader)
+	assert.Nil(t, err)
+	defer ts.Close()
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), bytes.NewBuffer([]byte("SOME DATA")))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", "9")
+	req.Header.Set("X-Timestamp", common.GetTimestamp())
+	req.Header.Set("X-Delete-At", strconv.FormatInt(time.Now().Unix()+1, 10))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+	time.Sleep(2 * time.Second)
+
+	resp, err = ts.Do("GET", "/sda/0/a/c/o", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req, err = http.NewRequest(method, fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), nil)
+		assert.Nil(t, err)
+		req.Header.Set("X-Backend-Open-Expired", "true")
+		resp, err = http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "9", resp.Header.Get("Content-Length"))
+	}
+}
+
 type slowReader struct {
 	readChan chan int
 	id       int
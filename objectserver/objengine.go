@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/conf"
 	"github.com/troubling/hummingbird/common/ring"
 	"github.com/troubling/hummingbird/common/srv"
@@ -30,7 +31,7 @@ import (
 )
 
 // DriveFullError can be returned by Object.SetData and Object.Delete if the disk is too full for the operation.
-var DriveFullError = errors.New("Drive Full")
+var DriveFullError error = &common.BackendError{StatusCode: http.StatusInsufficientStorage, Message: "Drive Full"}
 
 type Object interface {
 	// Exists determines whether or not there is an object to serve. Deleted objects do not exist, even if there is a tombstone.
@@ -59,6 +60,22 @@ type Object interface {
 	Repr() string
 }
 
+// ObjectPrefetcher is an Object that can be told which ranges of its data are
+// about to be read, so it can start reading them in.
+type ObjectPrefetcher interface {
+	Object
+	Prefetch(start, end int64)
+}
+
+// ObjectCreator is an Object that can be committed only if no object has been
+// stored in the meantime, for If-None-Match: * PUTs.
+type ObjectCreator interface {
+	Object
+	// CommitNew is Commit, but returns common.ErrPreconditionFailed
+	// instead if the object exists.
+	CommitNew(metadata map[string]string) error
+}
+
 type ObjectStabilizer interface {
 	Object
 	// Stabilize object- move to stable location / erasure code / do nothing / etc
@@ -79,6 +96,24 @@ type ReplicationDevice interface {
 	Type() string
 }
 
+// HandoffDrainer is a ReplicationDevice that can list its handoff partitions
+// and push one of them to its primaries outside of its regular scan, which
+// lets the handoff drainer work through them first.
+type HandoffDrainer interface {
+	ReplicationDevice
+	HandoffPartitions() ([]string, error)
+	DrainHandoff(partition string) (int64, error)
+}
+
+// FetchMetadataOnlyHeader on a HEAD asks for it to be answered from the
+// object's index row alone, without checking its data file is still on disk.
+// Engines without an index ignore it.
+const FetchMetadataOnlyHeader = "X-Backend-Fetch-Metadata-Only"
+
+// metadataOnlyVar is set in the vars passed to ObjectEngine.New when the
+// object is only needed for a FetchMetadataOnlyHeader HEAD.
+const metadataOnlyVar = "metadataOnly"
+
 // ObjectEngine is the type you have to give hummingbird to create a new object engine.
 type ObjectEngine interface {
 	// New creates a new instance of the Object, for interacting with a single object.
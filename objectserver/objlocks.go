@@ -0,0 +1,75 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"strconv"
+	"sync"
+)
+
+type objectLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// objectLocks hands out a mutex per object, so writes to the same object
+// queue up in the server instead of racing each other into the index, where
+// the loser either overwrites the winner's checks or spins on a busy
+// database.  Locks only exist while someone holds or waits on them.  The zero
+// value is ready to use.
+type objectLocks struct {
+	lock  sync.Mutex
+	locks map[string]*objectLock
+}
+
+// Lock blocks until the caller holds key's lock, and returns the function
+// that releases it, which may be called more than once.
+func (ol *objectLocks) Lock(key string) func() {
+	ol.lock.Lock()
+	if ol.locks == nil {
+		ol.locks = map[string]*objectLock{}
+	}
+	l := ol.locks[key]
+	if l == nil {
+		l = &objectLock{}
+		ol.locks[key] = l
+	}
+	l.waiters++
+	ol.lock.Unlock()
+	l.Lock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Unlock()
+			ol.lock.Lock()
+			if l.waiters--; l.waiters == 0 {
+				delete(ol.locks, key)
+			}
+			ol.lock.Unlock()
+		})
+	}
+}
+
+// Len returns how many objects are locked or waited on.
+func (ol *objectLocks) Len() int {
+	ol.lock.Lock()
+	defer ol.lock.Unlock()
+	return len(ol.locks)
+}
+
+func objectLockKey(vars map[string]string, policy int, hash string) string {
+	return vars["device"] + "/" + strconv.Itoa(policy) + "/" + hash
+}
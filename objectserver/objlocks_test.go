@@ -0,0 +1,71 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectLocksSerialize(t *testing.T) {
+	var ol objectLocks
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	holders, maxHolders := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := ol.Lock("sda/0/abc")
+			defer unlock()
+			lock.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			lock.Unlock()
+			time.Sleep(time.Millisecond)
+			lock.Lock()
+			holders--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 1, maxHolders)
+	require.Equal(t, 0, ol.Len())
+}
+
+func TestObjectLocksIndependentKeys(t *testing.T) {
+	var ol objectLocks
+	unlock := ol.Lock("sda/0/abc")
+	done := make(chan struct{})
+	go func() {
+		ol.Lock("sda/0/def")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock on another object blocked")
+	}
+	require.Equal(t, 1, ol.Len())
+	unlock()
+	unlock()
+	require.Equal(t, 0, ol.Len())
+}
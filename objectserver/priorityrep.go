@@ -82,6 +82,7 @@ func SendPriRepJob(job *PriorityRepJob, client common.HTTPClient, userAgent stri
 		return fmt.Sprintf("Failed to create request for some reason: %s", err), false
 	}
 	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(RequestClassHeader, requestClassReplication)
 	req.ContentLength = int64(len(jsonned))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := client.Do(req)
@@ -105,7 +106,7 @@ func SendPriRepJob(job *PriorityRepJob, client common.HTTPClient, userAgent stri
 			return fmt.Sprintf("could not  read body forpartition %d: %v",
 				job.Partition, err), false
 		}
-	} else if resp.StatusCode == 404 {
+	} else if resp.StatusCode == http.StatusNotFound {
 		return fmt.Sprintf("partition %d: not found on %s/%s",
 			job.Partition, job.FromDevice.Ip, job.FromDevice.Device), true
 	}
@@ -0,0 +1,140 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+// How an object PUT computes its checksums, set with put_hash_mode.  The
+// standard library's MD5 and SHA-256 are already written in assembly, using
+// the SHA extensions where the CPU has them, so "inline" hashes each chunk in
+// the request's goroutine between reads and writes.  "pipelined" hands the
+// chunks to a goroutine per hash instead, so the hashes run on other cores
+// alongside each other and the disk writes.
+const (
+	putHashInline    = "inline"
+	putHashPipelined = "pipelined"
+)
+
+// hashPipelineDepth is how many chunks a hash can fall behind the writes.
+const hashPipelineDepth = 8
+
+func putHashModeSetting(config conf.Config) (string, error) {
+	mode := strings.ToLower(config.GetDefault("app:object-server", "put_hash_mode", putHashInline))
+	if mode != putHashInline && mode != putHashPipelined {
+		return "", fmt.Errorf("Unknown put_hash_mode %q", mode)
+	}
+	return mode, nil
+}
+
+// setPutHashMode switches the hash mode for new PUTs, reporting whether it
+// changed.
+func (server *ObjectServer) setPutHashMode(mode string) bool {
+	var pipelined int32
+	if mode == putHashPipelined {
+		pipelined = 1
+	}
+	return atomic.SwapInt32(&server.putHashPipelined, pipelined) != pipelined
+}
+
+// putHasher returns a writer that feeds the hashes and a function that must
+// be called once the writes are done, before any of the sums are read.
+func (server *ObjectServer) putHasher(hashes ...hash.Hash) (io.Writer, func()) {
+	if atomic.LoadInt32(&server.putHashPipelined) == 0 {
+		writers := make([]io.Writer, len(hashes))
+		for i, h := range hashes {
+			writers[i] = h
+		}
+		return io.MultiWriter(writers...), func() {}
+	}
+	p := newHashPipeline(hashes...)
+	return p, p.Close
+}
+
+type hashChunk struct {
+	data []byte
+	refs int32
+}
+
+var hashChunkPool = sync.Pool{
+	New: func() interface{} {
+		return &hashChunk{data: make([]byte, 0, 64*1024)}
+	},
+}
+
+func (c *hashChunk) release() {
+	if atomic.AddInt32(&c.refs, -1) == 0 {
+		hashChunkPool.Put(c)
+	}
+}
+
+// hashPipeline is a writer that copies each write into a chunk shared by a
+// goroutine per hash.
+type hashPipeline struct {
+	chunks []chan *hashChunk
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func newHashPipeline(hashes ...hash.Hash) *hashPipeline {
+	p := &hashPipeline{}
+	for _, h := range hashes {
+		chunks := make(chan *hashChunk, hashPipelineDepth)
+		p.chunks = append(p.chunks, chunks)
+		p.wg.Add(1)
+		go func(h hash.Hash, chunks chan *hashChunk) {
+			defer p.wg.Done()
+			for c := range chunks {
+				h.Write(c.data)
+				c.release()
+			}
+		}(h, chunks)
+	}
+	return p
+}
+
+func (p *hashPipeline) Write(b []byte) (int, error) {
+	if len(p.chunks) == 0 {
+		return len(b), nil
+	}
+	c := hashChunkPool.Get().(*hashChunk)
+	c.data = append(c.data[:0], b...)
+	c.refs = int32(len(p.chunks))
+	for _, chunks := range p.chunks {
+		chunks <- c
+	}
+	return len(b), nil
+}
+
+// Close waits for the hashes to catch up.
+func (p *hashPipeline) Close() {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, chunks := range p.chunks {
+		close(chunks)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,70 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"go.uber.org/zap"
+)
+
+func TestPutHasher(t *testing.T) {
+	data := make([]byte, 1024*1024+17)
+	rand.Read(data)
+	wantMd5 := md5.Sum(data)
+	wantSha256 := sha256.Sum256(data)
+	server := &ObjectServer{}
+	for _, mode := range []string{putHashInline, putHashPipelined} {
+		server.setPutHashMode(mode)
+		md5Hash, sha256Hash := md5.New(), sha256.New()
+		w, done := server.putHasher(md5Hash, sha256Hash)
+		if mode == putHashPipelined {
+			require.IsType(t, &hashPipeline{}, w)
+		}
+		n, err := common.Copy(bytes.NewReader(data), w)
+		require.Nil(t, err)
+		require.Equal(t, int64(len(data)), n)
+		done()
+		done()
+		require.Equal(t, wantMd5[:], md5Hash.Sum(nil), mode)
+		require.Equal(t, wantSha256[:], sha256Hash.Sum(nil), mode)
+	}
+}
+
+func TestPutHashModeReload(t *testing.T) {
+	server := &ObjectServer{logLevel: zap.NewAtomicLevel()}
+	config, err := conf.StringConfig("[app:object-server]\nput_hash_mode = pipelined\n")
+	require.Nil(t, err)
+	changed, err := server.Reload(config)
+	require.Nil(t, err)
+	require.Equal(t, []string{"app:object-server/put_hash_mode"}, changed)
+	changed, err = server.Reload(config)
+	require.Nil(t, err)
+	require.Nil(t, changed)
+
+	config, err = conf.StringConfig("[app:object-server]\nput_hash_mode = simd\n")
+	require.Nil(t, err)
+	_, err = server.Reload(config)
+	require.NotNil(t, err)
+	require.Equal(t, int32(1), server.putHashPipelined)
+}
@@ -32,28 +32,38 @@ import (
 	"github.com/troubling/hummingbird/common/ring"
 )
 
-var RepUnmountedError = fmt.Errorf("Device unmounted")
+var RepUnmountedError = common.ErrDiskUnmounted
 var repDialer = (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).Dial
 
 const repConnBufferSize = 32768
 
+// repEncryptionHeader tells the replicator server that the connection can be
+// encrypted with the cluster's replication_psk once it's been hijacked.  The
+// server sends it back if it will be.
+const repEncryptionHeader = "X-Replication-Encryption"
+
 type BeginReplicationRequest struct {
 	Device     string
 	Partition  string
 	NeedHashes bool
+	Streaming  bool
 }
 
 type BeginReplicationResponse struct {
-	Hashes map[string]string
+	Hashes    map[string]string
+	Streaming bool
 }
 
 type SyncFileRequest struct {
-	Path   string
-	Xattrs string
-	Size   int64
-	Check  bool
-	Ping   bool
-	Done   bool
+	Path         string
+	Xattrs       string
+	Size         int64
+	Check        bool
+	Ping         bool
+	Done         bool
+	MissingCheck bool
+	Paths        []string
+	Streamed     bool
 }
 
 type SyncFileResponse struct {
@@ -61,6 +71,9 @@ type SyncFileResponse struct {
 	NewerExists bool
 	GoAhead     bool
 	Msg         string
+	Wanted      []string
+	Newer       []string
+	Saved       []string
 }
 
 type FileUploadResponse struct {
@@ -172,18 +185,22 @@ func (r *repConn) Close() {
 	r.c.Close()
 }
 
-func NewRepConn(dev *ring.Device, partition string, policy int, headers map[string]string, certFile, keyFile string, rcTimeout time.Duration) (RepConn, error) {
+func NewRepConn(dev *ring.Device, partition string, policy int, headers map[string]string, certFile, keyFile string, psk []byte, pskRequired bool, rcTimeout time.Duration) (RepConn, error) {
 	url := fmt.Sprintf("%s://%s:%d/%s/%s", dev.Scheme, dev.ReplicationIp, dev.ReplicationPort, dev.Device, partition)
 	req, err := http.NewRequest("REPCONN", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("X-Backend-Suppress-2xx-Logging", "t")
+	req.Header.Set(RequestClassHeader, requestClassReplication)
 	// left policy as an arg instead of a header to make it harder to forget to set it.
 	req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(policy))
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	if len(psk) > 0 {
+		req.Header.Set(repEncryptionHeader, "psk")
+	}
 	conn, err := repDialer("tcp", req.URL.Host)
 	if err != nil {
 		return nil, err
@@ -204,9 +221,23 @@ func NewRepConn(dev *ring.Device, partition string, policy int, headers map[stri
 	if resp.StatusCode/100 != 2 {
 		return nil, RepUnmountedError
 	}
-	newc, _ := hc.Hijack()
-	if newc, ok := newc.(*net.TCPConn); ok {
-		newc.SetNoDelay(true)
+	encrypted := len(psk) > 0 && resp.Header.Get(repEncryptionHeader) == "psk"
+	if pskRequired && !encrypted {
+		hc.Close()
+		return nil, errRepPSKRequired
+	}
+	newc, br := hc.Hijack()
+	if tcpc, ok := newc.(*net.TCPConn); ok {
+		tcpc.SetNoDelay(true)
+	}
+	if encrypted {
+		newc.SetDeadline(time.Now().Add(repPSKHandshakeTimeout))
+		pc, err := newPSKConn(newc, br, psk, true)
+		if err != nil {
+			newc.Close()
+			return nil, err
+		}
+		newc = pc
 	}
 	return &repConn{
 		rw: bufio.NewReadWriter(
@@ -115,6 +115,8 @@ type Replicator struct {
 	devices             map[string]bool
 	partitions          map[string]bool
 	quorumDelete        bool
+	streamingSync       bool
+	dryRun              bool
 	reclaimAge          int64
 	reserve             int64
 	incomingLimitPerDev int64
@@ -126,6 +128,7 @@ type Replicator struct {
 	clientTraceCloser   io.Closer
 	tracer              opentracing.Tracer
 	auditor             *AuditorDaemon
+	handoffDrain        *handoffDrainer
 
 	stats                   map[string]map[string]*DeviceStats
 	runningDevices          map[string]ReplicationDevice
@@ -146,6 +149,8 @@ type Replicator struct {
 	incomingSem             map[string]chan struct{}
 	asyncWG                 sync.WaitGroup // Used to wait on async goroutines
 	rcTimeout               time.Duration
+	replicationPSK          []byte
+	replicationPSKRequired  bool
 }
 
 func (server *Replicator) Type() string {
@@ -157,7 +162,7 @@ func (server *Replicator) Background(flags *flag.FlagSet) chan struct{} {
 	if f := flags.Lookup("once"); f != nil {
 		once = f.Value.(flag.Getter).Get() == true
 	}
-	if once {
+	if once || server.dryRun {
 		ch := make(chan struct{})
 		go func() {
 			defer close(ch)
@@ -166,6 +171,9 @@ func (server *Replicator) Background(flags *flag.FlagSet) chan struct{} {
 		return ch
 	}
 	go server.RunForever()
+	if server.handoffDrain != nil {
+		go server.handoffDrain.run()
+	}
 	if server.auditor != nil {
 		go server.auditor.RunForever()
 	}
@@ -446,6 +454,10 @@ func (r *Replicator) Run() {
 				r.logger.Error("building replication device", zap.String("device", dev.Device), zap.Int("policy", policy), zap.Error(err))
 				continue
 			}
+			if _, ok := rd.(*swiftDevice); r.dryRun && !ok {
+				r.logger.Info("Dry run not supported for policy, skipping device", zap.String("device", dev.Device), zap.Int("policy", policy))
+				continue
+			}
 			key := rd.Key()
 			r.runningDevices[key] = rd
 			r.stats[rd.Type()][key] = &DeviceStats{
@@ -457,6 +469,10 @@ func (r *Replicator) Run() {
 				rd.Scan()
 				r.onceDone <- struct{}{}
 			}(rd)
+			r.onceWaiting++
+			if r.dryRun {
+				continue
+			}
 
 			r.updatingDevices[key] = newUpdateDevice(dev, policy, r)
 			r.stats["object-updater"][key] = &DeviceStats{
@@ -468,8 +484,7 @@ func (r *Replicator) Run() {
 				ud.update()
 				r.onceDone <- struct{}{}
 			}(r.updatingDevices[key])
-
-			r.onceWaiting += 2
+			r.onceWaiting++
 		}
 	}
 	for r.onceWaiting > 0 {
@@ -505,6 +520,14 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 			return ipPort, nil, nil, fmt.Errorf("Error setting up http2: %v", err)
 		}
 	}
+	replicationPSK, err := ParseReplicationPSK(serverconf.GetDefault("object-replicator", "replication_psk", ""))
+	if err != nil {
+		return ipPort, nil, nil, err
+	}
+	replicationPSKRequired := serverconf.GetBool("object-replicator", "replication_psk_required", false)
+	if replicationPSKRequired && replicationPSK == nil {
+		return ipPort, nil, nil, fmt.Errorf("replication_psk_required needs a replication_psk")
+	}
 	httpClient := &http.Client{
 		Timeout:   time.Second * 60,
 		Transport: transport,
@@ -519,6 +542,8 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 		CertFile:            certFile,
 		KeyFile:             keyFile,
 		quorumDelete:        serverconf.GetBool("object-replicator", "quorum_delete", false),
+		streamingSync:       serverconf.GetBool("object-replicator", "streaming_sync", false),
+		dryRun:              serverconf.GetBool("object-replicator", "dry_run", false),
 		reclaimAge:          int64(serverconf.GetInt("object-replicator", "reclaim_age", int64(common.ONE_WEEK))),
 		incomingLimitPerDev: int64(serverconf.GetInt("object-replicator", "incoming_limit", 3)),
 
@@ -529,6 +554,8 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 		updateConcurrencySem:    make(chan struct{}, updaterConcurrency),
 		nurseryConcurrencySem:   make(chan struct{}, nurseryConcurrency),
 		rcTimeout:               time.Duration(serverconf.GetInt("object-replicator", "replication_timeout_sec", 0)) * time.Second,
+		replicationPSK:          replicationPSK,
+		replicationPSKRequired:  replicationPSKRequired,
 		updateStat:              make(chan statUpdate),
 		devices:                 make(map[string]bool),
 		partitions:              make(map[string]bool),
@@ -542,6 +569,10 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 		},
 	}
 	replicator.logLevel = logLevel
+	if drainConcurrency := int(serverconf.GetInt("object-replicator", "handoff_drain_concurrency", 0)); drainConcurrency > 0 {
+		replicator.handoffDrain = newHandoffDrainer(replicator, drainConcurrency,
+			time.Duration(serverconf.GetInt("object-replicator", "handoff_drain_interval", 60))*time.Second)
+	}
 
 	hashPathPrefix, hashPathSuffix, err := cnf.GetHashPrefixAndSuffix()
 	if err != nil {
@@ -604,6 +635,9 @@ func NewReplicator(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLo
 			replicator.quorumDelete = true
 		}
 	}
+	if dryRunFlag := flags.Lookup("dry-run"); dryRunFlag != nil && dryRunFlag.Value.(flag.Getter).Get() == true {
+		replicator.dryRun = true
+	}
 	if serverconf.HasSection("object-auditor") {
 		replicator.auditor, err = NewAuditorDaemon(serverconf, flags, cnf)
 	}
@@ -29,6 +29,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -175,8 +176,10 @@ type patchableReplicationDevice struct {
 	_beginReplication     func(dev *ring.Device, partition string, hashes bool, rChan chan beginReplicationResponse, headers map[string]string)
 	_listObjFiles         func(objChan chan string, cancel chan struct{}, partdir string, needSuffix func(string) bool)
 	_syncFile             func(objFile string, dst []*syncFileArg, handoff bool) (syncs int, insync int, err error)
+	_syncFilesStreamed    func(objFiles []string, dst []*syncFileArg) (syncs int, insync map[string]int, err error)
 	_replicateUsingHashes func(rjob replJob, moreNodes ring.MoreNodes)
 	_replicateAll         func(rjob replJob, isHandoff bool)
+	_estimatePartition    func(rjob replJob, isHandoff bool, useHashes bool) (*partitionDelta, error)
 	_cleanTemp            func()
 	_listPartitions       func() ([]string, []string, error)
 	_replicatePartition   func(partition string)
@@ -216,6 +219,12 @@ func (d *patchableReplicationDevice) syncFile(objFile string, dst []*syncFileArg
 	}
 	return d.swiftDevice.syncFile(objFile, dst, handoff)
 }
+func (d *patchableReplicationDevice) syncFilesStreamed(objFiles []string, dst []*syncFileArg) (syncs int, insync map[string]int, err error) {
+	if d._syncFilesStreamed != nil {
+		return d._syncFilesStreamed(objFiles, dst)
+	}
+	return d.swiftDevice.syncFilesStreamed(objFiles, dst)
+}
 func (d *patchableReplicationDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNodes) (int64, error) {
 	if d._replicateUsingHashes != nil {
 		d._replicateUsingHashes(rjob, moreNodes)
@@ -230,6 +239,12 @@ func (d *patchableReplicationDevice) replicateAll(rjob replJob, isHandoff bool)
 	}
 	return d.swiftDevice.replicateAll(rjob, isHandoff)
 }
+func (d *patchableReplicationDevice) estimatePartition(rjob replJob, isHandoff bool, useHashes bool) (*partitionDelta, error) {
+	if d._estimatePartition != nil {
+		return d._estimatePartition(rjob, isHandoff, useHashes)
+	}
+	return d.swiftDevice.estimatePartition(rjob, isHandoff, useHashes)
+}
 func (d *patchableReplicationDevice) cleanTemp() {
 	if d._cleanTemp != nil {
 		d._cleanTemp()
@@ -628,6 +643,70 @@ func TestSyncFileNewerExists(t *testing.T) {
 	require.Equal(t, 1, insync)
 }
 
+func TestSyncFilesStreamed(t *testing.T) {
+	deviceRoot, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(deviceRoot)
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	replicator, _, err := newTestReplicator(confLoader, "bind_port", "1234", "check_mounts", "no")
+	require.Nil(t, err)
+
+	var filenames []string
+	for _, hash := range []string{"00000000000000000000000000000aaa", "00000000000000000000000000000bbb"} {
+		filename := filepath.Join(deviceRoot, "objects", "1", "aaa", hash, "1472940619.68559.data")
+		require.Nil(t, os.MkdirAll(filepath.Dir(filename), 0777))
+		file, err := os.Create(filename)
+		require.Nil(t, err)
+		file.Write([]byte("SOME DATA"))
+		common.SwiftObjectWriteMetadata(file.Fd(), map[string]string{
+			"ETag":           "662411c1698ecc13dd07aee13439eadc",
+			"X-Timestamp":    "1472940619.68559",
+			"Content-Length": "9",
+			"Content-Type":   "text/plain",
+			"name":           "/a/c/o",
+		})
+		file.Close()
+		filenames = append(filenames, filename)
+	}
+	wantedPath := filepath.Join("sda", "objects", "1", "aaa", "00000000000000000000000000000bbb", "1472940619.68559.data")
+	var streamed []string
+	dataReceived := 0
+	rd := newPatchableReplicationDevice(testRing, replicator)
+	rc := &mockRepConn{
+		_SendMessage: func(v interface{}) error {
+			if sfr := v.(SyncFileRequest); sfr.Streamed {
+				streamed = append(streamed, sfr.Path)
+			}
+			return nil
+		},
+		_RecvMessage: func(v interface{}, sfrq *SyncFileRequest) error {
+			sfr := v.(*SyncFileResponse)
+			require.True(t, sfrq.MissingCheck)
+			if len(sfrq.Paths) > 0 {
+				require.Equal(t, 2, len(sfrq.Paths))
+				sfr.Wanted = []string{wantedPath}
+			} else {
+				sfr.Saved = []string{wantedPath}
+			}
+			return nil
+		},
+		_Write: func(data []byte) (l int, err error) {
+			dataReceived += len(data)
+			return len(data), nil
+		},
+	}
+	dsts := []*syncFileArg{
+		{conn: rc, dev: &ring.Device{Device: "sda"}},
+	}
+	syncs, insync, err := rd.syncFilesStreamed(filenames, dsts)
+	require.Nil(t, err)
+	require.Equal(t, 1, syncs)
+	require.Equal(t, map[string]int{filenames[0]: 1, filenames[1]: 1}, insync)
+	require.Equal(t, []string{wantedPath}, streamed)
+	require.Equal(t, 9, dataReceived)
+}
+
 func TestReplicateUsingHashes(t *testing.T) {
 	deviceRoot, err := ioutil.TempDir("", "")
 	require.Nil(t, err)
@@ -697,6 +776,81 @@ func TestReplicateAll(t *testing.T) {
 	require.False(t, fs.Exists(filename))
 }
 
+func TestEstimatePartition(t *testing.T) {
+	deviceRoot, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(deviceRoot)
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	replicator, _, err := newTestReplicator(confLoader, "bind_port", "1234", "check_mounts", "no", "devices", deviceRoot)
+	require.Nil(t, err)
+	partition := "1"
+	objPath := filepath.Join(deviceRoot, "objects")
+	missing := filepath.Join(objPath, partition, "aaa", "00000000000000000000000000000000", "1472940619.68559.data")
+	present := filepath.Join(objPath, partition, "aaa", "11111111111111111111111111111111", "1472940619.68559.data")
+	for _, filename := range []string{missing, present} {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filename), 0777))
+		require.Nil(t, ioutil.WriteFile(filename, []byte("SOME DATA"), 0666))
+	}
+	remoteDevs := []*ring.Device{{Id: 1, Device: "sda"}, {Id: 2, Device: "sdb"}}
+	var requests []SyncFileRequest
+	rd := newPatchableReplicationDevice(testRing, replicator)
+	rd._beginReplication = func(dev *ring.Device, partition string, hashes bool, rChan chan beginReplicationResponse, headers map[string]string) {
+		rChan <- beginReplicationResponse{dev: dev, conn: &mockRepConn{
+			_RecvMessage: func(v interface{}, sfrq *SyncFileRequest) error {
+				requests = append(requests, *sfrq)
+				if sfr, ok := v.(*SyncFileResponse); ok {
+					sfr.Exists = strings.Contains(sfrq.Path, "11111111111111111111111111111111") || sfrq.Path[:3] == "sda"
+				}
+				return nil
+			},
+		}}
+	}
+	rd._listObjFiles = func(objChan chan string, cancel chan struct{}, partdir string, needSuffix func(string) bool) {
+		objChan <- missing
+		objChan <- present
+		close(objChan)
+	}
+	delta, err := rd.estimatePartition(replJob{partition, remoteDevs, nil}, true, false)
+	require.Nil(t, err)
+	require.Equal(t, &partitionDelta{filesToSend: 1, bytesToSend: 9, filesToDelete: 2, bytesToDelete: 18}, delta)
+	for _, sfr := range requests {
+		require.True(t, sfr.Check)
+	}
+	require.True(t, fs.Exists(missing))
+	require.True(t, fs.Exists(present))
+
+	// a primary's files aren't deleted for being in sync
+	delta, err = rd.estimatePartition(replJob{partition, remoteDevs, nil}, false, false)
+	require.Nil(t, err)
+	require.Equal(t, &partitionDelta{filesToSend: 1, bytesToSend: 9}, delta)
+}
+
+func TestReplicatePartitionDryRun(t *testing.T) {
+	testRing := &test.FakeRing{MockGetMoreNodes: &NoMoreNodes{}, MockGetJobNodesHandoff: true}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	replicator, _, err := newTestReplicator(confLoader, "bind_port", "1234", "check_mounts", "no", "dry_run", "true")
+	require.Nil(t, err)
+	rd := newPatchableReplicationDevice(testRing, replicator)
+	rd._replicateAll = func(rjob replJob, isHandoff bool) {
+		t.Fatal("replicateAll called in a dry run")
+	}
+	rd._estimatePartition = func(rjob replJob, isHandoff bool, useHashes bool) (*partitionDelta, error) {
+		require.True(t, isHandoff)
+		require.False(t, useHashes)
+		return &partitionDelta{filesToSend: 3, bytesToSend: 300, filesToDelete: 3, bytesToDelete: 300}, nil
+	}
+	rd.replicatePartition("1")
+	stats := map[string]int64{}
+	for len(replicator.updateStat) > 0 {
+		update := <-replicator.updateStat
+		stats[update.stat] += update.value
+	}
+	require.Equal(t, int64(3), stats["DryRunFilesToSend"])
+	require.Equal(t, int64(300), stats["DryRunBytesToDelete"])
+	require.Equal(t, int64(1), stats["PartitionsDone"])
+}
+
 func TestCleanTemp(t *testing.T) {
 	deviceRoot, err := ioutil.TempDir("", "")
 	require.Nil(t, err)
@@ -1232,6 +1386,63 @@ func TestReplicationHandoff(t *testing.T) {
 	require.Equal(t, 404, resp.StatusCode)
 }
 
+func TestReplicationHandoffStreaming(t *testing.T) {
+	testRing := &test.FakeRing{}
+	confLoader := srv.NewTestConfigLoader(testRing)
+	ts, err := makeObjectServer(confLoader)
+	assert.Nil(t, err)
+	defer ts.Close()
+
+	ts2, err := makeObjectServer(confLoader)
+	assert.Nil(t, err)
+	defer ts2.Close()
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port),
+		bytes.NewBuffer([]byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", "26")
+	req.Header.Set("X-Timestamp", common.GetTimestamp())
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 201, resp.StatusCode)
+
+	req, err = http.NewRequest("HEAD", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), nil)
+	assert.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	trs1, err := makeReplicatorWebServer(confLoader, "streaming_sync", "true")
+	require.Nil(t, err)
+	defer trs1.Close()
+	trs1.replicator.deviceRoot = ts.objServer.driveRoot
+	trs2, err := makeReplicatorWebServer(confLoader, "streaming_sync", "true")
+	require.Nil(t, err)
+	defer trs2.Close()
+	trs2.replicator.deviceRoot = ts2.objServer.driveRoot
+
+	ldev := &ring.Device{ReplicationIp: trs1.host, ReplicationPort: trs1.port, Device: "sda", Scheme: "http"}
+	rdev := &ring.Device{ReplicationIp: trs2.host, ReplicationPort: trs2.port, Device: "sda", Scheme: "http"}
+	testRing.MockLocalDevices = []*ring.Device{ldev}
+	testRing.MockGetJobNodes = []*ring.Device{rdev}
+	testRing.MockGetJobNodesHandoff = true
+
+	trs1.replicator.Run()
+
+	req, err = http.NewRequest("HEAD", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts2.host, ts2.port), nil)
+	assert.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	req, err = http.NewRequest("HEAD", fmt.Sprintf("http://%s:%d/sda/0/a/c/o", ts.host, ts.port), nil)
+	assert.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 404, resp.StatusCode)
+}
+
 func TestReplicationHandoffQuorumDelete(t *testing.T) {
 	testRing := &test.FakeRing{}
 	confLoader := srv.NewTestConfigLoader(testRing)
@@ -57,8 +57,8 @@ func (ro *repObject) Exists() bool {
 }
 
 func (ro *repObject) Copy(dsts ...io.Writer) (written int64, err error) {
-	var f *os.File
-	f, err = os.Open(ro.Path)
+	var f itemReader
+	f, err = openItem(&ro.IndexDBItem)
 	if err != nil {
 		return 0, err
 	}
@@ -78,7 +78,7 @@ func (ro *repObject) Copy(dsts ...io.Writer) (written int64, err error) {
 }
 
 func (ro *repObject) CopyRange(w io.Writer, start int64, end int64) (int64, error) {
-	f, err := os.Open(ro.Path)
+	f, err := openItem(&ro.IndexDBItem)
 	if err != nil {
 		return 0, err
 	}
@@ -127,7 +127,11 @@ func (ro *repObject) commit(metadata map[string]string, method string, nursery b
 		return err
 	}
 	timestamp = timestampTime.UnixNano()
-	err = ro.idb.Commit(ro.atomicFileWriter, ro.Hash, roShard, timestamp, method, metadata, nursery, "")
+	if method == "CREATE" {
+		err = ro.idb.CommitNew(ro.atomicFileWriter, ro.Hash, roShard, timestamp, metadata, nursery, "")
+	} else {
+		err = ro.idb.Commit(ro.atomicFileWriter, ro.Hash, roShard, timestamp, method, metadata, nursery, "")
+	}
 	ro.atomicFileWriter = nil
 	return err
 }
@@ -136,6 +140,10 @@ func (ro *repObject) Commit(metadata map[string]string) error {
 	return ro.commit(metadata, "PUT", true)
 }
 
+func (ro *repObject) CommitNew(metadata map[string]string) error {
+	return ro.commit(metadata, "CREATE", true)
+}
+
 func (ro *repObject) Delete(metadata map[string]string) error {
 	return ro.commit(metadata, "DELETE", true)
 }
@@ -213,7 +221,7 @@ func (ro *repObject) stabilizeDelete(dev *ring.Device) error {
 			if resp, err := ro.client.Do(req); err == nil {
 				io.Copy(ioutil.Discard, resp.Body)
 				resp.Body.Close()
-				if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusConflict || resp.StatusCode == 404 {
+				if err := common.StatusError(resp.StatusCode); err == nil || common.IsConflict(err) || common.IsNotFound(err) {
 					atomic.AddInt64(&successes, 1)
 				}
 			}
@@ -255,7 +263,7 @@ func (ro *repObject) restabilize(dev *ring.Device) error {
 			if resp, err := ro.client.Do(req); err == nil {
 				io.Copy(ioutil.Discard, resp.Body)
 				resp.Body.Close()
-				if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusConflict {
+				if err := common.StatusError(resp.StatusCode); err == nil || common.IsConflict(err) {
 					atomic.AddInt64(&successes, 1)
 				}
 			}
@@ -312,7 +320,7 @@ func (ro *repObject) Stabilize(dev *ring.Device) error {
 
 func (ro *repObject) Replicate(prirep PriorityRepJob) error {
 	_, isHandoff := ro.ring.GetJobNodes(prirep.Partition, prirep.FromDevice.Id)
-	fp, err := os.Open(ro.Path)
+	fp, err := openItem(&ro.IndexDBItem)
 	if err != nil {
 		return err
 	}
@@ -336,7 +344,7 @@ func (ro *repObject) Replicate(prirep PriorityRepJob) error {
 		return fmt.Errorf("error syncing obj %s: %v", ro.Hash, err)
 	}
 	defer resp.Body.Close()
-	if !(resp.StatusCode/100 == 2 || resp.StatusCode == 409) {
+	if err := common.StatusError(resp.StatusCode); err != nil && !common.IsConflict(err) {
 		return fmt.Errorf("bad status code %d syncing obj with  %s", resp.StatusCode, ro.Hash)
 	}
 	if isHandoff {
@@ -341,3 +341,10 @@ func TestReplicateCanStabilizeFail(t *testing.T) {
 	require.NotNil(t, err)
 	require.Equal(t, int64(2), calls)
 }
+
+func TestRepObjectLargeContentLength(t *testing.T) {
+	ro := &repObject{metadata: map[string]string{"Content-Length": "21474836480"}}
+	require.Equal(t, int64(20*1024*1024*1024), ro.ContentLength())
+	eo := &ecObject{metadata: map[string]string{"Content-Length": "21474836480"}}
+	require.Equal(t, int64(20*1024*1024*1024), eo.ContentLength())
+}
@@ -8,7 +8,6 @@ import (
 	"math/bits"
 	"net"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -54,6 +53,18 @@ func repEngineConstructor(config conf.Config, policy *conf.Policy, flags *flag.F
 	if err != nil {
 		return nil, err
 	}
+	dbBackend, err := policy.GetDbBackend()
+	if err != nil {
+		return nil, err
+	}
+	inlineMaxSize, err := policy.GetInlineMaxSize()
+	if err != nil {
+		return nil, err
+	}
+	sp, err := newSyncPolicies(config, policy)
+	if err != nil {
+		return nil, err
+	}
 	logLevelString := config.GetDefault("app:object-server", "log_level", "INFO")
 	logLevel := zap.NewAtomicLevel()
 	logLevel.UnmarshalText([]byte(strings.ToLower(logLevelString)))
@@ -90,6 +101,10 @@ func repEngineConstructor(config conf.Config, policy *conf.Policy, flags *flag.F
 		idbs:           map[string]*IndexDB{},
 		dbPartPower:    int(dbPartPower),
 		numSubDirs:     subdirs,
+		dbBackend:      dbBackend,
+		inlineMaxSize:  inlineMaxSize,
+		syncPolicies:   sp,
+		reclaimAge:     time.Duration(config.GetInt("app:object-server", "reclaim_age", int64(common.ONE_WEEK))) * time.Second,
 		client: &http.Client{
 			Timeout:   120 * time.Minute,
 			Transport: transport,
@@ -115,7 +130,12 @@ type repEngine struct {
 	dblock         sync.Mutex
 	dbPartPower    int
 	numSubDirs     int
+	dbBackend      string
+	inlineMaxSize  int64
+	syncPolicies   *syncPolicies
+	reclaimAge     time.Duration
 	client         *http.Client
+	metricsScope   tally.Scope
 }
 
 func (re *repEngine) getDB(device string) (*IndexDB, error) {
@@ -129,10 +149,17 @@ func (re *repEngine) getDB(device string) (*IndexDB, error) {
 	path := filepath.Join(re.driveRoot, device, PolicyDir(re.policy), "repng")
 	temppath := filepath.Join(re.driveRoot, device, "tmp")
 	ringPartPower := bits.Len64(re.ring.PartitionCount() - 1)
-	re.idbs[device], err = NewIndexDB(dbpath, path, temppath, ringPartPower, re.dbPartPower, re.numSubDirs, re.reserve, re.logger, repAuditor{})
+	re.idbs[device], err = NewIndexDBWithBackend(re.dbBackend, dbpath, path, temppath, ringPartPower, re.dbPartPower, re.numSubDirs, re.reserve, re.logger, repAuditor{})
 	if err != nil {
 		return nil, err
 	}
+	re.idbs[device].SetInlineMaxSize(re.inlineMaxSize)
+	if re.syncPolicies.configured(device) {
+		re.idbs[device].SetSyncPolicy(re.syncPolicies.forDevice(device))
+	}
+	if re.metricsScope != nil {
+		re.idbs[device].SetMetrics(re.metricsScope, fmt.Sprintf("%d_%s_", re.policy, device))
+	}
 	return re.idbs[device], nil
 }
 
@@ -158,16 +185,17 @@ func (re *repEngine) New(vars map[string]string, needData bool, asyncWG *sync.Wa
 			if err = json.Unmarshal(item.Metabytes, &obj.metadata); err != nil {
 				return nil, fmt.Errorf("Error parsing metadata: %v", err)
 			}
-			if !item.Deletion {
-				if fi, err := os.Stat(item.Path); err != nil {
+			// A metadata only HEAD trusts the index row, saving the stat.
+			if !item.Deletion && vars[metadataOnlyVar] != "true" {
+				if size, err := itemSize(item); err != nil {
 					obj.Quarantine()
 					return nil, err
 				} else if contentLength, err := strconv.ParseInt(obj.metadata["Content-Length"], 10, 64); err != nil {
 					obj.Quarantine()
 					return nil, fmt.Errorf("Unable to parse content-length: %s %s", obj.metadata["Content-Length"], err)
-				} else if fi.Size() != contentLength {
+				} else if size != contentLength {
 					obj.Quarantine()
-					return nil, fmt.Errorf("File size doesn't match content-length: %d vs %d", fi.Size(), contentLength)
+					return nil, fmt.Errorf("File size doesn't match content-length: %d vs %d", size, contentLength)
 				}
 			}
 		} else if err != nil {
@@ -279,6 +307,11 @@ func (re *repEngine) getObjectsToStabilize(device *ring.Device, c chan ObjectSta
 		return
 	}
 	idb.ExpireObjects()
+	if n, err := idb.ReclaimTombstones(re.reclaimAge); err != nil {
+		re.logger.Error("ReclaimTombstones error", zap.Error(err))
+	} else if n > 0 {
+		re.logger.Debug("reclaimed tombstones", zap.String("device", device.Device), zap.Int64("count", n))
+	}
 
 	idbItems, err := idb.ListObjectsToStabilize()
 	if err != nil {
@@ -403,6 +436,7 @@ func (re *repEngine) deleteStableObject(writer http.ResponseWriter, request *htt
 }
 
 func (re *repEngine) RegisterHandlers(addRoute func(method, path string, handler http.HandlerFunc), metScope tally.Scope) {
+	re.metricsScope = metScope
 	addRoute("GET", "/rep-partition/:device/:partition", re.listPartitionHandler)
 	addRoute("PUT", "/rep-obj/:device/:hash", re.putStableObject)
 	addRoute("POST", "/rep-obj/:device/:hash", re.postStableObject)
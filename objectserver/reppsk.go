@@ -0,0 +1,193 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// repPSKNonceSize is the size of the random value each side contributes
+	// to a connection's keys.
+	repPSKNonceSize = 32
+	// repPSKMaxFrame is the largest plaintext sealed into one frame.
+	repPSKMaxFrame = repConnBufferSize
+	// repPSKMinKeyLength is the shortest replication_psk we'll accept.
+	repPSKMinKeyLength = 16
+	// repPSKHandshakeTimeout bounds the nonce exchange.
+	repPSKHandshakeTimeout = 30 * time.Second
+)
+
+var (
+	errRepPSKFrame    = errors.New("Invalid replication frame")
+	errRepPSKRequired = errors.New("Replication server won't encrypt the connection")
+)
+
+// ParseReplicationPSK turns the replication_psk config value into the key
+// used for replication connections.  An empty value means no key, and
+// replication traffic stays plaintext.
+//
+// The key only covers the REPCONN connections the swift engine replicates
+// over.  Policies using the repng and hec engines replicate with ordinary
+// requests to the object servers, which need cert_file and key_file for TLS
+// to keep their data off the network in plaintext.
+//
+// Until every server has the key, connections between a server with it and
+// one without stay plaintext.  Once they all do, replication_psk_required
+// makes both sides refuse plaintext connections.
+func ParseReplicationPSK(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if len(value) < repPSKMinKeyLength {
+		return nil, fmt.Errorf("replication_psk must be at least %d characters", repPSKMinKeyLength)
+	}
+	key := sha256.Sum256([]byte(value))
+	return key[:], nil
+}
+
+// pskConn encrypts and authenticates a replication connection with a key
+// shared by the whole cluster, for networks where the replicators don't have
+// certificates.  Each side sends a random nonce, and the keys for each
+// direction are derived from the shared key and both nonces, so no two
+// connections share keys.  Everything after that is sealed with AES-GCM in
+// length-prefixed frames, numbered by a per-direction counter that prevents
+// frames from being replayed or reordered.  A peer with a different key fails
+// on the first frame it reads.
+type pskConn struct {
+	net.Conn
+	r           io.Reader
+	sealer      cipher.AEAD
+	opener      cipher.AEAD
+	sealCounter uint64
+	openCounter uint64
+	readBuf     []byte
+}
+
+// newPSKConn runs the key exchange over c, reading through r, which lets
+// the incoming side keep whatever its hijacked reader has already buffered.
+// The side that dialed the connection passes client as true.
+func newPSKConn(c net.Conn, r io.Reader, psk []byte, client bool) (*pskConn, error) {
+	local := make([]byte, repPSKNonceSize)
+	if _, err := rand.Read(local); err != nil {
+		return nil, err
+	}
+	remote := make([]byte, repPSKNonceSize)
+	if client {
+		if _, err := c.Write(local); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, remote); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := io.ReadFull(r, remote); err != nil {
+			return nil, err
+		}
+		if _, err := c.Write(local); err != nil {
+			return nil, err
+		}
+	}
+	clientNonce, serverNonce := local, remote
+	if !client {
+		clientNonce, serverNonce = remote, local
+	}
+	toServer, err := repPSKCipher(psk, "client", clientNonce, serverNonce)
+	if err != nil {
+		return nil, err
+	}
+	toClient, err := repPSKCipher(psk, "server", clientNonce, serverNonce)
+	if err != nil {
+		return nil, err
+	}
+	if client {
+		return &pskConn{Conn: c, r: r, sealer: toServer, opener: toClient}, nil
+	}
+	return &pskConn{Conn: c, r: r, sealer: toClient, opener: toServer}, nil
+}
+
+func repPSKCipher(psk []byte, label string, clientNonce, serverNonce []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, psk)
+	mac.Write([]byte(label))
+	mac.Write(clientNonce)
+	mac.Write(serverNonce)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *pskConn) nonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+func (p *pskConn) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > repPSKMaxFrame {
+			chunk = chunk[:repPSKMaxFrame]
+		}
+		frame := make([]byte, 4, 4+len(chunk)+p.sealer.Overhead())
+		frame = p.sealer.Seal(frame, p.nonce(p.sealer, p.sealCounter), chunk, nil)
+		p.sealCounter++
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+		if _, err := p.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		data = data[len(chunk):]
+	}
+	return written, nil
+}
+
+func (p *pskConn) Read(data []byte) (int, error) {
+	for len(p.readBuf) == 0 {
+		var length uint32
+		if err := binary.Read(p.r, binary.BigEndian, &length); err != nil {
+			return 0, err
+		}
+		if length < uint32(p.opener.Overhead()) || length > uint32(repPSKMaxFrame+p.opener.Overhead()) {
+			return 0, errRepPSKFrame
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(p.r, frame); err != nil {
+			return 0, err
+		}
+		plain, err := p.opener.Open(frame[:0], p.nonce(p.opener, p.openCounter), frame, nil)
+		if err != nil {
+			return 0, errRepPSKFrame
+		}
+		p.openCounter++
+		p.readBuf = plain
+	}
+	n := copy(data, p.readBuf)
+	p.readBuf = p.readBuf[n:]
+	return n, nil
+}
@@ -0,0 +1,164 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+)
+
+func pskConnPair(t *testing.T, clientKey, serverKey []byte) (*pskConn, *pskConn) {
+	c1, c2 := net.Pipe()
+	type result struct {
+		pc  *pskConn
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		pc, err := newPSKConn(c2, c2, serverKey, false)
+		done <- result{pc, err}
+	}()
+	client, err := newPSKConn(c1, c1, clientKey, true)
+	require.Nil(t, err)
+	res := <-done
+	require.Nil(t, res.err)
+	return client, res.pc
+}
+
+func TestParseReplicationPSK(t *testing.T) {
+	key, err := ParseReplicationPSK("")
+	require.Nil(t, err)
+	require.Nil(t, key)
+	_, err = ParseReplicationPSK("short")
+	require.NotNil(t, err)
+	key, err = ParseReplicationPSK("a cluster secret long enough")
+	require.Nil(t, err)
+	require.Equal(t, 32, len(key))
+}
+
+func TestPSKConn(t *testing.T) {
+	key, _ := ParseReplicationPSK("a cluster secret long enough")
+	client, server := pskConnPair(t, key, key)
+	defer client.Close()
+	defer server.Close()
+	data := bytes.Repeat([]byte("0123456789"), repPSKMaxFrame/4)
+	go func() {
+		w := bufio.NewWriterSize(client, repConnBufferSize)
+		w.Write(data)
+		w.Flush()
+	}()
+	got := make([]byte, len(data))
+	_, err := io.ReadFull(server, got)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	go server.Write([]byte("reply"))
+	got = make([]byte, 5)
+	_, err = io.ReadFull(client, got)
+	require.Nil(t, err)
+	require.Equal(t, "reply", string(got))
+}
+
+func TestPSKConnWrongKey(t *testing.T) {
+	key, _ := ParseReplicationPSK("a cluster secret long enough")
+	other, _ := ParseReplicationPSK("some other cluster's secret")
+	client, server := pskConnPair(t, key, other)
+	defer client.Close()
+	defer server.Close()
+	go client.Write([]byte("object data"))
+	_, err := server.Read(make([]byte, 11))
+	require.Equal(t, errRepPSKFrame, err)
+}
+
+func TestPSKConnTampered(t *testing.T) {
+	key, _ := ParseReplicationPSK("a cluster secret long enough")
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	done := make(chan *pskConn)
+	go func() {
+		pc, _ := newPSKConn(c2, c2, key, false)
+		done <- pc
+	}()
+	client, err := newPSKConn(c1, c1, key, true)
+	require.Nil(t, err)
+	server := <-done
+	go func() {
+		frame := make([]byte, 4, 4+11+client.sealer.Overhead())
+		frame = client.sealer.Seal(frame, client.nonce(client.sealer, client.sealCounter), []byte("object data"), nil)
+		frame[len(frame)-1] ^= 1
+		frame[3] = byte(len(frame) - 4)
+		c1.Write(frame)
+	}()
+	_, err = server.Read(make([]byte, 11))
+	require.Equal(t, errRepPSKFrame, err)
+}
+
+func TestRepConnPSKModes(t *testing.T) {
+	key, _ := ParseReplicationPSK("a cluster secret long enough")
+	connect := func(serverKey []byte, serverRequired bool, clientKey []byte, clientRequired bool) (RepConn, error) {
+		r := &Replicator{replicationPSK: serverKey, replicationPSKRequired: serverRequired}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.objRepConnHandler(w, srv.SetLogger(req, zap.NewNop()))
+		}))
+		defer ts.Close()
+		u, _ := url.Parse(ts.URL)
+		host, ports, _ := net.SplitHostPort(u.Host)
+		port, _ := strconv.Atoi(ports)
+		dev := &ring.Device{Scheme: "http", ReplicationIp: host, ReplicationPort: port, Device: "sda"}
+		return NewRepConn(dev, "1", 0, nil, "", "", clientKey, clientRequired, time.Minute)
+	}
+	encrypted := func(rc RepConn) bool {
+		defer rc.Close()
+		_, ok := rc.(*repConn).c.(*pskConn)
+		return ok
+	}
+
+	rc, err := connect(key, false, key, false)
+	require.Nil(t, err)
+	require.True(t, encrypted(rc))
+	rc, err = connect(key, true, key, true)
+	require.Nil(t, err)
+	require.True(t, encrypted(rc))
+
+	// while the key's being rolled out, servers with and without it still
+	// replicate to each other in plaintext
+	rc, err = connect(nil, false, key, false)
+	require.Nil(t, err)
+	require.False(t, encrypted(rc))
+	rc, err = connect(key, false, nil, false)
+	require.Nil(t, err)
+	require.False(t, encrypted(rc))
+
+	// once it's required, neither side will
+	_, err = connect(nil, false, key, true)
+	require.Equal(t, errRepPSKRequired, err)
+	_, err = connect(key, true, nil, false)
+	require.Equal(t, RepUnmountedError, err)
+}
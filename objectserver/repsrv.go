@@ -19,6 +19,7 @@ import (
 	"bufio"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -97,6 +98,10 @@ func (r *Replicator) priorityRepHandler(w http.ResponseWriter, req *http.Request
 			return
 		}
 	}
+	if deviceBreakerTripped(r.reconCachePath, pri.FromDevice.Device) {
+		w.WriteHeader(507)
+		return
+	}
 	r.runningDevicesLock.Lock()
 	rd, ok := r.runningDevices[deviceKeyId(pri.FromDevice.Device, pri.Policy)]
 	r.runningDevicesLock.Unlock()
@@ -187,6 +192,16 @@ func (r *Replicator) objReplicateHandler(writer http.ResponseWriter, request *ht
 	writer.Write(pickle.PickleDumps(hashes))
 }
 
+// syncFileState reports whether fileName already exists, or whether a newer
+// data or meta file makes it obsolete.
+func syncFileState(fileName string) (exists bool, newer bool) {
+	if fs.Exists(fileName) {
+		return true, false
+	}
+	dataFile, metaFile := ObjectFiles(filepath.Dir(fileName))
+	return false, filepath.Base(fileName) < filepath.Base(dataFile) || filepath.Base(fileName) < filepath.Base(metaFile)
+}
+
 func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http.Request) {
 	var conn net.Conn
 	var rw *bufio.ReadWriter
@@ -201,6 +216,16 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 		policy = 0
 	}
 
+	encrypted := len(r.replicationPSK) > 0 && request.Header.Get(repEncryptionHeader) == "psk"
+	if r.replicationPSKRequired && !encrypted {
+		srv.GetLogger(request).Error("[ObjRepConnHandler] Refusing unencrypted replication connection")
+		srv.StandardResponse(writer, http.StatusForbidden)
+		return
+	}
+	if encrypted {
+		writer.Header().Set(repEncryptionHeader, "psk")
+	}
+
 	writer.WriteHeader(http.StatusOK)
 	if hijacker, ok := writer.(http.Hijacker); !ok {
 		srv.GetLogger(request).Error("[ObjRepConnHandler] Writer not a Hijacker")
@@ -213,6 +238,17 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 	}
 	defer conn.Close()
 
+	if encrypted {
+		rw.Flush()
+		conn.SetDeadline(time.Now().Add(repPSKHandshakeTimeout))
+		pc, err := newPSKConn(conn, rw, r.replicationPSK, false)
+		if err != nil {
+			srv.GetLogger(request).Error("[ObjRepConnHandler] Replication key exchange failed", zap.Error(err))
+			return
+		}
+		conn = pc
+		rw = bufio.NewReadWriter(bufio.NewReaderSize(pc, repConnBufferSize), bufio.NewWriterSize(pc, repConnBufferSize))
+	}
 	rc := NewIncomingRepConn(rw, conn, r.rcTimeout)
 	if err := rc.RecvMessage(&brr); err != nil {
 		srv.GetLogger(request).Error("[ObjRepConnHandler] Error receiving BeginReplicationRequest", zap.Error(err))
@@ -236,13 +272,15 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 			return
 		}
 	}
-	if err := rc.SendMessage(BeginReplicationResponse{Hashes: hashes}); err != nil {
+	if err := rc.SendMessage(BeginReplicationResponse{Hashes: hashes, Streaming: brr.Streaming}); err != nil {
 		srv.GetLogger(request).Error("[ObjRepConnHandler] Error sending BeginReplicationResponse", zap.Duration("connectionTime", time.Since(startTime)), zap.Error(err))
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	sfrsProcessed := int64(0)
 	startTime = time.Now()
+	// saved lists the streamed files written since the last missing check.
+	var saved []string
 	for {
 		errType, err := func() (string, error) { // this is a closure so we can use defers inside
 			var sfr SyncFileRequest
@@ -256,23 +294,44 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 			if sfr.Ping {
 				return "ping", rc.SendMessage(SyncFileResponse{Msg: "pong"})
 			}
+			if sfr.MissingCheck {
+				resp := SyncFileResponse{Msg: "missing check", Saved: saved}
+				saved = nil
+				for _, path := range sfr.Paths {
+					switch exists, newer := syncFileState(filepath.Join(r.deviceRoot, path)); {
+					case newer:
+						resp.Newer = append(resp.Newer, path)
+					case !exists:
+						resp.Wanted = append(resp.Wanted, path)
+					}
+				}
+				return "missing check", rc.SendMessage(resp)
+			}
+			// Streamed files are sent without waiting for a go ahead, so any
+			// we aren't going to keep still have to be read off the connection.
+			skip := func(errType string, resp SyncFileResponse) (string, error) {
+				if sfr.Streamed {
+					_, err := io.CopyN(ioutil.Discard, rc, sfr.Size)
+					return errType, err
+				}
+				return errType, rc.SendMessage(resp)
+			}
 			tempDir := TempDirPath(r.deviceRoot, vars["device"])
 			fileName := filepath.Join(r.deviceRoot, sfr.Path)
 			hashDir := filepath.Dir(fileName)
 
 			if ext := filepath.Ext(fileName); (ext != ".data" && ext != ".ts" && ext != ".meta") || len(filepath.Base(filepath.Dir(fileName))) != 32 {
-				return "invalid file path", rc.SendMessage(SyncFileResponse{Msg: "bad file path"})
+				return skip("invalid file path", SyncFileResponse{Msg: "bad file path"})
 			}
-			if fs.Exists(fileName) {
-				return "file exists", rc.SendMessage(SyncFileResponse{Exists: true, Msg: "exists"})
-			}
-			dataFile, metaFile := ObjectFiles(hashDir)
-			if filepath.Base(fileName) < filepath.Base(dataFile) || filepath.Base(fileName) < filepath.Base(metaFile) {
-				return "newer file exists", rc.SendMessage(SyncFileResponse{NewerExists: true, Msg: "newer exists"})
+			if exists, newer := syncFileState(fileName); exists {
+				return skip("file exists", SyncFileResponse{Exists: true, Msg: "exists"})
+			} else if newer {
+				return skip("newer file exists", SyncFileResponse{NewerExists: true, Msg: "newer exists"})
 			}
 			if sfr.Check {
 				return "just check", rc.SendMessage(SyncFileResponse{Exists: false, Msg: "doesn't exist"})
 			}
+			dataFile, metaFile := ObjectFiles(hashDir)
 			tempFile, err := fs.NewAtomicFileWriter(tempDir, hashDir)
 			if err != nil {
 				return "creating file writer", err
@@ -282,12 +341,14 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 				return "preallocating space", err
 			}
 			if xattrs, err := hex.DecodeString(sfr.Xattrs); err != nil || len(xattrs) == 0 {
-				return "parsing xattrs", rc.SendMessage(SyncFileResponse{Msg: "bad xattrs"})
+				return skip("parsing xattrs", SyncFileResponse{Msg: "bad xattrs"})
 			} else if err := common.SwiftObjectRawWriteMetadata(tempFile.Fd(), xattrs); err != nil {
 				return "writing metadata", err
 			}
-			if err := rc.SendMessage(SyncFileResponse{GoAhead: true, Msg: "go ahead"}); err != nil {
-				return "sending go ahead", err
+			if !sfr.Streamed {
+				if err := rc.SendMessage(SyncFileResponse{GoAhead: true, Msg: "go ahead"}); err != nil {
+					return "sending go ahead", err
+				}
 			}
 			if _, err := common.CopyN(rc, sfr.Size, tempFile); err != nil {
 				return "copying data", err
@@ -299,6 +360,10 @@ func (r *Replicator) objRepConnHandler(writer http.ResponseWriter, request *http
 				HashCleanupListDir(hashDir, r.reclaimAge)
 			}
 			InvalidateHash(hashDir)
+			if sfr.Streamed {
+				saved = append(saved, sfr.Path)
+				return "file done", nil
+			}
 			err = rc.SendMessage(FileUploadResponse{Success: true, Msg: "YAY"})
 			return "file done", err
 		}()
@@ -320,6 +385,18 @@ func (r *Replicator) LogRequest(next http.Handler) http.Handler {
 	return srv.LogRequest(r.logger, next)
 }
 
+// pauseInMaintenance turns away incoming replication while the node is in
+// maintenance, so other nodes' replicators leave it alone until it's back.
+func (r *Replicator) pauseInMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if middleware.InMaintenance(r.reconCachePath) {
+			srv.SimpleErrorResponse(writer, http.StatusServiceUnavailable, "Node is in maintenance")
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
 func (r *Replicator) GetHandler(config conf.Config, metricsPrefix string) http.Handler {
 	r.metricsScope, r.metricsCloser = tally.NewRootScope(tally.ScopeOptions{
 		Prefix:         metricsPrefix,
@@ -333,6 +410,7 @@ func (r *Replicator) GetHandler(config conf.Config, metricsPrefix string) http.H
 		middleware.RecoverHandler,
 		middleware.ValidateRequest,
 	)
+	repHandlers := commonHandlers.Append(r.pauseInMaintenance)
 	router := srv.NewRouter()
 	router.Get("/metrics", prometheus.Handler())
 	router.Get("/loglevel", r.logLevel)
@@ -340,19 +418,21 @@ func (r *Replicator) GetHandler(config conf.Config, metricsPrefix string) http.H
 	router.Get("/healthcheck", commonHandlers.ThenFunc(r.HealthcheckHandler))
 	router.Get("/debug/pprof/:parm", http.DefaultServeMux)
 	router.Post("/debug/pprof/:parm", http.DefaultServeMux)
-	router.Post("/priorityrep", commonHandlers.ThenFunc(r.priorityRepHandler))
+	router.Post("/priorityrep", repHandlers.ThenFunc(r.priorityRepHandler))
 	router.Post("/stabilize/:device/:partition/:account/:container/*obj", commonHandlers.ThenFunc(r.stabilizeHandler))
 	router.Get("/progress/:name", commonHandlers.ThenFunc(r.ProgressReportHandler))
 	for _, policy := range r.policies {
-		router.HandlePolicy("REPCONN", "/:device/:partition", policy.Index, commonHandlers.ThenFunc(r.objRepConnHandler))
-		router.HandlePolicy("REPLICATE", "/:device/:partition/:suffixes", policy.Index, commonHandlers.ThenFunc(r.objReplicateHandler))
-		router.HandlePolicy("REPLICATE", "/:device/:partition", policy.Index, commonHandlers.ThenFunc(r.objReplicateHandler))
+		router.HandlePolicy("REPCONN", "/:device/:partition", policy.Index, repHandlers.ThenFunc(r.objRepConnHandler))
+		router.HandlePolicy("REPLICATE", "/:device/:partition/:suffixes", policy.Index, repHandlers.ThenFunc(r.objReplicateHandler))
+		router.HandlePolicy("REPLICATE", "/:device/:partition", policy.Index, repHandlers.ThenFunc(r.objReplicateHandler))
 	}
 	router.Get("/debug/*_", http.DefaultServeMux)
+	// The engines' routes here are how their replicators talk to each other,
+	// so they pause in maintenance too.
 	for policy, objEngine := range r.objEngines {
 		if rhoe, ok := objEngine.(PolicyHandlerRegistrator); ok {
 			rhoe.RegisterHandlers(func(method, path string, handler http.HandlerFunc) {
-				router.HandlePolicy(method, path, policy, commonHandlers.ThenFunc(handler))
+				router.HandlePolicy(method, path, policy, repHandlers.ThenFunc(handler))
 			}, r.metricsScope)
 		}
 	}
@@ -0,0 +1,106 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+)
+
+// RequestClassHeader lets backend daemons say what kind of work a request
+// is for, so the object server can keep background work from crowding out
+// client requests.
+const RequestClassHeader = "X-Backend-Request-Class"
+
+const (
+	requestClassClient      = "client"
+	requestClassReplication = "replication"
+	requestClassAudit       = "audit"
+)
+
+// classifyRequest returns the request's class from RequestClassHeader,
+// falling back to the User-Agents of our own background daemons for
+// requests that don't set it.
+func classifyRequest(request *http.Request) string {
+	switch class := strings.ToLower(request.Header.Get(RequestClassHeader)); class {
+	case requestClassClient, requestClassReplication, requestClassAudit:
+		return class
+	}
+	if request.Method == "REPCONN" {
+		return requestClassReplication
+	}
+	ua := request.Header.Get("User-Agent")
+	switch {
+	case strings.HasPrefix(ua, "nursery-stabilizer"):
+		return requestClassReplication
+	case strings.HasPrefix(ua, "Andrewd"):
+		return requestClassAudit
+	}
+	return requestClassClient
+}
+
+// requestClassLimits caps the number of concurrent requests per device for
+// each background class at its share of disk_limit.  Client requests aren't
+// capped beyond disk_limit itself, so there is always room left for them.
+type requestClassLimits map[string]*common.KeyedLimit
+
+// newRequestClassLimits parses shares like "replication:20, audit:10", each
+// a percentage of diskLimit, and builds the limits for those classes.
+func newRequestClassLimits(shares string, diskLimit int64) (requestClassLimits, error) {
+	limits := requestClassLimits{}
+	if shares != "" && diskLimit <= 0 {
+		return nil, fmt.Errorf("request_class_shares needs a disk_limit to take shares of")
+	}
+	for _, share := range common.SliceFromCSV(shares) {
+		parts := strings.SplitN(share, ":", 2)
+		class := strings.ToLower(strings.TrimSpace(parts[0]))
+		if class != requestClassReplication && class != requestClassAudit {
+			return nil, fmt.Errorf("Invalid request class %q in request_class_shares", parts[0])
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Missing share for request class %q", class)
+		}
+		percent, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("Invalid share for request class %q: %q", class, parts[1])
+		}
+		limit := diskLimit * percent / 100
+		if limit < 1 {
+			limit = 1
+		}
+		limits[class] = common.NewKeyedLimit(limit, 0)
+	}
+	return limits, nil
+}
+
+// Acquire takes a slot for the class on device, returning the number of
+// requests of that class already in use if the class is at its share.
+func (l requestClassLimits) Acquire(device, class string, force bool) int64 {
+	if limit, ok := l[class]; ok {
+		return limit.Acquire(device, force)
+	}
+	return 0
+}
+
+func (l requestClassLimits) Release(device, class string) {
+	if limit, ok := l[class]; ok {
+		limit.Release(device)
+	}
+}
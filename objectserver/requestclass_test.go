@@ -0,0 +1,66 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyRequest(t *testing.T) {
+	req, err := http.NewRequest("GET", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	require.Equal(t, requestClassClient, classifyRequest(req))
+	req.Header.Set("User-Agent", "Andrewd")
+	require.Equal(t, requestClassAudit, classifyRequest(req))
+	req.Header.Set("User-Agent", "nursery-stabilizer")
+	require.Equal(t, requestClassReplication, classifyRequest(req))
+	req.Header.Set(RequestClassHeader, "Audit")
+	require.Equal(t, requestClassAudit, classifyRequest(req))
+	req.Header.Set(RequestClassHeader, "bogus")
+	require.Equal(t, requestClassReplication, classifyRequest(req))
+}
+
+func TestRequestClassLimits(t *testing.T) {
+	limits, err := newRequestClassLimits("replication:50, audit:10", 4)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassReplication, false))
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassReplication, false))
+	require.Equal(t, int64(2), limits.Acquire("sda", requestClassReplication, false))
+	require.Equal(t, int64(0), limits.Acquire("sdb", requestClassReplication, false))
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassAudit, false))
+	require.Equal(t, int64(1), limits.Acquire("sda", requestClassAudit, false))
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassAudit, true))
+	for i := 0; i < 10; i++ {
+		require.Equal(t, int64(0), limits.Acquire("sda", requestClassClient, false))
+	}
+	limits.Release("sda", requestClassReplication)
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassReplication, false))
+
+	_, err = newRequestClassLimits("client:50", 4)
+	require.NotNil(t, err)
+	_, err = newRequestClassLimits("replication", 4)
+	require.NotNil(t, err)
+	_, err = newRequestClassLimits("replication:150", 4)
+	require.NotNil(t, err)
+	_, err = newRequestClassLimits("replication:50", 0)
+	require.NotNil(t, err)
+	limits, err = newRequestClassLimits("", 0)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), limits.Acquire("sda", requestClassReplication, false))
+}
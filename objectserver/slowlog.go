@@ -0,0 +1,119 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type phaseTimerKey struct{}
+
+type requestPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// phaseTimer splits a request's time into named phases, so a slow request's
+// log line shows whether it waited, stalled opening files, or crawled moving
+// data.
+type phaseTimer struct {
+	lock   sync.Mutex
+	start  time.Time
+	last   time.Time
+	phases []requestPhase
+}
+
+func newPhaseTimer() *phaseTimer {
+	now := time.Now()
+	return &phaseTimer{start: now, last: now}
+}
+
+// mark ends the current phase, charging it everything since the previous
+// mark.  A phase marked more than once accumulates.
+func (t *phaseTimer) mark(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	d := now.Sub(t.last)
+	t.last = now
+	for i := range t.phases {
+		if t.phases[i].name == name {
+			t.phases[i].duration += d
+			return
+		}
+	}
+	t.phases = append(t.phases, requestPhase{name: name, duration: d})
+}
+
+func (t *phaseTimer) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, phase := range t.phases {
+		enc.AddFloat64(phase.name, phase.duration.Seconds())
+	}
+	return nil
+}
+
+// markPhase ends the request's current phase; it does nothing for requests
+// that aren't being timed.
+func markPhase(request *http.Request, name string) {
+	if t, ok := request.Context().Value(phaseTimerKey{}).(*phaseTimer); ok {
+		t.mark(name)
+	}
+}
+
+// LogSlowRequests is a middleware that logs a warning, with the time spent in
+// each phase, for any request that takes longer than slow_request_threshold.
+func (server *ObjectServer) LogSlowRequests(next http.Handler) http.Handler {
+	if server.slowRequestThreshold <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		timer := newPhaseTimer()
+		request = request.WithContext(context.WithValue(request.Context(), phaseTimerKey{}, timer))
+		next.ServeHTTP(writer, request)
+		elapsed := time.Since(timer.start)
+		if elapsed < server.slowRequestThreshold {
+			return
+		}
+		timer.mark("respond")
+		vars := srv.GetVars(request)
+		fields := []zapcore.Field{
+			zap.String("method", request.Method),
+			zap.String("device", vars["device"]),
+			zap.Float64("requestTimeSeconds", elapsed.Seconds()),
+			zap.Object("phases", timer),
+		}
+		if vars["obj"] != "" {
+			fields = append(fields, zap.String("hash", ObjHash(vars, server.hashPathPrefix, server.hashPathSuffix)))
+		}
+		if w, ok := writer.(*srv.WebWriter); ok {
+			fields = append(fields, zap.Int("status", w.Status))
+		}
+		if logger := srv.GetLogger(request); logger != nil {
+			logger.With(fields...).Warn("Slow request")
+		} else {
+			server.logger.With(fields...).Warn("Slow request")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/srv"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPhaseTimer(t *testing.T) {
+	timer := newPhaseTimer()
+	timer.mark("open")
+	timer.mark("transfer")
+	timer.mark("open")
+	require.Equal(t, 2, len(timer.phases))
+	require.Equal(t, "open", timer.phases[0].name)
+	require.Equal(t, "transfer", timer.phases[1].name)
+	// Requests that aren't being timed are fine too.
+	markPhase(httptest.NewRequest("GET", "/", nil), "open")
+}
+
+func TestLogSlowRequests(t *testing.T) {
+	obs, logs := observer.New(zap.InfoLevel)
+	server := &ObjectServer{logger: zap.New(obs), hashPathSuffix: "changeme", slowRequestThreshold: 10 * time.Millisecond}
+	handler := server.LogSlowRequests(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		markPhase(request, "open")
+		if request.Header.Get("Slow") == "true" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		markPhase(request, "transfer")
+		writer.WriteHeader(http.StatusCreated)
+	}))
+
+	do := func(slow bool) {
+		request := httptest.NewRequest("PUT", "/sda/1/a/c/o", nil)
+		request = srv.SetVars(request, map[string]string{"device": "sda", "partition": "1", "account": "a", "container": "c", "obj": "o"})
+		if slow {
+			request.Header.Set("Slow", "true")
+		}
+		handler.ServeHTTP(&srv.WebWriter{ResponseWriter: httptest.NewRecorder(), Status: 500}, request)
+	}
+	do(false)
+	require.Equal(t, 0, logs.Len())
+	do(true)
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	require.Equal(t, "Slow request", entry.Message)
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range entry.Context {
+		field.AddTo(enc)
+	}
+	fields := enc.Fields
+	require.Equal(t, "PUT", fields["method"])
+	require.Equal(t, "sda", fields["device"])
+	require.Equal(t, ObjHash(map[string]string{"account": "a", "container": "c", "obj": "o"}, "", "changeme"), fields["hash"])
+	require.Equal(t, int64(http.StatusCreated), fields["status"])
+	phases := fields["phases"].(map[string]interface{})
+	require.True(t, phases["transfer"].(float64) >= 0.02)
+	require.Contains(t, phases, "open")
+	require.Contains(t, phases, "respond")
+}
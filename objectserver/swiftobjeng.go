@@ -104,8 +104,10 @@ type swiftDevice struct {
 		beginReplication(dev *ring.Device, partition string, hashes bool, rChan chan beginReplicationResponse, headers map[string]string)
 		listObjFiles(objChan chan string, cancel chan struct{}, partdir string, needSuffix func(string) bool)
 		syncFile(objFile string, dst []*syncFileArg, handoff bool) (syncs int, insync int, err error)
+		syncFilesStreamed(objFiles []string, dst []*syncFileArg) (syncs int, insync map[string]int, err error)
 		replicateUsingHashes(rjob replJob, moreNodes ring.MoreNodes) (int64, error)
 		replicateAll(rjob replJob, isHandoff bool) (int64, error)
+		estimatePartition(rjob replJob, isHandoff bool, useHashes bool) (*partitionDelta, error)
 		cleanTemp()
 		listPartitions() ([]string, []string, error)
 		replicatePartition(partition string)
@@ -117,12 +119,17 @@ type swiftDevice struct {
 }
 
 type beginReplicationResponse struct {
-	dev    *ring.Device
-	conn   RepConn
-	hashes map[string]string
-	err    error
+	dev       *ring.Device
+	conn      RepConn
+	hashes    map[string]string
+	streaming bool
+	err       error
 }
 
+// streamingSyncBatchSize is how many files syncFilesStreamed is given at a
+// time, and so how many paths go in each missing check.
+const streamingSyncBatchSize = 128
+
 type syncFileArg struct {
 	conn RepConn
 	dev  *ring.Device
@@ -134,6 +141,15 @@ type replJob struct {
 	headers   map[string]string
 }
 
+// partitionDelta is what replicating a partition would send and delete, as
+// worked out by a dry run.
+type partitionDelta struct {
+	filesToSend   int64
+	bytesToSend   int64
+	filesToDelete int64
+	bytesToDelete int64
+}
+
 type quarantineFileError struct {
 	msg string
 }
@@ -290,6 +306,138 @@ func (rd *swiftDevice) syncFile(objFile string, dst []*syncFileArg, handoff bool
 	return syncs, insync, nil
 }
 
+// syncFilesStreamed does what syncFile does for a batch of files, over
+// connections that negotiated streaming.  Each server gets one missing check
+// for the whole batch, then the files it wants are streamed back to back
+// without waiting on a response for each, and a last missing check reports
+// which of them it saved.  insync is keyed by objFile.
+func (rd *swiftDevice) syncFilesStreamed(objFiles []string, dst []*syncFileArg) (syncs int, insync map[string]int, err error) {
+	insync = make(map[string]int, len(objFiles))
+	relPaths := make([]string, len(objFiles))
+	for i, objFile := range objFiles {
+		lst := strings.Split(objFile, string(os.PathSeparator))
+		relPaths[i] = filepath.Join(lst[len(lst)-5:]...)
+	}
+
+	// ask each server which of the files it needs
+	wanted := make(map[*syncFileArg]map[string]bool, len(dst))
+	for _, sfa := range dst {
+		var sfr SyncFileResponse
+		paths := make([]string, len(relPaths))
+		for i, relPath := range relPaths {
+			paths[i] = filepath.Join(sfa.dev.Device, relPath)
+		}
+		if err := sfa.conn.SendMessage(SyncFileRequest{MissingCheck: true, Paths: paths}); err != nil {
+			continue
+		} else if err := sfa.conn.RecvMessage(&sfr); err != nil {
+			continue
+		}
+		wanted[sfa] = make(map[string]bool, len(sfr.Wanted))
+		for _, path := range sfr.Wanted {
+			wanted[sfa][path] = true
+		}
+		newer := make(map[string]bool, len(sfr.Newer))
+		for _, path := range sfr.Newer {
+			newer[path] = true
+		}
+		for i, objFile := range objFiles {
+			if newer[paths[i]] {
+				insync[objFile]++
+				if os.Remove(objFile) == nil {
+					InvalidateHash(filepath.Dir(objFile))
+				}
+			} else if !wanted[sfa][paths[i]] {
+				insync[objFile]++
+			}
+		}
+	}
+
+	// stream the wanted files
+	sizes := make(map[string]int64)
+	scratch := make([]byte, 32768)
+	for i, objFile := range objFiles {
+		var wrs []*syncFileArg
+		// like syncFile, only send to one server in each remote region
+		syncingRemoteRegion := make(map[int]bool)
+		for _, sfa := range dst {
+			if !wanted[sfa][filepath.Join(sfa.dev.Device, relPaths[i])] || syncingRemoteRegion[sfa.dev.Region] || sfa.conn.Disconnected() {
+				continue
+			}
+			wrs = append(wrs, sfa)
+			if sfa.dev.Region != rd.dev.Region {
+				syncingRemoteRegion[sfa.dev.Region] = true
+			}
+		}
+		if len(wrs) == 0 {
+			continue
+		}
+		fp, xattrs, fileSize, err := getFile(objFile)
+		if _, ok := err.(quarantineFileError); ok {
+			hashDir := filepath.Dir(objFile)
+			rd.r.logger.Error("[syncFilesStreamed] Failed audit and is being quarantined",
+				zap.String("hashDir", hashDir),
+				zap.Error(err))
+			QuarantineHash(hashDir)
+			continue
+		} else if err != nil {
+			continue
+		}
+		sizes[objFile] = fileSize
+		for index, sfa := range wrs {
+			if sfa.conn.SendMessage(SyncFileRequest{Path: filepath.Join(sfa.dev.Device, relPaths[i]),
+				Xattrs: hex.EncodeToString(xattrs), Size: fileSize, Streamed: true}) != nil {
+				wrs[index] = nil
+			}
+		}
+		var length int
+		var totalRead int64
+		for length, err = fp.Read(scratch); err == nil; length, err = fp.Read(scratch) {
+			totalRead += int64(length)
+			for index, sfa := range wrs {
+				if sfa == nil {
+					continue
+				}
+				if _, err := sfa.conn.Write(scratch[0:length]); err != nil {
+					rd.r.logger.Error("Failed to write to remoteDevice",
+						zap.Int("device id", sfa.dev.Id),
+						zap.Error(err))
+					wrs[index] = nil
+				}
+			}
+		}
+		fp.Close()
+		if totalRead != fileSize {
+			return syncs, insync, fmt.Errorf("Failed to read the full file: %s, %v", objFile, err)
+		}
+	}
+
+	// find out what was saved
+	for sfa := range wanted {
+		if len(wanted[sfa]) == 0 || sfa.conn.Disconnected() {
+			continue
+		}
+		var sfr SyncFileResponse
+		if err := sfa.conn.SendMessage(SyncFileRequest{MissingCheck: true}); err != nil {
+			continue
+		} else if err := sfa.conn.RecvMessage(&sfr); err != nil {
+			continue
+		}
+		saved := make(map[string]bool, len(sfr.Saved))
+		for _, path := range sfr.Saved {
+			saved[path] = true
+		}
+		for i, objFile := range objFiles {
+			if saved[filepath.Join(sfa.dev.Device, relPaths[i])] {
+				syncs++
+				insync[objFile]++
+				rd.UpdateStat("FilesSent", 1)
+				rd.UpdateStat("BytesSent", sizes[objFile])
+			}
+		}
+	}
+	return syncs, insync, nil
+}
+
 func spaceWriter(w http.ResponseWriter, c chan struct{}, d chan struct{}) {
 	defer close(d)
 	for {
@@ -361,14 +509,14 @@ func (rd *swiftDevice) beginReplication(dev *ring.Device, partition string, hash
 	}
 	headers["X-Trans-Id"] = fmt.Sprintf("%s-%d", common.UUID(), dev.Id)
 
-	if rc, err := NewRepConn(dev, partition, rd.policy, headers, rd.r.CertFile, rd.r.KeyFile, rd.r.rcTimeout); err != nil {
+	if rc, err := NewRepConn(dev, partition, rd.policy, headers, rd.r.CertFile, rd.r.KeyFile, rd.r.replicationPSK, rd.r.replicationPSKRequired, rd.r.rcTimeout); err != nil {
 		rChan <- beginReplicationResponse{dev: dev, err: err}
-	} else if err := rc.SendMessage(BeginReplicationRequest{Device: dev.Device, Partition: partition, NeedHashes: hashes}); err != nil {
+	} else if err := rc.SendMessage(BeginReplicationRequest{Device: dev.Device, Partition: partition, NeedHashes: hashes, Streaming: rd.r.streamingSync}); err != nil {
 		rChan <- beginReplicationResponse{dev: dev, err: err}
 	} else if err := rc.RecvMessage(&brr); err != nil {
 		rChan <- beginReplicationResponse{dev: dev, err: err}
 	} else {
-		rChan <- beginReplicationResponse{dev: dev, conn: rc, hashes: brr.Hashes}
+		rChan <- beginReplicationResponse{dev: dev, conn: rc, hashes: brr.Hashes, streaming: brr.Streaming}
 	}
 }
 
@@ -378,6 +526,7 @@ func (rd *swiftDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNod
 	startGetHashesRemote := time.Now()
 	remoteHashes := make(map[int]map[string]string)
 	remoteConnections := make(map[int]RepConn)
+	streaming := true
 	rChan := make(chan beginReplicationResponse)
 	for _, dev := range rjob.nodes {
 		go rd.i.beginReplication(dev, rjob.partition, true, rChan, rjob.headers)
@@ -388,7 +537,8 @@ func (rd *swiftDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNod
 			defer rData.conn.Close()
 			remoteHashes[rData.dev.Id] = rData.hashes
 			remoteConnections[rData.dev.Id] = rData.conn
-		} else if rData.err == RepUnmountedError {
+			streaming = streaming && rData.streaming
+		} else if common.IsDiskUnmounted(rData.err) {
 			if nextNode := moreNodes.Next(); nextNode != nil {
 				go rd.i.beginReplication(nextNode, rjob.partition, true, rChan, rjob.headers)
 				rjob.nodes = append(rjob.nodes, nextNode)
@@ -437,6 +587,21 @@ func (rd *swiftDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNod
 		return false
 	})
 	startSyncing := time.Now()
+	var batch []string
+	batchDevs := make(map[int]bool)
+	syncBatch := func() error {
+		toSync := make([]*syncFileArg, 0, len(batchDevs))
+		for _, dev := range rjob.nodes {
+			if batchDevs[dev.Id] {
+				toSync = append(toSync, &syncFileArg{conn: remoteConnections[dev.Id], dev: dev})
+			}
+		}
+		syncs, _, err := rd.i.syncFilesStreamed(batch, toSync)
+		syncCount += int64(syncs)
+		batch = batch[:0]
+		batchDevs = make(map[int]bool)
+		return err
+	}
 	for objFile := range objChan {
 		toSync := make([]*syncFileArg, 0)
 		suffix := filepath.Base(filepath.Dir(filepath.Dir(objFile)))
@@ -450,6 +615,19 @@ func (rd *swiftDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNod
 		if len(toSync) == 0 {
 			break
 		}
+		if streaming {
+			batch = append(batch, objFile)
+			for _, sfa := range toSync {
+				batchDevs[sfa.dev.Id] = true
+			}
+			if len(batch) >= streamingSyncBatchSize {
+				if err := syncBatch(); err != nil {
+					rd.r.logger.Error("[syncFilesStreamed]", zap.Error(err))
+					return syncCount, err
+				}
+			}
+			continue
+		}
 		if syncs, _, err := rd.i.syncFile(objFile, toSync, false); err == nil {
 			syncCount += int64(syncs)
 		} else {
@@ -457,6 +635,12 @@ func (rd *swiftDevice) replicateUsingHashes(rjob replJob, moreNodes ring.MoreNod
 			return syncCount, err
 		}
 	}
+	if len(batch) > 0 {
+		if err := syncBatch(); err != nil {
+			rd.r.logger.Error("[syncFilesStreamed]", zap.Error(err))
+			return syncCount, err
+		}
+	}
 	for _, conn := range remoteConnections {
 		if !conn.Disconnected() {
 			conn.SendMessage(SyncFileRequest{Done: true})
@@ -478,6 +662,7 @@ func (rd *swiftDevice) replicateAll(rjob replJob, isHandoff bool) (int64, error)
 	path := filepath.Join(rd.r.deviceRoot, rd.dev.Device, PolicyDir(rd.policy), rjob.partition)
 	syncCount := int64(0)
 	remoteConnections := make(map[int]RepConn)
+	streaming := true
 	rChan := make(chan beginReplicationResponse)
 	for _, dev := range rjob.nodes {
 		go rd.i.beginReplication(dev, rjob.partition, false, rChan, rjob.headers)
@@ -487,6 +672,7 @@ func (rd *swiftDevice) replicateAll(rjob replJob, isHandoff bool) (int64, error)
 		if rData.err == nil {
 			defer rData.conn.Close()
 			remoteConnections[rData.dev.Id] = rData.conn
+			streaming = streaming && rData.streaming
 		}
 	}
 	if len(remoteConnections) == 0 {
@@ -497,8 +683,27 @@ func (rd *swiftDevice) replicateAll(rjob replJob, isHandoff bool) (int64, error)
 	cancel := make(chan struct{})
 	defer close(cancel)
 	go rd.i.listObjFiles(objChan, cancel, path, func(string) bool { return true })
+	removeIfInSync := func(objFile string, insync int) {
+		if isHandoff && rd.handoffInSync(insync, len(rjob.nodes)) {
+			os.Remove(objFile)
+			os.Remove(filepath.Dir(objFile))
+		}
+	}
+	var batch []string
+	syncBatch := func(toSync []*syncFileArg) error {
+		syncs, insync, err := rd.i.syncFilesStreamed(batch, toSync)
+		syncCount += int64(syncs)
+		if err == nil {
+			for _, objFile := range batch {
+				removeIfInSync(objFile, insync[objFile])
+			}
+		}
+		batch = batch[:0]
+		return err
+	}
+	var toSync []*syncFileArg
 	for objFile := range objChan {
-		toSync := make([]*syncFileArg, 0)
+		toSync = make([]*syncFileArg, 0)
 		for _, dev := range rjob.nodes {
 			if remoteConnections[dev.Id] != nil && !remoteConnections[dev.Id].Disconnected() {
 				toSync = append(toSync, &syncFileArg{conn: remoteConnections[dev.Id], dev: dev})
@@ -507,22 +712,29 @@ func (rd *swiftDevice) replicateAll(rjob replJob, isHandoff bool) (int64, error)
 		if len(toSync) == 0 {
 			return 0, fmt.Errorf("replicateAll could get no remote connections to sync")
 		}
+		if streaming {
+			if batch = append(batch, objFile); len(batch) >= streamingSyncBatchSize {
+				if err := syncBatch(toSync); err != nil {
+					rd.r.logger.Error("[syncFilesStreamed]", zap.Error(err))
+					return syncCount, err
+				}
+			}
+			continue
+		}
 		if syncs, insync, err := rd.i.syncFile(objFile, toSync, true); err == nil {
 			syncCount += int64(syncs)
-
-			success := insync == len(rjob.nodes)
-			if rd.r.quorumDelete {
-				success = insync >= len(rjob.nodes)/2+1
-			}
-			if success && isHandoff {
-				os.Remove(objFile)
-				os.Remove(filepath.Dir(objFile))
-			}
+			removeIfInSync(objFile, insync)
 		} else {
 			rd.r.logger.Error("[syncFile]", zap.Error(err))
 			return syncCount, err
 		}
 	}
+	if len(batch) > 0 {
+		if err := syncBatch(toSync); err != nil {
+			rd.r.logger.Error("[syncFilesStreamed]", zap.Error(err))
+			return syncCount, err
+		}
+	}
 	for _, conn := range remoteConnections {
 		if !conn.Disconnected() {
 			conn.SendMessage(SyncFileRequest{Done: true})
@@ -534,6 +746,127 @@ func (rd *swiftDevice) replicateAll(rjob replJob, isHandoff bool) (int64, error)
 	return syncCount, nil
 }
 
+// handoffInSync reports whether a handoff's file is on enough of its primary
+// nodes to be removed.
+func (rd *swiftDevice) handoffInSync(insync int, nodes int) bool {
+	if rd.r.quorumDelete {
+		return insync >= nodes/2+1
+	}
+	return insync == nodes
+}
+
+// estimatePartition works out what replicating rjob would send and delete,
+// the way replicateAll or replicateUsingHashes would go about it, without
+// doing either.  The remote servers are only asked whether they have each
+// file, so nothing is written at either end.
+func (rd *swiftDevice) estimatePartition(rjob replJob, isHandoff bool, useHashes bool) (*partitionDelta, error) {
+	path := filepath.Join(rd.r.deviceRoot, rd.dev.Device, PolicyDir(rd.policy), rjob.partition)
+	remoteHashes := make(map[int]map[string]string)
+	remoteConnections := make(map[int]RepConn)
+	rChan := make(chan beginReplicationResponse)
+	for _, dev := range rjob.nodes {
+		go rd.i.beginReplication(dev, rjob.partition, useHashes, rChan, rjob.headers)
+	}
+	for i := 0; i < len(rjob.nodes); i++ {
+		if rData := <-rChan; rData.err == nil {
+			defer rData.conn.Close()
+			remoteHashes[rData.dev.Id] = rData.hashes
+			remoteConnections[rData.dev.Id] = rData.conn
+		}
+	}
+	if len(remoteConnections) == 0 {
+		return nil, fmt.Errorf("estimatePartition could get no remote connections")
+	}
+
+	var hashes map[string]string
+	if useHashes {
+		var err error
+		if hashes, err = GetHashes(rd.r.deviceRoot, rd.dev.Device, rjob.partition, []string{}, rd.r.reclaimAge, rd.policy, rd.r.logger); err != nil {
+			return nil, err
+		}
+		recalc := []string{}
+		for suffix, localHash := range hashes {
+			for _, remoteHash := range remoteHashes {
+				if remoteHash[suffix] != "" && localHash != remoteHash[suffix] {
+					recalc = append(recalc, suffix)
+					break
+				}
+			}
+		}
+		if hashes, err = GetHashes(rd.r.deviceRoot, rd.dev.Device, rjob.partition, recalc, rd.r.reclaimAge, rd.policy, rd.r.logger); err != nil {
+			return nil, err
+		}
+	}
+	differs := func(devId int, suffix string) bool {
+		return !useHashes || hashes[suffix] != remoteHashes[devId][suffix]
+	}
+
+	objChan := make(chan string, 100)
+	cancel := make(chan struct{})
+	defer close(cancel)
+	go rd.i.listObjFiles(objChan, cancel, path, func(suffix string) bool {
+		for devId := range remoteConnections {
+			if differs(devId, suffix) {
+				return true
+			}
+		}
+		return false
+	})
+	delta := &partitionDelta{}
+	for objFile := range objChan {
+		finfo, err := os.Stat(objFile)
+		if err != nil {
+			continue
+		}
+		lst := strings.Split(objFile, string(os.PathSeparator))
+		relPath := filepath.Join(lst[len(lst)-5:]...)
+		suffix := filepath.Base(filepath.Dir(filepath.Dir(objFile)))
+		insync := 0
+		newer := false
+		// like syncFile, only send to one server in each remote region
+		syncingRemoteRegion := make(map[int]bool)
+		for _, dev := range rjob.nodes {
+			conn := remoteConnections[dev.Id]
+			if conn == nil || conn.Disconnected() {
+				continue
+			}
+			if !differs(dev.Id, suffix) {
+				insync++
+				continue
+			}
+			var sfr SyncFileResponse
+			if conn.SendMessage(SyncFileRequest{Path: filepath.Join(dev.Device, relPath), Check: true}) != nil {
+				continue
+			} else if conn.RecvMessage(&sfr) != nil {
+				continue
+			}
+			if sfr.NewerExists {
+				insync++
+				newer = true
+			} else if sfr.Exists {
+				insync++
+			} else if !syncingRemoteRegion[dev.Region] {
+				insync++
+				delta.filesToSend++
+				delta.bytesToSend += finfo.Size()
+				if dev.Region != rd.dev.Region {
+					syncingRemoteRegion[dev.Region] = true
+				}
+			}
+		}
+		if newer || (isHandoff && rd.handoffInSync(insync, len(rjob.nodes))) {
+			delta.filesToDelete++
+			delta.bytesToDelete += finfo.Size()
+		}
+	}
+	for _, conn := range remoteConnections {
+		if !conn.Disconnected() {
+			conn.SendMessage(SyncFileRequest{Done: true})
+		}
+	}
+	return delta, nil
+}
+
 func (rd *swiftDevice) Key() string {
 	return deviceKeyId(rd.dev.Device, rd.policy)
 }
@@ -553,6 +886,11 @@ func (rd *swiftDevice) cleanTemp() {
 }
 
 func (rd *swiftDevice) replicatePartition(partition string) {
+	if !rd.r.handoffDrain.claim(rd.Key(), partition) {
+		rd.UpdateStat("PartitionsDone", 1)
+		return
+	}
+	defer rd.r.handoffDrain.release(rd.Key(), partition)
 	rd.r.replicateConcurrencySem <- struct{}{}
 	defer func() {
 		<-rd.r.replicateConcurrencySem
@@ -567,8 +905,11 @@ func (rd *swiftDevice) replicatePartition(partition string) {
 		return
 	}
 	rjob := replJob{partition: partition, nodes: nodes}
-	if handoff || (policy.Type == "replication-nursery" &&
-		!common.LooksTrue(policy.Config["cache_hash_dirs"])) {
+	useHashes := !handoff && !(policy.Type == "replication-nursery" &&
+		!common.LooksTrue(policy.Config["cache_hash_dirs"]))
+	if rd.r.dryRun {
+		rd.estimate(rjob, handoff, useHashes)
+	} else if !useHashes {
 		rd.i.replicateAll(rjob, handoff)
 	} else {
 		rd.i.replicateUsingHashes(rjob, rd.r.objectRings[rd.policy].GetMoreNodes(partitioni))
@@ -576,6 +917,34 @@ func (rd *swiftDevice) replicatePartition(partition string) {
 	rd.UpdateStat("PartitionsDone", 1)
 }
 
+// estimate logs what replicating a partition would do and adds it to the
+// device's stats, which are logged at the end of the pass.
+func (rd *swiftDevice) estimate(rjob replJob, isHandoff bool, useHashes bool) {
+	delta, err := rd.i.estimatePartition(rjob, isHandoff, useHashes)
+	if err != nil {
+		rd.r.logger.Error("[dryRun] Error estimating partition",
+			zap.String("Device", rd.dev.Device),
+			zap.String("Partition", rjob.partition),
+			zap.Error(err))
+		return
+	}
+	rd.UpdateStat("DryRunFilesToSend", delta.filesToSend)
+	rd.UpdateStat("DryRunBytesToSend", delta.bytesToSend)
+	rd.UpdateStat("DryRunFilesToDelete", delta.filesToDelete)
+	rd.UpdateStat("DryRunBytesToDelete", delta.bytesToDelete)
+	if delta.filesToSend > 0 || delta.filesToDelete > 0 {
+		rd.r.logger.Info("[dryRun] Partition would be replicated",
+			zap.String("Device", rd.dev.Device),
+			zap.Int("Policy", rd.policy),
+			zap.String("Partition", rjob.partition),
+			zap.Bool("Handoff", isHandoff),
+			zap.Int64("FilesToSend", delta.filesToSend),
+			zap.Int64("BytesToSend", delta.bytesToSend),
+			zap.Int64("FilesToDelete", delta.filesToDelete),
+			zap.Int64("BytesToDelete", delta.bytesToDelete))
+	}
+}
+
 func (rd *swiftDevice) listPartitions() ([]string, []string, error) {
 	// returns a list of all partitions and a subset of that list- just the handoffs
 	objPath := filepath.Join(rd.r.deviceRoot, rd.dev.Device, PolicyDir(rd.policy))
@@ -608,6 +977,27 @@ func (rd *swiftDevice) listPartitions() ([]string, []string, error) {
 	return partitionList, handoffList, nil
 }
 
+// HandoffPartitions returns the partitions on the device the ring has
+// assigned elsewhere.
+func (rd *swiftDevice) HandoffPartitions() ([]string, error) {
+	_, handoffs, err := rd.i.listPartitions()
+	return handoffs, err
+}
+
+// DrainHandoff pushes a handoff partition to its primaries, removing the
+// files they have, returning how many files were sent.
+func (rd *swiftDevice) DrainHandoff(partition string) (int64, error) {
+	partitioni, err := strconv.ParseUint(partition, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	nodes, handoff := rd.r.objectRings[rd.policy].GetJobNodes(partitioni, rd.dev.Id)
+	if !handoff {
+		return 0, nil
+	}
+	return rd.i.replicateAll(replJob{partition: partition, nodes: nodes}, true)
+}
+
 func (rd *swiftDevice) Scan() {
 	defer srv.LogPanics(rd.r.logger, fmt.Sprintf("PANIC REPLICATING DEVICE: %s", rd.dev.Device))
 	rd.UpdateStat("startRun", 1)
@@ -618,6 +1008,10 @@ func (rd *swiftDevice) Scan() {
 	if fs.Exists(filepath.Join(rd.r.deviceRoot, rd.dev.Device, "lock_device")) {
 		return
 	}
+	if deviceBreakerTripped(rd.r.reconCachePath, rd.dev.Device) {
+		rd.r.logger.Info("[replicateDevice] Skipping device out of service after I/O errors", zap.String("Device", rd.dev.Device))
+		return
+	}
 
 	rd.i.cleanTemp()
 
@@ -713,6 +1107,14 @@ type SwiftObject struct {
 	reserve      int64
 	reclaimAge   int64
 	asyncWG      *sync.WaitGroup // Used to keep track of async goroutines
+	// readahead is how much of the data to have the kernel prefetch when a
+	// read starts, 0 to leave it to the kernel's own readahead.
+	readahead int64
+	// directReadThreshold is the size at and above which whole-object
+	// reads use O_DIRECT, 0 to never use it.
+	directReadThreshold int64
+	// syncPolicy is how durably new files are written.
+	syncPolicy fs.SyncPolicy
 }
 
 // Metadata returns the object's metadata.
@@ -743,8 +1145,33 @@ func (o *SwiftObject) Exists() bool {
 	return strings.HasSuffix(o.dataFile, ".data")
 }
 
+// Prefetch has the kernel start reading in the range of the data from start
+// to end, up to readahead bytes of it.
+func (o *SwiftObject) Prefetch(start, end int64) {
+	if o.readahead <= 0 || o.file == nil {
+		return
+	}
+	if end-start > o.readahead {
+		end = start + o.readahead
+	}
+	fs.Fadvise(o.file, start, end-start, fs.FADV_WILLNEED)
+}
+
 // Copy copies all data from the underlying .data file to the given writers.
+// Objects of at least directReadThreshold bytes are streamed with O_DIRECT,
+// so serving one doesn't push everything else out of the page cache.
 func (o *SwiftObject) Copy(dsts ...io.Writer) (written int64, err error) {
+	contentLength := o.ContentLength()
+	if o.directReadThreshold > 0 && contentLength >= o.directReadThreshold && fs.SetDirect(o.file) == nil {
+		if len(dsts) == 1 {
+			return fs.CopyDirect(o.file, contentLength, dsts[0])
+		}
+		return fs.CopyDirect(o.file, contentLength, io.MultiWriter(dsts...))
+	}
+	if o.readahead > 0 {
+		fs.Fadvise(o.file, 0, 0, fs.FADV_SEQUENTIAL)
+		o.Prefetch(0, contentLength)
+	}
 	if len(dsts) == 1 {
 		return io.Copy(dsts[0], o.file)
 	} else {
@@ -773,7 +1200,7 @@ func (o *SwiftObject) Repr() string {
 func (o *SwiftObject) newFile(class string, size int64) (io.Writer, error) {
 	var err error
 	o.Close()
-	if o.afw, err = fs.NewAtomicFileWriter(o.tempDir, o.hashDir); err != nil {
+	if o.afw, err = fs.NewAtomicFileWriterSync(o.tempDir, o.hashDir, o.syncPolicy); err != nil {
 		return nil, fmt.Errorf("Error creating temp file: %v", err)
 	}
 	if err := o.afw.Preallocate(size, o.reserve); err != nil {
@@ -805,10 +1232,7 @@ func (o *SwiftObject) Commit(metadata map[string]string) error {
 	go func() {
 		defer o.asyncWG.Done()
 		HashCleanupListDir(o.hashDir, o.reclaimAge)
-		if dir, err := os.OpenFile(o.hashDir, os.O_RDONLY, 0666); err == nil {
-			dir.Sync()
-			dir.Close()
-		}
+		o.syncPolicy.SyncDir(o.hashDir)
 		InvalidateHash(o.hashDir)
 	}()
 	return nil
@@ -852,12 +1276,18 @@ type SwiftEngine struct {
 	reserve        int64
 	reclaimAge     int64
 	policy         int
+	// readahead and directReadThreshold are passed on to each SwiftObject.
+	readahead           int64
+	directReadThreshold int64
+	syncPolicies        *syncPolicies
 }
 
 // New returns an instance of SwiftObject with the given parameters. Metadata is read in and if needData is true, the file is opened.  AsyncWG is a waitgroup if the object spawns any async operations
 func (f *SwiftEngine) New(vars map[string]string, needData bool, asyncWG *sync.WaitGroup) (Object, error) {
 	var err error
-	sor := &SwiftObject{reclaimAge: f.reclaimAge, reserve: f.reserve, asyncWG: asyncWG}
+	sor := &SwiftObject{reclaimAge: f.reclaimAge, reserve: f.reserve, asyncWG: asyncWG,
+		readahead: f.readahead, directReadThreshold: f.directReadThreshold,
+		syncPolicy: f.syncPolicies.forDevice(vars["device"])}
 	sor.hashDir = ObjHashDir(vars, f.driveRoot, f.hashPathPrefix, f.hashPathSuffix, f.policy)
 	sor.tempDir = TempDirPath(f.driveRoot, vars["device"])
 	sor.dataFile, sor.metaFile = ObjectFiles(sor.hashDir)
@@ -920,13 +1350,20 @@ func SwiftEngineConstructor(config conf.Config, policy *conf.Policy, flags *flag
 		return nil, errors.New("Unable to load hashpath prefix and suffix")
 	}
 	reclaimAge := int64(config.GetInt("app:object-server", "reclaim_age", int64(common.ONE_WEEK)))
+	sp, err := newSyncPolicies(config, policy)
+	if err != nil {
+		return nil, err
+	}
 	return &SwiftEngine{
-		driveRoot:      driveRoot,
-		hashPathPrefix: hashPathPrefix,
-		hashPathSuffix: hashPathSuffix,
-		reserve:        reserve,
-		reclaimAge:     reclaimAge,
-		policy:         policy.Index}, nil
+		driveRoot:           driveRoot,
+		hashPathPrefix:      hashPathPrefix,
+		hashPathSuffix:      hashPathSuffix,
+		reserve:             reserve,
+		reclaimAge:          reclaimAge,
+		policy:              policy.Index,
+		readahead:           config.GetInt("app:object-server", "readahead", 0),
+		directReadThreshold: config.GetInt("app:object-server", "direct_read_threshold", 0),
+		syncPolicies:        sp}, nil
 }
 
 func init() {
@@ -936,4 +1373,5 @@ func init() {
 // make sure these things satisfy interfaces at compile time
 var _ ObjectEngineConstructor = SwiftEngineConstructor
 var _ Object = &SwiftObject{}
+var _ ObjectPrefetcher = &SwiftObject{}
 var _ ObjectEngine = &SwiftEngine{}
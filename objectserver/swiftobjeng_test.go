@@ -165,6 +165,47 @@ func testObjectMultiCopy(swcon ObjectEngine, t *testing.T) {
 	require.Equal(t, "!", buf2.String())
 }
 
+func TestSwiftObjectReadahead(t *testing.T) {
+	driveRoot, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(driveRoot)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	data := bytes.Repeat([]byte("0123456789"), 100000)
+	vars := map[string]string{"device": "sda", "account": "a", "container": "c", "object": "o", "partition": "1"}
+	swcon := &SwiftEngine{driveRoot: driveRoot, hashPathPrefix: "prefix", hashPathSuffix: "suffix", readahead: 65536}
+	swo, err := swcon.New(vars, false, &wg)
+	require.Nil(t, err)
+	w, err := swo.SetData(int64(len(data)))
+	require.Nil(t, err)
+	w.Write(data)
+	require.Nil(t, swo.Commit(map[string]string{"Content-Length": "1000000", "Content-Type": "text/plain", "X-Timestamp": "1234567890.123456"}))
+	swo.Close()
+
+	for _, threshold := range []int64{0, 1000000, 1000001} {
+		swcon.directReadThreshold = threshold
+		swo, err = swcon.New(vars, true, &wg)
+		require.Nil(t, err)
+		buf1 := &bytes.Buffer{}
+		buf2 := &bytes.Buffer{}
+		n, err := swo.Copy(buf1, buf2)
+		require.Nil(t, err)
+		require.Equal(t, int64(len(data)), n)
+		require.True(t, bytes.Equal(data, buf1.Bytes()))
+		require.True(t, bytes.Equal(data, buf2.Bytes()))
+		swo.Close()
+	}
+
+	swo, err = swcon.New(vars, true, &wg)
+	require.Nil(t, err)
+	defer swo.Close()
+	swo.(ObjectPrefetcher).Prefetch(100, 500000)
+	buf := &bytes.Buffer{}
+	_, err = swo.CopyRange(buf, 100, 500000)
+	require.Nil(t, err)
+	require.True(t, bytes.Equal(data[100:500000], buf.Bytes()))
+}
+
 func TestSwiftObjectDelete(t *testing.T) {
 	driveRoot, err := ioutil.TempDir("", "")
 	require.Nil(t, err)
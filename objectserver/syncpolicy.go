@@ -0,0 +1,116 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/fs"
+)
+
+type deviceSyncPolicy struct {
+	pattern string
+	policy  fs.SyncPolicy
+}
+
+// syncPolicies decides how durably object writes to each device are made.
+// The fsync setting in [app:object-server], or in the storage policy's own
+// section, is the default.  fsync_devices lists "pattern:policy" pairs, the
+// patterns matched against device names so a class of devices, like
+// "scratch*", can be given its own; the first match wins.  So:
+//
+//	[storage-policy:2]
+//	fsync = none
+//
+//	[app:object-server]
+//	fsync = always
+//	fsync_devices = nvme*:fdatasync scratch*:none
+//
+// Devices without a policy configured are written as they always have been,
+// which is like "always" except the repng and hec engines don't fsync the
+// directories their files are linked into.
+type syncPolicies struct {
+	def     fs.SyncPolicy
+	devices []deviceSyncPolicy
+	// set is whether fsync was given at all, rather than left to default.
+	set bool
+}
+
+func newSyncPolicies(config conf.Config, policy *conf.Policy) (*syncPolicies, error) {
+	setting := config.GetDefault("app:object-server", "fsync", "")
+	devices := config.GetDefault("app:object-server", "fsync_devices", "")
+	if policy != nil {
+		if v := policy.Config["fsync"]; v != "" {
+			setting = v
+		}
+		if v := policy.Config["fsync_devices"]; v != "" {
+			devices = v
+		}
+	}
+	sp := &syncPolicies{set: setting != ""}
+	if setting == "" {
+		setting = "always"
+	}
+	var err error
+	if sp.def, err = fs.ParseSyncPolicy(setting); err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.FieldsFunc(devices, func(r rune) bool { return r == ',' || r == ' ' }) {
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid fsync_devices entry %q, should be pattern:policy", pair)
+		}
+		if _, err := filepath.Match(pair[:i], ""); err != nil {
+			return nil, fmt.Errorf("Invalid fsync_devices pattern %q: %v", pair[:i], err)
+		}
+		policy, err := fs.ParseSyncPolicy(pair[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		sp.devices = append(sp.devices, deviceSyncPolicy{pattern: pair[:i], policy: policy})
+	}
+	return sp, nil
+}
+
+// configured says whether the config gives a SyncPolicy for writes to the
+// device, rather than leaving them to the default.
+func (sp *syncPolicies) configured(device string) bool {
+	if sp == nil {
+		return false
+	}
+	for _, d := range sp.devices {
+		if ok, _ := filepath.Match(d.pattern, device); ok {
+			return true
+		}
+	}
+	return sp.set
+}
+
+// forDevice returns the SyncPolicy for writes to the device.
+func (sp *syncPolicies) forDevice(device string) fs.SyncPolicy {
+	if sp == nil {
+		return fs.SyncAlways
+	}
+	for _, d := range sp.devices {
+		if ok, _ := filepath.Match(d.pattern, device); ok {
+			return d.policy
+		}
+	}
+	return sp.def
+}
@@ -0,0 +1,64 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package objectserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/fs"
+)
+
+func TestSyncPolicies(t *testing.T) {
+	config, err := conf.StringConfig("[app:object-server]\nfsync = fdatasync\nfsync_devices = nvme*:always, scratch*:none\n")
+	require.Nil(t, err)
+	sp, err := newSyncPolicies(config, &conf.Policy{Config: map[string]string{}})
+	require.Nil(t, err)
+	require.Equal(t, fs.SyncData, sp.forDevice("sda"))
+	require.Equal(t, fs.SyncAlways, sp.forDevice("nvme0"))
+	require.Equal(t, fs.SyncNone, sp.forDevice("scratch1"))
+	require.True(t, sp.configured("sda"))
+
+	sp, err = newSyncPolicies(config, &conf.Policy{Config: map[string]string{"fsync": "dir", "fsync_devices": "sdb:none"}})
+	require.Nil(t, err)
+	require.Equal(t, fs.SyncDirOnly, sp.forDevice("sda"))
+	require.Equal(t, fs.SyncNone, sp.forDevice("sdb"))
+	require.Equal(t, fs.SyncDirOnly, sp.forDevice("scratch1"))
+
+	config, err = conf.StringConfig("")
+	require.Nil(t, err)
+	sp, err = newSyncPolicies(config, nil)
+	require.Nil(t, err)
+	require.Equal(t, fs.SyncAlways, sp.forDevice("sda"))
+	require.False(t, sp.configured("sda"))
+	require.Equal(t, fs.SyncAlways, (*syncPolicies)(nil).forDevice("sda"))
+	require.False(t, (*syncPolicies)(nil).configured("sda"))
+
+	config, err = conf.StringConfig("[app:object-server]\nfsync_devices = scratch*:none\n")
+	require.Nil(t, err)
+	sp, err = newSyncPolicies(config, nil)
+	require.Nil(t, err)
+	require.False(t, sp.configured("sda"))
+	require.True(t, sp.configured("scratch1"))
+
+	for _, bad := range []string{"fsync = sometimes", "fsync_devices = sda", "fsync_devices = [:none", "fsync_devices = sda:sometimes"} {
+		config, err = conf.StringConfig("[app:object-server]\n" + bad + "\n")
+		require.Nil(t, err)
+		_, err = newSyncPolicies(config, nil)
+		require.NotNil(t, err, bad)
+	}
+}
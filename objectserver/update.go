@@ -22,8 +22,10 @@ import (
 	"io"
 	"math/big"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -56,17 +58,73 @@ func (server *ObjectServer) hashPath(account, container, obj string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// parseDeleteAt reads an X-Delete-At value as whole seconds.  Python Swift
+// sends normalized timestamps like "1434707411.00000" where we'd send
+// "1434707411", so both forms are accepted.
+func parseDeleteAt(deleteAt string) (int64, error) {
+	if at, err := strconv.ParseInt(deleteAt, 10, 64); err == nil {
+		return at, nil
+	}
+	at, err := strconv.ParseFloat(deleteAt, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(at), nil
+}
+
+// normalizeDeleteAt formats a delete-at time the way Swift's
+// normalize_delete_at_timestamp does for expirer task names and containers:
+// ten zero padded digits, clamped to the range that fits.
+func normalizeDeleteAt(at int64) string {
+	if at < 0 {
+		at = 0
+	} else if at > 9999999999 {
+		at = 9999999999
+	}
+	return fmt.Sprintf("%010d", at)
+}
+
 func (server *ObjectServer) expirerContainer(deleteAt time.Time, account, container, obj string) string {
 	i := new(big.Int)
 	fmt.Sscanf(server.hashPath(account, container, obj), "%x", i)
 	shardInt := i.Mod(i, big.NewInt(100)).Int64()
-	timestamp := (deleteAt.Unix()/server.expiringDivisor)*server.expiringDivisor - shardInt
-	if timestamp < 0 {
-		timestamp = 0
-	} else if timestamp > 9999999999 {
-		timestamp = 9999999999
+	return normalizeDeleteAt((deleteAt.Unix()/server.expiringDivisor)*server.expiringDivisor - shardInt)
+}
+
+// expirerTaskName is the name of an object's entry in its expirer task
+// container, the same "<delete-at>-<account>/<container>/<obj>" Swift uses.
+func expirerTaskName(deleteAt int64, account, container, obj string) string {
+	return fmt.Sprintf("%s-%s/%s/%s", normalizeDeleteAt(deleteAt), account, container, obj)
+}
+
+// queueExpiration adds or removes the object's expirer task.  The update goes
+// through async_pending, so the object updater delivers it to the container
+// servers for the task container.  A Python proxy names the task container in
+// X-Delete-At-Container, which is used as given so both agree on where the
+// task lives.
+func (server *ObjectServer) queueExpiration(method string, deleteAt string, request *http.Request, vars map[string]string, logger srv.LowLevelLogger) {
+	at, err := parseDeleteAt(deleteAt)
+	if err != nil {
+		return
+	}
+	headers := http.Header{
+		"X-Timestamp":                    request.Header["X-Timestamp"],
+		"X-Backend-Storage-Policy-Index": {"0"},
+		"Referer":                        {common.GetDefault(request.Header, "Referer", "-")},
+		"User-Agent":                     {common.GetDefault(request.Header, "User-Agent", "-")},
+		"X-Trans-Id":                     {common.GetDefault(request.Header, "X-Trans-Id", "-")},
+	}
+	container := server.expirerContainer(time.Unix(at, 0), vars["account"], vars["container"], vars["obj"])
+	if method != "DELETE" {
+		headers.Set("X-Content-Type", "text/plain")
+		headers.Set("X-Size", "0")
+		headers.Set("X-Etag", zeroByteHash)
+		if c := request.Header.Get("X-Delete-At-Container"); c != "" {
+			container = c
+		}
 	}
-	return fmt.Sprintf("%010d", timestamp)
+	server.saveAsync(method, deleteAtAccount, container,
+		expirerTaskName(at, vars["account"], vars["container"], vars["obj"]), vars["device"], headers, logger)
 }
 
 func (server *ObjectServer) sendContainerUpdate(ctx context.Context, scheme, host, device, method, partition, account, container, obj string, headers http.Header) bool {
@@ -129,10 +187,47 @@ func (server *ObjectServer) updateContainer(ctx context.Context, metadata map[st
 		"X-Timestamp":                    request.Header["X-Timestamp"],
 		"X-Delete-At":                    request.Header["X-Delete-At"],
 	}
+	if traceparent := request.Header.Get("Traceparent"); traceparent != "" {
+		requestHeaders.Set("Traceparent", traceparent)
+	}
+	if common.IsLowPriority(request) {
+		requestHeaders.Set(common.BackendPriorityHeader, common.LowPriority)
+	}
 	if request.Method != "DELETE" {
 		requestHeaders.Add("X-Content-Type", metadata["Content-Type"])
 		requestHeaders.Add("X-Size", metadata["Content-Length"])
-		requestHeaders.Add("X-Etag", metadata["ETag"])
+		etag := metadata["ETag"]
+		// The etag to list can differ from that of the stored bytes, as
+		// with encrypted objects.
+		if override, ok := metadata["X-Object-Sysmeta-Container-Update-Override-Etag"]; ok {
+			etag = override
+		}
+		requestHeaders.Add("X-Etag", etag)
+		tags := url.Values{}
+		for key, value := range metadata {
+			if strings.HasPrefix(key, "X-Object-Sysmeta-Tag-") {
+				tags.Set(strings.ToLower(key[len("X-Object-Sysmeta-Tag-"):]), value)
+			}
+		}
+		if len(tags) > 0 {
+			requestHeaders.Add("X-Object-Tags", tags.Encode())
+		}
+		// the proxy names the metadata keys the container indexes, so
+		// their values can be sent along to go in its listing
+		if indexed := request.Header.Get("X-Backend-Indexed-Meta"); indexed != "" {
+			meta := url.Values{}
+			for _, key := range strings.Split(indexed, ",") {
+				if key = strings.ToLower(strings.TrimSpace(key)); key == "" {
+					continue
+				}
+				if value, ok := metadata[http.CanonicalHeaderKey("X-Object-Meta-"+key)]; ok {
+					meta.Set(key, value)
+				}
+			}
+			if len(meta) > 0 {
+				requestHeaders.Add("X-Object-Indexed-Meta", meta.Encode())
+			}
+		}
 	}
 	failures := 0
 	for index := range hosts {
@@ -151,6 +246,13 @@ func (server *ObjectServer) updateContainer(ctx context.Context, metadata map[st
 func (server *ObjectServer) containerUpdates(writer http.ResponseWriter, request *http.Request, metadata map[string]string, deleteAt string, vars map[string]string, logger srv.LowLevelLogger) {
 	defer middleware.Recover(writer, request, "PANIC WHILE UPDATING CONTAINER LISTINGS")
 
+	// The expirer cleans up its own task after deleting an object, and says
+	// so, rather than have the object server queue a second removal.
+	if deleteAt != "" && (request.Method != "DELETE" ||
+		common.LooksTrue(common.GetDefault(request.Header, "X-Backend-Clean-Expiring-Object-Queue", "true"))) {
+		server.queueExpiration(request.Method, deleteAt, request, vars, logger)
+	}
+
 	done := make(chan struct{}, 1)
 	go func() {
 		ctx := tracing.CopySpanFromContext(request.Context())
@@ -114,6 +114,60 @@ func TestUpdateContainer(t *testing.T) {
 	require.Equal(t, asyncData["obj"], "o")
 }
 
+func TestQueueExpiration(t *testing.T) {
+	ts, err := makeObjectServer(srv.NewTestConfigLoader(&test.FakeRing{}))
+	require.Nil(t, err)
+	server := ts.objServer
+	defer ts.Close()
+	req, err := http.NewRequest("PUT", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Timestamp", "12345.6789")
+	vars := map[string]string{"account": "a", "container": "c", "obj": "o", "device": "sda"}
+
+	server.queueExpiration("PUT", "1434707411", req, vars, zap.NewNop())
+	files, err := filepath.Glob(filepath.Join(ts.root, "sda", "async_pending", "*", "*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(files))
+	data, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+	a, err := pickle.PickleLoads(data)
+	require.Nil(t, err)
+	asyncData := a.(map[interface{}]interface{})
+	require.Equal(t, "PUT", asyncData["op"])
+	require.Equal(t, ".expiring_objects", asyncData["account"])
+	require.Equal(t, server.expirerContainer(time.Unix(1434707411, 0), "a", "c", "o"), asyncData["container"])
+	require.Equal(t, "1434707411-a/c/o", asyncData["obj"])
+
+	server.queueExpiration("PUT", "never", req, vars, zap.NewNop())
+	files, err = filepath.Glob(filepath.Join(ts.root, "sda", "async_pending", "*", "*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(files))
+}
+
+func TestQueueExpirationSwiftFormat(t *testing.T) {
+	ts, err := makeObjectServer(srv.NewTestConfigLoader(&test.FakeRing{}))
+	require.Nil(t, err)
+	server := ts.objServer
+	defer ts.Close()
+	req, err := http.NewRequest("PUT", "/sda/0/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Timestamp", "12345.6789")
+	req.Header.Set("X-Delete-At-Container", "1434700000")
+	vars := map[string]string{"account": "a", "container": "c", "obj": "o", "device": "sda"}
+
+	server.queueExpiration("PUT", "12345.00000", req, vars, zap.NewNop())
+	files, err := filepath.Glob(filepath.Join(ts.root, "sda", "async_pending", "*", "*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(files))
+	data, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+	a, err := pickle.PickleLoads(data)
+	require.Nil(t, err)
+	asyncData := a.(map[interface{}]interface{})
+	require.Equal(t, "1434700000", asyncData["container"])
+	require.Equal(t, "0000012345-a/c/o", asyncData["obj"])
+}
+
 func TestUpdateContainerNoHeaders(t *testing.T) {
 	testRing := &test.FakeRing{}
 	confLoader := srv.NewTestConfigLoader(testRing)
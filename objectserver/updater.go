@@ -90,6 +90,7 @@ func (ud *updateDevice) updateContainers(ap *asyncPending) bool {
 	part := ud.r.containerRing.GetPartition(ap.Account, ap.Container, "")
 	header := common.Map2Headers(ap.Headers)
 	header.Set("User-Agent", fmt.Sprintf("object-updater %d", os.Getpid()))
+	header.Set(common.BackendPriorityHeader, common.LowPriority)
 	for _, node := range ud.r.containerRing.GetNodes(part) {
 		objUrl := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", node.Scheme, node.Ip, node.Port, node.Device, part,
 			common.Urlencode(ap.Account), common.Urlencode(ap.Container), common.Urlencode(ap.Object))
@@ -108,6 +109,9 @@ func (ud *updateDevice) updateContainers(ap *asyncPending) bool {
 			successes++
 		}
 	}
+	// A strict majority, unlike the proxy's write quorum: the pending is
+	// removed on success, so the nodes that missed the update only get it
+	// from container replication.
 	return successes >= (ud.r.containerRing.ReplicaCount()/2)+1
 }
 
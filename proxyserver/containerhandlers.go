@@ -16,7 +16,11 @@
 package proxyserver
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
 
@@ -34,6 +38,86 @@ var listingQueryParms = map[string]bool{
 	"delimiter":  true,
 	"reverse":    true,
 	"path":       true,
+	"fields":     true,
+	"depth":      true,
+}
+
+// anonymousContainerHeaders are the container headers shown to requests let
+// in only by a referrer ACL; custom metadata and anything derived from
+// sysmeta are for the account's users.
+var anonymousContainerHeaders = map[string]bool{
+	"Accept-Ranges":            true,
+	"Content-Type":             true,
+	"Content-Length":           true,
+	"Date":                     true,
+	"Last-Modified":            true,
+	"X-Container-Bytes-Used":   true,
+	"X-Container-Object-Count": true,
+	"X-Storage-Policy":         true,
+	"X-Timestamp":              true,
+	"X-Trans-Id":               true,
+	"X-Openstack-Request-Id":   true,
+}
+
+// anonymousListingFields are the json listing fields shown to requests let in
+// only by a referrer ACL.
+var anonymousListingFields = map[string]bool{
+	"name":          true,
+	"hash":          true,
+	"bytes":         true,
+	"content_type":  true,
+	"last_modified": true,
+	"subdir":        true,
+}
+
+// anonymousRequest reports whether the request was let in only by a referrer
+// ACL.
+func anonymousRequest(ctx *middleware.ProxyContext) bool {
+	return ctx.ReferrerOnly && !ctx.StorageOwner && !ctx.ResellerRequest
+}
+
+// copyContainerHeaders passes a container's response headers on to the
+// client, leaving out the ones the request isn't allowed to see.
+func copyContainerHeaders(writer http.ResponseWriter, header http.Header, ctx *middleware.ProxyContext) {
+	for k := range header {
+		if anonymousRequest(ctx) && !anonymousContainerHeaders[k] {
+			continue
+		}
+		if !common.OwnerHeaders[strings.ToLower(k)] || ctx.StorageOwner {
+			writer.Header().Set(k, header.Get(k))
+		}
+	}
+	if anonymousRequest(ctx) {
+		// The body may shrink once it's filtered.
+		writer.Header().Del("Content-Length")
+	}
+}
+
+// anonymousListing trims a json listing down to the fields anonymous users
+// may see, such as dropping object tags.  The other formats carry nothing
+// more than those fields to begin with.
+func anonymousListing(header http.Header, body []byte) []byte {
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		return body
+	}
+	var records []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&records); err != nil {
+		return []byte("[]")
+	}
+	for _, record := range records {
+		for field := range record {
+			if !anonymousListingFields[field] {
+				delete(record, field)
+			}
+		}
+	}
+	filtered, err := json.Marshal(records)
+	if err != nil {
+		return []byte("[]")
+	}
+	return filtered
 }
 
 func (server *ProxyServer) ContainerGetHandler(writer http.ResponseWriter, request *http.Request) {
@@ -54,6 +138,31 @@ func (server *ProxyServer) ContainerGetHandler(writer http.ResponseWriter, reque
 				options[k] = v[0]
 			}
 		}
+		if tags := request.Form["tag"]; len(tags) > 0 {
+			options["tag"] = strings.Join(tags, ",")
+		}
+		if meta := request.Form["meta"]; len(meta) > 0 {
+			options["meta"] = strings.Join(meta, ",")
+		}
+	}
+	cacheKey := listingKey(options, request.Header.Get("Accept"))
+	useCache := server.listingCache != nil && request.Header.Get("X-Newest") == ""
+	if listing := server.listingCache.get(vars["account"], vars["container"], cacheKey); useCache && listing != nil {
+		ctx.ACL = listing.header.Get("X-Container-Read")
+		if ctx.Authorize != nil {
+			if ok, s := ctx.Authorize(request); !ok {
+				srv.StandardResponse(writer, s)
+				return
+			}
+		}
+		copyContainerHeaders(writer, listing.header, ctx)
+		body := listing.body
+		if anonymousRequest(ctx) {
+			body = anonymousListing(listing.header, body)
+		}
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(body)
+		return
 	}
 	resp := ctx.C.GetContainerRaw(request.Context(), vars["account"], vars["container"], options, request.Header)
 	defer resp.Body.Close()
@@ -65,12 +174,31 @@ func (server *ProxyServer) ContainerGetHandler(writer http.ResponseWriter, reque
 			return
 		}
 	}
-	for k := range resp.Header {
-		if !common.OwnerHeaders[strings.ToLower(k)] || ctx.StorageOwner {
-			writer.Header().Set(k, resp.Header.Get(k))
+	copyContainerHeaders(writer, resp.Header, ctx)
+	if anonymousRequest(ctx) && resp.StatusCode == http.StatusOK {
+		// The whole listing is needed to filter it, and the unfiltered one
+		// is what's worth caching for everyone else.
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			srv.StandardResponse(writer, http.StatusInternalServerError)
+			return
 		}
+		if useCache && len(body) <= server.listingCache.maxSize {
+			server.listingCache.set(vars["account"], vars["container"], cacheKey, resp.Header, body)
+		}
+		writer.WriteHeader(resp.StatusCode)
+		writer.Write(anonymousListing(resp.Header, body))
+		return
 	}
 	writer.WriteHeader(resp.StatusCode)
+	if useCache && resp.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(server.listingCache.maxSize)+1))
+		writer.Write(body)
+		if err == nil && len(body) <= server.listingCache.maxSize {
+			server.listingCache.set(vars["account"], vars["container"], cacheKey, resp.Header, body)
+			return
+		}
+	}
 	common.Copy(resp.Body, writer)
 }
 
@@ -95,11 +223,7 @@ func (server *ProxyServer) ContainerHeadHandler(writer http.ResponseWriter, requ
 			return
 		}
 	}
-	for k := range resp.Header {
-		if !common.OwnerHeaders[strings.ToLower(k)] || ctx.StorageOwner {
-			writer.Header().Set(k, resp.Header.Get(k))
-		}
-	}
+	copyContainerHeaders(writer, resp.Header, ctx)
 	writer.WriteHeader(resp.StatusCode)
 }
 
@@ -124,7 +248,7 @@ func (server *ProxyServer) ContainerPostHandler(writer http.ResponseWriter, requ
 			return
 		}
 	}
-	if status, str := common.CheckContainerPut(request, vars["container"]); status != http.StatusOK {
+	if status, str := server.constraints.CheckContainerPut(request, vars["container"]); status != http.StatusOK {
 		writer.Header().Set("Content-Type", "text/html; charset=UTF-8")
 		writer.WriteHeader(status)
 		writer.Write([]byte(fmt.Sprintf("<html><h1>%s</h1><p>%s</p></html>", http.StatusText(status), str)))
@@ -141,6 +265,7 @@ func (server *ProxyServer) ContainerPostHandler(writer http.ResponseWriter, requ
 	}
 	resp := ctx.C.PostContainer(request.Context(), vars["account"], vars["container"], request.Header)
 	resp.Body.Close()
+	server.listingCache.invalidate(vars["account"], vars["container"])
 	srv.StandardResponse(writer, resp.StatusCode)
 }
 
@@ -172,7 +297,7 @@ func (server *ProxyServer) ContainerPutHandler(writer http.ResponseWriter, reque
 		srv.StandardResponse(writer, 404)
 		return
 	}
-	if status, str := common.CheckContainerPut(request, vars["container"]); status != http.StatusOK {
+	if status, str := server.constraints.CheckContainerPut(request, vars["container"]); status != http.StatusOK {
 		writer.Header().Set("Content-Type", "text/html; charset=UTF-8")
 		writer.WriteHeader(status)
 		writer.Write([]byte(fmt.Sprintf("<html><h1>%s</h1><p>%s</p></html>", http.StatusText(status), str)))
@@ -189,6 +314,7 @@ func (server *ProxyServer) ContainerPutHandler(writer http.ResponseWriter, reque
 	}
 	resp := ctx.C.PutContainer(request.Context(), vars["account"], vars["container"], request.Header)
 	resp.Body.Close()
+	ctx.InvalidateContainer(request.Context(), vars["account"], vars["container"])
 	srv.StandardResponse(writer, resp.StatusCode)
 }
 
@@ -211,6 +337,7 @@ func (server *ProxyServer) ContainerDeleteHandler(writer http.ResponseWriter, re
 	}
 	resp := ctx.C.DeleteContainer(request.Context(), vars["account"], vars["container"], request.Header)
 	resp.Body.Close()
+	ctx.InvalidateContainer(request.Context(), vars["account"], vars["container"])
 	srv.StandardResponse(writer, resp.StatusCode)
 }
 
@@ -226,63 +353,3 @@ func cleanACLs(r *http.Request) error {
 	}
 	return nil
 }
-
-func setVary(writer http.ResponseWriter, h string) {
-	if v := writer.Header().Get("Vary"); v != "" {
-		writer.Header().Set("Vary", fmt.Sprintf("%s, %s", v, h))
-	} else {
-		writer.Header().Set("Vary", h)
-	}
-}
-
-var publicMethods = []string{"HEAD", "GET", "PUT", "POST", "OPTIONS", "DELETE", "COPY"}
-
-func (server *ProxyServer) OptionsHandler(writer http.ResponseWriter, request *http.Request) {
-	vars := srv.GetVars(request)
-	ctx := middleware.GetProxyContext(request)
-	origin := request.Header.Get("Origin")
-	methodString := strings.Join(publicMethods, ", ")
-	if origin == "" || vars["container"] == "" {
-		writer.Header().Set("Allow", methodString)
-		srv.StandardResponse(writer, 200)
-		return
-	}
-	if rqm := request.Header.Get("Access-Control-Request-Method"); rqm == "" {
-		srv.SimpleErrorResponse(writer, 401, "")
-		return
-	} else {
-		found := false
-		for _, method := range publicMethods {
-			if rqm == method {
-				found = true
-				break
-			}
-		}
-		if !found {
-			srv.SimpleErrorResponse(writer, 401, "")
-			return
-		}
-	}
-	if ci, err := ctx.C.GetContainerInfo(request.Context(), vars["account"], vars["container"]); err == nil {
-		if common.IsOriginAllowed(ci.Metadata["Access-Control-Allow-Origin"], origin) {
-			writer.Header().Set("Allow", methodString)
-			if ci.Metadata["Access-Control-Allow-Origin"] == "*" {
-				writer.Header().Set("Access-Control-Allow-Origin", "*")
-			} else {
-				writer.Header().Set("Access-Control-Allow-Origin", origin)
-				setVary(writer, "Origin")
-			}
-			if ma := ci.Metadata["Access-Control-Max-Age"]; ma != "" {
-				writer.Header().Set("Access-Control-Max-Age", ma)
-			}
-			if rh := request.Header.Get("Access-Control-Request-Headers"); rh != "" {
-				writer.Header().Set("Access-Control-Allow-Headers", rh)
-				setVary(writer, "Access-Control-Request-Headers")
-			}
-			srv.StandardResponse(writer, 200)
-			return
-		}
-	}
-	srv.SimpleErrorResponse(writer, 401, "")
-	return
-}
@@ -2,7 +2,6 @@ package proxyserver
 
 import (
 	"bytes"
-	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -39,7 +38,7 @@ func TestEndpointsObjectGetHandler(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/a/c/o", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a", "container": "c", "obj": "o"})
 	p.EndpointsObjectGetHandler(fakeWriter, r)
 	if statuses["S"] != 200 {
@@ -73,7 +72,7 @@ func TestEndpointsContainerGetHandler(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/a/c", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a", "container": "c"})
 	p.EndpointsContainerGetHandler(fakeWriter, r)
 	if statuses["S"] != 200 {
@@ -107,7 +106,7 @@ func TestEndpointsAccountGetHandler(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/a", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a"})
 	p.EndpointsAccountGetHandler(fakeWriter, r)
 	if statuses["S"] != 200 {
@@ -141,7 +140,7 @@ func TestEndpointsObjectGetHandler2(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/v2/a/c/o", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a", "container": "c", "obj": "o"})
 	p.EndpointsObjectGetHandler2(fakeWriter, r)
 	if statuses["S"] != 200 {
@@ -175,7 +174,7 @@ func TestEndpointsContainerGetHandler2(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/v2/a/c", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a", "container": "c"})
 	p.EndpointsContainerGetHandler2(fakeWriter, r)
 	if statuses["S"] != 200 {
@@ -209,7 +208,7 @@ func TestEndpointsAccountGetHandler2(t *testing.T) {
 	require.Nil(t, err)
 	r := httptest.NewRequest("GET", "/endpoints/v2/a", nil)
 	ctx := &middleware.ProxyContext{C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {}}, zap.NewNop())}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = middleware.SetProxyContext(r, ctx)
 	r = srv.SetVars(r, map[string]string{"account": "a"})
 	p.EndpointsAccountGetHandler2(fakeWriter, r)
 	if statuses["S"] != 200 {
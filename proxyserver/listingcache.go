@@ -0,0 +1,126 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package proxyserver
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// cachedListing is a container GET response kept by a listingCache.
+type cachedListing struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// listingCache keeps container listings for a short time so that clients
+// repeatedly listing the same container, like web UIs, don't each go to the
+// container servers.  Writes through this proxy drop the container's
+// listings; writes through other proxies are only seen once the ttl passes.
+type listingCache struct {
+	ttl        time.Duration
+	maxEntries int
+	maxSize    int
+	lock       sync.Mutex
+	entries    int
+	containers map[string]map[string]*cachedListing
+}
+
+func newListingCache(ttl time.Duration, maxEntries, maxSize int) *listingCache {
+	return &listingCache{ttl: ttl, maxEntries: maxEntries, maxSize: maxSize, containers: map[string]map[string]*cachedListing{}}
+}
+
+// listingKey identifies a listing by its query options and the Accept
+// header, which can also choose the format.
+func listingKey(options map[string]string, accept string) string {
+	values := url.Values{}
+	for k, v := range options {
+		values.Set(k, v)
+	}
+	return values.Encode() + "\x00" + accept
+}
+
+func (lc *listingCache) get(account, container, key string) *cachedListing {
+	if lc == nil {
+		return nil
+	}
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	listings := lc.containers[account+"/"+container]
+	listing := listings[key]
+	if listing == nil {
+		return nil
+	}
+	if time.Now().After(listing.expires) {
+		delete(listings, key)
+		lc.entries--
+		return nil
+	}
+	return listing
+}
+
+func (lc *listingCache) set(account, container, key string, header http.Header, body []byte) {
+	if lc == nil || len(body) > lc.maxSize {
+		return
+	}
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	if lc.entries >= lc.maxEntries {
+		lc.expire()
+		if lc.entries >= lc.maxEntries {
+			return
+		}
+	}
+	listings := lc.containers[account+"/"+container]
+	if listings == nil {
+		listings = map[string]*cachedListing{}
+		lc.containers[account+"/"+container] = listings
+	}
+	if listings[key] == nil {
+		lc.entries++
+	}
+	listings[key] = &cachedListing{header: header, body: body, expires: time.Now().Add(lc.ttl)}
+}
+
+// expire drops listings past their ttl; lc.lock must be held.
+func (lc *listingCache) expire() {
+	now := time.Now()
+	for name, listings := range lc.containers {
+		for key, listing := range listings {
+			if now.After(listing.expires) {
+				delete(listings, key)
+				lc.entries--
+			}
+		}
+		if len(listings) == 0 {
+			delete(lc.containers, name)
+		}
+	}
+}
+
+// invalidate drops every listing of the container.
+func (lc *listingCache) invalidate(account, container string) {
+	if lc == nil {
+		return
+	}
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	lc.entries -= len(lc.containers[account+"/"+container])
+	delete(lc.containers, account+"/"+container)
+}
@@ -0,0 +1,55 @@
+package proxyserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListingCache(t *testing.T) {
+	lc := newListingCache(time.Minute, 2, 10)
+	key := listingKey(map[string]string{"prefix": "a", "format": "json"}, "")
+	require.Equal(t, key, listingKey(map[string]string{"format": "json", "prefix": "a"}, ""))
+	require.NotEqual(t, key, listingKey(map[string]string{"format": "json", "prefix": "a"}, "application/xml"))
+
+	require.Nil(t, lc.get("a", "c", key))
+	lc.set("a", "c", key, http.Header{"X-Container-Read": {".r:*"}}, []byte("[]"))
+	listing := lc.get("a", "c", key)
+	require.NotNil(t, listing)
+	require.Equal(t, "[]", string(listing.body))
+	require.Equal(t, ".r:*", listing.header.Get("X-Container-Read"))
+
+	// too big
+	lc.set("a", "c", "big", http.Header{}, []byte("01234567890"))
+	require.Nil(t, lc.get("a", "c", "big"))
+
+	// full
+	lc.set("a", "c2", key, http.Header{}, []byte("[]"))
+	lc.set("a", "c3", key, http.Header{}, []byte("[]"))
+	require.Nil(t, lc.get("a", "c3", key))
+
+	lc.invalidate("a", "c")
+	require.Nil(t, lc.get("a", "c", key))
+	require.NotNil(t, lc.get("a", "c2", key))
+	lc.set("a", "c3", key, http.Header{}, []byte("[]"))
+	require.NotNil(t, lc.get("a", "c3", key))
+}
+
+func TestListingCacheExpires(t *testing.T) {
+	lc := newListingCache(time.Millisecond, 1, 10)
+	lc.set("a", "c", "k", http.Header{}, []byte("[]"))
+	time.Sleep(5 * time.Millisecond)
+	require.Nil(t, lc.get("a", "c", "k"))
+	lc.set("a", "c", "k", http.Header{}, []byte("[]"))
+	time.Sleep(5 * time.Millisecond)
+	// expired entries make room for new ones
+	lc.set("a", "c2", "k", http.Header{}, []byte("[]"))
+	require.NotNil(t, lc.get("a", "c2", "k"))
+
+	var nilCache *listingCache
+	nilCache.set("a", "c", "k", http.Header{}, nil)
+	require.Nil(t, nilCache.get("a", "c", "k"))
+	nilCache.invalidate("a", "c")
+}
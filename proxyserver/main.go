@@ -22,6 +22,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/troubling/hummingbird/client"
 	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/recon"
 	"github.com/troubling/hummingbird/common/ring"
 	"github.com/troubling/hummingbird/common/srv"
 	"github.com/troubling/hummingbird/common/tracing"
@@ -51,12 +53,153 @@ type ProxyServer struct {
 	metricsCloser     io.Closer
 	traceCloser       io.Closer
 	tracer            opentracing.Tracer
+	listingCache      *listingCache
+	constraints       common.Constraints
+	headMetadataOnly  bool
+	allowOpenExpired  bool
+	apiVersions       []string
+	pipelines         map[string][]middleware.Registration
+	dashboard         *recon.Dashboard
+}
+
+// versionedHandler sends requests under each additional API version to that
+// version's pipeline, and everything else to the default one.
+type versionedHandler struct {
+	pipelines map[string]http.Handler
+	dflt      http.Handler
+}
+
+func (v *versionedHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if parts := strings.SplitN(request.URL.Path, "/", 3); len(parts) > 1 {
+		if pipeline, ok := v.pipelines[parts[1]]; ok {
+			pipeline.ServeHTTP(writer, request)
+			return
+		}
+	}
+	v.dflt.ServeHTTP(writer, request)
+}
+
+// parseAPIVersions parses the api_versions setting, a comma separated list of
+// the API prefixes to serve besides v1, such as "v2".
+func parseAPIVersions(setting string) ([]string, error) {
+	var versions []string
+	for _, version := range strings.Split(setting, ",") {
+		version = strings.TrimSpace(version)
+		if version == "" || version == "v1" {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimPrefix(version, "v"), 10, 32); err != nil || !strings.HasPrefix(version, "v") {
+			return nil, fmt.Errorf("Invalid API version %q", version)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// loadConstraints reads the request constraints from [app:proxy-server], where
+// each can be set by the name /info advertises it under.
+func loadConstraints(config conf.Config) (common.Constraints, error) {
+	c := common.DefaultConstraints
+	c.MaxFileSize = config.GetInt("app:proxy-server", "max_file_size", c.MaxFileSize)
+	if c.MaxFileSize <= 0 {
+		return c, fmt.Errorf("Invalid max_file_size %d", c.MaxFileSize)
+	}
+	for _, limit := range []struct {
+		name  string
+		value *int
+		min   int
+	}{
+		{"max_meta_name_length", &c.MaxMetaNameLength, 1},
+		{"max_meta_value_length", &c.MaxMetaValueLength, 1},
+		{"max_meta_count", &c.MaxMetaCount, 0},
+		{"max_meta_overall_size", &c.MaxMetaOverallSize, 0},
+		{"max_header_size", &c.MaxHeaderSize, 1},
+		{"extra_header_count", &c.ExtraHeaderCount, 0},
+	} {
+		v := config.GetInt("app:proxy-server", limit.name, int64(*limit.value))
+		if v < int64(limit.min) {
+			return c, fmt.Errorf("Invalid %s %d", limit.name, v)
+		}
+		*limit.value = int(v)
+	}
+	return c, nil
+}
+
+// pipelineFor returns the middleware for version's pipeline, in order.  The
+// order comes from the pipeline setting in [pipeline:main], or from a
+// [pipeline:main@v2] style section for that version, like Swift's:
+//
+//	pipeline = catch_errors healthcheck proxy-logging tempauth proxy-server
+//
+// Without one, it's every registered middleware in its default position,
+// with tempauth or authtoken and keystoneauth left out according to
+// tempauth_enabled.  A pipeline setting without the gatekeeper gets it added
+// after catch_errors, since nothing else keeps clients from setting sysmeta,
+// and one with tempurl gets tempurl_keys added after the auth middleware, so
+// Temp-URL keys are always checked as they're changed.
+func pipelineFor(config conf.Config, version string) ([]middleware.Registration, error) {
+	section := "pipeline:main"
+	if version != "v1" && config.HasSection(section+"@"+version) {
+		section += "@" + version
+	}
+	var names []string
+	if setting := config.GetDefault(section, "pipeline", ""); setting != "" {
+		names = strings.Fields(setting)
+		if names[len(names)-1] == "proxy-server" {
+			names = names[:len(names)-1]
+		}
+		if !common.StringInSlice("gatekeeper", names) {
+			at := 0
+			if len(names) > 0 && names[0] == "catch_errors" {
+				at = 1
+			}
+			names = append(names[:at], append([]string{"gatekeeper"}, names[at:]...)...)
+		}
+		if common.StringInSlice("tempurl", names) && !common.StringInSlice("tempurl_keys", names) {
+			at := 0
+			for i, name := range names {
+				if name == "tempurl" || name == "tempauth" || name == "authtoken" || name == "keystoneauth" {
+					at = i + 1
+				}
+			}
+			names = append(names[:at], append([]string{"tempurl_keys"}, names[at:]...)...)
+		}
+	} else {
+		skip := map[string]bool{"authtoken": true, "keystoneauth": true}
+		if !config.GetBool("app:proxy-server", "tempauth_enabled", true) {
+			skip = map[string]bool{"tempauth": true}
+		}
+		for _, name := range middleware.DefaultPipeline() {
+			if !skip[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	var regs []middleware.Registration
+	for _, name := range names {
+		reg, ok := middleware.Registered(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown middleware %q in %s pipeline", name, version)
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
 }
 
 func (server *ProxyServer) Type() string {
 	return "proxy"
 }
 
+// Reload applies the settings that can be changed without a restart.
+func (server *ProxyServer) Reload(config conf.Config) ([]string, error) {
+	if changed, err := srv.ReloadLogLevel(server.logLevel, config, "app:proxy-server"); err != nil {
+		return nil, err
+	} else if changed {
+		return []string{"app:proxy-server/log_level"}, nil
+	}
+	return nil, nil
+}
+
 func (server *ProxyServer) Background(flags *flag.FlagSet) chan struct{} {
 	return nil
 }
@@ -71,6 +214,18 @@ func (server *ProxyServer) Finalize() {
 	server.proxyClient.Close()
 }
 
+// checkHeaderCount turns away requests with too many headers.  It's the first
+// thing in every pipeline, so only the headers the client sent are counted.
+func (server *ProxyServer) checkHeaderCount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if status, msg := server.constraints.CheckHeaderCount(request); status != http.StatusOK {
+			srv.SimpleErrorResponse(writer, status, msg)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
 func (server *ProxyServer) GetHandler(config conf.Config, metricsPrefix string) http.Handler {
 	obfuscatedPrefix, _ := config.Get("app:proxy-server", "obfuscated_prefix")
 	var metricsScope tally.Scope
@@ -100,109 +255,81 @@ func (server *ProxyServer) GetHandler(config conf.Config, metricsPrefix string)
 		router.Get(path.Join("/", op, "endpoints/:account/:container/*obj"), http.HandlerFunc(server.EndpointsObjectGetHandler))
 		router.Get(path.Join("/", op, "endpoints/:account/:container"), http.HandlerFunc(server.EndpointsContainerGetHandler))
 		router.Get(path.Join("/", op, "endpoints/:account"), http.HandlerFunc(server.EndpointsAccountGetHandler))
+		if server.dashboard != nil {
+			router.Get(path.Join("/", op, "dashboard"), server.dashboard)
+		}
 	}
-	router.Get("/v1/:account/:container/*obj", http.HandlerFunc(server.ObjectGetHandler))
-	router.Head("/v1/:account/:container/*obj", http.HandlerFunc(server.ObjectHeadHandler))
-	router.Put("/v1/:account/:container/*obj", http.HandlerFunc(server.ObjectPutHandler))
-	router.Delete("/v1/:account/:container/*obj", http.HandlerFunc(server.ObjectDeleteHandler))
-	router.Post("/v1/:account/:container/*obj", http.HandlerFunc(server.ObjectPostHandler))
-	router.Options("/v1/:account/:container/*obj", http.HandlerFunc(server.OptionsHandler))
-
-	router.Get("/v1/:account/:container", http.HandlerFunc(server.ContainerGetHandler))
-	router.Get("/v1/:account/:container/", http.HandlerFunc(server.ContainerGetHandler))
-	router.Head("/v1/:account/:container", http.HandlerFunc(server.ContainerHeadHandler))
-	router.Head("/v1/:account/:container/", http.HandlerFunc(server.ContainerHeadHandler))
-	router.Put("/v1/:account/:container", http.HandlerFunc(server.ContainerPutHandler))
-	router.Put("/v1/:account/:container/", http.HandlerFunc(server.ContainerPutHandler))
-	router.Delete("/v1/:account/:container", http.HandlerFunc(server.ContainerDeleteHandler))
-	router.Delete("/v1/:account/:container/", http.HandlerFunc(server.ContainerDeleteHandler))
-	router.Post("/v1/:account/:container", http.HandlerFunc(server.ContainerPostHandler))
-	router.Post("/v1/:account/:container/", http.HandlerFunc(server.ContainerPostHandler))
-	router.Options("/v1/:account/:container", http.HandlerFunc(server.OptionsHandler))
-	router.Options("/v1/:account/:container/", http.HandlerFunc(server.OptionsHandler))
+	for _, version := range append([]string{"v1"}, server.apiVersions...) {
+		prefix := "/" + version
+		router.Get(prefix+"/:account/:container/*obj", http.HandlerFunc(server.ObjectGetHandler))
+		router.Head(prefix+"/:account/:container/*obj", http.HandlerFunc(server.ObjectHeadHandler))
+		router.Put(prefix+"/:account/:container/*obj", http.HandlerFunc(server.ObjectPutHandler))
+		router.Delete(prefix+"/:account/:container/*obj", http.HandlerFunc(server.ObjectDeleteHandler))
+		router.Post(prefix+"/:account/:container/*obj", http.HandlerFunc(server.ObjectPostHandler))
 
-	router.Get("/v1/:account", http.HandlerFunc(server.AccountGetHandler))
-	router.Get("/v1/:account/", http.HandlerFunc(server.AccountGetHandler))
-	router.Head("/v1/:account", http.HandlerFunc(server.AccountHeadHandler))
-	router.Head("/v1/:account/", http.HandlerFunc(server.AccountHeadHandler))
-	router.Put("/v1/:account", http.HandlerFunc(server.AccountPutHandler))
-	router.Put("/v1/:account/", http.HandlerFunc(server.AccountPutHandler))
-	router.Delete("/v1/:account", http.HandlerFunc(server.AccountDeleteHandler))
-	router.Delete("/v1/:account/", http.HandlerFunc(server.AccountDeleteHandler))
-	router.Post("/v1/:account", http.HandlerFunc(server.AccountPostHandler))
-	router.Post("/v1/:account/", http.HandlerFunc(server.AccountPostHandler))
-	router.Options("/v1/:account", http.HandlerFunc(server.OptionsHandler))
-	router.Options("/v1/:account/", http.HandlerFunc(server.OptionsHandler))
+		router.Get(prefix+"/:account/:container", http.HandlerFunc(server.ContainerGetHandler))
+		router.Get(prefix+"/:account/:container/", http.HandlerFunc(server.ContainerGetHandler))
+		router.Head(prefix+"/:account/:container", http.HandlerFunc(server.ContainerHeadHandler))
+		router.Head(prefix+"/:account/:container/", http.HandlerFunc(server.ContainerHeadHandler))
+		router.Put(prefix+"/:account/:container", http.HandlerFunc(server.ContainerPutHandler))
+		router.Put(prefix+"/:account/:container/", http.HandlerFunc(server.ContainerPutHandler))
+		router.Delete(prefix+"/:account/:container", http.HandlerFunc(server.ContainerDeleteHandler))
+		router.Delete(prefix+"/:account/:container/", http.HandlerFunc(server.ContainerDeleteHandler))
+		router.Post(prefix+"/:account/:container", http.HandlerFunc(server.ContainerPostHandler))
+		router.Post(prefix+"/:account/:container/", http.HandlerFunc(server.ContainerPostHandler))
 
-	tempAuth := config.GetBool("app:proxy-server", "tempauth_enabled", true)
-	var middlewares []struct {
-		construct func(conf.Section, tally.Scope) (func(http.Handler) http.Handler, error)
-		section   string
+		router.Get(prefix+"/:account", http.HandlerFunc(server.AccountGetHandler))
+		router.Get(prefix+"/:account/", http.HandlerFunc(server.AccountGetHandler))
+		router.Head(prefix+"/:account", http.HandlerFunc(server.AccountHeadHandler))
+		router.Head(prefix+"/:account/", http.HandlerFunc(server.AccountHeadHandler))
+		router.Put(prefix+"/:account", http.HandlerFunc(server.AccountPutHandler))
+		router.Put(prefix+"/:account/", http.HandlerFunc(server.AccountPutHandler))
+		router.Delete(prefix+"/:account", http.HandlerFunc(server.AccountDeleteHandler))
+		router.Delete(prefix+"/:account/", http.HandlerFunc(server.AccountDeleteHandler))
+		router.Post(prefix+"/:account", http.HandlerFunc(server.AccountPostHandler))
+		router.Post(prefix+"/:account/", http.HandlerFunc(server.AccountPostHandler))
 	}
-	// TODO: make this all dynamical and stuff
-	if tempAuth {
-		middlewares = []struct {
-			construct func(conf.Section, tally.Scope) (func(http.Handler) http.Handler, error)
-			section   string
-		}{
-			{middleware.NewCatchError, "filter:catch_errors"},
-			{middleware.NewHealthcheck, "filter:healthcheck"},
-			{middleware.NewRequestLogger, "filter:proxy-logging"},
-			{middleware.NewS3Auth, "filter:s3api"},
-			{middleware.NewCrossDomain, "filter:crossdomain"},
-			{middleware.NewCors, "filter:cors"}, // TODO: i dont want to have to have a seciton for this
-			{middleware.NewFormPost, "filter:formpost"},
-			{middleware.NewTempURL, "filter:tempurl"},
-			{middleware.NewTempAuth, "filter:tempauth"},
-			{middleware.NewS3Api, "filter:s3api"},
-			{middleware.NewBulk, "filter:bulk"},
-			{middleware.NewMultirange, "filter:multirange"},
-			{middleware.NewRatelimiter, "filter:ratelimit"},
-			{middleware.NewStaticWeb, "filter:staticweb"},
-			{middleware.NewCopyMiddleware, "filter:copy"},
-			{middleware.NewAccountQuota, "filter:account-quotas"},
-			{middleware.NewContainerQuota, "filter:container-quotas"},
-			{middleware.NewVersionedWrites, "filter:versioned_writes"},
-			{middleware.NewXlo, "filter:slo"},
+
+	// Each API version gets its own pipeline, in the order from
+	// pipelineFor and configured from the usual filter sections except
+	// where a section named like filter:slo@v2 replaces one for that
+	// version.  The v1 pipeline is built last so it's
+	// what the middleware register in /info.
+	buildPipeline := func(version string) http.Handler {
+		debugTiming := config.GetBool("debug", "debug_timing", false)
+		pipeline := alice.New(server.checkHeaderCount, globalmiddleware.ServerTracer(server.tracer), middleware.NewContext(config.GetBool("debug", "debug_x_source_code", false),
+			debugTiming, config.GetBool("app:proxy-server", "normalize_names", false),
+			config.GetBool("app:proxy-server", "allow_client_timestamps", false), server.mc, server.logger, server.proxyClient,
+			server.listingCache.invalidate))
+		for _, m := range server.pipelines[version] {
+			section := m.Section
+			if version != "v1" && config.HasSection(section+"@"+version) {
+				section += "@" + version
+			}
+			mid, err := m.New(config.GetSection(section), metricsScope)
+			if err != nil {
+				// TODO: propagate error upwards instead of panicking
+				panic("Unable to construct middleware")
+			}
+			if debugTiming {
+				name, timed := m.Name, mid
+				mid = func(next http.Handler) http.Handler {
+					return middleware.TimedStage(name, timed(next))
+				}
+			}
+			pipeline = pipeline.Append(mid)
 		}
-	} else {
-		middlewares = []struct {
-			construct func(conf.Section, tally.Scope) (func(http.Handler) http.Handler, error)
-			section   string
-		}{
-			{middleware.NewCatchError, "filter:catch_errors"},
-			{middleware.NewHealthcheck, "filter:healthcheck"},
-			{middleware.NewRequestLogger, "filter:proxy-logging"},
-			{middleware.NewS3Auth, "filter:s3api"},
-			{middleware.NewCrossDomain, "filter:crossdomain"},
-			{middleware.NewCors, "filter:cors"},
-			{middleware.NewFormPost, "filter:formpost"},
-			{middleware.NewTempURL, "filter:tempurl"},
-			{middleware.NewAuthToken, "filter:authtoken"},
-			{middleware.NewS3Api, "filter:s3api"},
-			{middleware.NewKeystoneAuth, "filter:keystoneauth"},
-			{middleware.NewBulk, "filter:bulk"},
-			{middleware.NewMultirange, "filter:multirange"},
-			{middleware.NewRatelimiter, "filter:ratelimit"},
-			{middleware.NewStaticWeb, "filter:staticweb"},
-			{middleware.NewCopyMiddleware, "filter:copy"},
-			{middleware.NewAccountQuota, "filter:account-quotas"},
-			{middleware.NewContainerQuota, "filter:container-quotas"},
-			{middleware.NewVersionedWrites, "filter:versioned_writes"},
-			{middleware.NewXlo, "filter:slo"},
+		if debugTiming {
+			return pipeline.Then(middleware.TimedStage("backend", router))
 		}
+		return pipeline.Then(router)
 	}
-	pipeline := alice.New(globalmiddleware.ServerTracer(server.tracer), middleware.NewContext(config.GetBool("debug", "debug_x_source_code", false),
-		server.mc, server.logger, server.proxyClient))
-	for _, m := range middlewares {
-		mid, err := m.construct(config.GetSection(m.section), metricsScope)
-		if err != nil {
-			// TODO: propagate error upwards instead of panicking
-			panic("Unable to construct middleware")
-		}
-		pipeline = pipeline.Append(mid)
+	handler := &versionedHandler{pipelines: map[string]http.Handler{}}
+	for _, version := range server.apiVersions {
+		handler.pipelines[version] = buildPipeline(version)
 	}
-	return pipeline.Then(router)
+	handler.dflt = buildPipeline("v1")
+	return handler
 }
 
 func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader) (*srv.IpPort, srv.Server, srv.LowLevelLogger, error) {
@@ -226,6 +353,28 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 	server.logLevel = zap.NewAtomicLevel()
 	server.logLevel.UnmarshalText([]byte(strings.ToLower(logLevelString)))
 	server.accountAutoCreate = serverconf.GetBool("app:proxy-server", "account_autocreate", false)
+	if server.constraints, err = loadConstraints(serverconf); err != nil {
+		return ipPort, nil, nil, err
+	}
+	server.headMetadataOnly = serverconf.GetBool("app:proxy-server", "head_metadata_only", false)
+	server.allowOpenExpired = serverconf.GetBool("app:proxy-server", "allow_open_expired", false)
+	if server.apiVersions, err = parseAPIVersions(serverconf.GetDefault("app:proxy-server", "api_versions", "")); err != nil {
+		return ipPort, nil, nil, err
+	}
+	for _, version := range server.apiVersions {
+		middleware.EnableAPIVersion(version)
+	}
+	server.pipelines = map[string][]middleware.Registration{}
+	for _, version := range append([]string{"v1"}, server.apiVersions...) {
+		if server.pipelines[version], err = pipelineFor(serverconf, version); err != nil {
+			return ipPort, nil, nil, err
+		}
+	}
+	if listingCacheTTL := serverconf.GetFloat("app:proxy-server", "listing_cache_ttl", 0); listingCacheTTL > 0 {
+		server.listingCache = newListingCache(time.Duration(listingCacheTTL*float64(time.Second)),
+			int(serverconf.GetInt("app:proxy-server", "listing_cache_max_entries", 1000)),
+			int(serverconf.GetInt("app:proxy-server", "listing_cache_max_size", 256*1024)))
+	}
 	if server.logger, err = srv.SetupLogger("proxy-server", &server.logLevel, flags); err != nil {
 		return ipPort, nil, nil, fmt.Errorf("Error setting up logger: %v", err)
 	}
@@ -240,6 +389,12 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 	if err != nil {
 		return ipPort, nil, nil, err
 	}
+	if serverconf.GetBool("app:proxy-server", "dashboard", false) {
+		refresh := time.Duration(serverconf.GetInt("app:proxy-server", "dashboard_refresh", 60)) * time.Second
+		if server.dashboard, err = recon.NewDashboard(certFile, keyFile, refresh); err != nil {
+			return ipPort, nil, nil, fmt.Errorf("Error setting up dashboard: %v", err)
+		}
+	}
 	server.proxyClient, err = client.NewProxyClient(
 		policies, cnf, server.logger, certFile, keyFile, readAff, writeAff, writeAffCount, serverconf)
 	if err != nil {
@@ -251,10 +406,12 @@ func NewServer(serverconf conf.Config, flags *flag.FlagSet, cnf srv.ConfigLoader
 		"policies":                 policies.GetPolicyInfo(),
 		"account_autocreate":       server.accountAutoCreate,
 		"allow_account_management": true,
+		"allow_open_expired":       server.allowOpenExpired,
 	}
-	for k, v := range common.DEFAULT_CONSTRAINTS {
+	for k, v := range server.constraints.Info() {
 		info[k] = v
 	}
+	info["api_versions"] = append([]string{"v1"}, server.apiVersions...)
 	middleware.RegisterInfo("swift", info)
 	ipPort = &srv.IpPort{Ip: bindIP, Port: int(bindPort), CertFile: certFile, KeyFile: keyFile}
 	return ipPort, server, server.logger, nil
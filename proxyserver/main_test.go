@@ -0,0 +1,136 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func TestParseAPIVersions(t *testing.T) {
+	versions, err := parseAPIVersions("")
+	require.Nil(t, err)
+	require.Empty(t, versions)
+	versions, err = parseAPIVersions("v1, v2,v3")
+	require.Nil(t, err)
+	require.Equal(t, []string{"v2", "v3"}, versions)
+	_, err = parseAPIVersions("v2, beta")
+	require.NotNil(t, err)
+	_, err = parseAPIVersions("2")
+	require.NotNil(t, err)
+}
+
+func TestLoadConstraints(t *testing.T) {
+	config, err := conf.StringConfig("")
+	require.Nil(t, err)
+	c, err := loadConstraints(config)
+	require.Nil(t, err)
+	require.Equal(t, common.DefaultConstraints, c)
+
+	config, err = conf.StringConfig("[app:proxy-server]\nmax_meta_count = 10\nmax_header_size = 1024\nextra_header_count = 5\n")
+	require.Nil(t, err)
+	c, err = loadConstraints(config)
+	require.Nil(t, err)
+	require.Equal(t, 10, c.MaxMetaCount)
+	require.Equal(t, 1024, c.MaxHeaderSize)
+	require.Equal(t, 35, c.MaxHeaderCount())
+	require.Equal(t, 1024, c.Info()["max_header_size"])
+	require.Equal(t, common.MAX_META_NAME_LENGTH, c.MaxMetaNameLength)
+
+	config, err = conf.StringConfig("[app:proxy-server]\nmax_header_size = 0\n")
+	require.Nil(t, err)
+	_, err = loadConstraints(config)
+	require.NotNil(t, err)
+}
+
+func TestCheckHeaderCount(t *testing.T) {
+	server := &ProxyServer{constraints: common.DefaultConstraints}
+	server.constraints.MaxMetaCount = 2
+	h := server.checkHeaderCount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	for i := 0; i < server.constraints.MaxHeaderCount(); i++ {
+		req.Header.Set(fmt.Sprintf("X-Header-%d", i), "X")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+
+	req.Header.Set("X-Another", "X")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestVersionedHandler(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	vh := &versionedHandler{pipelines: map[string]http.Handler{"v2": handler("v2")}, dflt: handler("default")}
+	for path, expected := range map[string]string{
+		"/v1/a/c/o": "default",
+		"/v2/a/c/o": "v2",
+		"/v2":       "v2",
+		"/v2/a":     "v2",
+		"/info":     "default",
+		"/v20/a":    "default",
+	} {
+		w := httptest.NewRecorder()
+		vh.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, expected, w.Body.String(), path)
+	}
+}
+
+func TestPipelineFor(t *testing.T) {
+	names := func(config conf.Config, version string) []string {
+		regs, err := pipelineFor(config, version)
+		require.Nil(t, err)
+		var names []string
+		for _, r := range regs {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+	config, err := conf.StringConfig("")
+	require.Nil(t, err)
+	dflt := names(config, "v1")
+	require.Equal(t, []string{"header_policy", "catch_errors", "gatekeeper"}, dflt[:3])
+	require.Contains(t, dflt, "tempauth")
+	require.NotContains(t, dflt, "keystoneauth")
+
+	config, err = conf.StringConfig("[app:proxy-server]\ntempauth_enabled = false\n")
+	require.Nil(t, err)
+	dflt = names(config, "v1")
+	require.NotContains(t, dflt, "tempauth")
+	require.Contains(t, dflt, "authtoken")
+	require.Contains(t, dflt, "keystoneauth")
+
+	config, err = conf.StringConfig("[pipeline:main]\npipeline = catch_errors healthcheck tempauth proxy-server\n" +
+		"[pipeline:main@v2]\npipeline = healthcheck slo\n")
+	require.Nil(t, err)
+	require.Equal(t, []string{"catch_errors", "gatekeeper", "healthcheck", "tempauth"}, names(config, "v1"))
+	require.Equal(t, []string{"gatekeeper", "healthcheck", "slo"}, names(config, "v2"))
+	require.Equal(t, []string{"catch_errors", "gatekeeper", "healthcheck", "tempauth"}, names(config, "v3"))
+
+	config, err = conf.StringConfig("[pipeline:main]\npipeline = catch_errors healthcheck gatekeeper proxy-server\n")
+	require.Nil(t, err)
+	require.Equal(t, []string{"catch_errors", "healthcheck", "gatekeeper"}, names(config, "v1"))
+
+	config, err = conf.StringConfig("[pipeline:main]\npipeline = catch_errors tempurl tempauth slo proxy-server\n")
+	require.Nil(t, err)
+	require.Equal(t, []string{"catch_errors", "gatekeeper", "tempurl", "tempauth", "tempurl_keys", "slo"}, names(config, "v1"))
+	require.Contains(t, dflt, "tempurl_keys")
+
+	config, err = conf.StringConfig("[pipeline:main]\npipeline = catch_errors nonexistent proxy-server\n")
+	require.Nil(t, err)
+	_, err = pipelineFor(config, "v1")
+	require.NotNil(t, err)
+}
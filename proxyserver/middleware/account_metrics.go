@@ -0,0 +1,203 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+// otherAccounts is the account tag of everything outside the top accounts.
+const otherAccounts = "other"
+
+// accountSketch estimates the heaviest accounts in a stream with a fixed
+// amount of memory, using the Space-Saving algorithm: once it's full, a new
+// account replaces the lightest one and inherits its count.  Accounts
+// heavier than total/capacity are always kept.
+type accountSketch struct {
+	capacity int
+	counts   map[string]int64
+}
+
+func newAccountSketch(capacity int) *accountSketch {
+	return &accountSketch{capacity: capacity, counts: map[string]int64{}}
+}
+
+func (s *accountSketch) add(account string, n int64) {
+	if _, ok := s.counts[account]; !ok && len(s.counts) >= s.capacity {
+		var min int64
+		lightest := ""
+		for a, c := range s.counts {
+			if lightest == "" || c < min {
+				lightest, min = a, c
+			}
+		}
+		delete(s.counts, lightest)
+		s.counts[account] = min
+	}
+	s.counts[account] += n
+}
+
+// top returns the n heaviest accounts.
+func (s *accountSketch) top(n int) []string {
+	accounts := make([]string, 0, len(s.counts))
+	for a, c := range s.counts {
+		if c > 0 {
+			accounts = append(accounts, a)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if s.counts[accounts[i]] != s.counts[accounts[j]] {
+			return s.counts[accounts[i]] > s.counts[accounts[j]]
+		}
+		return accounts[i] < accounts[j]
+	})
+	if len(accounts) > n {
+		accounts = accounts[:n]
+	}
+	return accounts
+}
+
+// accountTop decides which accounts get metrics of their own.  Each interval
+// the top accounts by requests and by bytes are measured; those accounts are
+// reported by name during the next interval and everyone else as "other".
+// Every account name becomes a metrics series that lives as long as the
+// proxy, so after maxAccounts have been named, newcomers stay in "other".
+type accountTop struct {
+	lock        sync.Mutex
+	topN        int
+	maxAccounts int
+	interval    time.Duration
+	started     time.Time
+	requests    *accountSketch
+	bytes       *accountSketch
+	named       map[string]bool
+	counters    map[string]accountCounters
+	numNamed    int
+	scope       tally.Scope
+}
+
+type accountCounters struct {
+	requests tally.Counter
+	bytes    tally.Counter
+}
+
+func newAccountTop(topN, maxAccounts int, interval time.Duration, scope tally.Scope) *accountTop {
+	return &accountTop{
+		topN:        topN,
+		maxAccounts: maxAccounts,
+		interval:    interval,
+		started:     time.Now(),
+		requests:    newAccountSketch(topN * 10),
+		bytes:       newAccountSketch(topN * 10),
+		named:       map[string]bool{},
+		counters:    map[string]accountCounters{},
+		scope:       scope,
+	}
+}
+
+func (t *accountTop) record(account string, bytes int64) {
+	t.lock.Lock()
+	if now := time.Now(); now.Sub(t.started) >= t.interval {
+		t.named = map[string]bool{}
+		for _, a := range append(t.requests.top(t.topN), t.bytes.top(t.topN)...) {
+			t.named[a] = true
+		}
+		t.requests = newAccountSketch(t.topN * 10)
+		t.bytes = newAccountSketch(t.topN * 10)
+		t.started = now
+	}
+	t.requests.add(account, 1)
+	t.bytes.add(account, bytes)
+	tag := otherAccounts
+	if t.named[account] {
+		tag = account
+	}
+	counters, ok := t.counters[tag]
+	if !ok && tag != otherAccounts && t.numNamed >= t.maxAccounts {
+		tag = otherAccounts
+		counters, ok = t.counters[tag]
+	}
+	if !ok {
+		scope := t.scope.Tagged(map[string]string{"account": tag})
+		counters = accountCounters{requests: scope.Counter("account_requests"), bytes: scope.Counter("account_bytes")}
+		t.counters[tag] = counters
+		if tag != otherAccounts {
+			t.numNamed++
+		}
+	}
+	t.lock.Unlock()
+	counters.requests.Inc(1)
+	counters.bytes.Inc(bytes)
+}
+
+type accountMetrics struct {
+	next http.Handler
+	top  *accountTop
+}
+
+func (a *accountMetrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiRequest, account, _, _ := getPathParts(request)
+	if ctx := GetProxyContext(request); !apiRequest || account == "" || (ctx != nil && ctx.Source != "") {
+		a.next.ServeHTTP(writer, request)
+		return
+	}
+	newWriter := &srv.WebWriter{ResponseWriter: writer, Status: 500}
+	var newReader *srv.CountingReadCloser
+	if request.Body != nil {
+		newReader = &srv.CountingReadCloser{ReadCloser: request.Body}
+		request.Body = newReader
+	}
+	a.next.ServeHTTP(newWriter, request)
+	bytes := int64(newWriter.ByteCount)
+	if newReader != nil {
+		bytes += int64(newReader.ByteCount)
+	}
+	a.top.record(account, bytes)
+}
+
+func init() {
+	Register(Registration{Name: "account_metrics", Position: 140, New: NewAccountMetrics})
+}
+
+// NewAccountMetrics returns the account metrics middleware, which counts
+// requests and bytes transferred per account as the account_requests and
+// account_bytes metrics, tagged with the account.  To keep the number of
+// series bounded only the top_accounts busiest accounts of each interval
+// are tagged by name; the rest are counted together as "other".
+func NewAccountMetrics(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	topN := int(config.GetInt("top_accounts", 10))
+	if topN < 1 {
+		topN = 1
+	}
+	maxAccounts := int(config.GetInt("max_accounts", int64(topN*10)))
+	interval := time.Duration(config.GetFloat("interval", 60) * float64(time.Second))
+	top := newAccountTop(topN, maxAccounts, interval, metricsScope)
+	return func(next http.Handler) http.Handler {
+		return &accountMetrics{next: next, top: top}
+	}, nil
+}
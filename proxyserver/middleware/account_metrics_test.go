@@ -0,0 +1,86 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// accountCounts returns the value of the named counter for each account tag.
+func accountCounts(scope tally.TestScope, name string) map[string]int64 {
+	counts := map[string]int64{}
+	for _, c := range scope.Snapshot().Counters() {
+		if c.Name() == name {
+			counts[c.Tags()["account"]] = c.Value()
+		}
+	}
+	return counts
+}
+
+func TestAccountSketch(t *testing.T) {
+	s := newAccountSketch(3)
+	for i := 0; i < 10; i++ {
+		s.add("heavy", 1)
+	}
+	for i := 0; i < 6; i++ {
+		s.add(fmt.Sprintf("light%d", i), 1)
+	}
+	s.add("medium", 5)
+	require.Equal(t, 3, len(s.counts))
+	require.Equal(t, []string{"heavy"}, s.top(1))
+}
+
+func TestAccountMetrics(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	top := newAccountTop(1, 2, time.Hour, scope)
+	handler := &accountMetrics{top: top, next: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ioutil.ReadAll(request.Body)
+		writer.Write([]byte("hello"))
+	})}
+	do := func(path, body string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", path, strings.NewReader(body)))
+	}
+
+	// Until the first interval is over, nobody's known to be busy.
+	do("/v1/AUTH_a/c/o", "12345")
+	do("/v1/AUTH_a/c/o", "")
+	do("/v1/AUTH_b/c", "")
+	do("/info", "")
+	require.Equal(t, map[string]int64{"other": 3}, accountCounts(scope, "account_requests"))
+	require.Equal(t, map[string]int64{"other": 20}, accountCounts(scope, "account_bytes"))
+
+	top.started = time.Now().Add(-2 * time.Hour)
+	do("/v1/AUTH_a/c/o", "")
+	do("/v1/AUTH_b/c/o", "")
+	require.Equal(t, map[string]int64{"other": 4, "AUTH_a": 1}, accountCounts(scope, "account_requests"))
+
+	// The number of named accounts is capped.
+	top.requests.add("AUTH_b", 10)
+	top.bytes.add("AUTH_c", 1000)
+	top.started = time.Now().Add(-2 * time.Hour)
+	do("/v1/AUTH_b/c/o", "")
+	do("/v1/AUTH_c/c/o", "")
+	require.Equal(t, map[string]int64{"other": 5, "AUTH_a": 1, "AUTH_b": 1}, accountCounts(scope, "account_requests"))
+}
@@ -91,6 +91,10 @@ func accountQuota(metric tally.Counter) func(http.Handler) http.Handler {
 	}
 }
 
+func init() {
+	Register(Registration{Name: "account-quotas", Position: 260, New: NewAccountQuota})
+}
+
 func NewAccountQuota(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("account_quotas", map[string]interface{}{})
 	return accountQuota(metricsScope.Counter("account_quotas")), nil
@@ -50,7 +50,7 @@ func TestAccountQuotaBytes(t *testing.T) {
 
 	req, err := http.NewRequest("PUT", "/v1/a/c/o", strings.NewReader("MORETHAN3"))
 	require.Nil(t, err)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, req)
@@ -69,7 +69,7 @@ func TestBadAccountQuotaBytes(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/v1/a", nil)
 	require.Nil(t, err)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	req.Header.Set("X-Account-Meta-Quota-Bytes", "wharrgarbl")
 
 	w := httptest.NewRecorder()
@@ -113,6 +113,9 @@ func ReferrerAllowed(referrer string, referrerACL []string) bool {
 func AuthorizeUnconfirmedIdentity(r *http.Request, obj string, referrers []string, roles []string) (bool, error) {
 	if ReferrerAllowed(r.Referer(), referrers) {
 		if obj != "" || common.StringInSlice(".rlistings", roles) {
+			if ctx := GetProxyContext(r); ctx != nil {
+				ctx.ReferrerOnly = true
+			}
 			return true, nil
 		}
 		return false, nil
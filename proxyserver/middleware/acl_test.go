@@ -16,6 +16,7 @@
 package middleware
 
 import (
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -137,3 +138,14 @@ func TestReferrerAllowed(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthorizeUnconfirmedIdentityReferrerOnly(t *testing.T) {
+	ctx := &ProxyContext{}
+	r := SetProxyContext(httptest.NewRequest("GET", "/v1/a/c", nil), ctx)
+	ok, _ := AuthorizeUnconfirmedIdentity(r, "", []string{"*"}, []string{})
+	assert.False(t, ok)
+	assert.False(t, ctx.ReferrerOnly)
+	ok, _ = AuthorizeUnconfirmedIdentity(r, "", []string{"*"}, []string{".rlistings"})
+	assert.True(t, ok)
+	assert.True(t, ctx.ReferrerOnly)
+}
@@ -0,0 +1,176 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/uber-go/tally"
+)
+
+// authDecision is an authorize result kept by an authDecisionCache, along
+// with what the authorize func set in the ProxyContext while deciding.
+type authDecision struct {
+	key          string
+	container    string
+	ok           bool
+	status       int
+	storageOwner bool
+	referrerOnly bool
+	expires      time.Time
+}
+
+// authDecisionCache keeps an auth middleware's recent authorize results, so
+// a burst of requests from the same client doesn't work through the same
+// ACL and group rules for each one.  Decisions are kept for the identity the
+// auth middleware found, the method, the account and container, whether
+// it's an object request, the Referer and the container's ACL; a changed ACL
+// won't match the old decisions, and an ACL change passing through drops the
+// container's decisions outright.  Least recently used decisions go first
+// once there are maxEntries.
+type authDecisionCache struct {
+	ttl        time.Duration
+	maxEntries int
+	lock       sync.Mutex
+	used       *list.List
+	entries    map[string]*list.Element
+	hits       tally.Counter
+	misses     tally.Counter
+}
+
+// newAuthDecisionCache returns the cache configured by the auth_cache_ttl and
+// auth_cache_max_entries settings, or nil if auth_cache_ttl isn't set.
+func newAuthDecisionCache(name string, config conf.Section, metricsScope tally.Scope) *authDecisionCache {
+	ttl := config.GetFloat("auth_cache_ttl", 0)
+	if ttl <= 0 {
+		return nil
+	}
+	return &authDecisionCache{
+		ttl:        time.Duration(ttl * float64(time.Second)),
+		maxEntries: int(config.GetInt("auth_cache_max_entries", 10000)),
+		used:       list.New(),
+		entries:    map[string]*list.Element{},
+		hits:       metricsScope.Counter(name + "_auth_cache_hits"),
+		misses:     metricsScope.Counter(name + "_auth_cache_misses"),
+	}
+}
+
+func (c *authDecisionCache) get(key string) *authDecision {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem := c.entries[key]
+	if elem == nil {
+		return nil
+	}
+	d := elem.Value.(*authDecision)
+	if time.Now().After(d.expires) {
+		c.used.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+	c.used.MoveToBack(elem)
+	return d
+}
+
+func (c *authDecisionCache) set(d *authDecision) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem := c.entries[d.key]; elem != nil {
+		c.used.Remove(elem)
+	}
+	for len(c.entries) >= c.maxEntries && c.used.Len() > 0 {
+		oldest := c.used.Front()
+		c.used.Remove(oldest)
+		delete(c.entries, oldest.Value.(*authDecision).key)
+	}
+	c.entries[d.key] = c.used.PushBack(d)
+}
+
+// invalidate drops every decision made about the container.
+func (c *authDecisionCache) invalidate(account, container string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for elem := c.used.Front(); elem != nil; {
+		next := elem.Next()
+		if d := elem.Value.(*authDecision); d.container == account+"/"+container {
+			c.used.Remove(elem)
+			delete(c.entries, d.key)
+		}
+		elem = next
+	}
+}
+
+// watch drops the decisions about a container whose ACLs the request may
+// change.
+func (c *authDecisionCache) watch(r *http.Request) {
+	if c == nil {
+		return
+	}
+	pathParts, err := common.ParseProxyPath(r.URL.Path)
+	if err != nil || pathParts["container"] == "" || pathParts["object"] != "" {
+		return
+	}
+	if r.Method == "DELETE" || ((r.Method == "PUT" || r.Method == "POST") &&
+		(r.Header.Get("X-Container-Read") != "" || r.Header.Get("X-Container-Write") != "")) {
+		c.invalidate(pathParts["account"], pathParts["container"])
+	}
+}
+
+// wrap returns authorize, with its decisions for identity cached.  The
+// identity must be everything the auth middleware set the ProxyContext's
+// RemoteUsers from, like the tokens the request came with.
+func (c *authDecisionCache) wrap(identity string, authorize AuthorizeFunc) AuthorizeFunc {
+	if c == nil || identity == "" {
+		return authorize
+	}
+	return func(r *http.Request) (bool, int) {
+		ctx := GetProxyContext(r)
+		pathParts, err := common.ParseProxyPath(r.URL.Path)
+		if ctx == nil || err != nil {
+			return authorize(r)
+		}
+		container := pathParts["account"] + "/" + pathParts["container"]
+		scope := "container"
+		if pathParts["object"] != "" {
+			scope = "object"
+		}
+		key := strings.Join([]string{identity, r.Method, container, scope, r.Referer(), ctx.ACL}, "\x00")
+		if d := c.get(key); d != nil {
+			c.hits.Inc(1)
+			ctx.StorageOwner = ctx.StorageOwner || d.storageOwner
+			ctx.ReferrerOnly = ctx.ReferrerOnly || d.referrerOnly
+			return d.ok, d.status
+		}
+		c.misses.Inc(1)
+		ok, status := authorize(r)
+		c.set(&authDecision{
+			key:          key,
+			container:    container,
+			ok:           ok,
+			status:       status,
+			storageOwner: ctx.StorageOwner,
+			referrerOnly: ctx.ReferrerOnly,
+			expires:      time.Now().Add(c.ttl),
+		})
+		return ok, status
+	}
+}
@@ -0,0 +1,79 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func TestAuthDecisionCacheDisabled(t *testing.T) {
+	require.Nil(t, newAuthDecisionCache("test", conf.Section{}, common.NewTestScope()))
+	var c *authDecisionCache
+	c.watch(httptest.NewRequest("DELETE", "/v1/a/c", nil))
+}
+
+func TestAuthDecisionCache(t *testing.T) {
+	config, err := conf.StringConfig("[filter:tempauth]\nauth_cache_ttl = 60\nauth_cache_max_entries = 2\n")
+	require.Nil(t, err)
+	c := newAuthDecisionCache("test", config.GetSection("filter:tempauth"), common.NewTestScope())
+	require.NotNil(t, c)
+	calls := 0
+	authorize := c.wrap("token", func(r *http.Request) (bool, int) {
+		calls++
+		GetProxyContext(r).StorageOwner = true
+		return true, http.StatusOK
+	})
+	do := func(method, path, acl string) *ProxyContext {
+		ctx := &ProxyContext{ProxyContextMiddleware: &ProxyContextMiddleware{}, ACL: acl}
+		ok, status := authorize(SetProxyContext(httptest.NewRequest(method, path, nil), ctx))
+		require.True(t, ok)
+		require.Equal(t, http.StatusOK, status)
+		return ctx
+	}
+
+	require.True(t, do("GET", "/v1/a/c/o", "").StorageOwner)
+	require.True(t, do("GET", "/v1/a/c/o2", "").StorageOwner)
+	require.Equal(t, 1, calls)
+	do("PUT", "/v1/a/c/o", "")
+	require.Equal(t, 2, calls)
+	do("GET", "/v1/a/c/o", ".r:*")
+	require.Equal(t, 3, calls)
+
+	// only two are kept, and GET with no ACL was used least recently
+	do("GET", "/v1/a/c/o", "")
+	require.Equal(t, 4, calls)
+
+	c.watch(httptest.NewRequest("POST", "/v1/a/c", nil))
+	do("GET", "/v1/a/c/o", "")
+	require.Equal(t, 4, calls)
+	r := httptest.NewRequest("POST", "/v1/a/c", nil)
+	r.Header.Set("X-Container-Read", ".r:*")
+	c.watch(r)
+	do("GET", "/v1/a/c/o", "")
+	require.Equal(t, 5, calls)
+
+	c.ttl = -time.Second
+	do("HEAD", "/v1/a/c/o", "")
+	do("HEAD", "/v1/a/c/o", "")
+	require.Equal(t, 7, calls)
+}
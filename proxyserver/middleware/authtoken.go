@@ -46,6 +46,53 @@ type identity struct {
 	userName        string
 	password        string
 	userAgent       string
+	// appCredID or appCredName, the latter with userName and userDomainID,
+	// along with appCredSecret identify the Keystone application credential
+	// to authenticate with when authPlugin is application_credential.
+	appCredID     string
+	appCredName   string
+	appCredSecret string
+}
+
+// newIdentity reads the settings for authenticating with Keystone that the
+// authtoken middleware and the barbican keymaster share.
+func newIdentity(section conf.Section, client common.HTTPClient) *identity {
+	return &identity{authURL: section.GetDefault("auth_uri", "http://127.0.0.1:5000/"),
+		authPlugin:      section.GetDefault("auth_plugin", "password"),
+		projectDomainID: section.GetDefault("project_domain_id", "default"),
+		userDomainID:    section.GetDefault("user_domain_id", "default"),
+		projectName:     section.GetDefault("project_name", "service"),
+		userName:        section.GetDefault("username", "swift"),
+		password:        section.GetDefault("password", "password"),
+		userAgent:       section.GetDefault("user_agent", "hummingbird-keystone-middleware/1.0"),
+		appCredID:       section.GetDefault("application_credential_id", ""),
+		appCredName:     section.GetDefault("application_credential_name", ""),
+		appCredSecret:   section.GetDefault("application_credential_secret", ""),
+		client:          client}
+}
+
+// authRequest returns the request for a token for the identity itself.  An
+// application credential is already scoped to its project, so no scope is
+// asked for with one; otherwise the user's password is used to get a token
+// scoped to the configured project.
+func (i *identity) authRequest() *identityReq {
+	authReq := &identityReq{}
+	if i.authPlugin == "application_credential" || i.authPlugin == "v3applicationcredential" {
+		authReq.Auth.Identity.Methods = []string{"application_credential"}
+		appCred := &applicationCredentialIdentity{ID: i.appCredID, Secret: i.appCredSecret}
+		if appCred.ID == "" {
+			appCred.Name = i.appCredName
+			appCred.User = &identityUser{Name: i.userName}
+			appCred.User.Domain.ID = i.userDomainID
+		}
+		authReq.Auth.Identity.ApplicationCredential = appCred
+		return authReq
+	}
+	authReq.Auth.Identity.Methods = []string{i.authPlugin}
+	authReq.Auth.Identity.Password = &passwordIdentity{User: identityUser{Name: i.userName, Password: i.password}}
+	authReq.Auth.Identity.Password.User.Domain.ID = i.userDomainID
+	authReq.Auth.Scope = &identityScope{Project: &project{Domain: &domain{ID: i.projectDomainID}, Name: i.projectName}}
+	return authReq
 }
 
 type authToken struct {
@@ -170,24 +217,38 @@ func (t token) populateReqHeader(r *http.Request, headerPrefix string) {
 	}
 }
 
+type identityUser struct {
+	Domain struct {
+		ID string `json:"id"`
+	} `json:"domain"`
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+}
+
+type passwordIdentity struct {
+	User identityUser `json:"user"`
+}
+
+type applicationCredentialIdentity struct {
+	ID     string        `json:"id,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Secret string        `json:"secret"`
+	User   *identityUser `json:"user,omitempty"`
+}
+
+type identityScope struct {
+	Project *project `json:"project"`
+}
+
 type identityReq struct {
 	Auth struct {
 		Identity struct {
-			Methods  []string `json:"methods"`
-			Password struct {
-				User struct {
-					Domain struct {
-						ID string `json:"id"`
-					} `json:"domain"`
-					Name     string `json:"name"`
-					Password string `json:"password"`
-				} `json:"user"`
-			} `json:"password"`
+			Methods               []string                       `json:"methods"`
+			Password              *passwordIdentity              `json:"password,omitempty"`
+			ApplicationCredential *applicationCredentialIdentity `json:"application_credential,omitempty"`
 		} `json:"identity"`
 
-		Scope struct {
-			Project *project `json:"project"`
-		} `json:"scope"`
+		Scope *identityScope `json:"scope,omitempty"`
 	} `json:"auth"`
 }
 
@@ -317,8 +378,10 @@ func (at *authToken) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (at *authToken) validateS3Signature(ctx context.Context, proxyCtx *ProxyContext) (*token, bool) {
 	// Check for a cached token
+	// A cached validation is only any use with the secret to check the
+	// request's signature against.
 	cachedToken := at.loadTokenFromCache(ctx, proxyCtx, "S3:"+proxyCtx.S3Auth.Key)
-	if cachedToken != nil {
+	if cachedToken != nil && cachedToken.S3Creds != nil && cachedToken.Project != nil {
 		proxyCtx.S3Auth.Account = cachedToken.Project.ID
 		return cachedToken, proxyCtx.S3Auth.validateSignature([]byte(cachedToken.S3Creds.Secret))
 	}
@@ -534,13 +597,7 @@ func (at *authToken) serverAuth(ctx context.Context, proxyCtx *ProxyContext, fre
 			}
 		}
 	}
-	authReq := &identityReq{}
-	authReq.Auth.Identity.Methods = []string{at.authPlugin}
-	authReq.Auth.Identity.Password.User.Domain.ID = at.userDomainID
-	authReq.Auth.Identity.Password.User.Name = at.userName
-	authReq.Auth.Identity.Password.User.Password = at.password
-	authReq.Auth.Scope.Project = &project{Domain: &domain{ID: at.projectDomainID}, Name: at.projectName}
-	authReqBody, err := json.Marshal(authReq)
+	authReqBody, err := json.Marshal(at.authRequest())
 	if err != nil {
 		return "", err
 	}
@@ -570,6 +627,10 @@ func removeAuthHeaders(r *http.Request) {
 	}
 }
 
+func init() {
+	Register(Registration{Name: "authtoken", Position: 115, New: NewAuthToken})
+}
+
 func NewAuthToken(section conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	return func(next http.Handler) http.Handler {
 		tokenCacheDur := time.Duration(int(section.GetInt("token_cache_time", 300))) * time.Second
@@ -581,15 +642,7 @@ func NewAuthToken(section conf.Section, metricsScope tally.Scope) (func(http.Han
 			cacheDur:       tokenCacheDur,
 			preValidateDur: (tokenCacheDur / 10),
 			preValidations: make(map[string]bool),
-			identity: &identity{authURL: section.GetDefault("auth_uri", "http://127.0.0.1:5000/"),
-				authPlugin:      section.GetDefault("auth_plugin", "password"),
-				projectDomainID: section.GetDefault("project_domain_id", "default"),
-				userDomainID:    section.GetDefault("user_domain_id", "default"),
-				projectName:     section.GetDefault("project_name", "service"),
-				userName:        section.GetDefault("username", "swift"),
-				password:        section.GetDefault("password", "password"),
-				userAgent:       section.GetDefault("user_agent", "hummingbird-keystone-middleware/1.0"),
-				client:          c},
+			identity:       newIdentity(section, c),
 		}
 		if section.GetConfig().HasSection("tracing") {
 			clientTracer, _, err := tracing.Init("proxy-keystone-client", zap.NewNop(), section.GetConfig().GetSection("tracing"))
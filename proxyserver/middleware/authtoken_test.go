@@ -32,6 +32,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 
+	"github.com/troubling/hummingbird/common/conf"
 	"github.com/troubling/hummingbird/common/test"
 )
 
@@ -74,7 +75,7 @@ func TestSpoofBlock(t *testing.T) {
 	req.Header.Add("X-Project-Name", "value")
 	req.Header.Add("X-Domain-Id", "142")
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	passthrough := checkHeaders(t, map[string]string{
 		"X-Identity-Status": "Invalid",
@@ -97,7 +98,7 @@ func TestNoToken(t *testing.T) {
 	req, err := http.NewRequest("GET", "/someurl", nil)
 	require.Nil(t, err)
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	passthrough := checkHeaders(t, map[string]string{
 		"X-Identity-Status": "Invalid",
@@ -193,7 +194,7 @@ func TestExpiredToken(t *testing.T) {
 	req, err := http.NewRequest("GET", "/someurl", nil)
 	require.Nil(t, err)
 	req.Header.Set("X-Auth-Token", "abcd")
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	identityServ := fakeIdentityServer(201, 200, `
 	{
     "token": {
@@ -264,7 +265,7 @@ func TestUnscopedToken(t *testing.T) {
 	req, err := http.NewRequest("GET", "/someurl", nil)
 	require.Nil(t, err)
 	req.Header.Set("X-Auth-Token", "abcd")
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	identityServ := fakeIdentityServer(201, 200, `
 	{
     "token": {
@@ -336,7 +337,7 @@ func TestProjectScopedToken(t *testing.T) {
 	req, err := http.NewRequest("GET", "/someurl", nil)
 	require.Nil(t, err)
 	req.Header.Set("X-Auth-Token", "abcd")
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	identityServ := fakeIdentityServer(201, 200, `
 	{
     "token": {
@@ -410,7 +411,7 @@ func TestDomainScopedToken(t *testing.T) {
 	req, err := http.NewRequest("GET", "/someurl", nil)
 	require.Nil(t, err)
 	req.Header.Set("X-Auth-Token", "abcd")
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	identityServ := fakeIdentityServer(201, 200, `
 	{
   "token": {
@@ -475,7 +476,7 @@ func TestGetCachedToken(t *testing.T) {
 		ProxyContextMiddleware: &ProxyContextMiddleware{Cache: &fakeCache},
 	}
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	passthrough := checkHeaders(t, map[string]string{
 		"X-Identity-Status": "Confirmed",
@@ -502,7 +503,7 @@ func TestWriteCachedToken(t *testing.T) {
 		Logger:                 zap.NewNop(),
 		ProxyContextMiddleware: &ProxyContextMiddleware{Cache: &fakeCache},
 	}
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	expectedExpiry := time.Now().Add(5 * time.Second).Round(time.Second)
 	identityServ := fakeIdentityServer(201, 200, fmt.Sprintf(`
 {
@@ -558,7 +559,7 @@ func TestPreauthCachedToken(t *testing.T) {
 		Logger:                 zap.NewNop(),
 		ProxyContextMiddleware: &ProxyContextMiddleware{Cache: &fakeCache},
 	}
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	identityServ := fakeIdentityServer(201, 200, fmt.Sprintf(`
 {
   "token": {
@@ -596,3 +597,39 @@ func TestPreauthCachedToken(t *testing.T) {
 		t.Fatalf("cached token ttl didn't get updated: %v", timeout)
 	}
 }
+
+func TestServerAuthApplicationCredential(t *testing.T) {
+	var body map[string]interface{}
+	identityServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("X-Subject-Token", "servertoken")
+		w.WriteHeader(201)
+	}))
+	defer identityServ.Close()
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:authtoken]\nauth_uri = %s/\nauth_plugin = v3applicationcredential\napplication_credential_id = appcredid\napplication_credential_secret = appcredsecret\n", identityServ.URL))
+	require.Nil(t, err)
+	at := &authToken{identity: newIdentity(config.GetSection("filter:authtoken"), http.DefaultClient)}
+	tok, err := at.serverAuth(context.Background(), newFakeProxyContext(), true)
+	require.Nil(t, err)
+	require.Equal(t, "servertoken", tok)
+	auth := body["auth"].(map[string]interface{})
+	require.Nil(t, auth["scope"])
+	ident := auth["identity"].(map[string]interface{})
+	require.Equal(t, []interface{}{"application_credential"}, ident["methods"])
+	require.Nil(t, ident["password"])
+	require.Equal(t, map[string]interface{}{"id": "appcredid", "secret": "appcredsecret"}, ident["application_credential"])
+}
+
+func TestIdentityAuthRequest(t *testing.T) {
+	config, err := conf.StringConfig("[filter:authtoken]\nusername = automation\nuser_domain_id = users\napplication_credential_name = backups\napplication_credential_secret = s3cr3t\nauth_plugin = application_credential\n")
+	require.Nil(t, err)
+	b, err := json.Marshal(newIdentity(config.GetSection("filter:authtoken"), http.DefaultClient).authRequest())
+	require.Nil(t, err)
+	require.Equal(t, `{"auth":{"identity":{"methods":["application_credential"],"application_credential":{"name":"backups","secret":"s3cr3t","user":{"domain":{"id":"users"},"name":"automation"}}}}}`, string(b))
+
+	config, err = conf.StringConfig("[filter:authtoken]\nusername = swift\npassword = pass\n")
+	require.Nil(t, err)
+	b, err = json.Marshal(newIdentity(config.GetSection("filter:authtoken"), http.DefaultClient).authRequest())
+	require.Nil(t, err)
+	require.Equal(t, `{"auth":{"identity":{"methods":["password"],"password":{"user":{"domain":{"id":"default"},"name":"swift","password":"pass"}}},"scope":{"project":{"name":"service","domain":{"id":"default"}}}}}`, string(b))
+}
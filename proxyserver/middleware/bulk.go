@@ -11,7 +11,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
 	"path"
 	"strconv"
@@ -24,6 +23,10 @@ import (
 	"go.uber.org/zap"
 )
 
+func init() {
+	Register(Registration{Name: "bulk", Position: 180, New: NewBulk})
+}
+
 func NewBulk(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	yieldFrequency := time.Duration(time.Duration(config.GetInt("yield_frequency", 10)) * time.Second) // for yielding prepending whitespace to keep a client response alive
 	maxContainersPerExtraction := int(config.GetInt("max_containers_per_extraction", 10000))
@@ -166,12 +169,11 @@ func (b *bulkPut) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 			if err != nil {
 				failures = append(failures, []string{containerPath, httpStatusString(http.StatusInternalServerError)})
 			} else {
-				subrec := httptest.NewRecorder()
+				subrec := newSpoolWriter()
 				ctx.serveHTTPSubrequest(subrec, subreq)
-				subresp := subrec.Result()
-				subresp.Body.Close()
-				if subresp.StatusCode/100 != 2 {
-					failures = append(failures, []string{containerPath, httpStatusString(subresp.StatusCode)})
+				subrec.Close()
+				if subrec.status/100 != 2 {
+					failures = append(failures, []string{containerPath, httpStatusString(subrec.status)})
 				}
 			}
 		}
@@ -187,16 +189,15 @@ func (b *bulkPut) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		for k := range header {
 			subreq.Header.Set(k, header.Get(k))
 		}
-		subrec := httptest.NewRecorder()
+		subrec := newSpoolWriter()
 		ctx.serveHTTPSubrequest(subrec, subreq)
-		subresp := subrec.Result()
-		subresp.Body.Close()
-		if subresp.StatusCode/100 == 5 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		subrec.Close()
+		if subrec.status/100 == 5 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 			failureResponseType = http.StatusBadGateway
 			return
-		} else if subresp.StatusCode/100 != 2 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		} else if subrec.status/100 != 2 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 			return
 		}
 		numberFilesCreated++
@@ -363,17 +364,16 @@ func (b *bulkDelete) ServeHTTP(writer http.ResponseWriter, request *http.Request
 			failures = append(failures, []string{subpath, httpStatusString(http.StatusInternalServerError)})
 			return
 		}
-		subrec := httptest.NewRecorder()
+		subrec := newSpoolWriter()
 		ctx.serveHTTPSubrequest(subrec, subreq)
-		subresp := subrec.Result()
-		subresp.Body.Close()
-		if subresp.StatusCode/100 == 5 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		subrec.Close()
+		if subrec.status/100 == 5 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 			failureResponseType = http.StatusBadGateway
-		} else if subresp.StatusCode == http.StatusNotFound {
+		} else if subrec.status == http.StatusNotFound {
 			numberNotFound++
-		} else if subresp.StatusCode/100 != 2 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		} else if subrec.status/100 != 2 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 		} else {
 			numberDeleted++
 		}
@@ -391,17 +391,16 @@ func (b *bulkDelete) ServeHTTP(writer http.ResponseWriter, request *http.Request
 			failures = append(failures, []string{subpath, httpStatusString(http.StatusInternalServerError)})
 			return
 		}
-		subrec := httptest.NewRecorder()
+		subrec := newSpoolWriter()
 		ctx.serveHTTPSubrequest(subrec, subreq)
-		subresp := subrec.Result()
-		subresp.Body.Close()
-		if subresp.StatusCode/100 == 5 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		subrec.Close()
+		if subrec.status/100 == 5 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 			failureResponseType = http.StatusBadGateway
-		} else if subresp.StatusCode == http.StatusNotFound {
+		} else if subrec.status == http.StatusNotFound {
 			numberNotFound++
-		} else if subresp.StatusCode/100 != 2 {
-			failures = append(failures, []string{subpath, httpStatusString(subresp.StatusCode)})
+		} else if subrec.status/100 != 2 {
+			failures = append(failures, []string{subpath, httpStatusString(subrec.status)})
 		} else {
 			numberDeleted++
 		}
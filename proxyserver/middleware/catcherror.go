@@ -17,6 +17,8 @@ package middleware
 
 import (
 	"net/http"
+	"runtime/debug"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -25,20 +27,39 @@ import (
 	"github.com/uber-go/tally"
 )
 
+// Recover is deferred to catch a panic in a request's handlers.  It logs the
+// panic and its stack trace with the request's transaction id and, if no
+// response has been started, sends a 500 that carries the X-Trans-Id so the
+// user has something to report that the logs can be searched for.
 func Recover(w http.ResponseWriter, r *http.Request, msg string, recoversMetric tally.Counter) {
 	if err := recover(); err != nil {
+		if err == http.ErrAbortHandler {
+			// the handler meant to abort the response; net/http handles it.
+			panic(err)
+		}
 		transactionId := r.Header.Get("X-Trans-Id")
+		logger := zap.L()
+		started := time.Time{}
 		if ctx := GetProxyContext(r); ctx != nil {
-			ctx.Logger.Error(msg, zap.Any("err", err), zap.String("txn", transactionId))
-			recoversMetric.Inc(1)
-			// if we haven't set a status code yet, we can send a 500 response.
-			if started, _ := ctx.Response(); started.IsZero() {
-				srv.StandardResponse(w, http.StatusInternalServerError)
+			logger = ctx.Logger
+			started, _ = ctx.Response()
+		}
+		logger.Error(msg, zap.Any("err", err), zap.String("txn", transactionId), zap.String("stack", string(debug.Stack())))
+		recoversMetric.Inc(1)
+		// if we haven't set a status code yet, we can send a 500 response.
+		if started.IsZero() {
+			if transactionId != "" {
+				w.Header().Set("X-Trans-Id", transactionId)
 			}
+			srv.StandardResponse(w, http.StatusInternalServerError)
 		}
 	}
 }
 
+func init() {
+	Register(Registration{Name: "catch_errors", Position: 10, New: NewCatchError})
+}
+
 func NewCatchError(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	recoversMetric := metricsScope.Counter("recovers")
 	return func(next http.Handler) http.Handler {
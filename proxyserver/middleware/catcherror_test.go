@@ -0,0 +1,60 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCatchError(t *testing.T) {
+	obs, logs := observer.New(zap.InfoLevel)
+	mid, err := NewCatchError(conf.Section{}, common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+	req := httptest.NewRequest("GET", "/v1/a/c/o", nil)
+	req.Header.Set("X-Trans-Id", "tx123")
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, &ProxyContext{Logger: zap.New(obs)}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "tx123", w.Header().Get("X-Trans-Id"))
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "tx123", fields["txn"])
+	require.Equal(t, "oops", fields["err"])
+	require.True(t, strings.Contains(fields["stack"].(string), "TestCatchError"))
+}
+
+func TestCatchErrorAbortHandler(t *testing.T) {
+	mid, err := NewCatchError(conf.Section{}, common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	require.Panics(t, func() { h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/a", nil)) })
+}
@@ -0,0 +1,184 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/uber-go/tally"
+)
+
+// compressWriter decides when the response headers are written whether the
+// body should be compressed, and if so streams it through an encoder for the
+// encoding the client asked for.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	enc      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	h := w.Header()
+	if status == http.StatusOK && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && w.c.compressible(h) {
+		if w.encoding == "zstd" {
+			// Each response gets an encoder of its own, so there's no call
+			// for it to start a goroutine per CPU.
+			if enc, err := zstd.NewWriter(w.ResponseWriter, zstd.WithEncoderConcurrency(1)); err == nil {
+				w.enc = enc
+			}
+		} else {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	if w.enc != nil {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		// The compressed bytes aren't the object's bytes, so only a weak
+		// validator is still accurate.
+		if etag := h.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			if !strings.HasPrefix(etag, "\"") {
+				etag = "\"" + etag + "\""
+			}
+			h.Set("Etag", "W/"+etag)
+		}
+		w.c.metric.Inc(1)
+	}
+	h.Add("Vary", "Accept-Encoding")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) Close() error {
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+type compressor struct {
+	next         http.Handler
+	minSize      int64
+	contentTypes []string
+	metric       tally.Counter
+}
+
+func (c *compressor) compressible(h http.Header) bool {
+	if length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && length < c.minSize {
+		return false
+	}
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(h.Get("Content-Type"), ";")[0]))
+	for _, ct := range c.contentTypes {
+		if strings.HasSuffix(ct, "/*") {
+			if strings.HasPrefix(contentType, ct[:len(ct)-1]) {
+				return true
+			}
+		} else if contentType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the encoding to compress with given the client's
+// Accept-Encoding, zstd or gzip, whichever the client weighs higher and zstd
+// when it weighs them the same, or "" if it takes neither.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := map[string]float64{}
+	for _, enc := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(enc, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != "zstd" && name != "gzip" && name != "*" {
+			continue
+		}
+		weight := 1.0
+		if len(parts) > 1 {
+			if q := strings.TrimSpace(parts[1]); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					weight = v
+				}
+			}
+		}
+		weights[name] = weight
+	}
+	best, bestWeight := "", 0.0
+	for _, name := range []string{"zstd", "gzip"} {
+		weight, ok := weights[name]
+		if !ok {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = name, weight
+		}
+	}
+	return best
+}
+
+func (c *compressor) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+	if request.Method != "GET" || request.Header.Get("Range") != "" || encoding == "" {
+		c.next.ServeHTTP(writer, request)
+		return
+	}
+	if apiReq, _, _, object := getPathParts(request); !apiReq || object == "" {
+		c.next.ServeHTTP(writer, request)
+		return
+	}
+	// Backends mustn't see the client's Accept-Encoding or they may hand back
+	// something already encoded.
+	request.Header.Del("Accept-Encoding")
+	cw := &compressWriter{ResponseWriter: writer, c: c, encoding: encoding}
+	c.next.ServeHTTP(cw, request)
+	cw.Close()
+}
+
+func init() {
+	Register(Registration{Name: "compress", Position: 40, New: NewCompress})
+}
+
+// NewCompress returns the compress middleware, which zstd or gzip compresses
+// object GET responses of compressible content types for clients that send
+// an appropriate Accept-Encoding.  Responses smaller than min_size, range
+// responses and objects that already have a Content-Encoding are passed
+// through untouched.
+func NewCompress(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	minSize := config.GetInt("min_size", 1024)
+	contentTypes := common.SliceFromCSV(strings.ToLower(config.GetDefault("content_types",
+		"text/*,application/json,application/xml,application/javascript")))
+	RegisterInfo("compress", map[string]interface{}{"encodings": []string{"zstd", "gzip"}, "min_size": minSize, "content_types": contentTypes})
+	metric := metricsScope.Counter("compressed_responses")
+	return func(next http.Handler) http.Handler {
+		return &compressor{next: next, minSize: minSize, contentTypes: contentTypes, metric: metric}
+	}, nil
+}
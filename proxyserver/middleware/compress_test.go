@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func newTestCompress(t *testing.T, contentType, body string) http.Handler {
+	config, err := conf.StringConfig("[filter:compress]\nenabled = true\nmin_size = 10")
+	require.Nil(t, err)
+	mid, err := NewCompress(config.GetSection("filter:compress"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Etag", "d41d8cd98f00b204e9800998ecf8427e")
+		w.WriteHeader(200)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestCompressGet(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+	h := newTestCompress(t, "text/plain; charset=utf-8", body)
+	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("Accept-Encoding", "deflate, gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, "", resp.Header.Get("Content-Length"))
+	require.Equal(t, "W/\"d41d8cd98f00b204e9800998ecf8427e\"", resp.Header.Get("Etag"))
+	require.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	gz, err := gzip.NewReader(resp.Body)
+	require.Nil(t, err)
+	data, err := ioutil.ReadAll(gz)
+	require.Nil(t, err)
+	require.Equal(t, body, string(data))
+}
+
+func TestCompressGetZstd(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+	h := newTestCompress(t, "application/json", body)
+	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "zstd", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, "W/\"d41d8cd98f00b204e9800998ecf8427e\"", resp.Header.Get("Etag"))
+	dec, err := zstd.NewReader(resp.Body)
+	require.Nil(t, err)
+	defer dec.Close()
+	data, err := ioutil.ReadAll(dec)
+	require.Nil(t, err)
+	require.Equal(t, body, string(data))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	require.Equal(t, "gzip", negotiateEncoding("deflate, gzip"))
+	require.Equal(t, "zstd", negotiateEncoding("gzip, zstd"))
+	require.Equal(t, "gzip", negotiateEncoding("zstd;q=0.5, gzip"))
+	require.Equal(t, "zstd", negotiateEncoding("*"))
+	require.Equal(t, "gzip", negotiateEncoding("*, zstd;q=0"))
+	require.Equal(t, "", negotiateEncoding("gzip;q=0"))
+	require.Equal(t, "", negotiateEncoding("identity"))
+}
+
+func TestCompressSkipped(t *testing.T) {
+	for _, tc := range []struct {
+		contentType, body, acceptEncoding, path string
+	}{
+		{"text/plain", strings.Repeat("x", 100), "", "/v1/a/c/o"},
+		{"text/plain", strings.Repeat("x", 100), "gzip;q=0", "/v1/a/c/o"},
+		{"image/png", strings.Repeat("x", 100), "gzip", "/v1/a/c/o"},
+		{"text/plain", "tiny", "gzip", "/v1/a/c/o"},
+		{"text/plain", strings.Repeat("x", 100), "gzip", "/v1/a/c"},
+	} {
+		h := newTestCompress(t, tc.contentType, tc.body)
+		req, err := http.NewRequest("GET", tc.path, nil)
+		require.Nil(t, err)
+		req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		require.Equal(t, "", w.Header().Get("Content-Encoding"))
+		require.Equal(t, tc.body, w.Body.String())
+	}
+}
@@ -82,6 +82,10 @@ func containerQuota(metric tally.Counter) func(http.Handler) http.Handler {
 	}
 }
 
+func init() {
+	Register(Registration{Name: "container-quotas", Position: 270, New: NewContainerQuota})
+}
+
 func NewContainerQuota(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("container_quotas", map[string]interface{}{})
 	return containerQuota(metricsScope.Counter("container_quotas")), nil
@@ -44,7 +44,7 @@ func TestQuotaBytes(t *testing.T) {
 
 	req, err := http.NewRequest("PUT", "/v1/a/c/o", strings.NewReader("MORETHAN3"))
 	require.Nil(t, err)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, req)
@@ -73,7 +73,7 @@ func TestQuotaCount(t *testing.T) {
 
 	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
 	require.Nil(t, err)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	w := httptest.NewRecorder()
 	h.ServeHTTP(w, req)
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"runtime/debug"
 	"strconv"
@@ -35,17 +36,32 @@ import (
 )
 
 var (
-	serverInfo     = make(map[string]interface{})
-	sil            sync.Mutex
-	excludeHeaders = []string{
-		"X-Account-Sysmeta-",
-		"X-Container-Sysmeta-",
-		"X-Object-Sysmeta-",
-		"X-Object-Transient-Sysmeta-",
-		"X-Backend-",
+	serverInfo = make(map[string]interface{})
+	sil        sync.Mutex
+	// lowPrioritySources are the subrequest sources that aren't worth making
+	// a user request wait on a busy backend device for.
+	lowPrioritySources = map[string]bool{
+		"bulkput":    true,
+		"bulkdelete": true,
 	}
+	// apiVersions are the path prefixes of API requests: always v1, plus any
+	// others the proxy has been configured to serve.
+	apiVersions = map[string]bool{"v1": true}
 )
 
+// EnableAPIVersion has the middleware treat requests under /<version>/ as API
+// requests, just as they do /v1/ ones.  It's meant to be called while the
+// proxy is starting up, before any requests are served.
+func EnableAPIVersion(version string) {
+	apiVersions[version] = true
+}
+
+// isAPIPath reports whether the path is under one of the API versions.
+func isAPIPath(requestPath string) bool {
+	version, _, _, _ := getPathSegments(requestPath)
+	return apiVersions[version]
+}
+
 func RegisterInfo(name string, data interface{}) {
 	sil.Lock()
 	defer sil.Unlock()
@@ -77,6 +93,28 @@ func NewCaptureWriter() *captureWriter {
 	return &captureWriter{header: make(http.Header)}
 }
 
+// spoolMemoryLimit is how much of a spooled response body is kept in memory
+// before it's moved to a temporary file.
+var spoolMemoryLimit = 1024 * 1024
+
+// spoolWriter captures a subrequest's response like captureWriter, but
+// spools the body so one too big for memory ends up on disk.  It has to be
+// closed once the body's been read.
+type spoolWriter struct {
+	status int
+	header http.Header
+	body   *common.Spool
+}
+
+func (x *spoolWriter) Header() http.Header         { return x.header }
+func (x *spoolWriter) WriteHeader(status int)      { x.status = status }
+func (x *spoolWriter) Write(b []byte) (int, error) { return x.body.Write(b) }
+func (x *spoolWriter) Close() error                { return x.body.Close() }
+
+func newSpoolWriter() *spoolWriter {
+	return &spoolWriter{status: http.StatusOK, header: make(http.Header), body: common.NewSpool(spoolMemoryLimit, "")}
+}
+
 type AccountInfo struct {
 	ContainerCount int64
 	ObjectCount    int64
@@ -89,40 +127,90 @@ type AccountInfo struct {
 type AuthorizeFunc func(r *http.Request) (bool, int)
 type subrequestCopy func(dst, src *http.Request)
 
+// InvalidationHook is called by InvalidateContainer so caches kept outside
+// the ProxyContext, like the proxy's container listing cache, can drop the
+// container's entries too.
+type InvalidationHook func(account, container string)
+
 type ProxyContextMiddleware struct {
 	next               http.Handler
 	log                srv.LowLevelLogger
 	Cache              ring.MemcacheRing
 	proxyClientFactory client.ProxyClient
 	debugResponses     bool
+	debugTiming        bool
+	normalizeNames     bool
+	clientTimestamps   bool
+	invalidationHooks  []InvalidationHook
+}
+
+// AuthIdentity is who the auth middleware decided a request is from.
+type AuthIdentity struct {
+	RemoteUsers     []string
+	StorageOwner    bool
+	ResellerRequest bool
+	// ReferrerOnly is set when a referrer ACL is what let the request in,
+	// so it should see no more than an anonymous user would.
+	ReferrerOnly bool
+}
+
+// TempURLInfo is how the tempurl middleware authorized a request.
+type TempURLInfo struct {
+	Scope     int
+	Account   string
+	Container string
+	Expires   time.Time
+	SingleUse bool
 }
 
 type ProxyContext struct {
 	*ProxyContextMiddleware
-	C                client.RequestClient
-	Authorize        AuthorizeFunc
-	RemoteUsers      []string
-	StorageOwner     bool
-	ResellerRequest  bool
-	ACL              string
-	subrequestCopy   subrequestCopy
-	Logger           *zap.Logger
-	TxId             string
-	responseSent     time.Time
-	status           int
+	AuthIdentity
+	C              client.RequestClient
+	Authorize      AuthorizeFunc
+	ACL            string
+	subrequestCopy subrequestCopy
+	Logger         *zap.Logger
+	TxId           string
+	TraceId        string
+	TempURL        *TempURLInfo
+	responseSent   time.Time
+	status         int
+	// accountInfoCache is shared by a request and its subrequests, which
+	// middleware may run concurrently, so it's guarded by accountInfoLock.
 	accountInfoCache map[string]*AccountInfo
-	depth            int
-	Source           string
-	S3Auth           *S3AuthInfo
+	// accountInfoFetching has a channel, closed when done, for each account
+	// being looked up, also guarded by accountInfoLock.
+	accountInfoFetching map[string]chan struct{}
+	accountInfoLock     *sync.RWMutex
+	depth               int
+	Source              string
+	S3Auth              *S3AuthInfo
+	// timings is set when the request asked for an X-Debug-Timing header.
+	timings *requestTimings
+	// clientTimestamp is the X-Timestamp a PUT or DELETE came with, kept
+	// when client timestamps are allowed; see ClientTimestamp.
+	clientTimestamp string
 }
 
+// proxyContextKey is the context key a request's ProxyContext is stored
+// under.
+type proxyContextKey struct{}
+
+// GetProxyContext returns the request's ProxyContext, or nil if it doesn't
+// have one.
 func GetProxyContext(r *http.Request) *ProxyContext {
-	if rv := r.Context().Value("proxycontext"); rv != nil {
-		return rv.(*ProxyContext)
+	if pc, ok := r.Context().Value(proxyContextKey{}).(*ProxyContext); ok {
+		return pc
 	}
 	return nil
 }
 
+// SetProxyContext returns a shallow copy of r with pc as its ProxyContext.
+func SetProxyContext(r *http.Request, pc *ProxyContext) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, pc))
+}
+
 func (ctx *ProxyContext) Response() (time.Time, int) {
 	return ctx.responseSent, ctx.status
 }
@@ -141,7 +229,7 @@ func (ctx *ProxyContext) addSubrequestCopy(f subrequestCopy) {
 
 func getPathParts(request *http.Request) (bool, string, string, string) {
 	apiRequest, account, container, object := getPathSegments(request.URL.Path)
-	return apiRequest == "v1", account, container, object
+	return apiVersions[apiRequest], account, container, object
 }
 
 func getPathSegments(requestPath string) (string, string, string, string) {
@@ -160,23 +248,63 @@ func getPathSegments(requestPath string) (string, string, string, string) {
 	}
 }
 
+// joinAccountFetch waits for any lookup of key already under way.  If there
+// isn't one and key isn't in accountInfoCache, it returns a func the caller
+// must call when its own lookup is done.
+func (pc *ProxyContext) joinAccountFetch(ctx context.Context, key string) func() {
+	if pc.accountInfoLock == nil || pc.accountInfoFetching == nil {
+		return nil
+	}
+	pc.accountInfoLock.Lock()
+	if pc.accountInfoCache[key] != nil {
+		pc.accountInfoLock.Unlock()
+		return nil
+	}
+	if ch, ok := pc.accountInfoFetching[key]; ok {
+		pc.accountInfoLock.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	ch := make(chan struct{})
+	pc.accountInfoFetching[key] = ch
+	pc.accountInfoLock.Unlock()
+	return func() {
+		pc.accountInfoLock.Lock()
+		delete(pc.accountInfoFetching, key)
+		pc.accountInfoLock.Unlock()
+		close(ch)
+	}
+}
+
 func (pc *ProxyContext) GetAccountInfo(ctx context.Context, account string) (*AccountInfo, error) {
 	key := fmt.Sprintf("account/%s", account)
+	if done := pc.joinAccountFetch(ctx, key); done != nil {
+		defer done()
+	}
+	if pc.accountInfoLock != nil {
+		pc.accountInfoLock.RLock()
+	}
 	ai := pc.accountInfoCache[key]
+	if pc.accountInfoLock != nil {
+		pc.accountInfoLock.RUnlock()
+	}
 	if ai == nil {
 		if err := pc.Cache.GetStructured(ctx, key, &ai); err != nil {
 			ai = nil
 		}
 	}
 	if ai != nil && ai.StatusCode != 0 && ai.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("%d error retrieving info for account %s", ai.StatusCode, account)
+		return nil, &common.BackendError{StatusCode: ai.StatusCode, Message: fmt.Sprintf("%d error retrieving info for account %s", ai.StatusCode, account)}
 	}
 	if ai == nil {
 		resp := pc.C.HeadAccount(ctx, account, nil)
 		resp.Body.Close()
 		if resp.StatusCode/100 != 2 {
 			pc.Cache.Set(ctx, key, &AccountInfo{StatusCode: resp.StatusCode}, 30)
-			return nil, fmt.Errorf("%d error retrieving info for account %s", resp.StatusCode, account)
+			return nil, &common.BackendError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%d error retrieving info for account %s", resp.StatusCode, account)}
 		}
 		ai = &AccountInfo{
 			Metadata:    make(map[string]string),
@@ -202,15 +330,49 @@ func (pc *ProxyContext) GetAccountInfo(ctx context.Context, account string) (*Ac
 		}
 		pc.Cache.Set(ctx, key, ai, 30)
 	}
+	if pc.accountInfoLock != nil && pc.accountInfoCache != nil {
+		pc.accountInfoLock.Lock()
+		pc.accountInfoCache[key] = ai
+		pc.accountInfoLock.Unlock()
+	}
 	return ai, nil
 }
 
 func (pc *ProxyContext) InvalidateAccountInfo(ctx context.Context, account string) {
 	key := fmt.Sprintf("account/%s", account)
+	if pc.accountInfoLock != nil {
+		// A lookup under way, like the prefetch, may have read the info
+		// from before the change; let it finish caching that first.
+		pc.accountInfoLock.RLock()
+		ch, ok := pc.accountInfoFetching[key]
+		pc.accountInfoLock.RUnlock()
+		if ok {
+			select {
+			case <-ch:
+			case <-ctx.Done():
+			}
+		}
+		pc.accountInfoLock.Lock()
+		defer pc.accountInfoLock.Unlock()
+	}
 	delete(pc.accountInfoCache, key)
 	pc.Cache.Delete(ctx, key)
 }
 
+// InvalidateContainer drops what's cached about the container and its
+// account, the account's container count having likely changed with it.
+// Anything that creates or deletes a container, including middleware making
+// their own backend requests, should call it after, so later quota and
+// storage policy decisions, in this request or others, aren't made from
+// stale info.
+func (pc *ProxyContext) InvalidateContainer(ctx context.Context, account, container string) {
+	pc.C.InvalidateContainerInfo(ctx, account, container)
+	pc.InvalidateAccountInfo(ctx, account)
+	for _, hook := range pc.invalidationHooks {
+		hook(account, container)
+	}
+}
+
 func (pc *ProxyContext) AutoCreateAccount(ctx context.Context, account string, headers http.Header) {
 	h := http.Header{"X-Timestamp": []string{common.GetTimestamp()},
 		"X-Trans-Id": []string{pc.TxId}}
@@ -225,6 +387,25 @@ func (pc *ProxyContext) AutoCreateAccount(ctx context.Context, account string, h
 	}
 }
 
+// ClientTimestamp returns the X-Timestamp a PUT or DELETE came with, in the
+// form the backends store, when the proxy allows client timestamps and the
+// request is from a reseller admin, like container sync or a migration tool
+// keeping the timestamps of what it copies.  Anyone else gets "" and the
+// proxy's own timestamp.  It must be called once the request is authorized.
+func (pc *ProxyContext) ClientTimestamp() (string, error) {
+	if pc.clientTimestamp == "" || !isResellerAdmin(pc) {
+		return "", nil
+	}
+	ts, err := common.StandardizeTimestamp(pc.clientTimestamp)
+	if err != nil {
+		return "", fmt.Errorf("Invalid X-Timestamp header")
+	}
+	if f, err := strconv.ParseFloat(strings.SplitN(ts, "_", 2)[0], 64); err != nil || !(f > 0) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("Invalid X-Timestamp header")
+	}
+	return ts, nil
+}
+
 func (pc *ProxyContext) newSubrequest(method, urlStr string, body io.Reader, req *http.Request, source string) (*http.Request, error) {
 	if source == "" {
 		panic("Programmer error: You must supply the source with newSubrequest. If you want the subrequest to be treated a user request (billing, quotas, etc.) you can set the source to \"-\"")
@@ -239,24 +420,37 @@ func (pc *ProxyContext) newSubrequest(method, urlStr string, body io.Reader, req
 	subctx := &ProxyContext{
 		ProxyContextMiddleware: pc.ProxyContextMiddleware,
 		Authorize:              pc.Authorize,
-		RemoteUsers:            pc.RemoteUsers,
+		AuthIdentity:           AuthIdentity{RemoteUsers: pc.RemoteUsers},
 		subrequestCopy:         pc.subrequestCopy,
 		Logger:                 pc.Logger.With(zap.String("src", source)),
 		C:                      pc.C,
 		TxId:                   pc.TxId,
+		TraceId:                pc.TraceId,
+		TempURL:                pc.TempURL,
 		accountInfoCache:       pc.accountInfoCache,
+		accountInfoFetching:    pc.accountInfoFetching,
+		accountInfoLock:        pc.accountInfoLock,
 		status:                 500,
 		depth:                  pc.depth + 1,
 		Source:                 source,
 		S3Auth:                 pc.S3Auth,
 	}
-	subreq = subreq.WithContext(context.WithValue(req.Context(), "proxycontext", subctx))
+	if pc.normalizeNames {
+		normalizeNames(subreq)
+	}
+	subreq = subreq.WithContext(context.WithValue(req.Context(), proxyContextKey{}, subctx))
 	if subctx.subrequestCopy != nil {
 		subctx.subrequestCopy(subreq, req)
 	}
 	if v := req.Header.Get("Referer"); v != "" {
 		subreq.Header.Set("Referer", v)
 	}
+	if v := req.Header.Get("Traceparent"); v != "" {
+		subreq.Header.Set("Traceparent", v)
+	}
+	if lowPrioritySources[source] || common.IsLowPriority(req) {
+		subreq.Header.Set(common.BackendPriorityHeader, common.LowPriority)
+	}
 	subreq.Header.Set("X-Trans-Id", subctx.TxId)
 	subreq.Header.Set("X-Timestamp", common.GetTimestamp())
 	return subreq, nil
@@ -278,6 +472,30 @@ func (m *ProxyContextMiddleware) ServeHTTP(writer http.ResponseWriter, request *
 	if !srv.ValidateRequest(writer, request) {
 		return
 	}
+	if m.normalizeNames {
+		raw := copyNames(request)
+		if normalizeNames(request) && rawNameMethods[request.Method] {
+			nfw := &notFoundWriter{ResponseWriter: writer}
+			m.serveRequest(nfw, request)
+			if !nfw.notFound {
+				return
+			}
+			for k := range writer.Header() {
+				delete(writer.Header(), k)
+			}
+			request = raw
+		}
+	}
+	m.serveRequest(writer, request)
+}
+
+// serveRequest gives a request its ProxyContext and passes it down the
+// pipeline.
+func (m *ProxyContextMiddleware) serveRequest(writer http.ResponseWriter, request *http.Request) {
+	if status, msg := checkNames(request); status != http.StatusOK {
+		srv.SimpleErrorResponse(writer, status, msg)
+		return
+	}
 
 	if request.URL.Path == "/info" {
 		if request.URL.Query().Get("swiftinfo_sig") != "" || request.URL.Query().Get("swiftinfo_expires") != "" {
@@ -307,59 +525,49 @@ func (m *ProxyContextMiddleware) ServeHTTP(writer http.ResponseWriter, request *
 		}
 	}
 
-	for k := range request.Header {
-		for _, ex := range excludeHeaders {
-			if strings.HasPrefix(k, ex) || k == "X-Timestamp" {
-				delete(request.Header, k)
-			}
-		}
-	}
-
-	transId := common.GetTransactionId()
+	transId := common.GetTransactionId() + common.TransactionIdExtra(request.Header.Get("X-Trans-Id-Extra"))
 	request.Header.Set("X-Trans-Id", transId)
 	writer.Header().Set("X-Trans-Id", transId)
 	writer.Header().Set("X-Openstack-Request-Id", transId)
+	var clientTimestamp string
+	if m.clientTimestamps && (request.Method == "PUT" || request.Method == "DELETE") {
+		clientTimestamp = request.Header.Get("X-Timestamp")
+	}
 	request.Header.Set("X-Timestamp", common.GetTimestamp())
 	logr := m.log.With(zap.String("txn", transId))
+	traceId, ok := common.ParseTraceparent(request.Header.Get("Traceparent"))
+	if ok {
+		logr = logr.With(zap.String("traceId", traceId))
+	} else {
+		request.Header.Del("Traceparent")
+	}
 	pc := &ProxyContext{
 		ProxyContextMiddleware: m,
 		Authorize:              nil,
 		Logger:                 logr,
 		TxId:                   transId,
+		TraceId:                traceId,
 		status:                 500,
 		accountInfoCache:       make(map[string]*AccountInfo),
+		accountInfoFetching:    make(map[string]chan struct{}),
+		accountInfoLock:        &sync.RWMutex{},
 		C:                      m.proxyClientFactory.NewRequestClient(m.Cache, make(map[string]*client.ContainerInfo), logr),
+		clientTimestamp:        clientTimestamp,
 	}
-	// we'll almost certainly need the AccountInfo and ContainerInfo for the current path, so pre-fetch them in parallel.
+	if m.debugTiming && request.Header.Get("X-Debug-Timing") != "" {
+		pc.timings = newRequestTimings()
+	}
+	request.Header.Del("X-Debug-Timing")
+	// we'll almost certainly need the AccountInfo and ContainerInfo for the current path, so pre-fetch them in parallel
+	// while the rest of the pipeline gets going.  Whatever asks for them first joins the fetch already under way.
 	apiRequest, account, container, _ := getPathParts(request)
 	if apiRequest && account != "" {
-		wg := &sync.WaitGroup{}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			pc.GetAccountInfo(request.Context(), account)
-		}()
+		go pc.GetAccountInfo(request.Context(), account)
 		if container != "" {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				pc.C.GetContainerInfo(request.Context(), account, container)
-			}()
+			go pc.C.GetContainerInfo(request.Context(), account, container)
 		}
-		wg.Wait()
 	}
 	newWriter := srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
-		// strip out any bad headers before calling real WriteHeader
-		for k := range w.Header() {
-			if k == "X-Account-Sysmeta-Project-Domain-Id" {
-				w.Header().Set("X-Account-Project-Domain-Id", w.Header().Get(k))
-			}
-			for _, ex := range excludeHeaders {
-				if strings.HasPrefix(k, ex) {
-					delete(w.Header(), k)
-				}
-			}
-		}
 		if status == http.StatusUnauthorized && w.Header().Get("Www-Authenticate") == "" {
 			if account != "" {
 				w.Header().Set("Www-Authenticate", fmt.Sprintf("Swift realm=\"%s\"", common.Urlencode(account)))
@@ -373,15 +581,26 @@ func (m *ProxyContextMiddleware) ServeHTTP(writer http.ResponseWriter, request *
 			w.Header().Set("X-Source-Code", string(buf))
 		}
 
+		// Only reseller admins get to see timings, since they say a fair
+		// bit about how the cluster is put together.
+		if pc.timings != nil && isResellerAdmin(pc) {
+			w.Header().Set("X-Debug-Timing", pc.timings.header())
+		}
+
 		pc.responseSent = time.Now()
 		pc.status = status
 		return status
 	})
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", pc))
+	request = SetProxyContext(request, pc)
 	m.next.ServeHTTP(newWriter, request)
 }
 
-func NewContext(debugResponses bool, mc ring.MemcacheRing, log srv.LowLevelLogger, proxyClientFactory client.ProxyClient) func(http.Handler) http.Handler {
+// NewContext returns the middleware that gives each request its
+// ProxyContext.  The hooks are called whenever a ProxyContext's
+// InvalidateContainer is.  With debugTiming, requests sent with an
+// X-Debug-Timing header get one back listing the time spent in each
+// TimedStage of the pipeline, if they're from a reseller admin.
+func NewContext(debugResponses, debugTiming, normalizeNames, clientTimestamps bool, mc ring.MemcacheRing, log srv.LowLevelLogger, proxyClientFactory client.ProxyClient, hooks ...InvalidationHook) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return &ProxyContextMiddleware{
 			Cache:              mc,
@@ -389,6 +608,10 @@ func NewContext(debugResponses bool, mc ring.MemcacheRing, log srv.LowLevelLogge
 			next:               next,
 			proxyClientFactory: proxyClientFactory,
 			debugResponses:     debugResponses,
+			debugTiming:        debugTiming,
+			normalizeNames:     normalizeNames,
+			clientTimestamps:   clientTimestamps,
+			invalidationHooks:  hooks,
 		}
 	}
 }
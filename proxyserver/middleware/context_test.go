@@ -0,0 +1,250 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func TestProxyContextKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, GetProxyContext(r))
+	pc := &ProxyContext{}
+	require.Nil(t, GetProxyContext(r.WithContext(context.WithValue(r.Context(), "proxycontext", pc))))
+	require.True(t, pc == GetProxyContext(SetProxyContext(r, pc)))
+}
+
+func TestSubrequestProxyContext(t *testing.T) {
+	pc := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{},
+		AuthIdentity:           AuthIdentity{RemoteUsers: []string{"a", "a:u"}, StorageOwner: true},
+		Logger:                 zap.NewNop(),
+		TxId:                   "tx1",
+		TraceId:                "trace1",
+		TempURL:                &TempURLInfo{Scope: SCOPE_CONTAINER, Account: "a", Container: "c"},
+		accountInfoCache:       map[string]*AccountInfo{},
+		accountInfoLock:        &sync.RWMutex{},
+	}
+	r := SetProxyContext(httptest.NewRequest("GET", "/v1/a/c/o", nil), pc)
+	subreq, err := pc.newSubrequest("GET", "/v1/a/c/o2", nil, r, "test")
+	require.Nil(t, err)
+	subctx := GetProxyContext(subreq)
+	require.Equal(t, []string{"a", "a:u"}, subctx.RemoteUsers)
+	require.False(t, subctx.StorageOwner)
+	require.Equal(t, "trace1", subctx.TraceId)
+	require.True(t, pc.TempURL == subctx.TempURL)
+	require.True(t, pc.accountInfoLock == subctx.accountInfoLock)
+	require.Equal(t, "test", subctx.Source)
+}
+
+func TestInvalidateContainer(t *testing.T) {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	var hooked []string
+	lc := map[string]*client.ContainerInfo{"container/a/c": {}, "container/a/c2": {}}
+	pc := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{
+			Cache: &test.FakeMemcacheRing{},
+			invalidationHooks: []InvalidationHook{func(account, container string) {
+				hooked = append(hooked, account+"/"+container)
+			}},
+		},
+		C:                f.NewRequestClient(nil, lc, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{"account/a": {ContainerCount: 1}},
+		accountInfoLock:  &sync.RWMutex{},
+	}
+	pc.InvalidateContainer(context.Background(), "a", "c")
+	require.Equal(t, []string{"a/c"}, hooked)
+	_, ok := lc["container/a/c"]
+	require.False(t, ok)
+	_, ok = lc["container/a/c2"]
+	require.True(t, ok)
+	require.Nil(t, pc.accountInfoCache["account/a"])
+}
+
+// slowAccountClient answers HeadAccount once release is closed, counting the
+// calls made.
+type slowAccountClient struct {
+	client.RequestClient
+	heads   int32
+	release chan struct{}
+}
+
+func (c *slowAccountClient) HeadAccount(ctx context.Context, account string, headers http.Header) *http.Response {
+	atomic.AddInt32(&c.heads, 1)
+	<-c.release
+	return &http.Response{
+		StatusCode: 204,
+		Header: http.Header{
+			"X-Account-Container-Count": {"2"},
+			"X-Account-Object-Count":    {"3"},
+			"X-Account-Bytes-Used":      {"4"},
+		},
+		Body: ioutil.NopCloser(strings.NewReader("")),
+	}
+}
+
+func TestGetAccountInfoJoinsFetch(t *testing.T) {
+	c := &slowAccountClient{release: make(chan struct{})}
+	pc := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{Cache: &test.FakeMemcacheRing{}},
+		C:                      c,
+		accountInfoCache:       map[string]*AccountInfo{},
+		accountInfoFetching:    map[string]chan struct{}{},
+		accountInfoLock:        &sync.RWMutex{},
+	}
+	var wg sync.WaitGroup
+	infos := make([]*AccountInfo, 2)
+	for i := range infos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			infos[i], _ = pc.GetAccountInfo(context.Background(), "a")
+		}(i)
+		for atomic.LoadInt32(&c.heads) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(c.release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&c.heads))
+	require.NotNil(t, infos[0])
+	require.True(t, infos[0] == infos[1])
+	require.Equal(t, int64(2), infos[0].ContainerCount)
+	require.True(t, infos[0] == pc.accountInfoCache["account/a"])
+}
+
+func TestClientTimestamp(t *testing.T) {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	var userTs, adminTs string
+	var adminErr error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := GetProxyContext(r)
+		userTs, _ = ctx.ClientTimestamp()
+		ctx.ResellerRequest = true
+		adminTs, adminErr = ctx.ClientTimestamp()
+	})
+	do := func(h http.Handler, method, ts string) {
+		req := httptest.NewRequest(method, "/v1/a/c/o", nil)
+		req.Header.Set("X-Timestamp", ts)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	h := NewContext(false, false, false, true, &test.FakeMemcacheRing{}, zap.NewNop(), f)(next)
+
+	do(h, "PUT", "1500000000.5")
+	require.Equal(t, "", userTs)
+	require.Nil(t, adminErr)
+	require.Equal(t, "1500000000.50000", adminTs)
+
+	do(h, "DELETE", "-1")
+	require.NotNil(t, adminErr)
+
+	do(h, "POST", "1500000000.5")
+	require.Nil(t, adminErr)
+	require.Equal(t, "", adminTs)
+
+	h = NewContext(false, false, false, false, &test.FakeMemcacheRing{}, zap.NewNop(), f)(next)
+	do(h, "PUT", "1500000000.5")
+	require.Equal(t, "", adminTs)
+}
+
+func TestNormalizeNamesFallsBack(t *testing.T) {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	var paths []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v1/a/c/cafe\u0301" || r.Method == "PUT" {
+			w.WriteHeader(200)
+			w.Write([]byte("found"))
+			return
+		}
+		w.Header().Set("X-Missing", "yes")
+		w.WriteHeader(404)
+		w.Write([]byte("not found"))
+	})
+	h := NewContext(false, false, true, false, &test.FakeMemcacheRing{}, zap.NewNop(), f)(next)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/a/c/cafe%CC%81", nil))
+	require.Equal(t, 200, rec.Code)
+	require.Equal(t, "found", rec.Body.String())
+	require.Equal(t, "", rec.Header().Get("X-Missing"))
+	require.Equal(t, []string{"/v1/a/c/caf\u00e9", "/v1/a/c/cafe\u0301"}, paths)
+
+	paths = nil
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/a/c/cafe%CC%81", nil))
+	require.Equal(t, 200, rec.Code)
+	require.Equal(t, []string{"/v1/a/c/caf\u00e9"}, paths)
+
+	paths = nil
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/a/c/missing", nil))
+	require.Equal(t, 404, rec.Code)
+	require.Equal(t, []string{"/v1/a/c/missing"}, paths)
+}
+
+func TestInvalidateAccountInfoWaitsForFetch(t *testing.T) {
+	c := &slowAccountClient{release: make(chan struct{})}
+	mc := &test.FakeMemcacheRing{}
+	pc := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{Cache: mc},
+		C:                      c,
+		accountInfoCache:       map[string]*AccountInfo{},
+		accountInfoFetching:    map[string]chan struct{}{},
+		accountInfoLock:        &sync.RWMutex{},
+	}
+	go pc.GetAccountInfo(context.Background(), "a")
+	for atomic.LoadInt32(&c.heads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	invalidated := make(chan struct{})
+	go func() {
+		pc.InvalidateAccountInfo(context.Background(), "a")
+		close(invalidated)
+	}()
+	select {
+	case <-invalidated:
+		t.Fatal("invalidated while the fetch was under way")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(c.release)
+	<-invalidated
+	require.Equal(t, 1, len(mc.MockSetValues))
+	pc.accountInfoLock.RLock()
+	defer pc.accountInfoLock.RUnlock()
+	require.Nil(t, pc.accountInfoCache["account/a"])
+}
@@ -380,6 +380,11 @@ func (c *copyMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Req
 	c.next.ServeHTTP(writer, request)
 }
 
+func init() {
+	Register(Registration{Name: "copy", Position: 230, New: NewCopyMiddleware})
+}
+
 func NewCopyMiddleware(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	RegisterMethods("object", "COPY")
 	return func(next http.Handler) http.Handler { return &copyMiddleware{next: next} }, nil
 }
@@ -36,7 +36,7 @@ func TestPut(t *testing.T) {
 	req.Header.Set("X-Copy-From", "c/o")
 
 	ctx := NewFakeProxyContext(handler)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -63,7 +63,7 @@ func TestPutAllNewMeta(t *testing.T) {
 	req.Header.Set("X-Object-Metadata-Foo", "NewObjectMetadataFoo")
 
 	ctx := NewFakeProxyContext(handler)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -85,7 +85,7 @@ func TestCopy(t *testing.T) {
 	rr := httptest.NewRecorder()
 	req, _ := http.NewRequest("COPY", "/v1/a/c/o", nil)
 	ctx := NewFakeProxyContext(handler)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	handler.ServeHTTP(rr, req)
 
 	require.Equal(t, 412, rr.Code)
@@ -98,7 +98,7 @@ func TestCopy(t *testing.T) {
 	req, _ = http.NewRequest("COPY", "/v1/a/c/o", nil)
 	ctx = NewFakeProxyContext(handler)
 	req.Header.Set("Destination", common.Urlencode("//o2"))
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -109,7 +109,7 @@ func TestCopy(t *testing.T) {
 	req, _ = http.NewRequest("COPY", "/v1/a/c/o", nil)
 	ctx = NewFakeProxyContext(handler)
 	req.Header.Set("Destination", common.Urlencode("c/o2"))
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -131,7 +131,7 @@ func TestCopy(t *testing.T) {
 	ctx = NewFakeProxyContext(handler)
 	req.Header.Set("Destination", common.Urlencode("c/o2"))
 	req.Header.Set("Destination-Account", common.Urlencode("a2"))
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -271,7 +271,7 @@ func TestPostAsCopy(t *testing.T) {
 	req.Header.Set("Content-Type", "something")
 
 	ctx := NewFakeProxyContext(handler)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 
 	handler.ServeHTTP(rr, req)
 
@@ -26,17 +26,54 @@ import (
 	"github.com/uber-go/tally"
 )
 
+// corsMetadataKeys are the container metadata that make up its CORS policy.
+var corsMetadataKeys = []string{"Access-Control-Allow-Origin", "Access-Control-Expose-Headers", "Access-Control-Max-Age"}
+
+// corsDefaults reads the cluster's default CORS policy, for containers
+// without one of their own, from a cors or options filter's section, keyed
+// like corsMetadataKeys.  It's nil if there isn't one.
+func corsDefaults(config conf.Section) map[string]string {
+	var defaults map[string]string
+	for _, k := range corsMetadataKeys {
+		setting := "default_" + strings.Replace(strings.ToLower(strings.TrimPrefix(k, "Access-Control-")), "-", "_", -1)
+		if v := config.GetDefault(setting, ""); v != "" {
+			if defaults == nil {
+				defaults = map[string]string{}
+			}
+			defaults[k] = v
+		}
+	}
+	return defaults
+}
+
+// corsPolicy returns the container's CORS metadata or, if it has none, the
+// default policy.
+func corsPolicy(defaults map[string]string, ci *client.ContainerInfo) map[string]string {
+	for _, k := range corsMetadataKeys {
+		if ci.Metadata[k] != "" {
+			return ci.Metadata
+		}
+	}
+	if defaults == nil {
+		return ci.Metadata
+	}
+	return defaults
+}
+
 type corsMiddleware struct {
-	next http.Handler
+	next     http.Handler
+	defaults map[string]string
 }
 
 type cors struct {
-	origin string
-	ci     *client.ContainerInfo
+	origin   string
+	ci       *client.ContainerInfo
+	defaults map[string]string
 }
 
 func (c *cors) HandleCors(writer http.ResponseWriter, status int) int {
-	if c.origin == "" || !common.IsOriginAllowed(c.ci.Metadata["Access-Control-Allow-Origin"], c.origin) {
+	meta := corsPolicy(c.defaults, c.ci)
+	if c.origin == "" || !common.IsOriginAllowed(meta["Access-Control-Allow-Origin"], c.origin) {
 		return status
 	}
 	if writer.Header().Get("Access-Control-Expose-Headers") == "" {
@@ -50,9 +87,9 @@ func (c *cors) HandleCors(writer http.ResponseWriter, status int) int {
 				corsExposeHeaders = append(corsExposeHeaders, k)
 			}
 		}
-		if c.ci.Metadata["Access-Control-Expose-Headers"] != "" {
+		if meta["Access-Control-Expose-Headers"] != "" {
 			for _, h := range strings.Split(
-				c.ci.Metadata["Access-Control-Expose-Headers"], " ") {
+				meta["Access-Control-Expose-Headers"], " ") {
 				corsExposeHeaders = append(corsExposeHeaders, h)
 			}
 		}
@@ -60,7 +97,7 @@ func (c *cors) HandleCors(writer http.ResponseWriter, status int) int {
 			"Access-Control-Expose-Headers", strings.ToLower(strings.Join(corsExposeHeaders, ", ")))
 	}
 	if writer.Header().Get("Access-Control-Allow-Origin") == "" {
-		if c.ci.Metadata["Access-Control-Allow-Origin"] == "*" {
+		if meta["Access-Control-Allow-Origin"] == "*" {
 			writer.Header().Set("Access-Control-Allow-Origin", "*")
 		} else {
 			writer.Header().Set("Access-Control-Allow-Origin", c.origin)
@@ -82,7 +119,7 @@ func (cm *corsMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Re
 		return
 	}
 	if ci, err := ctx.C.GetContainerInfo(request.Context(), pathParts["account"], pathParts["container"]); err == nil {
-		cHandler := &cors{origin: origin, ci: ci}
+		cHandler := &cors{origin: origin, ci: ci, defaults: cm.defaults}
 		w := srv.NewCustomWriter(writer, cHandler.HandleCors)
 		cm.next.ServeHTTP(w, request)
 		return
@@ -90,10 +127,28 @@ func (cm *corsMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Re
 	cm.next.ServeHTTP(writer, request)
 }
 
+func init() {
+	Register(Registration{Name: "cors", Position: 80, New: NewCors})
+}
+
+// NewCors returns the middleware adding CORS headers to responses for
+// containers whose policy allows the request's Origin.  Containers without
+// any CORS metadata of their own get the cluster's default policy, if one is
+// configured:
+//
+//	[filter:cors]
+//	default_allow_origin = https://app.example.com https://admin.example.com
+//	default_expose_headers = X-Object-Meta-Color
+//	default_max_age = 3600
+//
+// The options middleware answers preflight requests from the same settings
+// in its own [filter:options] section.
 func NewCors(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	defaults := corsDefaults(config)
 	return func(next http.Handler) http.Handler {
 		return &corsMiddleware{
-			next: next,
+			next:     next,
+			defaults: defaults,
 		}
 	}, nil
 }
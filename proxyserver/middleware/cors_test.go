@@ -22,6 +22,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common/conf"
 	"github.com/troubling/hummingbird/common/test"
 )
 
@@ -63,3 +64,29 @@ func TestHandleCorsSpec(t *testing.T) {
 	require.True(t, strings.Index(theHeader.Get("Access-Control-Expose-Headers"), "a, b") >= 0)
 	require.Equal(t, status, 200)
 }
+
+func TestHandleCorsDefaults(t *testing.T) {
+	config, err := conf.StringConfig("[filter:cors]\ndefault_allow_origin = app.com\ndefault_expose_headers = X-Object-Meta-Color\n")
+	require.Nil(t, err)
+	defaults := corsDefaults(config.GetSection("filter:cors"))
+	require.Equal(t, map[string]string{"Access-Control-Allow-Origin": "app.com", "Access-Control-Expose-Headers": "X-Object-Meta-Color"}, defaults)
+	require.Nil(t, corsDefaults(config.GetSection("filter:other")))
+
+	theHeader := make(http.Header, 1)
+	fakeWriter := test.MockResponseWriter{SaveHeader: &theHeader}
+	// without defaults, there's no policy
+	c := &cors{origin: "app.com", ci: &client.ContainerInfo{Metadata: map[string]string{}}}
+	c.HandleCors(fakeWriter, 200)
+	require.Equal(t, "", theHeader.Get("Access-Control-Allow-Origin"))
+
+	c.defaults = defaults
+	c.HandleCors(fakeWriter, 200)
+	require.Equal(t, "app.com", theHeader.Get("Access-Control-Allow-Origin"))
+	require.True(t, strings.Contains(theHeader.Get("Access-Control-Expose-Headers"), "x-object-meta-color"))
+
+	theHeader = make(http.Header, 1)
+	fakeWriter = test.MockResponseWriter{SaveHeader: &theHeader}
+	c.ci.Metadata["Access-Control-Allow-Origin"] = "there.com"
+	c.HandleCors(fakeWriter, 200)
+	require.Equal(t, "", theHeader.Get("Access-Control-Allow-Origin"))
+}
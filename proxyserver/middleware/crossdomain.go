@@ -37,6 +37,10 @@ func crossdomain(policy string, requestsMetric tally.Counter) func(http.Handler)
 	}
 }
 
+func init() {
+	Register(Registration{Name: "crossdomain", Position: 70, New: NewCrossDomain})
+}
+
 func NewCrossDomain(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("crossdomain", map[string]interface{}{})
 	defaultPolicy := `<allow-access-from domain="*" secure="false" />`
@@ -0,0 +1,161 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+const compressedSysmetaHeader = "X-Object-Sysmeta-Compressed"
+
+var errCompressedEtagMismatch = errors.New("compressed body does not match etag")
+var errDecompressedTooLarge = errors.New("decompressed body too large")
+
+// gunzipReader streams the decompressed form of a gzip request body, checking
+// the compressed bytes against the client's etag and the decompressed size
+// against the maximum object size as it goes.
+type gunzipReader struct {
+	compressed io.ReadCloser
+	gz         *gzip.Reader
+	hash       hash.Hash
+	etag       string
+	maxSize    int64
+	size       int64
+	err        error
+}
+
+func (g *gunzipReader) Read(b []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.gz == nil {
+		if g.gz, g.err = gzip.NewReader(io.TeeReader(g.compressed, g.hash)); g.err != nil {
+			return 0, g.err
+		}
+	}
+	n, err := g.gz.Read(b)
+	g.size += int64(n)
+	if g.size > g.maxSize {
+		g.err = errDecompressedTooLarge
+		return 0, g.err
+	}
+	if err == io.EOF && g.etag != "" {
+		// drain any trailing bytes so the hash covers the whole upload
+		io.Copy(g.hash, g.compressed)
+		if fmt.Sprintf("%x", g.hash.Sum(nil)) != g.etag {
+			g.err = errCompressedEtagMismatch
+			return 0, g.err
+		}
+	}
+	if err != nil && err != io.EOF {
+		g.err = err
+	}
+	return n, err
+}
+
+func (g *gunzipReader) Close() error {
+	return g.compressed.Close()
+}
+
+type decompressPut struct {
+	next    http.Handler
+	store   bool
+	maxSize int64
+	metric  tally.Counter
+}
+
+func (d *decompressPut) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "PUT" || !strings.EqualFold(strings.TrimSpace(request.Header.Get("Content-Encoding")), "gzip") {
+		d.next.ServeHTTP(writer, request)
+		return
+	}
+	if _, _, _, obj := getPathParts(request); obj == "" {
+		d.next.ServeHTTP(writer, request)
+		return
+	}
+	d.metric.Inc(1)
+	if d.store {
+		// Keep the body as sent; the Content-Encoding is stored with the
+		// object and the flag lets other middlewares know the stored bytes
+		// aren't the logical content.
+		request.Header.Set(compressedSysmetaHeader, "gzip")
+		d.next.ServeHTTP(writer, request)
+		return
+	}
+	gr := &gunzipReader{
+		compressed: request.Body,
+		hash:       md5.New(),
+		etag:       strings.ToLower(strings.Trim(request.Header.Get("Etag"), "\"")),
+		maxSize:    d.maxSize,
+	}
+	request.Body = gr
+	request.Header.Del("Content-Encoding")
+	request.Header.Del("Etag")
+	request.Header.Del("Content-Length")
+	request.ContentLength = -1
+	request.TransferEncoding = []string{"chunked"}
+	d.next.ServeHTTP(srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+		switch gr.err {
+		case nil:
+			return status
+		case errCompressedEtagMismatch:
+			return http.StatusUnprocessableEntity
+		case errDecompressedTooLarge:
+			return http.StatusRequestEntityTooLarge
+		default:
+			return http.StatusBadRequest
+		}
+	}), request)
+}
+
+func init() {
+	Register(Registration{Name: "decompress", Position: 170, New: NewDecompress})
+}
+
+// NewDecompress handles object PUTs sent with "Content-Encoding: gzip". By
+// default the body is decompressed as it streams to the object servers so the
+// stored object, etag and length are those of the uncompressed content; with
+// "mode = store" the compressed bytes are stored as-is and the object is
+// flagged as compressed in sysmeta.
+func NewDecompress(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	mode := config.GetDefault("mode", "decompress")
+	if mode != "decompress" && mode != "store" {
+		return nil, fmt.Errorf("Invalid decompress mode %q", mode)
+	}
+	maxSize := config.GetInt("max_decompressed_size", common.MAX_FILE_SIZE)
+	RegisterInfo("decompress", map[string]interface{}{"mode": mode, "max_decompressed_size": maxSize})
+	metric := metricsScope.Counter("decompress_puts")
+	return func(next http.Handler) http.Handler {
+		return &decompressPut{next: next, store: mode == "store", maxSize: maxSize, metric: metric}
+	}, nil
+}
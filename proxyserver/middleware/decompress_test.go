@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(data))
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	return buf.Bytes()
+}
+
+func newTestDecompress(t *testing.T, configString string, next http.Handler) http.Handler {
+	config, err := conf.StringConfig("[filter:decompress]\nenabled = true\n" + configString)
+	require.Nil(t, err)
+	mid, err := NewDecompress(config.GetSection("filter:decompress"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(next)
+}
+
+func TestDecompressPut(t *testing.T) {
+	var gotBody []byte
+	var gotHeader http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		var err error
+		if gotBody, err = ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(201)
+	})
+	h := newTestDecompress(t, "", next)
+
+	body := gzipped(t, "some log lines")
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	req.Header.Set("Etag", fmt.Sprintf("%x", md5.Sum(body)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "some log lines", string(gotBody))
+	require.Equal(t, "", gotHeader.Get("Content-Encoding"))
+	require.Equal(t, "", gotHeader.Get("Content-Length"))
+	require.Equal(t, "", gotHeader.Get("Etag"))
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Etag", "d41d8cd98f00b204e9800998ecf8427e")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader([]byte("not gzip")))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDecompressPutTooLarge(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(201)
+	})
+	h := newTestDecompress(t, "max_decompressed_size = 4", next)
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(gzipped(t, "more than four bytes")))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestDecompressStoreMode(t *testing.T) {
+	var gotHeader http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(201)
+	})
+	h := newTestDecompress(t, "mode = store", next)
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(gzipped(t, "data")))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "gzip", gotHeader.Get("Content-Encoding"))
+	require.Equal(t, "gzip", gotHeader.Get("X-Object-Sysmeta-Compressed"))
+
+	config, err := conf.StringConfig("[filter:decompress]\nenabled = true\nmode = bogus")
+	require.Nil(t, err)
+	_, err = NewDecompress(config.GetSection("filter:decompress"), common.NewTestScope())
+	require.NotNil(t, err)
+}
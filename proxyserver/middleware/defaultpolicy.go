@@ -0,0 +1,135 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+const (
+	clientDefaultPolicy  = "X-Account-Default-Storage-Policy"
+	sysmetaDefaultPolicy = "X-Account-Sysmeta-Default-Storage-Policy"
+)
+
+type defaultPolicy struct {
+	next     http.Handler
+	policies conf.PolicyList
+	applied  tally.Counter
+}
+
+// handleAccount lets reseller admins set the account's default policy, which
+// must name a policy in use, and shows it on account HEAD and GET.
+func (d *defaultPolicy) handleAccount(writer http.ResponseWriter, request *http.Request) {
+	ctx := GetProxyContext(request)
+	if request.Method == "PUT" || request.Method == "POST" {
+		if _, ok := request.Header[clientDefaultPolicy]; ok {
+			if ctx.Authorize != nil {
+				if ok, st := ctx.Authorize(request); !ok {
+					srv.StandardResponse(writer, st)
+					return
+				}
+			}
+			if !isResellerAdmin(ctx) {
+				srv.StandardResponse(writer, http.StatusForbidden)
+				return
+			}
+			value := request.Header.Get(clientDefaultPolicy)
+			if value != "" {
+				policy := d.policies.NameLookup(value)
+				if policy == nil || policy.Deprecated {
+					srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Invalid %s name %q", clientDefaultPolicy, value))
+					return
+				}
+				value = policy.Name
+			}
+			request.Header.Del(clientDefaultPolicy)
+			request.Header.Set(sysmetaDefaultPolicy, value)
+		}
+	} else if request.Method == "GET" || request.Method == "HEAD" {
+		writer = renameHeaders(writer, map[string]string{sysmetaDefaultPolicy: clientDefaultPolicy})
+	}
+	d.next.ServeHTTP(writer, request)
+}
+
+// accountDefault returns the account's default policy if it still names a
+// policy new containers can be given.
+func (d *defaultPolicy) accountDefault(ai *AccountInfo) string {
+	name := ai.SysMetadata["Default-Storage-Policy"]
+	if name == "" {
+		return ""
+	}
+	if policy := d.policies.NameLookup(name); policy != nil && !policy.Deprecated {
+		return policy.Name
+	}
+	return ""
+}
+
+func (d *defaultPolicy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	ctx := GetProxyContext(request)
+	if !apiReq || account == "" || ctx == nil {
+		d.next.ServeHTTP(writer, request)
+		return
+	}
+	if container == "" {
+		d.handleAccount(writer, request)
+		return
+	}
+	if obj == "" && request.Method == "PUT" && request.Header.Get("X-Storage-Policy") == "" && request.Header.Get("X-Storage-Class") == "" {
+		if ai, err := ctx.GetAccountInfo(request.Context(), account); err == nil {
+			// Only new containers get the default; sending a policy with a
+			// PUT to an existing container would get a 409 if it differs.
+			if name := d.accountDefault(ai); name != "" {
+				if _, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == client.ContainerNotFound {
+					request.Header.Set("X-Storage-Policy", name)
+					d.applied.Inc(1)
+				}
+			}
+		}
+	}
+	d.next.ServeHTTP(writer, request)
+}
+
+func init() {
+	Register(Registration{Name: "default_policy", Position: 160, New: NewDefaultPolicy})
+}
+
+// NewDefaultPolicy returns the middleware that lets reseller admins give an
+// account a default storage policy with X-Account-Default-Storage-Policy,
+// kept in account sysmeta.  Containers created in the account without an
+// X-Storage-Policy get that policy instead of the cluster default.
+func NewDefaultPolicy(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	policies, err := conf.GetPolicies()
+	if err != nil {
+		return nil, err
+	}
+	RegisterInfo("default_policy", map[string]interface{}{})
+	applied := metricsScope.Counter("default_policy_applied")
+	return func(next http.Handler) http.Handler {
+		return &defaultPolicy{next: next, policies: policies, applied: applied}
+	}, nil
+}
@@ -0,0 +1,138 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+var defaultPolicyList = conf.PolicyList(map[int]*conf.Policy{
+	0: {Index: 0, Type: "replication", Name: "gold", Aliases: []string{}, Default: true},
+	1: {Index: 1, Type: "replication", Name: "silver", Aliases: []string{"cheap"}},
+	2: {Index: 2, Type: "replication", Name: "bronze", Aliases: []string{}, Deprecated: true},
+})
+
+func defaultPolicyRequest(t *testing.T, method, path string, sysmeta map[string]string) (*http.Request, *ProxyContext) {
+	f, err := client.NewProxyClient(defaultPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		Logger: zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/new":      nil,
+			"container/a/existing": {},
+		}, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{
+			"account/a": {Metadata: map[string]string{}, SysMetadata: sysmeta},
+		},
+	}
+	req, err := http.NewRequest(method, path, nil)
+	require.Nil(t, err)
+	return SetProxyContext(req, ctx), ctx
+}
+
+func TestDefaultPolicySetOnAccount(t *testing.T) {
+	var gotHeader http.Header
+	h := &defaultPolicy{policies: defaultPolicyList, applied: common.NewTestScope().Counter("applied"),
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotHeader = r.Header
+			w.WriteHeader(204)
+		})}
+
+	req, _ := defaultPolicyRequest(t, "POST", "/v1/a", nil)
+	req.Header.Set("X-Account-Default-Storage-Policy", "silver")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req, ctx := defaultPolicyRequest(t, "POST", "/v1/a", nil)
+	ctx.ResellerRequest = true
+	req.Header.Set("X-Account-Default-Storage-Policy", "cheap")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "silver", gotHeader.Get("X-Account-Sysmeta-Default-Storage-Policy"))
+	require.Equal(t, "", gotHeader.Get("X-Account-Default-Storage-Policy"))
+
+	for _, name := range []string{"bronze", "platinum"} {
+		req, ctx = defaultPolicyRequest(t, "POST", "/v1/a", nil)
+		ctx.ResellerRequest = true
+		req.Header.Set("X-Account-Default-Storage-Policy", name)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		require.Equal(t, 400, w.Code)
+	}
+
+	req, ctx = defaultPolicyRequest(t, "POST", "/v1/a", nil)
+	ctx.ResellerRequest = true
+	req.Header.Set("X-Account-Default-Storage-Policy", "")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	v, ok := gotHeader["X-Account-Sysmeta-Default-Storage-Policy"]
+	require.True(t, ok)
+	require.Equal(t, []string{""}, v)
+}
+
+func TestDefaultPolicyShownOnAccount(t *testing.T) {
+	h := &defaultPolicy{policies: defaultPolicyList, next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Account-Sysmeta-Default-Storage-Policy", "silver")
+		w.WriteHeader(204)
+	})}
+	req, _ := defaultPolicyRequest(t, "HEAD", "/v1/a", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "silver", w.Header().Get("X-Account-Default-Storage-Policy"))
+}
+
+func TestDefaultPolicyContainerPut(t *testing.T) {
+	var gotPolicy string
+	applied := common.NewTestScope().Counter("default_policy_applied")
+	h := &defaultPolicy{policies: defaultPolicyList, applied: applied,
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPolicy = r.Header.Get("X-Storage-Policy")
+			w.WriteHeader(201)
+		})}
+	do := func(path, policy string, sysmeta map[string]string) string {
+		gotPolicy = ""
+		req, _ := defaultPolicyRequest(t, "PUT", path, sysmeta)
+		if policy != "" {
+			req.Header.Set("X-Storage-Policy", policy)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return gotPolicy
+	}
+	silver := map[string]string{"Default-Storage-Policy": "silver"}
+
+	require.Equal(t, "silver", do("/v1/a/new", "", silver))
+	require.Equal(t, "gold", do("/v1/a/new", "gold", silver))
+	require.Equal(t, "", do("/v1/a/existing", "", silver))
+	require.Equal(t, "", do("/v1/a/new", "", nil))
+	require.Equal(t, "", do("/v1/a/new", "", map[string]string{"Default-Storage-Policy": "bronze"}))
+	require.Equal(t, "", do("/v1/a/new/o", "", silver))
+	require.Equal(t, int64(1), applied.(*common.TestCounter).Value())
+}
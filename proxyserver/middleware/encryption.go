@@ -0,0 +1,786 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	customerAlgorithmHeader = "X-Object-Encryption-Customer-Algorithm"
+	customerKeyHeader       = "X-Object-Encryption-Customer-Key"
+	customerKeyMD5Header    = "X-Object-Encryption-Customer-Key-Md5"
+	cryptoIVSysmetaHeader   = "X-Object-Sysmeta-Crypto-Iv"
+	cryptoKeyCheckHeader    = "X-Object-Sysmeta-Crypto-Key-Check"
+	cryptoKeyIDHeader       = "X-Object-Sysmeta-Crypto-Key-Id"
+	customerAlgorithm       = "AES256"
+	clientEncryptNames      = "X-Container-Encrypt-Names"
+	sysmetaEncryptNames     = "X-Container-Sysmeta-Crypto-Names"
+	cryptoEtagHeader        = "X-Object-Sysmeta-Crypto-Etag"
+	cryptoEtagMacHeader     = "X-Object-Sysmeta-Crypto-Etag-Mac"
+	listingEtagHeader       = "X-Object-Sysmeta-Container-Update-Override-Etag"
+	// listingKeyIDParam follows an etag encrypted for container listings,
+	// naming the root secret its key was derived from.
+	listingKeyIDParam = "; key_id="
+	// maxEncryptedNameLength keeps an object's alias, its iv and encrypted
+	// name base64 encoded, within the object name length limit.
+	maxEncryptedNameLength = common.MAX_OBJECT_NAME_LENGTH*3/4 - aes.BlockSize
+)
+
+var errEncryptedEtagMismatch = errors.New("encrypted body does not match etag")
+
+// customerKey returns the key a client supplied with the customer key
+// headers, or nil if it didn't send one.
+func customerKey(h http.Header) ([]byte, error) {
+	algorithm, encodedKey, keyMD5 := h.Get(customerAlgorithmHeader), h.Get(customerKeyHeader), h.Get(customerKeyMD5Header)
+	if algorithm == "" && encodedKey == "" && keyMD5 == "" {
+		return nil, nil
+	}
+	if algorithm != customerAlgorithm {
+		return nil, fmt.Errorf("%s must be %s.", customerAlgorithmHeader, customerAlgorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s must be a base64 encoded 256-bit key.", customerKeyHeader)
+	}
+	sum := md5.Sum(key)
+	if keyMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("%s does not match the key.", customerKeyMD5Header)
+	}
+	return key, nil
+}
+
+// keyCheck is stored with an object so that later requests can be checked
+// against the key it was written with, without storing the key itself.
+func keyCheck(key, iv []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(iv)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encryptValue encrypts a metadata value with a random iv, which is kept with
+// it.
+func encryptValue(key []byte, value string) (string, error) {
+	raw := make([]byte, aes.BlockSize+len(value))
+	if _, err := rand.Read(raw[:aes.BlockSize]); err != nil {
+		return "", err
+	}
+	block, _ := aes.NewCipher(key)
+	cipher.NewCTR(block, raw[:aes.BlockSize]).XORKeyStream(raw[aes.BlockSize:], []byte(value))
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// decryptValue decrypts a metadata value encrypted by encryptValue.
+func decryptValue(key []byte, encrypted string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < aes.BlockSize {
+		return "", errors.New("encrypted value too short")
+	}
+	value := make([]byte, len(raw)-aes.BlockSize)
+	block, _ := aes.NewCipher(key)
+	cipher.NewCTR(block, raw[:aes.BlockSize]).XORKeyStream(value, raw[aes.BlockSize:])
+	return string(value), nil
+}
+
+// etagMac is stored with an encrypted object so the object server can
+// evaluate If-Match and If-None-Match against its plaintext etag.
+func etagMac(key []byte, etag string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(etag))
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
+
+// macConditions adds the macs of the etags in a request's If-Match and
+// If-None-Match, and points the object server at encrypted objects' etag
+// macs, so conditional requests work against their plaintext etags.  Objects
+// that aren't encrypted are still compared with the etags as sent.
+func macConditions(request *http.Request, key []byte) {
+	conditional := false
+	for header, parse := range map[string]func(string) map[string]bool{
+		"If-Match":      common.ParseIfMatch,
+		"If-None-Match": common.ParseIfNoneMatch,
+	} {
+		values := request.Header.Get(header)
+		var macs []string
+		for etag := range parse(values) {
+			if etag != "*" {
+				macs = append(macs, "\""+etagMac(key, etag)+"\"")
+			}
+		}
+		if len(macs) > 0 {
+			request.Header.Set(header, values+", "+strings.Join(macs, ", "))
+			conditional = true
+		}
+	}
+	if conditional {
+		updateEtagIsAt(request, cryptoEtagMacHeader)
+	}
+}
+
+// ctrStreamAt returns an AES-CTR stream positioned offset bytes into the
+// object, so range responses can be decrypted.
+func ctrStreamAt(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, iv)
+	carry := uint64(offset / aes.BlockSize)
+	for i := aes.BlockSize - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(block, counter)
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream
+}
+
+// encryptReader encrypts a request body as it's read, checking the plaintext
+// against the client's etag.  Its etag is sent on to the object servers in a
+// metadata footer, encrypted with the object's key and, if listingKey is set,
+// with that for the container's listings.
+type encryptReader struct {
+	body         io.ReadCloser
+	stream       cipher.Stream
+	hash         hash.Hash
+	etag         string
+	key          []byte
+	listingKey   []byte
+	listingKeyID string
+	eof          bool
+	err          error
+}
+
+func (e *encryptReader) Read(b []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.body.Read(b)
+	e.hash.Write(b[:n])
+	e.stream.XORKeyStream(b[:n], b[:n])
+	if err == io.EOF && e.etag != "" && fmt.Sprintf("%x", e.hash.Sum(nil)) != e.etag {
+		e.err = errEncryptedEtagMismatch
+		return 0, e.err
+	}
+	if err == io.EOF {
+		e.eof = true
+	}
+	return n, err
+}
+
+func (e *encryptReader) Close() error {
+	return e.body.Close()
+}
+
+// plainEtag returns the etag of the plaintext, once it's all been read.
+func (e *encryptReader) plainEtag() string {
+	if !e.eof {
+		return ""
+	}
+	return fmt.Sprintf("%x", e.hash.Sum(nil))
+}
+
+// Footers returns the encrypted plaintext etag for the object's metadata.
+func (e *encryptReader) Footers() map[string]string {
+	etag := e.plainEtag()
+	if etag == "" {
+		return nil
+	}
+	encrypted, err := encryptValue(e.key, etag)
+	if err != nil {
+		return nil
+	}
+	footers := map[string]string{
+		cryptoEtagHeader:    encrypted,
+		cryptoEtagMacHeader: etagMac(e.key, etag),
+	}
+	if e.listingKey != nil {
+		if encrypted, err = encryptValue(e.listingKey, etag); err == nil {
+			footers[listingEtagHeader] = encrypted + listingKeyIDParam + e.listingKeyID
+		}
+	}
+	return footers
+}
+
+// decryptWriter decides when the response headers are written whether the
+// object was encrypted, and with which key.  Objects encrypted with a
+// customer key are refused if the request's key doesn't match; objects
+// encrypted under a root secret get their key from the keymaster.
+type decryptWriter struct {
+	http.ResponseWriter
+	key       []byte
+	keymaster keymaster
+	path      string
+	decrypted tally.Counter
+	stream    cipher.Stream
+	discard   bool
+}
+
+func (w *decryptWriter) fail(status int, msg string) {
+	h := w.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	w.discard = true
+	srv.SimpleErrorResponse(w.ResponseWriter, status, msg)
+}
+
+func (w *decryptWriter) WriteHeader(status int) {
+	h := w.Header()
+	encodedIV := h.Get(cryptoIVSysmetaHeader)
+	if encodedIV == "" {
+		if w.key != nil && status/100 == 2 {
+			w.fail(http.StatusBadRequest, "The object was not encrypted with a customer key.")
+			return
+		}
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	key := w.key
+	if keyID := h.Get(cryptoKeyIDHeader); keyID != "" {
+		if w.key != nil {
+			w.fail(http.StatusBadRequest, "The object was not encrypted with a customer key.")
+			return
+		}
+		if w.keymaster == nil {
+			w.fail(http.StatusServiceUnavailable, "No keymaster is configured to decrypt the object.")
+			return
+		}
+		rootSecret, err := w.keymaster.secret(keyID)
+		if err != nil {
+			w.fail(http.StatusServiceUnavailable, "The object's root secret is not available.")
+			return
+		}
+		key = objectKey(rootSecret, w.path)
+	} else if key == nil {
+		w.fail(http.StatusBadRequest, "The object was encrypted with a customer key, which must be supplied.")
+		return
+	}
+	iv, err := base64.StdEncoding.DecodeString(encodedIV)
+	if err != nil || len(iv) != aes.BlockSize || !hmac.Equal([]byte(keyCheck(key, iv)), []byte(h.Get(cryptoKeyCheckHeader))) {
+		w.fail(http.StatusForbidden, "The key does not match the one the object was encrypted with.")
+		return
+	}
+	if encrypted := h.Get(cryptoEtagHeader); encrypted != "" {
+		if etag, err := decryptValue(key, encrypted); err == nil {
+			h.Set("Etag", "\""+etag+"\"")
+		}
+	}
+	h.Del(cryptoIVSysmetaHeader)
+	h.Del(cryptoKeyCheckHeader)
+	h.Del(cryptoKeyIDHeader)
+	h.Del(cryptoEtagHeader)
+	h.Del(cryptoEtagMacHeader)
+	if status == http.StatusOK || status == http.StatusPartialContent {
+		var offset int64
+		if status == http.StatusPartialContent {
+			if _, err := fmt.Sscanf(h.Get("Content-Range"), "bytes %d-", &offset); err != nil {
+				w.fail(http.StatusRequestedRangeNotSatisfiable, "Multiple ranges are not supported for encrypted objects.")
+				return
+			}
+		}
+		block, _ := aes.NewCipher(key)
+		w.stream = ctrStreamAt(block, iv, offset)
+		w.decrypted.Inc(1)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *decryptWriter) Write(b []byte) (int, error) {
+	if w.discard {
+		return len(b), nil
+	}
+	if w.stream != nil {
+		plain := make([]byte, len(b))
+		w.stream.XORKeyStream(plain, b)
+		return w.ResponseWriter.Write(plain)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// nameKey derives the key a container's object names are encrypted with.
+func nameKey(rootSecret []byte, account, container string) []byte {
+	return objectKey(rootSecret, "/v1/"+account+"/"+container)
+}
+
+// encryptName returns the alias an object is stored and listed under.  The
+// iv is an HMAC of the name, so a name always has the same alias and objects
+// can still be found by name, at the cost of revealing which names are equal.
+func encryptName(key []byte, name string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	alias := make([]byte, aes.BlockSize+len(name))
+	copy(alias, mac.Sum(nil)[:aes.BlockSize])
+	block, _ := aes.NewCipher(key)
+	cipher.NewCTR(block, alias[:aes.BlockSize]).XORKeyStream(alias[aes.BlockSize:], []byte(name))
+	return base64.RawURLEncoding.EncodeToString(alias)
+}
+
+// decryptName returns the name an alias was made from, or false if it isn't
+// an alias made with key, like the names of objects written before the
+// container's names were encrypted.
+func decryptName(key []byte, alias string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(alias)
+	if err != nil || len(raw) < aes.BlockSize {
+		return "", false
+	}
+	name := make([]byte, len(raw)-aes.BlockSize)
+	block, _ := aes.NewCipher(key)
+	cipher.NewCTR(block, raw[:aes.BlockSize]).XORKeyStream(name, raw[aes.BlockSize:])
+	mac := hmac.New(sha256.New, key)
+	mac.Write(name)
+	if !hmac.Equal(mac.Sum(nil)[:aes.BlockSize], raw[:aes.BlockSize]) {
+		return "", false
+	}
+	return string(name), true
+}
+
+// nameListingRecord is an object in a container listing, as the container
+// server renders it.
+type nameListingRecord struct {
+	XMLName      xml.Name          `xml:"object" json:"-"`
+	Name         string            `xml:"name" json:"name"`
+	LastModified string            `xml:"last_modified" json:"last_modified"`
+	Size         int64             `xml:"bytes" json:"bytes"`
+	ContentType  string            `xml:"content_type" json:"content_type"`
+	ETag         string            `xml:"hash" json:"hash"`
+	Tags         map[string]string `xml:"-" json:"tags,omitempty"`
+}
+
+// listingFormat returns the format a container listing was asked for in.
+func listingFormat(request *http.Request) string {
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		accept := request.Header.Get("Accept")
+		if strings.Contains(accept, "application/json") {
+			format = "json"
+		} else if strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml") {
+			format = "xml"
+		}
+	}
+	if format != "json" && format != "xml" {
+		format = "text"
+	}
+	return format
+}
+
+// subdirListingRecord is a subdir in a container listing, as the container
+// server renders it.
+type subdirListingRecord struct {
+	XMLName xml.Name `xml:"subdir" json:"-"`
+	Name2   string   `xml:"name,attr" json:"-"`
+	Name    string   `xml:"name" json:"subdir"`
+}
+
+// decryptListing passes the objects in a json container listing through
+// decrypt and renders it in format, returning the body and its content type.
+func decryptListing(listing []byte, decrypt func(*nameListingRecord), container, format string) ([]byte, string, error) {
+	var entries []*struct {
+		nameListingRecord
+		Subdir string `json:"subdir"`
+	}
+	if err := json.Unmarshal(listing, &entries); err != nil {
+		return nil, "", err
+	}
+	records := make([]interface{}, len(entries))
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		if entry.Subdir != "" {
+			records[i] = &subdirListingRecord{Name2: entry.Subdir, Name: entry.Subdir}
+			names[i] = entry.Subdir
+			continue
+		}
+		decrypt(&entry.nameListingRecord)
+		records[i] = &entry.nameListingRecord
+		names[i] = entry.Name
+	}
+	switch format {
+	case "json":
+		body, err := json.Marshal(records)
+		return body, "application/json; charset=utf-8", err
+	case "xml":
+		body, err := xml.Marshal(&struct {
+			XMLName xml.Name `xml:"container"`
+			Name    string   `xml:"name,attr"`
+			Objects []interface{}
+		}{Name: container, Objects: records})
+		return append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"), body...), "application/xml; charset=utf-8", err
+	}
+	var body []byte
+	for _, name := range names {
+		body = append(body, name+"\n"...)
+	}
+	return body, "text/plain; charset=utf-8", nil
+}
+
+type encryption struct {
+	next         http.Handler
+	keymaster    keymaster
+	encryptNames bool
+	encrypted    tally.Counter
+	decrypted    tally.Counter
+}
+
+// containerNameKey returns the key the container's object names are
+// encrypted with, or nil if they aren't.
+func (e *encryption) containerNameKey(request *http.Request, account, container string) ([]byte, error) {
+	ctx := GetProxyContext(request)
+	if ctx == nil {
+		return nil, nil
+	}
+	ci, err := ctx.C.GetContainerInfo(request.Context(), account, container)
+	if err != nil || ci.SysMetadata["Crypto-Names"] == "" {
+		return nil, nil
+	}
+	rootSecret, err := e.keymaster.secret(ci.SysMetadata["Crypto-Names"])
+	if err != nil {
+		return nil, err
+	}
+	return nameKey(rootSecret, account, container), nil
+}
+
+// listingEtag returns the plaintext of an etag encrypted for the container's
+// listings, or the etag as it is if it wasn't.  Keys are kept in keys by root
+// secret id for the rest of the listing.
+func (e *encryption) listingEtag(keys map[string][]byte, account, container, etag string) string {
+	i := strings.Index(etag, listingKeyIDParam)
+	if i < 0 {
+		return etag
+	}
+	keyID := etag[i+len(listingKeyIDParam):]
+	key, ok := keys[keyID]
+	if !ok {
+		if rootSecret, err := e.keymaster.secret(keyID); err == nil {
+			key = nameKey(rootSecret, account, container)
+		}
+		keys[keyID] = key
+	}
+	if key == nil {
+		return etag
+	}
+	if plain, err := decryptValue(key, etag[:i]); err == nil {
+		return plain
+	}
+	return etag
+}
+
+// listContainer serves a container listing with its objects' etags, and
+// their names if nameKey is set, decrypted.  It's fetched as json and
+// rendered in the format asked for; text listings of containers with plain
+// names have no etags and are passed through.  Listings of containers with
+// encrypted names stay in the order of the aliases, so markers work but
+// prefix and delimiter queries can't.
+func (e *encryption) listContainer(writer http.ResponseWriter, request *http.Request, account, container string, nameKey []byte) {
+	query := request.URL.Query()
+	format := listingFormat(request)
+	if nameKey != nil {
+		if query.Get("prefix") != "" || query.Get("delimiter") != "" || query["path"] != nil {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Prefix and delimiter listings are not supported for containers with encrypted names.")
+			return
+		}
+		for _, marker := range []string{"marker", "end_marker"} {
+			if v := query.Get(marker); v != "" {
+				query.Set(marker, encryptName(nameKey, v))
+			}
+		}
+	} else if format == "text" {
+		e.next.ServeHTTP(writer, request)
+		return
+	}
+	query.Set("format", "json")
+	request.URL.RawQuery = query.Encode()
+	cw := NewCaptureWriter()
+	e.next.ServeHTTP(cw, request)
+	for k, v := range cw.Header() {
+		writer.Header()[k] = v
+	}
+	if cw.status != http.StatusOK {
+		writer.WriteHeader(cw.status)
+		writer.Write(cw.body)
+		return
+	}
+	keys := map[string][]byte{}
+	body, contentType, err := decryptListing(cw.body, func(record *nameListingRecord) {
+		if nameKey != nil {
+			if name, ok := decryptName(nameKey, record.Name); ok {
+				record.Name = name
+			}
+		}
+		record.ETag = e.listingEtag(keys, account, container, record.ETag)
+	}, container, format)
+	if err != nil {
+		if ctx := GetProxyContext(request); ctx != nil {
+			ctx.Logger.Error("Error decrypting container listing", zap.Error(err))
+		}
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if len(body) == 0 {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(body)
+}
+
+func (e *encryption) handleContainer(writer http.ResponseWriter, request *http.Request, account, container string) {
+	if !e.encryptNames && request.Method != "GET" {
+		e.next.ServeHTTP(writer, request)
+		return
+	}
+	switch request.Method {
+	case "PUT":
+		v, ok := request.Header[clientEncryptNames]
+		if !ok {
+			break
+		}
+		request.Header.Del(clientEncryptNames)
+		if !common.LooksTrue(v[0]) {
+			break
+		}
+		// An existing container's names can't start being encrypted, since
+		// its objects would no longer be found under their names.
+		if ctx := GetProxyContext(request); ctx != nil {
+			if ci, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == nil {
+				if ci.SysMetadata["Crypto-Names"] == "" {
+					srv.SimpleErrorResponse(writer, http.StatusConflict, "Names can only be encrypted in new containers.")
+					return
+				}
+				break
+			}
+		}
+		keyID, _, err := e.keymaster.activeSecret()
+		if err != nil {
+			if ctx := GetProxyContext(request); ctx != nil {
+				ctx.Logger.Error("Error getting root secret", zap.Error(err))
+			}
+			srv.StandardResponse(writer, http.StatusServiceUnavailable)
+			return
+		}
+		request.Header.Set(sysmetaEncryptNames, keyID)
+	case "POST":
+		if _, ok := request.Header[clientEncryptNames]; ok {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Names can only be encrypted when the container is created.")
+			return
+		}
+	case "GET", "HEAD":
+		if e.encryptNames {
+			writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+				if w.Header().Get(sysmetaEncryptNames) != "" {
+					w.Header().Set(clientEncryptNames, "true")
+				}
+				w.Header().Del(sysmetaEncryptNames)
+				return status
+			})
+		}
+		if request.Method == "GET" {
+			var key []byte
+			if e.encryptNames {
+				var err error
+				if key, err = e.containerNameKey(request, account, container); err != nil {
+					srv.SimpleErrorResponse(writer, http.StatusServiceUnavailable, "The container's root secret is not available.")
+					return
+				}
+			}
+			e.listContainer(writer, request, account, container, key)
+			return
+		}
+	}
+	e.next.ServeHTTP(writer, request)
+}
+
+func (e *encryption) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	if !apiReq || container == "" {
+		e.next.ServeHTTP(writer, request)
+		return
+	}
+	if obj == "" {
+		if e.keymaster != nil {
+			e.handleContainer(writer, request, account, container)
+		} else {
+			e.next.ServeHTTP(writer, request)
+		}
+		return
+	}
+	if e.encryptNames {
+		key, err := e.containerNameKey(request, account, container)
+		if err != nil {
+			srv.SimpleErrorResponse(writer, http.StatusServiceUnavailable, "The container's root secret is not available.")
+			return
+		}
+		if key != nil {
+			if request.Method == "PUT" && len(obj) > maxEncryptedNameLength {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Object name length of %d longer than %d", len(obj), maxEncryptedNameLength))
+				return
+			}
+			request.URL.Path = "/v1/" + account + "/" + container + "/" + encryptName(key, obj)
+			request.URL.RawPath = ""
+		}
+	}
+	key, err := customerKey(request.Header)
+	if err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The customer key must never reach the backends.
+	request.Header.Del(customerAlgorithmHeader)
+	request.Header.Del(customerKeyHeader)
+	request.Header.Del(customerKeyMD5Header)
+	switch request.Method {
+	case "PUT":
+		var keyID, listingKeyID string
+		var rootSecret, listingKey []byte
+		if e.keymaster != nil {
+			listingKeyID, rootSecret, err = e.keymaster.activeSecret()
+			if err == nil {
+				listingKey = nameKey(rootSecret, account, container)
+			}
+		}
+		if key == nil {
+			if e.keymaster == nil {
+				e.next.ServeHTTP(writer, request)
+				return
+			}
+			if err != nil {
+				if ctx := GetProxyContext(request); ctx != nil {
+					ctx.Logger.Error("Error getting root secret", zap.Error(err))
+				}
+				srv.StandardResponse(writer, http.StatusServiceUnavailable)
+				return
+			}
+			keyID, key = listingKeyID, objectKey(rootSecret, request.URL.Path)
+		}
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			srv.StandardResponse(writer, http.StatusInternalServerError)
+			return
+		}
+		block, _ := aes.NewCipher(key)
+		er := &encryptReader{
+			body:         request.Body,
+			stream:       cipher.NewCTR(block, iv),
+			hash:         md5.New(),
+			etag:         strings.ToLower(strings.Trim(request.Header.Get("Etag"), "\"")),
+			key:          key,
+			listingKey:   listingKey,
+			listingKeyID: listingKeyID,
+		}
+		request.Body = er
+		// The object servers check the encrypted bytes against their own
+		// etag; any etag the client sent is checked against the plaintext by
+		// encryptReader instead, and the plaintext etag goes in a footer.
+		request.Header.Del("Etag")
+		request.Header.Set(cryptoIVSysmetaHeader, base64.StdEncoding.EncodeToString(iv))
+		request.Header.Set(cryptoKeyCheckHeader, keyCheck(key, iv))
+		if keyID != "" {
+			request.Header.Set(cryptoKeyIDHeader, keyID)
+		}
+		e.encrypted.Inc(1)
+		e.next.ServeHTTP(srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+			if er.err == errEncryptedEtagMismatch {
+				return http.StatusUnprocessableEntity
+			}
+			if etag := er.plainEtag(); etag != "" && status/100 == 2 {
+				w.Header().Set("Etag", etag)
+			}
+			return status
+		}), request)
+	case "GET", "HEAD":
+		if key != nil {
+			macConditions(request, key)
+		} else if e.keymaster != nil {
+			// Objects written under an earlier root secret won't match.
+			if _, rootSecret, err := e.keymaster.activeSecret(); err == nil {
+				macConditions(request, objectKey(rootSecret, request.URL.Path))
+			}
+		}
+		e.next.ServeHTTP(&decryptWriter{ResponseWriter: writer, key: key, keymaster: e.keymaster, path: request.URL.Path, decrypted: e.decrypted}, request)
+	default:
+		e.next.ServeHTTP(writer, request)
+	}
+}
+
+func init() {
+	Register(Registration{Name: "encryption", Position: 300, New: NewEncryption})
+}
+
+// NewEncryption returns the encryption middleware, which encrypts objects
+// with a key the client supplies on each request in the
+// X-Object-Encryption-Customer-Algorithm, -Key and -Key-Md5 headers, or, if a
+// keymaster is configured, with a key derived from the cluster's root secret
+// for objects PUT without one.  Objects are encrypted with AES-256 in CTR
+// mode; customer keys are never stored, only an HMAC of them used to refuse
+// GETs and HEADs made with the wrong key.  An encrypted object's plaintext
+// etag is kept, encrypted, in its sysmeta and returned by GETs and HEADs.
+// With a keymaster it's also encrypted for the container's listings, which
+// the proxy decrypts; without one, listings of objects encrypted with a
+// customer key show the etag of their encrypted bytes.
+//
+// With encrypt_names and a keymaster, containers created with
+// X-Container-Encrypt-Names: true also have their objects' names encrypted;
+// objects are stored under an encrypted alias and listings are decrypted by
+// the proxy.
+func NewEncryption(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	km, err := newKeymaster(config)
+	if err != nil {
+		return nil, err
+	}
+	encryptNames := config.GetBool("encrypt_names", false)
+	if encryptNames && km == nil {
+		return nil, errors.New("encrypt_names needs a keymaster")
+	}
+	RegisterInfo("encryption", map[string]interface{}{
+		"customer_key_algorithms": []string{customerAlgorithm},
+		"keymaster":               config.GetDefault("keymaster", ""),
+		"encrypt_names":           encryptNames,
+	})
+	encrypted := metricsScope.Counter("encrypted_puts")
+	decrypted := metricsScope.Counter("decrypted_gets")
+	return func(next http.Handler) http.Handler {
+		return &encryption{next: next, keymaster: km, encryptNames: encryptNames, encrypted: encrypted, decrypted: decrypted}
+	}, nil
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+// encryptionBackend is a single object store that understands simple
+// "bytes=start-end" ranges.
+type encryptionBackend struct {
+	body   []byte
+	header http.Header
+}
+
+func (b *encryptionBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(499)
+			return
+		}
+		if footers, ok := r.Body.(common.FooterSource); ok {
+			for k, v := range footers.Footers() {
+				r.Header.Set(k, v)
+			}
+		}
+		b.body, b.header = body, r.Header
+		w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum(body)))
+		w.WriteHeader(201)
+	case "GET", "HEAD":
+		for k := range b.header {
+			if strings.HasPrefix(k, "X-Object-Sysmeta-") {
+				w.Header().Set(k, b.header.Get(k))
+			}
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(b.body)))
+			w.WriteHeader(206)
+			w.Write(b.body[start : end+1])
+			return
+		}
+		w.WriteHeader(200)
+		w.Write(b.body)
+	}
+}
+
+func newTestEncryption(t *testing.T, next http.Handler) http.Handler {
+	config, err := conf.StringConfig("[filter:encryption]\nenabled = true\n")
+	require.Nil(t, err)
+	mid, err := NewEncryption(config.GetSection("filter:encryption"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(next)
+}
+
+func setCustomerKey(req *http.Request, key []byte) {
+	sum := md5.Sum(key)
+	req.Header.Set("X-Object-Encryption-Customer-Algorithm", "AES256")
+	req.Header.Set("X-Object-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("X-Object-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	backend := &encryptionBackend{}
+	h := newTestEncryption(t, backend)
+	key := bytes.Repeat([]byte("k"), 32)
+	plain := []byte("the quick brown fox jumps over the lazy dog, again and again")
+
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(plain))
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	req.Header.Set("Etag", fmt.Sprintf("%x", md5.Sum(plain)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.NotEqual(t, plain, backend.body)
+	require.Equal(t, len(plain), len(backend.body))
+	require.Equal(t, "", backend.header.Get("X-Object-Encryption-Customer-Key"))
+	require.NotEqual(t, "", backend.header.Get("X-Object-Sysmeta-Crypto-Iv"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, plain, w.Body.Bytes())
+	require.Equal(t, "", w.Header().Get("X-Object-Sysmeta-Crypto-Iv"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	req.Header.Set("Range", "bytes=21-40")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 206, w.Code)
+	require.Equal(t, plain[21:41], w.Body.Bytes())
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+	require.NotContains(t, w.Body.String(), "quick")
+
+	req, err = http.NewRequest("HEAD", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	setCustomerKey(req, bytes.Repeat([]byte("x"), 32))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+}
+
+func TestEncryptionBadRequests(t *testing.T) {
+	backend := &encryptionBackend{}
+	h := newTestEncryption(t, backend)
+	key := bytes.Repeat([]byte("k"), 32)
+
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader([]byte("data")))
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	req.Header.Set("X-Object-Encryption-Customer-Key-Md5", "wrong")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader([]byte("data")))
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	req.Header.Set("Etag", fmt.Sprintf("%x", md5.Sum([]byte("other data"))))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 422, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader([]byte("data")))
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "data", string(backend.body))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	setCustomerKey(req, key)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestEncryptionRootSecret(t *testing.T) {
+	backend := &encryptionBackend{}
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:encryption]\nenabled = true\nkeymaster = config\nencryption_root_secret = %s\n", testRootSecret('r')))
+	require.Nil(t, err)
+	mid, err := NewEncryption(config.GetSection("filter:encryption"), common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(backend)
+	plain := []byte("encrypted without the client having to know")
+
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(plain))
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.NotEqual(t, plain, backend.body)
+	require.Equal(t, "default", backend.header.Get("X-Object-Sysmeta-Crypto-Key-Id"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, plain, w.Body.Bytes())
+	require.Equal(t, "", w.Header().Get("X-Object-Sysmeta-Crypto-Key-Id"))
+
+	// The key is tied to the object's path.
+	req, err = http.NewRequest("GET", "/v1/a/c/other", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+}
+
+func TestEncryptName(t *testing.T) {
+	key := nameKey([]byte(testRootSecret('r')), "a", "c")
+	alias := encryptName(key, "some/object")
+	require.Equal(t, alias, encryptName(key, "some/object"))
+	require.NotEqual(t, alias, encryptName(key, "some/other"))
+	require.NotEqual(t, alias, encryptName(nameKey([]byte(testRootSecret('r')), "a", "c2"), "some/object"))
+	require.NotContains(t, alias, "/")
+	name, ok := decryptName(key, alias)
+	require.True(t, ok)
+	require.Equal(t, "some/object", name)
+	_, ok = decryptName(nameKey([]byte(testRootSecret('x')), "a", "c"), alias)
+	require.False(t, ok)
+	_, ok = decryptName(key, "plain-name")
+	require.False(t, ok)
+	require.True(t, len(encryptName(key, strings.Repeat("o", maxEncryptedNameLength))) <= common.MAX_OBJECT_NAME_LENGTH)
+}
+
+func TestDecryptListing(t *testing.T) {
+	key := nameKey([]byte(testRootSecret('r')), "a", "c")
+	listing := fmt.Sprintf(`[{"name":%q,"last_modified":"2018-01-01T00:00:00.000000","bytes":3,"content_type":"text/plain","hash":"abc"},{"name":"plain","last_modified":"2018-01-01T00:00:00.000000","bytes":0,"content_type":"text/plain","hash":"def"}]`, encryptName(key, "o1"))
+
+	decrypt := func(record *nameListingRecord) {
+		if name, ok := decryptName(key, record.Name); ok {
+			record.Name = name
+		}
+	}
+
+	body, contentType, err := decryptListing([]byte(listing), decrypt, "c", "json")
+	require.Nil(t, err)
+	require.Equal(t, "application/json; charset=utf-8", contentType)
+	require.Equal(t, `[{"name":"o1","last_modified":"2018-01-01T00:00:00.000000","bytes":3,"content_type":"text/plain","hash":"abc"},{"name":"plain","last_modified":"2018-01-01T00:00:00.000000","bytes":0,"content_type":"text/plain","hash":"def"}]`, string(body))
+
+	body, contentType, err = decryptListing([]byte(listing), decrypt, "c", "text")
+	require.Nil(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", contentType)
+	require.Equal(t, "o1\nplain\n", string(body))
+
+	body, _, err = decryptListing([]byte(listing), decrypt, "c", "xml")
+	require.Nil(t, err)
+	require.Contains(t, string(body), `<container name="c"><object><name>o1</name><last_modified>2018-01-01T00:00:00.000000</last_modified><bytes>3</bytes>`)
+
+	body, _, err = decryptListing([]byte("[]"), decrypt, "c", "text")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(body))
+
+	body, _, err = decryptListing([]byte(`[{"subdir":"dir/"}]`), decrypt, "c", "json")
+	require.Nil(t, err)
+	require.Equal(t, `[{"subdir":"dir/"}]`, string(body))
+	body, _, err = decryptListing([]byte(`[{"subdir":"dir/"}]`), decrypt, "c", "xml")
+	require.Nil(t, err)
+	require.Contains(t, string(body), `<subdir name="dir/"><name>dir/</name></subdir>`)
+}
+
+func TestEncryptionPlainEtag(t *testing.T) {
+	backend := &encryptionBackend{}
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:encryption]\nenabled = true\nkeymaster = config\nencryption_root_secret = %s\n", testRootSecret('r')))
+	require.Nil(t, err)
+	mid, err := NewEncryption(config.GetSection("filter:encryption"), common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(backend)
+	plain := []byte("the etag clients see is that of what they sent")
+	etag := fmt.Sprintf("%x", md5.Sum(plain))
+
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", bytes.NewReader(plain))
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, etag, w.Header().Get("Etag"))
+	require.NotContains(t, backend.header.Get("X-Object-Sysmeta-Crypto-Etag"), etag)
+	listingEtag := backend.header.Get("X-Object-Sysmeta-Container-Update-Override-Etag")
+	require.True(t, strings.HasSuffix(listingEtag, "; key_id=default"))
+
+	req, err = http.NewRequest("HEAD", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "\""+etag+"\"", w.Header().Get("Etag"))
+	require.Equal(t, "", w.Header().Get("X-Object-Sysmeta-Crypto-Etag"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("If-Match", etag)
+	mac := etagMac(objectKey([]byte(testRootSecret('r')), "/v1/a/c/o"), etag)
+	require.Equal(t, mac, backend.header.Get("X-Object-Sysmeta-Crypto-Etag-Mac"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, etag+", \""+mac+"\"", req.Header.Get("If-Match"))
+	require.Equal(t, "X-Object-Sysmeta-Crypto-Etag-Mac", req.Header.Get("X-Backend-Etag-Is-At"))
+
+	listing := fmt.Sprintf(`[{"name":"o","last_modified":"2018-01-01T00:00:00.000000","bytes":%d,"content_type":"text/plain","hash":%q}]`, len(plain), listingEtag)
+	h = mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "json", r.URL.Query().Get("format"))
+		w.WriteHeader(200)
+		w.Write([]byte(listing))
+	}))
+	req, err = http.NewRequest("GET", "/v1/a/c?format=json", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Body.String(), fmt.Sprintf(`"hash":%q`, etag))
+}
+
+func TestEncryptNamesNeedsKeymaster(t *testing.T) {
+	config, err := conf.StringConfig("[filter:encryption]\nenabled = true\nencrypt_names = true\n")
+	require.Nil(t, err)
+	_, err = NewEncryption(config.GetSection("filter:encryption"), common.NewTestScope())
+	require.NotNil(t, err)
+}
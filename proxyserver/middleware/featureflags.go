@@ -0,0 +1,218 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+const (
+	featureHeaderPrefix  = "X-Account-Feature-"
+	featureSysmetaPrefix = "X-Account-Sysmeta-Feature-"
+)
+
+// featureUses maps each feature that can be switched per account to a test
+// of whether a request would use it.
+var featureUses = map[string]func(request *http.Request, ctx *ProxyContext, container, obj string) bool{
+	"s3api": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		return ctx.S3Auth != nil
+	},
+	"tempurl": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		return common.StringInSlice(".tempurl", ctx.RemoteUsers)
+	},
+	"signedurl": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		return common.StringInSlice(".signedurl", ctx.RemoteUsers)
+	},
+	"formpost": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		return common.StringInSlice(".formpost", ctx.RemoteUsers)
+	},
+	"versioning": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		return obj == "" && container != "" && (request.Method == "PUT" || request.Method == "POST") &&
+			(request.Header.Get(CLIENT_VERSIONS_LOC) != "" || request.Header.Get(CLIENT_HISTORY_LOC) != "")
+	},
+	"object_lock": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		if request.Method != "PUT" && request.Method != "POST" {
+			return false
+		}
+		for _, h := range []string{CLIENT_RETENTION_PERIOD, CLIENT_CONTAINER_HOLD, CLIENT_RETAIN_UNTIL, CLIENT_OBJECT_HOLD} {
+			if request.Header.Get(h) != "" {
+				return true
+			}
+		}
+		return false
+	},
+	"tagging": func(request *http.Request, ctx *ProxyContext, container, obj string) bool {
+		if obj == "" || request.Method != "PUT" {
+			return false
+		}
+		for k := range request.Header {
+			if strings.HasPrefix(k, tagHeaderPrefix) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+type featureFlags struct {
+	next            http.Handler
+	defaultDisabled map[string]bool
+	denied          tally.Counter
+}
+
+func isResellerAdmin(ctx *ProxyContext) bool {
+	return ctx.ResellerRequest || common.StringInSlice(".reseller_admin", ctx.RemoteUsers)
+}
+
+// enabled reports whether the account's sysmeta, or failing that the
+// cluster default, allows the feature.
+func (f *featureFlags) enabled(ai *AccountInfo, feature string) bool {
+	for k, v := range ai.SysMetadata {
+		if strings.EqualFold(k, "Feature-"+strings.Replace(feature, "_", "-", -1)) {
+			return common.LooksTrue(v)
+		}
+	}
+	return !f.defaultDisabled[feature]
+}
+
+// handleAccount lets reseller admins set X-Account-Feature-<name> headers,
+// which are stored as account sysmeta and shown on account HEAD and GET.
+func (f *featureFlags) handleAccount(writer http.ResponseWriter, request *http.Request) {
+	ctx := GetProxyContext(request)
+	if request.Method == "PUT" || request.Method == "POST" {
+		var flags []string
+		for k := range request.Header {
+			if strings.HasPrefix(k, featureHeaderPrefix) {
+				flags = append(flags, k)
+			}
+		}
+		if len(flags) > 0 {
+			if ctx.Authorize != nil {
+				if ok, st := ctx.Authorize(request); !ok {
+					srv.StandardResponse(writer, st)
+					return
+				}
+			}
+			if !isResellerAdmin(ctx) {
+				srv.StandardResponse(writer, http.StatusForbidden)
+				return
+			}
+			for _, k := range flags {
+				feature := strings.Replace(strings.ToLower(k[len(featureHeaderPrefix):]), "-", "_", -1)
+				if _, ok := featureUses[feature]; !ok {
+					srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Unknown feature %q.", feature))
+					return
+				}
+				value := request.Header.Get(k)
+				if value != "" {
+					if common.LooksTrue(value) {
+						value = "true"
+					} else {
+						value = "false"
+					}
+				}
+				request.Header.Del(k)
+				request.Header.Set(featureSysmetaPrefix+k[len(featureHeaderPrefix):], value)
+			}
+		}
+	} else if request.Method == "GET" || request.Method == "HEAD" {
+		writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+			for k, v := range w.Header() {
+				if strings.HasPrefix(k, featureSysmetaPrefix) {
+					w.Header()[featureHeaderPrefix+k[len(featureSysmetaPrefix):]] = v
+				}
+			}
+			return status
+		})
+	}
+	f.next.ServeHTTP(writer, request)
+}
+
+func (f *featureFlags) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	ctx := GetProxyContext(request)
+	if !apiReq || account == "" || ctx == nil {
+		f.next.ServeHTTP(writer, request)
+		return
+	}
+	if container == "" {
+		f.handleAccount(writer, request)
+		return
+	}
+	var ai *AccountInfo
+	for feature, uses := range featureUses {
+		if !uses(request, ctx, container, obj) {
+			continue
+		}
+		if ai == nil {
+			var err error
+			if ai, err = ctx.GetAccountInfo(request.Context(), account); err != nil {
+				// Without the account's flags there's no telling whether
+				// the feature is allowed, so it isn't.
+				srv.StandardResponse(writer, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		if !f.enabled(ai, feature) {
+			f.denied.Inc(1)
+			srv.SimpleErrorResponse(writer, http.StatusForbidden, fmt.Sprintf("The %s feature is disabled for this account.", feature))
+			return
+		}
+	}
+	f.next.ServeHTTP(writer, request)
+}
+
+func init() {
+	Register(Registration{Name: "feature_flags", Position: 150, New: NewFeatureFlags})
+}
+
+// NewFeatureFlags returns the middleware that lets reseller admins switch
+// features on and off per account with X-Account-Feature-<name>: true or
+// false, kept in account sysmeta.  Requests that would use a feature the
+// account has switched off are refused with a 403.  Features listed in
+// default_disabled are off for accounts that don't say otherwise.
+func NewFeatureFlags(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	defaultDisabled := map[string]bool{}
+	for _, feature := range common.SliceFromCSV(strings.ToLower(config.GetDefault("default_disabled", ""))) {
+		if _, ok := featureUses[feature]; !ok {
+			return nil, fmt.Errorf("Unknown feature %q in default_disabled", feature)
+		}
+		defaultDisabled[feature] = true
+	}
+	var features []string
+	for feature := range featureUses {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	RegisterInfo("feature_flags", map[string]interface{}{"features": features})
+	denied := metricsScope.Counter("feature_disabled_requests")
+	return func(next http.Handler) http.Handler {
+		return &featureFlags{next: next, defaultDisabled: defaultDisabled, denied: denied}
+	}, nil
+}
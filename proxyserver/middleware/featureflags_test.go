@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func newTestFeatureFlags(t *testing.T, settings string, next http.Handler) http.Handler {
+	config, err := conf.StringConfig("[filter:feature_flags]\nenabled = true\n" + settings)
+	require.Nil(t, err)
+	mid, err := NewFeatureFlags(config.GetSection("filter:feature_flags"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(next)
+}
+
+func featureFlagsRequest(t *testing.T, method, path string, sysmeta map[string]string) (*http.Request, *ProxyContext) {
+	ctx := &ProxyContext{
+		accountInfoCache: map[string]*AccountInfo{
+			"account/a": {Metadata: map[string]string{}, SysMetadata: sysmeta},
+		},
+	}
+	req, err := http.NewRequest(method, path, nil)
+	require.Nil(t, err)
+	return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx)), ctx
+}
+
+func TestFeatureFlagsSetOnAccount(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestFeatureFlags(t, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(204)
+	}))
+
+	req, _ := featureFlagsRequest(t, "POST", "/v1/a", nil)
+	req.Header.Set("X-Account-Feature-Versioning", "off")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req, ctx := featureFlagsRequest(t, "POST", "/v1/a", nil)
+	ctx.RemoteUsers = []string{".reseller_admin"}
+	req.Header.Set("X-Account-Feature-Versioning", "off")
+	req.Header.Set("X-Account-Feature-Object-Lock", "yes")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "false", gotHeader.Get("X-Account-Sysmeta-Feature-Versioning"))
+	require.Equal(t, "true", gotHeader.Get("X-Account-Sysmeta-Feature-Object-Lock"))
+	require.Equal(t, "", gotHeader.Get("X-Account-Feature-Versioning"))
+
+	req, ctx = featureFlagsRequest(t, "POST", "/v1/a", nil)
+	ctx.ResellerRequest = true
+	req.Header.Set("X-Account-Feature-Teleportation", "on")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestFeatureFlagsShownOnAccount(t *testing.T) {
+	h := newTestFeatureFlags(t, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Account-Sysmeta-Feature-S3api", "false")
+		w.WriteHeader(204)
+	}))
+	req, _ := featureFlagsRequest(t, "HEAD", "/v1/a", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "false", w.Header().Get("X-Account-Feature-S3api"))
+}
+
+func TestFeatureFlagsEnforced(t *testing.T) {
+	h := newTestFeatureFlags(t, "default_disabled = tagging", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(201)
+	}))
+
+	req, _ := featureFlagsRequest(t, "PUT", "/v1/a/c", map[string]string{"Feature-Versioning": "false"})
+	req.Header.Set("X-Versions-Location", "old")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req, _ = featureFlagsRequest(t, "PUT", "/v1/a/c", map[string]string{})
+	req.Header.Set("X-Versions-Location", "old")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+
+	req, ctx := featureFlagsRequest(t, "GET", "/v1/a/c/o", map[string]string{"Feature-Tempurl": "false"})
+	ctx.RemoteUsers = []string{".tempurl"}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req, _ = featureFlagsRequest(t, "PUT", "/v1/a/c/o", map[string]string{})
+	req.Header.Set("X-Object-Tag-Color", "red")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req, _ = featureFlagsRequest(t, "PUT", "/v1/a/c/o", map[string]string{"Feature-Tagging": "true"})
+	req.Header.Set("X-Object-Tag-Color", "red")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+
+	req, ctx = featureFlagsRequest(t, "PUT", "/v1/a/c/o", map[string]string{"Feature-Tagging": "true"})
+	ctx.accountInfoCache["account/a"] = &AccountInfo{StatusCode: 503}
+	req.Header.Set("X-Object-Tag-Color", "red")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 503, w.Code)
+}
+
+func TestFeatureFlagsBadDefault(t *testing.T) {
+	config, err := conf.StringConfig("[filter:feature_flags]\nenabled = true\ndefault_disabled = teleportation")
+	require.Nil(t, err)
+	_, err = NewFeatureFlags(config.GetSection("filter:feature_flags"), common.NewTestScope())
+	require.NotNil(t, err)
+}
@@ -0,0 +1,285 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	federationPeerPrefix     = "peer_"
+	clientFederationPeer     = "X-Account-Federation-Peer"
+	sysmetaFederationPeer    = "X-Account-Sysmeta-Federation-Peer"
+	federationFromHeader     = "X-Federated-From"
+	defaultFederationTimeout = 30 * time.Second
+)
+
+// federationRequestHeaders are the client request headers passed on to a
+// peer cluster.
+var federationRequestHeaders = []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// federationPeer is another cluster objects may be read through from.
+type federationPeer struct {
+	name  string
+	url   string
+	token string
+}
+
+// notFoundWriter holds back a 404 response so the request can be tried
+// somewhere else.
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+func (w *notFoundWriter) WriteHeader(status int) {
+	if status == http.StatusNotFound {
+		w.notFound = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *notFoundWriter) Write(b []byte) (int, error) {
+	if w.notFound {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// cacheWriter feeds a local PUT of a federated object, giving up quietly if
+// the PUT stops reading so the client's response isn't affected.
+type cacheWriter struct {
+	w      *io.PipeWriter
+	failed bool
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if !c.failed {
+		if _, err := c.w.Write(b); err != nil {
+			c.failed = true
+		}
+	}
+	return len(b), nil
+}
+
+type federation struct {
+	next     http.Handler
+	peers    map[string]*federationPeer
+	cache    bool
+	client   common.HTTPClient
+	requests tally.Counter
+	cached   tally.Counter
+}
+
+func (f *federation) handleAccount(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "PUT", "POST":
+		v, ok := request.Header[clientFederationPeer]
+		if !ok {
+			break
+		}
+		ctx := GetProxyContext(request)
+		if ctx.Authorize != nil {
+			if ok, st := ctx.Authorize(request); !ok {
+				srv.StandardResponse(writer, st)
+				return
+			}
+		}
+		if !isResellerAdmin(ctx) {
+			srv.StandardResponse(writer, http.StatusForbidden)
+			return
+		}
+		if v[0] != "" && f.peers[v[0]] == nil {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Unknown federation peer %q.", v[0]))
+			return
+		}
+		request.Header.Set(sysmetaFederationPeer, v[0])
+		request.Header.Del(clientFederationPeer)
+	case "GET", "HEAD":
+		writer = renameHeaders(writer, map[string]string{sysmetaFederationPeer: clientFederationPeer})
+	}
+	f.next.ServeHTTP(writer, request)
+}
+
+// peerRequest reads the object from the peer cluster into writer, caching a
+// complete copy locally if configured to.
+func (f *federation) peerRequest(writer http.ResponseWriter, request *http.Request, peer *federationPeer, account, container, obj string) {
+	ctx := GetProxyContext(request)
+	peerReq, err := http.NewRequest(request.Method, strings.TrimRight(peer.url, "/")+common.Urlencode(fmt.Sprintf("/v1/%s/%s/%s", account, container, obj)), nil)
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	peerReq = peerReq.WithContext(request.Context())
+	for _, h := range federationRequestHeaders {
+		if v := request.Header.Get(h); v != "" {
+			peerReq.Header.Set(h, v)
+		}
+	}
+	if peer.token != "" {
+		peerReq.Header.Set("X-Auth-Token", peer.token)
+	} else if token := request.Header.Get("X-Auth-Token"); token != "" {
+		peerReq.Header.Set("X-Auth-Token", token)
+	}
+	peerReq.Header.Set("X-Trans-Id-Extra", ctx.TxId)
+	resp, err := f.client.Do(peerReq)
+	if err != nil {
+		ctx.Logger.Error("Error reading from federation peer", zap.String("peer", peer.name), zap.Error(err))
+		srv.StandardResponse(writer, http.StatusNotFound)
+		return
+	}
+	defer resp.Body.Close()
+	f.requests.Inc(1)
+	for k, v := range resp.Header {
+		writer.Header()[k] = v
+	}
+	writer.Header().Set(federationFromHeader, peer.name)
+	writer.WriteHeader(resp.StatusCode)
+	if request.Method == "HEAD" {
+		return
+	}
+	if !f.cache || resp.StatusCode != http.StatusOK || resp.ContentLength < 0 || request.Header.Get("Range") != "" ||
+		resp.Header.Get("X-Static-Large-Object") != "" || resp.Header.Get("X-Object-Manifest") != "" {
+		io.Copy(writer, resp.Body)
+		return
+	}
+	pr, pw := io.Pipe()
+	subreq, err := ctx.newSubrequest("PUT", common.Urlencode(request.URL.Path), pr, request, "federation")
+	if err != nil {
+		io.Copy(writer, resp.Body)
+		return
+	}
+	GetProxyContext(subreq).Authorize = okAuthFunc
+	subreq.ContentLength = resp.ContentLength
+	subreq.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	subreq.Header.Set("Etag", strings.Trim(resp.Header.Get("Etag"), "\""))
+	for k := range resp.Header {
+		if k == "Content-Type" || k == "Content-Encoding" || k == "Content-Disposition" || strings.HasPrefix(k, "X-Object-Meta-") {
+			subreq.Header.Set(k, resp.Header.Get(k))
+		}
+	}
+	done := make(chan int)
+	go func() {
+		cw := NewCaptureWriter()
+		ctx.serveHTTPSubrequest(cw, subreq)
+		pr.Close()
+		done <- cw.status
+	}()
+	_, err = io.Copy(writer, io.TeeReader(resp.Body, &cacheWriter{w: pw}))
+	pw.CloseWithError(err)
+	if status := <-done; status/100 == 2 {
+		f.cached.Inc(1)
+	} else {
+		ctx.Logger.Debug("Unable to cache federated object", zap.String("path", request.URL.Path), zap.Int("status", status))
+	}
+}
+
+func (f *federation) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	if !apiReq || account == "" {
+		f.next.ServeHTTP(writer, request)
+		return
+	}
+	if container == "" {
+		f.handleAccount(writer, request)
+		return
+	}
+	if obj == "" || (request.Method != "GET" && request.Method != "HEAD") {
+		f.next.ServeHTTP(writer, request)
+		return
+	}
+	ctx := GetProxyContext(request)
+	if ctx.Source == "federation" {
+		f.next.ServeHTTP(writer, request)
+		return
+	}
+	ai, err := ctx.GetAccountInfo(request.Context(), account)
+	if err != nil || f.peers[ai.SysMetadata["Federation-Peer"]] == nil {
+		f.next.ServeHTTP(writer, request)
+		return
+	}
+	// The local cluster answers 404 only once the request is authorized, so
+	// the peer is only asked on behalf of clients allowed to read the object.
+	nfw := &notFoundWriter{ResponseWriter: writer}
+	f.next.ServeHTTP(nfw, request)
+	if !nfw.notFound {
+		return
+	}
+	for k := range writer.Header() {
+		delete(writer.Header(), k)
+	}
+	f.peerRequest(writer, request, f.peers[ai.SysMetadata["Federation-Peer"]], account, container, obj)
+}
+
+func init() {
+	Register(Registration{Name: "federation", Position: 210, New: NewFederation})
+}
+
+// NewFederation returns the federation middleware, which reads objects the
+// local cluster doesn't have through from a peer cluster, for accounts a
+// reseller admin has opted in by setting X-Account-Federation-Peer to the
+// peer's name.  Peers are configured as peer_<name> = <url of the peer's
+// proxy>, with an optional peer_<name>_token to authenticate with instead of
+// the client's own token.  With cache = true, objects read from a peer are
+// also written locally, so an account can be moved between clusters without
+// its objects ever being unavailable.
+func NewFederation(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	peers := map[string]*federationPeer{}
+	for _, key := range config.Keys() {
+		if !strings.HasPrefix(key, federationPeerPrefix) || strings.HasSuffix(key, "_token") {
+			continue
+		}
+		name := key[len(federationPeerPrefix):]
+		peers[name] = &federationPeer{
+			name:  name,
+			url:   config.GetDefault(key, ""),
+			token: config.GetDefault(key+"_token", ""),
+		}
+		if !strings.HasPrefix(peers[name].url, "http://") && !strings.HasPrefix(peers[name].url, "https://") {
+			return nil, fmt.Errorf("Invalid url for federation peer %q", name)
+		}
+	}
+	var peerNames []string
+	for name := range peers {
+		peerNames = append(peerNames, name)
+	}
+	RegisterInfo("federation", map[string]interface{}{"peers": peerNames})
+	timeout := time.Duration(config.GetFloat("peer_timeout", defaultFederationTimeout.Seconds()) * float64(time.Second))
+	client := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: timeout}}
+	cache := config.GetBool("cache", false)
+	requests := metricsScope.Counter("federated_requests")
+	cached := metricsScope.Counter("federated_cached")
+	return func(next http.Handler) http.Handler {
+		return &federation{next: next, peers: peers, cache: cache, client: client, requests: requests, cached: cached}
+	}, nil
+}
@@ -0,0 +1,156 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"go.uber.org/zap"
+)
+
+func newTestFederation(next http.Handler, peerURL string) *federation {
+	scope := common.NewTestScope()
+	return &federation{
+		next:     next,
+		peers:    map[string]*federationPeer{"east": {name: "east", url: peerURL}},
+		client:   http.DefaultClient,
+		requests: scope.Counter("federated_requests"),
+		cached:   scope.Counter("federated_cached"),
+	}
+}
+
+func federationRequest(method, path, peer string) *http.Request {
+	req, _ := http.NewRequest(method, path, nil)
+	ctx := &ProxyContext{
+		Logger: zap.NewNop(),
+		accountInfoCache: map[string]*AccountInfo{
+			"account/a": {SysMetadata: map[string]string{"Federation-Peer": peer}},
+		},
+	}
+	return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+}
+
+func TestFederationReadThrough(t *testing.T) {
+	var peerPath, peerToken string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerPath = r.URL.Path
+		peerToken = r.Header.Get("X-Auth-Token")
+		w.Header().Set("Etag", "\"abc\"")
+		w.WriteHeader(200)
+		w.Write([]byte("remote"))
+	}))
+	defer peer.Close()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Local", "yes")
+		w.WriteHeader(404)
+		w.Write([]byte("<html>Not Found</html>"))
+	})
+	f := newTestFederation(next, peer.URL)
+
+	req := federationRequest("GET", "/v1/a/c/o", "east")
+	req.Header.Set("X-Auth-Token", "tok")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "remote", w.Body.String())
+	require.Equal(t, "east", w.Header().Get("X-Federated-From"))
+	require.Equal(t, "", w.Header().Get("X-Local"))
+	require.Equal(t, "/v1/a/c/o", peerPath)
+	require.Equal(t, "tok", peerToken)
+
+	f.peers["east"].token = "peertok"
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, federationRequest("GET", "/v1/a/c/o", "east"))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "peertok", peerToken)
+}
+
+func TestFederationLocalFirst(t *testing.T) {
+	peerCalled := false
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCalled = true
+		w.WriteHeader(200)
+	}))
+	defer peer.Close()
+	status := 200
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("local"))
+	})
+	f := newTestFederation(next, peer.URL)
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, federationRequest("GET", "/v1/a/c/o", "east"))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "local", w.Body.String())
+	require.False(t, peerCalled)
+
+	status = 404
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, federationRequest("GET", "/v1/a/c/o", ""))
+	require.Equal(t, 404, w.Code)
+	require.False(t, peerCalled)
+
+	status = 401
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, federationRequest("GET", "/v1/a/c/o", "east"))
+	require.Equal(t, 401, w.Code)
+	require.False(t, peerCalled)
+}
+
+func TestFederationAccountPeer(t *testing.T) {
+	var stored string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stored = r.Header.Get("X-Account-Sysmeta-Federation-Peer")
+		w.WriteHeader(204)
+	})
+	f := newTestFederation(next, "http://127.0.0.1:1")
+
+	req := federationRequest("POST", "/v1/a", "")
+	req.Header.Set("X-Account-Federation-Peer", "east")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+
+	req = federationRequest("POST", "/v1/a", "")
+	GetProxyContext(req).ResellerRequest = true
+	req.Header.Set("X-Account-Federation-Peer", "west")
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+
+	// Tempauth's reseller admins come as .reseller_admin users.
+	req = federationRequest("POST", "/v1/a", "")
+	GetProxyContext(req).RemoteUsers = []string{".reseller_admin"}
+	req.Header.Set("X-Account-Federation-Peer", "east")
+	w = httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "east", stored)
+}
+
+func TestNewFederationBadPeer(t *testing.T) {
+	config, err := conf.StringConfig("[filter:federation]\nenabled = true\npeer_east = east.example.com")
+	require.Nil(t, err)
+	_, err = NewFederation(config.GetSection("filter:federation"), common.NewTestScope())
+	require.NotNil(t, err)
+}
@@ -66,7 +66,7 @@ func (o *fpLimitReader) Read(p []byte) (int, error) {
 	return i, err
 }
 
-func authenticateFormpost(ctx context.Context, proxyCtx *ProxyContext, account, container, path string, attrs map[string]string) int {
+func authenticateFormpost(ctx context.Context, proxyCtx *ProxyContext, maxKeys int, account, container, path string, attrs map[string]string) int {
 	if expires, err := common.ParseDate(attrs["expires"]); err != nil {
 		return FP_ERROR
 	} else if time.Now().After(expires) {
@@ -85,18 +85,11 @@ func authenticateFormpost(ctx context.Context, proxyCtx *ProxyContext, account,
 		return hmac.Equal(sigb, mac.Sum(nil))
 	}
 
-	if ai, err := proxyCtx.GetAccountInfo(ctx, account); err == nil {
-		if key, ok := ai.Metadata["Temp-Url-Key"]; ok && checkhmac([]byte(key)) {
-			return FP_SCOPE_ACCOUNT
-		} else if key, ok := ai.Metadata["Temp-Url-Key-2"]; ok && checkhmac([]byte(key)) {
-			return FP_SCOPE_ACCOUNT
-		} else if ci, err := proxyCtx.C.GetContainerInfo(ctx, account, container); err == nil {
-			if key, ok := ci.Metadata["Temp-Url-Key"]; ok && checkhmac([]byte(key)) {
-				return FP_SCOPE_CONTAINER
-			} else if key, ok := ci.Metadata["Temp-Url-Key-2"]; ok && checkhmac([]byte(key)) {
-				return FP_SCOPE_CONTAINER
-			}
-		}
+	switch tempURLScope(ctx, proxyCtx, account, container, maxKeys, checkhmac) {
+	case SCOPE_ACCOUNT:
+		return FP_SCOPE_ACCOUNT
+	case SCOPE_CONTAINER:
+		return FP_SCOPE_CONTAINER
 	}
 	return FP_INVALID
 }
@@ -139,7 +132,7 @@ func formpostAuthorizer(scope int, account, container string) func(r *http.Reque
 	}
 }
 
-func formpost(formpostRequestsMetric tally.Counter) func(http.Handler) http.Handler {
+func formpost(formpostRequestsMetric tally.Counter, maxKeys int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			if request.Method != "POST" {
@@ -203,7 +196,7 @@ func formpost(formpostRequestsMetric tally.Counter) func(http.Handler) http.Hand
 							formpostRespond(writer, 400, "max_file_size not valid", attrs["redirect"])
 							return
 						}
-						scope := authenticateFormpost(request.Context(), ctx, account, container, request.URL.Path, attrs)
+						scope := authenticateFormpost(request.Context(), ctx, maxKeys, account, container, request.URL.Path, attrs)
 						switch scope {
 						case FP_EXPIRED:
 							formpostRespond(writer, 401, "Form Expired", attrs["redirect"])
@@ -264,7 +257,11 @@ func formpost(formpostRequestsMetric tally.Counter) func(http.Handler) http.Hand
 	}
 }
 
+func init() {
+	Register(Registration{Name: "formpost", Position: 90, New: NewFormPost})
+}
+
 func NewFormPost(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("formpost", map[string]interface{}{})
-	return formpost(metricsScope.Counter("formpost_requests")), nil
+	return formpost(metricsScope.Counter("formpost_requests"), tempURLMaxKeys(config)), nil
 }
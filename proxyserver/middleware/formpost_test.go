@@ -61,8 +61,8 @@ func makeFormpostRequest(t *testing.T, body, boundary string, next http.Handler)
 			next: next,
 		},
 	}
-	newr = newr.WithContext(context.WithValue(newr.Context(), "proxycontext", ctx))
-	formpost(common.NewTestScope().Counter("test_formpost"))(next).ServeHTTP(neww, newr)
+	newr = newr.WithContext(context.WithValue(newr.Context(), proxyContextKey{}, ctx))
+	formpost(common.NewTestScope().Counter("test_formpost"), 2)(next).ServeHTTP(neww, newr)
 	return neww
 }
 
@@ -187,30 +187,30 @@ func TestAuthenticateFormpost(t *testing.T) {
 	}
 
 	require.Equal(t, FP_ERROR,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "X"}))
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "X"}))
 	require.Equal(t, FP_EXPIRED,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "12345"}))
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "12345"}))
 	require.Equal(t, FP_ERROR,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999", "signature": "X"}))
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999", "signature": "X"}))
 
 	// account key 1
 	require.Equal(t, FP_SCOPE_ACCOUNT,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
 			"signature": "1d4cb17a0d70b32f7987fe49b1990020bab52ae6"}))
 	// account key 2
 	require.Equal(t, FP_SCOPE_ACCOUNT,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
 			"signature": "9749158451be0383af1ec6d8e10f09a2d0d5f2b1"}))
 	// container key 1
 	require.Equal(t, FP_SCOPE_CONTAINER,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
 			"signature": "3320ff06b119d287a1c8d18d4356cd91e8518fe7"}))
 	// container key 2
 	require.Equal(t, FP_SCOPE_CONTAINER,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
 			"signature": "a3c3dd56ad65f5b87eeb384f9e0406c79511b556"}))
 	// invalid key
 	require.Equal(t, FP_INVALID,
-		authenticateFormpost(context.Background(), pc, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
+		authenticateFormpost(context.Background(), pc, 2, "a", "c", "/v1/a/c", map[string]string{"expires": "9999999999",
 			"signature": "1111111111111111111111111111111111111111"}))
 }
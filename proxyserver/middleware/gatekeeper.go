@@ -0,0 +1,101 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+// excludeHeaders are the prefixes of headers that only the proxy and its
+// middleware may set.
+var excludeHeaders = []string{
+	"X-Account-Sysmeta-",
+	"X-Container-Sysmeta-",
+	"X-Object-Sysmeta-",
+	"X-Object-Transient-Sysmeta-",
+	"X-Backend-",
+}
+
+// hopByHopHeaders only mean something for a single connection, so they're
+// never passed between the client and the backend.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Upgrade",
+}
+
+// stripHeaders removes the sysmeta, backend and hop-by-hop headers from h,
+// along with any headers named in its Connection header.
+func stripHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(textproto.CanonicalMIMEHeaderKey(name))
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+	for k := range h {
+		for _, ex := range excludeHeaders {
+			if strings.HasPrefix(k, ex) {
+				delete(h, k)
+			}
+		}
+	}
+}
+
+// gatekeeper keeps clients from setting the headers that only the proxy and
+// its middleware are trusted to, and from seeing them in responses.
+// Subrequests pass through untouched, since middleware make them with sysmeta
+// of their own and need to read it back.
+func gatekeeper(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if ctx := GetProxyContext(request); ctx != nil && ctx.depth > 0 {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		stripHeaders(request.Header)
+		writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+			if v := w.Header().Get("X-Account-Sysmeta-Project-Domain-Id"); v != "" {
+				w.Header().Set("X-Account-Project-Domain-Id", v)
+			}
+			stripHeaders(w.Header())
+			return status
+		})
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func init() {
+	Register(Registration{Name: "gatekeeper", Position: 15, New: NewGatekeeper})
+}
+
+func NewGatekeeper(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	return gatekeeper, nil
+}
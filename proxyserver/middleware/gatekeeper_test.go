@@ -0,0 +1,82 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func TestGatekeeper(t *testing.T) {
+	var got http.Header
+	mid, err := NewGatekeeper(conf.Section{}, common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Header().Set("X-Object-Sysmeta-Crypto-Iv", "secret")
+		w.Header().Set("X-Backend-Timestamp", "1")
+		w.Header().Set("X-Account-Sysmeta-Project-Domain-Id", "default")
+		w.Header().Set("X-Object-Meta-Color", "blue")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("PUT", "/v1/a/c/o", nil)
+	req.Header.Set("X-Object-Sysmeta-Crypto-Iv", "forged")
+	req.Header.Set("X-Container-Sysmeta-Anything", "forged")
+	req.Header.Set("X-Backend-Storage-Policy-Index", "1")
+	req.Header.Set("Connection", "X-Private, keep-alive")
+	req.Header.Set("X-Private", "hop")
+	req.Header.Set("Keep-Alive", "300")
+	req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	req.Header.Set("X-Object-Meta-Color", "red")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, k := range []string{"X-Object-Sysmeta-Crypto-Iv", "X-Container-Sysmeta-Anything", "X-Backend-Storage-Policy-Index",
+		"Connection", "X-Private", "Keep-Alive", "Proxy-Authorization"} {
+		require.Empty(t, got.Get(k), k)
+	}
+	require.Equal(t, "red", got.Get("X-Object-Meta-Color"))
+	require.Empty(t, w.Header().Get("X-Object-Sysmeta-Crypto-Iv"))
+	require.Empty(t, w.Header().Get("X-Backend-Timestamp"))
+	require.Empty(t, w.Header().Get("X-Account-Sysmeta-Project-Domain-Id"))
+	require.Equal(t, "default", w.Header().Get("X-Account-Project-Domain-Id"))
+	require.Equal(t, "blue", w.Header().Get("X-Object-Meta-Color"))
+}
+
+func TestGatekeeperSubrequest(t *testing.T) {
+	var got http.Header
+	mid, err := NewGatekeeper(conf.Section{}, common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Header().Set("X-Object-Sysmeta-Versions-Location", "versions")
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("PUT", "/v1/a/c/o", nil)
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, &ProxyContext{depth: 1}))
+	req.Header.Set("X-Object-Sysmeta-Versions-Location", "versions")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, "versions", got.Get("X-Object-Sysmeta-Versions-Location"))
+	require.Equal(t, "versions", w.Header().Get("X-Object-Sysmeta-Versions-Location"))
+}
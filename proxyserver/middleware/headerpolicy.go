@@ -0,0 +1,130 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+// headerPolicyKeep are never removed by an allow_headers list, since clients
+// can't make sense of a response without them.
+var headerPolicyKeep = []string{"Content-Length", "Content-Range", "Content-Type", "Date", "Transfer-Encoding", "X-Trans-Id"}
+
+// headerPolicy decides which headers a response leaves the proxy with.
+type headerPolicy struct {
+	// allow, if not empty, are the only headers passed on, besides
+	// headerPolicyKeep.
+	allow []string
+	deny  []string
+	// add are set on every response, replacing any value it had.
+	add map[string]string
+}
+
+// headerMatches returns true if name is one of patterns, where a pattern
+// ending in * matches any header starting with the rest of it.
+func headerMatches(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, p[:len(p)-1]) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *headerPolicy) apply(h http.Header) {
+	for k := range h {
+		if len(p.allow) > 0 && !headerMatches(k, p.allow) && !headerMatches(k, headerPolicyKeep) {
+			delete(h, k)
+		} else if headerMatches(k, p.deny) {
+			delete(h, k)
+		}
+	}
+	for k, v := range p.add {
+		h.Set(k, v)
+	}
+}
+
+func headerPolicyMiddleware(policy *headerPolicy, requestsMetric tally.Counter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if ctx := GetProxyContext(request); ctx != nil && ctx.depth > 0 {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			requestsMetric.Inc(1)
+			writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+				policy.apply(w.Header())
+				return status
+			})
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// parseHeaderList splits a space or comma separated list of header names,
+// canonicalizing each.
+func parseHeaderList(value string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		if strings.HasSuffix(name, "*") {
+			names = append(names, textproto.CanonicalMIMEHeaderKey(name[:len(name)-1])+"*")
+		} else {
+			names = append(names, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+	return names
+}
+
+func init() {
+	Register(Registration{Name: "header_policy", Position: 5, New: NewHeaderPolicy})
+}
+
+// NewHeaderPolicy builds the header_policy middleware, which applies the
+// same header rules to every response the proxy sends, including the errors
+// from catch_errors:
+//
+//	[filter:header_policy]
+//	allow_headers =
+//	deny_headers = Server X-Powered-By X-Debug-*
+//	add_header_strict_transport_security = max-age=31536000; includeSubDomains
+//
+// An empty allow_headers passes every header deny_headers doesn't name.  Each
+// add_header_<name> setting sets the header, with underscores in its name
+// becoming dashes, after the lists are applied.
+func NewHeaderPolicy(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	policy := &headerPolicy{
+		allow: parseHeaderList(config.GetDefault("allow_headers", "")),
+		deny:  parseHeaderList(config.GetDefault("deny_headers", "")),
+		add:   map[string]string{},
+	}
+	for _, key := range config.Keys() {
+		if strings.HasPrefix(key, "add_header_") {
+			name := strings.Replace(strings.TrimPrefix(key, "add_header_"), "_", "-", -1)
+			policy.add[textproto.CanonicalMIMEHeaderKey(name)] = config.Section[key]
+		}
+	}
+	return headerPolicyMiddleware(policy, metricsScope.Counter("header_policy_requests")), nil
+}
@@ -0,0 +1,71 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func headerPolicyTestHandler(t *testing.T, settings string) http.Handler {
+	config, err := conf.StringConfig("[filter:header_policy]\n" + settings)
+	require.Nil(t, err)
+	mid, err := NewHeaderPolicy(config.GetSection("filter:header_policy"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Server", "hummingbird")
+		w.Header().Set("X-Debug-Node", "10.0.0.1")
+		w.Header().Set("X-Object-Meta-Color", "blue")
+		w.Header().Set("Etag", "abc")
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestHeaderPolicyDenyAndAdd(t *testing.T) {
+	h := headerPolicyTestHandler(t, "deny_headers = server, x-debug-*\nadd_header_strict_transport_security = max-age=31536000; includeSubDomains\n")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/a/c/o", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Server"))
+	require.Empty(t, w.Header().Get("X-Debug-Node"))
+	require.Equal(t, "blue", w.Header().Get("X-Object-Meta-Color"))
+	require.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestHeaderPolicyAllow(t *testing.T) {
+	h := headerPolicyTestHandler(t, "allow_headers = Etag X-Object-Meta-*\n")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/a/c/o", nil))
+	require.Equal(t, "blue", w.Header().Get("X-Object-Meta-Color"))
+	require.Equal(t, "abc", w.Header().Get("Etag"))
+	require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	require.Empty(t, w.Header().Get("Server"))
+	require.Empty(t, w.Header().Get("X-Debug-Node"))
+}
+
+func TestHeaderPolicyEmpty(t *testing.T) {
+	h := headerPolicyTestHandler(t, "")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/a/c/o", nil))
+	require.Equal(t, "hummingbird", w.Header().Get("Server"))
+	require.Equal(t, "10.0.0.1", w.Header().Get("X-Debug-Node"))
+}
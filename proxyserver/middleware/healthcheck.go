@@ -22,6 +22,10 @@ import (
 	"github.com/uber-go/tally"
 )
 
+func init() {
+	Register(Registration{Name: "healthcheck", Position: 20, New: NewHealthcheck})
+}
+
 func NewHealthcheck(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
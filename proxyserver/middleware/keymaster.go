@@ -0,0 +1,336 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+const rootSecretPrefix = "encryption_root_secret"
+
+// keymaster supplies the root secrets objects are encrypted under.  Each
+// secret has an id, stored with the objects encrypted under it, so objects
+// written before a rotation can still be read.
+type keymaster interface {
+	// activeSecret returns the secret new objects should be encrypted under.
+	activeSecret() (id string, secret []byte, err error)
+	// secret returns the secret with the given id.
+	secret(id string) ([]byte, error)
+}
+
+// objectKey derives the key for a single object from a root secret.
+func objectKey(rootSecret []byte, objPath string) []byte {
+	mac := hmac.New(sha256.New, rootSecret)
+	mac.Write([]byte(objPath))
+	return mac.Sum(nil)
+}
+
+func decodeRootSecret(encoded string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("root secret is not base64 encoded: %v", err)
+	}
+	if len(secret) < 32 {
+		return nil, errors.New("root secret must be at least 32 bytes")
+	}
+	return secret, nil
+}
+
+// configKeymaster reads root secrets from the config file:
+// encryption_root_secret has the id "default" and encryption_root_secret_<id>
+// any others, with active_root_secret_id choosing which one new objects use.
+type configKeymaster struct {
+	activeID string
+	secrets  map[string][]byte
+}
+
+func newConfigKeymaster(config conf.Section) (*configKeymaster, error) {
+	km := &configKeymaster{activeID: config.GetDefault("active_root_secret_id", "default"), secrets: map[string][]byte{}}
+	for _, key := range config.Keys() {
+		var id string
+		if key == rootSecretPrefix {
+			id = "default"
+		} else if strings.HasPrefix(key, rootSecretPrefix+"_") {
+			id = key[len(rootSecretPrefix)+1:]
+		} else {
+			continue
+		}
+		secret, err := decodeRootSecret(config.GetDefault(key, ""))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		km.secrets[id] = secret
+	}
+	if km.secrets[km.activeID] == nil {
+		return nil, fmt.Errorf("No root secret with the active id %q", km.activeID)
+	}
+	return km, nil
+}
+
+func (km *configKeymaster) activeSecret() (string, []byte, error) {
+	return km.activeID, km.secrets[km.activeID], nil
+}
+
+func (km *configKeymaster) secret(id string) ([]byte, error) {
+	if secret, ok := km.secrets[id]; ok {
+		return secret, nil
+	}
+	return nil, fmt.Errorf("No root secret with id %q", id)
+}
+
+// secretFetcher gets root secrets from an external key manager.
+type secretFetcher interface {
+	// fetch returns the secret with the given id, or the active secret and
+	// its id if id is "".
+	fetch(id string) (string, []byte, error)
+}
+
+// cachingKeymaster keeps the secrets a secretFetcher returns, asking again
+// for the active secret every ttl so that rotations are picked up.  Secrets
+// never change once they have an id, so those are kept indefinitely.
+type cachingKeymaster struct {
+	fetcher  secretFetcher
+	ttl      time.Duration
+	lock     sync.Mutex
+	activeID string
+	fetched  time.Time
+	secrets  map[string][]byte
+}
+
+func (km *cachingKeymaster) activeSecret() (string, []byte, error) {
+	km.lock.Lock()
+	defer km.lock.Unlock()
+	if km.activeID == "" || time.Since(km.fetched) > km.ttl {
+		id, secret, err := km.fetcher.fetch("")
+		if err != nil {
+			if km.activeID == "" {
+				return "", nil, err
+			}
+			// Keep using the secret we have until the key manager is back.
+			return km.activeID, km.secrets[km.activeID], nil
+		}
+		km.activeID = id
+		km.secrets[id] = secret
+		km.fetched = time.Now()
+	}
+	return km.activeID, km.secrets[km.activeID], nil
+}
+
+func (km *cachingKeymaster) secret(id string) ([]byte, error) {
+	km.lock.Lock()
+	defer km.lock.Unlock()
+	if secret, ok := km.secrets[id]; ok {
+		return secret, nil
+	}
+	_, secret, err := km.fetcher.fetch(id)
+	if err != nil {
+		return nil, err
+	}
+	km.secrets[id] = secret
+	return secret, nil
+}
+
+// vaultFetcher reads root secrets from a HashiCorp Vault key/value (version
+// 2) secrets engine; the secret's version number is its id.
+type vaultFetcher struct {
+	client common.HTTPClient
+	url    string
+	token  string
+	mount  string
+	path   string
+	field  string
+}
+
+func (v *vaultFetcher) fetch(id string) (string, []byte, error) {
+	u := strings.TrimRight(v.url, "/") + "/v1/" + path.Join(v.mount, "data", v.path)
+	if id != "" {
+		u += "?version=" + url.QueryEscape(id)
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("vault secret request gave status %d", resp.StatusCode)
+	}
+	var body struct {
+		Data struct {
+			Data     map[string]string `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", nil, err
+	}
+	secret, err := decodeRootSecret(body.Data.Data[v.field])
+	if err != nil {
+		return "", nil, err
+	}
+	return strconv.Itoa(body.Data.Metadata.Version), secret, nil
+}
+
+// barbicanFetcher reads root secrets from OpenStack Barbican.  The active
+// secret is the newest one with the configured name, so storing a new secret
+// under that name rotates it; the secret's uuid is its id.
+type barbicanFetcher struct {
+	*identity
+	barbicanURL string
+	secretName  string
+}
+
+func (b *barbicanFetcher) token() (string, error) {
+	authReqBody, err := json.Marshal(b.authRequest())
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", b.authURL+"v3/auth/tokens", bytes.NewBuffer(authReqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		return "", fmt.Errorf("keystone token request gave status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("X-Subject-Token"), nil
+}
+
+func (b *barbicanFetcher) get(token, u, accept string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", token)
+	req.Header.Set("Accept", accept)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("barbican request gave status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (b *barbicanFetcher) fetch(id string) (string, []byte, error) {
+	token, err := b.token()
+	if err != nil {
+		return "", nil, err
+	}
+	base := strings.TrimRight(b.barbicanURL, "/") + "/v1/secrets"
+	if id == "" {
+		resp, err := b.get(token, base+"?limit=1&sort=created:desc&name="+url.QueryEscape(b.secretName), "application/json")
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		var list struct {
+			Secrets []struct {
+				SecretRef string `json:"secret_ref"`
+			} `json:"secrets"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			return "", nil, err
+		}
+		if len(list.Secrets) == 0 {
+			return "", nil, fmt.Errorf("no barbican secret named %q", b.secretName)
+		}
+		id = path.Base(list.Secrets[0].SecretRef)
+	}
+	resp, err := b.get(token, base+"/"+url.PathEscape(id)+"/payload", "application/octet-stream")
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	secret, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(secret) < 32 {
+		return "", nil, errors.New("root secret must be at least 32 bytes")
+	}
+	return id, secret, nil
+}
+
+// newKeymaster returns the keymaster named by the keymaster setting, or nil
+// if none is configured.
+func newKeymaster(config conf.Section) (keymaster, error) {
+	c := &http.Client{Timeout: 10 * time.Second}
+	ttl := time.Duration(config.GetInt("keymaster_cache_seconds", 300)) * time.Second
+	switch name := config.GetDefault("keymaster", ""); name {
+	case "":
+		return nil, nil
+	case "config":
+		return newConfigKeymaster(config)
+	case "vault":
+		return &cachingKeymaster{
+			fetcher: &vaultFetcher{
+				client: c,
+				url:    config.GetDefault("vault_url", "http://127.0.0.1:8200"),
+				token:  config.GetDefault("vault_token", ""),
+				mount:  config.GetDefault("vault_mount", "secret"),
+				path:   config.GetDefault("vault_secret_path", "hummingbird"),
+				field:  config.GetDefault("vault_secret_field", "root_secret"),
+			},
+			ttl:     ttl,
+			secrets: map[string][]byte{},
+		}, nil
+	case "barbican":
+		return &cachingKeymaster{
+			fetcher: &barbicanFetcher{
+				identity:    newIdentity(config, c),
+				barbicanURL: config.GetDefault("barbican_url", "http://127.0.0.1:9311"),
+				secretName:  config.GetDefault("barbican_secret_name", "hummingbird_root_secret"),
+			},
+			ttl:     ttl,
+			secrets: map[string][]byte{},
+		}, nil
+	case "kmip":
+		return nil, errors.New("The kmip keymaster is not supported in this build")
+	default:
+		return nil, fmt.Errorf("Unknown keymaster %q", name)
+	}
+}
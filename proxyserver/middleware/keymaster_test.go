@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func testRootSecret(c byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{c}, 32))
+}
+
+func TestConfigKeymaster(t *testing.T) {
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:encryption]\nkeymaster = config\nencryption_root_secret = %s\nencryption_root_secret_2 = %s\nactive_root_secret_id = 2\n",
+		testRootSecret('a'), testRootSecret('b')))
+	require.Nil(t, err)
+	km, err := newKeymaster(config.GetSection("filter:encryption"))
+	require.Nil(t, err)
+	id, secret, err := km.activeSecret()
+	require.Nil(t, err)
+	require.Equal(t, "2", id)
+	require.Equal(t, bytes.Repeat([]byte("b"), 32), secret)
+	secret, err = km.secret("default")
+	require.Nil(t, err)
+	require.Equal(t, bytes.Repeat([]byte("a"), 32), secret)
+	_, err = km.secret("3")
+	require.NotNil(t, err)
+
+	config, err = conf.StringConfig("[filter:encryption]\nkeymaster = config\nencryption_root_secret = c2hvcnQ=\n")
+	require.Nil(t, err)
+	_, err = newKeymaster(config.GetSection("filter:encryption"))
+	require.NotNil(t, err)
+}
+
+func TestVaultKeymaster(t *testing.T) {
+	version := 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s3cr3t" || r.URL.Path != "/v1/secret/data/hummingbird" {
+			w.WriteHeader(403)
+			return
+		}
+		v := version
+		if q := r.URL.Query().Get("version"); q != "" {
+			fmt.Sscanf(q, "%d", &v)
+		}
+		fmt.Fprintf(w, `{"data": {"data": {"root_secret": "%s"}, "metadata": {"version": %d}}}`, testRootSecret(byte('a'+v)), v)
+	}))
+	defer ts.Close()
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:encryption]\nkeymaster = vault\nvault_url = %s\nvault_token = s3cr3t\n", ts.URL))
+	require.Nil(t, err)
+	km, err := newKeymaster(config.GetSection("filter:encryption"))
+	require.Nil(t, err)
+	id, secret, err := km.activeSecret()
+	require.Nil(t, err)
+	require.Equal(t, "1", id)
+	require.Equal(t, bytes.Repeat([]byte("b"), 32), secret)
+
+	// A rotation is picked up once the cached secret expires.
+	version = 2
+	id, _, err = km.activeSecret()
+	require.Nil(t, err)
+	require.Equal(t, "1", id)
+	km.(*cachingKeymaster).fetched = time.Now().Add(-time.Hour)
+	id, secret, err = km.activeSecret()
+	require.Nil(t, err)
+	require.Equal(t, "2", id)
+	require.Equal(t, bytes.Repeat([]byte("c"), 32), secret)
+	secret, err = km.secret("1")
+	require.Nil(t, err)
+	require.Equal(t, bytes.Repeat([]byte("b"), 32), secret)
+
+	// Old secrets are still fetched by id.
+	km.(*cachingKeymaster).secrets = map[string][]byte{}
+	secret, err = km.secret("1")
+	require.Nil(t, err)
+	require.Equal(t, bytes.Repeat([]byte("b"), 32), secret)
+}
+
+func TestBarbicanKeymaster(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v3/auth/tokens":
+			w.Header().Set("X-Subject-Token", "tok")
+			w.WriteHeader(201)
+		case r.Header.Get("X-Auth-Token") != "tok":
+			w.WriteHeader(401)
+		case r.URL.Path == "/v1/secrets" && r.URL.Query().Get("name") == "hummingbird_root_secret":
+			fmt.Fprintf(w, `{"secrets": [{"secret_ref": "http://%s/v1/secrets/uuid2"}]}`, r.Host)
+		case r.URL.Path == "/v1/secrets/uuid1/payload":
+			w.Write(bytes.Repeat([]byte("x"), 32))
+		case r.URL.Path == "/v1/secrets/uuid2/payload":
+			w.Write(bytes.Repeat([]byte("y"), 32))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+	config, err := conf.StringConfig(fmt.Sprintf("[filter:encryption]\nkeymaster = barbican\nauth_uri = %s/\nbarbican_url = %s\n", ts.URL, ts.URL))
+	require.Nil(t, err)
+	km, err := newKeymaster(config.GetSection("filter:encryption"))
+	require.Nil(t, err)
+	id, secret, err := km.activeSecret()
+	require.Nil(t, err)
+	require.Equal(t, "uuid2", id)
+	require.Equal(t, bytes.Repeat([]byte("y"), 32), secret)
+	secret, err = km.secret("uuid1")
+	require.Nil(t, err)
+	require.Equal(t, bytes.Repeat([]byte("x"), 32), secret)
+	_, err = km.secret("uuid3")
+	require.NotNil(t, err)
+}
+
+func TestUnsupportedKeymaster(t *testing.T) {
+	config, err := conf.StringConfig("[filter:encryption]\nkeymaster = kmip\n")
+	require.Nil(t, err)
+	_, err = newKeymaster(config.GetSection("filter:encryption"))
+	require.NotNil(t, err)
+}
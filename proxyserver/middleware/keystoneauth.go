@@ -342,6 +342,10 @@ func extractIdentity(r *http.Request) map[string]string {
 	return identity
 }
 
+func init() {
+	Register(Registration{Name: "keystoneauth", Position: 145, New: NewKeystoneAuth})
+}
+
 func NewKeystoneAuth(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	defaultRules := map[string][]string{"operator_roles": {"admin", "swiftoperator"},
 		"service_roles": {}}
@@ -18,6 +18,7 @@ package middleware
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -41,6 +42,11 @@ import (
 var maxManifestSize = 1024 * 1024 * 2 // TODO add a check for this
 var maxManifestLen = 1000
 
+const (
+	clientCompositeEtag  = "X-Object-Composite-Etag"
+	sysmetaCompositeEtag = "X-Object-Sysmeta-Slo-Composite-Etag"
+)
+
 type segItem struct {
 	Hash         string `json:"hash"`
 	LastModified string `json:"last_modified"`
@@ -71,6 +77,28 @@ func (si segItem) makeRange() common.HttpRange {
 	return common.HttpRange{Start: 0, End: int64(si.Bytes)}
 }
 
+// compositeEtag returns the S3 style multipart etag of a manifest, the md5 of
+// its segments' binary md5s followed by the number of segments.  Only
+// manifests of whole, plain segments have one, as ranges and nested
+// manifests have no S3 equivalent.
+func compositeEtag(manifest []segItem) (string, bool) {
+	if len(manifest) == 0 {
+		return "", false
+	}
+	h := md5.New()
+	for _, si := range manifest {
+		if si.Range != "" || si.SubSlo {
+			return "", false
+		}
+		b, err := hex.DecodeString(si.Hash)
+		if err != nil || len(b) != md5.Size {
+			return "", false
+		}
+		h.Write(b)
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil), len(manifest)), true
+}
+
 type sloPutManifest struct {
 	Path      string `json:"path"`
 	Etag      string `json:"etag"`
@@ -183,6 +211,44 @@ type xloMiddleware struct {
 	sloGetRequestsMetric    tally.Counter
 	sloPutRequestsMetric    tally.Counter
 	sloDeleteRequestsMetric tally.Counter
+	sloVerifyRequestsMetric tally.Counter
+}
+
+// segmentSpan is the part of a segment object that a read of a large
+// object needs, as a byte range within the segment object.
+type segmentSpan struct {
+	seg   segItem
+	start int64
+	end   int64
+}
+
+// resolveSegmentRanges maps a range of a large object onto the segments of
+// its manifest, taking any range each segment itself has into account.  Only
+// segments that overlap reqRange are returned.
+func resolveSegmentRanges(manifest []segItem, reqRange common.HttpRange) []segmentSpan {
+	var spans []segmentSpan
+	var offset int64
+	for _, si := range manifest {
+		segLen, _ := si.segLenHash()
+		segStart := offset
+		offset += segLen
+		if offset <= reqRange.Start || segLen <= 0 {
+			continue
+		}
+		if segStart >= reqRange.End {
+			break
+		}
+		from, to := int64(0), segLen
+		if reqRange.Start > segStart {
+			from = reqRange.Start - segStart
+		}
+		if reqRange.End < offset {
+			to = reqRange.End - segStart
+		}
+		segRange := si.makeRange()
+		spans = append(spans, segmentSpan{seg: si, start: segRange.Start + from, end: segRange.Start + to})
+	}
+	return spans
 }
 
 func (xlo *xloMiddleware) feedOutSegments(sw *xloIdentifyWriter, request *http.Request, manifest []segItem, reqRange common.HttpRange, status int) {
@@ -194,38 +260,8 @@ func (xlo *xloMiddleware) feedOutSegments(sw *xloIdentifyWriter, request *http.R
 		return
 	}
 	writeHeader := true
-	for _, si := range manifest {
-		segLen, _ := si.segLenHash()
-		if reqRange.Start >= segLen {
-			reqRange.Start -= segLen
-			reqRange.End -= segLen
-			if reqRange.End < 0 {
-				if writeHeader {
-					sw.ResponseWriter.WriteHeader(status)
-				}
-				return
-			}
-			continue
-		}
-		if reqRange.End < 0 {
-			if writeHeader {
-				sw.ResponseWriter.WriteHeader(status)
-			}
-			return
-		}
-		segmentRange := si.makeRange()
-		subReqStart := segmentRange.Start
-		if reqRange.Start > 0 {
-			subReqStart += reqRange.Start
-		}
-		subReqEnd := segmentRange.End
-		if subReqEnd > segmentRange.Start+reqRange.End {
-			subReqEnd = segmentRange.Start + reqRange.End
-		}
-		if subReqEnd <= 0 {
-			continue
-		}
-		container, object, err := splitSegPath(si.Name)
+	for _, span := range resolveSegmentRanges(manifest, reqRange) {
+		container, object, err := splitSegPath(span.seg.Name)
 		if err != nil {
 			if writeHeader {
 				sw.ResponseWriter.WriteHeader(http.StatusConflict)
@@ -241,7 +277,7 @@ func (xlo *xloMiddleware) feedOutSegments(sw *xloIdentifyWriter, request *http.R
 			}
 			return
 		}
-		newReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", subReqStart, subReqEnd-1))
+		newReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", span.start, span.end-1))
 		sw2 := &xloForwardBodyWriter{ResponseWriter: sw.ResponseWriter, header: make(http.Header)}
 		if writeHeader {
 			sw2.status = status
@@ -253,8 +289,6 @@ func (xlo *xloMiddleware) feedOutSegments(sw *xloIdentifyWriter, request *http.R
 				zap.String("Segment404", "404"), zap.Int("sw2.status", sw2.status))
 			break
 		}
-		reqRange.Start -= segLen
-		reqRange.End -= segLen
 	}
 	if writeHeader {
 		sw.ResponseWriter.WriteHeader(status)
@@ -359,14 +393,13 @@ func (xlo *xloMiddleware) byteFeeder(sw *xloIdentifyWriter, request *http.Reques
 	status := http.StatusOK
 	if reqRangeStr != "" {
 		if ranges, err := common.ParseRange(reqRangeStr, xloContentLength); err == nil {
-			xloContentLength = 0
 			if len(ranges) > 1 {
 				sw.ResponseWriter.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", xloContentLength))
 				srv.SimpleErrorResponse(sw.ResponseWriter, http.StatusRequestedRangeNotSatisfiable, "invalid multi range")
 				return
 			} else if len(ranges) == 1 {
 				reqRange = ranges[0]
-				sw.Header().Set("Content-Range", fmt.Sprintf("%d-%d/%s", reqRange.Start, reqRange.End, xloContentLengthStr))
+				sw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", reqRange.Start, reqRange.End-1, xloContentLength))
 				status = http.StatusPartialContent
 			}
 		} else {
@@ -406,6 +439,9 @@ func (xlo *xloMiddleware) handleDloGet(sw *xloIdentifyWriter, request *http.Requ
 func (xlo *xloMiddleware) handleSloGet(sw *xloIdentifyWriter, request *http.Request) {
 	xlo.sloGetRequestsMetric.Inc(1)
 	// next has already been called and this is an SLO
+	if composite := sw.Header().Get(sysmetaCompositeEtag); composite != "" {
+		sw.Header().Set(clientCompositeEtag, composite)
+	}
 	//TODO: what does comment at slo.py#624 mean?
 	contentType, _, _ := common.ParseContentTypeForSlo(sw.Header().Get("Content-Type"), 0)
 	sw.Header().Set("Content-Type", contentType)
@@ -607,6 +643,18 @@ func (xlo *xloMiddleware) handleSloPut(writer http.ResponseWriter, request *http
 			return
 		}
 	}
+	composite, hasComposite := compositeEtag(toPutManifest)
+	if reqComposite := request.Header.Get(clientCompositeEtag); reqComposite != "" {
+		if !hasComposite {
+			srv.SimpleErrorResponse(writer, 400, "Composite etags need whole segments that aren't manifests")
+			return
+		}
+		if strings.Trim(reqComposite, "\"") != composite {
+			srv.SimpleErrorResponse(writer, 422, "Invalid composite etag")
+			return
+		}
+		request.Header.Del(clientCompositeEtag)
+	}
 	contentType := request.Header.Get("Content-Type")
 	if contentType == "" {
 		pathMap, _ := common.ParseProxyPath(request.URL.Path)
@@ -623,6 +671,10 @@ func (xlo *xloMiddleware) handleSloPut(writer http.ResponseWriter, request *http
 	request.Header.Set("X-Object-Sysmeta-Slo-Size", fmt.Sprintf("%d", totalSize))
 	request.Header.Set("Etag", fmt.Sprintf("%x", md5.Sum(newBody)))
 	request.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	if hasComposite {
+		request.Header.Set(sysmetaCompositeEtag, composite)
+		writer.Header().Set(clientCompositeEtag, composite)
+	}
 
 	etagWriter := &etagQuoteWriter{ResponseWriter: writer}
 	xlo.next.ServeHTTP(etagWriter, request)
@@ -737,6 +789,10 @@ func (xlo *xloMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Re
 		xlo.handleSloDelete(writer, request)
 		return
 	}
+	if request.Method == "GET" && xloFuncName == "verify" {
+		xlo.handleSloVerify(writer, request)
+		return
+	}
 	if request.Method == "GET" || request.Method == "HEAD" {
 		if xloFuncName != "get" {
 			updateEtagIsAt(request, "X-Object-Sysmeta-Slo-Etag")
@@ -753,6 +809,10 @@ func (xlo *xloMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Re
 	xlo.next.ServeHTTP(writer, request)
 }
 
+func init() {
+	Register(Registration{Name: "slo", Position: 290, New: NewXlo})
+}
+
 func NewXlo(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("slo", map[string]interface{}{"max_manifest_segments": 1000, "max_manifest_size": 2097152, "min_segment_size": 1048576})
 	RegisterInfo("dlo", map[string]interface{}{"max_segments": 10000})
@@ -760,6 +820,7 @@ func NewXlo(config conf.Section, metricsScope tally.Scope) (func(http.Handler) h
 	sloGetRequestsMetric := metricsScope.Counter("slo_GET_requests")
 	sloPutRequestsMetric := metricsScope.Counter("slo_PUT_requests")
 	sloDeleteRequestsMetric := metricsScope.Counter("slo_DELETE_requests")
+	sloVerifyRequestsMetric := metricsScope.Counter("slo_VERIFY_requests")
 	return func(next http.Handler) http.Handler {
 		return &xloMiddleware{
 			next:                    next,
@@ -767,6 +828,7 @@ func NewXlo(config conf.Section, metricsScope tally.Scope) (func(http.Handler) h
 			sloGetRequestsMetric:    sloGetRequestsMetric,
 			sloPutRequestsMetric:    sloPutRequestsMetric,
 			sloDeleteRequestsMetric: sloDeleteRequestsMetric,
+			sloVerifyRequestsMetric: sloVerifyRequestsMetric,
 		}
 	}, nil
 }
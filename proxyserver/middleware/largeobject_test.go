@@ -50,6 +50,7 @@ func newTestXLOMiddleware(next http.Handler) *xloMiddleware {
 		sloGetRequestsMetric:    testScope.Counter("test_largeobject_slo_get"),
 		sloPutRequestsMetric:    testScope.Counter("test_largeobject_slo_put"),
 		sloDeleteRequestsMetric: testScope.Counter("test_largeobject_slo_delete"),
+		sloVerifyRequestsMetric: testScope.Counter("test_largeobject_slo_verify"),
 	}
 }
 
@@ -65,7 +66,7 @@ func TestGetRegular(t *testing.T) {
 	req, err := http.NewRequest("GET", "v/a/c/o", nil)
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -89,7 +90,7 @@ func TestGetMultipartManifest(t *testing.T) {
 	req, err := http.NewRequest("GET", "/v/a/c/o?multipart-manifest=get", nil)
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -105,7 +106,7 @@ func TestGetMultipartManifest(t *testing.T) {
 	w = httptest.NewRecorder()
 	req, err = http.NewRequest("GET", "/v/a/c/o?multipart-manifest=get&format=raw", nil)
 	require.Nil(t, err)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	nresp := w.Result()
@@ -151,7 +152,7 @@ func TestGetSlo(t *testing.T) {
 	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -198,7 +199,7 @@ func TestGetSloRangeRequest(t *testing.T) {
 	require.Nil(t, err)
 	req.Header.Set("Range", "bytes=4-7")
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -248,7 +249,7 @@ func TestGetRangedSlo(t *testing.T) {
 	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(sm)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -309,7 +310,7 @@ func TestGetSuperSlo(t *testing.T) {
 	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(sm)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -362,7 +363,7 @@ func TestPutSlo(t *testing.T) {
 	req.Header.Set("Content-Length", strconv.Itoa(len(simplePutManifest)))
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -417,7 +418,7 @@ func TestDeleteSlo(t *testing.T) {
 	req.Header.Set("Content-Length", "0")
 	require.Nil(t, err)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 
 	sm.ServeHTTP(w, req)
 	resp := w.Result()
@@ -468,7 +469,7 @@ func TestGetDlo(t *testing.T) {
 
 	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	sm.ServeHTTP(w, req)
@@ -478,3 +479,119 @@ func TestGetDlo(t *testing.T) {
 	require.Equal(t, resp.Header.Get("Content-Type"), "app/html")
 	require.Equal(t, "123456789", string(body))
 }
+
+func TestResolveSegmentRanges(t *testing.T) {
+	var manifest []segItem
+	require.Nil(t, json.Unmarshal([]byte(rangedManifest), &manifest))
+	// The object is "23" + "45" + "789".
+	spans := func(start, end int64) [][3]interface{} {
+		var got [][3]interface{}
+		for _, span := range resolveSegmentRanges(manifest, common.HttpRange{Start: start, End: end}) {
+			got = append(got, [3]interface{}{span.seg.Name, span.start, span.end})
+		}
+		return got
+	}
+	require.Equal(t, [][3]interface{}{{"/hat/a", int64(1), int64(3)}, {"/hat/b", int64(0), int64(2)}, {"hat/c", int64(0), int64(3)}}, spans(0, 7))
+	require.Equal(t, [][3]interface{}{{"/hat/a", int64(2), int64(3)}, {"/hat/b", int64(0), int64(2)}, {"hat/c", int64(0), int64(1)}}, spans(1, 5))
+	require.Equal(t, [][3]interface{}{{"/hat/b", int64(1), int64(2)}}, spans(3, 4))
+	require.Equal(t, [][3]interface{}{{"hat/c", int64(1), int64(3)}}, spans(5, 7))
+	require.Nil(t, spans(7, 7))
+
+	manifest = append([]segItem{{Name: "/hat/empty"}}, manifest...)
+	require.Equal(t, [][3]interface{}{{"/hat/a", int64(1), int64(2)}}, spans(0, 1))
+}
+
+func TestGetDloSuffixRange(t *testing.T) {
+	var paths []string
+	next := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		paths = append(paths, request.URL.Path)
+		switch request.URL.Path {
+		case "/v1/a/c/o":
+			writer.Header().Set("X-Object-Manifest", "hat/dlo-")
+			writer.Header().Set("Content-Type", "app/html")
+			writer.WriteHeader(416)
+		case "/v1/a/hat":
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(200)
+			writer.Write([]byte(simpleDloManifest))
+		case "/v1/a/hat/dlo-b":
+			require.Equal(t, "bytes=1-2", request.Header.Get("Range"))
+			writer.WriteHeader(206)
+			writer.Write([]byte("56"))
+		case "/v1/a/hat/dlo-c":
+			require.Equal(t, "bytes=0-2", request.Header.Get("Range"))
+			writer.WriteHeader(206)
+			writer.Write([]byte("789"))
+		default:
+			writer.WriteHeader(404)
+		}
+	})
+	sm := newTestXLOMiddleware(next)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("Range", "bytes=-5")
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, NewFakeProxyContext(next)))
+
+	sm.ServeHTTP(w, req)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	require.Equal(t, 206, resp.StatusCode)
+	require.Equal(t, "56789", string(body))
+	require.Equal(t, "bytes 4-8/9", resp.Header.Get("Content-Range"))
+	require.Equal(t, "5", resp.Header.Get("Content-Length"))
+	require.Equal(t, []string{"/v1/a/c/o", "/v1/a/hat", "/v1/a/hat/dlo-b", "/v1/a/hat/dlo-c"}, paths)
+}
+
+func TestCompositeEtag(t *testing.T) {
+	var manifest []segItem
+	require.Nil(t, json.Unmarshal([]byte(simpleManifest), &manifest))
+	composite, ok := compositeEtag(manifest)
+	require.True(t, ok)
+	require.Equal(t, "a8dd1c5498a84913e3d6e7b59d4b4f8f-3", composite)
+
+	require.Nil(t, json.Unmarshal([]byte(rangedManifest), &manifest))
+	_, ok = compositeEtag(manifest)
+	require.False(t, ok)
+	_, ok = compositeEtag(nil)
+	require.False(t, ok)
+}
+
+func TestPutSloCompositeEtag(t *testing.T) {
+	etags := map[string]string{
+		"/v1/a/hat/a": "202cb962ac59075b964b07152d234b70",
+		"/v1/a/hat/b": "250cf8b51c773f3f8dc8b4be867a9a02",
+		"/v1/a/hat/c": "68053af2923e00204c3ca7c6a3150cf7",
+	}
+	var stored string
+	next := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == "PUT" {
+			stored = request.Header.Get("X-Object-Sysmeta-Slo-Composite-Etag")
+			writer.WriteHeader(201)
+			return
+		}
+		writer.Header().Set("Content-Length", "3")
+		writer.Header().Set("Etag", etags[request.URL.Path])
+		writer.WriteHeader(200)
+	})
+	sm := newTestXLOMiddleware(next)
+	put := func(composite string) *http.Response {
+		req, err := http.NewRequest("PUT", "/v1/a/c/o?multipart-manifest=put", bytes.NewBuffer([]byte(simplePutManifest)))
+		require.Nil(t, err)
+		req.Header.Set("Content-Length", strconv.Itoa(len(simplePutManifest)))
+		req.Header.Set("X-Object-Composite-Etag", composite)
+		req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, NewFakeProxyContext(next)))
+		w := httptest.NewRecorder()
+		sm.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	resp := put("a8dd1c5498a84913e3d6e7b59d4b4f8f-2")
+	require.Equal(t, 422, resp.StatusCode)
+	require.Equal(t, "", stored)
+
+	resp = put("\"a8dd1c5498a84913e3d6e7b59d4b4f8f-3\"")
+	require.Equal(t, 201, resp.StatusCode)
+	require.Equal(t, "a8dd1c5498a84913e3d6e7b59d4b4f8f-3", stored)
+	require.Equal(t, "a8dd1c5498a84913e3d6e7b59d4b4f8f-3", resp.Header.Get("X-Object-Composite-Etag"))
+}
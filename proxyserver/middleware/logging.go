@@ -25,6 +25,10 @@ import (
 	"github.com/uber-go/tally"
 )
 
+func init() {
+	Register(Registration{Name: "proxy-logging", Position: 30, New: NewRequestLogger})
+}
+
 func NewRequestLogger(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	requestsMetric := metricsScope.Counter("requests")
 	return func(next http.Handler) http.Handler {
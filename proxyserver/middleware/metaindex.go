@@ -0,0 +1,254 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	indexedMetaHeader         = "X-Container-Indexed-Meta"
+	indexedMetaSysmeta        = "X-Container-Sysmeta-Indexed-Meta"
+	incompleteMetaHeader      = "X-Container-Indexed-Meta-Incomplete"
+	incompleteMetaSysmeta     = "X-Container-Sysmeta-Indexed-Meta-Incomplete"
+	indexedMetaChangedMessage = "Indexed metadata can only be changed by PUT or COPY"
+)
+
+type metaIndex struct {
+	next         http.Handler
+	maxKeys      int
+	indexedPuts  tally.Counter
+	rejectedPost tally.Counter
+}
+
+func splitKeys(value string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// translateIndexedMeta moves the client's X-Container-Indexed-Meta header
+// into sysmeta, normalizing the list of keys on the way.  Keys newly named
+// while the container holds objects are also recorded as incomplete, since
+// the objects already there were never indexed on them; ci is nil if the
+// container's info couldn't be had.
+func (m *metaIndex) translateIndexedMeta(request *http.Request, ci *client.ContainerInfo) string {
+	values, ok := request.Header[indexedMetaHeader]
+	if !ok {
+		return ""
+	}
+	request.Header.Del(indexedMetaHeader)
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(strings.Join(values, ","), ",") {
+		if key = strings.ToLower(strings.TrimSpace(key)); key == "" || seen[key] {
+			continue
+		}
+		if strings.Contains(key, ":") {
+			return fmt.Sprintf("Indexed metadata key %q may not contain colons", key)
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) > m.maxKeys {
+		return fmt.Sprintf("Too many indexed metadata keys; maximum is %d", m.maxKeys)
+	}
+	previous := map[string]bool{}
+	incomplete := map[string]bool{}
+	// Without info, a PUT is taken to be creating an empty container and a
+	// POST to be changing one that may hold objects.
+	hasObjects := request.Method == "POST"
+	if ci != nil {
+		for _, key := range splitKeys(ci.SysMetadata["Indexed-Meta"]) {
+			previous[key] = true
+		}
+		for _, key := range splitKeys(ci.SysMetadata["Indexed-Meta-Incomplete"]) {
+			incomplete[key] = true
+		}
+		hasObjects = ci.ObjectCount > 0
+	}
+	incompleteKeys := []string{}
+	for _, key := range keys {
+		if incomplete[key] || (!previous[key] && hasObjects) {
+			incompleteKeys = append(incompleteKeys, key)
+		}
+	}
+	// An empty value is passed along as is, which clears the setting.
+	request.Header.Set(indexedMetaSysmeta, strings.Join(keys, ","))
+	request.Header.Set(incompleteMetaSysmeta, strings.Join(incompleteKeys, ","))
+	return ""
+}
+
+// incompleteFilter returns the first key of the listing's meta filters that
+// the container's index is incomplete for, or "".
+func incompleteFilter(request *http.Request, ci *client.ContainerInfo) string {
+	incomplete := map[string]bool{}
+	for _, key := range splitKeys(ci.SysMetadata["Indexed-Meta-Incomplete"]) {
+		incomplete[key] = true
+	}
+	for _, filter := range strings.Split(strings.Join(request.URL.Query()["meta"], ","), ",") {
+		if key := strings.ToLower(strings.SplitN(filter, ":", 2)[0]); incomplete[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+// changesIndexedMeta reports whether an object POST would change the value
+// of any indexed key.  A POST replaces all of an object's metadata but doesn't
+// update the container listing, so such a change would leave the index stale.
+func (m *metaIndex) changesIndexedMeta(request *http.Request, keys []string) (bool, int) {
+	ctx := GetProxyContext(request)
+	subreq, err := ctx.newSubrequest("HEAD", common.Urlencode(request.URL.Path), http.NoBody, request, "metaindex")
+	if err != nil {
+		ctx.Logger.Error("metaIndex HEAD error", zap.Error(err))
+		return false, http.StatusInternalServerError
+	}
+	GetProxyContext(subreq).Authorize = okAuthFunc
+	vow := NewVersionedObjectWriter()
+	ctx.serveHTTPSubrequest(vow, subreq)
+	if vow.status/100 != 2 {
+		// the POST will fail the same way
+		return false, http.StatusOK
+	}
+	for _, key := range keys {
+		header := http.CanonicalHeaderKey("X-Object-Meta-" + key)
+		current, had := vow.Header()[header]
+		posted, has := request.Header[header]
+		if had != has || (has && current[0] != posted[0]) {
+			return true, http.StatusOK
+		}
+	}
+	return false, http.StatusOK
+}
+
+func (m *metaIndex) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, object := getPathParts(request)
+	if !apiReq || container == "" {
+		m.next.ServeHTTP(writer, request)
+		return
+	}
+	containerInfo := func() *client.ContainerInfo {
+		if ctx := GetProxyContext(request); ctx != nil {
+			if ci, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == nil {
+				return ci
+			}
+		}
+		return nil
+	}
+	if object == "" {
+		switch request.Method {
+		case "PUT", "POST":
+			var ci *client.ContainerInfo
+			if _, ok := request.Header[indexedMetaHeader]; ok {
+				ci = containerInfo()
+			}
+			if msg := m.translateIndexedMeta(request, ci); msg != "" {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, msg)
+				return
+			}
+		case "GET", "HEAD":
+			if _, ok := request.URL.Query()["meta"]; ok && request.Method == "GET" {
+				if ci := containerInfo(); ci != nil {
+					if key := incompleteFilter(request, ci); key != "" {
+						srv.SimpleErrorResponse(writer, http.StatusConflict, fmt.Sprintf("Metadata key %q was indexed after objects were added, so its index is incomplete", key))
+						return
+					}
+				}
+			}
+			writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+				if v := w.Header().Get(indexedMetaSysmeta); v != "" {
+					w.Header().Set(indexedMetaHeader, v)
+				}
+				if v := w.Header().Get(incompleteMetaSysmeta); v != "" {
+					w.Header().Set(incompleteMetaHeader, v)
+				}
+				w.Header().Del(indexedMetaSysmeta)
+				w.Header().Del(incompleteMetaSysmeta)
+				return status
+			})
+		}
+	} else if request.Method == "PUT" || request.Method == "POST" {
+		ci := containerInfo()
+		if ci == nil || ci.SysMetadata["Indexed-Meta"] == "" {
+			m.next.ServeHTTP(writer, request)
+			return
+		}
+		switch request.Method {
+		case "PUT":
+			request.Header.Set("X-Backend-Indexed-Meta", ci.SysMetadata["Indexed-Meta"])
+			m.indexedPuts.Inc(1)
+		case "POST":
+			changed, status := m.changesIndexedMeta(request, splitKeys(ci.SysMetadata["Indexed-Meta"]))
+			if status != http.StatusOK {
+				srv.StandardResponse(writer, status)
+				return
+			}
+			if changed {
+				m.rejectedPost.Inc(1)
+				srv.SimpleErrorResponse(writer, http.StatusConflict, indexedMetaChangedMessage)
+				return
+			}
+		}
+	}
+	m.next.ServeHTTP(writer, request)
+}
+
+func init() {
+	Register(Registration{Name: "metaindex", Position: 241, New: NewMetaIndex})
+}
+
+// NewMetaIndex returns the metaindex middleware, which lets clients name up
+// to max_indexed_keys object metadata keys in a container's
+// X-Container-Indexed-Meta header.  The values objects are PUT with for those
+// keys are recorded in the container, so listings can be filtered with
+// meta=<key>:<value> or meta=<key> parameters.  Since a POST doesn't update
+// the container listing, object POSTs that would change an indexed key's
+// value are refused.  Objects already in the container when a key is named
+// aren't indexed on it, so the key is listed in
+// X-Container-Indexed-Meta-Incomplete and listings filtered on it are refused.
+func NewMetaIndex(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	maxKeys := int(config.GetInt("max_indexed_keys", 5))
+	RegisterInfo("metaindex", map[string]interface{}{"max_indexed_keys": maxKeys})
+	indexedPuts := metricsScope.Counter("indexed_puts")
+	rejectedPost := metricsScope.Counter("rejected_posts")
+	return func(next http.Handler) http.Handler {
+		return &metaIndex{
+			next:         next,
+			maxKeys:      maxKeys,
+			indexedPuts:  indexedPuts,
+			rejectedPost: rejectedPost,
+		}
+	}, nil
+}
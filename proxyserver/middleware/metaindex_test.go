@@ -0,0 +1,228 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func newTestMetaIndex(t *testing.T, next http.Handler) http.Handler {
+	config, err := conf.StringConfig("[filter:metaindex]\nenabled = true\nmax_indexed_keys = 2")
+	require.Nil(t, err)
+	mid, err := NewMetaIndex(config.GetSection("filter:metaindex"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(next)
+}
+
+func TestMetaIndexContainerPut(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestMetaIndex(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(201)
+	}))
+	req, err := http.NewRequest("PUT", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "Color, size,color")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "color,size", gotHeader.Get("X-Container-Sysmeta-Indexed-Meta"))
+	require.Equal(t, "", gotHeader.Get("X-Container-Indexed-Meta"))
+
+	req, err = http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	v, ok := gotHeader["X-Container-Sysmeta-Indexed-Meta"]
+	require.True(t, ok)
+	require.Equal(t, []string{""}, v)
+
+	req, err = http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "a,b,c")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "a:b")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestMetaIndexContainerHead(t *testing.T) {
+	h := newTestMetaIndex(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Container-Sysmeta-Indexed-Meta", "color")
+		w.WriteHeader(204)
+	}))
+	req, err := http.NewRequest("HEAD", "/v1/a/c", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "color", w.Header().Get("X-Container-Indexed-Meta"))
+	require.Equal(t, "", w.Header().Get("X-Container-Sysmeta-Indexed-Meta"))
+}
+
+func TestMetaIndexObjectPut(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestMetaIndex(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(201)
+	}))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		Logger: zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {SysMetadata: map[string]string{"Indexed-Meta": "color,size"}},
+			"container/a/d": {SysMetadata: map[string]string{}},
+		}, zap.NewNop()),
+	}
+
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "color,size", gotHeader.Get("X-Backend-Indexed-Meta"))
+
+	req, err = http.NewRequest("PUT", "/v1/a/d/o", nil)
+	require.Nil(t, err)
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "", gotHeader.Get("X-Backend-Indexed-Meta"))
+}
+
+func TestMetaIndexIncompleteKeys(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestMetaIndex(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(204)
+	}))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		Logger: zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {ObjectCount: 3, SysMetadata: map[string]string{"Indexed-Meta": "color,size", "Indexed-Meta-Incomplete": "size"}},
+			"container/a/d": {ObjectCount: 0, SysMetadata: map[string]string{"Indexed-Meta": "color"}},
+		}, zap.NewNop()),
+	}
+	withContext := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+	}
+
+	req, err := http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "color,size,shape")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "color,size,shape", gotHeader.Get("X-Container-Sysmeta-Indexed-Meta"))
+	require.Equal(t, "size,shape", gotHeader.Get("X-Container-Sysmeta-Indexed-Meta-Incomplete"))
+
+	req, err = http.NewRequest("POST", "/v1/a/d", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Container-Indexed-Meta", "color,shape")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "", gotHeader.Get("X-Container-Sysmeta-Indexed-Meta-Incomplete"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c?meta=color:red,size:large", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	req, err = http.NewRequest("GET", "/v1/a/c?meta=color:red", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 204, w.Code)
+}
+
+func TestMetaIndexObjectPost(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestMetaIndex(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			w.Header().Set("X-Object-Meta-Color", "red")
+			w.Header().Set("X-Object-Meta-Other", "x")
+			w.WriteHeader(200)
+			return
+		}
+		gotHeader = r.Header
+		w.WriteHeader(202)
+	}))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{next: h},
+		Logger:                 zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {SysMetadata: map[string]string{"Indexed-Meta": "color,size"}},
+		}, zap.NewNop()),
+	}
+	withContext := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+	}
+
+	req, err := http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Meta-Color", "red")
+	req.Header.Set("X-Object-Meta-Other", "y")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 202, w.Code)
+	require.Equal(t, "y", gotHeader.Get("X-Object-Meta-Other"))
+
+	for _, meta := range []map[string]string{
+		{"X-Object-Meta-Color": "blue"},
+		{"X-Object-Meta-Other": "y"},
+		{"X-Object-Meta-Color": "red", "X-Object-Meta-Size": "large"},
+	} {
+		req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+		require.Nil(t, err)
+		for k, v := range meta {
+			req.Header.Set(k, v)
+		}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, withContext(req))
+		require.Equal(t, http.StatusConflict, w.Code)
+	}
+}
@@ -147,6 +147,10 @@ func multirange(next http.Handler) http.Handler {
 	})
 }
 
+func init() {
+	Register(Registration{Name: "multirange", Position: 190, New: NewMultirange})
+}
+
 // NewMultirange returns an instance of the multirange middleware with the given config.
 //
 // This middleware intercepts object GET requests with multiple ranges in the Range header and
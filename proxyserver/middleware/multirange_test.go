@@ -69,7 +69,7 @@ func TestMultiRange(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	r, err := http.NewRequest("GET", "/v1/a/c/o", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext",
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{},
 		&ProxyContext{
 			Authorize:              func(r *http.Request) (bool, int) { return true, http.StatusOK },
 			Logger:                 zap.NewNop(),
@@ -125,7 +125,7 @@ func TestMultiRangeNotFound(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	r, err := http.NewRequest("GET", "/v1/a/c/o", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext",
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{},
 		&ProxyContext{
 			Authorize:              func(r *http.Request) (bool, int) { return true, http.StatusOK },
 			Logger:                 zap.NewNop(),
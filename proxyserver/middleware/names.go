@@ -0,0 +1,105 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/troubling/hummingbird/common"
+	"golang.org/x/text/unicode/norm"
+)
+
+// nameQueryParams are the listing parameters holding names, which have to be
+// normalized the same way as the names they're compared to.
+var nameQueryParams = []string{"prefix", "marker", "end_marker", "path"}
+
+// nameHeaders are the request headers that refer to other containers or
+// objects by name.
+var nameHeaders = []string{"X-Copy-From", "Destination", "X-Object-Manifest", "X-Versions-Location", "X-History-Location"}
+
+// normalizeNames rewrites the names in a request to Unicode NFC, so names
+// that look the same but were typed with different code points, like a
+// precomposed "é" and an "e" with a combining accent, hash to the same place.
+// It returns whether the request's path was changed.
+func normalizeNames(request *http.Request) bool {
+	changedPath := false
+	if p := norm.NFC.String(request.URL.Path); p != request.URL.Path {
+		request.URL.Path = p
+		request.URL.RawPath = ""
+		changedPath = true
+	}
+	if request.URL.RawQuery != "" {
+		query := request.URL.Query()
+		changed := false
+		for _, k := range nameQueryParams {
+			if v := query.Get(k); v != "" && !norm.NFC.IsNormalString(v) {
+				query.Set(k, norm.NFC.String(v))
+				changed = true
+			}
+		}
+		if changed {
+			request.URL.RawQuery = query.Encode()
+		}
+	}
+	for _, h := range nameHeaders {
+		if v := request.Header.Get(h); v != "" && !norm.NFC.IsNormalString(v) {
+			request.Header.Set(h, norm.NFC.String(v))
+		}
+	}
+	return changedPath
+}
+
+// rawNameMethods are the methods that are tried again with the name as sent
+// if the normalized name isn't found, so what was stored under a name before
+// names were normalized can still be reached.
+var rawNameMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "DELETE": true}
+
+// copyNames returns a copy of the request whose names normalizeNames can
+// change without changing the original's.
+func copyNames(request *http.Request) *http.Request {
+	raw := new(http.Request)
+	*raw = *request
+	u := *request.URL
+	raw.URL = &u
+	raw.Header = make(http.Header, len(request.Header))
+	for k, v := range request.Header {
+		raw.Header[k] = append([]string(nil), v...)
+	}
+	return raw
+}
+
+// checkNames validates the account, container and object names of an API
+// request, holding the one a PUT would create to the stricter rules.
+func checkNames(request *http.Request) (int, string) {
+	apiReq, account, container, obj := getPathParts(request)
+	if !apiReq {
+		return http.StatusOK, ""
+	}
+	put := request.Method == "PUT"
+	if status, msg := common.CheckName(account, "Account", common.MAX_ACCOUNT_NAME_LENGTH, put && container == ""); status != http.StatusOK {
+		return status, msg
+	}
+	if container == "" {
+		return http.StatusOK, ""
+	}
+	if status, msg := common.CheckName(container, "Container", common.MAX_CONTAINER_NAME_LENGTH, put && obj == ""); status != http.StatusOK {
+		return status, msg
+	}
+	if obj == "" {
+		return http.StatusOK, ""
+	}
+	return common.CheckName(obj, "Object", common.MAX_OBJECT_NAME_LENGTH, put)
+}
@@ -0,0 +1,65 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+)
+
+func TestNormalizeNames(t *testing.T) {
+	// "cafe" with a combining acute accent, which NFC composes to U+00E9.
+	req, err := http.NewRequest("GET", "/v1/a/cafe%CC%81/o?prefix=cafe%CC%81&limit=2", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Copy-From", "cafe\u0301/o")
+	normalizeNames(req)
+	require.Equal(t, "/v1/a/caf\u00e9/o", req.URL.Path)
+	require.Equal(t, "caf\u00e9", req.URL.Query().Get("prefix"))
+	require.Equal(t, "2", req.URL.Query().Get("limit"))
+	require.Equal(t, "caf\u00e9/o", req.Header.Get("X-Copy-From"))
+
+	req, err = http.NewRequest("GET", "/v1/a/c/o?prefix=abc", nil)
+	require.Nil(t, err)
+	normalizeNames(req)
+	require.Equal(t, "/v1/a/c/o", req.URL.Path)
+	require.Equal(t, "prefix=abc", req.URL.RawQuery)
+}
+
+func TestCheckNames(t *testing.T) {
+	req, _ := http.NewRequest("PUT", "/v1/a/c/o%0A", nil)
+	status, _ := checkNames(req)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	req, _ = http.NewRequest("DELETE", "/v1/a/c/o%0A", nil)
+	status, _ = checkNames(req)
+	require.Equal(t, http.StatusOK, status)
+
+	req, _ = http.NewRequest("PUT", "/v1/a/"+strings.Repeat("c", common.MAX_CONTAINER_NAME_LENGTH+1), nil)
+	status, _ = checkNames(req)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	req, _ = http.NewRequest("GET", "/v1/a/"+strings.Repeat("c", common.MAX_CONTAINER_NAME_LENGTH+1), nil)
+	status, _ = checkNames(req)
+	require.Equal(t, http.StatusOK, status)
+
+	req, _ = http.NewRequest("PUT", "/info", nil)
+	status, _ = checkNames(req)
+	require.Equal(t, http.StatusOK, status)
+}
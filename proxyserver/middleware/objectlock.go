@@ -0,0 +1,315 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	CLIENT_RETENTION_PERIOD  = "X-Container-Retention-Period"
+	CLIENT_CONTAINER_HOLD    = "X-Container-Legal-Hold"
+	SYSMETA_RETENTION_PERIOD = "X-Container-Sysmeta-Retention-Period"
+	SYSMETA_CONTAINER_HOLD   = "X-Container-Sysmeta-Legal-Hold"
+	CLIENT_RETAIN_UNTIL      = "X-Object-Retain-Until"
+	CLIENT_OBJECT_HOLD       = "X-Object-Legal-Hold"
+	SYSMETA_RETAIN_UNTIL     = "X-Object-Sysmeta-Retain-Until"
+	// Object holds are kept in transient sysmeta, which object POSTs can
+	// change, so a hold can be lifted without rewriting the object.
+	TRANSIENT_OBJECT_HOLD = "X-Object-Transient-Sysmeta-Legal-Hold"
+)
+
+type objectLock struct {
+	next               http.Handler
+	maxRetentionPeriod int64
+	rejected           tally.Counter
+}
+
+// renameHeaders returns a writer that moves response headers named in
+// renames to their new names before they're sent, which is how the lock
+// sysmeta is shown to clients.
+func renameHeaders(writer http.ResponseWriter, renames map[string]string) http.ResponseWriter {
+	return srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+		for from, to := range renames {
+			if v := w.Header().Get(from); v != "" {
+				w.Header().Set(to, v)
+			}
+		}
+		return status
+	})
+}
+
+func (o *objectLock) handleContainer(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == "PUT" || request.Method == "POST" {
+		if v, ok := request.Header[CLIENT_RETENTION_PERIOD]; ok {
+			if v[0] != "" {
+				period, err := strconv.ParseInt(v[0], 10, 64)
+				if err != nil || period < 0 || (o.maxRetentionPeriod > 0 && period > o.maxRetentionPeriod) {
+					srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid retention period.")
+					return
+				}
+			}
+			request.Header.Set(SYSMETA_RETENTION_PERIOD, v[0])
+			request.Header.Del(CLIENT_RETENTION_PERIOD)
+		}
+		if v, ok := request.Header[CLIENT_CONTAINER_HOLD]; ok {
+			if common.LooksTrue(v[0]) {
+				request.Header.Set(SYSMETA_CONTAINER_HOLD, "true")
+			} else {
+				request.Header.Set(SYSMETA_CONTAINER_HOLD, "")
+			}
+			request.Header.Del(CLIENT_CONTAINER_HOLD)
+		}
+	} else if request.Method == "GET" || request.Method == "HEAD" {
+		writer = renameHeaders(writer, map[string]string{
+			SYSMETA_RETENTION_PERIOD: CLIENT_RETENTION_PERIOD,
+			SYSMETA_CONTAINER_HOLD:   CLIENT_CONTAINER_HOLD,
+		})
+	}
+	o.next.ServeHTTP(writer, request)
+}
+
+// currentLock returns the existing object's headers, with its lock shown
+// under the client header names, or nil headers if there is no object.
+func (o *objectLock) currentLock(request *http.Request) (http.Header, int) {
+	ctx := GetProxyContext(request)
+	subreq, err := ctx.newSubrequest("HEAD", common.Urlencode(request.URL.Path), http.NoBody, request, "OL")
+	if err != nil {
+		ctx.Logger.Error("objectLock HEAD error", zap.Error(err))
+		return nil, http.StatusInternalServerError
+	}
+	GetProxyContext(subreq).Authorize = okAuthFunc
+	vow := NewVersionedObjectWriter()
+	ctx.serveHTTPSubrequest(vow, subreq)
+	if vow.status == http.StatusNotFound {
+		return nil, http.StatusOK
+	} else if vow.status/100 != 2 {
+		return nil, vow.status
+	}
+	return vow.Header(), http.StatusOK
+}
+
+// lockedReason returns why the existing object can't be deleted or
+// overwritten, or "" if nothing protects it.
+func (o *objectLock) lockedReason(request *http.Request, ci map[string]string) (string, int) {
+	if common.LooksTrue(ci["Legal-Hold"]) {
+		return "Container is under legal hold.", http.StatusOK
+	}
+	headers, status := o.currentLock(request)
+	if headers == nil {
+		return "", status
+	}
+	if common.LooksTrue(headers.Get(CLIENT_OBJECT_HOLD)) {
+		return "Object is under legal hold.", http.StatusOK
+	}
+	if until, err := strconv.ParseInt(headers.Get(CLIENT_RETAIN_UNTIL), 10, 64); err == nil && until > time.Now().Unix() {
+		return fmt.Sprintf("Object is retained until %d.", until), http.StatusOK
+	}
+	return "", http.StatusOK
+}
+
+// deleteAt returns when the request asks for the object to be deleted and
+// whether it asks at all.  X-Delete-After is resolved into an X-Delete-At
+// here rather than later by the object constraints, so neither can slip past
+// the lock; a value that doesn't parse counts as asking for deletion now.
+func deleteAt(request *http.Request) (int64, bool) {
+	if v := request.Header.Get("X-Delete-At"); v != "" {
+		at, _ := strconv.ParseInt(v, 10, 64)
+		return at, true
+	}
+	if v := request.Header.Get("X-Delete-After"); v != "" {
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, true
+		}
+		at := time.Now().Unix() + after
+		request.Header.Set("X-Delete-At", strconv.FormatInt(at, 10))
+		request.Header.Del("X-Delete-After")
+		return at, true
+	}
+	return 0, false
+}
+
+// deleteAtReason returns why the request may not schedule the deletion of
+// an object retained until the given time or under a legal hold, or "".
+func deleteAtReason(request *http.Request, until int64, held bool) string {
+	at, ok := deleteAt(request)
+	if !ok {
+		return ""
+	}
+	if held {
+		return "X-Delete-At may not be set while the object is under legal hold."
+	}
+	if at < until {
+		return "X-Delete-At may not be before the object's retention expires."
+	}
+	return ""
+}
+
+// setRetention validates the lock headers of an object PUT and moves them
+// into sysmeta.  The container's retention period is a minimum, so a
+// retain-until time from the client can lengthen it but not shorten it.
+func (o *objectLock) setRetention(request *http.Request, ci map[string]string) string {
+	var until int64
+	if v := request.Header.Get(CLIENT_RETAIN_UNTIL); v != "" {
+		var err error
+		if until, err = strconv.ParseInt(v, 10, 64); err != nil || until < 0 {
+			return "Invalid " + CLIENT_RETAIN_UNTIL + "."
+		}
+	}
+	if period, err := strconv.ParseInt(ci["Retention-Period"], 10, 64); err == nil && period > 0 {
+		if min := time.Now().Unix() + period; min > until {
+			until = min
+		}
+	}
+	request.Header.Del(CLIENT_RETAIN_UNTIL)
+	held := common.LooksTrue(ci["Legal-Hold"]) || common.LooksTrue(request.Header.Get(CLIENT_OBJECT_HOLD))
+	if msg := deleteAtReason(request, until, held); msg != "" {
+		return msg
+	}
+	if until > 0 {
+		request.Header.Set(SYSMETA_RETAIN_UNTIL, strconv.FormatInt(until, 10))
+	}
+	if common.LooksTrue(request.Header.Get(CLIENT_OBJECT_HOLD)) {
+		request.Header.Set(TRANSIENT_OBJECT_HOLD, "true")
+	}
+	request.Header.Del(CLIENT_OBJECT_HOLD)
+	return ""
+}
+
+// setHold validates the lock headers of an object POST and moves its legal
+// hold into transient sysmeta.  A POST replaces all of the object's transient
+// sysmeta, so when the client doesn't mention the hold the object's current
+// one, from current, is carried over.
+func (o *objectLock) setHold(request *http.Request, ci map[string]string, current http.Header) string {
+	hold := current.Get(CLIENT_OBJECT_HOLD)
+	if v, ok := request.Header[CLIENT_OBJECT_HOLD]; ok {
+		hold = v[0]
+	}
+	request.Header.Del(CLIENT_OBJECT_HOLD)
+	if common.LooksTrue(hold) {
+		request.Header.Set(TRANSIENT_OBJECT_HOLD, "true")
+	} else {
+		request.Header.Del(TRANSIENT_OBJECT_HOLD)
+	}
+	until, _ := strconv.ParseInt(current.Get(CLIENT_RETAIN_UNTIL), 10, 64)
+	return deleteAtReason(request, until, common.LooksTrue(ci["Legal-Hold"]) || common.LooksTrue(hold))
+}
+
+func (o *objectLock) handleObject(writer http.ResponseWriter, request *http.Request, account, container string) {
+	switch request.Method {
+	case "GET", "HEAD":
+		writer = renameHeaders(writer, map[string]string{
+			SYSMETA_RETAIN_UNTIL:  CLIENT_RETAIN_UNTIL,
+			TRANSIENT_OBJECT_HOLD: CLIENT_OBJECT_HOLD,
+		})
+	case "POST":
+		// Object POSTs can't change sysmeta, so retention is fixed at PUT
+		// time; holds may be placed and lifted by anyone allowed to POST.
+		if request.Header.Get(CLIENT_RETAIN_UNTIL) != "" {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Object retention can only be set on PUT.")
+			return
+		}
+		ci, err := GetProxyContext(request).C.GetContainerInfo(request.Context(), account, container)
+		if err != nil {
+			srv.StandardResponse(writer, common.ErrorStatus(err))
+			return
+		}
+		current := http.Header{}
+		_, holdGiven := request.Header[CLIENT_OBJECT_HOLD]
+		if !holdGiven || request.Header.Get("X-Delete-At") != "" || request.Header.Get("X-Delete-After") != "" {
+			headers, status := o.currentLock(request)
+			if status != http.StatusOK {
+				srv.StandardResponse(writer, status)
+				return
+			} else if headers != nil {
+				current = headers
+			}
+		}
+		if msg := o.setHold(request, ci.SysMetadata, current); msg != "" {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, msg)
+			return
+		}
+	case "PUT", "DELETE":
+		ci, err := GetProxyContext(request).C.GetContainerInfo(request.Context(), account, container)
+		if err != nil {
+			srv.StandardResponse(writer, common.ErrorStatus(err))
+			return
+		}
+		if reason, status := o.lockedReason(request, ci.SysMetadata); status != http.StatusOK {
+			srv.StandardResponse(writer, status)
+			return
+		} else if reason != "" {
+			o.rejected.Inc(1)
+			srv.SimpleErrorResponse(writer, http.StatusConflict, reason)
+			return
+		}
+		if request.Method == "PUT" {
+			if msg := o.setRetention(request, ci.SysMetadata); msg != "" {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, msg)
+				return
+			}
+		}
+	}
+	o.next.ServeHTTP(writer, request)
+}
+
+func (o *objectLock) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, object := getPathParts(request)
+	if !apiReq || container == "" {
+		o.next.ServeHTTP(writer, request)
+		return
+	}
+	if object == "" {
+		o.handleContainer(writer, request)
+		return
+	}
+	o.handleObject(writer, request, account, container)
+}
+
+func init() {
+	Register(Registration{Name: "object_lock", Position: 250, New: NewObjectLock})
+}
+
+// NewObjectLock returns the object lock (WORM) middleware.  Objects may be
+// written with X-Object-Retain-Until (a unix timestamp) and
+// X-Object-Legal-Hold, and containers may carry a default
+// X-Container-Retention-Period in seconds and an X-Container-Legal-Hold that
+// covers every object in them.  An object's hold can also be placed or lifted
+// later with a POST.  Locked objects can't be deleted or overwritten until
+// their retention passes and all holds are lifted.
+func NewObjectLock(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	maxRetentionPeriod := config.GetInt("max_retention_period", 0)
+	RegisterInfo("object_lock", map[string]interface{}{"max_retention_period": maxRetentionPeriod})
+	rejected := metricsScope.Counter("object_lock_rejected")
+	return func(next http.Handler) http.Handler {
+		return &objectLock{next: next, maxRetentionPeriod: maxRetentionPeriod, rejected: rejected}
+	}, nil
+}
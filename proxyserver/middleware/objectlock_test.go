@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+// newTestObjectLock returns an object lock handler in front of a fake backend
+// that holds a single object with the given headers, along with a request
+// wrapper that supplies the proxy context.
+func newTestObjectLock(t *testing.T, containerSysmeta map[string]string, objHeaders map[string]string) (http.Handler, func(*http.Request) *http.Request, *http.Header) {
+	config, err := conf.StringConfig("[filter:object_lock]\nenabled = true")
+	require.Nil(t, err)
+	mid, err := NewObjectLock(config.GetSection("filter:object_lock"), common.NewTestScope())
+	require.Nil(t, err)
+	var gotHeader http.Header
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "HEAD", "GET":
+			if objHeaders == nil {
+				w.WriteHeader(404)
+				return
+			}
+			for k, v := range objHeaders {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(200)
+		default:
+			gotHeader = r.Header
+			w.WriteHeader(201)
+		}
+	}))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		ProxyContextMiddleware: &ProxyContextMiddleware{next: h},
+		Logger:                 zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {SysMetadata: containerSysmeta},
+		}, zap.NewNop()),
+	}
+	withContext := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+	}
+	return h, withContext, &gotHeader
+}
+
+func TestObjectLockRetained(t *testing.T) {
+	until := strconv.FormatInt(time.Now().Unix()+3600, 10)
+	h, withContext, _ := newTestObjectLock(t, map[string]string{}, map[string]string{SYSMETA_RETAIN_UNTIL: until})
+	for _, method := range []string{"DELETE", "PUT"} {
+		req, err := http.NewRequest(method, "/v1/a/c/o", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withContext(req))
+		require.Equal(t, http.StatusConflict, w.Code)
+	}
+
+	req, err := http.NewRequest("HEAD", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, until, w.Header().Get(CLIENT_RETAIN_UNTIL))
+
+	expired := strconv.FormatInt(time.Now().Unix()-3600, 10)
+	h, withContext, _ = newTestObjectLock(t, map[string]string{}, map[string]string{SYSMETA_RETAIN_UNTIL: expired})
+	req, err = http.NewRequest("DELETE", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+}
+
+func TestObjectLockLegalHold(t *testing.T) {
+	h, withContext, gotHeader := newTestObjectLock(t, map[string]string{}, map[string]string{TRANSIENT_OBJECT_HOLD: "true"})
+	req, err := http.NewRequest("DELETE", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Meta-Color", "blue")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "true", (*gotHeader).Get(TRANSIENT_OBJECT_HOLD))
+
+	req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_OBJECT_HOLD, "false")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "", (*gotHeader).Get(TRANSIENT_OBJECT_HOLD))
+	require.Equal(t, "", (*gotHeader).Get(CLIENT_OBJECT_HOLD))
+
+	req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_RETAIN_UNTIL, "1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 400, w.Code)
+
+	h, withContext, _ = newTestObjectLock(t, map[string]string{"Legal-Hold": "true"}, nil)
+	req, err = http.NewRequest("DELETE", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestObjectLockPutRetention(t *testing.T) {
+	h, withContext, gotHeader := newTestObjectLock(t, map[string]string{"Retention-Period": "60"}, nil)
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_OBJECT_HOLD, "yes")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	until, err := strconv.ParseInt((*gotHeader).Get(SYSMETA_RETAIN_UNTIL), 10, 64)
+	require.Nil(t, err)
+	require.True(t, until > time.Now().Unix())
+	require.Equal(t, "true", (*gotHeader).Get(TRANSIENT_OBJECT_HOLD))
+	require.Equal(t, "", (*gotHeader).Get(CLIENT_OBJECT_HOLD))
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Delete-At", strconv.FormatInt(time.Now().Unix()+10, 10))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_RETENTION_PERIOD, "-1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_RETENTION_PERIOD, "86400")
+	req.Header.Set(CLIENT_CONTAINER_HOLD, "true")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "86400", (*gotHeader).Get(SYSMETA_RETENTION_PERIOD))
+	require.Equal(t, "true", (*gotHeader).Get(SYSMETA_CONTAINER_HOLD))
+}
+
+func TestObjectLockDeleteAt(t *testing.T) {
+	h, withContext, gotHeader := newTestObjectLock(t, map[string]string{"Retention-Period": "3600"}, nil)
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_RETAIN_UNTIL, "0")
+	req.Header.Set("X-Delete-After", "10")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set(CLIENT_RETAIN_UNTIL, strconv.FormatInt(time.Now().Unix()+10, 10))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	until, err := strconv.ParseInt((*gotHeader).Get(SYSMETA_RETAIN_UNTIL), 10, 64)
+	require.Nil(t, err)
+	require.True(t, until >= time.Now().Unix()+3500)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Delete-After", "7200")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 201, w.Code)
+	require.NotEqual(t, "", (*gotHeader).Get("X-Delete-At"))
+	require.Equal(t, "", (*gotHeader).Get("X-Delete-After"))
+
+	retained := strconv.FormatInt(time.Now().Unix()+3600, 10)
+	h, withContext, _ = newTestObjectLock(t, map[string]string{}, map[string]string{SYSMETA_RETAIN_UNTIL: retained})
+	for _, header := range []string{"X-Delete-At", "X-Delete-After"} {
+		req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+		require.Nil(t, err)
+		if header == "X-Delete-At" {
+			req.Header.Set(header, strconv.FormatInt(time.Now().Unix()+10, 10))
+		} else {
+			req.Header.Set(header, "10")
+		}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, withContext(req))
+		require.Equal(t, 400, w.Code, header)
+	}
+
+	h, withContext, _ = newTestObjectLock(t, map[string]string{}, map[string]string{TRANSIENT_OBJECT_HOLD: "true"})
+	req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Delete-After", "86400")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(req))
+	require.Equal(t, 400, w.Code)
+}
@@ -0,0 +1,144 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+var (
+	aml            sync.Mutex
+	allowedMethods = map[string][]string{
+		"account":   {"HEAD", "GET", "PUT", "POST", "DELETE", "OPTIONS"},
+		"container": {"HEAD", "GET", "PUT", "POST", "DELETE", "OPTIONS"},
+		"object":    {"HEAD", "GET", "PUT", "POST", "DELETE", "OPTIONS"},
+	}
+)
+
+// RegisterMethods adds methods a middleware handles for a resource type
+// ("account", "container" or "object") to what OPTIONS responses report in
+// Allow and what CORS preflight requests may ask for.
+func RegisterMethods(resourceType string, methods ...string) {
+	aml.Lock()
+	defer aml.Unlock()
+	for _, method := range methods {
+		if !common.StringInSlice(method, allowedMethods[resourceType]) {
+			allowedMethods[resourceType] = append(allowedMethods[resourceType], method)
+		}
+	}
+	info := make(map[string][]string, len(allowedMethods))
+	for k, v := range allowedMethods {
+		info[k] = append([]string{}, v...)
+	}
+	RegisterInfo("allowed_methods", info)
+}
+
+func getAllowedMethods(resourceType string) []string {
+	aml.Lock()
+	defer aml.Unlock()
+	return append([]string{}, allowedMethods[resourceType]...)
+}
+
+func setVary(writer http.ResponseWriter, h string) {
+	if v := writer.Header().Get("Vary"); v != "" {
+		writer.Header().Set("Vary", fmt.Sprintf("%s, %s", v, h))
+	} else {
+		writer.Header().Set("Vary", h)
+	}
+}
+
+type optionsMiddleware struct {
+	next         http.Handler
+	corsDefaults map[string]string
+}
+
+func (o *optionsMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	if request.Method != "OPTIONS" || !apiReq || account == "" {
+		o.next.ServeHTTP(writer, request)
+		return
+	}
+	resourceType := "account"
+	if obj != "" {
+		resourceType = "object"
+	} else if container != "" {
+		resourceType = "container"
+	}
+	methods := getAllowedMethods(resourceType)
+	methodString := strings.Join(methods, ", ")
+	origin := request.Header.Get("Origin")
+	if origin == "" || container == "" {
+		writer.Header().Set("Allow", methodString)
+		srv.StandardResponse(writer, 200)
+		return
+	}
+	if rqm := request.Header.Get("Access-Control-Request-Method"); rqm == "" || !common.StringInSlice(rqm, methods) {
+		srv.SimpleErrorResponse(writer, 401, "")
+		return
+	}
+	ctx := GetProxyContext(request)
+	if ci, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == nil {
+		meta := corsPolicy(o.corsDefaults, ci)
+		if common.IsOriginAllowed(meta["Access-Control-Allow-Origin"], origin) {
+			writer.Header().Set("Allow", methodString)
+			if meta["Access-Control-Allow-Origin"] == "*" {
+				writer.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				writer.Header().Set("Access-Control-Allow-Origin", origin)
+				setVary(writer, "Origin")
+			}
+			writer.Header().Set("Access-Control-Allow-Methods", methodString)
+			if ma := meta["Access-Control-Max-Age"]; ma != "" {
+				writer.Header().Set("Access-Control-Max-Age", ma)
+			}
+			if rh := request.Header.Get("Access-Control-Request-Headers"); rh != "" {
+				writer.Header().Set("Access-Control-Allow-Headers", rh)
+				setVary(writer, "Access-Control-Request-Headers")
+			}
+			srv.StandardResponse(writer, 200)
+			return
+		}
+	}
+	srv.SimpleErrorResponse(writer, 401, "")
+}
+
+func init() {
+	Register(Registration{Name: "options", Position: 50, New: NewOptions})
+}
+
+// NewOptions returns the middleware that answers every OPTIONS request for
+// an account, container or object, including CORS preflight requests, so
+// they don't need to pass through auth and the rest of the pipeline.  The
+// Allow header lists the methods for that type of resource, which
+// middlewares may extend with RegisterMethods.  Preflight requests for
+// containers without a CORS policy of their own are answered from the
+// default policy in the options filter's section, set like the cors
+// filter's.
+func NewOptions(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	RegisterMethods("object")
+	defaults := corsDefaults(config)
+	return func(next http.Handler) http.Handler {
+		return &optionsMiddleware{next: next, corsDefaults: defaults}
+	}, nil
+}
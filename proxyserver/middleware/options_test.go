@@ -0,0 +1,151 @@
+//  Copyright (c) 2017 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func newTestOptions(t *testing.T, containerMeta map[string]string, settings string) (http.Handler, func(*http.Request) *http.Request) {
+	config, err := conf.StringConfig("[filter:options]\n" + settings)
+	require.Nil(t, err)
+	mid, err := NewOptions(config.GetSection("filter:options"), common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {Metadata: containerMeta},
+		}, zap.NewNop()),
+	}
+	return h, func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+	}
+}
+
+func TestOptionsHandler(t *testing.T) {
+	h, withContext := newTestOptions(t, map[string]string{"Access-Control-Allow-Origin": "there.com"}, "")
+	r := withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	require.True(t, strings.HasPrefix(w.Header().Get("Allow"), "HEAD, GET"))
+
+	r.Header.Set("Origin", "hey.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+
+	r.Header.Set("Origin", "there.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "there.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	r.Header.Set("Access-Control-Request-Method", "MOO")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+}
+
+func TestOptionsHandlerStar(t *testing.T) {
+	h, withContext := newTestOptions(t, map[string]string{"Access-Control-Allow-Origin": "*"}, "")
+	r := withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	r.Header.Set("Origin", "hey.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestOptionsHandlerNotSetup(t *testing.T) {
+	h, withContext := newTestOptions(t, map[string]string{}, "")
+	r := withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	r.Header.Set("Origin", "hey.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+	require.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestOptionsHandlerCorsDefaults(t *testing.T) {
+	defaults := "default_allow_origin = app.com\ndefault_max_age = 3600\n"
+	h, withContext := newTestOptions(t, map[string]string{}, defaults)
+	r := withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	r.Header.Set("Origin", "app.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "app.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+
+	h, withContext = newTestOptions(t, map[string]string{"Access-Control-Allow-Origin": "there.com"}, defaults)
+	r = withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	r.Header.Set("Origin", "app.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+
+	// without defaults in its own section, there's no policy
+	h, withContext = newTestOptions(t, map[string]string{}, "")
+	r = withContext(httptest.NewRequest("OPTIONS", "/v1/a/c/o", nil))
+	r.Header.Set("Origin", "app.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+}
+
+func TestOptionsAllowPerResource(t *testing.T) {
+	h, withContext := newTestOptions(t, map[string]string{}, "")
+	RegisterMethods("object", "COPY")
+	for path, copyAllowed := range map[string]bool{"/v1/a": false, "/v1/a/c": false, "/v1/a/c/o": true} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withContext(httptest.NewRequest("OPTIONS", path, nil)))
+		require.Equal(t, 200, w.Code)
+		require.Equal(t, copyAllowed, strings.Contains(w.Header().Get("Allow"), "COPY"), path)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, withContext(httptest.NewRequest("GET", "/v1/a/c/o", nil)))
+	require.Equal(t, http.StatusTeapot, w.Code)
+}
@@ -18,7 +18,7 @@ func TestGet(t *testing.T) {
 	})
 	fakeContext := NewFakeProxyContext(passthrough)
 	dummy, err := http.NewRequest("GET", "/someurl", nil)
-	dummy = dummy.WithContext(context.WithValue(dummy.Context(), "proxycontext", fakeContext))
+	dummy = dummy.WithContext(context.WithValue(dummy.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 	body, header, code := PipedGet("/ver/a/c/o", dummy, "test", nil)
 	require.Equal(t, 200, code)
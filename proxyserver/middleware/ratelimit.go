@@ -17,9 +17,12 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/troubling/hummingbird/common"
@@ -33,6 +36,10 @@ import (
 const rateBuffer = int64(5 * time.Second)
 const maxSleep = int64(60 * time.Second)
 const nsPerSecond = int64(1000000000)
+const casTries = 5
+const maxLocalBuckets = 10000
+
+var errCASContention = errors.New("too many concurrent ratelimit updates")
 
 var writeMethods = map[string]bool{"PUT": true, "DELETE": true, "POST": true}
 
@@ -45,9 +52,97 @@ var writeMethods = map[string]bool{"PUT": true, "DELETE": true, "POST": true}
 type ratelimiter struct {
 	accountLimit   int64
 	containerLimit int64
+	burstSeconds   float64
+	local          *localBuckets
+	fallbacks      tally.Counter
 	next           http.Handler
 }
 
+// tokenBucket holds up to burst tokens, refilled at a ratelimit's rate per
+// second; each request takes one.  Once the bucket is empty it goes into
+// debt and requests sleep until their token would have been refilled.
+type tokenBucket struct {
+	Tokens  float64 `json:"tokens"`
+	Updated int64   `json:"updated"`
+}
+
+// take takes a token as of now and returns the ns to sleep for it.
+func (tb *tokenBucket) take(now int64, ratePs int64, burst float64) int64 {
+	if tb.Updated == 0 {
+		tb.Tokens = burst
+	} else if now > tb.Updated {
+		tb.Tokens = math.Min(burst, tb.Tokens+float64(now-tb.Updated)*float64(ratePs)/float64(nsPerSecond))
+	}
+	if now > tb.Updated {
+		tb.Updated = now
+	}
+	tb.Tokens--
+	if tb.Tokens >= 0 {
+		return 0
+	}
+	return int64(-tb.Tokens * float64(nsPerSecond) / float64(ratePs))
+}
+
+// localBuckets are used in place of the shared buckets while memcache is
+// unavailable, so each proxy still limits on its own.
+type localBuckets struct {
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *localBuckets) getSleepTime(key string, ratePs int64, burst float64) int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := nowNano()
+	if len(l.buckets) >= maxLocalBuckets {
+		for k, tb := range l.buckets {
+			if now-tb.Updated > maxSleep+rateBuffer {
+				delete(l.buckets, k)
+			}
+		}
+	}
+	tb := l.buckets[key]
+	if tb == nil {
+		tb = &tokenBucket{}
+		l.buckets[key] = tb
+	}
+	sleepTime := tb.take(now, ratePs, burst)
+	if sleepTime > maxSleep {
+		// rejected requests don't use up a token
+		tb.Tokens++
+	}
+	return sleepTime
+}
+
+// burst is how many tokens a bucket for ratePs holds.
+func (r *ratelimiter) burst(ratePs int64) float64 {
+	return math.Max(1, r.burstSeconds*float64(ratePs))
+}
+
+// getTokenBucketSleepTime takes a token from the bucket shared by all proxies
+// through memcache, returning the ns to sleep before serving the request.
+func (r *ratelimiter) getTokenBucketSleepTime(ctx context.Context, mc ring.CASMemcacheRing, key string, ratePs int64) (int64, error) {
+	for i := 0; i < casTries; i++ {
+		var tb tokenBucket
+		cas, err := mc.GetStructuredCAS(ctx, key, &tb)
+		if err == ring.CacheMiss {
+			cas = 0
+		} else if err != nil {
+			return 0, err
+		}
+		sleepTime := tb.take(nowNano(), ratePs, r.burst(ratePs))
+		if sleepTime > maxSleep {
+			return sleepTime, nil
+		}
+		if err = mc.SetCAS(ctx, key, &tb, cas, 3600); err == nil {
+			return sleepTime, nil
+		} else if err != ring.CASConflict && err != ring.CacheMiss {
+			return 0, err
+		}
+	}
+	return 0, errCASContention
+}
+
 var sleep = func(s time.Duration) {
 	time.Sleep(s)
 }
@@ -123,30 +218,51 @@ func (r *ratelimiter) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 		}
 	}
 	if limit > 0 {
-		sleepTime, err := r.getSleepTime(request.Context(), ctx.Cache, ratekey, limit)
-		if err == nil {
-			if sleepTime > maxSleep {
-				sleep(time.Second)
-				srv.StandardResponse(writer, 498)
-				return
-			}
-			sleep(time.Duration(sleepTime))
-		} else {
-			ctx.Logger.Debug("Ratelimiter errored while getting sleep time", zap.Error(err))
+		var sleepTime int64
+		err := errors.New("no memcache ring")
+		if mc, ok := ctx.Cache.(ring.CASMemcacheRing); ok {
+			sleepTime, err = r.getTokenBucketSleepTime(request.Context(), mc, ratekey, limit)
+		} else if ctx.Cache != nil {
+			sleepTime, err = r.getSleepTime(request.Context(), ctx.Cache, ratekey, limit)
 		}
+		if err != nil {
+			ctx.Logger.Debug("Ratelimiter errored while getting sleep time; using local limits", zap.Error(err))
+			r.fallbacks.Inc(1)
+			sleepTime = r.local.getSleepTime(ratekey, limit, r.burst(limit))
+		}
+		if sleepTime > maxSleep {
+			sleep(time.Second)
+			srv.StandardResponse(writer, 498)
+			return
+		}
+		sleep(time.Duration(sleepTime))
 	}
 	r.next.ServeHTTP(writer, request)
 }
 
+func init() {
+	Register(Registration{Name: "ratelimit", Position: 200, New: NewRatelimiter})
+}
+
+// NewRatelimiter returns the ratelimit middleware, which limits writes to
+// accounts and containers.  Limits are kept in token buckets shared by all
+// proxies through memcache, which hold burst_seconds worth of requests; while
+// memcache is unavailable, each proxy falls back to buckets of its own.
 func NewRatelimiter(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 
 	accLimit := int64(config.GetInt("account_db_max_writes_per_sec", 0))
 	contLimit := int64(config.GetInt("container_db_max_writes_per_sec", 0))
-	RegisterInfo("ratelimit", map[string]interface{}{"account_ratelimit": accLimit, "container_ratelimits": [][]int64{{contLimit}}, "max_sleep_time_seconds": float64(60.0)})
+	burstSeconds := config.GetFloat("burst_seconds", float64(rateBuffer)/float64(nsPerSecond))
+	RegisterInfo("ratelimit", map[string]interface{}{"account_ratelimit": accLimit, "container_ratelimits": [][]int64{{contLimit}}, "max_sleep_time_seconds": float64(60.0), "burst_seconds": burstSeconds})
+	local := &localBuckets{buckets: map[string]*tokenBucket{}}
+	fallbacks := metricsScope.Counter("ratelimit_local_fallbacks")
 	return func(next http.Handler) http.Handler {
 		return &ratelimiter{
 			accountLimit:   accLimit,
 			containerLimit: contLimit,
+			burstSeconds:   burstSeconds,
+			local:          local,
+			fallbacks:      fallbacks,
 			next:           next,
 		}
 	}, nil
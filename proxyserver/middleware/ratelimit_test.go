@@ -17,11 +17,13 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/troubling/hummingbird/common/ring"
 	"github.com/troubling/hummingbird/common/test"
 )
 
@@ -125,3 +127,101 @@ func TestServeHTTP(t *testing.T) {
 	assert.Equal(t, s.SleepVals[len(s.SleepVals)-1], time.Second)
 }
 */
+
+// casMemcacheRing keeps structured values with CAS tokens; conflicts makes
+// the next SetCAS calls fail as if someone else had changed the value.
+type casMemcacheRing struct {
+	test.FakeMemcacheRing
+	values    map[string][]byte
+	cas       map[string]uint64
+	conflicts int
+}
+
+func (mr *casMemcacheRing) GetStructuredCAS(ctx context.Context, key string, val interface{}) (uint64, error) {
+	v, ok := mr.values[key]
+	if !ok {
+		return 0, ring.CacheMiss
+	}
+	return mr.cas[key], json.Unmarshal(v, val)
+}
+
+func (mr *casMemcacheRing) SetCAS(ctx context.Context, key string, value interface{}, cas uint64, timeout int) error {
+	if mr.conflicts > 0 {
+		mr.conflicts--
+		return ring.CASConflict
+	}
+	if mr.cas[key] != cas {
+		return ring.CASConflict
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	mr.values[key] = v
+	mr.cas[key]++
+	return nil
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := &tokenBucket{}
+	assert.Equal(t, int64(0), tb.take(now, 10, 2))
+	assert.Equal(t, int64(0), tb.take(now, 10, 2))
+	assert.Equal(t, nsPerSecond/10, tb.take(now, 10, 2))
+	assert.Equal(t, 2*nsPerSecond/10, tb.take(now, 10, 2))
+	// a second later the debt is paid and the bucket is full again
+	assert.Equal(t, int64(0), tb.take(now+nsPerSecond, 10, 2))
+	assert.Equal(t, 1.0, tb.Tokens)
+}
+
+func TestGetTokenBucketSleepTime(t *testing.T) {
+	oldNowNano := nowNano
+	defer func() {
+		nowNano = oldNowNano
+	}()
+	nowNano = fakeNowNano
+	mr := &casMemcacheRing{values: map[string][]byte{}, cas: map[string]uint64{}}
+	rt := ratelimiter{burstSeconds: 1}
+
+	sleepTime, err := rt.getTokenBucketSleepTime(context.Background(), mr, "key", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), sleepTime)
+	sleepTime, err = rt.getTokenBucketSleepTime(context.Background(), mr, "key", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), sleepTime)
+	mr.conflicts = casTries - 1
+	sleepTime, err = rt.getTokenBucketSleepTime(context.Background(), mr, "key", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, nsPerSecond/2, sleepTime)
+
+	mr.conflicts = casTries
+	_, err = rt.getTokenBucketSleepTime(context.Background(), mr, "key", 2)
+	assert.Equal(t, errCASContention, err)
+
+	// requests that would sleep too long don't take a token
+	rt.burstSeconds = 0
+	for i := 0; i < 61; i++ {
+		rt.getTokenBucketSleepTime(context.Background(), mr, "key2", 1)
+	}
+	sleepTime, err = rt.getTokenBucketSleepTime(context.Background(), mr, "key2", 1)
+	assert.Nil(t, err)
+	assert.True(t, sleepTime > maxSleep)
+	var tb tokenBucket
+	mr.GetStructuredCAS(context.Background(), "key2", &tb)
+	assert.Equal(t, -60.0, tb.Tokens)
+}
+
+func TestLocalBuckets(t *testing.T) {
+	oldNowNano := nowNano
+	defer func() {
+		nowNano = oldNowNano
+	}()
+	nowNano = fakeNowNano
+	l := &localBuckets{buckets: map[string]*tokenBucket{}}
+	assert.Equal(t, int64(0), l.getSleepTime("key", 1, 1))
+	assert.Equal(t, nsPerSecond, l.getSleepTime("key", 1, 1))
+	assert.Equal(t, int64(0), l.getSleepTime("other", 1, 1))
+	for i := 0; i < 100; i++ {
+		l.getSleepTime("key", 1, 1)
+	}
+	assert.Equal(t, -60.0, l.buckets["key"].Tokens)
+}
@@ -0,0 +1,98 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/uber-go/tally"
+)
+
+// Constructor builds a middleware from its config section.
+type Constructor func(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error)
+
+// Registration describes a middleware that proxy pipelines can use.
+type Registration struct {
+	// Name is what the middleware is called in a pipeline setting.
+	Name string
+	// Section is the config section it's built from, "filter:" + Name if
+	// left empty.
+	Section string
+	// Position orders the middleware in the default pipeline, lowest
+	// first.  Middleware with a Position of 0 are only used if a pipeline
+	// setting names them.
+	Position int
+	New      Constructor
+}
+
+var (
+	registryLock sync.Mutex
+	registry     = map[string]*Registration{}
+)
+
+// Register makes a middleware available to proxy pipelines.  It's meant to
+// be called from an init function, in this package or any other compiled
+// into the proxy, and panics if the name is already taken.
+func Register(r Registration) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[r.Name]; ok {
+		panic(fmt.Sprintf("middleware %q registered twice", r.Name))
+	}
+	if r.Section == "" {
+		r.Section = "filter:" + r.Name
+	}
+	registry[r.Name] = &r
+}
+
+// Registered returns the named middleware's registration.
+func Registered(name string) (Registration, bool) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	r, ok := registry[name]
+	if !ok {
+		return Registration{}, false
+	}
+	return *r, true
+}
+
+// DefaultPipeline returns the names of the middleware with a Position, in
+// order.
+func DefaultPipeline() []string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	var regs []*Registration
+	for _, r := range registry {
+		if r.Position != 0 {
+			regs = append(regs, r)
+		}
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		if regs[i].Position != regs[j].Position {
+			return regs[i].Position < regs[j].Position
+		}
+		return regs[i].Name < regs[j].Name
+	})
+	names := make([]string, len(regs))
+	for i, r := range regs {
+		names[i] = r.Name
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/uber-go/tally"
+)
+
+func TestRegistry(t *testing.T) {
+	pipeline := DefaultPipeline()
+	require.Equal(t, "header_policy", pipeline[0])
+	require.Equal(t, "catch_errors", pipeline[1])
+	require.Equal(t, "encryption", pipeline[len(pipeline)-1])
+
+	reg, ok := Registered("s3auth")
+	require.True(t, ok)
+	require.Equal(t, "filter:s3api", reg.Section)
+	reg, ok = Registered("bulk")
+	require.True(t, ok)
+	require.Equal(t, "filter:bulk", reg.Section)
+	_, ok = Registered("nonexistent")
+	require.False(t, ok)
+
+	noop := func(conf.Section, tally.Scope) (func(http.Handler) http.Handler, error) {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+	Register(Registration{Name: "test_plugin", New: noop})
+	defer func() {
+		registryLock.Lock()
+		delete(registry, "test_plugin")
+		registryLock.Unlock()
+	}()
+	_, ok = Registered("test_plugin")
+	require.True(t, ok)
+	require.NotContains(t, DefaultPipeline(), "test_plugin")
+	require.Panics(t, func() { Register(Registration{Name: "test_plugin", New: noop}) })
+}
@@ -0,0 +1,438 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Resumable uploads let a client send an object in chunks it can retry, so a
+// dropped connection costs it a chunk rather than the whole upload:
+//
+//	POST /v1/a/c/o?upload-session                  starts a session, answering
+//	                                               with X-Upload-Session: <id>;
+//	                                               send X-Upload-Length if the
+//	                                               size is known
+//	PUT /v1/a/c/o?upload-session=<id>              stores the body at the byte
+//	                                               offset in X-Upload-Offset
+//	HEAD /v1/a/c/o?upload-session=<id>             reports in X-Upload-Offset
+//	                                               how many bytes from the start
+//	                                               have been received
+//	POST /v1/a/c/o?upload-session=<id>&commit      makes the object from them;
+//	                                               send Content-Type and any
+//	                                               X-Object-Meta-* with it
+//	DELETE /v1/a/c/o?upload-session=<id>           abandons the session
+//
+// Chunks go in the <c>+segments container, the same one s3api uses, and
+// committing writes a static large object manifest for them.  Chunks may
+// overlap or be sent again; the manifest uses ranges of them to cover each
+// byte once.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/containerserver"
+	"github.com/uber-go/tally"
+)
+
+const (
+	uploadSessionParam  = "upload-session"
+	uploadSessionHeader = "X-Upload-Session"
+	uploadOffsetHeader  = "X-Upload-Offset"
+	uploadLengthHeader  = "X-Upload-Length"
+	uploadLengthMeta    = "X-Object-Meta-Upload-Length"
+)
+
+// uploadChunk is a chunk of a resumable upload stored as a segment.
+type uploadChunk struct {
+	name   string
+	offset int64
+	size   int64
+	etag   string
+}
+
+// planUpload works out the manifest for chunks: the chunks, or ranges of
+// them, that cover the upload from its start without overlapping, up to the
+// first gap.  It returns the manifest's entries, how many bytes they cover,
+// and which chunks they use.
+func planUpload(segContainer string, chunks []uploadChunk) ([]sloPutManifest, int64, map[string]bool) {
+	sorted := append([]uploadChunk(nil), chunks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].offset != sorted[j].offset {
+			return sorted[i].offset < sorted[j].offset
+		}
+		return sorted[i].size > sorted[j].size
+	})
+	var manifest []sloPutManifest
+	used := map[string]bool{}
+	received := int64(0)
+	for _, c := range sorted {
+		if c.offset > received {
+			break
+		}
+		if c.size == 0 || c.offset+c.size <= received {
+			continue
+		}
+		entry := sloPutManifest{Path: "/" + segContainer + "/" + common.Urlencode(c.name), Etag: c.etag, SizeBytes: c.size}
+		if c.offset < received {
+			entry.Range = fmt.Sprintf("%d-%d", received-c.offset, c.size-1)
+		}
+		manifest = append(manifest, entry)
+		used[c.name] = true
+		received = c.offset + c.size
+	}
+	return manifest, received, used
+}
+
+type resumableUpload struct {
+	next           http.Handler
+	requestsMetric tally.Counter
+	commitsMetric  tally.Counter
+}
+
+// session holds the names for one upload session's request.
+type session struct {
+	id           string
+	account      string
+	container    string
+	object       string
+	segContainer string
+}
+
+func (s *session) path(container, object string) string {
+	if object == "" {
+		return fmt.Sprintf("/v1/%s/%s", common.Urlencode(s.account), common.Urlencode(container))
+	}
+	return fmt.Sprintf("/v1/%s/%s/%s", common.Urlencode(s.account), common.Urlencode(container), common.Urlencode(object))
+}
+
+// marker is the name of the zero byte object that records the session.
+func (s *session) marker() string {
+	return s.id + "/" + s.object
+}
+
+func (s *session) chunkName(offset int64) string {
+	return fmt.Sprintf("%s/%016d", s.marker(), offset)
+}
+
+// subrequest makes a bodiless subrequest, answering the request itself and
+// returning false if it can't.
+func (ru *resumableUpload) subrequest(writer http.ResponseWriter, request *http.Request, method, path string) (*captureWriter, bool) {
+	ctx := GetProxyContext(request)
+	newReq, err := ctx.newSubrequest(method, path, http.NoBody, request, "resumable")
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return nil, false
+	}
+	if method == "PUT" {
+		newReq.Header.Set("Content-Length", "0")
+	}
+	w := NewCaptureWriter()
+	ctx.serveHTTPSubrequest(w, newReq)
+	return w, true
+}
+
+// chunks returns the session's chunks, along with the upload's length if
+// it was given when the session started, or -1.  It answers the request
+// itself and returns false if it can't.
+func (ru *resumableUpload) chunks(writer http.ResponseWriter, request *http.Request, s *session) ([]uploadChunk, int64, bool) {
+	w, ok := ru.subrequest(writer, request, "HEAD", s.path(s.segContainer, s.marker()))
+	if !ok {
+		return nil, 0, false
+	}
+	if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return nil, 0, false
+	}
+	length := int64(-1)
+	if v := w.Header().Get(uploadLengthMeta); v != "" {
+		if l, err := strconv.ParseInt(v, 10, 64); err == nil {
+			length = l
+		}
+	}
+	prefix := s.marker() + "/"
+	w, ok = ru.subrequest(writer, request, "GET", s.path(s.segContainer, "")+"?format=json&prefix="+common.Urlencode(prefix))
+	if !ok {
+		return nil, 0, false
+	}
+	if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return nil, 0, false
+	}
+	var listing []containerserver.ObjectListingRecord
+	if err := json.Unmarshal(w.body, &listing); err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	var chunks []uploadChunk
+	for _, obj := range listing {
+		offset, err := strconv.ParseInt(strings.TrimPrefix(obj.Name, prefix), 10, 64)
+		if err != nil || offset < 0 {
+			continue
+		}
+		chunks = append(chunks, uploadChunk{name: obj.Name, offset: offset, size: obj.Size, etag: obj.ETag})
+	}
+	return chunks, length, true
+}
+
+func (ru *resumableUpload) start(writer http.ResponseWriter, request *http.Request, s *session) {
+	length := request.Header.Get(uploadLengthHeader)
+	if length != "" {
+		if l, err := strconv.ParseInt(length, 10, 64); err != nil || l < 0 {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid "+uploadLengthHeader)
+			return
+		}
+	}
+	if w, ok := ru.subrequest(writer, request, "HEAD", s.path(s.container, "")); !ok {
+		return
+	} else if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return
+	}
+	if w, ok := ru.subrequest(writer, request, "PUT", s.path(s.segContainer, "")); !ok {
+		return
+	} else if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return
+	}
+	ctx := GetProxyContext(request)
+	newReq, err := ctx.newSubrequest("PUT", s.path(s.segContainer, s.marker()), http.NoBody, request, "resumable")
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	newReq.Header.Set("Content-Length", "0")
+	if length != "" {
+		newReq.Header.Set(uploadLengthMeta, length)
+	}
+	w := NewCaptureWriter()
+	ctx.serveHTTPSubrequest(w, newReq)
+	if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return
+	}
+	writer.Header().Set(uploadSessionHeader, s.id)
+	srv.StandardResponse(writer, http.StatusCreated)
+}
+
+func (ru *resumableUpload) putChunk(writer http.ResponseWriter, request *http.Request, s *session) {
+	offset, err := strconv.ParseInt(request.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Invalid "+uploadOffsetHeader)
+		return
+	}
+	w, ok := ru.subrequest(writer, request, "HEAD", s.path(s.segContainer, s.marker()))
+	if !ok {
+		return
+	}
+	if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return
+	}
+	if length, err := strconv.ParseInt(w.Header().Get(uploadLengthMeta), 10, 64); err == nil && request.ContentLength >= 0 && offset+request.ContentLength > length {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Chunk runs past "+uploadLengthHeader)
+		return
+	}
+	ctx := GetProxyContext(request)
+	newReq, err := ctx.newSubrequest("PUT", s.path(s.segContainer, s.chunkName(offset)), request.Body, request, "resumable")
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	newReq.Header.Set("Content-Length", request.Header.Get("Content-Length"))
+	newReq.Header.Set("Content-Type", "application/octet-stream")
+	if etag := request.Header.Get("Etag"); etag != "" {
+		newReq.Header.Set("Etag", etag)
+	}
+	w = NewCaptureWriter()
+	ctx.serveHTTPSubrequest(w, newReq)
+	if w.status/100 != 2 {
+		srv.StandardResponse(writer, w.status)
+		return
+	}
+	writer.Header().Set("Etag", w.Header().Get("Etag"))
+	srv.StandardResponse(writer, http.StatusCreated)
+}
+
+func (ru *resumableUpload) status(writer http.ResponseWriter, request *http.Request, s *session) {
+	chunks, length, ok := ru.chunks(writer, request, s)
+	if !ok {
+		return
+	}
+	_, received, _ := planUpload(s.segContainer, chunks)
+	writer.Header().Set(uploadOffsetHeader, strconv.FormatInt(received, 10))
+	if length >= 0 {
+		writer.Header().Set(uploadLengthHeader, strconv.FormatInt(length, 10))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// deleteChunks deletes the session's chunks that aren't in keep, then its
+// marker; it answers the request itself and returns false if it can't.
+func (ru *resumableUpload) deleteChunks(writer http.ResponseWriter, request *http.Request, s *session, chunks []uploadChunk, keep map[string]bool) bool {
+	for _, c := range chunks {
+		if keep[c.name] {
+			continue
+		}
+		if w, ok := ru.subrequest(writer, request, "DELETE", s.path(s.segContainer, c.name)); !ok {
+			return false
+		} else if w.status/100 != 2 && w.status != http.StatusNotFound {
+			srv.StandardResponse(writer, w.status)
+			return false
+		}
+	}
+	if w, ok := ru.subrequest(writer, request, "DELETE", s.path(s.segContainer, s.marker())); !ok {
+		return false
+	} else if w.status/100 != 2 && w.status != http.StatusNotFound {
+		srv.StandardResponse(writer, w.status)
+		return false
+	}
+	return true
+}
+
+func (ru *resumableUpload) commit(writer http.ResponseWriter, request *http.Request, s *session) {
+	chunks, length, ok := ru.chunks(writer, request, s)
+	if !ok {
+		return
+	}
+	manifest, received, used := planUpload(common.Urlencode(s.segContainer), chunks)
+	if length >= 0 && received != length {
+		writer.Header().Set(uploadOffsetHeader, strconv.FormatInt(received, 10))
+		srv.SimpleErrorResponse(writer, http.StatusConflict, fmt.Sprintf("Upload incomplete: %d of %d bytes received", received, length))
+		return
+	}
+	if len(manifest) > maxManifestLen {
+		srv.SimpleErrorResponse(writer, http.StatusConflict, fmt.Sprintf("Upload has more than %d chunks", maxManifestLen))
+		return
+	}
+	ctx := GetProxyContext(request)
+	var newReq *http.Request
+	var err error
+	if len(manifest) == 0 {
+		newReq, err = ctx.newSubrequest("PUT", s.path(s.container, s.object), http.NoBody, request, "resumable")
+	} else {
+		var body []byte
+		if body, err = json.Marshal(manifest); err != nil {
+			srv.StandardResponse(writer, http.StatusInternalServerError)
+			return
+		}
+		newReq, err = ctx.newSubrequest("PUT", s.path(s.container, s.object)+"?multipart-manifest=put", bytes.NewBuffer(body), request, "resumable")
+	}
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	for key := range request.Header {
+		if key == "Content-Type" || key == "Content-Disposition" || key == "Content-Encoding" ||
+			key == "X-Delete-At" || key == "X-Delete-After" || strings.HasPrefix(key, "X-Object-Meta-") {
+			newReq.Header.Set(key, request.Header.Get(key))
+		}
+	}
+	newReq.Header.Set("Content-Length", "0")
+	w := NewCaptureWriter()
+	ctx.serveHTTPSubrequest(w, newReq)
+	if w.status/100 != 2 {
+		srv.SimpleErrorResponse(writer, w.status, string(w.body))
+		return
+	}
+	ru.commitsMetric.Inc(1)
+	if !ru.deleteChunks(writer, request, s, chunks, used) {
+		return
+	}
+	writer.Header().Set("Etag", w.Header().Get("Etag"))
+	srv.StandardResponse(writer, http.StatusCreated)
+}
+
+func (ru *resumableUpload) abort(writer http.ResponseWriter, request *http.Request, s *session) {
+	chunks, _, ok := ru.chunks(writer, request, s)
+	if !ok {
+		return
+	}
+	if ru.deleteChunks(writer, request, s, chunks, nil) {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (ru *resumableUpload) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if _, ok := query[uploadSessionParam]; !ok {
+		ru.next.ServeHTTP(writer, request)
+		return
+	}
+	apiReq, account, container, object := getPathParts(request)
+	if !apiReq || object == "" {
+		ru.next.ServeHTTP(writer, request)
+		return
+	}
+	ru.requestsMetric.Inc(1)
+	s := &session{
+		id:           query.Get(uploadSessionParam),
+		account:      account,
+		container:    container,
+		object:       object,
+		segContainer: container + "+segments",
+	}
+	if s.id == "" {
+		if request.Method != "POST" {
+			srv.StandardResponse(writer, http.StatusBadRequest)
+			return
+		}
+		s.id = fmt.Sprintf("%016x", rand.Int63())
+		ru.start(writer, request, s)
+		return
+	}
+	if strings.Contains(s.id, "/") {
+		srv.StandardResponse(writer, http.StatusBadRequest)
+		return
+	}
+	switch request.Method {
+	case "PUT":
+		ru.putChunk(writer, request, s)
+	case "HEAD":
+		ru.status(writer, request, s)
+	case "POST":
+		if _, ok := query["commit"]; !ok {
+			srv.StandardResponse(writer, http.StatusBadRequest)
+			return
+		}
+		ru.commit(writer, request, s)
+	case "DELETE":
+		ru.abort(writer, request, s)
+	default:
+		srv.StandardResponse(writer, http.StatusMethodNotAllowed)
+	}
+}
+
+func init() {
+	Register(Registration{Name: "resumable_upload", Position: 135, New: NewResumableUpload})
+}
+
+func NewResumableUpload(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	RegisterInfo("resumable_upload", map[string]interface{}{"max_chunks": maxManifestLen})
+	return func(next http.Handler) http.Handler {
+		return &resumableUpload{
+			next:           next,
+			requestsMetric: metricsScope.Counter("resumable_upload_requests"),
+			commitsMetric:  metricsScope.Counter("resumable_upload_commits"),
+		}
+	}, nil
+}
@@ -0,0 +1,154 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/containerserver"
+	"go.uber.org/zap"
+)
+
+func TestPlanUpload(t *testing.T) {
+	manifest, received, used := planUpload("c+segments", []uploadChunk{
+		{name: "s/o/0000000000000010", offset: 10, size: 10, etag: "b"},
+		{name: "s/o/0000000000000000", offset: 0, size: 15, etag: "a"},
+		{name: "s/o/0000000000000040", offset: 40, size: 10, etag: "d"},
+		{name: "s/o/0000000000000012", offset: 12, size: 2, etag: "c"},
+	})
+	require.Equal(t, int64(20), received)
+	require.Equal(t, []sloPutManifest{
+		{Path: "/c+segments/s/o/0000000000000000", Etag: "a", SizeBytes: 15},
+		{Path: "/c+segments/s/o/0000000000000010", Etag: "b", SizeBytes: 10, Range: "5-9"},
+	}, manifest)
+	require.Equal(t, map[string]bool{"s/o/0000000000000000": true, "s/o/0000000000000010": true}, used)
+
+	manifest, received, _ = planUpload("c+segments", nil)
+	require.Equal(t, int64(0), received)
+	require.Empty(t, manifest)
+}
+
+// fakeResumableBackend stands in for the rest of the pipeline, keeping
+// objects in memory.
+type fakeResumableBackend struct {
+	objects  map[string][]byte
+	meta     map[string]http.Header
+	manifest []sloPutManifest
+}
+
+func (f *fakeResumableBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _, container, object := getPathParts(r)
+	switch {
+	case object == "" && r.Method == "GET":
+		prefix := r.URL.Query().Get("prefix")
+		var listing []containerserver.ObjectListingRecord
+		for name, body := range f.objects {
+			parts := strings.SplitN(name, "/", 2)
+			if parts[0] == container && strings.HasPrefix(parts[1], prefix) {
+				listing = append(listing, containerserver.ObjectListingRecord{Name: parts[1], Size: int64(len(body)), ETag: fmt.Sprintf("%x", md5.Sum(body))})
+			}
+		}
+		sort.Slice(listing, func(i, j int) bool { return listing[i].Name < listing[j].Name })
+		b, _ := json.Marshal(listing)
+		w.WriteHeader(200)
+		w.Write(b)
+	case object == "":
+		w.WriteHeader(204)
+	case r.Method == "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("multipart-manifest") == "put" {
+			json.Unmarshal(body, &f.manifest)
+			body = nil
+		}
+		f.objects[container+"/"+object] = body
+		f.meta[container+"/"+object] = r.Header
+		w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum(body)))
+		w.WriteHeader(201)
+	case r.Method == "HEAD":
+		if _, ok := f.objects[container+"/"+object]; !ok {
+			w.WriteHeader(404)
+			return
+		}
+		for k, v := range f.meta[container+"/"+object] {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(200)
+	case r.Method == "DELETE":
+		delete(f.objects, container+"/"+object)
+		w.WriteHeader(204)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	backend := &fakeResumableBackend{objects: map[string][]byte{}, meta: map[string]http.Header{}}
+	mid, err := NewResumableUpload(conf.Section{}, common.NewTestScope())
+	require.Nil(t, err)
+	h := mid(backend)
+	do := func(method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		ctx := &ProxyContext{ProxyContextMiddleware: &ProxyContextMiddleware{next: h}, Logger: zap.NewNop()}
+		req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/v1/a/c/o?upload-session", nil, map[string]string{"X-Upload-Length": "10"})
+	require.Equal(t, 201, w.Code)
+	id := w.Header().Get("X-Upload-Session")
+	require.NotEmpty(t, id)
+	base := "/v1/a/c/o?upload-session=" + id
+
+	w = do("PUT", base, strings.NewReader("hello"), map[string]string{"X-Upload-Offset": "0"})
+	require.Equal(t, 201, w.Code)
+	w = do("PUT", base, strings.NewReader("toolong"), map[string]string{"X-Upload-Offset": "5"})
+	require.Equal(t, 400, w.Code)
+	w = do("HEAD", base, nil, nil)
+	require.Equal(t, 204, w.Code)
+	require.Equal(t, "5", w.Header().Get("X-Upload-Offset"))
+	require.Equal(t, "10", w.Header().Get("X-Upload-Length"))
+	w = do("POST", base+"&commit", nil, nil)
+	require.Equal(t, 409, w.Code)
+
+	w = do("PUT", base, strings.NewReader("world"), map[string]string{"X-Upload-Offset": "5"})
+	require.Equal(t, 201, w.Code)
+	w = do("POST", base+"&commit", nil, map[string]string{"Content-Type": "text/plain", "X-Object-Meta-Color": "blue"})
+	require.Equal(t, 201, w.Code)
+	require.Len(t, backend.manifest, 2)
+	require.Equal(t, "/c%2Bsegments/"+id+"/o/0000000000000005", backend.manifest[1].Path)
+	require.Equal(t, "blue", backend.meta["c/o"].Get("X-Object-Meta-Color"))
+	_, ok := backend.objects["c+segments/"+id+"/o"]
+	require.False(t, ok)
+
+	w = do("HEAD", base, nil, nil)
+	require.Equal(t, 404, w.Code)
+}
@@ -46,7 +46,6 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"regexp"
@@ -65,7 +64,7 @@ import (
 
 const (
 	s3Xmlns                      = "http://s3.amazonaws.com/doc/2006-03-01"
-	s3MultipartCompleteBodyLimit = 65536
+	s3MultipartCompleteBodyLimit = 16 * 1024 * 1024
 	s3MultipartMaxParts          = 1000
 )
 
@@ -478,7 +477,7 @@ func s3DateString(s string) string {
 func (s *s3ApiHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	ctx := GetProxyContext(request)
 	// Check if this is an S3 request
-	if ctx.S3Auth == nil || strings.HasPrefix(strings.ToLower(request.URL.Path), "/v1/") {
+	if ctx.S3Auth == nil || strings.HasPrefix(strings.ToLower(request.URL.Path), "/v1/") || isAPIPath(request.URL.Path) {
 		// Not an S3 request
 		s.next.ServeHTTP(writer, request)
 		return
@@ -750,13 +749,21 @@ func (s *s3ApiHandler) handleObjectRequest(writer http.ResponseWriter, request *
 			writer.Write(output)
 			return
 		} else if uploadId := request.Form.Get("uploadId"); uploadId != "" {
-			body, err := ioutil.ReadAll(io.LimitReader(request.Body, s3MultipartCompleteBodyLimit))
+			// The part list is spooled rather than read into memory, since
+			// clients can pad it out with as much whitespace as they like.
+			spool := common.NewSpool(spoolMemoryLimit, "")
+			defer spool.Close()
+			if _, err := common.Copy(io.LimitReader(request.Body, s3MultipartCompleteBodyLimit), spool); err != nil {
+				srv.StandardResponse(writer, http.StatusInternalServerError)
+				return
+			}
+			body, err := spool.Reader()
 			if err != nil {
 				srv.StandardResponse(writer, http.StatusInternalServerError)
 				return
 			}
 			completeMU := s3CompleteMultipartUpload{}
-			if err := xml.Unmarshal(body, &completeMU); err != nil {
+			if err := xml.NewDecoder(body).Decode(&completeMU); err != nil {
 				srv.StandardResponse(writer, http.StatusBadRequest)
 				return
 			}
@@ -794,7 +801,7 @@ func (s *s3ApiHandler) handleObjectRequest(writer http.ResponseWriter, request *
 				Location: "", // TODO
 				Bucket:   s.container,
 				Key:      s.object,
-				ETag:     "", // TODO
+				ETag:     fmt.Sprintf("\"%s\"", c.Header().Get(clientCompositeEtag)),
 			}, "", "  ")
 			if err != nil {
 				srv.StandardResponse(writer, http.StatusInternalServerError)
@@ -1104,8 +1111,12 @@ func (s *s3ApiHandler) handleAccountRequest(writer http.ResponseWriter, request
 	srv.StandardResponse(writer, http.StatusMethodNotAllowed)
 }
 
+func init() {
+	Register(Registration{Name: "s3api", Position: 130, New: NewS3Api})
+}
+
 func NewS3Api(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
-	enabled, ok := config.Section["enabled"]
+	enabled, ok := config.Get("enabled")
 	if !ok || strings.Compare(strings.ToLower(enabled), "false") == 0 {
 		// s3api is disabled, so pass the request on
 		return func(next http.Handler) http.Handler {
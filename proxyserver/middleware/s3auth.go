@@ -176,8 +176,12 @@ func (s *s3AuthHandler) ServeHTTP(writer http.ResponseWriter, request *http.Requ
 	s.next.ServeHTTP(writer, request)
 }
 
+func init() {
+	Register(Registration{Name: "s3auth", Section: "filter:s3api", Position: 60, New: NewS3Auth})
+}
+
 func NewS3Auth(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
-	enabled, ok := config.Section["enabled"]
+	enabled, ok := config.Get("enabled")
 	if !ok || strings.Compare(strings.ToLower(enabled), "false") == 0 {
 		// s3api is disabled, so pass the request on
 		return func(next http.Handler) http.Handler {
@@ -0,0 +1,260 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+// signedPolicy is the JSON document carried (base64url encoded) in the
+// signed_policy query parameter.  Path is the full /v1/account/container/object
+// path the URL may be used for; a trailing "*" makes it a prefix.  Every
+// other constraint is optional.
+type signedPolicy struct {
+	Path         string   `json:"path"`
+	Expires      int64    `json:"expires"`
+	Methods      []string `json:"methods,omitempty"`
+	IPRanges     []string `json:"ip_ranges,omitempty"`
+	MaxSize      int64    `json:"max_size,omitempty"`
+	ContentTypes []string `json:"content_types,omitempty"`
+}
+
+func (p *signedPolicy) allowsPath(path string) bool {
+	if strings.HasSuffix(p.Path, "*") {
+		return strings.HasPrefix(path, p.Path[:len(p.Path)-1])
+	}
+	return path == p.Path
+}
+
+func (p *signedPolicy) allowsMethod(method string) bool {
+	if len(p.Methods) == 0 {
+		return true
+	}
+	for _, m := range p.Methods {
+		m = strings.ToUpper(m)
+		if m == method || (method == "HEAD" && m == "GET") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *signedPolicy) allowsIP(ip net.IP) bool {
+	if len(p.IPRanges) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, r := range p.IPRanges {
+		if _, ipnet, err := net.ParseCIDR(r); err == nil && ipnet.Contains(ip) {
+			return true
+		} else if err != nil && net.ParseIP(r).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *signedPolicy) allowsContentType(contentType string) bool {
+	if len(p.ContentTypes) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, ct := range p.ContentTypes {
+		ct = strings.ToLower(ct)
+		if strings.HasSuffix(ct, "/*") {
+			if strings.HasPrefix(contentType, ct[:len(ct)-1]) {
+				return true
+			}
+		} else if contentType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPolicySig(key []byte, sig []byte, encodedPolicy string) bool {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encodedPolicy))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+func clientIP(request *http.Request, trustForwardedFor bool) net.IP {
+	if trustForwardedFor {
+		if fwd := request.Header.Get("X-Forwarded-For"); fwd != "" {
+			return net.ParseIP(strings.TrimSpace(strings.Split(fwd, ",")[0]))
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func signedurl(requestsMetric tally.Counter, maxKeys int, trustForwardedFor bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Method == "OPTIONS" {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			ctx := GetProxyContext(request)
+			if ctx.Authorize != nil {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			q := request.URL.Query()
+			encodedPolicy := q.Get("signed_policy")
+			sig := q.Get("signed_sig")
+			if encodedPolicy == "" && sig == "" {
+				next.ServeHTTP(writer, request)
+				return
+			} else if encodedPolicy == "" || sig == "" {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+
+			requestsMetric.Inc(1)
+
+			sigb, err := hex.DecodeString(sig)
+			if err != nil {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+			policyJSON, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encodedPolicy, "="))
+			if err != nil {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+			var policy signedPolicy
+			if err := json.Unmarshal(policyJSON, &policy); err != nil || policy.Path == "" {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+			if time.Now().Unix() > policy.Expires {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+
+			apiReq, account, container, obj := getPathParts(request)
+			if !apiReq || account == "" || container == "" || obj == "" {
+				// Signed URLs are for objects; they're never grounds for
+				// listing, changing or deleting an account or container.
+				srv.StandardResponse(writer, 401)
+				return
+			}
+			path := fmt.Sprintf("/v1/%s/%s/%s", account, container, obj)
+			if !policy.allowsPath(path) || !policy.allowsMethod(request.Method) ||
+				!policy.allowsIP(clientIP(request, trustForwardedFor)) {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+
+			if bh := request.Header.Get("X-Object-Manifest"); bh != "" && (request.Method == "PUT" || request.Method == "POST") {
+				srv.StandardResponse(writer, 400)
+				return
+			}
+			if request.Method == "PUT" {
+				if policy.MaxSize > 0 {
+					if request.ContentLength < 0 {
+						srv.StandardResponse(writer, http.StatusLengthRequired)
+						return
+					} else if request.ContentLength > policy.MaxSize {
+						srv.StandardResponse(writer, http.StatusRequestEntityTooLarge)
+						return
+					}
+				}
+				if !policy.allowsContentType(request.Header.Get("Content-Type")) {
+					srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Content-Type not allowed by policy.")
+					return
+				}
+			}
+
+			scope := tempURLScope(request.Context(), ctx, account, container, maxKeys, func(key []byte) bool {
+				return checkPolicySig(key, sigb, encodedPolicy)
+			})
+			if scope == SCOPE_INVALID {
+				srv.StandardResponse(writer, 401)
+				return
+			}
+			expires := time.Unix(policy.Expires, 0)
+			ctx.RemoteUsers = []string{".signedurl"}
+			ctx.TempURL = &TempURLInfo{Scope: scope, Account: account, Container: container, Expires: expires}
+			ctx.Authorize = func(r *http.Request) (bool, int) {
+				ar, a, c, o := getPathParts(r)
+				if !ar || o == "" || !policy.allowsPath(fmt.Sprintf("/v1/%s/%s/%s", a, c, o)) || !policy.allowsMethod(r.Method) {
+					return false, http.StatusUnauthorized
+				}
+				if (scope == SCOPE_ACCOUNT && a == account) || (scope == SCOPE_CONTAINER && c == container) {
+					return true, http.StatusOK
+				}
+				return false, http.StatusUnauthorized
+			}
+
+			next.ServeHTTP(
+				&tuWriter{
+					ResponseWriter: writer,
+					method:         request.Method,
+					obj:            obj,
+					filename:       q.Get("filename"),
+					expires:        expires.UTC().Format(time.RFC1123),
+					inline:         common.LooksTrue(q.Get("inline")),
+				},
+				request,
+			)
+		})
+	}
+}
+
+func init() {
+	Register(Registration{Name: "signedurl", Position: 110, New: NewSignedURL})
+}
+
+// NewSignedURL returns the signed URL middleware, a policy based alternative
+// to tempurl.  Clients send signed_policy, a base64url encoded JSON policy,
+// and signed_sig, the hex HMAC-SHA256 of that encoded policy using one of the
+// account or container Temp-URL keys.  Besides a path and an expiry the
+// policy may restrict methods, client IP ranges, upload size and upload
+// content types.
+func NewSignedURL(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	RegisterInfo("signedurl", map[string]interface{}{
+		"methods":     []string{"GET", "HEAD", "PUT", "POST", "DELETE"},
+		"constraints": []string{"methods", "ip_ranges", "max_size", "content_types"},
+	})
+	requestsMetric := metricsScope.Counter("signedurl_requests")
+	return signedurl(requestsMetric, tempURLMaxKeys(config), config.GetBool("trust_x_forwarded_for", false)), nil
+}
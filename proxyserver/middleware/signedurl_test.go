@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+func signedURLQuery(t *testing.T, key string, policy signedPolicy) string {
+	policyJSON, err := json.Marshal(policy)
+	require.Nil(t, err)
+	encoded := base64.RawURLEncoding.EncodeToString(policyJSON)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(encoded))
+	return "signed_policy=" + url.QueryEscape(encoded) + "&signed_sig=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func serveSignedURL(t *testing.T, r *http.Request) int {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {Metadata: map[string]string{"Temp-Url-Key": "mykey"}},
+		}, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{"account/a": {Metadata: map[string]string{}}},
+	}
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ok, _ := GetProxyContext(request).Authorize(request)
+		require.True(t, ok)
+		writer.WriteHeader(200)
+	})
+	signedurl(common.NewTestScope().Counter("test_signedurl"), 2, false)(handler).ServeHTTP(w, r)
+	return w.Result().StatusCode
+}
+
+func TestSignedURLPolicy(t *testing.T) {
+	policy := signedPolicy{
+		Path:         "/v1/a/c/uploads/*",
+		Expires:      time.Now().Unix() + 60,
+		Methods:      []string{"PUT"},
+		IPRanges:     []string{"10.0.0.0/8"},
+		MaxSize:      10,
+		ContentTypes: []string{"image/*"},
+	}
+	q := signedURLQuery(t, "mykey", policy)
+
+	newPut := func(path, body, contentType, remoteAddr string) *http.Request {
+		r := httptest.NewRequest("PUT", path+"?"+q, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+	require.Equal(t, 200, serveSignedURL(t, newPut("/v1/a/c/uploads/o", "data", "image/png", "10.1.2.3:5000")))
+	require.Equal(t, 401, serveSignedURL(t, newPut("/v1/a/c/other/o", "data", "image/png", "10.1.2.3:5000")))
+	require.Equal(t, 401, serveSignedURL(t, newPut("/v1/a/c/uploads/o", "data", "image/png", "192.168.1.1:5000")))
+	require.Equal(t, 413, serveSignedURL(t, newPut("/v1/a/c/uploads/o", "more than ten bytes", "image/png", "10.1.2.3:5000")))
+	require.Equal(t, 400, serveSignedURL(t, newPut("/v1/a/c/uploads/o", "data", "text/html", "10.1.2.3:5000")))
+
+	r := httptest.NewRequest("GET", "/v1/a/c/uploads/o?"+q, nil)
+	r.RemoteAddr = "10.1.2.3:5000"
+	require.Equal(t, 401, serveSignedURL(t, r))
+
+	r = httptest.NewRequest("PUT", "/v1/a/c/uploads/o?"+signedURLQuery(t, "wrongkey", policy), strings.NewReader("data"))
+	r.Header.Set("Content-Type", "image/png")
+	r.RemoteAddr = "10.1.2.3:5000"
+	require.Equal(t, 401, serveSignedURL(t, r))
+
+	policy.Expires = time.Now().Unix() - 60
+	r = newPut("/v1/a/c/uploads/o", "data", "image/png", "10.1.2.3:5000")
+	r.URL.RawQuery = signedURLQuery(t, "mykey", policy)
+	require.Equal(t, 401, serveSignedURL(t, r))
+}
+
+func TestSignedPolicyAllows(t *testing.T) {
+	p := &signedPolicy{Path: "/v1/a/c/o", Methods: []string{"get"}, IPRanges: []string{"127.0.0.1"}}
+	require.True(t, p.allowsPath("/v1/a/c/o"))
+	require.False(t, p.allowsPath("/v1/a/c/o2"))
+	require.True(t, p.allowsMethod("HEAD"))
+	require.False(t, p.allowsMethod("DELETE"))
+	require.True(t, p.allowsIP(net.ParseIP("127.0.0.1")))
+	require.False(t, p.allowsIP(nil))
+	require.True(t, p.allowsContentType("anything/at-all"))
+}
+
+func TestSignedURLObjectsOnly(t *testing.T) {
+	policy := signedPolicy{Path: "/v1/a/c/*", Expires: time.Now().Unix() + 60}
+	q := signedURLQuery(t, "mykey", policy)
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		r := httptest.NewRequest(method, "/v1/a/c/?"+q, nil)
+		require.Equal(t, 401, serveSignedURL(t, r), method)
+		r = httptest.NewRequest(method, "/v1/a/c?"+q, nil)
+		require.Equal(t, 401, serveSignedURL(t, r), method)
+	}
+
+	var ctx *ProxyContext
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	r := httptest.NewRequest("GET", "/v1/a/c/o?"+q, nil)
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {Metadata: map[string]string{"Temp-Url-Key": "mykey"}},
+		}, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{"account/a": {Metadata: map[string]string{}}},
+	}))
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx = GetProxyContext(request)
+		writer.WriteHeader(200)
+	})
+	w := httptest.NewRecorder()
+	signedurl(common.NewTestScope().Counter("test_signedurl"), 2, false)(handler).ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	require.NotNil(t, ctx.TempURL)
+	ok, _ := ctx.Authorize(httptest.NewRequest("POST", "/v1/a/c", nil))
+	require.False(t, ok)
+	ok, _ = ctx.Authorize(httptest.NewRequest("DELETE", "/v1/a/c2/o", nil))
+	require.False(t, ok)
+	ok, _ = ctx.Authorize(httptest.NewRequest("DELETE", "/v1/a/c/o2", nil))
+	require.True(t, ok)
+}
@@ -0,0 +1,203 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+// maxSloVerifyDepth limits how deeply nested manifests are followed, so a
+// manifest that ends up referring to itself can't loop forever.
+const maxSloVerifyDepth = 10
+
+// SloSegmentError is a segment of a manifest that is missing or has changed
+// since the manifest was written.
+type SloSegmentError struct {
+	// Manifest is the container/object of the manifest listing the segment,
+	// which may be a sub-manifest of the one being verified.
+	Manifest string `json:"manifest"`
+	Segment  string `json:"segment"`
+	Status   int    `json:"status,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// SloVerifyReport is the result of checking every segment of a manifest.
+type SloVerifyReport struct {
+	Segments int               `json:"segments"`
+	Bytes    int64             `json:"bytes"`
+	Errors   []SloSegmentError `json:"errors"`
+}
+
+func (r *SloVerifyReport) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// SloHeadFunc returns the status and headers of a HEAD of a segment.
+type SloHeadFunc func(container, object string) (int, http.Header)
+
+// SloManifestFunc returns the status and stored manifest of a sub-manifest.
+type SloManifestFunc func(container, object string) (int, io.Reader)
+
+// VerifySloManifest checks that every segment the manifest at manifestPath
+// (container/object) refers to still exists with the etag and size it had
+// when the manifest was written, following any nested manifests.
+func VerifySloManifest(manifestPath string, manifest io.Reader, head SloHeadFunc, getManifest SloManifestFunc) (*SloVerifyReport, error) {
+	var segments []segItem
+	if err := json.NewDecoder(manifest).Decode(&segments); err != nil {
+		return nil, err
+	}
+	report := &SloVerifyReport{Errors: []SloSegmentError{}}
+	verifySloSegments(report, manifestPath, segments, head, getManifest, 0)
+	return report, nil
+}
+
+func verifySloSegments(report *SloVerifyReport, manifestPath string, segments []segItem, head SloHeadFunc, getManifest SloManifestFunc, depth int) {
+	fail := func(segment string, status int, reason string) {
+		report.Errors = append(report.Errors, SloSegmentError{Manifest: manifestPath, Segment: segment, Status: status, Reason: reason})
+	}
+	for _, si := range segments {
+		report.Segments++
+		container, object, err := splitSegPath(si.Name)
+		if err != nil {
+			fail(si.Name, 0, err.Error())
+			continue
+		}
+		segment := container + "/" + object
+		status, header := head(container, object)
+		if status/100 != 2 {
+			fail(segment, status, http.StatusText(status))
+			continue
+		}
+		// A nested manifest's etag and size are those of its segments, which
+		// backends give in sysmeta and the slo middleware in place of the
+		// manifest's own.
+		isSlo := header.Get("X-Static-Large-Object") == "True"
+		etag := strings.Trim(header.Get("Etag"), "\"")
+		size := header.Get("Content-Length")
+		if isSlo && header.Get("X-Object-Sysmeta-Slo-Etag") != "" {
+			etag = header.Get("X-Object-Sysmeta-Slo-Etag")
+			size = header.Get("X-Object-Sysmeta-Slo-Size")
+		}
+		if etag != si.Hash {
+			fail(segment, status, fmt.Sprintf("Etag mismatch: manifest has %s, segment is %s", si.Hash, etag))
+			continue
+		}
+		if n, err := strconv.ParseInt(size, 10, 64); err != nil || n != si.Bytes {
+			fail(segment, status, fmt.Sprintf("Size mismatch: manifest has %d, segment is %s", si.Bytes, size))
+			continue
+		}
+		segLen, _ := si.segLenHash()
+		report.Bytes += segLen
+		if !isSlo {
+			continue
+		}
+		if depth >= maxSloVerifyDepth {
+			fail(segment, 0, "Manifests are nested too deeply")
+			continue
+		}
+		status, body := getManifest(container, object)
+		if status/100 != 2 {
+			fail(segment, status, "Error fetching sub-manifest")
+			continue
+		}
+		var subSegments []segItem
+		if err := json.NewDecoder(body).Decode(&subSegments); err != nil {
+			fail(segment, status, fmt.Sprintf("Invalid sub-manifest: %s", err))
+			continue
+		}
+		verifySloSegments(report, segment, subSegments, head, getManifest, depth+1)
+	}
+}
+
+// handleSloVerify serves GET ?multipart-manifest=verify, reporting any
+// segments of the manifest that are missing or have changed.
+func (xlo *xloMiddleware) handleSloVerify(writer http.ResponseWriter, request *http.Request) {
+	xlo.sloVerifyRequestsMetric.Inc(1)
+	pathMap, err := common.ParseProxyPath(request.URL.Path)
+	if err != nil || pathMap["object"] == "" {
+		srv.SimpleErrorResponse(writer, 400, fmt.Sprintf(
+			"invalid must multipath verify an object path: %s", request.URL.Path))
+		return
+	}
+	ctx := GetProxyContext(request)
+	subrequest := func(method, container, object, query string) *spoolWriter {
+		sw := newSpoolWriter()
+		newReq, err := ctx.newSubrequest(method, common.Urlencode(fmt.Sprintf("/v1/%s/%s/%s", pathMap["account"], container, object))+query, http.NoBody, request, "slo")
+		if err != nil {
+			sw.status = http.StatusInternalServerError
+			return sw
+		}
+		ctx.serveHTTPSubrequest(sw, newReq)
+		return sw
+	}
+	// Manifests are spooled, since one with thousands of segments could be
+	// more than is worth holding in memory.  Each is decoded before the next
+	// is fetched, so only one spool is open at a time.
+	sw := subrequest("GET", pathMap["container"], pathMap["object"], "?multipart-manifest=get")
+	defer func() { sw.Close() }()
+	if sw.status/100 != 2 {
+		srv.StandardResponse(writer, sw.status)
+		return
+	}
+	if sw.Header().Get("X-Static-Large-Object") != "True" {
+		srv.SimpleErrorResponse(writer, 400, "Not an SLO manifest")
+		return
+	}
+	manifest, err := sw.body.Reader()
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	report, err := VerifySloManifest(pathMap["container"]+"/"+pathMap["object"], manifest,
+		func(container, object string) (int, http.Header) {
+			hw := subrequest("HEAD", container, object, "")
+			hw.Close()
+			return hw.status, hw.Header()
+		},
+		func(container, object string) (int, io.Reader) {
+			sw.Close()
+			sw = subrequest("GET", container, object, "?multipart-manifest=get")
+			if sw.status/100 != 2 {
+				return sw.status, nil
+			}
+			body, err := sw.body.Reader()
+			if err != nil {
+				return http.StatusInternalServerError, nil
+			}
+			return sw.status, body
+		})
+	if err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("invalid manifest json: %s", err))
+		return
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		srv.StandardResponse(writer, http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(body)
+}
@@ -0,0 +1,105 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySlo(t *testing.T) {
+	next := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method + " " + request.URL.Path {
+		case "GET /v1/a/c/o":
+			require.Equal(t, "get", request.URL.Query().Get("multipart-manifest"))
+			writer.Header().Set("X-Static-Large-Object", "True")
+			writer.WriteHeader(200)
+			writer.Write([]byte(simpleManifest))
+		case "HEAD /v1/a/hat/a":
+			writer.Header().Set("Content-Length", "3")
+			writer.Header().Set("Etag", "\"202cb962ac59075b964b07152d234b70\"")
+			writer.WriteHeader(200)
+		case "HEAD /v1/a/hat/b":
+			writer.Header().Set("Content-Length", "3")
+			writer.Header().Set("Etag", "\"d41d8cd98f00b204e9800998ecf8427e\"")
+			writer.WriteHeader(200)
+		default:
+			writer.WriteHeader(404)
+		}
+	})
+	sm := newTestXLOMiddleware(next)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/v1/a/c/o?multipart-manifest=verify", nil)
+	require.Nil(t, err)
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, NewFakeProxyContext(next)))
+	sm.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	var report SloVerifyReport
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.False(t, report.Valid())
+	require.Equal(t, 3, report.Segments)
+	require.Equal(t, int64(3), report.Bytes)
+	require.Equal(t, 2, len(report.Errors))
+	require.Equal(t, "hat/b", report.Errors[0].Segment)
+	require.Contains(t, report.Errors[0].Reason, "Etag mismatch")
+	require.Equal(t, "c/o", report.Errors[1].Manifest)
+	require.Equal(t, "hat/c", report.Errors[1].Segment)
+	require.Equal(t, 404, report.Errors[1].Status)
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/v1/a/c/other?multipart-manifest=verify", nil)
+	require.Nil(t, err)
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, NewFakeProxyContext(next)))
+	sm.ServeHTTP(w, req)
+	require.Equal(t, 404, w.Code)
+}
+
+func TestVerifySloManifestNested(t *testing.T) {
+	heads := map[string]http.Header{
+		"hat/man": {"X-Static-Large-Object": {"True"}, "Etag": {"\"manifestetag\""}, "Content-Length": {"500"},
+			"X-Object-Sysmeta-Slo-Etag": {"202cb962ac59075b964b07152d234b70"}, "X-Object-Sysmeta-Slo-Size": {"9"}},
+		"hat/a": {"Etag": {"202cb962ac59075b964b07152d234b70"}, "Content-Length": {"3"}},
+		"hat/b": {"Etag": {"250cf8b51c773f3f8dc8b4be867a9a02"}, "Content-Length": {"3"}},
+		"hat/c": {"Etag": {"68053af2923e00204c3ca7c6a3150cf7"}, "Content-Length": {"4"}},
+	}
+	head := func(container, object string) (int, http.Header) {
+		if h, ok := heads[container+"/"+object]; ok {
+			return 200, h
+		}
+		return 404, http.Header{}
+	}
+	getManifest := func(container, object string) (int, io.Reader) {
+		require.Equal(t, "hat/man", container+"/"+object)
+		return 200, strings.NewReader(simpleManifest)
+	}
+	report, err := VerifySloManifest("c/o", strings.NewReader(superManifest), head, getManifest)
+	require.Nil(t, err)
+	require.Equal(t, 6, report.Segments)
+	require.Equal(t, []SloSegmentError{
+		{Manifest: "hat/man", Segment: "hat/c", Status: 200, Reason: "Size mismatch: manifest has 3, segment is 4"},
+		{Manifest: "c/o", Segment: "hat/c", Status: 200, Reason: "Size mismatch: manifest has 3, segment is 4"},
+	}, report.Errors)
+
+	_, err = VerifySloManifest("c/o", strings.NewReader("not json"), head, getManifest)
+	require.NotNil(t, err)
+}
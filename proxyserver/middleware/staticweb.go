@@ -33,6 +33,10 @@ import (
 	"github.com/uber-go/tally"
 )
 
+func init() {
+	Register(Registration{Name: "staticweb", Position: 220, New: NewStaticWeb})
+}
+
 func NewStaticWeb(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("staticweb", map[string]interface{}{})
 	return staticWeb(metricsScope), nil
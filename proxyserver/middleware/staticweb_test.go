@@ -109,7 +109,7 @@ func TestStaticWebGetObject(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C:                      f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{"Web-Index": "index.html"}}}, zap.NewNop()),
@@ -152,7 +152,7 @@ func TestStaticWebGetObjectNotThere(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -194,7 +194,7 @@ func TestStaticWebGetSubdirRedirect(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -240,7 +240,7 @@ func TestStaticWebGetSubdir(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -294,7 +294,7 @@ func TestStaticWebGetContainerRedirect(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -330,7 +330,7 @@ func TestStaticWebGetContainer(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -378,7 +378,7 @@ func TestStaticWebGetWithWebIndex(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -427,7 +427,7 @@ func TestStaticWebGetSubdirWithWebIndex(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -480,7 +480,7 @@ func TestStaticWebGetSubdirWithWebIndexRedirect(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -521,7 +521,7 @@ func TestStaticWebGetContainerNoListings(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -567,7 +567,7 @@ func TestStaticWebGetContainerCustomCSS(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -609,7 +609,7 @@ func TestStaticWebGetContainerCustomCSS(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -655,7 +655,7 @@ func TestStaticWebCustomErrorPages(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -700,7 +700,7 @@ func TestStaticWebCustomErrorPages(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c": {Metadata: map[string]string{
@@ -748,7 +748,7 @@ func TestStaticWebNoContainerInfo(t *testing.T) {
 	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
 		nil, "", "", "", "", "", conf.Config{})
 	require.Nil(t, err)
-	request = request.WithContext(context.WithValue(request.Context(), "proxycontext", &ProxyContext{
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &ProxyContext{
 		ProxyContextMiddleware: &ProxyContextMiddleware{next: s},
 		Logger:                 zap.NewNop(),
 		C:                      f.NewRequestClient(nil, map[string]*client.ContainerInfo{"container/a/c2": client.NilContainerInfo}, zap.NewNop()),
@@ -0,0 +1,136 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+)
+
+const (
+	tagHeaderPrefix  = "X-Object-Tag-"
+	tagSysmetaPrefix = "X-Object-Sysmeta-Tag-"
+)
+
+type tagging struct {
+	next           http.Handler
+	maxTags        int
+	maxKeyLength   int
+	maxValueLength int
+	taggedPuts     tally.Counter
+}
+
+// translateTags moves the client's X-Object-Tag-* headers into sysmeta so
+// they're stored with the object and passed along in its container update.
+func (t *tagging) translateTags(request *http.Request) string {
+	count := 0
+	for key, values := range request.Header {
+		if !strings.HasPrefix(key, tagHeaderPrefix) {
+			continue
+		}
+		tagKey := key[len(tagHeaderPrefix):]
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+		if len(tagKey) > t.maxKeyLength {
+			return fmt.Sprintf("Tag key %q is longer than %d", tagKey, t.maxKeyLength)
+		}
+		if len(value) > t.maxValueLength {
+			return fmt.Sprintf("Tag value for %q is longer than %d", tagKey, t.maxValueLength)
+		}
+		if strings.ContainsAny(tagKey, ",:") || strings.Contains(value, ",") {
+			return fmt.Sprintf("Tag %q may not contain commas, and its key may not contain colons", tagKey)
+		}
+		if count++; count > t.maxTags {
+			return fmt.Sprintf("Too many tags; maximum is %d", t.maxTags)
+		}
+		request.Header.Del(key)
+		request.Header.Set(tagSysmetaPrefix+tagKey, value)
+	}
+	if count > 0 {
+		t.taggedPuts.Inc(1)
+	}
+	return ""
+}
+
+func (t *tagging) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if apiReq, _, _, object := getPathParts(request); !apiReq || object == "" {
+		t.next.ServeHTTP(writer, request)
+		return
+	}
+	switch request.Method {
+	case "PUT":
+		if msg := t.translateTags(request); msg != "" {
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, msg)
+			return
+		}
+	case "POST":
+		// Tags are part of the container listing, which a POST doesn't update.
+		for key := range request.Header {
+			if strings.HasPrefix(key, tagHeaderPrefix) {
+				srv.SimpleErrorResponse(writer, http.StatusBadRequest, "Object tags can only be set on PUT")
+				return
+			}
+		}
+	case "GET", "HEAD":
+		writer = srv.NewCustomWriter(writer, func(w http.ResponseWriter, status int) int {
+			for key, values := range w.Header() {
+				if strings.HasPrefix(key, tagSysmetaPrefix) {
+					w.Header()[tagHeaderPrefix+key[len(tagSysmetaPrefix):]] = values
+					delete(w.Header(), key)
+				}
+			}
+			return status
+		})
+	}
+	t.next.ServeHTTP(writer, request)
+}
+
+func init() {
+	Register(Registration{Name: "tagging", Position: 240, New: NewTagging})
+}
+
+// NewTagging returns the tagging middleware, which lets clients attach
+// X-Object-Tag-<key>: <value> headers to objects on PUT.  Tags are stored as
+// object sysmeta, returned on GET and HEAD, and recorded in the container so
+// listings can be filtered with tag=<key>:<value> or tag=<key> parameters.
+func NewTagging(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	if !config.GetBool("enabled", false) {
+		return func(next http.Handler) http.Handler {
+			return next
+		}, nil
+	}
+	maxTags := int(config.GetInt("max_tags", 10))
+	maxKeyLength := int(config.GetInt("max_key_length", 128))
+	maxValueLength := int(config.GetInt("max_value_length", 256))
+	RegisterInfo("tagging", map[string]interface{}{"max_tags": maxTags, "max_key_length": maxKeyLength, "max_value_length": maxValueLength})
+	taggedPuts := metricsScope.Counter("tagged_puts")
+	return func(next http.Handler) http.Handler {
+		return &tagging{
+			next:           next,
+			maxTags:        maxTags,
+			maxKeyLength:   maxKeyLength,
+			maxValueLength: maxValueLength,
+			taggedPuts:     taggedPuts,
+		}
+	}, nil
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+)
+
+func newTestTagging(t *testing.T, next http.Handler) http.Handler {
+	config, err := conf.StringConfig("[filter:tagging]\nenabled = true\nmax_tags = 2")
+	require.Nil(t, err)
+	mid, err := NewTagging(config.GetSection("filter:tagging"), common.NewTestScope())
+	require.Nil(t, err)
+	return mid(next)
+}
+
+func TestTaggingPut(t *testing.T) {
+	var gotHeader http.Header
+	h := newTestTagging(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		w.WriteHeader(201)
+	}))
+	req, err := http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Tag-Color", "red")
+	req.Header.Set("X-Object-Tag-Size", "large")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 201, w.Code)
+	require.Equal(t, "red", gotHeader.Get("X-Object-Sysmeta-Tag-Color"))
+	require.Equal(t, "large", gotHeader.Get("X-Object-Sysmeta-Tag-Size"))
+	require.Equal(t, "", gotHeader.Get("X-Object-Tag-Color"))
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Tag-A", "1")
+	req.Header.Set("X-Object-Tag-B", "2")
+	req.Header.Set("X-Object-Tag-C", "3")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("PUT", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Tag-Color", strings.Repeat("x", 257))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+
+	req, err = http.NewRequest("POST", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	req.Header.Set("X-Object-Tag-Color", "red")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+}
+
+func TestTaggingGet(t *testing.T) {
+	h := newTestTagging(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Object-Sysmeta-Tag-Color", "red")
+		w.WriteHeader(200)
+	}))
+	req, err := http.NewRequest("HEAD", "/v1/a/c/o", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "red", w.Header().Get("X-Object-Tag-Color"))
+	require.Equal(t, "", w.Header().Get("X-Object-Sysmeta-Tag-Color"))
+}
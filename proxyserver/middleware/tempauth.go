@@ -44,6 +44,7 @@ type tempAuth struct {
 	resellers    []string
 	reseller     string
 	accountRules map[string]map[string][]string
+	decisions    *authDecisionCache
 	next         http.Handler
 }
 
@@ -191,6 +192,7 @@ func (ta *tempAuth) ServeHTTP(writer http.ResponseWriter, request *http.Request)
 		ta.next.ServeHTTP(writer, request)
 		return
 	}
+	ta.decisions.watch(request)
 	if ctx.S3Auth != nil && ctx.Authorize == nil {
 		// handle S3 auth validation
 		key := ctx.S3Auth.Key
@@ -220,7 +222,7 @@ func (ta *tempAuth) ServeHTTP(writer http.ResponseWriter, request *http.Request)
 	if request.URL.Path == "/auth/v1.0" {
 		ta.handleGetToken(writer, request)
 		return
-	} else if ctx.S3Auth != nil || strings.HasPrefix(request.URL.Path, "/v1") || strings.HasPrefix(request.URL.Path, "/V1") {
+	} else if ctx.S3Auth != nil || strings.HasPrefix(request.URL.Path, "/v1") || strings.HasPrefix(request.URL.Path, "/V1") || isAPIPath(request.URL.Path) {
 		token := request.Header.Get("X-Auth-Token")
 		if token == "" {
 			token = request.Header.Get("X-Storage-Token")
@@ -258,7 +260,7 @@ func (ta *tempAuth) ServeHTTP(writer http.ResponseWriter, request *http.Request)
 							}
 						}
 						ctx.RemoteUsers = ca.Groups
-						ctx.Authorize = ta.authorize
+						ctx.Authorize = ta.decisions.wrap(token+"\x00"+request.Header.Get("X-Service-Token"), ta.authorize)
 					}
 				} else if ok {
 					ctx.Authorize = ta.authorize
@@ -331,12 +333,17 @@ func (ta *tempAuth) authorize(r *http.Request) (bool, int) {
 	return false, s
 }
 
+func init() {
+	Register(Registration{Name: "tempauth", Position: 120, New: NewTempAuth})
+}
+
 func NewTempAuth(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	users := []testUser{}
 	defaultRules := map[string][]string{"require_group": {}}
 	resellerPrefixes, accountRules := conf.ReadResellerOptions(config, defaultRules)
 	reseller := resellerPrefixes[0]
-	for key, val := range config.Section {
+	for _, key := range config.Keys() {
+		val := config.Section[key]
 		keyparts := strings.Split(key, "_")
 		valparts := strings.Fields(val)
 		if len(keyparts) != 3 || keyparts[0] != "user" {
@@ -367,6 +374,7 @@ func NewTempAuth(config conf.Section, metricsScope tally.Scope) (func(http.Handl
 		users = append(users, testUser{account, user, valparts[0], groups, url, accountID})
 	}
 	RegisterInfo("tempauth", map[string]interface{}{"account_acls": false})
+	decisions := newAuthDecisionCache("tempauth", config, metricsScope)
 	return func(next http.Handler) http.Handler {
 		return &tempAuth{
 			next:         next,
@@ -374,6 +382,7 @@ func NewTempAuth(config conf.Section, metricsScope tally.Scope) (func(http.Handl
 			resellers:    resellerPrefixes,
 			reseller:     reseller,
 			accountRules: accountRules,
+			decisions:    decisions,
 		}
 	}, nil
 }
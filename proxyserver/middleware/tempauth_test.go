@@ -92,7 +92,7 @@ func TestHandleGetToken(t *testing.T) {
 	fakeContext.Cache = fakeMr
 
 	authReq, err := http.NewRequest("GET", "/auth/v1.0", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	tu := testUser{
@@ -135,7 +135,7 @@ func TestHandleGetTokenFail(t *testing.T) {
 	fakeContext.Cache = fakeMr
 
 	authReq, err := http.NewRequest("GET", "/auth/v1.0", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	tu := testUser{
@@ -192,7 +192,7 @@ func TestAuthorize(t *testing.T) {
 
 	fakeContext := NewFakeProxyContext(passthrough)
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	fakeContext.RemoteUsers = []string{"AUTH_test"}
 	ok, st = ta.authorize(authReq)
 	require.True(t, ok)
@@ -204,20 +204,20 @@ func TestAuthorize(t *testing.T) {
 
 	fakeContext.RemoteUsers = []string{"AUTH_test"}
 	authReq, _ = http.NewRequest("DELETE", "/v1/AUTH_test", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 403, st)
 
 	fakeContext.RemoteUsers = []string{".reseller_admin"}
 	authReq, _ = http.NewRequest("GET", "/v1/SERVICE_test", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 200, st)
 
 	fakeContext = NewFakeProxyContext(passthrough)
 	fakeContext.RemoteUsers = []string{"AUTH_test"}
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test/c/o", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.True(t, ok)
 	require.Equal(t, 200, st)
@@ -227,7 +227,7 @@ func TestAuthorize(t *testing.T) {
 
 	fakeContext.RemoteUsers = []string{"AUTH_test", "ops"}
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test/c/o", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 200, st)
 
@@ -254,26 +254,26 @@ func TestAuthorizeAcl(t *testing.T) {
 	fakeContext := NewFakeProxyContext(passthrough)
 	fakeContext.RemoteUsers = []string{"test", "test:tester3"}
 	authReq, _ := http.NewRequest("GET", "/v1/AUTH_test/c/o", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st := ta.authorize(authReq)
 	require.False(t, ok)
 	require.Equal(t, 403, st)
 
 	fakeContext.ACL = "test:tester3"
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test/c/o", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 200, st)
 
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test/c/o", nil)
 	fakeContext.ACL = ".r:*"
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 200, st)
 
 	authReq, _ = http.NewRequest("GET", "/v1/AUTH_test/c/", nil)
 	fakeContext.ACL = ".r:*"
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	ok, st = ta.authorize(authReq)
 	require.Equal(t, 403, st)
 }
@@ -294,7 +294,7 @@ func TestServeHTTP(t *testing.T) {
 	fakeContext.Cache = fakeMr
 
 	authReq, err := http.NewRequest("GET", "/v1/MOO_test", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	authReq.Header.Set("X-Auth-Token", "abcde")
@@ -317,7 +317,7 @@ func TestServeHTTP(t *testing.T) {
 	require.Equal(t, 0, len(fakeContext.RemoteUsers))
 
 	authReq, err = http.NewRequest("GET", "/v1/AUTH_test", nil)
-	authReq = authReq.WithContext(context.WithValue(authReq.Context(), "proxycontext", fakeContext))
+	authReq = authReq.WithContext(context.WithValue(authReq.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	authReq.Header.Set("X-Auth-Token", "abcde")
@@ -16,6 +16,7 @@
 package middleware
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/hex"
@@ -24,11 +25,14 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/troubling/hummingbird/common"
 	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
 	"github.com/troubling/hummingbird/common/srv"
 	"github.com/uber-go/tally"
+	"go.uber.org/zap"
 )
 
 const (
@@ -46,9 +50,25 @@ type tuWriter struct {
 	inline   bool
 }
 
+// dispositionFormat returns a Content-Disposition for filename.  Control
+// characters are dropped so the name can't break out of the header; the
+// filename parameter gets a plain ASCII version of the name for old browsers,
+// and filename* the full name, RFC 5987 encoded.
 func dispositionFormat(dtype string, filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
 	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s",
-		dtype, common.Urlencode(filename), common.Urlencode(filename))
+		dtype, fallback, common.Urlencode(filename))
 }
 
 func (w *tuWriter) WriteHeader(status int) {
@@ -91,7 +111,101 @@ func checkhmac(key, sig []byte, method, path string, expires time.Time) bool {
 	}
 }
 
-func tempurl(requestsMetric tally.Counter) func(http.Handler) http.Handler {
+// tempURLKeyNames returns the metadata names of the Temp-URL keys, newest
+// first: Temp-Url-Key, Temp-Url-Key-2 and so on up to maxKeys of them.
+func tempURLKeyNames(maxKeys int) []string {
+	names := []string{"Temp-Url-Key"}
+	for i := 2; i <= maxKeys; i++ {
+		names = append(names, fmt.Sprintf("Temp-Url-Key-%d", i))
+	}
+	return names
+}
+
+// tempURLScope checks the account's Temp-URL keys and then the container's,
+// returning the scope of the first key check accepts.
+func tempURLScope(ctx context.Context, proxyCtx *ProxyContext, account, container string, maxKeys int, check func(key []byte) bool) int {
+	ai, err := proxyCtx.GetAccountInfo(ctx, account)
+	if err != nil {
+		return SCOPE_INVALID
+	}
+	names := tempURLKeyNames(maxKeys)
+	for _, name := range names {
+		if key, ok := ai.Metadata[name]; ok && check([]byte(key)) {
+			return SCOPE_ACCOUNT
+		}
+	}
+	if ci, err := proxyCtx.C.GetContainerInfo(ctx, account, container); err == nil {
+		for _, name := range names {
+			if key, ok := ci.Metadata[name]; ok && check([]byte(key)) {
+				return SCOPE_CONTAINER
+			}
+		}
+	}
+	return SCOPE_INVALID
+}
+
+// maxRelativeExpiration is the longest memcache timeout taken as a number of
+// seconds rather than as a unix time.
+const maxRelativeExpiration = 30 * 24 * 60 * 60
+
+// useTempURL records a use of a single-use temp URL, identified by its
+// signature, and reports whether it was the first.  The record only needs to
+// outlive the URL itself.
+func useTempURL(ctx context.Context, mc ring.MemcacheRing, account, sig string, expires time.Time) (bool, error) {
+	timeout := int(time.Until(expires)/time.Second) + 1
+	if timeout > maxRelativeExpiration {
+		timeout = int(expires.Unix()) + 1
+	}
+	uses, err := mc.Incr(ctx, fmt.Sprintf("tempurl_use/%s/%s", account, sig), 1, timeout)
+	if err != nil {
+		return false, err
+	}
+	return uses == 1, nil
+}
+
+// rotateTempURLKey turns an X-Account-Rotate-Temp-Url-Key or
+// X-Container-Rotate-Temp-Url-Key header on a POST into metadata updates
+// that make the given key the new Temp-Url-Key and shift every older key
+// down a slot, dropping the oldest.  URLs signed with a retired key keep
+// working until it falls off the end of the list.
+func rotateTempURLKey(request *http.Request, maxKeys int) error {
+	apiReq, account, container, obj := getPathParts(request)
+	if request.Method != "POST" || !apiReq || account == "" || obj != "" {
+		return nil
+	}
+	ctx := GetProxyContext(request)
+	rotateHeader, metaPrefix := "X-Account-Rotate-Temp-Url-Key", "X-Account-Meta-"
+	if container != "" {
+		rotateHeader, metaPrefix = "X-Container-Rotate-Temp-Url-Key", "X-Container-Meta-"
+	}
+	newKey := request.Header.Get(rotateHeader)
+	if newKey == "" {
+		return nil
+	}
+	var metadata map[string]string
+	if container == "" {
+		ai, err := ctx.GetAccountInfo(request.Context(), account)
+		if err != nil {
+			return err
+		}
+		metadata = ai.Metadata
+	} else {
+		ci, err := ctx.C.GetContainerInfo(request.Context(), account, container)
+		if err != nil {
+			return err
+		}
+		metadata = ci.Metadata
+	}
+	names := tempURLKeyNames(maxKeys)
+	for i := len(names) - 1; i > 0; i-- {
+		request.Header.Set(metaPrefix+names[i], metadata[names[i-1]])
+	}
+	request.Header.Set(metaPrefix+names[0], newKey)
+	request.Header.Del(rotateHeader)
+	return nil
+}
+
+func tempurl(requestsMetric tally.Counter, maxKeys int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			if request.Method == "OPTIONS" {
@@ -106,6 +220,7 @@ func tempurl(requestsMetric tally.Counter) func(http.Handler) http.Handler {
 			q := request.URL.Query()
 			sig := q.Get("temp_url_sig")
 			exps := q.Get("temp_url_expires")
+			nonce := q.Get("temp_url_nonce")
 			_, inline := q["inline"]
 
 			if sig == "" && exps == "" {
@@ -152,26 +267,35 @@ func tempurl(requestsMetric tally.Counter) func(http.Handler) http.Handler {
 			} else {
 				path = fmt.Sprintf("/v1/%s/%s/%s", account, container, obj)
 			}
-
-			scope := SCOPE_INVALID
-			if ai, err := ctx.GetAccountInfo(request.Context(), account); err == nil {
-				if key, ok := ai.Metadata["Temp-Url-Key"]; ok && checkhmac([]byte(key), sigb, request.Method, path, expires) {
-					scope = SCOPE_ACCOUNT
-				} else if key, ok := ai.Metadata["Temp-Url-Key-2"]; ok && checkhmac([]byte(key), sigb, request.Method, path, expires) {
-					scope = SCOPE_ACCOUNT
-				} else if ci, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == nil {
-					if key, ok := ci.Metadata["Temp-Url-Key"]; ok && checkhmac([]byte(key), sigb, request.Method, path, expires) {
-						scope = SCOPE_CONTAINER
-					} else if key, ok := ci.Metadata["Temp-Url-Key-2"]; ok && checkhmac([]byte(key), sigb, request.Method, path, expires) {
-						scope = SCOPE_CONTAINER
-					}
-				}
+			// A single-use URL signs its nonce along with its path, so each
+			// one gets a signature of its own.
+			if nonce != "" {
+				path += "?temp_url_nonce=" + nonce
 			}
+
+			scope := tempURLScope(request.Context(), ctx, account, container, maxKeys, func(key []byte) bool {
+				return checkhmac(key, sigb, request.Method, path, expires)
+			})
 			if scope == SCOPE_INVALID {
 				srv.StandardResponse(writer, 401)
 				return
 			}
+			if nonce == "" {
+				// Accounts can insist their temp URLs are single-use.
+				if ai, err := ctx.GetAccountInfo(request.Context(), account); err != nil || common.LooksTrue(ai.SysMetadata["Tempurl-Single-Use"]) {
+					srv.StandardResponse(writer, 401)
+					return
+				}
+			} else if first, err := useTempURL(request.Context(), ctx.Cache, account, sig, expires); err != nil {
+				ctx.Logger.Error("Error recording single-use temp URL", zap.String("account", account), zap.Error(err))
+				srv.StandardResponse(writer, http.StatusServiceUnavailable)
+				return
+			} else if !first {
+				srv.StandardResponse(writer, 401)
+				return
+			}
 			ctx.RemoteUsers = []string{".tempurl"}
+			ctx.TempURL = &TempURLInfo{Scope: scope, Account: account, Container: container, Expires: expires, SingleUse: nonce != ""}
 			ctx.Authorize = func(r *http.Request) (bool, int) {
 				ar, a, c, _ := getPathParts(r)
 				if ar && ((scope == SCOPE_ACCOUNT && a == account) || (scope == SCOPE_CONTAINER && c == container)) {
@@ -195,13 +319,32 @@ func tempurl(requestsMetric tally.Counter) func(http.Handler) http.Handler {
 	}
 }
 
+// tempURLMaxKeys returns how many Temp-URL keys to check.  It's the tempurl
+// filter's max_keys whichever middleware asks, so formpost and signedurl
+// accept the same keys the tempurl middleware lets accounts set; there are
+// always at least the two keys Swift supports.
+func tempURLMaxKeys(config conf.Section) int {
+	if maxKeys := int(config.GetConfig().GetInt("filter:tempurl", "max_keys", 2)); maxKeys > 2 {
+		return maxKeys
+	}
+	return 2
+}
+
+func init() {
+	Register(Registration{Name: "tempurl", Position: 100, New: NewTempURL})
+}
+
 func NewTempURL(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	maxKeys := tempURLMaxKeys(config)
 	RegisterInfo("tempurl", map[string]interface{}{
+		"max_keys":                maxKeys,
+		"min_key_entropy":         config.GetInt("min_key_entropy", 64),
+		"single_use":              true,
 		"methods":                 []string{"GET", "HEAD", "PUT", "POST", "DELETE"},
 		"incoming_remove_headers": []string{"x-timestamp"},
 		"incoming_allow_headers":  []string{},
 		"outgoing_remove_headers": []string{"x-object-meta-*"}, "outgoing_allow_headers": []string{"x-object-meta-public-*"},
 	})
 	requestsMetric := metricsScope.Counter("tempurl_requests")
-	return tempurl(requestsMetric), nil
+	return tempurl(requestsMetric, maxKeys), nil
 }
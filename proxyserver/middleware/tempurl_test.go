@@ -17,7 +17,10 @@ package middleware
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -34,7 +37,11 @@ import (
 
 func TestDispositionFormat(t *testing.T) {
 	require.Equal(t, "inline; filename=\"a.txt\"; filename*=UTF-8''a.txt", dispositionFormat("inline", "a.txt"))
-	require.Equal(t, "attachment; filename=\"%25.txt\"; filename*=UTF-8''%25.txt", dispositionFormat("attachment", "%.txt"))
+	require.Equal(t, "attachment; filename=\"%.txt\"; filename*=UTF-8''%25.txt", dispositionFormat("attachment", "%.txt"))
+	require.Equal(t, "attachment; filename=\"caf_.txt\"; filename*=UTF-8''caf%C3%A9.txt", dispositionFormat("attachment", "café.txt"))
+	require.Equal(t, "attachment; filename=\"a_b_.txt\"; filename*=UTF-8''a%22b%5C.txt", dispositionFormat("attachment", "a\"b\\.txt"))
+	require.Equal(t, "inline; filename=\"a.txtSet-Cookie: x\"; filename*=UTF-8''a.txtSet-Cookie%3A%20x",
+		dispositionFormat("inline", "a.txt\r\nSet-Cookie: x\x00"))
 }
 
 func TestParseExpires(t *testing.T) {
@@ -105,14 +112,14 @@ func TestTempurlMiddlewarePassOptions(t *testing.T) {
 		require.Equal(t, r, request)
 		served = true
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.True(t, served)
 }
 
 func TestTempurlMiddlewarePassAlreadyAuthorized(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext",
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{},
 		&ProxyContext{
 			Authorize: func(r *http.Request) (bool, int) {
 				return false, http.StatusForbidden
@@ -125,14 +132,14 @@ func TestTempurlMiddlewarePassAlreadyAuthorized(t *testing.T) {
 		require.Equal(t, r, request)
 		served = true
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.True(t, served)
 }
 
 func TestTempurlMiddlewarePassNoQuery(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	served := false
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
@@ -140,47 +147,47 @@ func TestTempurlMiddlewarePassNoQuery(t *testing.T) {
 		require.Equal(t, r, request)
 		served = true
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.True(t, served)
 }
 
 func TestTempurlMiddleware401OnlySig(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something?temp_url_sig=ABCDEF", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
 
 func TestTempurlMiddleware401Expired(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something?temp_url_sig=ABCDEF&temp_url_expires=0", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
 
 func TestTempurlMiddleware401BadSig(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something?temp_url_sig=ABCDEFXXX&temp_url_expires=9999999999", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
 
 func TestTempurlMiddleware401NoContainer(t *testing.T) {
 	r := httptest.NewRequest("GET", "/v1/something?temp_url_sig=ABCDEF&temp_url_expires=9999999999", nil)
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
@@ -188,10 +195,10 @@ func TestTempurlMiddleware401NoContainer(t *testing.T) {
 func TestTempurlMiddleware400PuttingManifest(t *testing.T) {
 	r := httptest.NewRequest("PUT", "/v1/a/c/o?temp_url_sig=ABCDEF&temp_url_expires=9999999999", nil)
 	r.Header.Set("X-Object-Manifest", "true")
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", &ProxyContext{}))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, &ProxyContext{}))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 400, w.Result().StatusCode)
 }
@@ -209,10 +216,10 @@ func TestTempurlMiddleware401NoKeys(t *testing.T) {
 			"account/a": {Metadata: map[string]string{}},
 		},
 	}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
@@ -230,10 +237,10 @@ func TestTempurlMiddleware401WrongKeys(t *testing.T) {
 			"account/a": {Metadata: map[string]string{"Temp-Url-Key": "ABCD", "Temp-Url-Key-2": "012345"}},
 		},
 	}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 401, w.Result().StatusCode)
 }
@@ -250,7 +257,7 @@ func TestTempurlMiddlewareContainerKey(t *testing.T) {
 		}, zap.NewNop()),
 		accountInfoCache: map[string]*AccountInfo{"account/a": {Metadata: map[string]string{}}},
 	}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := GetProxyContext(request)
@@ -265,7 +272,7 @@ func TestTempurlMiddlewareContainerKey(t *testing.T) {
 		require.True(t, ok)
 		writer.WriteHeader(200)
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 200, w.Result().StatusCode)
 }
@@ -282,7 +289,7 @@ func TestTempurlMiddlewarePath(t *testing.T) {
 		}, zap.NewNop()),
 		accountInfoCache: map[string]*AccountInfo{"account/a": {Metadata: map[string]string{}}},
 	}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := GetProxyContext(request)
@@ -291,7 +298,7 @@ func TestTempurlMiddlewarePath(t *testing.T) {
 		require.True(t, ok)
 		writer.WriteHeader(200)
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 200, w.Result().StatusCode)
 }
@@ -309,13 +316,17 @@ func TestTempurlMiddlewareAccountKey(t *testing.T) {
 		accountInfoCache: map[string]*AccountInfo{
 			"account/a": {Metadata: map[string]string{"Temp-Url-Key": "mykey"}}},
 	}
-	r = r.WithContext(context.WithValue(r.Context(), "proxycontext", ctx))
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
 	w := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := GetProxyContext(request)
 		require.NotNil(t, ctx.Authorize)
 		ok, _ := ctx.Authorize(request)
 		require.True(t, ok)
+		require.Equal(t, SCOPE_ACCOUNT, ctx.TempURL.Scope)
+		require.Equal(t, "c", ctx.TempURL.Container)
+		require.Equal(t, int64(9999999999), ctx.TempURL.Expires.Unix())
+		require.False(t, ctx.TempURL.SingleUse)
 		// check that authorizing with other containers in the account works
 		ok, _ = ctx.Authorize(httptest.NewRequest("GET", "/v1/a/b/o", nil))
 		require.True(t, ok)
@@ -324,7 +335,134 @@ func TestTempurlMiddlewareAccountKey(t *testing.T) {
 		require.False(t, ok)
 		writer.WriteHeader(200)
 	})
-	mid := tempurl(common.NewTestScope().Counter("test_tempurl"))(handler)
+	mid := tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler)
 	mid.ServeHTTP(w, r)
 	require.Equal(t, 200, w.Result().StatusCode)
 }
+
+func TestTempurlMiddlewareExtraKeys(t *testing.T) {
+	for maxKeys, status := range map[int]int{2: 401, 3: 200} {
+		r := httptest.NewRequest("GET", "/v1/a/c/o?temp_url_sig=f2d61be897a27c03ac9a0dac3a8c4f6ce3a3d623&"+
+			"temp_url_expires=9999999999", nil)
+		f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+			nil, "", "", "", "", "", conf.Config{})
+		require.Nil(t, err)
+		ctx := &ProxyContext{
+			C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+				"container/a/c": {Metadata: map[string]string{}},
+			}, zap.NewNop()),
+			accountInfoCache: map[string]*AccountInfo{
+				"account/a": {Metadata: map[string]string{"Temp-Url-Key": "newkey", "Temp-Url-Key-3": "mykey"}}},
+		}
+		r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+		w := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(200)
+		})
+		mid := tempurl(common.NewTestScope().Counter("test_tempurl"), maxKeys)(handler)
+		mid.ServeHTTP(w, r)
+		require.Equal(t, status, w.Result().StatusCode)
+	}
+}
+
+func TestTempurlMiddlewareSingleUse(t *testing.T) {
+	mac := hmac.New(sha1.New, []byte("mykey"))
+	fmt.Fprintf(mac, "GET\n9999999999\n/v1/a/c/o?temp_url_nonce=abc")
+	sig := hex.EncodeToString(mac.Sum(nil))
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	mc := &test.FakeMemcacheRing{MockIncrResults: []int64{0, 1}}
+	ai := &AccountInfo{Metadata: map[string]string{"Temp-Url-Key": "mykey"}, SysMetadata: map[string]string{}}
+	do := func(query string) int {
+		r := httptest.NewRequest("GET", "/v1/a/c/o?"+query+"&temp_url_expires=9999999999", nil)
+		ctx := &ProxyContext{
+			C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+				"container/a/c": {Metadata: map[string]string{}},
+			}, zap.NewNop()),
+			ProxyContextMiddleware: &ProxyContextMiddleware{Cache: mc},
+			accountInfoCache:       map[string]*AccountInfo{"account/a": ai},
+		}
+		r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+		w := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(200)
+		})
+		tempurl(common.NewTestScope().Counter("test_tempurl"), 2)(handler).ServeHTTP(w, r)
+		return w.Result().StatusCode
+	}
+	require.Equal(t, 200, do("temp_url_sig="+sig+"&temp_url_nonce=abc"))
+	require.Equal(t, 401, do("temp_url_sig="+sig+"&temp_url_nonce=abc"))
+	require.Equal(t, []string{"tempurl_use/a/" + sig, "tempurl_use/a/" + sig}, mc.MockIncrKeys)
+	// The nonce is part of the signature.
+	require.Equal(t, 401, do("temp_url_sig="+sig+"&temp_url_nonce=abcd"))
+	require.Equal(t, 401, do("temp_url_sig="+sig))
+
+	// Accounts that want single-use URLs don't accept any others.
+	require.Equal(t, 200, do("temp_url_sig=f2d61be897a27c03ac9a0dac3a8c4f6ce3a3d623"))
+	ai.SysMetadata["Tempurl-Single-Use"] = "true"
+	require.Equal(t, 401, do("temp_url_sig=f2d61be897a27c03ac9a0dac3a8c4f6ce3a3d623"))
+}
+
+func TestRotateTempURLKey(t *testing.T) {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {Metadata: map[string]string{"Temp-Url-Key": "c1"}},
+		}, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{
+			"account/a": {Metadata: map[string]string{"Temp-Url-Key": "a1", "Temp-Url-Key-2": "a2", "Temp-Url-Key-3": "a3"}}},
+	}
+
+	r := httptest.NewRequest("POST", "/v1/a", nil)
+	r.Header.Set("X-Account-Rotate-Temp-Url-Key", "new")
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+	require.Nil(t, rotateTempURLKey(r, 3))
+	require.Equal(t, "new", r.Header.Get("X-Account-Meta-Temp-Url-Key"))
+	require.Equal(t, "a1", r.Header.Get("X-Account-Meta-Temp-Url-Key-2"))
+	require.Equal(t, "a2", r.Header.Get("X-Account-Meta-Temp-Url-Key-3"))
+	require.Equal(t, "", r.Header.Get("X-Account-Rotate-Temp-Url-Key"))
+
+	r = httptest.NewRequest("POST", "/v1/a/c", nil)
+	r.Header.Set("X-Container-Rotate-Temp-Url-Key", "new")
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+	require.Nil(t, rotateTempURLKey(r, 2))
+	require.Equal(t, "new", r.Header.Get("X-Container-Meta-Temp-Url-Key"))
+	require.Equal(t, "c1", r.Header.Get("X-Container-Meta-Temp-Url-Key-2"))
+}
+
+func TestRotateTempURLKeyError(t *testing.T) {
+	ctx := &ProxyContext{
+		accountInfoCache: map[string]*AccountInfo{"account/a": {StatusCode: 503}},
+	}
+	r := httptest.NewRequest("POST", "/v1/a", nil)
+	r.Header.Set("X-Account-Rotate-Temp-Url-Key", "new")
+	r = r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, ctx))
+	w := httptest.NewRecorder()
+	(&tempURLKeys{maxKeys: 2, next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request shouldn't have been passed on")
+	})}).ServeHTTP(w, r)
+	require.Equal(t, 503, w.Code)
+
+	// Callers who couldn't change the keys are turned away before anything
+	// is looked up.
+	ctx.Authorize = func(r *http.Request) (bool, int) {
+		return false, http.StatusUnauthorized
+	}
+	w = httptest.NewRecorder()
+	(&tempURLKeys{maxKeys: 2, next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request shouldn't have been passed on")
+	})}).ServeHTTP(w, r)
+	require.Equal(t, 401, w.Code)
+}
+
+func TestTempURLMaxKeysShared(t *testing.T) {
+	config, err := conf.StringConfig("[filter:tempurl]\nmax_keys = 4\n[filter:formpost]\nmax_keys = 3\n")
+	require.Nil(t, err)
+	require.Equal(t, 4, tempURLMaxKeys(config.GetSection("filter:tempurl")))
+	require.Equal(t, 4, tempURLMaxKeys(config.GetSection("filter:formpost")))
+	require.Equal(t, 4, tempURLMaxKeys(config.GetSection("filter:signedurl")))
+	require.Equal(t, 2, tempURLMaxKeys(conf.Config{}.GetSection("filter:formpost")))
+}
@@ -0,0 +1,234 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"unicode"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// tempURLKeyChange is a change to the Temp-URL keys a request would make.
+type tempURLKeyChange struct {
+	set     []string
+	removed []string
+}
+
+// tempURLKeyChanges finds the Temp-URL keys an account or container PUT or
+// POST sets or removes, after any rotation has been turned into metadata.
+func tempURLKeyChanges(request *http.Request, container string, maxKeys int) *tempURLKeyChange {
+	metaPrefix, removePrefix := "X-Account-Meta-", "X-Remove-Account-Meta-"
+	if container != "" {
+		metaPrefix, removePrefix = "X-Container-Meta-", "X-Remove-Container-Meta-"
+	}
+	change := &tempURLKeyChange{}
+	for _, name := range tempURLKeyNames(maxKeys) {
+		if v, ok := request.Header[metaPrefix+name]; ok {
+			if v[0] == "" {
+				change.removed = append(change.removed, name)
+			} else {
+				change.set = append(change.set, name)
+			}
+		} else if _, ok := request.Header[removePrefix+name]; ok {
+			change.removed = append(change.removed, name)
+		}
+	}
+	if len(change.set) == 0 && len(change.removed) == 0 {
+		return nil
+	}
+	return change
+}
+
+// tempURLKeyEntropy estimates the bits of entropy in a key: what a random key
+// of its length could hold, drawn from the character classes it uses.  A
+// random key uses about as many different characters as its length and
+// alphabet would suggest, so one using fewer than half that many, like
+// "aaaaaaaaaaaaaaaaaaaa" or "abababababab", gets proportionally less credit.
+func tempURLKeyEntropy(key string) float64 {
+	var lower, upper, digit, other bool
+	distinct := map[rune]bool{}
+	n := 0
+	for _, r := range key {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+		distinct[r] = true
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if other {
+		pool += 33
+	}
+	bits := float64(n) * math.Log2(float64(pool))
+	expected := float64(pool) * (1 - math.Pow(1-1/float64(pool), float64(n)))
+	if used := float64(len(distinct)); used < expected/2 {
+		bits *= used / expected
+	}
+	return bits
+}
+
+// tempURLKeys turns key rotations into metadata updates, checks Temp-URL
+// keys as they're set, stamps the account or
+// container's sysmeta with when they last changed, and logs each change that
+// succeeds so key rotations can be audited.
+type tempURLKeys struct {
+	next       http.Handler
+	maxKeys    int
+	minEntropy float64
+	changes    tally.Counter
+	rejected   tally.Counter
+}
+
+func (t *tempURLKeys) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	apiReq, account, container, obj := getPathParts(request)
+	ctx := GetProxyContext(request)
+	if !apiReq || account == "" || obj != "" || ctx == nil {
+		t.next.ServeHTTP(writer, request)
+		return
+	}
+	rotatedHeader, sysmetaRotated := "X-Account-Temp-Url-Key-Rotated", "X-Account-Sysmeta-Temp-Url-Key-Rotated"
+	if container != "" {
+		rotatedHeader, sysmetaRotated = "X-Container-Temp-Url-Key-Rotated", "X-Container-Sysmeta-Temp-Url-Key-Rotated"
+	}
+	if request.Method == "GET" || request.Method == "HEAD" {
+		t.next.ServeHTTP(renameHeaders(writer, map[string]string{sysmetaRotated: rotatedHeader}), request)
+		return
+	}
+	if request.Method != "PUT" && request.Method != "POST" {
+		t.next.ServeHTTP(writer, request)
+		return
+	}
+	rotateHeader := "X-Account-Rotate-Temp-Url-Key"
+	if container != "" {
+		rotateHeader = "X-Container-Rotate-Temp-Url-Key"
+	}
+	if request.Header.Get(rotateHeader) == "" && tempURLKeyChanges(request, container, t.maxKeys) == nil {
+		t.next.ServeHTTP(writer, request)
+		return
+	}
+	// Nothing is looked up for a caller who couldn't change the keys, so
+	// the answer can't tell them whether the account or container exists.
+	if ctx.Authorize != nil {
+		if ok, st := ctx.Authorize(request); !ok {
+			srv.StandardResponse(writer, st)
+			return
+		}
+	}
+	if err := rotateTempURLKey(request, t.maxKeys); err != nil {
+		srv.StandardResponse(writer, common.ErrorStatus(err))
+		return
+	}
+	change := tempURLKeyChanges(request, container, t.maxKeys)
+	if change == nil {
+		t.next.ServeHTTP(writer, request)
+		return
+	}
+	if ctx.TempURL != nil {
+		// A temp URL is no grounds for changing the keys that sign them.
+		t.rejected.Inc(1)
+		srv.StandardResponse(writer, http.StatusForbidden)
+		return
+	}
+	metaPrefix := "X-Account-Meta-"
+	if container != "" {
+		metaPrefix = "X-Container-Meta-"
+	}
+	// Keys that are only moving between slots, as they do in a rotation,
+	// were judged when they were first set.
+	existing := map[string]bool{}
+	var metadata map[string]string
+	if container == "" {
+		if ai, err := ctx.GetAccountInfo(request.Context(), account); err == nil {
+			metadata = ai.Metadata
+		}
+	} else if ci, err := ctx.C.GetContainerInfo(request.Context(), account, container); err == nil {
+		metadata = ci.Metadata
+	}
+	for _, name := range tempURLKeyNames(t.maxKeys) {
+		if key := metadata[name]; key != "" {
+			existing[key] = true
+		}
+	}
+	for _, name := range change.set {
+		if key := request.Header.Get(metaPrefix + name); !existing[key] && tempURLKeyEntropy(key) < t.minEntropy {
+			t.rejected.Inc(1)
+			srv.SimpleErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("%s is too weak; keys need at least %d bits of entropy.", name, int(t.minEntropy)))
+			return
+		}
+	}
+	request.Header.Set(sysmetaRotated, common.GetTimestamp())
+	newWriter := &srv.WebWriter{ResponseWriter: writer, Status: 500}
+	t.next.ServeHTTP(newWriter, request)
+	if newWriter.Status/100 == 2 {
+		t.changes.Inc(1)
+		ctx.Logger.Info("Temp-URL keys changed",
+			zap.String("account", account),
+			zap.String("container", container),
+			zap.Strings("set", change.set),
+			zap.Strings("removed", change.removed),
+			zap.Strings("users", ctx.RemoteUsers))
+	}
+}
+
+func init() {
+	// Changing keys takes an authorized caller, so this runs after the auth
+	// middleware, where tempurl itself has to run before it.
+	Register(Registration{Name: "tempurl_keys", Section: "filter:tempurl", Position: 147, New: NewTempURLKeys})
+}
+
+// NewTempURLKeys returns the middleware that rotates and checks Temp-URL
+// keys, configured from the tempurl section.
+func NewTempURLKeys(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
+	maxKeys := tempURLMaxKeys(config)
+	minEntropy := float64(config.GetInt("min_key_entropy", 64))
+	changesMetric := metricsScope.Counter("tempurl_key_changes")
+	rejectedMetric := metricsScope.Counter("tempurl_key_rejections")
+	return func(next http.Handler) http.Handler {
+		return &tempURLKeys{
+			next:       next,
+			maxKeys:    maxKeys,
+			minEntropy: minEntropy,
+			changes:    changesMetric,
+			rejected:   rejectedMetric,
+		}
+	}, nil
+}
@@ -0,0 +1,143 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/common/test"
+	"go.uber.org/zap"
+)
+
+const strongTempURLKey = "3f9c1e6b7a2d4c8e9f0a1b2c3d4e5f60"
+
+func TestTempURLKeyEntropy(t *testing.T) {
+	require.Equal(t, 0.0, tempURLKeyEntropy(""))
+	require.True(t, tempURLKeyEntropy("aaaaaaaaaaaaaaaaaaaa") < 64)
+	require.True(t, tempURLKeyEntropy("abababababababababababababab") < 64)
+	require.True(t, tempURLKeyEntropy("mykey") < 64)
+	require.True(t, tempURLKeyEntropy("abcdefgh") < 64)
+	require.True(t, tempURLKeyEntropy(strongTempURLKey) >= 64)
+	require.True(t, tempURLKeyEntropy("correct horse battery staple") >= 64)
+	// short random keys repeat some characters, which shouldn't count
+	// against them
+	require.True(t, tempURLKeyEntropy("a3f9a1c07b4d2d85") >= 64)
+	require.True(t, tempURLKeyEntropy("q7Rk2xP9mWb4") >= 64)
+}
+
+func TestTempURLKeyChanges(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/a/c", nil)
+	require.Nil(t, tempURLKeyChanges(r, "c", 3))
+	r.Header.Set("X-Container-Meta-Temp-Url-Key", "k")
+	r.Header.Set("X-Container-Meta-Temp-Url-Key-2", "")
+	r.Header.Set("X-Remove-Container-Meta-Temp-Url-Key-3", "x")
+	r.Header.Set("X-Account-Meta-Temp-Url-Key", "ignored")
+	change := tempURLKeyChanges(r, "c", 3)
+	require.Equal(t, []string{"Temp-Url-Key"}, change.set)
+	require.Equal(t, []string{"Temp-Url-Key-2", "Temp-Url-Key-3"}, change.removed)
+}
+
+func tempURLKeysRequest(t *testing.T, method, path string) (*http.Request, *ProxyContext) {
+	f, err := client.NewProxyClient(staticPolicyList, srv.NewTestConfigLoader(&test.FakeRing{}),
+		nil, "", "", "", "", "", conf.Config{})
+	require.Nil(t, err)
+	ctx := &ProxyContext{
+		Logger: zap.NewNop(),
+		C: f.NewRequestClient(nil, map[string]*client.ContainerInfo{
+			"container/a/c": {Metadata: map[string]string{"Temp-Url-Key": "weak"}},
+		}, zap.NewNop()),
+		accountInfoCache: map[string]*AccountInfo{
+			"account/a": {Metadata: map[string]string{}},
+		},
+	}
+	req := httptest.NewRequest(method, path, nil)
+	return SetProxyContext(req, ctx), ctx
+}
+
+func TestTempURLKeysMiddleware(t *testing.T) {
+	var gotHeader http.Header
+	status := 204
+	scope := common.NewTestScope()
+	h := &tempURLKeys{maxKeys: 2, minEntropy: 64, changes: scope.Counter("changes"), rejected: scope.Counter("rejected"),
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotHeader = r.Header
+			w.WriteHeader(status)
+		})}
+	changes := func() int64 { return h.changes.(*common.TestCounter).Value() }
+	rejected := func() int64 { return h.rejected.(*common.TestCounter).Value() }
+
+	req, _ := tempURLKeysRequest(t, "POST", "/v1/a")
+	req.Header.Set("X-Account-Meta-Temp-Url-Key", "mykey")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 400, w.Code)
+	require.Equal(t, int64(1), rejected())
+
+	req, _ = tempURLKeysRequest(t, "POST", "/v1/a")
+	req.Header.Set("X-Account-Meta-Temp-Url-Key", strongTempURLKey)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.NotEqual(t, "", gotHeader.Get("X-Account-Sysmeta-Temp-Url-Key-Rotated"))
+	require.Equal(t, int64(1), changes())
+
+	// Rotating moves the container's old weak key into the second slot,
+	// which isn't held against the new one.
+	req, _ = tempURLKeysRequest(t, "POST", "/v1/a/c")
+	req.Header.Set("X-Container-Meta-Temp-Url-Key", strongTempURLKey)
+	req.Header.Set("X-Container-Meta-Temp-Url-Key-2", "weak")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 204, w.Code)
+	require.NotEqual(t, "", gotHeader.Get("X-Container-Sysmeta-Temp-Url-Key-Rotated"))
+	require.Equal(t, int64(2), changes())
+
+	// Failed requests aren't counted as changes.
+	status = 403
+	req, _ = tempURLKeysRequest(t, "POST", "/v1/a")
+	req.Header.Set("X-Remove-Account-Meta-Temp-Url-Key", "x")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+	require.Equal(t, int64(2), changes())
+
+	status = 204
+	req, ctx := tempURLKeysRequest(t, "POST", "/v1/a/c")
+	ctx.TempURL = &TempURLInfo{Scope: SCOPE_CONTAINER, Account: "a", Container: "c"}
+	req.Header.Set("X-Container-Meta-Temp-Url-Key", strongTempURLKey)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, 403, w.Code)
+	require.Equal(t, int64(2), rejected())
+}
+
+func TestTempURLKeysShowsRotated(t *testing.T) {
+	h := &tempURLKeys{maxKeys: 2, minEntropy: 64, next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Account-Sysmeta-Temp-Url-Key-Rotated", "1500000000.00000")
+		w.WriteHeader(204)
+	})}
+	req, _ := tempURLKeysRequest(t, "HEAD", "/v1/a")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, "1500000000.00000", w.Header().Get("X-Account-Temp-Url-Key-Rotated"))
+}
@@ -0,0 +1,82 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimings keeps how long a request spent in each stage of the
+// pipeline, for its X-Debug-Timing header.  A stage is charged from when the
+// request reaches it until it reaches the next one, so the last stage, the
+// backend, is charged until the response headers are written.
+type requestTimings struct {
+	lock    sync.Mutex
+	current string
+	since   time.Time
+	names   []string
+	spent   map[string]time.Duration
+}
+
+func newRequestTimings() *requestTimings {
+	return &requestTimings{current: "context", since: time.Now(), spent: map[string]time.Duration{}}
+}
+
+// charge adds the time since the last charge to the current stage.
+func (t *requestTimings) charge(now time.Time) {
+	if _, ok := t.spent[t.current]; !ok {
+		t.names = append(t.names, t.current)
+	}
+	t.spent[t.current] += now.Sub(t.since)
+	t.since = now
+}
+
+// enter starts charging the request's time to the named stage.
+func (t *requestTimings) enter(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.charge(time.Now())
+	t.current = name
+}
+
+// header returns the time spent in each stage so far, in the order they were
+// first reached, like "context=0.012ms, tempauth=1.204ms, backend=8.310ms".
+func (t *requestTimings) header() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.charge(time.Now())
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = fmt.Sprintf("%s=%.3fms", name, float64(t.spent[name])/float64(time.Millisecond))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TimedStage returns next, charging the time requests spend from reaching it
+// to the named stage when they've asked for an X-Debug-Timing header.
+// Subrequests are charged to whichever stage made them.
+func TimedStage(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if ctx := GetProxyContext(request); ctx != nil && ctx.timings != nil {
+			ctx.timings.enter(name)
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
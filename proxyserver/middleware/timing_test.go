@@ -0,0 +1,52 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimedStage(t *testing.T) {
+	backend := TimedStage("backend", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+	}))
+	h := TimedStage("tempauth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backend.ServeHTTP(w, r)
+	}))
+	pc := &ProxyContext{timings: newRequestTimings()}
+	h.ServeHTTP(httptest.NewRecorder(), SetProxyContext(httptest.NewRequest("GET", "/v1/a/c/o", nil), pc))
+	header := pc.timings.header()
+	require.Regexp(t, regexp.MustCompile(`^context=[0-9.]+ms, tempauth=[0-9.]+ms, backend=[0-9.]+ms$`), header)
+	require.Equal(t, "backend", pc.timings.current)
+	require.True(t, pc.timings.spent["backend"] >= 2*time.Millisecond)
+}
+
+func TestTimedStageNotRequested(t *testing.T) {
+	called := false
+	h := TimedStage("tempauth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	pc := &ProxyContext{}
+	h.ServeHTTP(httptest.NewRecorder(), SetProxyContext(httptest.NewRequest("GET", "/v1/a/c/o", nil), pc))
+	require.True(t, called)
+	require.Nil(t, pc.timings)
+}
@@ -515,6 +515,10 @@ func (v *versionedWrites) ServeHTTP(writer http.ResponseWriter, request *http.Re
 	}
 }
 
+func init() {
+	Register(Registration{Name: "versioned_writes", Position: 280, New: NewVersionedWrites})
+}
+
 func NewVersionedWrites(config conf.Section, metricsScope tally.Scope) (func(http.Handler) http.Handler, error) {
 	RegisterInfo("versioned_writes", map[string]interface{}{"allowed_flags": []string{strings.ToLower(CLIENT_VERSIONS_LOC), strings.ToLower(CLIENT_HISTORY_LOC)}})
 	return func(next http.Handler) http.Handler {
@@ -93,7 +93,7 @@ func TestObjectPutHistory(t *testing.T) {
 		}, zap.NewNop()),
 	}
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	require.Nil(t, err)
 
 	vw.ServeHTTP(w, req)
@@ -153,7 +153,7 @@ func TestObjectDeleteHistory(t *testing.T) {
 		}, zap.NewNop()),
 	}
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	require.Nil(t, err)
 
 	vw.ServeHTTP(w, req)
@@ -220,7 +220,7 @@ func TestObjectDeleteStack(t *testing.T) {
 		}, zap.NewNop()),
 	}
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	require.Nil(t, err)
 
 	vw.ServeHTTP(w, req)
@@ -287,7 +287,7 @@ func TestObjectDeleteStackMarker(t *testing.T) {
 		}, zap.NewNop()),
 	}
 
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", ctx))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, ctx))
 	require.Nil(t, err)
 
 	vw.ServeHTTP(w, req)
@@ -309,7 +309,7 @@ func TestRemoveVersioning(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/v1/a/c", nil)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	req.Header.Set("X-Remove-Versions-Location", "anywhere")
@@ -338,7 +338,7 @@ func TestAddVersioning(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/v1/a/c", nil)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	req.Header.Set("X-Versions-Location", "anywhere")
@@ -361,7 +361,7 @@ func TestNotBothTypes(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/v1/a/c", nil)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	req.Header.Set("X-Versions-Location", "anywhere")
@@ -383,7 +383,7 @@ func TestDisabled(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/v1/a/c/o", nil)
 	fakeContext := NewFakeProxyContext(next)
-	req = req.WithContext(context.WithValue(req.Context(), "proxycontext", fakeContext))
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, fakeContext))
 	require.Nil(t, err)
 
 	w := httptest.NewRecorder()
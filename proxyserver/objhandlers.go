@@ -16,6 +16,8 @@
 package proxyserver
 
 import (
+	"errors"
+	"io"
 	"mime"
 	"net/http"
 	"path/filepath"
@@ -29,6 +31,16 @@ import (
 	"github.com/troubling/hummingbird/proxyserver/middleware"
 )
 
+// openExpired asks the object servers to return an object even if its
+// X-Delete-At has passed, as long as it hasn't been removed yet, when the
+// client sends X-Open-Expired: true.  Only the account's owners and reseller
+// admins may, and only if allow_open_expired is set.
+func (server *ProxyServer) openExpired(ctx *middleware.ProxyContext, request *http.Request) {
+	if server.allowOpenExpired && common.LooksTrue(request.Header.Get("X-Open-Expired")) && (ctx.StorageOwner || ctx.ResellerRequest) {
+		request.Header.Set("X-Backend-Open-Expired", "true")
+	}
+}
+
 func (server *ProxyServer) ObjectGetHandler(writer http.ResponseWriter, request *http.Request) {
 	vars := srv.GetVars(request)
 	ctx := middleware.GetProxyContext(request)
@@ -61,6 +73,7 @@ func (server *ProxyServer) ObjectGetHandler(writer http.ResponseWriter, request
 			return
 		}
 	}
+	server.openExpired(ctx, request)
 	resp := ctx.C.GetObject(request.Context(), vars["account"], vars["container"], vars["obj"], request.Header)
 	for k := range resp.Header {
 		writer.Header().Set(k, resp.Header.Get(k))
@@ -102,6 +115,12 @@ func (server *ProxyServer) ObjectHeadHandler(writer http.ResponseWriter, request
 			return
 		}
 	}
+	server.openExpired(ctx, request)
+	if server.headMetadataOnly {
+		// Object servers with an index answer from it without touching the
+		// object's data file.
+		request.Header.Set("X-Backend-Fetch-Metadata-Only", "true")
+	}
 	resp := ctx.C.HeadObject(request.Context(), vars["account"], vars["container"], vars["obj"], request.Header)
 	for k := range resp.Header {
 		writer.Header().Set(k, resp.Header.Get(k))
@@ -142,8 +161,15 @@ func (server *ProxyServer) ObjectDeleteHandler(writer http.ResponseWriter, reque
 			return
 		}
 	}
+	if ts, err := ctx.ClientTimestamp(); err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	} else if ts != "" {
+		request.Header.Set("X-Timestamp", ts)
+	}
 	resp := ctx.C.DeleteObject(request.Context(), vars["account"], vars["container"], vars["obj"], request.Header)
 	resp.Body.Close()
+	server.listingCache.invalidate(vars["account"], vars["container"])
 	srv.StandardResponse(writer, resp.StatusCode)
 }
 
@@ -179,7 +205,7 @@ func (server *ProxyServer) ObjectPostHandler(writer http.ResponseWriter, request
 			return
 		}
 	}
-	if status, str := common.CheckObjPost(request, vars["obj"]); status != http.StatusOK {
+	if status, str := server.constraints.CheckObjPost(request, vars["obj"]); status != http.StatusOK {
 		writer.Header().Set("Content-Type", "text/plain")
 		writer.WriteHeader(status)
 		writer.Write([]byte(str))
@@ -187,6 +213,7 @@ func (server *ProxyServer) ObjectPostHandler(writer http.ResponseWriter, request
 	}
 	resp := ctx.C.PostObject(request.Context(), vars["account"], vars["container"], vars["obj"], request.Header)
 	resp.Body.Close()
+	server.listingCache.invalidate(vars["account"], vars["container"])
 	srv.StandardResponse(writer, resp.StatusCode)
 }
 
@@ -227,6 +254,12 @@ func (server *ProxyServer) ObjectPutHandler(writer http.ResponseWriter, request
 			return
 		}
 	}
+	if ts, err := ctx.ClientTimestamp(); err != nil {
+		srv.SimpleErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	} else if ts != "" {
+		request.Header.Set("X-Timestamp", ts)
+	}
 	if request.Header.Get("Content-Type") == "" || common.LooksTrue(request.Header.Get("X-Detect-Content-Type")) {
 		contentType := mime.TypeByExtension(filepath.Ext(vars["obj"]))
 		contentType = strings.Split(contentType, ";")[0] // remove any charset it tried to foist on us
@@ -235,17 +268,64 @@ func (server *ProxyServer) ObjectPutHandler(writer http.ResponseWriter, request
 		}
 		request.Header.Set("Content-Type", contentType)
 	}
-	if status, str := common.CheckObjPut(request, vars["obj"]); status != http.StatusOK {
+	if status, str := server.constraints.CheckObjPut(request, vars["obj"]); status != http.StatusOK {
 		writer.Header().Set("Content-Type", "text/plain")
 		writer.WriteHeader(status)
 		writer.Write([]byte(str))
 		return
 	}
+	var sizeLimit *maxSizeReader
+	if request.ContentLength < 0 {
+		sizeLimit = &maxSizeReader{ReadCloser: request.Body, remaining: server.constraints.MaxFileSize}
+		if footers, ok := request.Body.(common.FooterSource); ok {
+			request.Body = &footerSizeReader{maxSizeReader: sizeLimit, footers: footers}
+		} else {
+			request.Body = sizeLimit
+		}
+	}
 	resp := ctx.C.PutObject(request.Context(), vars["account"], vars["container"], vars["obj"], request.Header, request.Body)
 	resp.Body.Close()
+	if sizeLimit != nil && sizeLimit.exceeded {
+		srv.SimpleErrorResponse(writer, http.StatusRequestEntityTooLarge, "Your request is too large.")
+		return
+	}
+	server.listingCache.invalidate(vars["account"], vars["container"])
 	writer.Header().Set("Etag", resp.Header.Get("Etag"))
+	if checksum := resp.Header.Get("X-Object-Checksum-Sha256"); checksum != "" {
+		writer.Header().Set("X-Object-Checksum-Sha256", checksum)
+	}
 	if modified, err := common.ParseDate(request.Header.Get("X-Timestamp")); err == nil {
 		writer.Header().Set("Last-Modified", common.FormatLastModified(modified))
 	}
 	srv.StandardResponse(writer, resp.StatusCode)
 }
+
+var errObjectTooLarge = errors.New("object too large")
+
+// maxSizeReader fails once more than remaining bytes have been read, for
+// chunked uploads whose size isn't known until they're done.
+type maxSizeReader struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (m *maxSizeReader) Read(b []byte) (int, error) {
+	n, err := m.ReadCloser.Read(b)
+	if m.remaining -= int64(n); m.remaining < 0 {
+		m.exceeded = true
+		return 0, errObjectTooLarge
+	}
+	return n, err
+}
+
+// footerSizeReader is a maxSizeReader around a body with metadata footers,
+// which it passes on.
+type footerSizeReader struct {
+	*maxSizeReader
+	footers common.FooterSource
+}
+
+func (f *footerSizeReader) Footers() map[string]string {
+	return f.footers.Footers()
+}
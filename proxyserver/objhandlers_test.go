@@ -0,0 +1,37 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package proxyserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxSizeReader(t *testing.T) {
+	r := &maxSizeReader{ReadCloser: ioutil.NopCloser(bytes.NewBufferString("0123456789")), remaining: 10}
+	data, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "0123456789", string(data))
+	require.False(t, r.exceeded)
+
+	r = &maxSizeReader{ReadCloser: ioutil.NopCloser(bytes.NewBufferString("0123456789")), remaining: 9}
+	_, err = ioutil.ReadAll(r)
+	require.Equal(t, errObjectTooLarge, err)
+	require.True(t, r.exceeded)
+}
@@ -0,0 +1,259 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gholt/brimtext"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/ring"
+)
+
+// minGrowthSpan is how much device state history is needed before a
+// device's growth rate is trusted.
+const minGrowthSpan = time.Hour
+
+// capacityGroup is the capacity of the devices of one ring in one zone.
+type capacityGroup struct {
+	Ring      string
+	Region    int
+	Zone      int
+	Devices   int
+	Reporting int
+	Size      int64
+	Used      int64
+	// GrowthPerDay is the bytes per day the reporting devices have grown
+	// over the device state history andrewd keeps.
+	GrowthPerDay int64
+}
+
+// TimeToFull returns how long until the group is full at its current
+// growth, or -1 if it isn't growing.
+func (g *capacityGroup) TimeToFull() time.Duration {
+	if g.GrowthPerDay <= 0 {
+		return -1
+	}
+	days := float64(g.Size-g.Used) / float64(g.GrowthPerDay)
+	if days > float64(100*365) {
+		return -1
+	}
+	return time.Duration(days * float64(24*time.Hour))
+}
+
+// deviceGrowth returns the bytes per second a device's usage has grown
+// according to its states, newest first as returned by deviceStates.  Only
+// the most recent run of samples with the same size is used, since a size
+// change means the device was replaced or reformatted.
+func deviceGrowth(states []*stateEntry) (float64, bool) {
+	var newest, oldest *stateEntry
+	for _, state := range states {
+		if !state.state || state.size <= 0 {
+			continue
+		}
+		if newest == nil {
+			newest = state
+		} else if state.size != newest.size {
+			break
+		}
+		oldest = state
+	}
+	if newest == nil || newest.recorded.Sub(oldest.recorded) < minGrowthSpan {
+		return 0, false
+	}
+	return float64(newest.used-oldest.used) / newest.recorded.Sub(oldest.recorded).Seconds(), true
+}
+
+// summarizeCapacity groups the devices of a ring by region and zone.
+func summarizeCapacity(ringName string, devs []*ring.Device, states func(*ring.Device) ([]*stateEntry, error)) ([]*capacityGroup, []string) {
+	var errs []string
+	groups := map[[2]int]*capacityGroup{}
+	for _, dev := range devs {
+		if dev == nil || dev.Weight < 0 {
+			continue
+		}
+		key := [2]int{dev.Region, dev.Zone}
+		g := groups[key]
+		if g == nil {
+			g = &capacityGroup{Ring: ringName, Region: dev.Region, Zone: dev.Zone}
+			groups[key] = g
+		}
+		g.Devices++
+		devStates, err := states(dev)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("error getting device states for %s:%d/%s: %s", dev.Ip, dev.Port, dev.Device, err))
+			continue
+		}
+		if len(devStates) == 0 || !devStates[0].state {
+			continue
+		}
+		g.Reporting++
+		g.Size += devStates[0].size
+		g.Used += devStates[0].used
+		if growth, ok := deviceGrowth(devStates); ok {
+			g.GrowthPerDay += int64(math.Round(growth * 24 * 60 * 60))
+		}
+	}
+	var summary []*capacityGroup
+	for _, g := range groups {
+		summary = append(summary, g)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Region != summary[j].Region {
+			return summary[i].Region < summary[j].Region
+		}
+		return summary[i].Zone < summary[j].Zone
+	})
+	return summary, errs
+}
+
+type capacityReport struct {
+	Name   string
+	Time   time.Time
+	Pass   bool
+	Errors []string
+	Groups []*capacityGroup
+}
+
+func (r *capacityReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *capacityReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	data := [][]string{{"Ring", "Region", "Zone", "Devices", "Size", "Used", "Avail", "Use%", "Growth/Day", "Full In"}}
+	for _, g := range r.Groups {
+		devices := fmt.Sprintf("%d", g.Devices)
+		if g.Reporting != g.Devices {
+			devices = fmt.Sprintf("%d/%d", g.Reporting, g.Devices)
+		}
+		usePct := "-"
+		if g.Size > 0 {
+			usePct = fmt.Sprintf("%.02f%%", 100*float64(g.Used)/float64(g.Size))
+		}
+		growth := "-"
+		if g.GrowthPerDay != 0 {
+			growth = brimtext.HumanSize1024(float64(g.GrowthPerDay))
+			if g.GrowthPerDay < 0 {
+				growth = "-" + brimtext.HumanSize1024(float64(-g.GrowthPerDay))
+			}
+		}
+		fullIn := "-"
+		if ttf := g.TimeToFull(); ttf >= 0 {
+			fullIn = fmt.Sprintf("%.1f days", ttf.Hours()/24)
+		}
+		data = append(data, []string{
+			g.Ring,
+			fmt.Sprintf("%d", g.Region),
+			fmt.Sprintf("%d", g.Zone),
+			devices,
+			brimtext.HumanSize1024(float64(g.Size)),
+			brimtext.HumanSize1024(float64(g.Used)),
+			brimtext.HumanSize1024(float64(g.Size - g.Used)),
+			usePct,
+			growth,
+			fullIn,
+		})
+	}
+	opts := brimtext.NewSimpleAlignOptions()
+	opts.Alignments = []brimtext.Alignment{brimtext.Left, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right, brimtext.Right}
+	s += brimtext.Align(data, opts)
+	return s
+}
+
+func getCapacityReport(flags *flag.FlagSet) *capacityReport {
+	report := &capacityReport{
+		Name: "Capacity Report",
+		Time: time.Now().UTC(),
+	}
+	serverconf, err := getAndrewdConf(flags)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	db, err := newDB(serverconf, "")
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	states := func(dev *ring.Device) ([]*stateEntry, error) {
+		return db.deviceStates(dev.Ip, dev.Port, dev.Device)
+	}
+	add := func(ringName string, r ring.Ring) {
+		groups, errs := summarizeCapacity(ringName, r.AllDevices(), states)
+		report.Groups = append(report.Groups, groups...)
+		report.Errors = append(report.Errors, errs...)
+	}
+	prefix, suffix := getAffixes()
+	if r, err := ring.GetRing("account", prefix, suffix, 0); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		add("account", r)
+	}
+	if r, err := ring.GetRing("container", prefix, suffix, 0); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		add("container", r)
+	}
+	if policies, err := conf.GetPolicies(); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		var indexes []int
+		for index := range policies {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			if r, err := ring.GetRing("object", prefix, suffix, index); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else {
+				add(fmt.Sprintf("object-%d", index), r)
+			}
+		}
+	}
+	report.Pass = len(report.Errors) == 0
+	return report
+}
+
+// DiskFree prints the cluster's capacity by ring, region and zone, from the
+// device states andrewd's unmounted monitor records, along with how long
+// until each zone fills at its recent growth.
+func DiskFree(flags *flag.FlagSet) bool {
+	report := getCapacityReport(flags)
+	if flags.Lookup("json").Value.(flag.Getter).Get().(bool) {
+		byts, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		fmt.Println(string(byts))
+	} else {
+		fmt.Print(report)
+	}
+	return report.Passed()
+}
@@ -0,0 +1,81 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+)
+
+func TestDeviceGrowth(t *testing.T) {
+	now := time.Now()
+	states := []*stateEntry{
+		{recorded: now, state: true, size: 1000, used: 600},
+		{recorded: now.Add(-12 * time.Hour), state: false},
+		{recorded: now.Add(-24 * time.Hour), state: true, size: 1000, used: 500},
+		{recorded: now.Add(-48 * time.Hour), state: true, size: 2000, used: 100},
+	}
+	growth, ok := deviceGrowth(states)
+	require.True(t, ok)
+	require.InDelta(t, 100.0/(24*60*60), growth, 0.0001)
+
+	_, ok = deviceGrowth(states[:1])
+	require.False(t, ok)
+	_, ok = deviceGrowth([]*stateEntry{
+		{recorded: now, state: true, size: 1000, used: 600},
+		{recorded: now.Add(-time.Minute), state: true, size: 1000, used: 500},
+	})
+	require.False(t, ok)
+	_, ok = deviceGrowth(nil)
+	require.False(t, ok)
+}
+
+func TestSummarizeCapacity(t *testing.T) {
+	now := time.Now()
+	devs := []*ring.Device{
+		{Id: 0, Region: 1, Zone: 2, Ip: "127.0.0.1", Port: 6000, Device: "sda", Weight: 1},
+		{Id: 1, Region: 1, Zone: 1, Ip: "127.0.0.1", Port: 6000, Device: "sdb", Weight: 1},
+		nil,
+		{Id: 3, Region: 1, Zone: 1, Ip: "127.0.0.1", Port: 6000, Device: "sdc", Weight: 1},
+		{Id: 4, Region: 1, Zone: 1, Ip: "127.0.0.1", Port: 6000, Device: "sdd", Weight: 1},
+		{Id: 5, Region: 1, Zone: 1, Ip: "127.0.0.1", Port: 6000, Device: "sde", Weight: -1},
+	}
+	states := func(dev *ring.Device) ([]*stateEntry, error) {
+		switch dev.Device {
+		case "sda":
+			return []*stateEntry{{recorded: now, state: true, size: 1000, used: 100}}, nil
+		case "sdb":
+			return []*stateEntry{
+				{recorded: now, state: true, size: 1000, used: 600},
+				{recorded: now.Add(-24 * time.Hour), state: true, size: 1000, used: 500},
+			}, nil
+		case "sdc":
+			return []*stateEntry{{recorded: now, state: false}}, nil
+		}
+		return nil, errors.New("boom")
+	}
+	groups, errs := summarizeCapacity("object-0", devs, states)
+	require.Equal(t, []string{"error getting device states for 127.0.0.1:6000/sdd: boom"}, errs)
+	require.Equal(t, 2, len(groups))
+	require.Equal(t, &capacityGroup{Ring: "object-0", Region: 1, Zone: 1, Devices: 3, Reporting: 1, Size: 1000, Used: 600, GrowthPerDay: 100}, groups[0])
+	require.Equal(t, &capacityGroup{Ring: "object-0", Region: 1, Zone: 2, Devices: 1, Reporting: 1, Size: 1000, Used: 100}, groups[1])
+	require.Equal(t, 4*24*time.Hour, groups[0].TimeToFull())
+	require.Equal(t, time.Duration(-1), groups[1].TimeToFull())
+}
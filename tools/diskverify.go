@@ -0,0 +1,268 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gholt/brimtext"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/fs"
+)
+
+// diskCheck is the outcome of one of disk-verify's checks.
+type diskCheck struct {
+	Name   string
+	Pass   bool
+	Detail string `json:",omitempty"`
+}
+
+type diskVerifyReport struct {
+	Name       string
+	Time       time.Time
+	Pass       bool
+	Mountpoint string
+	Checks     []*diskCheck
+	// WriteBytesPerSecond and ReadBytesPerSecond are from the throughput
+	// test, if it was run.
+	WriteBytesPerSecond float64
+	ReadBytesPerSecond  float64
+}
+
+func (r *diskVerifyReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *diskVerifyReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s for %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+		r.Mountpoint,
+	)
+	data := [][]string{{"Check", "Result", "Detail"}}
+	for _, c := range r.Checks {
+		result := "pass"
+		if !c.Pass {
+			result = "FAIL"
+		}
+		data = append(data, []string{c.Name, result, c.Detail})
+	}
+	s += brimtext.Align(data, brimtext.NewSimpleAlignOptions())
+	if r.WriteBytesPerSecond > 0 || r.ReadBytesPerSecond > 0 {
+		s += fmt.Sprintf("Write: %s/s  Read: %s/s\n",
+			brimtext.HumanSize1024(r.WriteBytesPerSecond), brimtext.HumanSize1024(r.ReadBytesPerSecond))
+	}
+	return s
+}
+
+func (r *diskVerifyReport) check(name string, err error) bool {
+	c := &diskCheck{Name: name, Pass: err == nil}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Pass
+}
+
+// diskVerifyWrite writes data to a new file at path and syncs it and its
+// directory, so it would survive a power loss.
+func diskVerifyWrite(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("fsync: %v", err)
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("fsync of directory: %v", err)
+	}
+	return f.Close()
+}
+
+// diskVerifyRead checks that the file at path holds data, reading it past
+// the page cache where that's possible.
+func diskVerifyRead(path string, data []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fs.DropCache(f)
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("read back %d bytes that don't match the %d written", len(got), len(data))
+	}
+	return nil
+}
+
+// diskVerifyXattrs checks that the disk can hold object metadata in xattrs,
+// at about the size an object with a fair amount of user metadata has.
+func diskVerifyXattrs(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	metadata := map[string]string{
+		"name":              "/disk-verify/container/object",
+		"X-Timestamp":       common.GetTimestamp(),
+		"X-Object-Meta-Big": strings.Repeat("x", 2048),
+	}
+	if err := common.SwiftObjectWriteMetadata(f.Fd(), metadata); err != nil {
+		return err
+	}
+	got, err := common.SwiftObjectReadMetadata(f.Fd())
+	if err != nil {
+		return err
+	}
+	for k, v := range metadata {
+		if got[k] != v {
+			return fmt.Errorf("metadata %q didn't read back the same", k)
+		}
+	}
+	return nil
+}
+
+// diskVerifyThroughput writes then reads size bytes and returns the rates.
+func diskVerifyThroughput(path string, size int64) (float64, float64, error) {
+	buf := make([]byte, 1024*1024)
+	rand.Read(buf)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	start := time.Now()
+	for written := int64(0); written < size; {
+		chunk := buf
+		if size-written < int64(len(chunk)) {
+			chunk = chunk[:size-written]
+		}
+		n, err := f.Write(chunk)
+		if err != nil {
+			return 0, 0, err
+		}
+		written += int64(n)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, 0, err
+	}
+	writeRate := float64(size) / time.Since(start).Seconds()
+	fs.DropCache(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	start = time.Now()
+	read, err := io.CopyBuffer(ioutil.Discard, f, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if read != size {
+		return 0, 0, fmt.Errorf("read %d bytes of the %d written", read, size)
+	}
+	return writeRate, float64(size) / time.Since(start).Seconds(), nil
+}
+
+// verifyDisk runs disk-verify's checks against mountpoint, in a scratch
+// directory that's removed afterward.  The throughput test is skipped if
+// testSize is 0.
+func verifyDisk(mountpoint string, mountCheck bool, testSize int64) *diskVerifyReport {
+	report := &diskVerifyReport{
+		Name:       "Disk Verify Report",
+		Time:       time.Now().UTC(),
+		Mountpoint: mountpoint,
+	}
+	if mountCheck {
+		mounted, err := fs.IsMount(mountpoint)
+		if err == nil && !mounted {
+			err = fmt.Errorf("%s is not a mount point", mountpoint)
+		}
+		if !report.check("mount", err) {
+			return report
+		}
+	}
+	dir, err := ioutil.TempDir(mountpoint, ".disk-verify-")
+	if !report.check("mkdir", err) {
+		return report
+	}
+	defer os.RemoveAll(dir)
+	data := make([]byte, 64*1024)
+	rand.Read(data)
+	path := filepath.Join(dir, "verify")
+	if report.check("write+fsync", diskVerifyWrite(path, data)) {
+		report.check("read", diskVerifyRead(path, data))
+		report.check("xattr", diskVerifyXattrs(path))
+	}
+	report.check("O_TMPFILE", fs.CheckTmpfile(dir))
+	if testSize > 0 {
+		var err error
+		report.WriteBytesPerSecond, report.ReadBytesPerSecond, err = diskVerifyThroughput(filepath.Join(dir, "throughput"), testSize)
+		report.check("throughput", err)
+	}
+	report.Pass = true
+	for _, c := range report.Checks {
+		report.Pass = report.Pass && c.Pass
+	}
+	return report
+}
+
+// DiskVerify checks that a disk can do what the servers need of it (write,
+// fsync, read back, hold xattrs and O_TMPFILE) and how fast it writes and
+// reads, so a bad disk can be caught before it's added to a ring.
+func DiskVerify(flags *flag.FlagSet) bool {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return false
+	}
+	size := int64(flags.Lookup("size").Value.(flag.Getter).Get().(int)) * 1024 * 1024
+	mountCheck := flags.Lookup("mount-check").Value.(flag.Getter).Get().(bool)
+	report := verifyDisk(flags.Arg(0), mountCheck, size)
+	if flags.Lookup("json").Value.(flag.Getter).Get().(bool) {
+		byts, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		fmt.Println(string(byts))
+	} else {
+		fmt.Print(report)
+	}
+	return report.Passed()
+}
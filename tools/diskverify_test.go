@@ -0,0 +1,78 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	report := verifyDisk(dir, false, 1024*1024)
+	checks := map[string]bool{}
+	for _, c := range report.Checks {
+		checks[c.Name] = c.Pass
+	}
+	// xattr and O_TMPFILE support depend on where the test runs.
+	require.True(t, checks["mkdir"])
+	require.True(t, checks["write+fsync"])
+	require.True(t, checks["read"])
+	require.True(t, checks["throughput"])
+	require.Contains(t, checks, "xattr")
+	require.Contains(t, checks, "O_TMPFILE")
+	require.True(t, report.WriteBytesPerSecond > 0)
+	require.True(t, report.ReadBytesPerSecond > 0)
+
+	// nothing is left behind
+	names, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, names)
+}
+
+func TestVerifyDiskNotMounted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	report := verifyDisk(dir, true, 0)
+	require.False(t, report.Passed())
+	require.Equal(t, 1, len(report.Checks))
+	require.Equal(t, "mount", report.Checks[0].Name)
+
+	report = verifyDisk(filepath.Join(dir, "missing"), false, 0)
+	require.False(t, report.Passed())
+	require.Equal(t, "mkdir", report.Checks[0].Name)
+}
+
+func TestVerifyDiskReadMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "f")
+	require.Nil(t, diskVerifyWrite(path, []byte("hello")))
+	require.Nil(t, diskVerifyRead(path, []byte("hello")))
+	require.NotNil(t, diskVerifyRead(path, []byte("jello")))
+	require.NotNil(t, diskVerifyWrite(path, []byte("again")))
+}
@@ -155,6 +155,9 @@ func (c *testDispersionClient) SetContainerInfo(ctx context.Context, account str
 	return nil, nil
 }
 
+func (c *testDispersionClient) InvalidateContainerInfo(ctx context.Context, account string, container string) {
+}
+
 func (c *testDispersionClient) HeadContainer(ctx context.Context, account string, container string, headers http.Header) *http.Response {
 	return nectarutil.ResponseStub(200, "")
 }
@@ -0,0 +1,371 @@
+package tools
+
+// In /etc/hummingbird/andrewd-server.conf:
+// [object-expirer]
+// interval = 300           # seconds between the starts of passes
+// concurrency = 4          # deletes to have in flight at once
+// processes = 0            # expirers sharing the queue; 0 or 1 means just this one
+// process = 0              # which of those expirers this one is, 0 to processes-1
+// report_interval = 600    # seconds between progress reports
+//
+// The object servers queue a task for each object with an X-Delete-At in
+// the .expiring_objects account, bucketed into a task container per hour
+// (expiring_objects_container_divisor).  Every expirer walks the same task
+// containers but only acts on the tasks that hash to its process number, so
+// expiration can be spread over as many andrewds as a cluster needs.
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/troubling/hummingbird/accountserver"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/containerserver"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const expiringObjectsAccount = ".expiring_objects"
+
+type expirer struct {
+	aa             *AutoAdmin
+	interval       time.Duration
+	concurrency    int
+	processes      int
+	process        int
+	reportInterval time.Duration
+	passesMetric   tally.Timer
+	expiredMetric  tally.Counter
+	skippedMetric  tally.Counter
+	errorsMetric   tally.Counter
+}
+
+type expirerTask struct {
+	container string
+	name      string
+	deleteAt  int64
+	account   string
+	cont      string
+	obj       string
+}
+
+func newExpirer(aa *AutoAdmin) *expirer {
+	e := &expirer{
+		aa:             aa,
+		interval:       time.Duration(aa.serverconf.GetInt("object-expirer", "interval", 300)) * time.Second,
+		concurrency:    int(aa.serverconf.GetInt("object-expirer", "concurrency", 4)),
+		processes:      int(aa.serverconf.GetInt("object-expirer", "processes", 0)),
+		process:        int(aa.serverconf.GetInt("object-expirer", "process", 0)),
+		reportInterval: time.Duration(aa.serverconf.GetInt("object-expirer", "report_interval", 600)) * time.Second,
+		passesMetric:   aa.metricsScope.Timer("expirer_passes"),
+		expiredMetric:  aa.metricsScope.Counter("expirer_objects_expired"),
+		skippedMetric:  aa.metricsScope.Counter("expirer_objects_skipped"),
+		errorsMetric:   aa.metricsScope.Counter("expirer_errors"),
+	}
+	if e.interval < time.Second {
+		e.interval = time.Second
+	}
+	if e.concurrency < 1 {
+		e.concurrency = 1
+	}
+	if e.processes < 1 {
+		e.processes = 1
+	}
+	if e.process < 0 || e.process >= e.processes {
+		aa.logger.Error("object-expirer process out of range; using 0", zap.Int("process", e.process), zap.Int("processes", e.processes))
+		e.process = 0
+	}
+	return e
+}
+
+// parseExpirerTask splits a task name, "<delete-at>-<account>/<container>/<obj>".
+func parseExpirerTask(container, name string) (*expirerTask, error) {
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("no delete-at in task %q", name)
+	}
+	// Python Swift's expirer accepts task names with a full timestamp, like
+	// "1434707411.00000-a/c/o", so those are taken too.
+	deleteAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(parts[0], 64)
+		if ferr != nil {
+			return nil, fmt.Errorf("bad delete-at in task %q: %s", name, err)
+		}
+		deleteAt = int64(f)
+	}
+	path := strings.SplitN(parts[1], "/", 3)
+	if len(path) != 3 || path[0] == "" || path[1] == "" || path[2] == "" {
+		return nil, fmt.Errorf("bad object path in task %q", name)
+	}
+	return &expirerTask{container: container, name: name, deleteAt: deleteAt, account: path[0], cont: path[1], obj: path[2]}, nil
+}
+
+// expirerTaskProcess returns which of the processes owns the task.
+func expirerTaskProcess(task *expirerTask, processes int) int {
+	if processes <= 1 {
+		return 0
+	}
+	sum := md5.Sum([]byte(task.account + "/" + task.cont + "/" + task.obj))
+	i := new(big.Int).SetBytes(sum[:])
+	return int(i.Mod(i, big.NewInt(int64(processes))).Int64())
+}
+
+func (e *expirer) runForever() {
+	for {
+		sleepFor := e.runOnce()
+		if sleepFor < 0 {
+			break
+		}
+		time.Sleep(sleepFor)
+	}
+}
+
+func (e *expirer) runOnce() time.Duration {
+	defer e.passesMetric.Start().Stop()
+	start := time.Now()
+	now := start.Unix()
+	logger := e.aa.logger.With(zap.String("process", "object expirer"))
+	logger.Debug("starting pass")
+	if err := e.aa.db.startProcessPass("object expirer", "", 0); err != nil {
+		logger.Error("startProcessPass", zap.Error(err))
+	}
+	var expired, skipped, errored int64
+	tasks := make(chan *expirerTask, e.concurrency)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < e.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if e.expire(logger, task) {
+					atomic.AddInt64(&expired, 1)
+				} else {
+					atomic.AddInt64(&errored, 1)
+				}
+			}
+		}()
+	}
+	cancel := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-cancel:
+				close(progressDone)
+				return
+			case <-time.After(e.reportInterval):
+				if err := e.aa.db.progressProcessPass("object expirer", "", 0, fmt.Sprintf("%d expired, %d skipped for other processes, %d errors", atomic.LoadInt64(&expired), atomic.LoadInt64(&skipped), atomic.LoadInt64(&errored))); err != nil {
+					logger.Error("progressProcessPass", zap.Error(err))
+				}
+			}
+		}
+	}()
+	var finished []string
+	for _, container := range e.dueContainers(logger, now) {
+		done, s := e.queueTasks(logger, container, now, tasks)
+		atomic.AddInt64(&skipped, s)
+		if done {
+			finished = append(finished, container)
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	for _, container := range finished {
+		e.removeContainer(logger, container)
+	}
+	close(cancel)
+	<-progressDone
+	e.expiredMetric.Inc(expired)
+	e.skippedMetric.Inc(skipped)
+	e.errorsMetric.Inc(errored)
+	status := fmt.Sprintf("%d expired, %d skipped for other processes, %d errors", expired, skipped, errored)
+	if err := e.aa.db.progressProcessPass("object expirer", "", 0, status); err != nil {
+		logger.Error("progressProcessPass", zap.Error(err))
+	}
+	if err := e.aa.db.completeProcessPass("object expirer", "", 0); err != nil {
+		logger.Error("completeProcessPass", zap.Error(err))
+	}
+	logger.Debug("pass complete", zap.Int64("expired", expired), zap.Int64("skipped", skipped), zap.Int64("errors", errored))
+	return time.Until(start.Add(e.interval))
+}
+
+// dueContainers lists the task containers whose hour has begun; the rest
+// can't hold anything due yet.
+func (e *expirer) dueContainers(logger *zap.Logger, now int64) []string {
+	var containers []string
+	marker := ""
+	for {
+		resp := e.aa.hClient.GetAccountRaw(context.Background(), expiringObjectsAccount, map[string]string{
+			"format": "json",
+			"marker": marker,
+		}, http.Header{})
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return containers
+		}
+		if resp.StatusCode/100 != 2 {
+			logger.Error("GET", zap.String("account", expiringObjectsAccount), zap.String("marker", marker), zap.Int("status", resp.StatusCode))
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			return containers
+		}
+		var clrs []*accountserver.ContainerListingRecord
+		err := json.NewDecoder(resp.Body).Decode(&clrs)
+		resp.Body.Close()
+		if err != nil {
+			logger.Error("GET got bad JSON", zap.String("account", expiringObjectsAccount), zap.String("marker", marker), zap.Error(err))
+			return containers
+		}
+		if len(clrs) == 0 {
+			return containers
+		}
+		for _, clr := range clrs {
+			timestamp, err := strconv.ParseInt(clr.Name, 10, 64)
+			if err != nil {
+				logger.Debug("odd task container name", zap.String("container", clr.Name))
+				continue
+			}
+			if timestamp > now {
+				// Task containers are named with zero-padded timestamps, so
+				// every one after this is in the future too.
+				return containers
+			}
+			containers = append(containers, clr.Name)
+		}
+		marker = clrs[len(clrs)-1].Name
+	}
+}
+
+// queueTasks sends this process's due tasks from the container to the
+// workers.  It returns whether every task in the container was due, which
+// means it should be empty once all the expirers are done with it, and how
+// many tasks were left to other processes.
+func (e *expirer) queueTasks(logger *zap.Logger, container string, now int64, tasks chan *expirerTask) (bool, int64) {
+	var skipped int64
+	marker := ""
+	for {
+		resp := e.aa.hClient.GetContainerRaw(context.Background(), expiringObjectsAccount, container, map[string]string{
+			"format": "json",
+			"marker": marker,
+		}, http.Header{})
+		if resp.StatusCode/100 != 2 {
+			logger.Error("GET", zap.String("container", container), zap.String("marker", marker), zap.Int("status", resp.StatusCode))
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			return false, skipped
+		}
+		var olrs []*containerserver.ObjectListingRecord
+		err := json.NewDecoder(resp.Body).Decode(&olrs)
+		resp.Body.Close()
+		if err != nil {
+			logger.Error("GET got bad JSON", zap.String("container", container), zap.String("marker", marker), zap.Error(err))
+			return false, skipped
+		}
+		if len(olrs) == 0 {
+			return true, skipped
+		}
+		for _, olr := range olrs {
+			task, err := parseExpirerTask(container, olr.Name)
+			if err != nil {
+				logger.Debug("odd task", zap.String("container", container), zap.Error(err))
+				continue
+			}
+			if task.deleteAt > now {
+				// The delete-at prefixes are all ten digits, so the listing
+				// is in time order and nothing else here is due.
+				return false, skipped
+			}
+			if expirerTaskProcess(task, e.processes) != e.process {
+				skipped++
+				continue
+			}
+			tasks <- task
+		}
+		marker = olrs[len(olrs)-1].Name
+	}
+}
+
+// expire deletes the object, as long as its X-Delete-At still matches the
+// task, and then removes the task.
+func (e *expirer) expire(logger *zap.Logger, task *expirerTask) bool {
+	deleteAt := strconv.FormatInt(task.deleteAt, 10)
+	resp := e.aa.hClient.DeleteObject(context.Background(), task.account, task.cont, task.obj, http.Header{
+		"X-If-Delete-At": {deleteAt},
+		"X-Timestamp":    {common.CanonicalTimestamp(float64(task.deleteAt))},
+		// The task is removed below, so the object servers needn't queue
+		// its removal too.
+		"X-Backend-Clean-Expiring-Object-Queue": {"no"},
+	})
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusConflict:
+		// Already gone, given a new X-Delete-At, or overwritten since.
+	default:
+		logger.Error("DELETE", zap.String("object", task.account+"/"+task.cont+"/"+task.obj), zap.Int("status", resp.StatusCode))
+		return false
+	}
+	return e.removeTask(logger, task.container, task.name)
+}
+
+// removeTask deletes the task's listing straight from the container servers;
+// there's no object behind it to delete.
+func (e *expirer) removeTask(logger *zap.Logger, container, name string) bool {
+	containerRing := e.aa.hClient.ContainerRing()
+	partition := containerRing.GetPartition(expiringObjectsAccount, container, "")
+	nodes := containerRing.GetNodes(partition)
+	timestamp := common.GetTimestamp()
+	successes := 0
+	for _, node := range nodes {
+		url := fmt.Sprintf("%s://%s:%d/%s/%d/%s/%s/%s", node.Scheme, node.Ip, node.Port, node.Device, partition,
+			common.Urlencode(expiringObjectsAccount), common.Urlencode(container), common.Urlencode(name))
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			logger.Error("http.NewRequest", zap.String("url", url), zap.Error(err))
+			continue
+		}
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Backend-Storage-Policy-Index", "0")
+		req.Header.Set("User-Agent", "Andrewd")
+		resp, err := e.aa.client.Do(req)
+		if err != nil {
+			logger.Error("DELETE", zap.String("url", url), zap.Error(err))
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusNotFound {
+			successes++
+		}
+	}
+	if successes < len(nodes)/2+1 {
+		logger.Error("could not remove task", zap.String("container", container), zap.String("task", name), zap.Int("successes", successes))
+		return false
+	}
+	return true
+}
+
+// removeContainer deletes a task container that should now be empty.  Until
+// every process has worked through its share it won't be, which the
+// container servers answer with a 409; a later pass will get it.
+func (e *expirer) removeContainer(logger *zap.Logger, container string) {
+	resp := e.aa.hClient.DeleteContainer(context.Background(), expiringObjectsAccount, container, http.Header{})
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusConflict {
+		logger.Error("DELETE", zap.String("container", container), zap.Int("status", resp.StatusCode))
+	}
+}
@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpirerTask(t *testing.T) {
+	task, err := parseExpirerTask("1434704400", "1434707411-a/c/o/with/slashes")
+	require.Nil(t, err)
+	require.Equal(t, "1434704400", task.container)
+	require.Equal(t, "1434707411-a/c/o/with/slashes", task.name)
+	require.Equal(t, int64(1434707411), task.deleteAt)
+	require.Equal(t, "a", task.account)
+	require.Equal(t, "c", task.cont)
+	require.Equal(t, "o/with/slashes", task.obj)
+
+	task, err = parseExpirerTask("1434704400", "1434707411.00000-a/c/o")
+	require.Nil(t, err)
+	require.Equal(t, int64(1434707411), task.deleteAt)
+	require.Equal(t, "o", task.obj)
+
+	for _, name := range []string{"a/c/o", "x-a/c/o", "1434707411-a/c", "1434707411-a//o", "1434707411-a/c/"} {
+		_, err = parseExpirerTask("1434704400", name)
+		require.NotNil(t, err, name)
+	}
+}
+
+func TestExpirerTaskProcess(t *testing.T) {
+	counts := make([]int, 3)
+	for i := 0; i < 300; i++ {
+		task, err := parseExpirerTask("0", "1434707411-a/c/o"+string(rune('a'+i%26))+string(rune('a'+i/26)))
+		require.Nil(t, err)
+		require.Equal(t, 0, expirerTaskProcess(task, 0))
+		require.Equal(t, 0, expirerTaskProcess(task, 1))
+		p := expirerTaskProcess(task, 3)
+		require.True(t, p >= 0 && p < 3)
+		require.Equal(t, p, expirerTaskProcess(task, 3))
+		counts[p]++
+	}
+	for _, count := range counts {
+		require.True(t, count > 50, "%v", counts)
+	}
+}
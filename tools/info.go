@@ -0,0 +1,265 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/recon"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+)
+
+// infoIgnoredHeaders differ from one response to the next whatever the
+// state of the replica, so they're left out of the comparison.
+var infoIgnoredHeaders = map[string]bool{
+	"Accept-Ranges":          true,
+	"Connection":             true,
+	"Date":                   true,
+	"X-Openstack-Request-Id": true,
+	"X-Trans-Id":             true,
+}
+
+// replicaInfo is what a backend server said about its replica of an item.
+type replicaInfo struct {
+	dev     *ring.Device
+	handoff bool
+	status  int
+	err     error
+	header  http.Header
+}
+
+func (r *replicaInfo) String() string {
+	return fmt.Sprintf("%s:%d %s", r.dev.Ip, r.dev.Port, r.dev.Device)
+}
+
+// timestamp returns the replica's timestamp, including a tombstone's.
+func (r *replicaInfo) timestamp() string {
+	if r.header == nil {
+		return ""
+	}
+	if ts := r.header.Get("X-Backend-Timestamp"); ts != "" {
+		return ts
+	}
+	return r.header.Get("X-Timestamp")
+}
+
+// headReplicas HEADs target on each of devs at once.
+func headReplicas(client common.HTTPClient, devs []*ring.Device, handoffs int, partition uint64, target string, policy int) []*replicaInfo {
+	replicas := make([]*replicaInfo, len(devs))
+	wg := sync.WaitGroup{}
+	for i, dev := range devs {
+		replicas[i] = &replicaInfo{dev: dev, handoff: i >= len(devs)-handoffs}
+		wg.Add(1)
+		go func(r *replicaInfo) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s://%s/%s/%d/%s", r.dev.Scheme, net.JoinHostPort(r.dev.Ip, strconv.Itoa(r.dev.Port)), r.dev.Device, partition, common.Urlencode(target))
+			req, err := http.NewRequest("HEAD", url, nil)
+			if err != nil {
+				r.err = err
+				return
+			}
+			req.Header.Set("X-Backend-Storage-Policy-Index", strconv.Itoa(policy))
+			resp, err := client.Do(req)
+			if err != nil {
+				r.err = err
+				return
+			}
+			resp.Body.Close()
+			r.status = resp.StatusCode
+			r.header = resp.Header
+		}(replicas[i])
+	}
+	wg.Wait()
+	return replicas
+}
+
+// replicaDiffs returns the replica with the newest timestamp and, for each
+// other replica, how its headers differ from that one's, or just its status
+// if that differs.  Replicas that couldn't be reached aren't compared.
+func replicaDiffs(replicas []*replicaInfo) (*replicaInfo, map[*replicaInfo][]string) {
+	var newest *replicaInfo
+	for _, r := range replicas {
+		if r.header != nil && (newest == nil || r.timestamp() > newest.timestamp()) {
+			newest = r
+		}
+	}
+	diffs := map[*replicaInfo][]string{}
+	if newest == nil {
+		return nil, diffs
+	}
+	for _, r := range replicas {
+		if r == newest || r.header == nil {
+			continue
+		}
+		if r.status != newest.status {
+			diffs[r] = append(diffs[r], fmt.Sprintf("status %d, newest has %d", r.status, newest.status))
+			continue
+		}
+		names := map[string]bool{}
+		for k := range r.header {
+			names[k] = true
+		}
+		for k := range newest.header {
+			names[k] = true
+		}
+		var sorted []string
+		for k := range names {
+			if !infoIgnoredHeaders[k] {
+				sorted = append(sorted, k)
+			}
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			if v, nv := r.header.Get(k), newest.header.Get(k); v != nv {
+				diffs[r] = append(diffs[r], fmt.Sprintf("%s: %q, newest has %q", k, v, nv))
+			}
+		}
+	}
+	return newest, diffs
+}
+
+// containerPolicy returns the storage policy of the container, from the
+// first of its primaries that knows.
+func containerPolicy(client common.HTTPClient, account, container string) (int, error) {
+	r, _ := getRing("", "container", 0)
+	partition := r.GetPartition(account, container, "")
+	for _, rep := range headReplicas(client, r.GetNodes(partition), 0, partition, account+"/"+container, 0) {
+		if rep.status/100 == 2 {
+			return strconv.Atoi(rep.header.Get("X-Backend-Storage-Policy-Index"))
+		}
+	}
+	return 0, fmt.Errorf("Unable to find container %s/%s", account, container)
+}
+
+// Info HEADs an account, container or object on its primaries and as many
+// handoffs, or all handoffs with -a, and reports each replica's status,
+// timestamp, etag and size and how its headers differ from the newest
+// replica's.  It returns false if any primary is missing the item or
+// disagrees with the newest replica.
+func Info(flags *flag.FlagSet, cnf srv.ConfigLoader) bool {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return false
+	}
+	account, container, object := parseArg0(flags.Arg(0))
+	if account == "" {
+		fmt.Println("No account specified")
+		return false
+	}
+	allHandoffs := flags.Lookup("a").Value.(flag.Getter).Get().(bool)
+	certFile := flags.Lookup("certfile").Value.(flag.Getter).Get().(string)
+	keyFile := flags.Lookup("keyfile").Value.(flag.Getter).Get().(string)
+	client, err := recon.HTTPClient(certFile, keyFile)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		fmt.Println("Unable to load policies:", err)
+		return false
+	}
+	policyIndex := 0
+	if object != "" {
+		if policyName := flags.Lookup("P").Value.(flag.Getter).Get().(string); policyName != "" {
+			policyIndex = policyByName(policyName, policies).Index
+		} else if policyIndex, err = containerPolicy(client, account, container); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	ringType := inferRingType(account, container, object)
+	r, _ := getRing("", ringType, policyIndex)
+	target := account
+	if container != "" {
+		target += "/" + container
+		if object != "" {
+			target += "/" + object
+		}
+	}
+	partition := r.GetPartition(account, container, object)
+	devs := r.GetNodes(partition)
+	primaries := len(devs)
+	more := r.GetMoreNodes(partition)
+	for dev := more.Next(); dev != nil && (allHandoffs || len(devs) < 2*primaries); dev = more.Next() {
+		devs = append(devs, dev)
+	}
+	replicas := headReplicas(client, devs, len(devs)-primaries, partition, target, policyIndex)
+
+	fmt.Printf("Path     \t/v1/%s\n", target)
+	fmt.Printf("Partition\t%d\n", partition)
+	if ringType == "object" {
+		if policy := policies[policyIndex]; policy != nil {
+			fmt.Printf("Policy   \t%d (%s)\n", policyIndex, policy.Name)
+		} else {
+			fmt.Printf("Policy   \t%d\n", policyIndex)
+		}
+	}
+	fmt.Println()
+	for _, rep := range replicas {
+		kind := "Primary"
+		if rep.handoff {
+			kind = "Handoff"
+		}
+		if rep.err != nil {
+			fmt.Printf("[%s] %s\terror: %v\n", kind, rep, rep.err)
+			continue
+		}
+		line := fmt.Sprintf("[%s] %s\t%d", kind, rep, rep.status)
+		if ts := rep.timestamp(); ts != "" {
+			line += "\ttimestamp=" + ts
+		}
+		if etag := rep.header.Get("Etag"); etag != "" {
+			line += "\tetag=" + strings.Trim(etag, "\"")
+		}
+		if ringType == "object" && rep.status/100 == 2 {
+			line += "\tsize=" + rep.header.Get("Content-Length")
+		}
+		fmt.Println(line)
+	}
+	pass := true
+	for _, rep := range replicas[:primaries] {
+		if rep.status/100 != 2 {
+			pass = false
+		}
+	}
+	newest, diffs := replicaDiffs(replicas)
+	if newest == nil {
+		fmt.Println("\nNo replicas could be reached")
+		return false
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("\nDifferences from the newest replica, %s:\n", newest)
+		for _, rep := range replicas {
+			for _, diff := range diffs[rep] {
+				fmt.Printf("  %s\t%s\n", rep, diff)
+				if !rep.handoff {
+					pass = false
+				}
+			}
+		}
+	}
+	return pass
+}
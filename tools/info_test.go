@@ -0,0 +1,77 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/ring"
+)
+
+func TestHeadReplicasAndDiffs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "HEAD", r.Method)
+		require.Equal(t, "2", r.Header.Get("X-Backend-Storage-Policy-Index"))
+		switch r.URL.Path {
+		case "/sda/12/a/c/o":
+			w.Header().Set("X-Timestamp", "1500000002.00000")
+			w.Header().Set("Etag", "abc")
+			w.Header().Set("X-Object-Meta-Color", "blue")
+			w.Header().Set("Date", "now")
+			w.WriteHeader(200)
+		case "/sdb/12/a/c/o":
+			w.Header().Set("X-Timestamp", "1500000001.00000")
+			w.Header().Set("Etag", "abc")
+			w.Header().Set("X-Object-Meta-Color", "red")
+			w.Header().Set("Date", "then")
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	host, ports, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(ports)
+	devs := []*ring.Device{
+		{Scheme: "http", Ip: host, Port: port, Device: "sda"},
+		{Scheme: "http", Ip: host, Port: port, Device: "sdb"},
+		{Scheme: "http", Ip: host, Port: port, Device: "sdc"},
+	}
+	replicas := headReplicas(&http.Client{Timeout: 10 * time.Second}, devs, 1, 12, "a/c/o", 2)
+	require.Equal(t, 3, len(replicas))
+	require.Equal(t, 200, replicas[0].status)
+	require.False(t, replicas[1].handoff)
+	require.True(t, replicas[2].handoff)
+	require.Equal(t, 404, replicas[2].status)
+	require.Equal(t, "1500000001.00000", replicas[1].timestamp())
+
+	newest, diffs := replicaDiffs(replicas)
+	require.True(t, newest == replicas[0])
+	require.Nil(t, diffs[newest])
+	require.Equal(t, []string{
+		`X-Object-Meta-Color: "red", newest has "blue"`,
+		`X-Timestamp: "1500000001.00000", newest has "1500000002.00000"`,
+	}, diffs[replicas[1]])
+	require.Equal(t, []string{"status 404, newest has 200"}, diffs[replicas[2]])
+}
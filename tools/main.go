@@ -694,6 +694,7 @@ func (a *AutoAdmin) RunForever() {
 	go newDispersionPopulateObjects(a).runForever()
 	go newDispersionScanContainers(a).runForever()
 	go newDispersionScanObjects(a).runForever()
+	go newExpirer(a).runForever()
 	go newQuarantineHistory(a).runForever()
 	go newQuarantineRepair(a).runForever()
 	go newUnmountedMonitor(a).runForever()
@@ -0,0 +1,257 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/recon"
+	"github.com/troubling/hummingbird/common/ring"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/middleware"
+)
+
+// getNodeServers returns the account, container and object servers in the
+// rings at ip, and only the one at port if it isn't 0.
+func getNodeServers(ip string, port int) ([]*recon.Server, []string) {
+	var errors []string
+	serversMap := map[string]*recon.Server{}
+	prefix, suffix := getAffixes()
+	fn := func(r ring.Ring) {
+		for _, dev := range r.AllDevices() {
+			if dev == nil || dev.Ip != ip || (port != 0 && dev.Port != port) {
+				continue
+			}
+			serversMap[recon.ServerID(dev.Ip, dev.Port)] = &recon.Server{IP: dev.Ip, Port: dev.Port, Scheme: dev.Scheme, ReplicationPort: dev.ReplicationPort}
+		}
+	}
+	if r, err := ring.GetRing("account", prefix, suffix, 0); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		fn(r)
+	}
+	if r, err := ring.GetRing("container", prefix, suffix, 0); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		fn(r)
+	}
+	if policies, err := conf.GetPolicies(); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		for _, policy := range policies {
+			if r, err := ring.GetRing("object", prefix, suffix, policy.Index); err != nil {
+				errors = append(errors, err.Error())
+			} else {
+				fn(r)
+			}
+		}
+	}
+	var servers []*recon.Server
+	for _, server := range serversMap {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Port < servers[j].Port })
+	return servers, errors
+}
+
+// setServerMaintenance sends method to the server's /maintenance and returns
+// the state it answers with.
+func setServerMaintenance(client common.HTTPClient, s *recon.Server, method, reason string) (*middleware.MaintenanceState, error) {
+	serverUrl := fmt.Sprintf("%s://%s:%d/maintenance", s.Scheme, s.IP, s.Port)
+	if reason != "" {
+		serverUrl += "?reason=" + url.QueryEscape(reason)
+	}
+	req, err := http.NewRequest(method, serverUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%d %s", resp.StatusCode, string(data))
+	}
+	state := &middleware.MaintenanceState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%s - %q", err, string(data))
+	}
+	return state, nil
+}
+
+func maintenanceLine(s *recon.Server, state *middleware.MaintenanceState) string {
+	if !state.Maintenance {
+		return fmt.Sprintf("%s:%d not in maintenance", s.IP, s.Port)
+	}
+	line := fmt.Sprintf("%s:%d in maintenance", s.IP, s.Port)
+	if state.Since != nil {
+		line += " since " + state.Since.Format("2006-01-02 15:04:05")
+	}
+	if state.Reason != "" {
+		line += ": " + state.Reason
+	}
+	return line
+}
+
+// Maintenance puts a node in maintenance, takes it out, or shows whether it
+// is.  The flag is kept on the node itself and reported by its servers'
+// health checks, so proxies doing health checks read from it last and write
+// to handoffs instead, and other nodes' replicators are turned away, all
+// without changing the rings.
+func Maintenance(flags *flag.FlagSet, cnf srv.ConfigLoader) bool {
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return false
+	}
+	var method string
+	switch flags.Arg(0) {
+	case "enable":
+		method = "PUT"
+	case "disable":
+		method = "DELETE"
+	case "status":
+		method = "GET"
+	default:
+		flags.Usage()
+		return false
+	}
+	ip, port := flags.Arg(1), 0
+	if host, portStr, err := net.SplitHostPort(ip); err == nil {
+		if port, err = strconv.Atoi(portStr); err != nil {
+			fmt.Printf("Invalid port in %q\n", flags.Arg(1))
+			return false
+		}
+		ip = host
+	}
+	servers, errors := getNodeServers(ip, port)
+	for _, e := range errors {
+		fmt.Printf("!! %s\n", e)
+	}
+	if len(servers) == 0 {
+		fmt.Printf("No servers found at %s in the rings\n", flags.Arg(1))
+		return false
+	}
+	certFile := flags.Lookup("certfile").Value.(flag.Getter).Get().(string)
+	keyFile := flags.Lookup("keyfile").Value.(flag.Getter).Get().(string)
+	client, err := recon.HTTPClient(certFile, keyFile)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	reason := flags.Lookup("reason").Value.(flag.Getter).Get().(string)
+	pass := true
+	for _, server := range servers {
+		state, err := setServerMaintenance(client, server, method, reason)
+		if err != nil {
+			fmt.Printf("!! %s: %s\n", server, err)
+			pass = false
+			continue
+		}
+		fmt.Println(maintenanceLine(server, state))
+	}
+	return pass
+}
+
+type maintenanceReport struct {
+	Name      string
+	Time      time.Time
+	Pass      bool
+	Servers   int
+	Successes int
+	Errors    []string
+	Nodes     map[string]*middleware.MaintenanceState
+}
+
+func (r *maintenanceReport) Passed() bool {
+	return r.Pass
+}
+
+func (r *maintenanceReport) String() string {
+	s := fmt.Sprintf(
+		"[%s] %s\n",
+		r.Time.Format("2006-01-02 15:04:05"),
+		r.Name,
+	)
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("!! %s\n", e)
+	}
+	var ips []string
+	for ip := range r.Nodes {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		state := r.Nodes[ip]
+		s += ip + " in maintenance"
+		if state.Since != nil {
+			s += " since " + state.Since.Format("2006-01-02 15:04:05")
+		}
+		if state.Reason != "" {
+			s += ": " + state.Reason
+		}
+		s += "\n"
+	}
+	s += fmt.Sprintf("%d/%d hosts in maintenance, %d error[s] while checking hosts.\n", len(r.Nodes), r.Servers, len(r.Errors))
+	return s
+}
+
+func getMaintenanceReport(client common.HTTPClient, servers []*recon.Server) *maintenanceReport {
+	// servers parameter is for overriding for tests, leave nil normally
+	report := &maintenanceReport{
+		Name:    "Maintenance Report",
+		Time:    time.Now().UTC(),
+		Servers: len(servers),
+		Nodes:   map[string]*middleware.MaintenanceState{},
+	}
+	if servers == nil {
+		servers, report.Errors = recon.DistinctIPServers(report.Errors)
+		report.Servers = len(servers)
+	}
+	for _, server := range servers {
+		rBytes, err := recon.QueryHostRecon(client, server, "maintenance")
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		state := &middleware.MaintenanceState{}
+		if err := json.Unmarshal(rBytes, state); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s - %q", server, err, string(rBytes)))
+			continue
+		}
+		if state.Maintenance {
+			report.Nodes[server.IP] = state
+		}
+		report.Successes++
+	}
+	report.Pass = report.Successes == report.Servers
+	return report
+}
@@ -0,0 +1,72 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/recon"
+	"github.com/troubling/hummingbird/middleware"
+)
+
+func TestMaintenanceSetAndReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/recon/maintenance" {
+			r.Method = "GET"
+		} else {
+			require.Equal(t, "/maintenance", r.URL.Path)
+		}
+		middleware.MaintenanceHandler(dir, w, r)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	host, ports, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(ports)
+	server := &recon.Server{IP: host, Port: port, Scheme: "http"}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	report := getMaintenanceReport(client, []*recon.Server{server})
+	require.True(t, report.Passed())
+	require.Equal(t, 0, len(report.Nodes))
+
+	state, err := setServerMaintenance(client, server, "PUT", "swapping disks")
+	require.Nil(t, err)
+	require.True(t, state.Maintenance)
+	require.True(t, strings.HasSuffix(maintenanceLine(server, state), ": swapping disks"))
+
+	report = getMaintenanceReport(client, []*recon.Server{server})
+	require.True(t, report.Passed())
+	require.Equal(t, "swapping disks", report.Nodes[host].Reason)
+	require.True(t, strings.Contains(report.String(), "1/1 hosts in maintenance"))
+
+	state, err = setServerMaintenance(client, server, "DELETE", "")
+	require.Nil(t, err)
+	require.False(t, state.Maintenance)
+	require.True(t, strings.HasSuffix(maintenanceLine(server, state), "not in maintenance"))
+}
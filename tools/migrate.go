@@ -0,0 +1,572 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/nectar"
+	"go.uber.org/zap"
+)
+
+const migrateListingLimit = 10000
+
+// migrateCopyHeaders are the object headers, besides X-Object-Meta-*, that
+// are kept when an object is migrated.
+var migrateCopyHeaders = []string{"Content-Type", "Content-Encoding", "Content-Disposition", "X-Delete-At", "X-Object-Manifest", "X-Static-Large-Object"}
+
+// migrateCheckpoint records how far a migration has got, so an interrupted
+// one can be run again without recopying everything.  Markers hold the last
+// object of the last whole listing page copied for each container.
+type migrateCheckpoint struct {
+	path    string
+	lock    sync.Mutex
+	Done    map[string]bool   `json:"done"`
+	Markers map[string]string `json:"markers"`
+}
+
+func loadMigrateCheckpoint(path string) (*migrateCheckpoint, error) {
+	cp := &migrateCheckpoint{path: path}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			if err = json.Unmarshal(data, cp); err != nil {
+				return nil, fmt.Errorf("Invalid checkpoint file %s: %v", path, err)
+			}
+		}
+	}
+	if cp.Done == nil {
+		cp.Done = map[string]bool{}
+	}
+	if cp.Markers == nil {
+		cp.Markers = map[string]string{}
+	}
+	return cp, nil
+}
+
+func (cp *migrateCheckpoint) marker(container string) (string, bool) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	return cp.Markers[container], cp.Done[container]
+}
+
+func (cp *migrateCheckpoint) update(container, marker string, done bool) error {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	if done {
+		cp.Done[container] = true
+		delete(cp.Markers, container)
+	} else {
+		cp.Markers[container] = marker
+	}
+	if cp.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(cp.path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(cp.path+".tmp", cp.path)
+}
+
+// objectLister returns the page of a container's listing following marker.
+type objectLister func(container, marker string) ([]*nectar.ObjectRecord, error)
+
+func clientLister(c nectar.Client) objectLister {
+	return func(container, marker string) ([]*nectar.ObjectRecord, error) {
+		objs, resp := c.GetContainer(container, marker, "", migrateListingLimit, "", "", false, nil)
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, nil
+		} else if resp.StatusCode/100 != 2 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Error listing container %s: %d", container, resp.StatusCode)
+		}
+		return objs, nil
+	}
+}
+
+// migrateDiff is how a destination container differs from its source.
+type migrateDiff struct {
+	Container string   `json:"container"`
+	Objects   int64    `json:"objects"`
+	Missing   []string `json:"missing"`
+	Mismatch  []string `json:"mismatch"`
+	Extra     []string `json:"extra"`
+}
+
+func (d *migrateDiff) matches() bool {
+	return len(d.Missing) == 0 && len(d.Mismatch) == 0 && len(d.Extra) == 0
+}
+
+// listingIter walks a whole container listing a page at a time.
+type listingIter struct {
+	list      objectLister
+	container string
+	page      []*nectar.ObjectRecord
+	marker    string
+	done      bool
+}
+
+func (li *listingIter) peek() (*nectar.ObjectRecord, error) {
+	if len(li.page) == 0 && !li.done {
+		var err error
+		if li.page, err = li.list(li.container, li.marker); err != nil {
+			return nil, err
+		}
+		li.done = len(li.page) < migrateListingLimit
+	}
+	if len(li.page) == 0 {
+		return nil, nil
+	}
+	return li.page[0], nil
+}
+
+func (li *listingIter) next() {
+	li.marker = li.page[0].Name
+	li.page = li.page[1:]
+}
+
+// diffContainer compares the listings of a source and destination
+// container, which are both in name order, without holding either in memory.
+func diffContainer(srcList, dstList objectLister, srcContainer, dstContainer string) (*migrateDiff, error) {
+	diff := &migrateDiff{Container: srcContainer, Missing: []string{}, Mismatch: []string{}, Extra: []string{}}
+	src := &listingIter{list: srcList, container: srcContainer}
+	dst := &listingIter{list: dstList, container: dstContainer}
+	for {
+		s, err := src.peek()
+		if err != nil {
+			return nil, err
+		}
+		d, err := dst.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case s == nil && d == nil:
+			return diff, nil
+		case d == nil || (s != nil && s.Name < d.Name):
+			diff.Objects++
+			diff.Missing = append(diff.Missing, s.Name)
+			src.next()
+		case s == nil || d.Name < s.Name:
+			diff.Extra = append(diff.Extra, d.Name)
+			dst.next()
+		default:
+			diff.Objects++
+			if s.Hash != d.Hash || s.Bytes != d.Bytes {
+				diff.Mismatch = append(diff.Mismatch, s.Name)
+			}
+			src.next()
+			dst.next()
+		}
+	}
+}
+
+type migrator struct {
+	src          nectar.Client
+	dst          nectar.Client
+	srcRemote    bool
+	suffix       string
+	policy       string
+	concurrency  int
+	checkpoint   *migrateCheckpoint
+	copied       int64
+	skipped      int64
+	failed       int64
+	copiedBytes  int64
+	reportErrors func(string)
+}
+
+func (m *migrator) getSource(container, obj string) *http.Response {
+	if m.srcRemote {
+		// Manifests are copied as manifests, not as the objects they describe.
+		return m.src.Raw("GET", common.Urlencode("/"+container+"/"+obj)+"?multipart-manifest=get", nil, nil)
+	}
+	return m.src.GetObject(container, obj, nil)
+}
+
+// sloSysmeta sets the sysmeta a static large object manifest is served with,
+// which the destination's object servers are given directly.  A local source
+// returns it with the manifest; a remote one reports the same values as the
+// etag and length of the large object.
+func (m *migrator) sloSysmeta(container, obj string, srcHeader http.Header, headers map[string]string) error {
+	if !m.srcRemote {
+		for _, h := range []string{"X-Object-Sysmeta-Slo-Etag", "X-Object-Sysmeta-Slo-Size"} {
+			if v := srcHeader.Get(h); v != "" {
+				headers[h] = v
+			}
+		}
+		return nil
+	}
+	resp := m.src.HeadObject(container, obj, nil)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HEAD %d", resp.StatusCode)
+	}
+	headers["X-Object-Sysmeta-Slo-Etag"] = strings.Trim(resp.Header.Get("Etag"), "\"")
+	headers["X-Object-Sysmeta-Slo-Size"] = resp.Header.Get("Content-Length")
+	return nil
+}
+
+// suffixSegments points the segments of a static large object manifest at
+// their containers' copies.
+func suffixSegments(manifest []byte, suffix string) ([]byte, error) {
+	var segments []map[string]json.RawMessage
+	if err := json.Unmarshal(manifest, &segments); err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		var name string
+		if err := json.Unmarshal(segment["name"], &name); err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid segment name %q", name)
+		}
+		encoded, err := json.Marshal("/" + parts[0] + suffix + "/" + parts[1])
+		if err != nil {
+			return nil, err
+		}
+		segment["name"] = encoded
+	}
+	return json.Marshal(segments)
+}
+
+func (m *migrator) copyObject(container string, obj *nectar.ObjectRecord) error {
+	resp := m.getSource(container, obj.Name)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Deleted since it was listed.
+		return nil
+	} else if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("GET %d", resp.StatusCode)
+	}
+	headers := map[string]string{}
+	for _, h := range migrateCopyHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+	for k := range resp.Header {
+		if strings.HasPrefix(k, "X-Object-Meta-") {
+			headers[k] = resp.Header.Get(k)
+		}
+	}
+	body := io.Reader(resp.Body)
+	if headers["X-Static-Large-Object"] != "" {
+		if err := m.sloSysmeta(container, obj.Name, resp.Header, headers); err != nil {
+			return err
+		}
+		if m.suffix != "" {
+			manifest, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if manifest, err = suffixSegments(manifest, m.suffix); err != nil {
+				return fmt.Errorf("Invalid manifest: %v", err)
+			}
+			body = bytes.NewReader(manifest)
+		}
+	} else if headers["X-Object-Manifest"] != "" {
+		if m.suffix != "" {
+			if parts := strings.SplitN(headers["X-Object-Manifest"], "/", 2); len(parts) == 2 {
+				headers["X-Object-Manifest"] = parts[0] + m.suffix + "/" + parts[1]
+			}
+		}
+	} else {
+		// The destination rejects the PUT if what arrives doesn't match.
+		headers["Etag"] = strings.Trim(resp.Header.Get("Etag"), "\"")
+	}
+	putResp := m.dst.PutObject(container+m.suffix, obj.Name, headers, body)
+	putResp.Body.Close()
+	if putResp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %d", putResp.StatusCode)
+	}
+	atomic.AddInt64(&m.copiedBytes, obj.Bytes)
+	return nil
+}
+
+func (m *migrator) migrateContainer(container string) bool {
+	marker, done := m.checkpoint.marker(container)
+	if done {
+		return true
+	}
+	resp := m.src.HeadContainer(container, nil)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		m.reportErrors(fmt.Sprintf("HEAD source container %s: %d", container, resp.StatusCode))
+		return false
+	}
+	headers := map[string]string{}
+	for k := range resp.Header {
+		if strings.HasPrefix(k, "X-Container-Meta-") || k == "X-Container-Read" || k == "X-Container-Write" || k == "X-Versions-Location" || k == "X-History-Location" {
+			headers[k] = resp.Header.Get(k)
+		}
+	}
+	if m.policy != "" {
+		headers["X-Storage-Policy"] = m.policy
+	}
+	resp = m.dst.PutContainer(container+m.suffix, headers)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		m.reportErrors(fmt.Sprintf("PUT destination container %s: %d", container+m.suffix, resp.StatusCode))
+		return false
+	}
+	srcList, dstList := clientLister(m.src), clientLister(m.dst)
+	ok := true
+	for {
+		objs, err := srcList(container, marker)
+		if err != nil {
+			m.reportErrors(err.Error())
+			return false
+		}
+		if len(objs) == 0 {
+			break
+		}
+		// Objects already at the destination with the same etag are left be,
+		// so rerunning a migration only copies what changed.
+		existing := map[string]string{}
+		for dstMarker := marker; ; {
+			dstObjs, err := dstList(container+m.suffix, dstMarker)
+			if err != nil {
+				m.reportErrors(err.Error())
+				return false
+			}
+			for _, o := range dstObjs {
+				existing[o.Name] = o.Hash
+			}
+			if len(dstObjs) < migrateListingLimit || dstObjs[len(dstObjs)-1].Name >= objs[len(objs)-1].Name {
+				break
+			}
+			dstMarker = dstObjs[len(dstObjs)-1].Name
+		}
+		work := make(chan *nectar.ObjectRecord)
+		var pageFailed int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < m.concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for obj := range work {
+					if hash, ok := existing[obj.Name]; ok && hash == obj.Hash {
+						atomic.AddInt64(&m.skipped, 1)
+						continue
+					}
+					if err := m.copyObject(container, obj); err != nil {
+						atomic.AddInt64(&m.failed, 1)
+						atomic.StoreInt32(&pageFailed, 1)
+						m.reportErrors(fmt.Sprintf("%s/%s: %v", container, obj.Name, err))
+						continue
+					}
+					atomic.AddInt64(&m.copied, 1)
+				}
+			}()
+		}
+		for _, obj := range objs {
+			work <- obj
+		}
+		close(work)
+		wg.Wait()
+		marker = objs[len(objs)-1].Name
+		if pageFailed != 0 {
+			ok = false
+		} else if ok {
+			// Only pages that copied completely move the checkpoint on.
+			if err := m.checkpoint.update(container, marker, false); err != nil {
+				m.reportErrors(fmt.Sprintf("Error saving checkpoint: %v", err))
+			}
+		}
+		if len(objs) < migrateListingLimit {
+			break
+		}
+	}
+	if ok {
+		if err := m.checkpoint.update(container, "", true); err != nil {
+			m.reportErrors(fmt.Sprintf("Error saving checkpoint: %v", err))
+		}
+	}
+	return ok
+}
+
+// Migrate copies an account, or a single container of it, from another
+// Swift or Hummingbird cluster into this one, or within this cluster into
+// containers of a different storage policy, then reports any differences
+// between the source and destination listings.
+func Migrate(flags *flag.FlagSet, cnf srv.ConfigLoader) bool {
+	account, onlyContainer, _ := parseArg0(flags.Arg(0))
+	if account == "" {
+		fmt.Println("Usage: hummingbird migrate [ARGS] ACCOUNT[/CONTAINER]")
+		return false
+	}
+	getString := func(name string) string {
+		return flags.Lookup(name).Value.(flag.Getter).Get().(string)
+	}
+	getBool := func(name string) bool {
+		return flags.Lookup(name).Value.(flag.Getter).Get().(bool)
+	}
+	dstAccount := getString("dst-account")
+	if dstAccount == "" {
+		dstAccount = account
+	}
+	m := &migrator{
+		suffix:      getString("container-suffix"),
+		policy:      getString("policy"),
+		concurrency: flags.Lookup("concurrency").Value.(flag.Getter).Get().(int),
+	}
+	if m.concurrency < 1 {
+		m.concurrency = 1
+	}
+	logger := zap.NewNop()
+	var err error
+	if authURL := getString("src-auth-url"); authURL != "" {
+		var resp *http.Response
+		if getBool("src-insecure") {
+			m.src, resp = nectar.NewInsecureClient(getString("src-tenant"), getString("src-user"), getString("src-password"), getString("src-key"), getString("src-region"), authURL, false)
+		} else {
+			m.src, resp = nectar.NewClient(getString("src-tenant"), getString("src-user"), getString("src-password"), getString("src-key"), getString("src-region"), authURL, false, nil)
+		}
+		if resp != nil {
+			msg, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			fmt.Println("Error authenticating with source cluster:", string(msg))
+			return false
+		}
+		m.srcRemote = true
+	} else {
+		if dstAccount == account && m.suffix == "" {
+			fmt.Println("Migrating within this cluster needs -dst-account or -container-suffix")
+			return false
+		}
+		if m.src, err = client.NewDirectClient(account, cnf, getString("certfile"), getString("keyfile"), logger); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if m.dst, err = client.NewDirectClient(dstAccount, cnf, getString("certfile"), getString("keyfile"), logger); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	m.src.SetUserAgent("migrate")
+	m.dst.SetUserAgent("migrate")
+	if m.checkpoint, err = loadMigrateCheckpoint(getString("checkpoint")); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	var errorLock sync.Mutex
+	m.reportErrors = func(msg string) {
+		errorLock.Lock()
+		fmt.Println("!!", msg)
+		errorLock.Unlock()
+	}
+	containers := []string{onlyContainer}
+	if onlyContainer == "" {
+		containers = nil
+		marker := ""
+		for {
+			page, resp := m.src.GetAccount(marker, "", migrateListingLimit, "", "", false, nil)
+			if resp.StatusCode/100 != 2 {
+				resp.Body.Close()
+				fmt.Printf("Error listing source account: %d\n", resp.StatusCode)
+				return false
+			}
+			for _, c := range page {
+				containers = append(containers, c.Name)
+			}
+			if len(page) < migrateListingLimit {
+				break
+			}
+			marker = page[len(page)-1].Name
+		}
+		resp := m.dst.HeadAccount(nil)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			resp = m.dst.PutAccount(nil)
+			resp.Body.Close()
+		}
+		if resp.StatusCode/100 != 2 {
+			fmt.Printf("Error creating destination account %s: %d\n", dstAccount, resp.StatusCode)
+			return false
+		}
+	}
+	pass := true
+	if !getBool("verify-only") {
+		for _, container := range containers {
+			if !m.migrateContainer(container) {
+				pass = false
+			}
+		}
+		fmt.Printf("Copied %d objects (%d bytes), skipped %d already present, %d failed\n", m.copied, m.copiedBytes, m.skipped, m.failed)
+	}
+	var diffs []*migrateDiff
+	for _, container := range containers {
+		diff, err := diffContainer(clientLister(m.src), clientLister(m.dst), container, container+m.suffix)
+		if err != nil {
+			fmt.Println("!!", err)
+			pass = false
+			continue
+		}
+		if !diff.matches() {
+			pass = false
+		}
+		diffs = append(diffs, diff)
+	}
+	if getBool("json") {
+		data, err := json.MarshalIndent(diffs, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		fmt.Println(string(data))
+		return pass
+	}
+	for _, diff := range diffs {
+		if diff.matches() {
+			fmt.Printf("%s: %d objects, all match\n", diff.Container, diff.Objects)
+			continue
+		}
+		fmt.Printf("%s: %d objects, %d missing, %d mismatched, %d extra\n", diff.Container, diff.Objects, len(diff.Missing), len(diff.Mismatch), len(diff.Extra))
+		for _, name := range diff.Missing {
+			fmt.Printf("  missing  %s\n", name)
+		}
+		for _, name := range diff.Mismatch {
+			fmt.Printf("  mismatch %s\n", name)
+		}
+		for _, name := range diff.Extra {
+			fmt.Printf("  extra    %s\n", name)
+		}
+	}
+	return pass
+}
@@ -0,0 +1,115 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/troubling/nectar"
+)
+
+func fakeLister(objs map[string]string) objectLister {
+	var names []string
+	for name := range objs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return func(container, marker string) ([]*nectar.ObjectRecord, error) {
+		var page []*nectar.ObjectRecord
+		for _, name := range names {
+			if name > marker && len(page) < migrateListingLimit {
+				page = append(page, &nectar.ObjectRecord{Name: name, Hash: objs[name], Bytes: 1})
+			}
+		}
+		return page, nil
+	}
+}
+
+func TestDiffContainer(t *testing.T) {
+	src := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}
+	dst := map[string]string{"a": "1", "c": "x", "d": "4", "e": "5"}
+	diff, err := diffContainer(fakeLister(src), fakeLister(dst), "c", "c")
+	require.Nil(t, err)
+	require.Equal(t, int64(4), diff.Objects)
+	require.Equal(t, []string{"b"}, diff.Missing)
+	require.Equal(t, []string{"c"}, diff.Mismatch)
+	require.Equal(t, []string{"e"}, diff.Extra)
+	require.False(t, diff.matches())
+
+	diff, err = diffContainer(fakeLister(src), fakeLister(src), "c", "c")
+	require.Nil(t, err)
+	require.True(t, diff.matches())
+}
+
+func TestDiffContainerPages(t *testing.T) {
+	src := map[string]string{}
+	for i := 0; i < migrateListingLimit+5; i++ {
+		src[fmt.Sprintf("%06d", i)] = "h"
+	}
+	dst := map[string]string{}
+	for k, v := range src {
+		dst[k] = v
+	}
+	delete(dst, fmt.Sprintf("%06d", migrateListingLimit+1))
+	diff, err := diffContainer(fakeLister(src), fakeLister(dst), "c", "c")
+	require.Nil(t, err)
+	require.Equal(t, int64(migrateListingLimit+5), diff.Objects)
+	require.Equal(t, []string{fmt.Sprintf("%06d", migrateListingLimit+1)}, diff.Missing)
+	require.Empty(t, diff.Extra)
+}
+
+func TestMigrateCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	cp, err := loadMigrateCheckpoint(path)
+	require.Nil(t, err)
+	require.Nil(t, cp.update("c1", "obj5", false))
+	require.Nil(t, cp.update("c2", "obj9", false))
+	require.Nil(t, cp.update("c2", "", true))
+
+	cp, err = loadMigrateCheckpoint(path)
+	require.Nil(t, err)
+	marker, done := cp.marker("c1")
+	require.Equal(t, "obj5", marker)
+	require.False(t, done)
+	marker, done = cp.marker("c2")
+	require.Equal(t, "", marker)
+	require.True(t, done)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("garbage"), 0600))
+	_, err = loadMigrateCheckpoint(path)
+	require.NotNil(t, err)
+}
+
+func TestSuffixSegments(t *testing.T) {
+	manifest, err := suffixSegments([]byte(`[{"name":"/segs/a/1","hash":"h1","bytes":10},{"name":"/segs/a/2","hash":"h2","bytes":5,"range":"0-1"}]`), "-new")
+	require.Nil(t, err)
+	require.Equal(t, `[{"bytes":10,"hash":"h1","name":"/segs-new/a/1"},{"bytes":5,"hash":"h2","name":"/segs-new/a/2","range":"0-1"}]`, string(manifest))
+
+	_, err = suffixSegments([]byte(`[{"name":"nocontainer"}]`), "-new")
+	require.NotNil(t, err)
+	_, err = suffixSegments([]byte(`garbage`), "-new")
+	require.NotNil(t, err)
+}
@@ -16,9 +16,7 @@
 package tools
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -30,171 +28,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/troubling/hummingbird/common/recon"
 )
 
-func TestReconReportTimeFail(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/hummingbirdtime", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		io.WriteString(w, "{\"time\": \"2017-11-17T18:57:32.276688312Z\"}")
-	}))
-	defer ts.Close()
-
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	servers := []*ipPort{{ip: host, port: port}}
-	client := &http.Client{Timeout: 10 * time.Second}
-	require.Equal(t, false, getTimeReport(client, servers).Passed())
-}
-
-func TestReconReportTimePass(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/hummingbirdtime", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := map[string]time.Time{"time": time.Now()}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts.Close()
-
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	servers := []*ipPort{{ip: host, port: port, scheme: "http"}}
-	client := &http.Client{Timeout: 10 * time.Second}
-	require.Equal(t, true, getTimeReport(client, servers).Passed())
-}
-
-func TestReconReportRingMd5Fail(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/ringmd5", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := map[string]string{"/a/object.ring.gz": "abcde"}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts.Close()
-
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	require.Equal(t, false, getRingMD5Report(
-		client,
-		map[string]string{"/a/object.ring.gz": "abcdf"},
-		map[string]map[string]*ipPort{fmt.Sprintf("%s:%d", host, port): {"object.ring.gz": {ip: host, port: port, scheme: "http"}}},
-	).Passed())
-}
-
-func TestReconReportRingMd5Pass(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/ringmd5", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := map[string]string{"/a/object.ring.gz": "abcde"}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts.Close()
-
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	require.Equal(t, true, getRingMD5Report(
-		client,
-		map[string]string{"/a/object.ring.gz": "abcde"},
-		map[string]map[string]*ipPort{fmt.Sprintf("%s:%d", host, port): {"object.ring.gz": {ip: host, port: port, scheme: "http"}}},
-	).Passed())
-}
-
-func TestReconReportQuarantine(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/quarantined", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := quarData{Accounts: 0, Containers: 5, Objects: 10}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts.Close()
-
-	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/quarantined", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := quarData{Accounts: 0, Containers: 5, Objects: 20}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts1.Close()
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	u, _ = url.Parse(ts1.URL)
-	host1, ports1, _ := net.SplitHostPort(u.Host)
-	host1 = "0" + host1 // force it to seem like another server
-	port1, _ := strconv.Atoi(ports1)
-
-	servers := []*ipPort{{ip: host, port: port, scheme: "http"}, {ip: host1, port: port1, scheme: "http"}}
-	client := &http.Client{Timeout: 10 * time.Second}
-	report := getQuarantineReport(client, servers)
-	require.Equal(t, true, report.Passed())
-	out := report.String()
-	require.True(t, strings.Contains(out, "[quarantined_account] low: 0, high: 0, avg: 0.0"))
-	require.True(t, strings.Contains(out, "[quarantined_container] low: 5, high: 5, avg: 5.0, total: 10"))
-	require.True(t, strings.Contains(out, "[quarantined_objects] low: 10, high: 20, avg: 15.0, total: 30, Failed: 0.0"))
-}
-
 func TestReconQuarantineDetailReport(t *testing.T) {
 	t.Parallel()
 	handlersRun := 0
@@ -294,7 +130,7 @@ func TestReconQuarantineDetailReport(t *testing.T) {
 	host1 = "0" + host1 // force it to seem like another server
 	port1, _ := strconv.Atoi(ports1)
 
-	servers := []*ipPort{{ip: host, port: port, scheme: "http"}, {ip: host1, port: port1, scheme: "http"}}
+	servers := []*recon.Server{{IP: host, Port: port, Scheme: "http"}, {IP: host1, Port: port1, Scheme: "http"}}
 	client := &http.Client{Timeout: 10 * time.Second}
 	report := getQuarantineDetailReport(client, servers)
 	require.Equal(t, true, report.Passed(), report.String())
@@ -323,56 +159,3 @@ objects-1
 	require.True(t, strings.Contains(out, look), fmt.Sprintf("\n%q\n%q", out, look))
 	require.Equal(t, handlersRun, 2)
 }
-
-func TestReconReportAsync(t *testing.T) {
-	t.Parallel()
-
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/async", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := map[string]int{"async_pending": 50}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts.Close()
-
-	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
-		r *http.Request) {
-
-		require.Equal(t, "/recon/async", r.URL.Path)
-		if _, err := ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(500)
-			return
-		}
-		w.WriteHeader(200)
-		content := map[string]int{"async_pending": 100}
-		serialized, _ := json.MarshalIndent(content, "", "  ")
-		w.Write(serialized)
-	}))
-	defer ts1.Close()
-	u, _ := url.Parse(ts.URL)
-	host, ports, _ := net.SplitHostPort(u.Host)
-	port, _ := strconv.Atoi(ports)
-
-	u, _ = url.Parse(ts1.URL)
-	host1, ports1, _ := net.SplitHostPort(u.Host)
-	port1, _ := strconv.Atoi(ports1)
-
-	servers := map[string]*ipPort{"a": {ip: host, port: port, scheme: "http"}, "b": {ip: host1, port: port1, scheme: "http"}}
-	client := &http.Client{Timeout: 10 * time.Second}
-	report := &asyncReport{
-		Name:  "Async Pending Report",
-		Time:  time.Now().UTC(),
-		Stats: map[int]map[string]int{},
-	}
-	getAsyncReportHelper(client, report, servers, 0)
-	require.Equal(t, 0, len(report.Errors))
-	out := report.String()
-	require.True(t, strings.Contains(out, "[async_pending] low: 50, high: 100, avg: 75.0, total: 150, Failed: 0.0%, no_result: 0, reported: 2"))
-}
@@ -31,11 +31,11 @@ import (
 
 func PrintDevs(devs []*ring.RingBuilderDevice) {
 	data := make([][]string, 0)
-	data = append(data, []string{"ID", "REGION", "ZONE", "SCHEME", "IP ADDRESS", "PORT", "REPLICATION IP", "REPLICATION PORT", "NAME", "WEIGHT", "PARTITIONS", "META"})
+	data = append(data, []string{"ID", "REGION", "ZONE", "SCHEME", "IP ADDRESS", "PORT", "REPLICATION IP", "REPLICATION PORT", "NAME", "WEIGHT", "PARTITIONS", "META", "ATTRIBUTES"})
 	data = append(data, nil)
 	for _, dev := range devs {
 		if dev != nil {
-			data = append(data, []string{strconv.FormatInt(dev.Id, 10), strconv.FormatInt(dev.Region, 10), strconv.FormatInt(dev.Zone, 10), dev.Scheme, dev.Ip, strconv.FormatInt(dev.Port, 10), dev.ReplicationIp, strconv.FormatInt(dev.ReplicationPort, 10), dev.Device, strconv.FormatFloat(dev.Weight, 'f', -1, 64), strconv.FormatInt(dev.Parts, 10), dev.Meta})
+			data = append(data, []string{strconv.FormatInt(dev.Id, 10), strconv.FormatInt(dev.Region, 10), strconv.FormatInt(dev.Zone, 10), dev.Scheme, dev.Ip, strconv.FormatInt(dev.Port, 10), dev.ReplicationIp, strconv.FormatInt(dev.ReplicationPort, 10), dev.Device, strconv.FormatFloat(dev.Weight, 'f', -1, 64), strconv.FormatInt(dev.Parts, 10), dev.Meta, ring.FormatAttributes(dev.Attributes)})
 		}
 	}
 	fmt.Println(brimtext.Align(data, brimtext.NewSimpleAlignOptions()))
@@ -103,6 +103,32 @@ func RingBuildCmd(flags *flag.FlagSet) {
 		}
 		return
 
+	case "apply":
+		applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+		dryrun := applyFlags.Bool("dryrun", false, "A dry run will show the changes but not make them.")
+		if err := applyFlags.Parse(args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if applyFlags.NArg() < 1 {
+			flags.Usage()
+			os.Exit(1)
+		}
+		changes, err := ring.Apply(pth, applyFlags.Arg(0), debug, *dryrun)
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			fmt.Println("The ring already matches the declaration.")
+		} else if *dryrun {
+			fmt.Println("Dry run complete; no changes were saved.")
+		}
+		return
+
 	case "pretend_min_part_hours_passed":
 		ring.PretendMinPartHoursPassed(pth)
 		return
@@ -165,10 +191,16 @@ func RingBuildCmd(flags *flag.FlagSet) {
 		newRepPort := changeFlags.Int64("change-replication-port", -1, "New replication port.")
 		newDevice := changeFlags.String("change-device", "", "New device name.")
 		newMeta := changeFlags.String("change-meta", "", "New meta data.")
+		newAttrs := changeFlags.String("change-attributes", "", "Attributes to set, as key=value,... (key= removes one).")
 		if err := changeFlags.Parse(args[2:]); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		attrs, err := ring.ParseAttributes(*newAttrs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		devs, err := ring.Search(pth, *region, *zone, *ip, *port, *repIp, *repPort, *device, *weight, *meta, *scheme)
 		if err != nil {
 			fmt.Println(err)
@@ -194,6 +226,9 @@ func RingBuildCmd(flags *flag.FlagSet) {
 				}
 			}
 			err := ring.SetInfo(pth, devs, *newIp, *newPort, *newRepIp, *newRepPort, *newDevice, *newMeta, *newScheme)
+			if err == nil && len(attrs) > 0 {
+				err = ring.SetAttributes(pth, devs, attrs)
+			}
 			if err != nil {
 				fmt.Println(err)
 			} else {
@@ -261,6 +296,83 @@ func RingBuildCmd(flags *flag.FlagSet) {
 			}
 		}
 
+	case "ramp":
+		rampFlags := flag.NewFlagSet("ramp", flag.ExitOnError)
+		region := rampFlags.Int64("region", -1, "Device region.")
+		zone := rampFlags.Int64("zone", -1, "Device zone.")
+		scheme := rampFlags.String("scheme", "", "URI scheme(http/https)")
+		ip := rampFlags.String("ip", "", "Device ip address.")
+		port := rampFlags.Int64("port", -1, "Device port.")
+		repIp := rampFlags.String("replication-ip", "", "Device replication address.")
+		repPort := rampFlags.Int64("replication-port", -1, "Device replication port.")
+		device := rampFlags.String("device", "", "Device name.")
+		weight := rampFlags.Float64("weight", -1.0, "Device weight.")
+		meta := rampFlags.String("meta", "", "Metadata.")
+		steps := rampFlags.Int("steps", 4, "Number of rebalances to reach the new weight in.")
+		yes := rampFlags.Bool("yes", false, "Force yes.")
+		if err := rampFlags.Parse(args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		args := rampFlags.Args()
+		if len(args) < 1 {
+			rampFlags.Usage()
+			os.Exit(1)
+		}
+		newWeight, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		devs, err := ring.Search(pth, *region, *zone, *ip, *port, *repIp, *repPort, *device, *weight, *meta, *scheme)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(devs) == 0 {
+			fmt.Println("No matching devices found.")
+			return
+		}
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Println("Search matched the following devices:")
+		PrintDevs(devs)
+		if !*yes {
+			fmt.Printf("Are you sure you want to ramp the weight to %.2f in %d steps for these %d devices (y/n)? ", newWeight, *steps, len(devs))
+			resp, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if resp[0] != 'y' && resp[0] != 'Y' {
+				fmt.Println("No devices updated.")
+				return
+			}
+		}
+		if err := ring.SetWeightRamp(pth, devs, newWeight, *steps); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fallthrough
+
+	case "ramp_step":
+		changes, err := ring.StepWeightRampsFile(pth)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if len(changes) == 0 {
+			fmt.Println("No weights were ramped; either none are pending or min_part_hours haven't passed since the last rebalance.")
+			return
+		}
+		if _, _, _, err := ring.Rebalance(pth, debug, false, false); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+
 	case "remove":
 		removeFlags := flag.NewFlagSet("set_weight", flag.ExitOnError)
 		region := removeFlags.Int64("region", -1, "Device region.")
@@ -10,6 +10,10 @@ package tools
 // initial_delay = 1      # seconds to wait between ring checks for the first pass
 // pass_time_target = 60  # seconds to try to make subsequent passes take
 // report_interval = 600  # seconds between progress reports
+//
+// Each scheduled rebalance first takes the next step of any weight ramps set
+// with "hummingbird ring <builder> ramp", and rebalances are kept scheduled,
+// min_part_hours apart, until the ramps are done.
 
 import (
 	"fmt"
@@ -316,6 +320,14 @@ func (rm *ringMonitor) rebalance(logger *zap.Logger, ringTask *ringTaskInstance)
 		logger.Error("Could not find builder after lock", zap.Error(err))
 		return false
 	}
+	ramped, err := ring.StepWeightRampsFile(ringBuilderFilePath)
+	if err != nil {
+		logger.Error("Error while ramping weights", zap.String("path", ringBuilderFilePath), zap.Error(err))
+		return false
+	}
+	for _, change := range ramped {
+		rm.aa.db.addRingLog(ringTask.typ, ringTask.policy, change)
+	}
 	var changedReplicas int
 	changedReplicas, _, _, err = ring.Rebalance(ringBuilderFilePath, false, false, true)
 	if err != nil {
@@ -329,6 +341,12 @@ func (rm *ringMonitor) rebalance(logger *zap.Logger, ringTask *ringTaskInstance)
 	}
 	// So we don't get stuck rebalancing a ring by tiny amounts for forever:
 	settled := float64(changedReplicas)/(float64(ringBuilder.Parts)*ringBuilder.Replicas) < 0.01
+	if settled {
+		// Devices still ramping need more rebalances even if this one was small.
+		if ramps, err := ring.LoadWeightRamps(ringBuilderFilePath); err != nil || len(ramps) > 0 {
+			settled = false
+		}
+	}
 	if settled {
 		for _, dev := range ringTask.ring.AllDevices() {
 			if dev == nil {
@@ -0,0 +1,115 @@
+//  Copyright (c) 2018 Rackspace
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+//  implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/troubling/hummingbird/client"
+	"github.com/troubling/hummingbird/common/conf"
+	"github.com/troubling/hummingbird/common/srv"
+	"github.com/troubling/hummingbird/proxyserver/middleware"
+	"go.uber.org/zap"
+)
+
+// SloVerify checks that every segment of the SLO manifest given as
+// account/container/object still exists with the etag and size the manifest
+// expects, talking directly to the backend servers.
+func SloVerify(flags *flag.FlagSet, cnf srv.ConfigLoader) bool {
+	account, container, object := parseArg0(flags.Arg(0))
+	if account == "" || container == "" || object == "" {
+		fmt.Println("Usage: hummingbird slo-verify [ARGS] ACCOUNT/CONTAINER/OBJECT")
+		return false
+	}
+	policies, err := cnf.GetPolicies()
+	if err != nil {
+		fmt.Println("Unable to load policies:", err)
+		return false
+	}
+	certFile := flags.Lookup("certfile").Value.(flag.Getter).Get().(string)
+	keyFile := flags.Lookup("keyfile").Value.(flag.Getter).Get().(string)
+	logger := zap.NewNop()
+	pdc, err := client.NewProxyClient(policies, cnf, logger, certFile, keyFile, "", "", "", conf.Config{})
+	if err != nil {
+		fmt.Println("Could not make client:", err)
+		return false
+	}
+	defer pdc.Close()
+	c := pdc.NewRequestClient(nil, nil, logger)
+	c.SetUserAgent("slo-verify")
+	getManifest := func(container, object string) (int, io.Reader) {
+		resp := c.GetObject(context.Background(), account, container, object, http.Header{})
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return resp.StatusCode, nil
+		}
+		if resp.Header.Get("X-Static-Large-Object") != "True" {
+			return http.StatusBadRequest, nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return http.StatusInternalServerError, nil
+		}
+		return resp.StatusCode, bytes.NewReader(body)
+	}
+	status, manifest := getManifest(container, object)
+	if status == http.StatusBadRequest {
+		fmt.Printf("%s/%s/%s is not an SLO manifest\n", account, container, object)
+		return false
+	} else if status/100 != 2 {
+		fmt.Printf("Error fetching manifest %s/%s/%s: %d %s\n", account, container, object, status, http.StatusText(status))
+		return false
+	}
+	report, err := middleware.VerifySloManifest(container+"/"+object, manifest,
+		func(container, object string) (int, http.Header) {
+			resp := c.HeadObject(context.Background(), account, container, object, http.Header{})
+			resp.Body.Close()
+			return resp.StatusCode, resp.Header
+		}, getManifest)
+	if err != nil {
+		fmt.Println("Invalid manifest:", err)
+		return false
+	}
+	if flags.Lookup("json").Value.(flag.Getter).Get().(bool) {
+		byts, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		fmt.Println(string(byts))
+		return report.Valid()
+	}
+	for _, e := range report.Errors {
+		if e.Status != 0 {
+			fmt.Printf("!! %s: segment %s: %d %s\n", e.Manifest, e.Segment, e.Status, e.Reason)
+		} else {
+			fmt.Printf("!! %s: segment %s: %s\n", e.Manifest, e.Segment, e.Reason)
+		}
+	}
+	if report.Valid() {
+		fmt.Printf("%s/%s/%s: %d segments, %d bytes, all present\n", account, container, object, report.Segments, report.Bytes)
+	} else {
+		fmt.Printf("%s/%s/%s: %d of %d segments broken\n", account, container, object, len(report.Errors), report.Segments)
+	}
+	return report.Valid()
+}